@@ -0,0 +1,613 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/cupsclient"
+)
+
+// The first line of __complete output tells the shell script whether to
+// offer the candidates that follow or complete file names itself.
+const (
+	modeWords = "words"
+	modeFiles = "files"
+)
+
+// completionTimeout bounds each scheduler query so a dead server does not
+// hang the shell.
+const completionTimeout = 2 * time.Second
+
+type argKind int
+
+const (
+	argNone argKind = iota
+	argText
+	argServer
+	argUser
+	argFile
+	argChoice
+	argDest
+	argPrinter
+	argClass
+	argJob
+	argOption
+	argOptionName
+)
+
+// argSpec is what an option value or operand may be; Choices are the
+// values of an argChoice.
+type argSpec struct {
+	kinds   []argKind
+	choices []string
+}
+
+func (a argSpec) takesValue() bool {
+	return len(a.kinds) > 0 && a.kinds[0] != argNone
+}
+
+func (a argSpec) has(kind argKind) bool {
+	for _, k := range a.kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// toolSpec describes a tool's command line for completion.
+type toolSpec struct {
+	flags map[string]argSpec
+	// args are the operand kinds in order; the last one repeats.
+	args []argSpec
+}
+
+var kindNames = map[string]argKind{
+	"text": argText, "server": argServer, "user": argUser, "file": argFile,
+	"dest": argDest, "printer": argPrinter, "class": argClass, "job": argJob,
+	"option": argOption, "optname": argOptionName,
+}
+
+// parseArg reads "kind", "kind|kind" or "{a|b|c}".
+func parseArg(s string) argSpec {
+	if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+		return argSpec{kinds: []argKind{argChoice}, choices: strings.Split(s[1:len(s)-1], "|")}
+	}
+	var spec argSpec
+	for _, name := range strings.Split(s, "|") {
+		kind, ok := kindNames[name]
+		if !ok {
+			panic("cups: unknown argument kind " + name)
+		}
+		spec.kinds = append(spec.kinds, kind)
+	}
+	return spec
+}
+
+// spec builds a toolSpec from "-f -o=kind ..." flags and operand kinds.
+func spec(flags string, args ...string) toolSpec {
+	t := toolSpec{flags: map[string]argSpec{}}
+	for _, f := range strings.Fields(flags) {
+		name, kind, ok := strings.Cut(f, "=")
+		if !ok {
+			t.flags[name] = argSpec{}
+			continue
+		}
+		t.flags[name] = parseArg(kind)
+	}
+	for _, a := range args {
+		t.args = append(t.args, parseArg(a))
+	}
+	return t
+}
+
+const (
+	connFlags   = "-E -h=server -U=user"
+	formatFlag  = "--format={json|yaml|csv}"
+	holdChoices = "{indefinite|no-hold|day-time|evening|night|second-shift|third-shift|weekend}"
+)
+
+// specs mirror each tool's parseArgs; TestSpecsMatchParseArgs runs the
+// tools to keep them in step.
+var specs = map[string]toolSpec{
+	"cancel":      spec(connFlags+" -a -u=user -x", "job|dest"),
+	"cupsaccept":  spec(connFlags+" -r=text", "dest"),
+	"cupsreject":  spec(connFlags+" -r=text", "dest"),
+	"cupsenable":  spec(connFlags+" -r=text -c --release", "dest"),
+	"cupsdisable": spec(connFlags+" -r=text -c --hold", "dest"),
+	"cupsctl": spec(connFlags+" --debug-logging --no-debug-logging --remote-admin --no-remote-admin"+
+		" --remote-any --no-remote-any --share-printers --no-share-printers --user-cancel-any --no-user-cancel-any"+
+		" --preserve-job-history --no-preserve-job-history --preserve-job-files --no-preserve-job-files --dump-effective", "text"),
+	"cupsfilter": spec("--list-filters -D -P=file -U=user -d=printer -i=text -j=job -m=text -n=text -o=option -p=file -t=text", "file"),
+	"cupstestppd": spec("-I={filename|filters|none|profiles} -R=file -q -r -v -vv"+
+		" -W={all|none|constraints|defaults|duplex|filters|profiles|sizes|translations}", "file"),
+	"cupstop": spec(connFlags+" -W={not-completed|completed|all} -i=text", "dest"),
+	"ippeveprinter": spec("--fault={offline|media-jam|media-empty} -2 -M=text -d=file -f=text -l=text -m=text"+
+		" -n=text -p=text -r={off} -s=text -v", "text"),
+	"ippfind": spec("-4 -6 -T=text -V={1.1|2.0|2.1|2.2} -P=text -d=text -h=text -l -N=text -p -q -r -s -t=text -u=text -x=file"+
+		" --domain=text --exec=file --host=text --local --ls --name=text --path=text --port=text --print --print-name"+
+		" --quiet --remote --txt=text --uri=text --not --false --true", "text"),
+	"ipptool": spec("--junit=file --stop-after-include-error --version -4 -6 -C -E -I -L -P=file -S -T=text"+
+		" -V={1.1|2.0|2.1|2.2} -X -c -d=text -f=file -h -i=text -l -n=text -q -t -v", "text", "file"),
+	"lp": spec(connFlags+" -c -d=dest -f=text -y=text -S=text -T=text -i=job -m -w -n=text -o=option -p=text -q=text"+
+		" -s -t=text -H="+holdChoices+" -P=text", "file"),
+	"lpadmin": spec(connFlags + " -u=text -A=file -I=text -p=printer -v=text -m=text -P=file -i=file -o=option" +
+		" -R=optname -D=text -L=text -c=class -r=class -d=dest -x=dest --auto"),
+	"lpc":       spec("", "{status|help}", "dest"),
+	"lpinfo":    spec("-E -h=server -v -m -l --device-id=text --exclude-schemes=text --include-schemes=text --language=text --make-and-model=text --product=text --timeout=text " + formatFlag),
+	"lpmove":    spec(connFlags, "job|dest", "dest"),
+	"lpoptions": spec(connFlags + " -p=dest -d=dest -l -o=option -r=optname -x=dest " + formatFlag),
+	"lpq":       spec(connFlags+" -a -l -P=dest "+formatFlag, "text"),
+	"lpr": spec("-E -H=server -U=user -#=text -C=text -J=text -T=text -P=dest -o=option -l -p -h -m -q -r -s"+
+		" -1=text -2=text -3=text -4=text -i=text -w=text", "file"),
+	"lprm": spec(connFlags+" - -P=dest", "job"),
+	"lpstat": spec("-a -c -d -e -f -h=server -H -l -o -p -P -r -R -s -S -t -u -U=user -v -D -E"+
+		" -W={completed|not-completed|successful|all} --audit "+formatFlag, "dest"),
+}
+
+// connection is where a command line points: its server, user and
+// encryption options.
+type connection struct {
+	server  string
+	user    string
+	encrypt bool
+}
+
+// source answers completion queries. The scheduler implementation is
+// replaced in tests.
+type source interface {
+	// destinations lists printers and classes as name, description and
+	// whether the entry is a class or the default.
+	destinations() []destination
+	jobs() []candidate
+	ppd(dest string) *config.PPD
+}
+
+type destination struct {
+	name, info       string
+	class, isDefault bool
+}
+
+// candidate is a value with an optional description shown by zsh and fish.
+type candidate struct {
+	value, desc string
+}
+
+func (c candidate) String() string {
+	if c.desc == "" {
+		return c.value
+	}
+	return c.value + "\t" + c.desc
+}
+
+// complete returns the output mode and candidates for words, the command
+// line up to the cursor with the word being completed last.
+func complete(newSource func(connection) source, words []string) (string, []string) {
+	if len(words) < 2 {
+		return modeWords, nil
+	}
+	if _, ok := tools[toolName(words[0])]; !ok {
+		if len(words) == 2 {
+			return modeWords, format(matching(words[1], "", plain(append(toolNames(), "completion", "--list", "--install", "--help")...)...))
+		}
+		switch words[1] {
+		case "completion":
+			if len(words) == 3 {
+				return modeWords, format(matching(words[2], "", plain("bash", "zsh", "fish")...))
+			}
+			return modeWords, nil
+		case "--install":
+			return modeFiles, nil
+		}
+		if _, ok := tools[words[1]]; !ok {
+			return modeWords, nil
+		}
+		words = words[1:]
+	}
+	t := specs[toolName(words[0])]
+	cur := words[len(words)-1]
+	st := t.scan(words[1 : len(words)-1])
+	c := &completer{newSource: newSource, st: st}
+
+	if st.pending != nil {
+		return c.values(*st.pending, cur, "")
+	}
+	if !st.endOfOptions && strings.HasPrefix(cur, "-") {
+		if strings.HasPrefix(cur, "--") {
+			if name, value, ok := strings.Cut(cur, "="); ok {
+				if f, known := t.flags[name]; known && f.takesValue() {
+					return c.values(f, value, name+"=")
+				}
+				return modeWords, nil
+			}
+		} else if len(cur) > 2 {
+			if f, known := t.flags[cur[:2]]; known && f.takesValue() {
+				return c.values(f, cur[2:], cur[:2])
+			}
+		}
+		names := make([]string, 0, len(t.flags))
+		for name := range t.flags {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return modeWords, format(matching(cur, "", plain(names...)...))
+	}
+	if len(t.args) == 0 {
+		return modeWords, nil
+	}
+	arg := t.args[min(st.operands, len(t.args)-1)]
+	return c.values(arg, cur, "")
+}
+
+// scanState is what the words before the cursor establish.
+type scanState struct {
+	conn connection
+	// dest is the last destination or printer named by an option, for
+	// option completion.
+	dest         string
+	pending      *argSpec
+	operands     int
+	endOfOptions bool
+}
+
+func (t toolSpec) scan(words []string) scanState {
+	var st scanState
+	apply := func(f argSpec, value string) {
+		switch {
+		case f.has(argServer):
+			st.conn.server = value
+		case f.has(argUser):
+			st.conn.user = value
+		case f.has(argDest), f.has(argPrinter):
+			st.dest = value
+		}
+	}
+	for _, w := range words {
+		if st.pending != nil {
+			apply(*st.pending, w)
+			st.pending = nil
+			continue
+		}
+		if st.endOfOptions || !strings.HasPrefix(w, "-") || w == "-" && !hasFlag(t, "-") {
+			st.operands++
+			continue
+		}
+		if w == "--" {
+			st.endOfOptions = true
+			continue
+		}
+		if f, ok := t.flags[w]; ok {
+			if w == "-E" {
+				st.conn.encrypt = true
+			}
+			if f.takesValue() {
+				st.pending = &f
+			}
+			continue
+		}
+		if strings.HasPrefix(w, "--") {
+			if name, value, ok := strings.Cut(w, "="); ok {
+				apply(t.flags[name], value)
+			}
+			continue
+		}
+		if f, ok := t.flags[w[:2]]; ok && f.takesValue() {
+			apply(f, w[2:])
+		}
+	}
+	return st
+}
+
+func hasFlag(t toolSpec, name string) bool {
+	_, ok := t.flags[name]
+	return ok
+}
+
+type completer struct {
+	newSource func(connection) source
+	st        scanState
+	src       source
+}
+
+func (c *completer) source() source {
+	if c.src == nil {
+		c.src = c.newSource(c.st.conn)
+	}
+	return c.src
+}
+
+// values completes cur as a value of arg; prefix is an option attached to
+// the same word.
+func (c *completer) values(arg argSpec, cur, prefix string) (string, []string) {
+	var out []candidate
+	for _, kind := range arg.kinds {
+		switch kind {
+		case argFile:
+			if prefix == "" {
+				return modeFiles, nil
+			}
+		case argChoice:
+			out = append(out, plain(arg.choices...)...)
+		case argDest, argPrinter, argClass:
+			for _, d := range c.source().destinations() {
+				if kind == argPrinter && d.class || kind == argClass && !d.class {
+					continue
+				}
+				out = append(out, candidate{value: d.name, desc: d.info})
+			}
+		case argJob:
+			out = append(out, c.source().jobs()...)
+		case argOption, argOptionName:
+			name, value, hasValue := strings.Cut(cur, "=")
+			if kind == argOption && hasValue {
+				return modeWords, format(matching(value, prefix+name+"=", c.optionValues(name)...))
+			}
+			out = append(out, c.optionNames(kind == argOption)...)
+		}
+	}
+	return modeWords, format(matching(cur, prefix, out...))
+}
+
+// standardOptions are the IPP job template options lp -o takes, with the
+// PPD option their values come from when the printer has one.
+var standardOptions = []struct {
+	name   string
+	ppd    string
+	values []candidate
+}{
+	{name: "copies"},
+	{name: "fit-to-page"},
+	{name: "job-hold-until", values: plain(strings.Split(strings.Trim(holdChoices, "{}"), "|")...)},
+	{name: "job-preset-name"},
+	{name: "job-priority"},
+	{name: "job-sheets", values: plain("none", "standard", "classified", "confidential", "secret", "topsecret", "unclassified")},
+	{name: "landscape"},
+	{name: "media", ppd: "PageSize"},
+	{name: "media-source", ppd: "InputSlot"},
+	{name: "media-type", ppd: "MediaType"},
+	{name: "number-up", values: plain("1", "2", "4", "6", "9", "16")},
+	{name: "orientation-requested", values: []candidate{{"3", "portrait"}, {"4", "landscape"}, {"5", "reverse-landscape"}, {"6", "reverse-portrait"}}},
+	{name: "output-bin", ppd: "OutputBin"},
+	{name: "page-ranges"},
+	{name: "print-color-mode", values: plain("auto", "color", "monochrome")},
+	{name: "print-quality", values: []candidate{{"3", "draft"}, {"4", "normal"}, {"5", "high"}}},
+	{name: "printer-resolution", ppd: "Resolution"},
+	{name: "sides", values: plain("one-sided", "two-sided-long-edge", "two-sided-short-edge")},
+}
+
+// optionNames lists the standard options and the PPD options of the
+// destination; withEquals appends "=" to those that take a value.
+func (c *completer) optionNames(withEquals bool) []candidate {
+	suffix := ""
+	if withEquals {
+		suffix = "="
+	}
+	var out []candidate
+	seen := map[string]bool{}
+	for _, o := range standardOptions {
+		s := suffix
+		if o.name == "landscape" || o.name == "fit-to-page" {
+			s = ""
+		}
+		out = append(out, candidate{value: o.name + s})
+		seen[strings.ToLower(o.name)] = true
+	}
+	if ppd := c.ppd(); ppd != nil {
+		keywords := make([]string, 0, len(ppd.OptionDetails))
+		for keyword := range ppd.OptionDetails {
+			keywords = append(keywords, keyword)
+		}
+		sort.Strings(keywords)
+		for _, keyword := range keywords {
+			if seen[strings.ToLower(keyword)] || strings.EqualFold(keyword, "PageRegion") {
+				continue
+			}
+			out = append(out, candidate{value: keyword + suffix, desc: ppd.OptionDetails[keyword].Text})
+		}
+	}
+	return out
+}
+
+// optionValues lists the values of option name: the PPD choices of the
+// option or the PPD option behind a standard one, else fixed values.
+func (c *completer) optionValues(name string) []candidate {
+	ppdName := name
+	var fixed []candidate
+	for _, o := range standardOptions {
+		if strings.EqualFold(o.name, name) {
+			ppdName, fixed = o.ppd, o.values
+		}
+	}
+	if ppdName != "" {
+		if ppd := c.ppd(); ppd != nil {
+			for keyword, opt := range ppd.OptionDetails {
+				if !strings.EqualFold(keyword, ppdName) {
+					continue
+				}
+				var out []candidate
+				for _, choice := range opt.Choices {
+					out = append(out, candidate{value: choice.Choice, desc: choice.Text})
+				}
+				return out
+			}
+		}
+	}
+	return fixed
+}
+
+// ppd is the PPD of the destination on the command line, else of the
+// default destination.
+func (c *completer) ppd() *config.PPD {
+	dest := c.st.dest
+	if dest == "" {
+		for _, d := range c.source().destinations() {
+			if d.isDefault {
+				dest = d.name
+			}
+		}
+	}
+	if dest == "" {
+		return nil
+	}
+	dest, _, _ = strings.Cut(dest, "/")
+	return c.source().ppd(dest)
+}
+
+func plain(values ...string) []candidate {
+	out := make([]candidate, 0, len(values))
+	for _, v := range values {
+		out = append(out, candidate{value: v})
+	}
+	return out
+}
+
+// matching keeps the candidates starting with cur and puts prefix in
+// front of each.
+func matching(cur, prefix string, all ...candidate) []candidate {
+	var out []candidate
+	for _, c := range all {
+		if strings.HasPrefix(strings.ToLower(c.value), strings.ToLower(cur)) {
+			c.value = prefix + c.value
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func format(cands []candidate) []string {
+	out := make([]string, 0, len(cands))
+	for _, c := range cands {
+		out = append(out, c.String())
+	}
+	return out
+}
+
+// serverSource queries the scheduler with the command line's connection
+// options, falling back to client.conf and the environment like the tools.
+type serverSource struct {
+	client *cupsclient.Client
+	dests  []destination
+	loaded bool
+}
+
+func newServerSource(conn connection) source {
+	return &serverSource{client: cupsclient.NewFromConfig(
+		cupsclient.WithServer(conn.server),
+		cupsclient.WithTLS(conn.encrypt),
+		cupsclient.WithUser(conn.user),
+	)}
+}
+
+func (s *serverSource) request(op goipp.Op, attrs ...string) *goipp.Message {
+	req := goipp.NewRequest(goipp.DefaultVersion, op, uint32(time.Now().UnixNano()))
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	if len(attrs) > 0 {
+		vals := make([]goipp.Value, 0, len(attrs))
+		for _, a := range attrs {
+			vals = append(vals, goipp.String(a))
+		}
+		req.Operation.Add(goipp.MakeAttr("requested-attributes", goipp.TagKeyword, vals[0], vals[1:]...))
+	}
+	return req
+}
+
+func (s *serverSource) send(req *goipp.Message) (*goipp.Message, []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), completionTimeout)
+	defer cancel()
+	resp, payload, err := s.client.SendWithPayload(ctx, req, nil)
+	if err != nil || goipp.Status(resp.Code) >= goipp.StatusRedirectionOtherSite {
+		return nil, nil
+	}
+	return resp, payload
+}
+
+func (s *serverSource) destinations() []destination {
+	if s.loaded {
+		return s.dests
+	}
+	s.loaded = true
+	resp, _ := s.send(s.request(goipp.OpCupsGetPrinters, "printer-name", "printer-info", "printer-type"))
+	if resp == nil {
+		return nil
+	}
+	for _, g := range resp.Groups {
+		if g.Tag != goipp.TagPrinterGroup {
+			continue
+		}
+		d := destination{name: attrValue(g.Attrs, "printer-name"), info: attrValue(g.Attrs, "printer-info")}
+		if d.name == "" {
+			continue
+		}
+		var ptype int
+		fmt.Sscan(attrValue(g.Attrs, "printer-type"), &ptype)
+		d.class = ptype&0x1 != 0
+		d.isDefault = ptype&0x20000 != 0
+		s.dests = append(s.dests, d)
+	}
+	return s.dests
+}
+
+func (s *serverSource) jobs() []candidate {
+	req := s.request(goipp.OpGetJobs, "job-id", "job-name", "job-printer-uri", "job-originating-user-name")
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String(s.client.PrinterURI(""))))
+	resp, _ := s.send(req)
+	if resp == nil {
+		return nil
+	}
+	var out []candidate
+	for _, g := range resp.Groups {
+		if g.Tag != goipp.TagJobGroup || len(g.Attrs) == 0 {
+			continue
+		}
+		printer := attrValue(g.Attrs, "job-printer-uri")
+		if i := strings.LastIndex(printer, "/"); i >= 0 {
+			printer = printer[i+1:]
+		}
+		out = append(out, candidate{
+			value: attrValue(g.Attrs, "job-id"),
+			desc:  fmt.Sprintf("%s (%s, %s)", attrValue(g.Attrs, "job-name"), printer, attrValue(g.Attrs, "job-originating-user-name")),
+		})
+	}
+	return out
+}
+
+func (s *serverSource) ppd(dest string) *config.PPD {
+	req := s.request(goipp.OpCupsGetPpd)
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String(s.client.PrinterURI(dest))))
+	_, payload := s.send(req)
+	if len(payload) == 0 {
+		return nil
+	}
+	// The PPD parser reads files.
+	tmp, err := os.CreateTemp("", "cups-complete-*.ppd")
+	if err != nil {
+		return nil
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(payload)
+	if cerr := tmp.Close(); err != nil || cerr != nil {
+		return nil
+	}
+	ppd, err := config.LoadPPD(tmp.Name())
+	if err != nil {
+		return nil
+	}
+	return ppd
+}
+
+func attrValue(attrs goipp.Attributes, name string) string {
+	for _, attr := range attrs {
+		if attr.Name == name && len(attr.Values) > 0 {
+			return attr.Values[0].V.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"cupsgolang/internal/tools/cancel"
+	"cupsgolang/internal/tools/cupsaccept"
+	"cupsgolang/internal/tools/cupsctl"
+	"cupsgolang/internal/tools/cupsdisable"
+	"cupsgolang/internal/tools/cupsenable"
+	"cupsgolang/internal/tools/cupsfilter"
+	"cupsgolang/internal/tools/cupsreject"
+	"cupsgolang/internal/tools/cupstestppd"
+	"cupsgolang/internal/tools/cupstop"
+	"cupsgolang/internal/tools/ippeveprinter"
+	"cupsgolang/internal/tools/ippfind"
+	"cupsgolang/internal/tools/ipptool"
+	"cupsgolang/internal/tools/lp"
+	"cupsgolang/internal/tools/lpadmin"
+	"cupsgolang/internal/tools/lpc"
+	"cupsgolang/internal/tools/lpinfo"
+	"cupsgolang/internal/tools/lpmove"
+	"cupsgolang/internal/tools/lpoptions"
+	"cupsgolang/internal/tools/lpq"
+	"cupsgolang/internal/tools/lpr"
+	"cupsgolang/internal/tools/lprm"
+	"cupsgolang/internal/tools/lpstat"
+)
+
+// tools are the commands this binary runs, by the name they are invoked
+// as.
+var tools = map[string]func(){
+	"cancel":        cancel.Main,
+	"cupsaccept":    cupsaccept.Main,
+	"cupsctl":       cupsctl.Main,
+	"cupsdisable":   cupsdisable.Main,
+	"cupsenable":    cupsenable.Main,
+	"cupsfilter":    cupsfilter.Main,
+	"cupsreject":    cupsreject.Main,
+	"cupstestppd":   cupstestppd.Main,
+	"cupstop":       cupstop.Main,
+	"ippeveprinter": ippeveprinter.Main,
+	"ippfind":       ippfind.Main,
+	"ipptool":       ipptool.Main,
+	"lp":            lp.Main,
+	"lpadmin":       lpadmin.Main,
+	"lpc":           lpc.Main,
+	"lpinfo":        lpinfo.Main,
+	"lpmove":        lpmove.Main,
+	"lpoptions":     lpoptions.Main,
+	"lpq":           lpq.Main,
+	"lpr":           lpr.Main,
+	"lprm":          lprm.Main,
+	"lpstat":        lpstat.Main,
+}
+
+func main() {
+	// Installed as a link named after a tool, run that tool as is.
+	if run, ok := tools[toolName(os.Args[0])]; ok {
+		run()
+		return
+	}
+	args := os.Args[1:]
+	if len(args) == 0 {
+		usage(os.Stderr)
+		os.Exit(1)
+	}
+	switch args[0] {
+	case "--help", "help":
+		usage(os.Stdout)
+		return
+	case "--list":
+		for _, name := range toolNames() {
+			fmt.Println(name)
+		}
+		return
+	case "--install":
+		dir := ""
+		if len(args) > 1 {
+			dir = args[1]
+		}
+		if err := install(dir); err != nil {
+			fail(err)
+		}
+		return
+	case "completion":
+		if len(args) != 2 {
+			fail(errors.New("usage: cups completion bash|zsh|fish"))
+		}
+		script, err := completionScript(args[1])
+		if err != nil {
+			fail(err)
+		}
+		fmt.Print(script)
+		return
+	case "__complete":
+		mode, candidates := complete(newServerSource, args[1:])
+		fmt.Println(mode)
+		for _, c := range candidates {
+			fmt.Println(c)
+		}
+		return
+	}
+	run, ok := tools[args[0]]
+	if !ok {
+		fail(fmt.Errorf("unknown command %q (see cups --list)", args[0]))
+	}
+	// The tool parses os.Args as if it had been run directly.
+	os.Args = args
+	run()
+}
+
+// usage prints the help text to w: stdout when it was asked for, stderr
+// when the command line was wrong.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: cups command [options] [arguments]")
+	fmt.Fprintln(w, "       command [options] [arguments]  (when installed as a link named after the command)")
+	fmt.Fprintln(w, "Options:")
+	fmt.Fprintln(w, "--list                  List the commands")
+	fmt.Fprintln(w, "--install [directory]   Link every command to this binary (default: its own directory)")
+	fmt.Fprintln(w, "completion shell        Print the bash, zsh or fish completion script")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	fmt.Fprintln(w, strings.Join(toolNames(), " "))
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "cups:", err)
+	os.Exit(1)
+}
+
+// toolName is the command a binary was invoked as: argv[0] without its
+// directory or executable suffix.
+func toolName(arg0 string) string {
+	name := filepath.Base(arg0)
+	return strings.TrimSuffix(strings.TrimSuffix(name, ".exe"), ".EXE")
+}
+
+func toolNames() []string {
+	names := make([]string, 0, len(tools))
+	for name := range tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// install links every tool name in dir to the running binary. Existing
+// links are replaced; other files are left alone and reported.
+func install(dir string) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(self); err == nil {
+		self = resolved
+	}
+	if dir == "" {
+		dir = filepath.Dir(self)
+	}
+	var skipped []string
+	for _, name := range toolNames() {
+		link := filepath.Join(dir, name)
+		if info, err := os.Lstat(link); err == nil {
+			if info.Mode()&os.ModeSymlink == 0 {
+				skipped = append(skipped, link)
+				continue
+			}
+			if err := os.Remove(link); err != nil {
+				return err
+			}
+		}
+		if err := os.Symlink(self, link); err != nil {
+			return err
+		}
+	}
+	if len(skipped) > 0 {
+		return fmt.Errorf("not replacing existing files: %s", strings.Join(skipped, ", "))
+	}
+	return nil
+}
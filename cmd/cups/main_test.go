@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/config"
+)
+
+// TestMain runs a tool instead of the tests when a test starts the test
+// binary as that tool.
+func TestMain(m *testing.M) {
+	if name := os.Getenv("CUPS_TEST_TOOL"); name != "" {
+		os.Args = append([]string{name}, strings.Split(os.Getenv("CUPS_TEST_TOOL_ARGS"), "\n")...)
+		tools[name]()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runTool runs a tool with args in a child process pointed at a server
+// that is not there, and returns everything it printed.
+func runTool(t *testing.T, name string, args ...string) string {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	home := t.TempDir()
+	cmd := exec.CommandContext(ctx, os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(),
+		"CUPS_TEST_TOOL="+name,
+		"CUPS_TEST_TOOL_ARGS="+strings.Join(args, "\n"),
+		"CUPS_SERVER=127.0.0.1:1",
+		"HOME="+home,
+		"CUPS_USER_CONF_DIR="+home,
+		"CUPS_CLIENT_CONF="+home+"/client.conf",
+	)
+	out, _ := cmd.CombinedOutput()
+	return string(out)
+}
+
+// TestSpecsMatchParseArgs checks each completion spec against the tool it
+// describes. Every flag must be known to the tool; a flag with a value
+// takes a following --help as that value, and a flag without one leaves
+// the --help to stop parsing before the option after it.
+func TestSpecsMatchParseArgs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs every tool")
+	}
+	for _, name := range toolNames() {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			help := runTool(t, name, "--help")
+			if strings.TrimSpace(help) == "" {
+				t.Fatalf("%s --help printed nothing", name)
+			}
+			flags := make([]string, 0, len(specs[name].flags))
+			for flag := range specs[name].flags {
+				flags = append(flags, flag)
+			}
+			sort.Strings(flags)
+			for _, flag := range flags {
+				out := runTool(t, name, flag, "--help", "--no-such-option")
+				switch takesValue := specs[name].flags[flag].takesValue(); {
+				case strings.Contains(out, "unknown") && strings.Contains(out, `"`+flag+`"`):
+					t.Errorf("%s does not know %s:\n%s", name, flag, out)
+				case takesValue && out == help:
+					t.Errorf("%s %s takes no value, but the spec gives it one", name, flag)
+				case !takesValue && strings.Contains(out, "--no-such-option"):
+					t.Errorf("%s %s takes a value, but the spec gives it none:\n%s", name, flag, out)
+				}
+			}
+		})
+	}
+}
+
+func TestToolName(t *testing.T) {
+	for in, want := range map[string]string{
+		"lp":                 "lp",
+		"/usr/local/bin/lpr": "lpr",
+		`C:\cups\lpstat.exe`: "lpstat",
+		"./cups":             "cups",
+	} {
+		if got := toolName(strings.ReplaceAll(in, `\`, string(os.PathSeparator))); got != want {
+			t.Fatalf("toolName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestEveryCommandIsIncluded(t *testing.T) {
+	entries, err := os.ReadDir("..")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == "cups" {
+			continue
+		}
+		if _, ok := tools[e.Name()]; !ok {
+			t.Errorf("cmd/%s is not in the multiplexer", e.Name())
+		}
+		if _, ok := specs[e.Name()]; !ok {
+			t.Errorf("cmd/%s has no completion spec", e.Name())
+		}
+	}
+}
+
+type fakeSource struct {
+	conns []connection
+	ppds  []string
+}
+
+func (f *fakeSource) destinations() []destination {
+	return []destination{
+		{name: "Office", info: "Second floor", isDefault: true},
+		{name: "Lab"},
+		{name: "Everyone", class: true},
+	}
+}
+
+func (f *fakeSource) jobs() []candidate {
+	return []candidate{{value: "12", desc: "report.pdf (Office, alice)"}, {value: "13"}}
+}
+
+func (f *fakeSource) ppd(dest string) *config.PPD {
+	f.ppds = append(f.ppds, dest)
+	return &config.PPD{OptionDetails: map[string]*config.PPDOption{
+		"PageSize":   {Keyword: "PageSize", Choices: []config.PPDChoice{{Choice: "A4"}, {Choice: "Letter", Text: "US Letter"}}},
+		"Duplex":     {Keyword: "Duplex", Text: "Two-sided", Choices: []config.PPDChoice{{Choice: "None"}, {Choice: "DuplexNoTumble"}}},
+		"PageRegion": {Keyword: "PageRegion"},
+	}}
+}
+
+func TestComplete(t *testing.T) {
+	fake := &fakeSource{}
+	newSource := func(c connection) source {
+		fake.conns = append(fake.conns, c)
+		return fake
+	}
+	for _, c := range []struct {
+		words []string
+		mode  string
+		want  []string
+	}{
+		{[]string{"cups", "lpst"}, modeWords, []string{"lpstat"}},
+		{[]string{"cups", "completion", "z"}, modeWords, []string{"zsh"}},
+		{[]string{"cups", "lp", "-d", ""}, modeWords, []string{"Office\tSecond floor", "Lab", "Everyone"}},
+		{[]string{"lp", "-d", ""}, modeWords, []string{"Office\tSecond floor", "Lab", "Everyone"}},
+		{[]string{"lp", "-dL"}, modeWords, []string{"-dLab"}},
+		{[]string{"lp", "-d", "Lab", "-q", "5", ""}, modeFiles, nil},
+		{[]string{"lp", "--", "-"}, modeFiles, nil},
+		{[]string{"lpadmin", "-p", ""}, modeWords, []string{"Office\tSecond floor", "Lab"}},
+		{[]string{"lpadmin", "-c", ""}, modeWords, []string{"Everyone"}},
+		{[]string{"cancel", "1"}, modeWords, []string{"12\treport.pdf (Office, alice)", "13"}},
+		{[]string{"lpmove", "12", "E"}, modeWords, []string{"Everyone"}},
+		{[]string{"lpstat", "-W", "c"}, modeWords, []string{"completed"}},
+		{[]string{"lpq", "--format=y"}, modeWords, []string{"--format=yaml"}},
+		{[]string{"cupsenable", "--r"}, modeWords, []string{"--release"}},
+		{[]string{"lp", "-o", "si"}, modeWords, []string{"sides="}},
+		{[]string{"lp", "-o", "Du"}, modeWords, []string{"Duplex=\tTwo-sided"}},
+		{[]string{"lp", "-o", "media=L"}, modeWords, []string{"media=Letter\tUS Letter"}},
+		{[]string{"lp", "-oDuplex=D"}, modeWords, []string{"-oDuplex=DuplexNoTumble"}},
+		{[]string{"lp", "-o", "sides=two-sided-l"}, modeWords, []string{"sides=two-sided-long-edge"}},
+		{[]string{"lpoptions", "-r", "Dup"}, modeWords, []string{"Duplex\tTwo-sided"}},
+		{[]string{"cups", "nosuch", ""}, modeWords, nil},
+	} {
+		mode, got := complete(newSource, c.words)
+		if mode != c.mode || strings.Join(got, "|") != strings.Join(c.want, "|") {
+			t.Errorf("complete(%q) = %s %q, want %s %q", c.words, mode, got, c.mode, c.want)
+		}
+	}
+
+	// The PPD comes from the named destination, else the default, and the
+	// connection options on the line are used for the queries.
+	fake.ppds, fake.conns = nil, nil
+	complete(newSource, []string{"lp", "-E", "-h", "print:631", "-U", "bob", "-d", "Lab/draft", "-o", "media="})
+	complete(newSource, []string{"lpr", "-H", "other", "-o", "media="})
+	if strings.Join(fake.ppds, ",") != "Lab,Office" {
+		t.Fatalf("PPDs fetched for %v, want Lab then the default", fake.ppds)
+	}
+	if fake.conns[0] != (connection{server: "print:631", user: "bob", encrypt: true}) || fake.conns[1].server != "other" {
+		t.Fatalf("connections = %+v", fake.conns)
+	}
+}
+
+func TestServerSource(t *testing.T) {
+	t.Setenv("CUPS_CLIENT_CONF_DIR", t.TempDir())
+	t.Setenv("CUPS_USER_CONF_DIR", t.TempDir())
+	ppd, err := os.ReadFile("../../data/ppd/CUPS-Golang-Generic.ppd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var ops []goipp.Op
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &goipp.Message{}
+		if err := req.Decode(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		ops = append(ops, goipp.Op(req.Code))
+		mu.Unlock()
+		resp := goipp.NewResponse(goipp.DefaultVersion, goipp.StatusOk, req.RequestID)
+		resp.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+		var body []byte
+		switch goipp.Op(req.Code) {
+		case goipp.OpCupsGetPrinters:
+			for _, p := range []struct {
+				name  string
+				ptype int
+			}{{"Office", 0x20000}, {"Team", 0x1}} {
+				attrs := goipp.Attributes{
+					goipp.MakeAttribute("printer-name", goipp.TagName, goipp.String(p.name)),
+					goipp.MakeAttribute("printer-type", goipp.TagEnum, goipp.Integer(p.ptype)),
+				}
+				resp.Groups = append(resp.Groups, goipp.Group{Tag: goipp.TagPrinterGroup, Attrs: attrs})
+			}
+		case goipp.OpGetJobs:
+			resp.Groups = append(resp.Groups, goipp.Group{Tag: goipp.TagJobGroup, Attrs: goipp.Attributes{
+				goipp.MakeAttribute("job-id", goipp.TagInteger, goipp.Integer(7)),
+				goipp.MakeAttribute("job-name", goipp.TagName, goipp.String("memo")),
+				goipp.MakeAttribute("job-printer-uri", goipp.TagURI, goipp.String("ipp://localhost/printers/Office")),
+				goipp.MakeAttribute("job-originating-user-name", goipp.TagName, goipp.String("alice")),
+			}})
+		case goipp.OpCupsGetPpd:
+			body = ppd
+		}
+		if len(resp.Groups) > 0 {
+			resp.Groups = append(goipp.Groups{{Tag: goipp.TagOperationGroup, Attrs: resp.Operation}}, resp.Groups...)
+		}
+		data, _ := resp.EncodeBytes()
+		w.Header().Set("Content-Type", goipp.ContentType)
+		w.Write(append(data, body...))
+	}))
+	defer srv.Close()
+
+	mode, got := complete(newServerSource, []string{"lp", "-h", strings.TrimPrefix(srv.URL, "http://"), "-o", "Duplex="})
+	if mode != modeWords || len(got) == 0 || !strings.HasPrefix(got[0], "Duplex=") {
+		t.Fatalf("Duplex values = %s %q", mode, got)
+	}
+	src := newServerSource(connection{server: strings.TrimPrefix(srv.URL, "http://")})
+	dests := src.destinations()
+	if len(dests) != 2 || !dests[0].isDefault || dests[0].class || !dests[1].class {
+		t.Fatalf("destinations = %+v", dests)
+	}
+	if jobs := src.jobs(); len(jobs) != 1 || jobs[0].String() != "7\tmemo (Office, alice)" {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	want := []goipp.Op{goipp.OpCupsGetPrinters, goipp.OpCupsGetPpd, goipp.OpCupsGetPrinters, goipp.OpGetJobs}
+	if len(ops) != len(want) {
+		t.Fatalf("operations = %v, want %v", ops, want)
+	}
+	for i := range want {
+		if ops[i] != want[i] {
+			t.Fatalf("operations = %v, want %v", ops, want)
+		}
+	}
+}
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		script, err := completionScript(shell)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(script, "cups __complete") || !strings.Contains(script, "cups cancel cupsaccept") || strings.Contains(script, "@COMMANDS@") {
+			t.Fatalf("%s script:\n%s", shell, script)
+		}
+	}
+	if _, err := completionScript("tcsh"); err == nil {
+		t.Fatal("completionScript accepted tcsh")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The scripts hand the command line to "cups __complete", whose first
+// output line is "words" or "files" and the rest are candidates, each
+// optionally followed by a tab and a description.
+
+const bashScript = `# bash completion for cups and its commands.
+# Load with: source <(cups completion bash)
+_cups_complete() {
+	local line=${COMP_LINE:0:COMP_POINT} mode value
+	local -a words out=()
+	read -ra words <<< "$line"
+	[[ $line == *[[:space:]] ]] && words+=("")
+	{
+		read -r mode
+		while IFS= read -r value; do
+			out+=("${value%%$'\t'*}")
+		done
+	} < <(cups __complete "${words[@]}" 2>/dev/null)
+	if [[ $mode == files ]]; then
+		compopt -o filenames 2>/dev/null
+		mapfile -t COMPREPLY < <(compgen -f -- "${COMP_WORDS[COMP_CWORD]}")
+		return
+	fi
+	COMPREPLY=("${out[@]}")
+	# Bash splits words at "=" and ":"; drop what it already has.
+	local cur=${words[${#words[@]}-1]}
+	if [[ $cur == *[=:]* ]]; then
+		local done=${cur%"${COMP_WORDS[COMP_CWORD]}"}
+		COMPREPLY=("${COMPREPLY[@]#"$done"}")
+	fi
+	if [[ ${#COMPREPLY[@]} -eq 1 && ${COMPREPLY[0]} == *= ]]; then
+		compopt -o nospace 2>/dev/null
+	fi
+}
+complete -F _cups_complete @COMMANDS@
+`
+
+const zshScript = `#compdef @COMMANDS@
+# zsh completion for cups and its commands.
+# Load with: source <(cups completion zsh)
+_cups_complete() {
+	local -a out values descs open opendescs
+	local line value desc
+	out=("${(@f)$(cups __complete "${(@)words[1,CURRENT]}" 2>/dev/null)}")
+	if [[ ${out[1]} == files ]]; then
+		_files
+		return
+	fi
+	for line in "${(@)out[2,-1]}"; do
+		[[ -z $line ]] && continue
+		value=${line%%$'\t'*}
+		desc=$value
+		[[ $line == *$'\t'* ]] && desc="$value -- ${line#*$'\t'}"
+		if [[ $value == *= ]]; then
+			open+=("$value")
+			opendescs+=("$desc")
+		else
+			values+=("$value")
+			descs+=("$desc")
+		fi
+	done
+	(( ${#open} )) && compadd -S '' -d opendescs -a open
+	(( ${#values} )) && compadd -d descs -a values
+}
+compdef _cups_complete @COMMANDS@
+`
+
+const fishScript = `# fish completion for cups and its commands.
+# Load with: cups completion fish | source
+function __cups_complete
+    set -l out (cups __complete (commandline -opc) (commandline -ct) 2>/dev/null)
+    if test "$out[1]" = files
+        __fish_complete_path (commandline -ct)
+        return
+    end
+    set -e out[1]
+    printf '%s\n' $out
+end
+for command in @COMMANDS@
+    complete -c $command -f -a '(__cups_complete)'
+end
+`
+
+// completionScript returns the completion script for shell, registered
+// for cups and every command.
+func completionScript(shell string) (string, error) {
+	commands := strings.Join(append([]string{"cups"}, toolNames()...), " ")
+	scripts := map[string]string{"bash": bashScript, "zsh": zshScript, "fish": fishScript}
+	if script, ok := scripts[shell]; ok {
+		return strings.ReplaceAll(script, "@COMMANDS@", commands), nil
+	}
+	return "", fmt.Errorf("unsupported shell %q (want bash, zsh or fish)", shell)
+}
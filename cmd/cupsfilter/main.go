@@ -0,0 +1,7 @@
+package main
+
+import "cupsgolang/internal/tools/cupsfilter"
+
+func main() {
+	cupsfilter.Main()
+}
@@ -0,0 +1,7 @@
+package main
+
+import "cupsgolang/internal/tools/cupstop"
+
+func main() {
+	cupstop.Main()
+}
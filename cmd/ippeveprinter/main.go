@@ -0,0 +1,7 @@
+package main
+
+import "cupsgolang/internal/tools/ippeveprinter"
+
+func main() {
+	ippeveprinter.Main()
+}
@@ -0,0 +1,7 @@
+package main
+
+import "cupsgolang/internal/tools/ippfind"
+
+func main() {
+	ippfind.Main()
+}
@@ -0,0 +1,7 @@
+package main
+
+import "cupsgolang/internal/tools/ipptool"
+
+func main() {
+	ipptool.Main()
+}
@@ -4,22 +4,22 @@ go 1.24.0
 
 require (
 	github.com/OpenPrinting/goipp v1.2.0
+	github.com/gosnmp/gosnmp v1.39.0
+	github.com/hashicorp/mdns v1.0.5
+	github.com/miekg/dns v1.1.41
 	golang.org/x/crypto v0.47.0
+	golang.org/x/sys v0.40.0
 	modernc.org/sqlite v1.29.0
 )
 
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/google/uuid v1.3.0 // indirect
-	github.com/gosnmp/gosnmp v1.39.0 // indirect
 	github.com/hashicorp/golang-lru/v2 v2.0.7 // indirect
-	github.com/hashicorp/mdns v1.0.5 // indirect
 	github.com/mattn/go-isatty v0.0.16 // indirect
-	github.com/miekg/dns v1.1.41 // indirect
 	github.com/ncruces/go-strftime v0.1.9 // indirect
 	github.com/remyoudompheng/bigfft v0.0.0-20230129092748-24d4a6f8daec // indirect
 	golang.org/x/net v0.48.0 // indirect
-	golang.org/x/sys v0.40.0 // indirect
 	modernc.org/gc/v3 v3.0.0-20240107210532-573471604cb6 // indirect
 	modernc.org/libc v1.41.0 // indirect
 	modernc.org/mathutil v1.6.0 // indirect
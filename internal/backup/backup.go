@@ -0,0 +1,280 @@
+// Package backup writes and restores a single archive holding the whole
+// server state: a consistent snapshot of the database, ConfDir (including the
+// TLS certificate and key), the PPDs in PPDDir and, optionally, the spooled
+// documents.
+//
+// The archive is a gzip-compressed tar file. Its last entry, manifest.json,
+// lists every other entry with its size and SHA-256 checksum; Restore refuses
+// an archive whose contents do not match.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/store"
+)
+
+// FormatVersion is written to every manifest; Restore rejects newer formats.
+const FormatVersion = 1
+
+const (
+	manifestName = "manifest.json"
+	dbEntry      = "db/cupsgolang.db"
+	confPrefix   = "conf/"
+	ppdPrefix    = "ppd/"
+	spoolPrefix  = "spool/"
+)
+
+// Manifest describes the contents of an archive.
+type Manifest struct {
+	Format        int         `json:"format"`
+	CreatedAt     time.Time   `json:"created_at"`
+	Host          string      `json:"host"`
+	IncludesSpool bool        `json:"includes_spool"`
+	Printers      []string    `json:"printers"`
+	Classes       []string    `json:"classes"`
+	Files         []FileEntry `json:"files"`
+}
+
+// FileEntry is one archived file.
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	Mode   uint32 `json:"mode"`
+	SHA256 string `json:"sha256"`
+}
+
+type Options struct {
+	// IncludeSpool adds the documents of queued and retained jobs.
+	IncludeSpool bool
+}
+
+// Create writes an archive of the server state described by cfg to w. The
+// database is captured with SQLite's online backup, so the server may keep
+// running while the archive is written.
+func Create(ctx context.Context, st *store.Store, cfg config.Config, w io.Writer, opts Options) (Manifest, error) {
+	host, _ := os.Hostname()
+	m := Manifest{
+		Format:        FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		Host:          host,
+		IncludesSpool: opts.IncludeSpool,
+	}
+
+	tmpDir, err := os.MkdirTemp("", "cupsgolang-backup-*")
+	if err != nil {
+		return m, err
+	}
+	defer os.RemoveAll(tmpDir)
+	snapshot := filepath.Join(tmpDir, "snapshot.db")
+	if err := st.Backup(ctx, snapshot); err != nil {
+		return m, fmt.Errorf("snapshot database: %w", err)
+	}
+	if err := st.WithTx(ctx, true, func(tx store.Tx) error {
+		printers, err := st.ListPrinters(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, p := range printers {
+			m.Printers = append(m.Printers, p.Name)
+		}
+		classes, err := st.ListClasses(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, c := range classes {
+			m.Classes = append(m.Classes, c.Name)
+		}
+		return nil
+	}); err != nil {
+		return m, err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name, src string, info fs.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		entry, err := addFile(tw, name, src, info)
+		if err != nil {
+			return fmt.Errorf("%s: %w", src, err)
+		}
+		m.Files = append(m.Files, entry)
+		return nil
+	}
+
+	info, err := os.Stat(snapshot)
+	if err != nil {
+		return m, err
+	}
+	if err := add(dbEntry, snapshot, info); err != nil {
+		return m, err
+	}
+	skip := skipList(cfg)
+	if err := addTree(cfg.ConfDir, confPrefix, skip, add); err != nil {
+		return m, err
+	}
+	if err := addTree(cfg.PPDDir, ppdPrefix, skip, add); err != nil {
+		return m, err
+	}
+	if opts.IncludeSpool {
+		if err := addTree(cfg.SpoolDir, spoolPrefix, nil, add); err != nil {
+			return m, err
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return m, err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    manifestName,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: m.CreatedAt,
+	}); err != nil {
+		return m, err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return m, err
+	}
+	if err := tw.Close(); err != nil {
+		return m, err
+	}
+	return m, gz.Close()
+}
+
+// skipList names paths under ConfDir and PPDDir that are archived separately
+// or must not be archived at all when the directories are nested.
+func skipList(cfg config.Config) []string {
+	out := []string{}
+	for _, p := range []string{cfg.SpoolDir, cfg.OutputDir, cfg.DBPath, cfg.DBPath + "-wal", cfg.DBPath + "-shm"} {
+		if strings.TrimSpace(p) == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			out = append(out, abs)
+		}
+	}
+	return out
+}
+
+func skipped(abs string, skip []string) bool {
+	for _, s := range skip {
+		if abs == s || strings.HasPrefix(abs, s+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func addTree(root, prefix string, skip []string, add func(name, src string, info fs.FileInfo) error) error {
+	if strings.TrimSpace(root) == "" {
+		return nil
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil
+	}
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != root && skipped(p, skip) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && !strings.HasSuffix(d.Name(), ".bak") {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+	for _, p := range files {
+		info, err := os.Stat(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Spool files come and go while the server runs.
+				continue
+			}
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if err := add(prefix+filepath.ToSlash(rel), p, info); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func addFile(tw *tar.Writer, name, src string, info fs.FileInfo) (FileEntry, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return FileEntry{}, err
+	}
+	defer f.Close()
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    int64(info.Mode().Perm()),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return FileEntry{}, err
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tw, h), io.LimitReader(f, info.Size()))
+	if err != nil {
+		return FileEntry{}, err
+	}
+	if n != info.Size() {
+		return FileEntry{}, fmt.Errorf("file shrank while being archived")
+	}
+	return FileEntry{
+		Path:   name,
+		Size:   n,
+		Mode:   uint32(info.Mode().Perm()),
+		SHA256: hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
+// cleanEntryName rejects archive paths that would escape the extraction
+// directory.
+func cleanEntryName(name string) (string, error) {
+	clean := path.Clean(strings.TrimPrefix(name, "./"))
+	if clean == "." || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("unsafe archive path %q", name)
+	}
+	return clean, nil
+}
@@ -0,0 +1,294 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+func newTestState(t *testing.T) (config.Config, *store.Store) {
+	t.Helper()
+	root := t.TempDir()
+	cfg := config.Config{
+		DataDir:  root,
+		DBPath:   filepath.Join(root, "cupsgolang.db"),
+		ConfDir:  filepath.Join(root, "conf"),
+		PPDDir:   filepath.Join(root, "ppd"),
+		SpoolDir: filepath.Join(root, "spool"),
+	}
+	for name, body := range map[string]string{
+		filepath.Join(cfg.ConfDir, "cupsd.conf"):      "LogLevel info\n",
+		filepath.Join(cfg.ConfDir, "cupsd.key"):       "key\n",
+		filepath.Join(cfg.PPDDir, "Office.ppd"):       "*PPD-Adobe: \"4.3\"\n",
+		filepath.Join(cfg.SpoolDir, "job-1", "d0001"): "%!PS\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	st, err := store.Open(ctx, cfg.DBPath)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	err = st.WithTx(ctx, false, func(tx store.Tx) error {
+		p, err := st.CreatePrinter(ctx, tx, "Office", "ipp://office/ipp/print", "Lab", "Office printer", "Office.ppd", true, false, true, "none", `{"media":"iso_a4_210x297mm"}`)
+		if err != nil {
+			return err
+		}
+		if err := st.UpdatePrinterDefaultOptions(ctx, tx, p.ID, p.DefaultOptions); err != nil {
+			return err
+		}
+		if err := st.SetSetting(ctx, tx, "printer."+strconv.FormatInt(p.ID, 10)+".allowed_users", "alice,bob"); err != nil {
+			return err
+		}
+		if err := st.SetSetting(ctx, tx, "printer."+strconv.FormatInt(p.ID, 10)+".job_presets", `[{"preset-name":"draft"}]`); err != nil {
+			return err
+		}
+		_, err = st.CreatePrinter(ctx, tx, "Lobby", "ipp://lobby/ipp/print", "", "", "", true, false, true, "none", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("setup store: %v", err)
+	}
+	return cfg, st
+}
+
+func getPrinter(t *testing.T, st *store.Store, name string) (model.Printer, bool) {
+	t.Helper()
+	var p model.Printer
+	err := st.WithTx(context.Background(), true, func(tx store.Tx) error {
+		var err error
+		p, err = st.GetPrinterByName(context.Background(), tx, name)
+		return err
+	})
+	return p, err == nil
+}
+
+func TestCreateAndRestoreFullState(t *testing.T) {
+	ctx := context.Background()
+	cfg, st := newTestState(t)
+
+	var archive bytes.Buffer
+	m, err := Create(ctx, st, cfg, &archive, Options{IncludeSpool: true})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	paths := map[string]bool{}
+	for _, f := range m.Files {
+		paths[f.Path] = true
+	}
+	for _, want := range []string{dbEntry, "conf/cupsd.conf", "conf/cupsd.key", "ppd/Office.ppd", "spool/job-1/d0001"} {
+		if !paths[want] {
+			t.Fatalf("archive is missing %s (have %v)", want, paths)
+		}
+	}
+	if len(m.Printers) != 2 {
+		t.Fatalf("expected 2 printers in manifest, got %v", m.Printers)
+	}
+
+	// Lose some state, then restore it.
+	err = st.WithTx(ctx, false, func(tx store.Tx) error {
+		p, err := st.GetPrinterByName(ctx, tx, "Lobby")
+		if err != nil {
+			return err
+		}
+		return st.DeletePrinter(ctx, tx, p.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(filepath.Join(cfg.PPDDir, "Office.ppd"))
+	_ = os.WriteFile(filepath.Join(cfg.ConfDir, "cupsd.conf"), []byte("LogLevel debug\n"), 0644)
+	_ = os.RemoveAll(cfg.SpoolDir)
+
+	report, err := Restore(ctx, st, cfg, bytes.NewReader(archive.Bytes()), RestoreOptions{Spool: true})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if !report.Database || report.Files != 4 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if _, ok := getPrinter(t, st, "Lobby"); !ok {
+		t.Fatalf("expected Lobby to be restored")
+	}
+	if data, _ := os.ReadFile(filepath.Join(cfg.ConfDir, "cupsd.conf")); string(data) != "LogLevel info\n" {
+		t.Fatalf("cupsd.conf not restored: %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.PPDDir, "Office.ppd")); err != nil {
+		t.Fatalf("PPD not restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cfg.SpoolDir, "job-1", "d0001")); err != nil {
+		t.Fatalf("spool file not restored: %v", err)
+	}
+}
+
+func TestRestoreSelectedPrinter(t *testing.T) {
+	ctx := context.Background()
+	cfg, st := newTestState(t)
+	var archive bytes.Buffer
+	if _, err := Create(ctx, st, cfg, &archive, Options{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		for _, name := range []string{"Office", "Lobby"} {
+			p, err := st.GetPrinterByName(ctx, tx, name)
+			if err != nil {
+				return err
+			}
+			if err := st.DeletePrinter(ctx, tx, p.ID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.Remove(filepath.Join(cfg.PPDDir, "Office.ppd"))
+
+	report, err := Restore(ctx, st, cfg, bytes.NewReader(archive.Bytes()), RestoreOptions{Printers: []string{"Office"}})
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if report.Database || len(report.Printers) != 1 || report.Files != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	p, ok := getPrinter(t, st, "Office")
+	if !ok {
+		t.Fatalf("expected Office to be restored")
+	}
+	if p.Location != "Lab" || p.PPDName != "Office.ppd" || !strings.Contains(p.DefaultOptions, "iso_a4") {
+		t.Fatalf("printer not restored faithfully: %+v", p)
+	}
+	if _, ok := getPrinter(t, st, "Lobby"); ok {
+		t.Fatalf("Lobby was not selected and must not be restored")
+	}
+	var allowed, presets string
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
+		allowed, _ = st.GetSetting(ctx, tx, "printer."+strconv.FormatInt(p.ID, 10)+".allowed_users", "")
+		presets, _ = st.GetSetting(ctx, tx, "printer."+strconv.FormatInt(p.ID, 10)+".job_presets", "")
+		return nil
+	})
+	if allowed != "alice,bob" {
+		t.Fatalf("allowed users not restored, got %q", allowed)
+	}
+	if !strings.Contains(presets, "draft") {
+		t.Fatalf("job presets not restored, got %q", presets)
+	}
+	db, err := sql.Open("sqlite", cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var media string
+	if err := db.QueryRowContext(ctx, `SELECT option_value FROM printer_options WHERE printer_id = ? AND option_key = 'media'`, p.ID).Scan(&media); err != nil || media != "iso_a4_210x297mm" {
+		t.Fatalf("printer options not restored, got %q (%v)", media, err)
+	}
+
+	if _, err := Restore(ctx, st, cfg, bytes.NewReader(archive.Bytes()), RestoreOptions{Printers: []string{"Missing"}}); err == nil {
+		t.Fatalf("expected error for a printer that is not in the archive")
+	}
+}
+
+func TestRestoreRejectsSchemaMismatch(t *testing.T) {
+	ctx := context.Background()
+	cfg, st := newTestState(t)
+	var archive bytes.Buffer
+	if _, err := Create(ctx, st, cfg, &archive, Options{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Make the live database look older than the archived one.
+	db, err := sql.Open("sqlite", cfg.DBPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, `DELETE FROM schema_migrations`); err != nil {
+		t.Fatal(err)
+	}
+	err = st.WithTx(ctx, false, func(tx store.Tx) error {
+		p, err := st.GetPrinterByName(ctx, tx, "Lobby")
+		if err != nil {
+			return err
+		}
+		return st.DeletePrinter(ctx, tx, p.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, opts := range []RestoreOptions{{}, {Printers: []string{"Lobby"}}} {
+		if _, err := Restore(ctx, st, cfg, bytes.NewReader(archive.Bytes()), opts); err == nil || !strings.Contains(err.Error(), "schema version") {
+			t.Fatalf("Restore(%+v) = %v, want a schema version error", opts, err)
+		}
+	}
+	if _, ok := getPrinter(t, st, "Lobby"); ok {
+		t.Fatalf("a refused restore must not change the database")
+	}
+	if version, err := st.SchemaVersion(ctx); err != nil || version != 0 {
+		t.Fatalf("restore must not migrate the database, got version %d (%v)", version, err)
+	}
+}
+
+func TestRestoreRejectsTamperedArchive(t *testing.T) {
+	ctx := context.Background()
+	cfg, st := newTestState(t)
+	var archive bytes.Buffer
+	if _, err := Create(ctx, st, cfg, &archive, Options{}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Rewrite the archive with cupsd.conf changed but the manifest intact.
+	gz, err := gzip.NewReader(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var tampered bytes.Buffer
+	gw := gzip.NewWriter(&tampered)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		if hdr.Name == "conf/cupsd.conf" {
+			data = []byte("Listen 0.0.0.0:631\n")
+			hdr.Size = int64(len(data))
+		}
+		_ = tw.WriteHeader(hdr)
+		_, _ = tw.Write(data)
+	}
+	_ = tw.Close()
+	_ = gw.Close()
+
+	if _, err := Restore(ctx, st, cfg, &tampered, RestoreOptions{}); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Fatalf("expected checksum error, got %v", err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(cfg.ConfDir, "cupsd.conf")); string(data) != "LogLevel info\n" {
+		t.Fatalf("tampered archive must not change anything, cupsd.conf is %q", data)
+	}
+}
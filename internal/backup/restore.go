@@ -0,0 +1,362 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/fsutil"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+type RestoreOptions struct {
+	// Printers limits the restore to the named printers: the printer record,
+	// its default and per-printer options, every "printer.<id>." setting
+	// (user access lists, job presets, policies) and its PPD are copied from
+	// the archive and everything else is left alone. Jobs, subscriptions and
+	// supply levels are runtime state and are not restored. When empty the
+	// whole state is restored.
+	Printers []string
+	// Spool restores spooled documents when the archive contains them.
+	Spool bool
+}
+
+// RestoreReport summarizes what Restore changed.
+type RestoreReport struct {
+	Manifest Manifest
+	Database bool
+	Files    int
+	Printers []string
+}
+
+// WriteText renders the report for the command line.
+func (r RestoreReport) WriteText(w io.Writer) {
+	fmt.Fprintf(w, "Archive from %s created %s\n", r.Manifest.Host, r.Manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	if r.Database {
+		fmt.Fprintln(w, "Restored database")
+	}
+	if len(r.Printers) > 0 {
+		fmt.Fprintf(w, "Restored %d printer(s): %s\n", len(r.Printers), strings.Join(r.Printers, " "))
+	}
+	fmt.Fprintf(w, "Restored %d file(s)\n", r.Files)
+}
+
+// Restore verifies the archive read from r against its manifest and writes
+// it back into the database and directories described by cfg. Nothing is
+// changed when any checksum does not match.
+func Restore(ctx context.Context, st *store.Store, cfg config.Config, r io.Reader, opts RestoreOptions) (RestoreReport, error) {
+	var report RestoreReport
+	tmpDir, err := os.MkdirTemp("", "cupsgolang-restore-*")
+	if err != nil {
+		return report, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	m, err := extract(r, tmpDir)
+	if err != nil {
+		return report, err
+	}
+	report.Manifest = m
+	if len(opts.Printers) > 0 {
+		return restorePrinters(ctx, st, cfg, tmpDir, opts.Printers, report)
+	}
+
+	if err := st.Restore(ctx, filepath.Join(tmpDir, filepath.FromSlash(dbEntry))); err != nil {
+		return report, fmt.Errorf("restore database: %w", err)
+	}
+	report.Database = true
+	targets := []struct {
+		prefix string
+		dir    string
+	}{
+		{confPrefix, cfg.ConfDir},
+		{ppdPrefix, cfg.PPDDir},
+	}
+	if opts.Spool {
+		targets = append(targets, struct {
+			prefix string
+			dir    string
+		}{spoolPrefix, cfg.SpoolDir})
+	}
+	for _, f := range m.Files {
+		for _, t := range targets {
+			rel, ok := strings.CutPrefix(f.Path, t.prefix)
+			if !ok || strings.TrimSpace(t.dir) == "" {
+				continue
+			}
+			src := filepath.Join(tmpDir, filepath.FromSlash(f.Path))
+			if err := installFile(src, filepath.Join(t.dir, filepath.FromSlash(rel)), fs.FileMode(f.Mode)); err != nil {
+				return report, err
+			}
+			report.Files++
+		}
+	}
+	return report, nil
+}
+
+// extract unpacks the archive into dir and checks every entry against the
+// manifest.
+func extract(r io.Reader, dir string) (Manifest, error) {
+	var m Manifest
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return m, fmt.Errorf("not a backup archive: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	sums := map[string]FileEntry{}
+	var manifest []byte
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return m, fmt.Errorf("read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, err := cleanEntryName(hdr.Name)
+		if err != nil {
+			return m, err
+		}
+		if name == manifestName {
+			manifest, err = io.ReadAll(io.LimitReader(tr, 64<<20))
+			if err != nil {
+				return m, err
+			}
+			continue
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0700); err != nil {
+			return m, err
+		}
+		out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return m, err
+		}
+		h := sha256.New()
+		n, err := io.Copy(io.MultiWriter(out, h), tr)
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return m, err
+		}
+		sums[name] = FileEntry{Path: name, Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}
+	}
+	if manifest == nil {
+		return m, errors.New("archive has no manifest")
+	}
+	if err := json.Unmarshal(manifest, &m); err != nil {
+		return m, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if m.Format > FormatVersion {
+		return m, fmt.Errorf("archive format %d is newer than this build supports (%d)", m.Format, FormatVersion)
+	}
+	listed := map[string]bool{}
+	for _, f := range m.Files {
+		got, ok := sums[f.Path]
+		if !ok {
+			return m, fmt.Errorf("%s is listed in the manifest but missing from the archive", f.Path)
+		}
+		if got.Size != f.Size || got.SHA256 != f.SHA256 {
+			return m, fmt.Errorf("%s does not match its checksum", f.Path)
+		}
+		listed[f.Path] = true
+	}
+	for name := range sums {
+		if !listed[name] {
+			return m, fmt.Errorf("%s is not listed in the manifest", name)
+		}
+	}
+	if !listed[dbEntry] {
+		return m, errors.New("archive has no database snapshot")
+	}
+	return m, nil
+}
+
+// restorePrinters copies the named printers out of the archived database
+// into the live one, creating them when they no longer exist. The archive
+// must have the schema version of the live database.
+func restorePrinters(ctx context.Context, st *store.Store, cfg config.Config, dir string, names []string, report RestoreReport) (RestoreReport, error) {
+	src, err := store.OpenExisting(ctx, filepath.Join(dir, filepath.FromSlash(dbEntry)))
+	if err != nil {
+		return report, fmt.Errorf("open archived database: %w", err)
+	}
+	defer src.Close()
+	want, err := st.SchemaVersion(ctx)
+	if err != nil {
+		return report, err
+	}
+	got, err := src.SchemaVersion(ctx)
+	if err != nil {
+		return report, err
+	}
+	if got != want {
+		return report, fmt.Errorf("archived database schema version %d does not match the current database (%d)", got, want)
+	}
+
+	type saved struct {
+		printer model.Printer
+		// settings holds the "printer.<id>." settings keyed by the part
+		// after the prefix, e.g. "job_presets".
+		settings map[string]string
+	}
+	var printers []saved
+	err = src.WithTx(ctx, true, func(tx store.Tx) error {
+		all, err := src.ListSettings(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			p, err := src.GetPrinterByName(ctx, tx, name)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("printer %q is not in the archive", name)
+				}
+				return err
+			}
+			printers = append(printers, saved{printer: p, settings: printerSettings(all, p.ID)})
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	err = st.WithTx(ctx, false, func(tx store.Tx) error {
+		for _, sp := range printers {
+			p := sp.printer
+			live, err := st.GetPrinterByName(ctx, tx, p.Name)
+			if errors.Is(err, sql.ErrNoRows) {
+				live, err = st.CreatePrinter(ctx, tx, p.Name, p.URI, p.Location, p.Info, p.PPDName, p.Accepting, false, p.Shared, p.JobSheetsDefault, p.DefaultOptions)
+			}
+			if err == nil {
+				// updatePrinter also rebuilds printer_options, which
+				// CreatePrinter leaves empty.
+				err = updatePrinter(ctx, st, tx, live.ID, p)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", p.Name, err)
+			}
+			if err := st.UpdatePrinterAttributes(ctx, tx, live.ID, nil, nil, &p.Geo, &p.Org, &p.OrgUnit); err != nil {
+				return err
+			}
+			if err := st.UpdatePrinterState(ctx, tx, live.ID, p.State); err != nil {
+				return err
+			}
+			if p.IsDefault {
+				if err := st.SetDefaultPrinter(ctx, tx, live.ID); err != nil {
+					return err
+				}
+			}
+			current, err := st.ListSettings(ctx, tx)
+			if err != nil {
+				return err
+			}
+			prefix := "printer." + strconv.FormatInt(live.ID, 10) + "."
+			for key := range printerSettings(current, live.ID) {
+				if _, ok := sp.settings[key]; !ok {
+					if err := st.SetSetting(ctx, tx, prefix+key, ""); err != nil {
+						return err
+					}
+				}
+			}
+			for key, v := range sp.settings {
+				if err := st.SetSetting(ctx, tx, prefix+key, v); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	for _, sp := range printers {
+		report.Printers = append(report.Printers, sp.printer.Name)
+		ppd := filepath.Base(strings.TrimSpace(sp.printer.PPDName))
+		if ppd == "" || ppd == "." || strings.TrimSpace(cfg.PPDDir) == "" {
+			continue
+		}
+		for _, f := range report.Manifest.Files {
+			if f.Path != ppdPrefix+ppd {
+				continue
+			}
+			if err := installFile(filepath.Join(dir, filepath.FromSlash(f.Path)), filepath.Join(cfg.PPDDir, ppd), fs.FileMode(f.Mode)); err != nil {
+				return report, err
+			}
+			report.Files++
+		}
+	}
+	return report, nil
+}
+
+// printerSettings returns the settings scoped to printer id, keyed by the
+// part after "printer.<id>.".
+func printerSettings(all map[string]string, id int64) map[string]string {
+	prefix := "printer." + strconv.FormatInt(id, 10) + "."
+	out := map[string]string{}
+	for key, v := range all {
+		if rest, ok := strings.CutPrefix(key, prefix); ok && rest != "" {
+			out[rest] = v
+		}
+	}
+	return out
+}
+
+func updatePrinter(ctx context.Context, st *store.Store, tx store.Tx, id int64, p model.Printer) error {
+	if err := st.UpdatePrinterURI(ctx, tx, id, p.URI); err != nil {
+		return err
+	}
+	if err := st.UpdatePrinterPPDName(ctx, tx, id, p.PPDName); err != nil {
+		return err
+	}
+	if err := st.UpdatePrinterAttributes(ctx, tx, id, &p.Info, &p.Location, nil, nil, nil); err != nil {
+		return err
+	}
+	if err := st.UpdatePrinterSharing(ctx, tx, id, p.Shared); err != nil {
+		return err
+	}
+	if err := st.UpdatePrinterAccepting(ctx, tx, id, p.Accepting); err != nil {
+		return err
+	}
+	if err := st.UpdatePrinterJobSheetsDefault(ctx, tx, id, p.JobSheetsDefault); err != nil {
+		return err
+	}
+	return st.UpdatePrinterDefaultOptions(ctx, tx, id, p.DefaultOptions)
+}
+
+// installFile copies src to dst with fsutil.WriteFileFrom, so a reader never
+// sees a partly written file.
+func installFile(src, dst string, mode fs.FileMode) error {
+	if mode == 0 {
+		mode = 0644
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return fsutil.WriteFileFrom(dst, in, mode)
+}
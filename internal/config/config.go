@@ -2,6 +2,7 @@ package config
 
 import (
 	"bufio"
+	"fmt"
 	"net"
 	"net/url"
 	"os"
@@ -19,6 +20,12 @@ type Config struct {
 	TLSCertPath                string
 	TLSKeyPath                 string
 	TLSAutoGenerate            bool
+	ACMEDirectory              string
+	ACMEEmail                  string
+	ACMEChallenge              string
+	ACMEDNSHook                string
+	ACMECARoots                string
+	ACMERenewDays              int
 	DataDir                    string
 	DBPath                     string
 	SpoolDir                   string
@@ -32,13 +39,19 @@ type Config struct {
 	MaxRequestSize             int64
 	MaxLogSize                 int64
 	LogLevel                   string
+	LogFormat                  string
 	AccessLogLevel             string
 	PageLogFormat              string
 	ErrorLogPath               string
 	AccessLogPath              string
 	PageLogPath                string
+	AuditLogPath               string
 	ErrorPolicy                string
 	DefaultAuthType            string
+	AuthMaxFailures            int
+	AuthBackoff                int
+	AuthLockoutTime            int
+	AuthCacheTime              int
 	MaxJobTime                 int
 	MaxEvents                  int
 	MaxLeaseDuration           int
@@ -62,6 +75,36 @@ type Config struct {
 	StateDir                   string
 	CacheDir                   string
 	DocumentRoot               string
+	// Connection handling; see main.go's http.Server.
+	Timeout           int
+	KeepAlive         bool
+	KeepAliveTimeout  int
+	MaxClients        int
+	MaxClientsPerHost int
+	ServerTokens      string
+	SSLOptions        []string
+	// Job limits and filter settings.
+	JobKillDelay       int
+	ReloadTimeout      int
+	PreserveJobHistory string
+	PreserveJobFiles   string
+	MaxJobs            int
+	MaxJobsPerPrinter  int
+	MaxJobsPerUser     int
+	MaxCopies          int
+	MaxHoldTime        int
+	DefaultShared      bool
+	RIPCache           string
+	SetEnv             []string
+	LogFilePerm        os.FileMode
+	ServerKeychain     string
+	TempDir            string
+	// Unused holds the directives CUPS defines that this server accepts but
+	// does not act on, by canonical name, so they can still be reported.
+	Unused map[string]string
+
+	// sources records where each directive's value came from; see Source.
+	sources map[string]string
 }
 
 type configOverrides struct {
@@ -92,6 +135,8 @@ func Load() Config {
 		TLSCertPath:                getenv("CUPS_TLS_CERT", filepath.Join(confDir, "cupsd.crt")),
 		TLSKeyPath:                 getenv("CUPS_TLS_KEY", filepath.Join(confDir, "cupsd.key")),
 		TLSAutoGenerate:            getenvBool("CUPS_TLS_AUTOGEN", true),
+		ACMEChallenge:              "http-01",
+		ACMERenewDays:              30,
 		DataDir:                    dataDir,
 		DBPath:                     getenv("CUPS_DB_PATH", filepath.Join(dataDir, "cupsgolang.db")),
 		SpoolDir:                   getenv("CUPS_SPOOL_DIR", filepath.Join(dataDir, "spool")),
@@ -101,11 +146,16 @@ func Load() Config {
 		ServerName:                 getenv("CUPS_SERVER_NAME", "CUPS-Golang"),
 		WebInterface:               true,
 		LogLevel:                   "info",
+		LogFormat:                  "text",
 		AccessLogLevel:             "actions",
 		PageLogFormat:              "%p %u %j %T %P %C %{job-billing} %{job-originating-host-name} %{job-name} %{media} %{sides}",
 		BrowseLocal:                true,
 		BrowseLocalProtocols:       []string{"dnssd"},
 		MultipleOperationTimeout:   900,
+		AuthMaxFailures:            5,
+		AuthBackoff:                1,
+		AuthLockoutTime:            15 * 60,
+		AuthCacheTime:              60,
 		MaxJobTime:                 3 * 60 * 60,
 		MaxEvents:                  100,
 		MaxLeaseDuration:           0,
@@ -114,6 +164,20 @@ func Load() Config {
 		MaxSubscriptionsPerJob:     0,
 		MaxSubscriptionsPerPrinter: 0,
 		MaxSubscriptionsPerUser:    0,
+		Timeout:                    900,
+		KeepAlive:                  true,
+		KeepAliveTimeout:           60,
+		MaxClients:                 100,
+		ServerTokens:               "Minimal",
+		JobKillDelay:               30,
+		ReloadTimeout:              30,
+		PreserveJobHistory:         "Yes",
+		PreserveJobFiles:           "1d",
+		MaxJobs:                    500,
+		MaxCopies:                  9999,
+		DefaultShared:              true,
+		RIPCache:                   "128m",
+		LogFilePerm:                0o644,
 	}
 
 	markEnvOverrides(&overrides)
@@ -256,6 +320,30 @@ func applyEnvOverrides(cfg *Config, overrides *configOverrides) {
 			overrides.tlsKeyLocked = true
 		}
 	}
+	if v, ok := os.LookupEnv("CUPS_ACME_DIRECTORY"); ok {
+		cfg.ACMEDirectory = strings.TrimSpace(v)
+	}
+	if v, ok := os.LookupEnv("CUPS_ACME_EMAIL"); ok {
+		cfg.ACMEEmail = strings.TrimSpace(v)
+	}
+	if v, ok := os.LookupEnv("CUPS_ACME_CHALLENGE"); ok {
+		cfg.ACMEChallenge = strings.ToLower(strings.TrimSpace(v))
+	}
+	if v, ok := os.LookupEnv("CUPS_ACME_DNS_HOOK"); ok {
+		cfg.ACMEDNSHook = strings.TrimSpace(v)
+	}
+	if v, ok := os.LookupEnv("CUPS_LOG_LEVEL"); ok {
+		cfg.LogLevel = strings.TrimSpace(v)
+	}
+	if v, ok := os.LookupEnv("CUPS_LOG_FORMAT"); ok {
+		cfg.LogFormat = strings.TrimSpace(v)
+	}
+	if v, ok := os.LookupEnv("CUPS_ERROR_LOG"); ok {
+		cfg.ErrorLogPath = resolveLogPath(cfg.ConfDir, v)
+	}
+	if v, ok := os.LookupEnv("CUPS_AUDIT_LOG"); ok {
+		cfg.AuditLogPath = resolveLogPath(cfg.ConfDir, v)
+	}
 	if v, ok := os.LookupEnv("CUPS_ACCESS_LOG_LEVEL"); ok {
 		cfg.AccessLogLevel = strings.TrimSpace(v)
 	}
@@ -316,6 +404,8 @@ func applyEnvOverrides(cfg *Config, overrides *configOverrides) {
 			overrides.serverNameLocked = true
 		}
 	}
+
+	applyDirectiveEnv(cfg, overrides)
 }
 
 func applyDerivedDefaults(cfg *Config, overrides *configOverrides) {
@@ -335,11 +425,15 @@ func applyDerivedDefaults(cfg *Config, overrides *configOverrides) {
 	if overrides == nil || !overrides.ppdDir {
 		cfg.PPDDir = filepath.Join(cfg.DataDir, "ppd")
 	}
+	keychain := cfg.ConfDir
+	if cfg.ServerKeychain != "" {
+		keychain = cfg.ServerKeychain
+	}
 	if overrides == nil || !overrides.tlsCertLocked {
-		cfg.TLSCertPath = filepath.Join(cfg.ConfDir, "cupsd.crt")
+		cfg.TLSCertPath = filepath.Join(keychain, "cupsd.crt")
 	}
 	if overrides == nil || !overrides.tlsKeyLocked {
-		cfg.TLSKeyPath = filepath.Join(cfg.ConfDir, "cupsd.key")
+		cfg.TLSKeyPath = filepath.Join(keychain, "cupsd.key")
 	}
 	if cfg.RequestRoot == "" {
 		cfg.RequestRoot = cfg.SpoolDir
@@ -361,6 +455,18 @@ func applyCupsFilesConf(cfg *Config, overrides *configOverrides) {
 }
 
 func parseCupsFilesConf(path string, cfg *Config, overrides *configOverrides) {
+	scanCupsFilesConf(path, cfg, overrides, nil)
+}
+
+// unusedCupsFilesDirectives are cups-files.conf directives CUPS accepts
+// that this server records in Config.Unused without acting on them, keyed
+// by lower-cased name.
+var unusedCupsFilesDirectives = canonicalNames(
+	"ConfigFilePerm", "FatalErrors", "FileDevice", "Group", "Printcap", "PrintcapFormat",
+	"PrintcapGUI", "RemoteRoot", "Sandboxing", "SyncOnClose", "SystemGroup", "User",
+)
+
+func scanCupsFilesConf(path string, cfg *Config, overrides *configOverrides, rep *ValidationReport) {
 	f, err := os.Open(path)
 	if err != nil {
 		return
@@ -368,7 +474,9 @@ func parseCupsFilesConf(path string, cfg *Config, overrides *configOverrides) {
 	defer f.Close()
 
 	sc := bufio.NewScanner(f)
+	lineNo := 0
 	for sc.Scan() {
+		lineNo++
 		line := strings.TrimSpace(sc.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -381,77 +489,157 @@ func parseCupsFilesConf(path string, cfg *Config, overrides *configOverrides) {
 		key := strings.ToLower(keyToken)
 		raw := strings.TrimSpace(line[len(keyToken):])
 		value := unquoteValue(strings.TrimSpace(raw))
-		if strings.Contains(value, "@") {
+		if name, ok := unusedCupsFilesDirectives[key]; ok {
+			rep.warnf(path, lineNo, "%s is accepted but has no effect in this server", keyToken)
+			cfg.noteUnused(name, value, fmt.Sprintf("%s:%d", filepath.Base(path), lineNo))
 			continue
 		}
-		switch key {
-		case "serverroot":
-			if overrides != nil && overrides.confDirLocked {
-				continue
-			}
-			if value != "" {
-				cfg.ConfDir = resolvePath(cfg.ConfDir, value)
-			}
-		case "datadir":
-			if overrides != nil && overrides.dataDirLocked {
-				continue
-			}
-			if value != "" {
-				cfg.DataDir = resolvePath(cfg.ConfDir, value)
-			}
-		case "requestroot":
-			if overrides != nil && overrides.spoolDir {
-				continue
-			}
-			if value != "" {
-				cfg.SpoolDir = resolvePath(cfg.ConfDir, value)
-				cfg.RequestRoot = cfg.SpoolDir
-				if overrides != nil {
-					overrides.spoolDir = true
-				}
-			}
-		case "statedir":
-			if value != "" {
-				cfg.StateDir = resolvePath(cfg.ConfDir, value)
-			}
-		case "cachedir":
-			if value != "" {
-				cfg.CacheDir = resolvePath(cfg.ConfDir, value)
-			}
-		case "documentroot":
-			if value != "" {
-				cfg.DocumentRoot = resolvePath(cfg.ConfDir, value)
-			}
-		case "serverbin":
-			if value != "" {
-				cfg.ServerBin = resolvePath(cfg.ConfDir, value)
-				if cfg.DeviceBackendsDir == "" {
-					cfg.DeviceBackendsDir = filepath.Join(cfg.ServerBin, "backend")
-				}
-				if cfg.FilterDir == "" {
-					cfg.FilterDir = filepath.Join(cfg.ServerBin, "filter")
-				}
+		// Skip unexpanded "@CUPS_...@" build placeholders; ACMEEmail is the
+		// one directive whose value legitimately contains '@'.
+		if strings.Contains(value, "@") && key != "acmeemail" {
+			rep.warnf(path, lineNo, "%s: unexpanded placeholder %q ignored", keyToken, value)
+			continue
+		}
+		if !cupsFilesDirectiveKnown(key) {
+			if cupsdDirectiveKnown(key) {
+				rep.warnf(path, lineNo, "%s belongs in cupsd.conf and is ignored here", keyToken)
+			} else {
+				rep.warnf(path, lineNo, "unknown directive %s", keyToken)
 			}
-		case "accesslog":
-			if value == "" {
-				cfg.AccessLogPath = ""
-				continue
+			continue
+		}
+		fail := func(format string, args ...any) {
+			rep.errorf(path, lineNo, format, args...)
+		}
+		if applyCupsFilesDirective(cfg, overrides, key, keyToken, value, fail) {
+			cfg.noteSource(key, fmt.Sprintf("%s:%d", filepath.Base(path), lineNo))
+		}
+	}
+}
+
+// applyCupsFilesDirective applies one cups-files.conf directive, read from
+// the file or from its environment variable. It reports whether the value
+// was taken; values that are locked by the environment or invalid are not.
+func applyCupsFilesDirective(cfg *Config, overrides *configOverrides, key, keyToken, value string, fail func(format string, args ...any)) bool {
+	switch key {
+	case "serverroot":
+		if overrides != nil && overrides.confDirLocked {
+			return false
+		}
+		if value != "" {
+			cfg.ConfDir = resolvePath(cfg.ConfDir, value)
+		}
+	case "datadir":
+		if overrides != nil && overrides.dataDirLocked {
+			return false
+		}
+		if value != "" {
+			cfg.DataDir = resolvePath(cfg.ConfDir, value)
+		}
+	case "requestroot":
+		if overrides != nil && overrides.spoolDir {
+			return false
+		}
+		if value != "" {
+			cfg.SpoolDir = resolvePath(cfg.ConfDir, value)
+			cfg.RequestRoot = cfg.SpoolDir
+			if overrides != nil {
+				overrides.spoolDir = true
 			}
-			cfg.AccessLogPath = resolvePath(cfg.ConfDir, value)
-		case "errorlog":
-			if value == "" {
-				cfg.ErrorLogPath = ""
-				continue
+		}
+	case "statedir":
+		if value != "" {
+			cfg.StateDir = resolvePath(cfg.ConfDir, value)
+		}
+	case "cachedir":
+		if value != "" {
+			cfg.CacheDir = resolvePath(cfg.ConfDir, value)
+		}
+	case "documentroot":
+		if value != "" {
+			cfg.DocumentRoot = resolvePath(cfg.ConfDir, value)
+		}
+	case "serverbin":
+		if value != "" {
+			cfg.ServerBin = resolvePath(cfg.ConfDir, value)
+			if cfg.DeviceBackendsDir == "" {
+				cfg.DeviceBackendsDir = filepath.Join(cfg.ServerBin, "backend")
 			}
-			cfg.ErrorLogPath = resolvePath(cfg.ConfDir, value)
-		case "pagelog":
-			if value == "" {
-				cfg.PageLogPath = ""
-				continue
+			if cfg.FilterDir == "" {
+				cfg.FilterDir = filepath.Join(cfg.ServerBin, "filter")
 			}
-			cfg.PageLogPath = resolvePath(cfg.ConfDir, value)
 		}
+	case "serverkeychain":
+		if value != "" {
+			cfg.ServerKeychain = resolvePath(cfg.ConfDir, value)
+		}
+	case "tempdir":
+		if value != "" {
+			cfg.TempDir = resolvePath(cfg.ConfDir, value)
+		}
+	case "createselfsignedcerts":
+		v, ok := parseBool(value)
+		if !ok {
+			fail("%s: invalid boolean %q", keyToken, value)
+			return false
+		}
+		cfg.TLSAutoGenerate = v
+	case "logfileperm":
+		n, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || n > 0o777 {
+			fail("%s: invalid permissions %q", keyToken, value)
+			return false
+		}
+		cfg.LogFilePerm = os.FileMode(n)
+	case "accesslog":
+		if value == "" {
+			cfg.AccessLogPath = ""
+			return true
+		}
+		cfg.AccessLogPath = resolveLogPath(cfg.ConfDir, value)
+	case "errorlog":
+		if value == "" {
+			cfg.ErrorLogPath = ""
+			return true
+		}
+		cfg.ErrorLogPath = resolveLogPath(cfg.ConfDir, value)
+	case "pagelog":
+		if value == "" {
+			cfg.PageLogPath = ""
+			return true
+		}
+		cfg.PageLogPath = resolveLogPath(cfg.ConfDir, value)
+	case "acmedirectory":
+		cfg.ACMEDirectory = value
+	case "acmeemail":
+		cfg.ACMEEmail = value
+	case "acmechallenge":
+		cfg.ACMEChallenge = strings.ToLower(value)
+	case "acmednshook":
+		if value != "" {
+			cfg.ACMEDNSHook = resolvePath(cfg.ConfDir, value)
+		}
+	case "acmecaroots":
+		if value != "" {
+			cfg.ACMECARoots = resolvePath(cfg.ConfDir, value)
+		}
+	case "acmerenewdays":
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			cfg.ACMERenewDays = n
+		} else {
+			fail("%s: %q is not a positive number", keyToken, value)
+			return false
+		}
+	case "auditlog":
+		if value == "" {
+			cfg.AuditLogPath = ""
+			return true
+		}
+		cfg.AuditLogPath = resolveLogPath(cfg.ConfDir, value)
+	default:
+		return false
 	}
+	return true
 }
 
 func applyCupsdConf(cfg *Config, overrides *configOverrides) {
@@ -462,6 +650,37 @@ func applyCupsdConf(cfg *Config, overrides *configOverrides) {
 }
 
 func parseCupsdConf(path string, cfg *Config, overrides *configOverrides) {
+	scanCupsdConf(path, cfg, overrides, nil)
+}
+
+// cupsdAliases are cupsd.conf directives that set the same value as another
+// one: Port and SSLPort add listeners, and MaxRequestSize is this server's
+// older name for LimitRequestBody.
+var cupsdAliases = map[string]bool{"port": true, "sslport": true, "maxrequestsize": true}
+
+// unusedCupsdDirectives are cupsd.conf directives CUPS accepts that this
+// server records in Config.Unused without acting on them, keyed by
+// lower-cased name. The Browse* directives other than BrowseLocalProtocols
+// and BrowseDNSSDSubTypes are CUPS 1.x leftovers.
+var unusedCupsdDirectives = canonicalNames(
+	"AutoPurgeJobs", "BrowseAddress", "BrowseAllow", "BrowseDeny", "BrowseDNSSDSubTypes",
+	"BrowseOrder", "BrowsePoll", "BrowseWebIF", "Classification", "ClassifyOverride",
+	"DefaultLanguage", "DefaultPaperSize", "DirtyCleanInterval", "FilterLimit", "FilterNice",
+	"GSSServiceName", "HostNameLookups", "IdleExitTimeout", "ListenBacklog", "LogDebugHistory",
+	"LogTimeFormat", "MaxActiveJobs", "PassEnv", "ServerAdmin", "StrictConformance",
+)
+
+func cupsdDirectiveKnown(key string) bool {
+	_, unused := unusedCupsdDirectives[key]
+	return cupsdAliases[key] || unused || lookupDirective(cupsdConf, key) != nil
+}
+
+func cupsFilesDirectiveKnown(key string) bool {
+	_, unused := unusedCupsFilesDirectives[key]
+	return unused || lookupDirective(cupsFilesConf, key) != nil
+}
+
+func scanCupsdConf(path string, cfg *Config, overrides *configOverrides, rep *ValidationReport) {
 	f, err := os.Open(path)
 	if err != nil {
 		return
@@ -470,7 +689,9 @@ func parseCupsdConf(path string, cfg *Config, overrides *configOverrides) {
 
 	sc := bufio.NewScanner(f)
 	blockDepth := 0
+	lineNo := 0
 	for sc.Scan() {
+		lineNo++
 		line := strings.TrimSpace(sc.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -489,131 +710,307 @@ func parseCupsdConf(path string, cfg *Config, overrides *configOverrides) {
 			continue
 		}
 		parts := strings.Fields(line)
-		if len(parts) < 2 {
-			continue
-		}
 		key := strings.ToLower(parts[0])
 		raw := strings.TrimSpace(line[len(key):])
 		value := unquoteValue(strings.TrimSpace(raw))
-		if strings.Contains(value, "@") {
+		if name, ok := unusedCupsdDirectives[key]; ok {
+			rep.warnf(path, lineNo, "%s is accepted but has no effect in this server", parts[0])
+			cfg.noteUnused(name, value, fmt.Sprintf("%s:%d", filepath.Base(path), lineNo))
 			continue
 		}
-		switch key {
-		case "listen":
-			if overrides != nil && overrides.listenHTTPLocked {
-				continue
-			}
-			lower := strings.ToLower(value)
-			if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "ipps://") || strings.HasPrefix(lower, "ssl://") {
-				if overrides == nil || !overrides.listenHTTPSLocked {
-					addListen(cfg, value, true)
-				}
+		if !cupsdDirectiveKnown(key) {
+			if cupsFilesDirectiveKnown(key) {
+				rep.warnf(path, lineNo, "%s belongs in cups-files.conf and is ignored here", parts[0])
 			} else {
-				addListen(cfg, value, false)
+				rep.warnf(path, lineNo, "unknown directive %s", parts[0])
 			}
-		case "port":
-			if overrides != nil && overrides.listenHTTPLocked {
-				continue
-			}
-			for _, p := range parts[1:] {
-				if p == "" {
-					continue
-				}
-				addListen(cfg, ":"+p, false)
+			continue
+		}
+		if len(parts) < 2 {
+			rep.errorf(path, lineNo, "%s: missing value", parts[0])
+			continue
+		}
+		if strings.Contains(value, "@") {
+			rep.warnf(path, lineNo, "%s: unexpanded placeholder %q ignored", parts[0], value)
+			continue
+		}
+		fail := func(format string, args ...any) {
+			rep.errorf(path, lineNo, format, args...)
+		}
+		if applyCupsdDirective(cfg, overrides, key, parts[0], parts[1:], value, fail) {
+			cfg.noteSource(canonicalCupsdKey(key), fmt.Sprintf("%s:%d", filepath.Base(path), lineNo))
+		}
+	}
+}
+
+// canonicalCupsdKey maps the alias directives onto the one Effective lists.
+func canonicalCupsdKey(key string) string {
+	switch key {
+	case "port":
+		return "listen"
+	case "sslport":
+		return "ssllisten"
+	case "maxrequestsize":
+		return "limitrequestbody"
+	}
+	return key
+}
+
+// applyCupsdDirective applies one top-level cupsd.conf directive, read from
+// the file or from its environment variable; args are the value's fields.
+// It reports whether the value was taken; values that are locked by the
+// environment or invalid are not.
+func applyCupsdDirective(cfg *Config, overrides *configOverrides, key, keyToken string, args []string, value string, fail func(format string, args ...any)) bool {
+	invalid := func(kind string) bool {
+		fail("%s: invalid %s %q", keyToken, kind, value)
+		return false
+	}
+	setInt := func(target *int) bool {
+		n, ok := parseInt(value)
+		if !ok {
+			return invalid("number")
+		}
+		*target = n
+		return true
+	}
+	setCount := func(target *int) bool {
+		n, ok := parseInt(value)
+		if !ok || n < 0 {
+			return invalid("number")
+		}
+		*target = n
+		return true
+	}
+	setTime := func(target *int) bool {
+		n, ok := parseTimeSeconds(value)
+		if !ok {
+			return invalid("time")
+		}
+		*target = n
+		return true
+	}
+	setBool := func(target *bool) bool {
+		v, ok := parseBool(value)
+		if !ok {
+			return invalid("boolean")
+		}
+		*target = v
+		return true
+	}
+	setSize := func(target *int64) bool {
+		v, ok := parseSize(value)
+		if !ok {
+			return invalid("size")
+		}
+		*target = v
+		return true
+	}
+	switch key {
+	case "listen":
+		if overrides != nil && overrides.listenHTTPLocked {
+			return false
+		}
+		lower := strings.ToLower(value)
+		if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "ipps://") || strings.HasPrefix(lower, "ssl://") {
+			if overrides != nil && overrides.listenHTTPSLocked {
+				return false
 			}
-		case "servername":
-			if overrides != nil && overrides.serverNameLocked {
+			addListen(cfg, value, true)
+		} else {
+			addListen(cfg, value, false)
+		}
+	case "ssllisten":
+		if overrides != nil && overrides.listenHTTPSLocked {
+			return false
+		}
+		addListen(cfg, value, true)
+	case "port", "sslport":
+		if overrides != nil && (overrides.listenHTTPLocked || key == "sslport" && overrides.listenHTTPSLocked) {
+			return false
+		}
+		added := false
+		for _, p := range args {
+			if n, err := strconv.Atoi(p); err != nil || n <= 0 || n > 65535 {
+				fail("%s: invalid port %q", keyToken, p)
 				continue
 			}
-			cfg.ServerName = value
-		case "serveralias":
-			cfg.ServerAlias = appendUniqueList(cfg.ServerAlias, parts[1:]...)
-		case "defaultpolicy":
-			cfg.DefaultPolicy = value
-		case "webinterface":
-			if v, ok := parseBool(value); ok {
-				cfg.WebInterface = v
-			}
-		case "maxrequestsize":
-			if v, ok := parseSize(value); ok {
-				cfg.MaxRequestSize = v
-			}
-		case "limitrequestbody":
-			if v, ok := parseSize(value); ok {
-				cfg.MaxRequestSize = v
-			}
-		case "maxlogsize":
-			if v, ok := parseSize(value); ok {
-				cfg.MaxLogSize = v
-			}
-		case "loglevel":
-			cfg.LogLevel = value
-		case "accessloglevel":
-			cfg.AccessLogLevel = strings.TrimSpace(value)
-		case "pagelogformat":
-			cfg.PageLogFormat = value
-		case "errorpolicy":
-			cfg.ErrorPolicy = value
-		case "defaultauthtype":
-			cfg.DefaultAuthType = value
-		case "browsing":
-			if v, ok := parseBool(value); ok {
-				cfg.BrowseLocal = v
-			}
-		case "browselocalprotocols":
-			cfg.BrowseLocalProtocols = parseBrowseLocalProtocols(parts[1:])
-		case "dnssdhostname":
-			cfg.DNSSDHostName = value
-		case "dnssdcomputername":
-			cfg.DNSSDComputerName = value
-		case "defaultencryption":
-			applyDefaultEncryption(cfg, value)
-		case "jobretrylimit":
-			if n, ok := parseInt(value); ok {
-				cfg.JobRetryLimit = n
-			}
-		case "jobretryinterval":
-			if n, ok := parseInt(value); ok {
-				cfg.JobRetryInterval = n
-			}
-		case "multipleoperationtimeout":
-			if n, ok := parseInt(value); ok {
-				cfg.MultipleOperationTimeout = n
-			}
-		case "maxjobtime":
-			if n, ok := parseTimeSeconds(value); ok {
-				cfg.MaxJobTime = n
-			}
-		case "maxevents":
-			if n, ok := parseInt(value); ok {
-				cfg.MaxEvents = n
-			}
-		case "maxleaseduration":
-			if n, ok := parseTimeSeconds(value); ok {
-				cfg.MaxLeaseDuration = n
-			}
-		case "defaultleaseduration":
-			if n, ok := parseTimeSeconds(value); ok {
-				cfg.DefaultLeaseDuration = n
-			}
-		case "maxsubscriptions":
-			if n, ok := parseInt(value); ok {
-				cfg.MaxSubscriptions = n
-			}
-		case "maxsubscriptionsperjob":
-			if n, ok := parseInt(value); ok {
-				cfg.MaxSubscriptionsPerJob = n
-			}
-		case "maxsubscriptionsperprinter":
-			if n, ok := parseInt(value); ok {
-				cfg.MaxSubscriptionsPerPrinter = n
+			addListen(cfg, ":"+p, key == "sslport")
+			added = true
+		}
+		return added
+	case "servername":
+		if overrides != nil && overrides.serverNameLocked {
+			return false
+		}
+		cfg.ServerName = value
+	case "serveralias":
+		cfg.ServerAlias = appendUniqueList(cfg.ServerAlias, args...)
+	case "defaultpolicy":
+		cfg.DefaultPolicy = value
+	case "webinterface":
+		return setBool(&cfg.WebInterface)
+	case "maxrequestsize", "limitrequestbody":
+		return setSize(&cfg.MaxRequestSize)
+	case "maxlogsize":
+		return setSize(&cfg.MaxLogSize)
+	case "loglevel":
+		cfg.LogLevel = value
+	case "logformat":
+		cfg.LogFormat = value
+	case "accessloglevel":
+		cfg.AccessLogLevel = strings.TrimSpace(value)
+	case "pagelogformat":
+		cfg.PageLogFormat = value
+	case "errorpolicy":
+		switch strings.ToLower(value) {
+		case "abort-job", "retry-job", "retry-current-job", "stop-printer":
+		default:
+			invalid("error policy")
+		}
+		cfg.ErrorPolicy = value
+	case "defaultauthtype":
+		cfg.DefaultAuthType = value
+	case "authmaxfailures":
+		return setCount(&cfg.AuthMaxFailures)
+	case "authbackoff":
+		return setTime(&cfg.AuthBackoff)
+	case "authlockouttime":
+		return setTime(&cfg.AuthLockoutTime)
+	case "authcachetime":
+		return setTime(&cfg.AuthCacheTime)
+	case "browsing":
+		return setBool(&cfg.BrowseLocal)
+	case "browselocalprotocols":
+		cfg.BrowseLocalProtocols = parseBrowseLocalProtocols(args)
+	case "dnssdhostname":
+		cfg.DNSSDHostName = value
+	case "dnssdcomputername":
+		cfg.DNSSDComputerName = value
+	case "defaultencryption":
+		switch strings.ToLower(value) {
+		case "never", "off", "no", "required", "always", "ifrequested", "on", "yes", "true":
+		default:
+			invalid("encryption")
+		}
+		applyDefaultEncryption(cfg, value)
+	case "jobretrylimit":
+		return setInt(&cfg.JobRetryLimit)
+	case "jobretryinterval":
+		return setInt(&cfg.JobRetryInterval)
+	case "multipleoperationtimeout":
+		return setInt(&cfg.MultipleOperationTimeout)
+	case "maxjobtime":
+		return setTime(&cfg.MaxJobTime)
+	case "maxevents":
+		return setInt(&cfg.MaxEvents)
+	case "maxleaseduration":
+		return setTime(&cfg.MaxLeaseDuration)
+	case "defaultleaseduration":
+		return setTime(&cfg.DefaultLeaseDuration)
+	case "maxsubscriptions":
+		return setInt(&cfg.MaxSubscriptions)
+	case "maxsubscriptionsperjob":
+		return setInt(&cfg.MaxSubscriptionsPerJob)
+	case "maxsubscriptionsperprinter":
+		return setInt(&cfg.MaxSubscriptionsPerPrinter)
+	case "maxsubscriptionsperuser":
+		return setInt(&cfg.MaxSubscriptionsPerUser)
+	case "timeout":
+		return setTime(&cfg.Timeout)
+	case "keepalive":
+		return setBool(&cfg.KeepAlive)
+	case "keepalivetimeout":
+		return setTime(&cfg.KeepAliveTimeout)
+	case "maxclients":
+		n, ok := parseInt(value)
+		if !ok || n < 1 {
+			return invalid("number")
+		}
+		cfg.MaxClients = n
+	case "maxclientsperhost":
+		return setCount(&cfg.MaxClientsPerHost)
+	case "servertokens":
+		switch strings.ToLower(value) {
+		case "none", "productonly", "major", "minor", "minimal", "os", "full":
+		default:
+			return invalid("value")
+		}
+		cfg.ServerTokens = value
+	case "ssloptions":
+		opts := []string{}
+		for _, opt := range args {
+			switch strings.ToLower(opt) {
+			case "none":
+				opts = opts[:0]
+			case "allowdh", "allowrc4", "allowssl3", "denycbc", "denytls1.0",
+				"mintls1.0", "mintls1.1", "mintls1.2", "mintls1.3",
+				"maxtls1.0", "maxtls1.1", "maxtls1.2", "maxtls1.3":
+				opts = append(opts, opt)
+			default:
+				fail("%s: unknown option %q", keyToken, opt)
+				return false
 			}
-		case "maxsubscriptionsperuser":
-			if n, ok := parseInt(value); ok {
-				cfg.MaxSubscriptionsPerUser = n
+		}
+		cfg.SSLOptions = opts
+	case "jobkilldelay":
+		return setTime(&cfg.JobKillDelay)
+	case "reloadtimeout":
+		return setTime(&cfg.ReloadTimeout)
+	case "preservejobhistory", "preservejobfiles":
+		if _, ok := parseBool(value); !ok {
+			if _, ok := parseTimeSeconds(value); !ok {
+				return invalid("value")
 			}
 		}
+		if key == "preservejobhistory" {
+			cfg.PreserveJobHistory = value
+		} else {
+			cfg.PreserveJobFiles = value
+		}
+	case "maxjobs":
+		return setCount(&cfg.MaxJobs)
+	case "maxjobsperprinter":
+		return setCount(&cfg.MaxJobsPerPrinter)
+	case "maxjobsperuser":
+		return setCount(&cfg.MaxJobsPerUser)
+	case "maxcopies":
+		n, ok := parseInt(value)
+		if !ok || n < 1 {
+			return invalid("number")
+		}
+		cfg.MaxCopies = n
+	case "maxholdtime":
+		return setTime(&cfg.MaxHoldTime)
+	case "defaultshared":
+		return setBool(&cfg.DefaultShared)
+	case "ripcache":
+		if _, ok := parseSize(value); !ok && !strings.EqualFold(value, "auto") {
+			return invalid("size")
+		}
+		cfg.RIPCache = value
+	case "setenv":
+		if len(args) < 2 || strings.Contains(args[0], "=") {
+			fail("%s: expected a variable name and a value", keyToken)
+			return false
+		}
+		setEnvValue(cfg, args[0], unquoteValue(strings.TrimSpace(value[len(args[0]):])))
+	default:
+		return false
+	}
+	return true
+}
+
+// setEnvValue records a SetEnv directive, replacing an earlier value for
+// the same variable.
+func setEnvValue(cfg *Config, name, value string) {
+	entry := name + "=" + value
+	for i, existing := range cfg.SetEnv {
+		if strings.HasPrefix(existing, name+"=") {
+			cfg.SetEnv[i] = entry
+			return
+		}
 	}
+	cfg.SetEnv = append(cfg.SetEnv, entry)
 }
 
 func applyDefaultEncryption(cfg *Config, value string) {
@@ -779,6 +1176,17 @@ func resolvePath(root, value string) string {
 	return filepath.Join(root, value)
 }
 
+// resolveLogPath keeps the special ErrorLog/AccessLog/PageLog targets
+// ("syslog", "stderr", "stdout", "-") instead of treating them as files.
+func resolveLogPath(root, value string) string {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(value) {
+	case "syslog", "stderr", "stdout", "-":
+		return strings.ToLower(value)
+	}
+	return resolvePath(root, value)
+}
+
 func parseBool(value string) (bool, bool) {
 	switch strings.ToLower(strings.TrimSpace(value)) {
 	case "1", "true", "yes", "on":
@@ -83,3 +83,167 @@ func TestParseCupsFilesConfBlankPageLogDisables(t *testing.T) {
 		t.Fatalf("PageLogPath = %q, want empty", cfg.PageLogPath)
 	}
 }
+
+func TestParseCupsdConfLogLevelAndFormat(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cupsd.conf")
+	if err := os.WriteFile(path, []byte("LogLevel debug2\nLogFormat json\n"), 0o644); err != nil {
+		t.Fatalf("write cupsd.conf: %v", err)
+	}
+
+	cfg := Config{ConfDir: dir}
+	parseCupsdConf(path, &cfg, nil)
+
+	if cfg.LogLevel != "debug2" {
+		t.Fatalf("LogLevel = %q, want debug2", cfg.LogLevel)
+	}
+	if cfg.LogFormat != "json" {
+		t.Fatalf("LogFormat = %q, want json", cfg.LogFormat)
+	}
+}
+
+func TestParseCupsdConfAuthLimits(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cupsd.conf")
+	data := "AuthMaxFailures 3\nAuthBackoff 2s\nAuthLockoutTime 30m\nAuthCacheTime 0\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatalf("write cupsd.conf: %v", err)
+	}
+
+	cfg := Config{ConfDir: dir, AuthCacheTime: 60}
+	parseCupsdConf(path, &cfg, nil)
+
+	if cfg.AuthMaxFailures != 3 {
+		t.Fatalf("AuthMaxFailures = %d, want 3", cfg.AuthMaxFailures)
+	}
+	if cfg.AuthBackoff != 2 {
+		t.Fatalf("AuthBackoff = %d, want 2", cfg.AuthBackoff)
+	}
+	if cfg.AuthLockoutTime != 30*60 {
+		t.Fatalf("AuthLockoutTime = %d, want 1800", cfg.AuthLockoutTime)
+	}
+	if cfg.AuthCacheTime != 0 {
+		t.Fatalf("AuthCacheTime = %d, want 0", cfg.AuthCacheTime)
+	}
+}
+
+func TestParseCupsFilesConfSpecialLogTargets(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cups-files.conf")
+	if err := os.WriteFile(path, []byte("ErrorLog syslog\nAccessLog stderr\n"), 0o644); err != nil {
+		t.Fatalf("write cups-files.conf: %v", err)
+	}
+
+	cfg := Config{ConfDir: dir}
+	parseCupsFilesConf(path, &cfg, nil)
+
+	if cfg.ErrorLogPath != "syslog" {
+		t.Fatalf("ErrorLogPath = %q, want syslog", cfg.ErrorLogPath)
+	}
+	if cfg.AccessLogPath != "stderr" {
+		t.Fatalf("AccessLogPath = %q, want stderr", cfg.AccessLogPath)
+	}
+}
+
+func TestParseCupsFilesConfACME(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cups-files.conf")
+	content := strings.Join([]string{
+		`ACMEDirectory https://acme.example.com/directory`,
+		`ACMEEmail admin@example.com`,
+		`ACMEChallenge DNS-01`,
+		`ACMEDNSHook hooks/dns`,
+		`ACMERenewDays 20`,
+		"",
+	}, "\n")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write cups-files.conf: %v", err)
+	}
+
+	cfg := Config{ConfDir: dir}
+	parseCupsFilesConf(path, &cfg, nil)
+
+	if cfg.ACMEDirectory != "https://acme.example.com/directory" {
+		t.Fatalf("ACMEDirectory = %q", cfg.ACMEDirectory)
+	}
+	if cfg.ACMEEmail != "admin@example.com" {
+		t.Fatalf("ACMEEmail = %q", cfg.ACMEEmail)
+	}
+	if cfg.ACMEChallenge != "dns-01" {
+		t.Fatalf("ACMEChallenge = %q", cfg.ACMEChallenge)
+	}
+	if cfg.ACMEDNSHook != filepath.Join(dir, "hooks", "dns") {
+		t.Fatalf("ACMEDNSHook = %q", cfg.ACMEDNSHook)
+	}
+	if cfg.ACMERenewDays != 20 {
+		t.Fatalf("ACMERenewDays = %d", cfg.ACMERenewDays)
+	}
+}
+
+func TestLoadRecordsDirectiveSources(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Join([]string{
+		`MaxClients 50`,
+		`Timeout 5m`,
+		`ServerAdmin root@example.com`,
+		`SetEnv PATH_EXTRA /opt/bin`,
+		"",
+	}, "\n")
+	if err := os.WriteFile(filepath.Join(dir, "cupsd.conf"), []byte(content), 0o644); err != nil {
+		t.Fatalf("write cupsd.conf: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cups-files.conf"), []byte("LogFilePerm 0600\n"), 0o644); err != nil {
+		t.Fatalf("write cups-files.conf: %v", err)
+	}
+	t.Setenv("CUPS_DATA_DIR", dir)
+	t.Setenv("CUPS_CONF_DIR", dir)
+	t.Setenv("CUPS_MAX_COPIES", "10")
+	t.Setenv("CUPS_TIMEOUT", "60")
+
+	cfg := Load()
+	if cfg.MaxClients != 50 || cfg.MaxCopies != 10 || cfg.Timeout != 60 || cfg.LogFilePerm != 0o600 {
+		t.Fatalf("MaxClients=%d MaxCopies=%d Timeout=%d LogFilePerm=%o", cfg.MaxClients, cfg.MaxCopies, cfg.Timeout, cfg.LogFilePerm)
+	}
+	if len(cfg.SetEnv) != 1 || cfg.SetEnv[0] != "PATH_EXTRA=/opt/bin" {
+		t.Fatalf("SetEnv = %#v", cfg.SetEnv)
+	}
+	for directive, want := range map[string]string{
+		"MaxClients":  "cupsd.conf:1",
+		"Timeout":     "env CUPS_TIMEOUT",
+		"MaxCopies":   "env CUPS_MAX_COPIES",
+		"LogFilePerm": "cups-files.conf:1",
+		"KeepAlive":   "default",
+	} {
+		if got := cfg.Source(directive); got != want {
+			t.Errorf("Source(%s) = %q, want %q", directive, got, want)
+		}
+	}
+
+	var unused *Setting
+	settings := Effective(cfg)
+	for i := range settings {
+		if settings[i].Directive == "ServerAdmin" {
+			unused = &settings[i]
+		}
+	}
+	if unused == nil || !unused.Unused || unused.Value != "root@example.com" || unused.Source != "cupsd.conf:3" {
+		t.Fatalf("ServerAdmin setting = %+v", unused)
+	}
+}
+
+func TestDirectiveEnvNames(t *testing.T) {
+	for name, want := range map[string]string{
+		"MaxClientsPerHost": "CUPS_MAX_CLIENTS_PER_HOST",
+		"RIPCache":          "CUPS_RIP_CACHE",
+		"SSLListen":         "CUPS_LISTEN_HTTPS",
+		"SetEnv":            "",
+	} {
+		d := lookupDirective(cupsdConf, name)
+		if d == nil {
+			t.Fatalf("directive %s not found", name)
+		}
+		if got := d.envName(); got != want {
+			t.Errorf("%s env = %q, want %q", name, got, want)
+		}
+	}
+}
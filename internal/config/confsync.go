@@ -0,0 +1,329 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cupsgolang/internal/logging"
+	"cupsgolang/internal/store"
+)
+
+// confSyncInterval is how often SyncLoop looks at printers.conf and
+// classes.conf. The store is only read when its generation moved, or at
+// least every confSyncFullInterval to catch writes by other processes.
+const (
+	confSyncInterval     = 2 * time.Second
+	confSyncFullInterval = 15 * time.Second
+)
+
+// confFileSync keeps one of printers.conf and classes.conf in step with the
+// store.
+type confFileSync struct {
+	path  string
+	class bool
+	// base is the state the file and the store last agreed on; a setting
+	// that differs from it on one side was changed there.
+	base map[string]queueConf
+	// hash is the content last read or written. A new content is only
+	// applied once it is seen on two polls in a row (pending), so an editor
+	// that is still writing the file is not imported half way.
+	hash    [sha256.Size]byte
+	pending *[sha256.Size]byte
+	// invalid is the last content rejected for syntax errors, so it is
+	// only reported once.
+	invalid [sha256.Size]byte
+	// generation and checked are the store generation and time of the
+	// last poll that read the store.
+	generation uint64
+	checked    time.Time
+}
+
+func newConfFileSync(confDir string, class bool) *confFileSync {
+	f := &confFileSync{path: filepath.Join(confDir, queueConfName(class)), class: class, base: map[string]queueConf{}}
+	if data, err := os.ReadFile(f.path); err == nil {
+		f.hash = sha256.Sum256(data)
+		queues, _ := parseQueueConf(bytes.NewReader(data), f.path, class, nil)
+		f.base = queueMap(queues)
+	}
+	return f
+}
+
+func queueMap(queues []queueConf) map[string]queueConf {
+	out := make(map[string]queueConf, len(queues))
+	for _, q := range queues {
+		out[strings.ToLower(q.name)] = q
+	}
+	return out
+}
+
+func queueMapsEqual(a, b map[string]queueConf) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, q := range a {
+		o, ok := b[name]
+		if !ok || o.name != q.name || !o.equal(q) {
+			return false
+		}
+	}
+	return true
+}
+
+func logQueueConf(msg string, args ...any) {
+	logging.Logger().Warn(msg, args...)
+}
+
+// sync runs one poll: an external edit of the file is merged into the store,
+// otherwise the file is rewritten if the store changed since the last poll.
+// Files are only written once the store transaction has committed.
+func (f *confFileSync) sync(ctx context.Context, st store.Repository) error {
+	data, err := os.ReadFile(f.path)
+	missing := os.IsNotExist(err)
+	if err != nil && !missing {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	edited := !missing && sum != f.hash
+	if edited && (f.pending == nil || *f.pending != sum) {
+		f.pending = &sum
+		return nil
+	}
+	f.pending = nil
+	generation, now := st.Generation(), time.Now()
+	if !edited && !missing && generation == f.generation && now.Sub(f.checked) < confSyncFullInterval {
+		return nil
+	}
+
+	var fileQueues map[string]queueConf
+	if edited {
+		rep := &ValidationReport{}
+		queues, err := parseQueueConf(bytes.NewReader(data), f.path, f.class, rep)
+		if err == nil && rep.HasErrors() {
+			for _, d := range rep.Diagnostics {
+				if d.Error {
+					err = errors.New(d.String())
+					break
+				}
+			}
+		}
+		if err != nil {
+			// Leave both sides alone until the file is fixed.
+			if sum != f.invalid {
+				f.invalid = sum
+				logQueueConf("Ignoring edited queue configuration until it parses", "file", f.path, "err", err)
+			}
+			return nil
+		}
+		fileQueues = queueMap(queues)
+	}
+
+	// What to do to the files once the transaction has committed: write
+	// queues (when rewrite is set), keep the edited file as conflict, or
+	// record the edit as agreed.
+	var (
+		rewrite  bool
+		queues   map[string]queueConf
+		conflict []byte
+	)
+	err = st.WithTx(ctx, !edited, func(tx store.Tx) error {
+		current, err := loadQueueConfs(ctx, st, tx, f.class)
+		if err != nil {
+			return err
+		}
+		if !edited {
+			if !missing && queueMapsEqual(current, f.base) {
+				return nil
+			}
+			for name, q := range current {
+				q.extra = f.base[name].extra
+				current[name] = q
+			}
+			rewrite, queues = true, current
+			return nil
+		}
+
+		merged, conflicts := mergeQueueConfs(f.path, f.base, fileQueues, current)
+		for name, q := range merged {
+			cur, ok := current[name]
+			if ok && cur.equal(q) {
+				continue
+			}
+			var curp *queueConf
+			if ok {
+				curp = &cur
+			}
+			if err := applyQueueConf(ctx, st, tx, q, curp, f.class); err != nil {
+				return err
+			}
+		}
+		for name, cur := range current {
+			if _, ok := merged[name]; ok {
+				continue
+			}
+			kept, err := deleteQueue(ctx, st, tx, cur.name, f.class)
+			if err != nil {
+				return err
+			}
+			if kept {
+				logQueueConf("Queue removed from file still has jobs; kept", "file", f.path, "queue", cur.name)
+				merged[name] = cur
+				conflicts++
+			}
+		}
+		logging.Logger().Info("Applied edited queue configuration", "file", f.path, "conflicts", conflicts)
+		if conflicts > 0 {
+			conflict = data
+		}
+		rewrite, queues = !queueMapsEqual(merged, fileQueues), merged
+		return nil
+	})
+	if err != nil {
+		// Nothing was stored; the edit is retried on the next poll.
+		return err
+	}
+	// A write committed meanwhile, including the merge above, moves the
+	// generation past this one and makes the next poll read the store.
+	f.generation, f.checked = generation, now
+	if conflict != nil {
+		if err := writeFileAtomic(f.path+".conflict", conflict); err != nil {
+			return err
+		}
+	}
+	if rewrite {
+		return f.write(queues)
+	}
+	if edited {
+		f.base = queues
+		f.hash = sum
+	}
+	return nil
+}
+
+func (f *confFileSync) write(queues map[string]queueConf) error {
+	data := renderQueueConf(queueList(queues), f.class)
+	if err := writeFileAtomic(f.path, data); err != nil {
+		return err
+	}
+	f.base = queues
+	f.hash = sha256.Sum256(data)
+	return nil
+}
+
+// deleteQueue removes a queue deleted from the file. A printer with queued
+// jobs is kept, and kept is true.
+func deleteQueue(ctx context.Context, st store.Repository, tx store.Tx, name string, class bool) (kept bool, err error) {
+	if class {
+		c, err := st.GetClassByName(ctx, tx, name)
+		if err != nil {
+			return false, err
+		}
+		return false, st.DeleteClass(ctx, tx, c.ID)
+	}
+	p, err := st.GetPrinterByName(ctx, tx, name)
+	if err != nil {
+		return false, err
+	}
+	queued, err := st.CountQueuedJobsByPrinterIDs(ctx, tx, []int64{p.ID})
+	if err != nil || queued > 0 {
+		return queued > 0, err
+	}
+	return false, st.DeletePrinter(ctx, tx, p.ID)
+}
+
+// mergeQueueConfs is a three-way merge of the file and the store against the
+// last state they agreed on. A setting changed on one side takes that side's
+// value; changed differently on both sides it is a conflict, the store's
+// value is kept and the conflict is logged. A queue deleted on one side and
+// changed on the other is kept as the store has it.
+func mergeQueueConfs(path string, base, file, db map[string]queueConf) (map[string]queueConf, int) {
+	merged := map[string]queueConf{}
+	conflicts := 0
+	names := map[string]bool{}
+	for _, m := range []map[string]queueConf{base, file, db} {
+		for name := range m {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		b, inBase := base[name]
+		f, inFile := file[name]
+		d, inDB := db[name]
+		switch {
+		case inFile && inDB:
+			q := queueConf{name: d.name, fields: map[string]string{}, extra: f.extra}
+			keys := map[string]bool{}
+			for _, m := range []map[string]string{b.fields, f.fields, d.fields} {
+				for k := range m {
+					keys[k] = true
+				}
+			}
+			for k := range keys {
+				fv, dv, bv := f.fields[k], d.fields[k], b.fields[k]
+				v := dv
+				switch {
+				case fv == dv, fv == bv:
+				case dv == bv:
+					v = fv
+				default:
+					conflicts++
+					logQueueConf("Queue configuration conflict; keeping the server's value",
+						"file", path, "queue", d.name, "directive", k, "file_value", fv, "server_value", dv)
+				}
+				if v != "" || k == "Member" {
+					q.fields[k] = v
+				}
+			}
+			merged[name] = q
+		case inFile:
+			if inBase && !b.equal(f) {
+				conflicts++
+				logQueueConf("Queue edited in the file was deleted on the server; not recreated", "file", path, "queue", f.name)
+			}
+			if !inBase {
+				merged[name] = f
+			}
+		case inDB:
+			if inBase && !b.equal(d) {
+				conflicts++
+				logQueueConf("Queue deleted from the file was changed on the server; kept", "file", path, "queue", d.name)
+				merged[name] = d
+			}
+			if !inBase {
+				merged[name] = d
+			}
+		}
+	}
+	return merged, conflicts
+}
+
+// SyncLoop keeps printers.conf and classes.conf in step with the store until
+// ctx is done. Store changes are written back atomically; edits to the files
+// are applied to the store once the file has stopped changing. When a setting
+// was changed differently on both sides the store's value wins, the conflict
+// is logged and the edited file is kept next to the original with a
+// ".conflict" suffix.
+func SyncLoop(ctx context.Context, confDir string, st store.Repository) {
+	files := []*confFileSync{newConfFileSync(confDir, false), newConfFileSync(confDir, true)}
+	ticker := time.NewTicker(confSyncInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				for _, f := range files {
+					if err := f.sync(ctx, st); err != nil {
+						logQueueConf("Failed to sync queue configuration", "file", f.path, "err", err)
+					}
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,272 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+func newSyncFixture(t *testing.T) (context.Context, string, *store.Memory, *confFileSync) {
+	t.Helper()
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := store.NewMemory()
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		_, err := st.CreatePrinter(ctx, tx, "Office", "ipp://office/ipp/print", "Lab", "Office laser", "", true, false, true, "", `{"media":"iso_a4_210x297mm"}`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create printer: %v", err)
+	}
+	if err := SyncToConf(ctx, dir, st); err != nil {
+		t.Fatalf("SyncToConf: %v", err)
+	}
+	return ctx, dir, st, newConfFileSync(dir, false)
+}
+
+func readConf(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func printerByName(t *testing.T, ctx context.Context, st store.Repository, name string) model.Printer {
+	t.Helper()
+	var p model.Printer
+	err := st.WithTx(ctx, true, func(tx store.Tx) error {
+		var err error
+		p, err = st.GetPrinterByName(ctx, tx, name)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("get %s: %v", name, err)
+	}
+	return p
+}
+
+// syncTwice applies an edit: a new file content is only taken on the
+// second poll that sees it.
+func syncTwice(t *testing.T, ctx context.Context, f *confFileSync, st store.Repository) {
+	t.Helper()
+	for i := 0; i < 2; i++ {
+		if err := f.sync(ctx, st); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+}
+
+func TestConfSyncWritesStoreChanges(t *testing.T) {
+	ctx, dir, st, f := newSyncFixture(t)
+	path := filepath.Join(dir, "printers.conf")
+	text := readConf(t, path)
+	for _, want := range []string{"# Written by cupsgolang", "<Printer Office>", "Info Office laser", "Shared Yes", "Option media iso_a4_210x297mm"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("missing %q in:\n%s", want, text)
+		}
+	}
+
+	p := printerByName(t, ctx, st, "Office")
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		return st.UpdatePrinterAccepting(ctx, tx, p.ID, false)
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := f.sync(ctx, st); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if text := readConf(t, path); !strings.Contains(text, "Accepting No") {
+		t.Fatalf("store change not written:\n%s", text)
+	}
+}
+
+func TestConfSyncAppliesFileEdits(t *testing.T) {
+	ctx, dir, st, f := newSyncFixture(t)
+	path := filepath.Join(dir, "printers.conf")
+	text := strings.Replace(readConf(t, path), "Info Office laser", "Info Second floor laser", 1)
+	text += "<Printer Lobby>\nDeviceURI ipp://lobby/ipp/print\nShared No\nUUID urn:uuid:1234\n</Printer>\n"
+	writeConfFiles(t, dir, map[string]string{"printers.conf": text})
+
+	if err := f.sync(ctx, st); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if p := printerByName(t, ctx, st, "Office"); p.Info != "Office laser" {
+		t.Fatalf("edit applied before the file was stable: %q", p.Info)
+	}
+	if err := f.sync(ctx, st); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if p := printerByName(t, ctx, st, "Office"); p.Info != "Second floor laser" {
+		t.Fatalf("Info = %q", p.Info)
+	}
+	lobby := printerByName(t, ctx, st, "Lobby")
+	if lobby.URI != "ipp://lobby/ipp/print" || lobby.Shared {
+		t.Fatalf("Lobby = %+v", lobby)
+	}
+	if text := readConf(t, path); !strings.Contains(text, "UUID urn:uuid:1234") {
+		t.Fatalf("unsynced directive dropped:\n%s", text)
+	}
+
+	// Removing the block deletes the printer.
+	text = readConf(t, path)
+	start := strings.Index(text, "<Printer Lobby>")
+	end := strings.Index(text[start:], "</Printer>\n") + start + len("</Printer>\n")
+	writeConfFiles(t, dir, map[string]string{"printers.conf": text[:start] + text[end:]})
+	syncTwice(t, ctx, f, st)
+	err := st.WithTx(ctx, true, func(tx store.Tx) error {
+		_, err := st.GetPrinterByName(ctx, tx, "Lobby")
+		return err
+	})
+	if err == nil {
+		t.Fatalf("Lobby still in the store")
+	}
+}
+
+func TestConfSyncConflictKeepsStoreValue(t *testing.T) {
+	ctx, dir, st, f := newSyncFixture(t)
+	path := filepath.Join(dir, "printers.conf")
+	edited := strings.Replace(readConf(t, path), "Location Lab", "Location Basement", 1)
+
+	p := printerByName(t, ctx, st, "Office")
+	location := "Annex"
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		return st.UpdatePrinterAttributes(ctx, tx, p.ID, nil, &location, nil, nil, nil)
+	})
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	writeConfFiles(t, dir, map[string]string{"printers.conf": edited})
+	syncTwice(t, ctx, f, st)
+
+	if p := printerByName(t, ctx, st, "Office"); p.Location != "Annex" {
+		t.Fatalf("Location = %q, want the store's value", p.Location)
+	}
+	if text := readConf(t, path); !strings.Contains(text, "Location Annex") {
+		t.Fatalf("file not rewritten with the store's value:\n%s", text)
+	}
+	if text := readConf(t, path+".conflict"); !strings.Contains(text, "Location Basement") {
+		t.Fatalf("conflicting edit not kept:\n%s", text)
+	}
+}
+
+// flakyStore counts transactions and can fail write transactions at
+// commit, after their callback ran.
+type flakyStore struct {
+	*store.Memory
+	failCommit bool
+	txs        int
+}
+
+func (s *flakyStore) WithTx(ctx context.Context, readOnly bool, fn func(tx store.Tx) error) error {
+	s.txs++
+	return s.Memory.WithTx(ctx, readOnly, func(tx store.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if s.failCommit && !readOnly {
+			return errors.New("commit failed")
+		}
+		return nil
+	})
+}
+
+func TestConfSyncLeavesFilesAloneWhenCommitFails(t *testing.T) {
+	ctx, dir, mem, f := newSyncFixture(t)
+	st := &flakyStore{Memory: mem}
+	path := filepath.Join(dir, "printers.conf")
+	edited := strings.Replace(readConf(t, path), "Location Lab", "Location Basement", 1)
+	p := printerByName(t, ctx, st, "Office")
+	location := "Annex"
+	if err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		return st.UpdatePrinterAttributes(ctx, tx, p.ID, nil, &location, nil, nil, nil)
+	}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	writeConfFiles(t, dir, map[string]string{"printers.conf": edited})
+
+	st.failCommit = true
+	if err := f.sync(ctx, st); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := f.sync(ctx, st); err == nil {
+		t.Fatalf("sync succeeded although the commit failed")
+	}
+	if text := readConf(t, path); text != edited {
+		t.Fatalf("file changed by a sync that did not commit:\n%s", text)
+	}
+	if _, err := os.Stat(path + ".conflict"); !os.IsNotExist(err) {
+		t.Fatalf("conflict file written by a sync that did not commit: %v", err)
+	}
+
+	// The edit is merged once the store commits again.
+	st.failCommit = false
+	syncTwice(t, ctx, f, st)
+	if text := readConf(t, path); !strings.Contains(text, "Location Annex") {
+		t.Fatalf("file not rewritten with the store's value:\n%s", text)
+	}
+	if text := readConf(t, path+".conflict"); !strings.Contains(text, "Location Basement") {
+		t.Fatalf("conflicting edit not kept:\n%s", text)
+	}
+}
+
+func TestConfSyncSkipsStoreWhenNothingChanged(t *testing.T) {
+	ctx, dir, mem, f := newSyncFixture(t)
+	st := &flakyStore{Memory: mem}
+	if err := f.sync(ctx, st); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	st.txs = 0
+	for i := 0; i < 3; i++ {
+		if err := f.sync(ctx, st); err != nil {
+			t.Fatalf("sync: %v", err)
+		}
+	}
+	if st.txs != 0 {
+		t.Fatalf("idle polls opened %d transactions", st.txs)
+	}
+
+	p := printerByName(t, ctx, st, "Office")
+	if err := mem.WithTx(ctx, false, func(tx store.Tx) error {
+		return mem.UpdatePrinterAccepting(ctx, tx, p.ID, false)
+	}); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if err := f.sync(ctx, st); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if text := readConf(t, filepath.Join(dir, "printers.conf")); !strings.Contains(text, "Accepting No") {
+		t.Fatalf("store change not written:\n%s", text)
+	}
+}
+
+func TestSyncFromConfKeepsUnstatedSettings(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	st := store.NewMemory()
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		_, err := st.CreatePrinter(ctx, tx, "Office", "ipp://old/ipp/print", "", "", "", true, false, false, "", `{"media":"na_letter_8.5x11in"}`)
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create printer: %v", err)
+	}
+	writeConfFiles(t, dir, map[string]string{
+		"printers.conf": "<Printer Office>\nDeviceURI ipp://office/ipp/print\nState 3\n</Printer>\n",
+	})
+	if err := SyncFromConf(ctx, dir, st); err != nil {
+		t.Fatalf("SyncFromConf: %v", err)
+	}
+	p := printerByName(t, ctx, st, "Office")
+	if p.URI != "ipp://office/ipp/print" || p.Shared || !strings.Contains(p.DefaultOptions, "na_letter") {
+		t.Fatalf("printer = %+v", p)
+	}
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	cupsdConf     = "cupsd.conf"
+	cupsFilesConf = "cups-files.conf"
+)
+
+// directive describes one configuration directive Load understands: the
+// file it belongs in, the environment variable that overrides it and how
+// its effective value is shown. Each file's apply function does the
+// parsing, for the file and the environment alike.
+type directive struct {
+	name string
+	file string
+	// env is the overriding variable; empty means CUPS_ followed by the
+	// name in upper snake case, "-" means there is none.
+	env   string
+	value func(Config) []string
+}
+
+var directives = []directive{
+	{name: "AccessLogLevel", file: cupsdConf, value: str(func(c Config) string { return c.AccessLogLevel })},
+	{name: "AuthBackoff", file: cupsdConf, value: num(func(c Config) int { return c.AuthBackoff })},
+	{name: "AuthCacheTime", file: cupsdConf, value: num(func(c Config) int { return c.AuthCacheTime })},
+	{name: "AuthLockoutTime", file: cupsdConf, value: num(func(c Config) int { return c.AuthLockoutTime })},
+	{name: "AuthMaxFailures", file: cupsdConf, value: num(func(c Config) int { return c.AuthMaxFailures })},
+	{name: "BrowseLocalProtocols", file: cupsdConf, value: str(func(c Config) string {
+		if len(c.BrowseLocalProtocols) == 0 {
+			return "none"
+		}
+		return strings.Join(c.BrowseLocalProtocols, " ")
+	})},
+	{name: "Browsing", file: cupsdConf, value: yesNo(func(c Config) bool { return c.BrowseLocal })},
+	{name: "DNSSDComputerName", file: cupsdConf, value: str(func(c Config) string { return c.DNSSDComputerName })},
+	{name: "DNSSDHostName", file: cupsdConf, value: str(func(c Config) string { return c.DNSSDHostName })},
+	{name: "DefaultAuthType", file: cupsdConf, value: str(func(c Config) string { return c.DefaultAuthType })},
+	{name: "DefaultEncryption", file: cupsdConf, value: str(func(c Config) string {
+		switch {
+		case !c.TLSEnabled:
+			return "Never"
+		case c.TLSOnly:
+			return "Required"
+		}
+		return "IfRequested"
+	})},
+	{name: "DefaultLeaseDuration", file: cupsdConf, value: num(func(c Config) int { return c.DefaultLeaseDuration })},
+	{name: "DefaultPolicy", file: cupsdConf, value: str(func(c Config) string { return c.DefaultPolicy })},
+	{name: "DefaultShared", file: cupsdConf, value: yesNo(func(c Config) bool { return c.DefaultShared })},
+	{name: "ErrorPolicy", file: cupsdConf, value: str(func(c Config) string { return c.ErrorPolicy })},
+	{name: "JobKillDelay", file: cupsdConf, value: num(func(c Config) int { return c.JobKillDelay })},
+	{name: "JobRetryInterval", file: cupsdConf, value: num(func(c Config) int { return c.JobRetryInterval })},
+	{name: "JobRetryLimit", file: cupsdConf, value: num(func(c Config) int { return c.JobRetryLimit })},
+	{name: "KeepAlive", file: cupsdConf, value: yesNo(func(c Config) bool { return c.KeepAlive })},
+	{name: "KeepAliveTimeout", file: cupsdConf, value: num(func(c Config) int { return c.KeepAliveTimeout })},
+	{name: "LimitRequestBody", file: cupsdConf, value: size(func(c Config) int64 { return c.MaxRequestSize })},
+	{name: "Listen", file: cupsdConf, env: "CUPS_LISTEN_HTTP", value: func(c Config) []string { return c.ListenHTTP }},
+	{name: "LogFormat", file: cupsdConf, value: str(func(c Config) string { return c.LogFormat })},
+	{name: "LogLevel", file: cupsdConf, value: str(func(c Config) string { return c.LogLevel })},
+	{name: "MaxClients", file: cupsdConf, value: num(func(c Config) int { return c.MaxClients })},
+	{name: "MaxClientsPerHost", file: cupsdConf, value: num(func(c Config) int { return c.MaxClientsPerHost })},
+	{name: "MaxCopies", file: cupsdConf, value: num(func(c Config) int { return c.MaxCopies })},
+	{name: "MaxEvents", file: cupsdConf, value: num(func(c Config) int { return c.MaxEvents })},
+	{name: "MaxHoldTime", file: cupsdConf, value: num(func(c Config) int { return c.MaxHoldTime })},
+	{name: "MaxJobTime", file: cupsdConf, value: num(func(c Config) int { return c.MaxJobTime })},
+	{name: "MaxJobs", file: cupsdConf, value: num(func(c Config) int { return c.MaxJobs })},
+	{name: "MaxJobsPerPrinter", file: cupsdConf, value: num(func(c Config) int { return c.MaxJobsPerPrinter })},
+	{name: "MaxJobsPerUser", file: cupsdConf, value: num(func(c Config) int { return c.MaxJobsPerUser })},
+	{name: "MaxLeaseDuration", file: cupsdConf, value: num(func(c Config) int { return c.MaxLeaseDuration })},
+	{name: "MaxLogSize", file: cupsdConf, value: size(func(c Config) int64 { return c.MaxLogSize })},
+	{name: "MaxSubscriptions", file: cupsdConf, value: num(func(c Config) int { return c.MaxSubscriptions })},
+	{name: "MaxSubscriptionsPerJob", file: cupsdConf, value: num(func(c Config) int { return c.MaxSubscriptionsPerJob })},
+	{name: "MaxSubscriptionsPerPrinter", file: cupsdConf, value: num(func(c Config) int { return c.MaxSubscriptionsPerPrinter })},
+	{name: "MaxSubscriptionsPerUser", file: cupsdConf, value: num(func(c Config) int { return c.MaxSubscriptionsPerUser })},
+	{name: "MultipleOperationTimeout", file: cupsdConf, value: num(func(c Config) int { return c.MultipleOperationTimeout })},
+	{name: "PageLogFormat", file: cupsdConf, value: str(func(c Config) string { return c.PageLogFormat })},
+	{name: "PreserveJobFiles", file: cupsdConf, value: str(func(c Config) string { return c.PreserveJobFiles })},
+	{name: "PreserveJobHistory", file: cupsdConf, value: str(func(c Config) string { return c.PreserveJobHistory })},
+	{name: "RIPCache", file: cupsdConf, value: str(func(c Config) string { return c.RIPCache })},
+	{name: "ReloadTimeout", file: cupsdConf, value: num(func(c Config) int { return c.ReloadTimeout })},
+	{name: "SSLListen", file: cupsdConf, env: "CUPS_LISTEN_HTTPS", value: func(c Config) []string { return c.ListenHTTPS }},
+	{name: "SSLOptions", file: cupsdConf, value: str(func(c Config) string {
+		if len(c.SSLOptions) == 0 {
+			return "None"
+		}
+		return strings.Join(c.SSLOptions, " ")
+	})},
+	{name: "ServerAlias", file: cupsdConf, value: str(func(c Config) string { return strings.Join(c.ServerAlias, " ") })},
+	{name: "ServerName", file: cupsdConf, value: str(func(c Config) string { return c.ServerName })},
+	{name: "ServerTokens", file: cupsdConf, value: str(func(c Config) string { return c.ServerTokens })},
+	{name: "SetEnv", file: cupsdConf, env: "-", value: func(c Config) []string {
+		out := make([]string, 0, len(c.SetEnv))
+		for _, kv := range c.SetEnv {
+			name, value, _ := strings.Cut(kv, "=")
+			out = append(out, name+" "+value)
+		}
+		return out
+	}},
+	{name: "Timeout", file: cupsdConf, value: num(func(c Config) int { return c.Timeout })},
+	{name: "WebInterface", file: cupsdConf, value: yesNo(func(c Config) bool { return c.WebInterface })},
+
+	{name: "ACMECARoots", file: cupsFilesConf, env: "CUPS_ACME_CA_ROOTS", value: str(func(c Config) string { return c.ACMECARoots })},
+	{name: "ACMEChallenge", file: cupsFilesConf, value: str(func(c Config) string { return c.ACMEChallenge })},
+	{name: "ACMEDNSHook", file: cupsFilesConf, env: "CUPS_ACME_DNS_HOOK", value: str(func(c Config) string { return c.ACMEDNSHook })},
+	{name: "ACMEDirectory", file: cupsFilesConf, value: str(func(c Config) string { return c.ACMEDirectory })},
+	{name: "ACMEEmail", file: cupsFilesConf, value: str(func(c Config) string { return c.ACMEEmail })},
+	{name: "ACMERenewDays", file: cupsFilesConf, value: num(func(c Config) int { return c.ACMERenewDays })},
+	{name: "AccessLog", file: cupsFilesConf, value: str(func(c Config) string { return c.AccessLogPath })},
+	{name: "AuditLog", file: cupsFilesConf, value: str(func(c Config) string { return c.AuditLogPath })},
+	{name: "CacheDir", file: cupsFilesConf, value: str(func(c Config) string { return c.CacheDir })},
+	{name: "CreateSelfSignedCerts", file: cupsFilesConf, env: "CUPS_TLS_AUTOGEN", value: yesNo(func(c Config) bool { return c.TLSAutoGenerate })},
+	{name: "DataDir", file: cupsFilesConf, value: str(func(c Config) string { return c.DataDir })},
+	{name: "DocumentRoot", file: cupsFilesConf, value: str(func(c Config) string { return c.DocumentRoot })},
+	{name: "ErrorLog", file: cupsFilesConf, value: str(func(c Config) string { return c.ErrorLogPath })},
+	{name: "LogFilePerm", file: cupsFilesConf, value: str(func(c Config) string { return fmt.Sprintf("%04o", uint32(c.LogFilePerm)) })},
+	{name: "PageLog", file: cupsFilesConf, value: str(func(c Config) string { return c.PageLogPath })},
+	{name: "RequestRoot", file: cupsFilesConf, env: "CUPS_SPOOL_DIR", value: str(func(c Config) string { return c.SpoolDir })},
+	{name: "ServerBin", file: cupsFilesConf, value: str(func(c Config) string { return c.ServerBin })},
+	{name: "ServerKeychain", file: cupsFilesConf, value: str(func(c Config) string { return c.ServerKeychain })},
+	{name: "ServerRoot", file: cupsFilesConf, env: "CUPS_CONF_DIR", value: str(func(c Config) string { return c.ConfDir })},
+	{name: "StateDir", file: cupsFilesConf, value: str(func(c Config) string { return c.StateDir })},
+	{name: "TempDir", file: cupsFilesConf, value: str(func(c Config) string { return c.TempDir })},
+}
+
+// explicitEnv are the variables applyEnvOverrides reads itself, with their
+// own parsing and precedence rules.
+var explicitEnv = map[string]bool{
+	"CUPS_DATA_DIR": true, "CUPS_CONF_DIR": true, "CUPS_SPOOL_DIR": true,
+	"CUPS_LISTEN_HTTP": true, "CUPS_LISTEN_HTTPS": true, "CUPS_SERVER_NAME": true,
+	"CUPS_ACME_DIRECTORY": true, "CUPS_ACME_EMAIL": true, "CUPS_ACME_CHALLENGE": true,
+	"CUPS_ACME_DNS_HOOK": true, "CUPS_LOG_LEVEL": true, "CUPS_LOG_FORMAT": true,
+	"CUPS_ERROR_LOG": true, "CUPS_AUDIT_LOG": true, "CUPS_ACCESS_LOG_LEVEL": true,
+	"CUPS_PAGE_LOG_FORMAT": true, "CUPS_MULTIPLE_OPERATION_TIMEOUT": true,
+	"CUPS_MAX_EVENTS": true, "CUPS_MAX_LEASE_DURATION": true, "CUPS_DEFAULT_LEASE_DURATION": true,
+	"CUPS_MAX_SUBSCRIPTIONS": true, "CUPS_MAX_SUBSCRIPTIONS_PER_JOB": true,
+	"CUPS_MAX_SUBSCRIPTIONS_PER_PRINTER": true, "CUPS_MAX_SUBSCRIPTIONS_PER_USER": true,
+	"CUPS_MAX_JOB_TIME": true, "CUPS_TLS_AUTOGEN": true,
+}
+
+func str(f func(Config) string) func(Config) []string {
+	return func(c Config) []string { return []string{f(c)} }
+}
+
+func num(f func(Config) int) func(Config) []string {
+	return func(c Config) []string { return []string{strconv.Itoa(f(c))} }
+}
+
+func size(f func(Config) int64) func(Config) []string {
+	return func(c Config) []string { return []string{strconv.FormatInt(f(c), 10)} }
+}
+
+func yesNo(f func(Config) bool) func(Config) []string {
+	return func(c Config) []string {
+		if f(c) {
+			return []string{"Yes"}
+		}
+		return []string{"No"}
+	}
+}
+
+func lookupDirective(file, key string) *directive {
+	for i := range directives {
+		if directives[i].file == file && strings.EqualFold(directives[i].name, key) {
+			return &directives[i]
+		}
+	}
+	return nil
+}
+
+// canonicalNames maps the lower-cased names to the names as given.
+func canonicalNames(names ...string) map[string]string {
+	out := make(map[string]string, len(names))
+	for _, name := range names {
+		out[strings.ToLower(name)] = name
+	}
+	return out
+}
+
+// envName is the variable that overrides the directive.
+func (d directive) envName() string {
+	if d.env == "-" {
+		return ""
+	}
+	if d.env != "" {
+		return d.env
+	}
+	// Split "MaxClientsPerHost" into words, keeping runs of capitals such as
+	// "DNSSD" or "SSL" together: CUPS_MAX_CLIENTS_PER_HOST.
+	var b strings.Builder
+	runes := []rune(d.name)
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) &&
+			(unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return "CUPS_" + b.String()
+}
+
+// applyDirectiveEnv applies the CUPS_* variable of every directive that
+// applyEnvOverrides does not handle itself, with the same parsing as the
+// configuration files, and records the source of each variable that is set.
+func applyDirectiveEnv(cfg *Config, overrides *configOverrides) {
+	for _, d := range directives {
+		env := d.envName()
+		if env == "" {
+			continue
+		}
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(d.name)
+		if !explicitEnv[env] {
+			value := unquoteValue(v)
+			ignore := func(string, ...any) {}
+			if d.file == cupsdConf {
+				ok = len(strings.Fields(v)) > 0 && applyCupsdDirective(cfg, overrides, key, env, strings.Fields(v), value, ignore)
+			} else {
+				ok = applyCupsFilesDirective(cfg, overrides, key, env, value, ignore)
+			}
+		}
+		if ok {
+			cfg.noteSource(key, "env "+env)
+		}
+	}
+}
+
+func (c *Config) noteSource(key, source string) {
+	if c.sources == nil {
+		c.sources = map[string]string{}
+	}
+	c.sources[strings.ToLower(key)] = source
+}
+
+func (c *Config) noteUnused(name, value, source string) {
+	if c.Unused == nil {
+		c.Unused = map[string]string{}
+	}
+	c.Unused[name] = value
+	c.noteSource(name, source)
+}
+
+// Source reports where the directive's value came from: "file:line",
+// "env VARIABLE" or "default".
+func (c Config) Source(directive string) string {
+	if src, ok := c.sources[strings.ToLower(directive)]; ok {
+		return src
+	}
+	return "default"
+}
+
+// Setting is one directive of the effective configuration.
+type Setting struct {
+	Directive string
+	File      string
+	Value     string
+	Source    string
+	// Unused marks directives that are accepted but have no effect.
+	Unused bool
+}
+
+// Effective lists the configuration cfg holds, one Setting per directive
+// (one per value for Listen, SSLListen and SetEnv), cupsd.conf first. Unused
+// directives are listed only when set.
+func Effective(cfg Config) []Setting {
+	var out []Setting
+	for _, file := range []string{cupsdConf, cupsFilesConf} {
+		for _, d := range directives {
+			if d.file != file {
+				continue
+			}
+			for _, v := range d.value(cfg) {
+				out = append(out, Setting{Directive: d.name, File: file, Value: v, Source: cfg.Source(d.name)})
+			}
+		}
+		unused := unusedCupsdDirectives
+		if file == cupsFilesConf {
+			unused = unusedCupsFilesDirectives
+		}
+		names := make([]string, 0, len(cfg.Unused))
+		for _, name := range unused {
+			if _, ok := cfg.Unused[name]; ok {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			out = append(out, Setting{Directive: name, File: file, Value: cfg.Unused[name], Source: cfg.Source(name), Unused: true})
+		}
+	}
+	return out
+}
@@ -2,267 +2,694 @@ package config
 
 import (
 	"bufio"
+	"bytes"
 	"context"
-	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
-	"strconv"
+	"sort"
 	"strings"
 	"time"
 
+	"cupsgolang/internal/fsutil"
 	"cupsgolang/internal/model"
 	"cupsgolang/internal/store"
 )
 
-type legacyPrinter struct {
-	name      string
-	info      string
-	location  string
-	deviceURI string
-	geo       string
-	org       string
-	orgUnit   string
+// queueConf is one queue as printers.conf or classes.conf describes it. Fields
+// maps directive names to values and always holds every synced setting (see
+// newQueueConf), so a file and the store can be compared field by field.
+// Repeated directives are folded: "Member" holds the members one per line and
+// each "Option name value" becomes the key "Option name".
+type queueConf struct {
+	line   int
+	name   string
+	fields map[string]string
+	// extra keeps directives that are not synced with the store (UUID,
+	// Attribute, ...) so rewriting the file does not drop them.
+	extra []string
+	// stated holds the fields the file spelled out rather than defaulted.
+	stated map[string]bool
 }
 
-type legacyClass struct {
-	name     string
-	info     string
-	location string
-	members  []string
+// queueConfKeys are the per-queue directives CUPS writes to printers.conf
+// and classes.conf. Only some are synced; the rest are kept as they are.
+var queueConfKeys = map[string]bool{
+	"Info": true, "Location": true, "DeviceURI": true, "GeoLocation": true,
+	"Organization": true, "OrganizationalUnit": true, "Member": true, "State": true,
+	"StateMessage": true, "StateTime": true, "Reason": true, "Type": true,
+	"Accepting": true, "Shared": true, "JobSheets": true, "QuotaPeriod": true,
+	"PageLimit": true, "KLimit": true, "OpPolicy": true, "ErrorPolicy": true,
+	"Attribute": true, "Option": true, "MakeModel": true, "UUID": true,
+	"PortMonitor": true, "AllowUser": true, "DenyUser": true, "AuthInfoRequired": true,
+	"ConfigTime": true, "Filter": true, "Product": true, "MarkerChangeTime": true,
 }
 
-func SyncFromConf(ctx context.Context, confDir string, st *store.Store) error {
-	if confDir == "" || st == nil {
+// Directives whose value is stored as-is; the others in newQueueConf are
+// normalized on the way in.
+var (
+	printerTextKeys = []string{"Info", "Location", "DeviceURI", "GeoLocation", "Organization", "OrganizationalUnit", "ErrorPolicy", "OpPolicy"}
+	classTextKeys   = []string{"Info", "Location", "ErrorPolicy", "OpPolicy"}
+)
+
+// ErrorPolicy and OpPolicy are kept with the queue's default options, as
+// migrate does.
+var policyOptionKeys = map[string]string{
+	"ErrorPolicy": "printer-error-policy",
+	"OpPolicy":    "printer-op-policy",
+}
+
+func newQueueConf(name string, class bool) queueConf {
+	q := queueConf{name: name, fields: map[string]string{
+		"Default":   "No",
+		"State":     "Idle",
+		"Accepting": "Yes",
+		"JobSheets": "none none",
+	}}
+	if class {
+		q.fields["Member"] = ""
+	} else {
+		q.fields["Shared"] = "Yes"
+	}
+	return q
+}
+
+func (q queueConf) members() []string {
+	if q.fields["Member"] == "" {
 		return nil
 	}
-	_ = os.MkdirAll(confDir, 0755)
-	printers, _ := parsePrintersConf(filepath.Join(confDir, "printers.conf"))
-	classes, _ := parseClassesConf(filepath.Join(confDir, "classes.conf"))
+	return strings.Split(q.fields["Member"], "\n")
+}
 
-	return st.WithTx(ctx, false, func(tx *sql.Tx) error {
-		for _, p := range printers {
-			printer, _ := st.UpsertPrinter(ctx, tx, p.name, p.deviceURI, p.location, p.info, true)
-			var geo *string
-			var org *string
-			var orgUnit *string
-			if p.geo != "" {
-				geo = &p.geo
-			}
-			if p.org != "" {
-				org = &p.org
-			}
-			if p.orgUnit != "" {
-				orgUnit = &p.orgUnit
-			}
-			if geo != nil || org != nil || orgUnit != nil {
-				_ = st.UpdatePrinterAttributes(ctx, tx, printer.ID, nil, nil, geo, org, orgUnit)
-			}
-		}
-		for _, c := range classes {
-			memberIDs := make([]int64, 0, len(c.members))
-			for _, m := range c.members {
-				if printer, err := st.GetPrinterByName(ctx, tx, m); err == nil {
-					memberIDs = append(memberIDs, printer.ID)
-				}
-			}
-			_, _ = st.UpsertClass(ctx, tx, c.name, c.location, c.info, true, memberIDs)
+func (q queueConf) options() map[string]string {
+	out := map[string]string{}
+	for k, v := range q.fields {
+		if name, ok := strings.CutPrefix(k, "Option "); ok {
+			out[name] = v
+		} else if opt, ok := policyOptionKeys[k]; ok && v != "" {
+			out[opt] = v
 		}
-		return nil
-	})
+	}
+	return out
 }
 
-func SyncToConf(ctx context.Context, confDir string, st *store.Store) error {
-	if confDir == "" || st == nil {
-		return nil
+func (q queueConf) equal(o queueConf) bool {
+	if len(q.fields) != len(o.fields) {
+		return false
 	}
-	_ = os.MkdirAll(confDir, 0755)
-	return st.WithTx(ctx, true, func(tx *sql.Tx) error {
-		printers, err := st.ListPrinters(ctx, tx)
-		if err != nil {
-			return err
+	for k, v := range q.fields {
+		if ov, ok := o.fields[k]; !ok || ov != v {
+			return false
 		}
-		classes, err := st.ListClasses(ctx, tx)
-		if err != nil {
-			return err
-		}
-		if err := writePrintersConf(filepath.Join(confDir, "printers.conf"), printers); err != nil {
-			return err
+	}
+	return true
+}
+
+func setQueueOptions(q *queueConf, optionsJSON string) {
+	if strings.TrimSpace(optionsJSON) == "" {
+		return
+	}
+	var opts map[string]string
+	if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+		return
+	}
+	for k, v := range opts {
+		key := "Option " + k
+		for directive, opt := range policyOptionKeys {
+			if opt == k {
+				key = directive
+			}
 		}
-		if err := writeClassesConf(filepath.Join(confDir, "classes.conf"), classes, st, tx); err != nil {
-			return err
+		q.fields[key] = v
+	}
+}
+
+func confState(state int) string {
+	if state == 5 {
+		return "Stopped"
+	}
+	return "Idle"
+}
+
+func confYesNo(v bool) string {
+	if v {
+		return "Yes"
+	}
+	return "No"
+}
+
+// confJobSheets turns the stored "start,end" (or a single banner) into the
+// two-word printers.conf form.
+func confJobSheets(value string) string {
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	for len(parts) < 2 {
+		parts = append(parts, "none")
+	}
+	return parts[0] + " " + parts[1]
+}
+
+func printerQueueConf(p model.Printer) queueConf {
+	q := newQueueConf(p.Name, false)
+	q.fields["Default"] = confYesNo(p.IsDefault)
+	q.fields["State"] = confState(p.State)
+	q.fields["Accepting"] = confYesNo(p.Accepting)
+	q.fields["Shared"] = confYesNo(p.Shared)
+	q.fields["JobSheets"] = confJobSheets(p.JobSheetsDefault)
+	for k, v := range map[string]string{
+		"Info": p.Info, "Location": p.Location, "DeviceURI": p.URI, "GeoLocation": p.Geo,
+		"Organization": p.Org, "OrganizationalUnit": p.OrgUnit,
+	} {
+		if v != "" {
+			q.fields[k] = v
 		}
-		return nil
-	})
+	}
+	setQueueOptions(&q, p.DefaultOptions)
+	return q
 }
 
-func parsePrintersConf(path string) ([]legacyPrinter, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+func classQueueConf(c model.Class, members []model.Printer) queueConf {
+	q := newQueueConf(c.Name, true)
+	q.fields["Default"] = confYesNo(c.IsDefault)
+	q.fields["State"] = confState(c.State)
+	q.fields["Accepting"] = confYesNo(c.Accepting)
+	q.fields["JobSheets"] = confJobSheets(c.JobSheetsDefault)
+	if c.Info != "" {
+		q.fields["Info"] = c.Info
 	}
-	defer f.Close()
+	if c.Location != "" {
+		q.fields["Location"] = c.Location
+	}
+	names := make([]string, 0, len(members))
+	for _, m := range members {
+		names = append(names, m.Name)
+	}
+	q.fields["Member"] = strings.Join(names, "\n")
+	setQueueOptions(&q, c.DefaultOptions)
+	return q
+}
 
-	var out []legacyPrinter
-	var cur *legacyPrinter
-	sc := bufio.NewScanner(f)
+// queueConfBlock is one <Printer> or <Class> block as scanned from
+// printers.conf or classes.conf.
+type queueConfBlock struct {
+	line       int
+	name       string
+	isDefault  bool
+	directives [][2]string
+}
+
+// scanQueueConf reads the <kind name> and <Defaultkind name> blocks of
+// printers.conf or classes.conf, reporting structural problems and unknown
+// directives.
+func scanQueueConf(r io.Reader, path, kind string, rep *ValidationReport) ([]queueConfBlock, error) {
+	var out []queueConfBlock
+	var cur *queueConfBlock
+	seen := map[string]int{}
+	skipUntil := ""
+	lineNo := 0
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
 	for sc.Scan() {
+		lineNo++
 		line := strings.TrimSpace(sc.Text())
-		if strings.HasPrefix(line, "<Printer ") {
-			name := strings.TrimSuffix(strings.TrimPrefix(line, "<Printer "), ">")
-			cur = &legacyPrinter{name: name}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if skipUntil != "" {
+			if strings.EqualFold(line, skipUntil) {
+				skipUntil = ""
+			}
 			continue
 		}
-		if line == "</Printer>" {
+		if strings.HasPrefix(line, "<") && !strings.HasPrefix(line, "</") {
+			tag, rest, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(line, "<"), ">"), " ")
+			if tag != kind && tag != "Default"+kind {
+				rep.warnf(path, lineNo, "<%s> blocks are not supported and are ignored", tag)
+				skipUntil = "</" + tag + ">"
+				continue
+			}
+			name := strings.TrimSpace(rest)
 			if cur != nil {
-				out = append(out, *cur)
+				rep.errorf(path, lineNo, "<%s> inside <%s %s>", tag, kind, cur.name)
 			}
-			cur = nil
+			if name == "" {
+				rep.errorf(path, lineNo, "<%s> needs a name", tag)
+			} else if prev, dup := seen[strings.ToLower(name)]; dup {
+				rep.errorf(path, lineNo, "%s %q is already defined at line %d", strings.ToLower(kind), name, prev)
+			} else {
+				seen[strings.ToLower(name)] = lineNo
+			}
+			cur = &queueConfBlock{line: lineNo, name: name, isDefault: tag != kind}
 			continue
 		}
-		if cur == nil || line == "" || strings.HasPrefix(line, "#") {
+		if line == "</"+kind+">" || line == "</Default"+kind+">" {
+			if cur == nil {
+				rep.errorf(path, lineNo, "%s without an opening tag", line)
+			} else {
+				out = append(out, *cur)
+			}
+			cur = nil
 			continue
 		}
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) != 2 {
+		if cur == nil {
+			// cupsd writes its next queue ID at the top of printers.conf.
+			if !strings.HasPrefix(line, "NextPrinterId ") {
+				rep.errorf(path, lineNo, "%s outside a <%s> block", strings.Fields(line)[0], kind)
+			}
 			continue
 		}
-		switch parts[0] {
-		case "Info":
-			cur.info = parts[1]
-		case "Location":
-			cur.location = parts[1]
-		case "DeviceURI":
-			cur.deviceURI = parts[1]
-		case "GeoLocation":
-			cur.geo = parts[1]
-		case "Organization":
-			cur.org = parts[1]
-		case "OrganizationalUnit":
-			cur.orgUnit = parts[1]
+		key, value, _ := strings.Cut(line, " ")
+		if !queueConfKeys[key] {
+			rep.warnf(path, lineNo, "unknown directive %s", key)
 		}
+		cur.directives = append(cur.directives, [2]string{key, strings.TrimSpace(value)})
+	}
+	if cur != nil {
+		rep.errorf(path, cur.line, "<%s %s> is never closed", kind, cur.name)
 	}
 	return out, sc.Err()
 }
 
-func parseClassesConf(path string) ([]legacyClass, error) {
+// parseQueueConf reads printers.conf (class false) or classes.conf.
+func parseQueueConf(r io.Reader, path string, class bool, rep *ValidationReport) ([]queueConf, error) {
+	kind, textKeys := "Printer", printerTextKeys
+	if class {
+		kind, textKeys = "Class", classTextKeys
+	}
+	blocks, err := scanQueueConf(r, path, kind, rep)
+	out := make([]queueConf, 0, len(blocks))
+	for _, b := range blocks {
+		q := newQueueConf(b.name, class)
+		q.line = b.line
+		q.fields["Default"] = confYesNo(b.isDefault)
+		q.stated = map[string]bool{"Default": b.isDefault}
+		var members []string
+		for _, d := range b.directives {
+			key, value := d[0], d[1]
+			if key == "Option" {
+				q.stated["Option"] = true
+			} else {
+				q.stated[key] = true
+			}
+			switch {
+			case key == "Member" && class:
+				members = append(members, value)
+			case key == "Option":
+				name, v, _ := strings.Cut(value, " ")
+				if name = strings.TrimSpace(name); name != "" {
+					q.fields["Option "+name] = strings.TrimSpace(v)
+				}
+			case key == "State":
+				q.fields["State"] = "Idle"
+				if strings.EqualFold(value, "stopped") || value == "5" {
+					q.fields["State"] = "Stopped"
+				}
+			case key == "Accepting" || (key == "Shared" && !class):
+				if v, ok := parseBool(value); ok {
+					q.fields[key] = confYesNo(v)
+				}
+			case key == "JobSheets":
+				q.fields["JobSheets"] = confJobSheets(value)
+			case containsString(textKeys, key):
+				if value != "" {
+					q.fields[key] = value
+				}
+			default:
+				q.extra = append(q.extra, strings.TrimSpace(key+" "+value))
+			}
+		}
+		if class {
+			q.fields["Member"] = strings.Join(members, "\n")
+		} else if q.fields["DeviceURI"] == "" {
+			rep.warnf(path, b.line, "printer %q has no DeviceURI", b.name)
+		}
+		out = append(out, q)
+	}
+	return out, err
+}
+
+func parseQueueConfFile(path string, class bool, rep *ValidationReport) ([]queueConf, error) {
 	f, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
 	defer f.Close()
+	return parseQueueConf(f, path, class, rep)
+}
 
-	var out []legacyClass
-	var cur *legacyClass
-	sc := bufio.NewScanner(f)
-	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
-		if strings.HasPrefix(line, "<Class ") {
-			name := strings.TrimSuffix(strings.TrimPrefix(line, "<Class "), ">")
-			cur = &legacyClass{name: name}
-			continue
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
 		}
-		if line == "</Class>" {
-			if cur != nil {
-				out = append(out, *cur)
+	}
+	return false
+}
+
+// renderQueueConf produces a printers.conf or classes.conf with the header
+// cupsd writes. Queues are written in name order.
+func renderQueueConf(queues []queueConf, class bool) []byte {
+	kind, what, textKeys := "Printer", "Printer", printerTextKeys
+	if class {
+		kind, what, textKeys = "Class", "Class", classTextKeys
+	}
+	sorted := append([]queueConf(nil), queues...)
+	sort.Slice(sorted, func(i, j int) bool { return strings.ToLower(sorted[i].name) < strings.ToLower(sorted[j].name) })
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "# %s configuration file for CUPS-Golang\n", what)
+	fmt.Fprintf(&b, "# Written by cupsgolang on %s\n", time.Now().Format("2006-01-02 15:04"))
+	b.WriteString("# Edits made while the server runs are picked up automatically.\n")
+	for _, q := range sorted {
+		tag := kind
+		if q.fields["Default"] == "Yes" {
+			tag = "Default" + kind
+		}
+		fmt.Fprintf(&b, "<%s %s>\n", tag, q.name)
+		for _, key := range textKeys {
+			if v := q.fields[key]; v != "" {
+				fmt.Fprintf(&b, "%s %s\n", key, v)
 			}
-			cur = nil
-			continue
 		}
-		if cur == nil || line == "" || strings.HasPrefix(line, "#") {
-			continue
+		fmt.Fprintf(&b, "State %s\n", q.fields["State"])
+		fmt.Fprintf(&b, "Accepting %s\n", q.fields["Accepting"])
+		if !class {
+			fmt.Fprintf(&b, "Shared %s\n", q.fields["Shared"])
 		}
-		parts := strings.SplitN(line, " ", 2)
-		if len(parts) != 2 {
-			continue
+		fmt.Fprintf(&b, "JobSheets %s\n", q.fields["JobSheets"])
+		for _, m := range q.members() {
+			fmt.Fprintf(&b, "Member %s\n", m)
+		}
+		var opts []string
+		for k := range q.fields {
+			if strings.HasPrefix(k, "Option ") {
+				opts = append(opts, k)
+			}
+		}
+		sort.Strings(opts)
+		for _, k := range opts {
+			fmt.Fprintf(&b, "%s %s\n", k, q.fields[k])
 		}
-		switch parts[0] {
-		case "Info":
-			cur.info = parts[1]
-		case "Location":
-			cur.location = parts[1]
-		case "Member":
-			cur.members = append(cur.members, parts[1])
+		for _, line := range q.extra {
+			b.WriteString(line + "\n")
 		}
+		fmt.Fprintf(&b, "</%s>\n", tag)
 	}
-	return out, sc.Err()
+	return b.Bytes()
 }
 
-func writePrintersConf(path string, printers []model.Printer) error {
-	f, err := os.Create(path)
-	if err != nil {
-		return err
+// writeFileAtomic replaces path with data through fsutil.WriteFile, keeping
+// the mode of the file it replaces.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(path); err == nil {
+		mode = fi.Mode().Perm()
 	}
-	defer f.Close()
-	w := bufio.NewWriter(f)
-	defer w.Flush()
+	return fsutil.WriteFile(path, data, mode)
+}
 
-	for _, p := range printers {
-		// Temporary queues are not persisted to printers.conf in CUPS.
-		if p.IsTemporary {
-			continue
+// loadQueueConfs returns the store's printers (class false) or classes in
+// their printers.conf/classes.conf form, keyed by lower-case name.
+// Temporary queues are not persisted, as in CUPS.
+func loadQueueConfs(ctx context.Context, st store.Repository, tx store.Tx, class bool) (map[string]queueConf, error) {
+	out := map[string]queueConf{}
+	if !class {
+		printers, err := st.ListPrinters(ctx, tx)
+		if err != nil {
+			return nil, err
 		}
-		_, _ = w.WriteString("<Printer " + p.Name + ">\n")
-		if p.Info != "" {
-			_, _ = w.WriteString("Info " + p.Info + "\n")
+		for _, p := range printers {
+			if !p.IsTemporary {
+				out[strings.ToLower(p.Name)] = printerQueueConf(p)
+			}
 		}
-		if p.Location != "" {
-			_, _ = w.WriteString("Location " + p.Location + "\n")
+		return out, nil
+	}
+	classes, err := st.ListClasses(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range classes {
+		members, err := st.ListClassMembers(ctx, tx, c.ID)
+		if err != nil {
+			return nil, err
 		}
-		if p.URI != "" {
-			_, _ = w.WriteString("DeviceURI " + p.URI + "\n")
+		out[strings.ToLower(c.Name)] = classQueueConf(c, members)
+	}
+	return out, nil
+}
+
+// SyncFromConf imports printers.conf and classes.conf at startup. The files
+// win for every setting they state; settings a file leaves out (older
+// cupsgolang versions did not write Shared or Option lines) and queues only
+// in the store are kept.
+func SyncFromConf(ctx context.Context, confDir string, st store.Repository) error {
+	if confDir == "" || st == nil {
+		return nil
+	}
+	_ = os.MkdirAll(confDir, 0755)
+	for _, class := range []bool{false, true} {
+		queues, _ := parseQueueConfFile(filepath.Join(confDir, queueConfName(class)), class, nil)
+		err := st.WithTx(ctx, false, func(tx store.Tx) error {
+			current, err := loadQueueConfs(ctx, st, tx, class)
+			if err != nil {
+				return err
+			}
+			for _, q := range queues {
+				cur, ok := current[strings.ToLower(q.name)]
+				var curp *queueConf
+				if ok {
+					curp = &cur
+					q = overlayStated(cur, q)
+				}
+				if err := applyQueueConf(ctx, st, tx, q, curp, class); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SyncToConf rewrites printers.conf and classes.conf from the store.
+func SyncToConf(ctx context.Context, confDir string, st store.Repository) error {
+	if confDir == "" || st == nil {
+		return nil
+	}
+	_ = os.MkdirAll(confDir, 0755)
+	return st.WithTx(ctx, true, func(tx store.Tx) error {
+		for _, class := range []bool{false, true} {
+			queues, err := loadQueueConfs(ctx, st, tx, class)
+			if err != nil {
+				return err
+			}
+			if err := writeFileAtomic(filepath.Join(confDir, queueConfName(class)), renderQueueConf(queueList(queues), class)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// overlayStated returns cur with the settings q's file states. Options are
+// taken as a whole when the file has any Option line.
+func overlayStated(cur, q queueConf) queueConf {
+	out := queueConf{name: q.name, fields: map[string]string{}, extra: q.extra}
+	for k, v := range cur.fields {
+		if !(q.stated["Option"] && strings.HasPrefix(k, "Option ")) {
+			out.fields[k] = v
 		}
-		if p.Geo != "" {
-			_, _ = w.WriteString("GeoLocation " + p.Geo + "\n")
+	}
+	for k, v := range q.fields {
+		name := k
+		if strings.HasPrefix(k, "Option ") {
+			name = "Option"
 		}
-		if p.Org != "" {
-			_, _ = w.WriteString("Organization " + p.Org + "\n")
+		if q.stated[name] {
+			out.fields[k] = v
 		}
-		if p.OrgUnit != "" {
-			_, _ = w.WriteString("OrganizationalUnit " + p.OrgUnit + "\n")
+	}
+	for k := range cur.fields {
+		if q.stated[k] {
+			if _, ok := q.fields[k]; !ok {
+				delete(out.fields, k)
+			}
 		}
-		_, _ = w.WriteString("State " + strconv.Itoa(p.State) + "\n")
-		_, _ = w.WriteString("</Printer>\n")
 	}
-	return nil
+	return out
 }
 
-func writeClassesConf(path string, classes []model.Class, st *store.Store, tx *sql.Tx) error {
-	f, err := os.Create(path)
-	if err != nil {
-		return err
+func queueConfName(class bool) string {
+	if class {
+		return "classes.conf"
 	}
-	defer f.Close()
-	w := bufio.NewWriter(f)
-	defer w.Flush()
+	return "printers.conf"
+}
 
-	for _, c := range classes {
-		_, _ = w.WriteString("<Class " + c.Name + ">\n")
-		if c.Info != "" {
-			_, _ = w.WriteString("Info " + c.Info + "\n")
+func queueList(m map[string]queueConf) []queueConf {
+	out := make([]queueConf, 0, len(m))
+	for _, q := range m {
+		out = append(out, q)
+	}
+	return out
+}
+
+// applyQueueConf makes the store match q. cur is the store's current view
+// of the queue, nil when it does not exist yet; only differing settings are
+// written.
+func applyQueueConf(ctx context.Context, st store.Repository, tx store.Tx, q queueConf, cur *queueConf, class bool) error {
+	changed := func(key string) bool {
+		return cur == nil || cur.fields[key] != q.fields[key]
+	}
+	optionsChanged := cur == nil && len(q.options()) > 0
+	if cur != nil {
+		a, _ := json.Marshal(cur.options())
+		b, _ := json.Marshal(q.options())
+		optionsChanged = string(a) != string(b)
+	}
+	optionsJSON := ""
+	if opts := q.options(); len(opts) > 0 {
+		raw, _ := json.Marshal(opts)
+		optionsJSON = string(raw)
+	}
+	state := 3
+	if q.fields["State"] == "Stopped" {
+		state = 5
+	}
+	sheets := strings.Replace(q.fields["JobSheets"], " ", ",", 1)
+	accepting := q.fields["Accepting"] == "Yes"
+	isDefault := q.fields["Default"] == "Yes"
+
+	if class {
+		var memberIDs []int64
+		for _, m := range q.members() {
+			p, err := st.GetPrinterByName(ctx, tx, m)
+			if err != nil {
+				logQueueConf("Class member is not a printer; skipped", "class", q.name, "member", m)
+				continue
+			}
+			memberIDs = append(memberIDs, p.ID)
+		}
+		var id int64
+		if cur == nil {
+			c, err := st.CreateClass(ctx, tx, q.name, q.fields["Location"], q.fields["Info"], accepting, false, memberIDs)
+			if err != nil {
+				return err
+			}
+			id = c.ID
+		} else {
+			c, err := st.GetClassByName(ctx, tx, q.name)
+			if err != nil {
+				return err
+			}
+			id = c.ID
+			if changed("Info") || changed("Location") {
+				info, location := q.fields["Info"], q.fields["Location"]
+				if err := st.UpdateClassAttributes(ctx, tx, id, &info, &location); err != nil {
+					return err
+				}
+			}
+			if changed("Accepting") {
+				if err := st.UpdateClassAccepting(ctx, tx, id, accepting); err != nil {
+					return err
+				}
+			}
+			if changed("Member") {
+				if err := st.ReplaceClassMembers(ctx, tx, id, memberIDs); err != nil {
+					return err
+				}
+			}
 		}
-		if c.Location != "" {
-			_, _ = w.WriteString("Location " + c.Location + "\n")
+		if changed("Default") && isDefault {
+			if err := st.SetDefaultClass(ctx, tx, id); err != nil {
+				return err
+			}
 		}
-		members, _ := st.ListClassMembers(context.Background(), tx, c.ID)
-		for _, m := range members {
-			_, _ = w.WriteString("Member " + m.Name + "\n")
+		if changed("State") {
+			if err := st.UpdateClassState(ctx, tx, id, state); err != nil {
+				return err
+			}
 		}
-		_, _ = w.WriteString("</Class>\n")
+		if changed("JobSheets") {
+			if err := st.UpdateClassJobSheetsDefault(ctx, tx, id, sheets); err != nil {
+				return err
+			}
+		}
+		if optionsChanged {
+			return st.UpdateClassDefaultOptions(ctx, tx, id, optionsJSON)
+		}
+		return nil
 	}
-	return nil
-}
 
-func SyncLoop(ctx context.Context, confDir string, st *store.Store) {
-	ticker := time.NewTicker(15 * time.Second)
-	go func() {
-		defer ticker.Stop()
-		for {
-			select {
-			case <-ctx.Done():
-				return
-			case <-ticker.C:
-				_ = SyncToConf(ctx, confDir, st)
+	var id int64
+	if cur == nil {
+		uri := q.fields["DeviceURI"]
+		if uri == "" {
+			uri = "file:///dev/null"
+		}
+		p, err := st.CreatePrinter(ctx, tx, q.name, uri, q.fields["Location"], q.fields["Info"], "", accepting, false, q.fields["Shared"] == "Yes", sheets, optionsJSON)
+		if err != nil {
+			return err
+		}
+		id = p.ID
+		optionsChanged = false
+	} else {
+		p, err := st.GetPrinterByName(ctx, tx, q.name)
+		if err != nil {
+			return err
+		}
+		id = p.ID
+		if changed("DeviceURI") && q.fields["DeviceURI"] != "" {
+			if err := st.UpdatePrinterURI(ctx, tx, id, q.fields["DeviceURI"]); err != nil {
+				return err
 			}
 		}
-	}()
+		if changed("Accepting") {
+			if err := st.UpdatePrinterAccepting(ctx, tx, id, accepting); err != nil {
+				return err
+			}
+		}
+		if changed("Shared") {
+			if err := st.UpdatePrinterSharing(ctx, tx, id, q.fields["Shared"] == "Yes"); err != nil {
+				return err
+			}
+		}
+		if changed("JobSheets") {
+			if err := st.UpdatePrinterJobSheetsDefault(ctx, tx, id, sheets); err != nil {
+				return err
+			}
+		}
+	}
+	// A new printer already has its Info and Location.
+	var attrs [5]*string
+	for i, key := range []string{"Info", "Location", "GeoLocation", "Organization", "OrganizationalUnit"} {
+		v := q.fields[key]
+		if (cur != nil && changed(key)) || (cur == nil && i >= 2 && v != "") {
+			attrs[i] = &v
+		}
+	}
+	if attrs != [5]*string{} {
+		if err := st.UpdatePrinterAttributes(ctx, tx, id, attrs[0], attrs[1], attrs[2], attrs[3], attrs[4]); err != nil {
+			return err
+		}
+	}
+	if changed("State") && (cur != nil || state != 3) {
+		if err := st.UpdatePrinterState(ctx, tx, id, state); err != nil {
+			return err
+		}
+	}
+	if changed("Default") && isDefault {
+		if err := st.SetDefaultPrinter(ctx, tx, id); err != nil {
+			return err
+		}
+	}
+	if optionsChanged {
+		return st.UpdatePrinterDefaultOptions(ctx, tx, id, optionsJSON)
+	}
+	return nil
 }
@@ -36,14 +36,14 @@ func LoadMimeDB(confDir string) (*MimeDB, error) {
 	if err := ensureDefaultConf(confDir); err != nil {
 		return db, err
 	}
-	if err := db.readMimeTypes(filepath.Join(confDir, "mime.types")); err != nil {
+	if err := db.readMimeTypes(filepath.Join(confDir, "mime.types"), nil); err != nil {
 		return db, err
 	}
-	_ = db.readMimeTypes(filepath.Join(confDir, "local.types"))
-	if err := db.readMimeConvs(filepath.Join(confDir, "mime.convs")); err != nil {
+	_ = db.readMimeTypes(filepath.Join(confDir, "local.types"), nil)
+	if err := db.readMimeConvs(filepath.Join(confDir, "mime.convs"), nil); err != nil {
 		return db, err
 	}
-	_ = db.readMimeConvs(filepath.Join(confDir, "local.convs"))
+	_ = db.readMimeConvs(filepath.Join(confDir, "local.convs"), nil)
 	return db, nil
 }
 
@@ -82,7 +82,7 @@ func writeEmbedded(path string, dest string) error {
 	return err
 }
 
-func (db *MimeDB) readMimeTypes(path string) error {
+func (db *MimeDB) readMimeTypes(path string, rep *ValidationReport) error {
 	file, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -92,8 +92,10 @@ func (db *MimeDB) readMimeTypes(path string) error {
 	}
 	defer file.Close()
 	sc := bufio.NewScanner(file)
+	lineNo := 0
 	for sc.Scan() {
-		raw := sc.Text()
+		lineNo++
+		raw := strings.TrimPrefix(sc.Text(), "\ufeff")
 		// Skip continuation lines in CUPS mime.types (they begin with whitespace).
 		if len(raw) > 0 && (raw[0] == ' ' || raw[0] == '\t') {
 			continue
@@ -107,6 +109,9 @@ func (db *MimeDB) readMimeTypes(path string) error {
 			continue
 		}
 		mt := parts[0]
+		if slash := strings.Index(mt, "/"); slash <= 0 || slash == len(mt)-1 {
+			rep.errorf(path, lineNo, "invalid MIME type %q", mt)
+		}
 		exts := []string{}
 		for _, token := range parts[1:] {
 			if ext, ok := mimeExtToken(token); ok {
@@ -121,7 +126,7 @@ func (db *MimeDB) readMimeTypes(path string) error {
 	return sc.Err()
 }
 
-func (db *MimeDB) readMimeConvs(path string) error {
+func (db *MimeDB) readMimeConvs(path string, rep *ValidationReport) error {
 	file, err := os.Open(path)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -131,21 +136,37 @@ func (db *MimeDB) readMimeConvs(path string) error {
 	}
 	defer file.Close()
 	sc := bufio.NewScanner(file)
+	lineNo := 0
 	for sc.Scan() {
-		line := strings.TrimSpace(sc.Text())
+		lineNo++
+		line := strings.TrimSpace(strings.TrimPrefix(sc.Text(), "\ufeff"))
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 		// Ignore build-time placeholders from CUPS *.in templates.
 		if strings.HasPrefix(line, "@") {
+			rep.warnf(path, lineNo, "unexpanded placeholder ignored")
 			continue
 		}
 		parts := strings.Fields(line)
 		if len(parts) < 4 {
+			rep.errorf(path, lineNo, "expected \"source destination cost filter\"")
 			continue
 		}
 		cost := 0
-		fmt.Sscanf(parts[2], "%d", &cost)
+		if _, err := fmt.Sscanf(parts[2], "%d", &cost); err != nil {
+			rep.errorf(path, lineNo, "invalid cost %q", parts[2])
+		}
+		if rep != nil {
+			for _, mt := range parts[:2] {
+				if _, ok := db.Types[mt]; !ok && !strings.Contains(mt, "*") {
+					rep.warnf(path, lineNo, "MIME type %s is not defined in mime.types", mt)
+				}
+			}
+			if msg := missingFilter(strings.Join(parts[3:], " ")); msg != "" {
+				rep.warnf(path, lineNo, "%s", msg)
+			}
+		}
 		db.Convs = append(db.Convs, MimeConv{
 			Source:  parts[0],
 			Dest:    parts[1],
@@ -21,6 +21,10 @@ type LocationRule struct {
 	Allow         []string
 	Deny          []string
 	Limits        map[string]LimitRule
+	// LimitRequestBody overrides the server-wide request size limit for
+	// the location when HasLimitRequestBody is set; 0 means no limit.
+	LimitRequestBody    int64
+	HasLimitRequestBody bool
 }
 
 type Policy struct {
@@ -47,7 +51,47 @@ type LimitRule struct {
 }
 
 func LoadPolicy(confDir string) Policy {
-	path := filepath.Join(confDir, "cupsd.conf")
+	return loadPolicyFile(filepath.Join(confDir, "cupsd.conf"), nil)
+}
+
+// limitBlock records where a <Limit> started and the operations it names, so
+// Validate can report blocks whose operations are all redefined later in the
+// same <Location> or <Policy> (the last <Limit> naming an operation wins).
+type limitBlock struct {
+	line int
+	ops  []string
+}
+
+func reportShadowedLimits(rep *ValidationReport, path string, blocks []limitBlock) {
+	for i, b := range blocks {
+		shadowed := 0
+		for _, op := range b.ops {
+			for _, later := range blocks[i+1:] {
+				if containsOp(later.ops, op) {
+					rep.warnf(path, b.line, "operation %s is redefined by the <Limit> at line %d", op, later.line)
+					shadowed++
+					break
+				}
+			}
+		}
+		if shadowed > 0 && shadowed == len(b.ops) {
+			rep.warnf(path, b.line, "<Limit> is unreachable: all of its operations are redefined later")
+		}
+	}
+}
+
+func containsOp(ops []string, op string) bool {
+	for _, candidate := range ops {
+		for _, alias := range opAliases(candidate) {
+			if strings.EqualFold(alias, op) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func loadPolicyFile(path string, rep *ValidationReport) Policy {
 	f, err := os.Open(path)
 	if err != nil {
 		return Policy{}
@@ -65,8 +109,17 @@ func LoadPolicy(confDir string) Policy {
 	curPolicyName := ""
 	var curPolicyLimit *LimitRule
 
+	// Line numbers and <Limit> blocks of the open sections, for diagnostics.
+	lineNo, locLine, policyLine, limitLine := 0, 0, 0, 0
+	var scopeLimits []limitBlock
+	closeScope := func() {
+		reportShadowedLimits(rep, path, scopeLimits)
+		scopeLimits = nil
+	}
+
 	sc := bufio.NewScanner(f)
 	for sc.Scan() {
+		lineNo++
 		line := strings.TrimSpace(sc.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
@@ -75,6 +128,12 @@ func LoadPolicy(confDir string) Policy {
 
 		if strings.HasPrefix(lower, "<policy ") && strings.HasSuffix(lower, ">") {
 			name := strings.TrimSpace(line[len("<Policy ") : len(line)-1])
+			if inPolicy || curLoc != nil {
+				rep.errorf(path, lineNo, "<Policy> cannot be nested")
+			}
+			if name == "" {
+				rep.errorf(path, lineNo, "<Policy> needs a name")
+			}
 			if name != "" {
 				seen := false
 				for _, existing := range policy.Policies {
@@ -88,6 +147,7 @@ func LoadPolicy(confDir string) Policy {
 				}
 				inPolicy = true
 				curPolicyName = name
+				policyLine = lineNo
 				if policy.PolicyLimits[strings.ToLower(name)] == nil {
 					policy.PolicyLimits[strings.ToLower(name)] = map[string]LimitRule{}
 				}
@@ -95,6 +155,12 @@ func LoadPolicy(confDir string) Policy {
 			continue
 		}
 		if strings.EqualFold(line, "</Policy>") {
+			if !inPolicy {
+				rep.errorf(path, lineNo, "</Policy> without <Policy>")
+			} else if curPolicyLimit != nil {
+				rep.errorf(path, limitLine, "<Limit> is not closed before </Policy>")
+			}
+			closeScope()
 			inPolicy = false
 			curPolicyName = ""
 			curPolicyLimit = nil
@@ -103,10 +169,23 @@ func LoadPolicy(confDir string) Policy {
 
 		if strings.HasPrefix(lower, "<location ") && strings.HasSuffix(lower, ">") {
 			p := strings.TrimSpace(line[len("<Location ") : len(line)-1])
+			if inPolicy || curLoc != nil {
+				rep.errorf(path, lineNo, "<Location> cannot be nested")
+			}
+			if p == "" {
+				rep.errorf(path, lineNo, "<Location> needs a path")
+			}
 			curLoc = &LocationRule{Path: p, Limits: map[string]LimitRule{}}
+			locLine = lineNo
 			continue
 		}
 		if strings.EqualFold(line, "</Location>") {
+			if curLoc == nil {
+				rep.errorf(path, lineNo, "</Location> without <Location>")
+			} else if curLocLimit != nil {
+				rep.errorf(path, limitLine, "<Limit> is not closed before </Location>")
+			}
+			closeScope()
 			if curLoc != nil {
 				policy.Locations = append(policy.Locations, *curLoc)
 			}
@@ -118,6 +197,19 @@ func LoadPolicy(confDir string) Policy {
 		if strings.HasPrefix(lower, "<limit ") && strings.HasSuffix(lower, ">") && (curLoc != nil || inPolicy) {
 			args := strings.TrimSpace(line[len("<Limit ") : len(line)-1])
 			ops := strings.Fields(args)
+			if curPolicyLimit != nil || curLocLimit != nil {
+				rep.errorf(path, lineNo, "<Limit> cannot be nested")
+			}
+			if len(ops) == 0 {
+				rep.errorf(path, lineNo, "<Limit> names no operations")
+			}
+			for _, op := range ops {
+				if !knownOperation(op) {
+					rep.warnf(path, lineNo, "unknown operation %s", op)
+				}
+			}
+			limitLine = lineNo
+			scopeLimits = append(scopeLimits, limitBlock{line: lineNo, ops: ops})
 			if inPolicy {
 				curPolicyLimit = &LimitRule{Ops: ops}
 			} else if curLoc != nil {
@@ -148,6 +240,17 @@ func LoadPolicy(confDir string) Policy {
 				curLocLimit = nil
 				continue
 			}
+			rep.errorf(path, lineNo, "</Limit> without <Limit>")
+		}
+		if strings.HasPrefix(line, "<") {
+			switch {
+			case strings.HasPrefix(lower, "<limit"):
+				rep.errorf(path, lineNo, "<Limit> outside <Location> or <Policy> is ignored")
+			case strings.HasPrefix(lower, "<limitexcept"), strings.HasPrefix(lower, "</limitexcept"):
+				rep.warnf(path, lineNo, "<LimitExcept> is not supported; its directives apply to the enclosing block")
+			case !strings.HasPrefix(lower, "</"):
+				rep.warnf(path, lineNo, "unknown block %s", strings.Fields(line)[0])
+			}
 		}
 
 		parts := strings.Fields(line)
@@ -157,25 +260,101 @@ func LoadPolicy(confDir string) Policy {
 
 		// Apply settings to current limit (policy or location) or to current location.
 		if inPolicy && curPolicyLimit != nil {
+			checkAccessDirective(rep, path, lineNo, parts)
 			limitCopy := *curPolicyLimit
 			applyLimitDirective(&limitCopy, parts)
 			*curPolicyLimit = limitCopy
 			continue
 		}
 		if curLocLimit != nil {
+			checkAccessDirective(rep, path, lineNo, parts)
 			limitCopy := *curLocLimit
 			applyLimitDirective(&limitCopy, parts)
 			*curLocLimit = limitCopy
 			continue
 		}
 		if curLoc != nil {
+			checkAccessDirective(rep, path, lineNo, parts)
 			applyLocationDirective(curLoc, parts)
+			continue
+		}
+		if inPolicy && !strings.HasPrefix(line, "<") {
+			switch strings.ToLower(parts[0]) {
+			case "jobprivateaccess", "jobprivatevalues", "subscriptionprivateaccess", "subscriptionprivatevalues":
+				rep.warnf(path, lineNo, "%s is not supported and is ignored", parts[0])
+			default:
+				rep.warnf(path, lineNo, "%s outside <Limit> is ignored", parts[0])
+			}
 		}
 	}
 
+	if curLocLimit != nil || curPolicyLimit != nil {
+		rep.errorf(path, limitLine, "<Limit> is never closed")
+	}
+	if curLoc != nil {
+		rep.errorf(path, locLine, "<Location %s> is never closed", curLoc.Path)
+	}
+	if inPolicy {
+		rep.errorf(path, policyLine, "<Policy %s> is never closed", curPolicyName)
+	}
+	closeScope()
 	return policy
 }
 
+// checkAccessDirective reports directives inside <Location> and <Limit>
+// blocks that applyLocationDirective and applyLimitDirective would ignore.
+func checkAccessDirective(rep *ValidationReport, path string, lineNo int, parts []string) {
+	if rep == nil || strings.HasPrefix(parts[0], "<") {
+		return
+	}
+	switch strings.ToLower(parts[0]) {
+	case "authtype":
+		if len(parts) < 2 {
+			rep.errorf(path, lineNo, "AuthType: missing value")
+			return
+		}
+		switch strings.ToLower(parts[1]) {
+		case "none", "basic", "default", "digest", "negotiate", "local":
+		default:
+			rep.warnf(path, lineNo, "AuthType: unknown type %q", parts[1])
+		}
+	case "require":
+		if len(parts) < 2 {
+			rep.errorf(path, lineNo, "Require: missing value")
+			return
+		}
+		switch strings.ToLower(parts[1]) {
+		case "valid-user", "user", "group", "all":
+		default:
+			rep.errorf(path, lineNo, "Require: unknown requirement %q", parts[1])
+		}
+	case "order":
+		if len(parts) < 2 {
+			rep.errorf(path, lineNo, "Order: missing value")
+			return
+		}
+		switch strings.ToLower(parts[1]) {
+		case "allow,deny", "deny,allow":
+		default:
+			rep.errorf(path, lineNo, "Order: invalid value %q", parts[1])
+		}
+	case "allow", "deny":
+		if len(parts) < 3 || !strings.EqualFold(parts[1], "from") {
+			rep.errorf(path, lineNo, "%s: expected \"%s from <address>\"", parts[0], parts[0])
+		}
+	case "limitrequestbody":
+		if len(parts) < 2 {
+			rep.errorf(path, lineNo, "LimitRequestBody: missing value")
+		} else if _, ok := parseSize(parts[1]); !ok {
+			rep.errorf(path, lineNo, "LimitRequestBody: invalid size %q", parts[1])
+		}
+	case "satisfy", "encryption":
+		rep.warnf(path, lineNo, "%s is not supported and is ignored", parts[0])
+	default:
+		rep.warnf(path, lineNo, "unknown directive %s", parts[0])
+	}
+}
+
 // PolicyLimitFor returns a policy-defined <Limit> rule for a given policy name
 // and operation (e.g. "default"+"Print-Job"), if present.
 func (p Policy) PolicyLimitFor(policyName string, op string) *LimitRule {
@@ -265,6 +444,13 @@ func applyLocationDirective(target *LocationRule, parts []string) {
 		return
 	}
 	switch strings.ToLower(parts[0]) {
+	case "limitrequestbody":
+		if len(parts) > 1 {
+			if v, ok := parseSize(parts[1]); ok {
+				target.LimitRequestBody = v
+				target.HasLimitRequestBody = true
+			}
+		}
 	case "authtype":
 		if len(parts) > 1 {
 			target.AuthType = parts[1]
@@ -0,0 +1,299 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/model"
+)
+
+// Diagnostic is one problem found by Validate. Line is 0 when the problem
+// concerns the file as a whole.
+type Diagnostic struct {
+	File    string
+	Line    int
+	Error   bool
+	Message string
+}
+
+func (d Diagnostic) String() string {
+	severity := "warning"
+	if d.Error {
+		severity = "error"
+	}
+	if d.Line > 0 {
+		return fmt.Sprintf("%s:%d: %s: %s", d.File, d.Line, severity, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", d.File, severity, d.Message)
+}
+
+// ValidationReport collects the diagnostics of a configuration check. The
+// parsers take a *ValidationReport and report into it as they go; the normal
+// loaders pass nil, which discards everything.
+type ValidationReport struct {
+	Diagnostics []Diagnostic
+}
+
+func (r *ValidationReport) errorf(file string, line int, format string, args ...any) {
+	if r == nil {
+		return
+	}
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{File: file, Line: line, Error: true, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *ValidationReport) warnf(file string, line int, format string, args ...any) {
+	if r == nil {
+		return
+	}
+	r.Diagnostics = append(r.Diagnostics, Diagnostic{File: file, Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// Counts returns the number of errors and warnings.
+func (r *ValidationReport) Counts() (errors, warnings int) {
+	if r == nil {
+		return 0, 0
+	}
+	for _, d := range r.Diagnostics {
+		if d.Error {
+			errors++
+		} else {
+			warnings++
+		}
+	}
+	return errors, warnings
+}
+
+// HasErrors reports whether any diagnostic is an error.
+func (r *ValidationReport) HasErrors() bool {
+	errs, _ := r.Counts()
+	return errs > 0
+}
+
+// WriteText prints one diagnostic per line followed by a summary.
+func (r *ValidationReport) WriteText(w io.Writer, cupsdPath string) {
+	if r != nil {
+		for _, d := range r.Diagnostics {
+			fmt.Fprintln(w, d.String())
+		}
+	}
+	errs, warns := r.Counts()
+	if errs == 0 && warns == 0 {
+		fmt.Fprintf(w, "%s is OK\n", cupsdPath)
+		return
+	}
+	fmt.Fprintf(w, "%s: %d error(s), %d warning(s)\n", cupsdPath, errs, warns)
+}
+
+// Validate checks the configuration the server would load from cupsdPath:
+// cupsd.conf and its policy blocks, and cups-files.conf, mime.types,
+// mime.convs, printers.conf and classes.conf from the same directory. It also
+// checks every PPD in cfg.PPDDir and that the filters referenced by
+// mime.convs and the PPDs can be run. Nothing is written to disk.
+func Validate(cfg Config, cupsdPath string) *ValidationReport {
+	if cupsdPath == "" {
+		cupsdPath = filepath.Join(cfg.ConfDir, "cupsd.conf")
+	}
+	confDir := filepath.Dir(cupsdPath)
+	rep := &ValidationReport{}
+
+	// Parse into a scratch copy so cross-file checks see the file values.
+	scratch := cfg
+	scratch.ConfDir = confDir
+	scratch.sources, scratch.Unused = nil, nil
+	filesPath := filepath.Join(confDir, "cups-files.conf")
+	if _, err := os.Stat(filesPath); err == nil {
+		scanCupsFilesConf(filesPath, &scratch, nil, rep)
+	}
+
+	if _, err := os.Stat(cupsdPath); err != nil {
+		rep.errorf(cupsdPath, 0, "%v", err)
+	} else {
+		scanCupsdConf(cupsdPath, &scratch, nil, rep)
+		policy := loadPolicyFile(cupsdPath, rep)
+		if name := strings.TrimSpace(scratch.DefaultPolicy); name != "" {
+			if _, ok := policy.PolicyLimits[strings.ToLower(name)]; !ok {
+				rep.errorf(cupsdPath, 0, "DefaultPolicy %q has no <Policy> block", name)
+			}
+		}
+	}
+
+	validateMime(confDir, rep)
+	validateQueues(confDir, rep)
+
+	ppds, _ := filepath.Glob(filepath.Join(cfg.PPDDir, "*.ppd"))
+	sort.Strings(ppds)
+	for _, path := range ppds {
+		validatePPD(path, rep)
+	}
+
+	// Some checks run when a block closes; present each file in line order.
+	fileOrder := map[string]int{}
+	for _, d := range rep.Diagnostics {
+		if _, ok := fileOrder[d.File]; !ok {
+			fileOrder[d.File] = len(fileOrder)
+		}
+	}
+	sort.SliceStable(rep.Diagnostics, func(i, j int) bool {
+		a, b := rep.Diagnostics[i], rep.Diagnostics[j]
+		if a.File != b.File {
+			return fileOrder[a.File] < fileOrder[b.File]
+		}
+		return a.Line < b.Line
+	})
+	return rep
+}
+
+func validateMime(confDir string, rep *ValidationReport) {
+	db := &MimeDB{Types: map[string]MimeType{}, ExtToType: map[string]string{}}
+	for _, name := range []string{"mime.types", "mime.convs"} {
+		if _, err := os.Stat(filepath.Join(confDir, name)); os.IsNotExist(err) {
+			rep.warnf(filepath.Join(confDir, name), 0, "not found; the built-in default will be installed on start")
+		}
+	}
+	for _, name := range []string{"mime.types", "local.types"} {
+		path := filepath.Join(confDir, name)
+		if err := db.readMimeTypes(path, rep); err != nil {
+			rep.errorf(path, 0, "%v", err)
+		}
+	}
+	for _, name := range []string{"mime.convs", "local.convs"} {
+		path := filepath.Join(confDir, name)
+		if err := db.readMimeConvs(path, rep); err != nil {
+			rep.errorf(path, 0, "%v", err)
+		}
+	}
+}
+
+func validateQueues(confDir string, rep *ValidationReport) {
+	printersPath := filepath.Join(confDir, "printers.conf")
+	printers, err := parseQueueConfFile(printersPath, false, rep)
+	if err != nil && !os.IsNotExist(err) {
+		rep.errorf(printersPath, 0, "%v", err)
+	}
+	names := map[string]bool{}
+	for _, p := range printers {
+		names[strings.ToLower(p.name)] = true
+	}
+
+	classesPath := filepath.Join(confDir, "classes.conf")
+	classes, err := parseQueueConfFile(classesPath, true, rep)
+	if err != nil && !os.IsNotExist(err) {
+		rep.errorf(classesPath, 0, "%v", err)
+	}
+	for _, c := range classes {
+		if names[strings.ToLower(c.name)] {
+			rep.errorf(classesPath, c.line, "class %q has the same name as a printer", c.name)
+		}
+		for _, m := range c.members() {
+			if !names[strings.ToLower(m)] {
+				rep.warnf(classesPath, c.line, "class %q member %q is not defined in printers.conf", c.name, m)
+			}
+		}
+	}
+}
+
+// validatePPD reports what LoadPPD would silently skip: a missing header,
+// malformed *cupsFilter lines, filters that cannot be found and unbalanced
+// *OpenUI/*CloseUI pairs.
+func validatePPD(path string, rep *ValidationReport) {
+	if _, err := LoadPPD(path); err != nil {
+		rep.errorf(path, 0, "%v", err)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		rep.errorf(path, 0, "%v", err)
+		return
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	lineNo := 0
+	seenHeader := false
+	openUI, openUILine := "", 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if lineNo == 1 {
+			line = strings.TrimPrefix(line, "\ufeff")
+		}
+		if line == "" {
+			continue
+		}
+		if !seenHeader {
+			seenHeader = true
+			if !strings.HasPrefix(line, "*PPD-Adobe:") {
+				rep.errorf(path, lineNo, "missing *PPD-Adobe header")
+			}
+		}
+		switch {
+		case strings.HasPrefix(line, "*cupsFilter:"), strings.HasPrefix(line, "*cupsFilter2:"):
+			filter, ok := parsePPDFilterLine(line, strings.HasPrefix(line, "*cupsFilter2:"))
+			if !ok {
+				rep.errorf(path, lineNo, "malformed %s", strings.SplitN(line, ":", 2)[0])
+				continue
+			}
+			if msg := missingFilter(filter.Program); msg != "" {
+				rep.errorf(path, lineNo, "%s", msg)
+			}
+		case strings.HasPrefix(line, "*OpenUI"):
+			if openUI != "" {
+				rep.errorf(path, lineNo, "*OpenUI inside %s opened at line %d", openUI, openUILine)
+			}
+			openUI, openUILine = strings.TrimSpace(strings.SplitN(strings.TrimPrefix(line, "*OpenUI"), ":", 2)[0]), lineNo
+		case strings.HasPrefix(line, "*CloseUI"):
+			if openUI == "" {
+				rep.errorf(path, lineNo, "*CloseUI without *OpenUI")
+			}
+			openUI = ""
+		}
+	}
+	if err := sc.Err(); err != nil {
+		rep.errorf(path, lineNo, "%v", err)
+	}
+	if openUI != "" {
+		rep.errorf(path, openUILine, "%s is never closed", openUI)
+	}
+}
+
+// missingFilter returns a message when program, as the scheduler would run
+// it, cannot be found. "-" is the pass-through filter.
+func missingFilter(program string) string {
+	parts := strings.Fields(program)
+	if len(parts) == 0 || parts[0] == "-" {
+		return ""
+	}
+	if _, err := exec.LookPath(parts[0]); err != nil {
+		return fmt.Sprintf("filter %q not found", parts[0])
+	}
+	return ""
+}
+
+// ippOperationNames holds every operation name a <Limit> block may list.
+var ippOperationNames = sync.OnceValue(func() map[string]bool {
+	names := map[string]bool{"all": true, "cups-golang-backup": true}
+	for op := goipp.Op(0); op < goipp.Op(model.OpBackupServer); op++ {
+		if name := op.String(); !strings.HasPrefix(name, "0x") {
+			names[strings.ToLower(name)] = true
+		}
+	}
+	return names
+})
+
+func knownOperation(op string) bool {
+	for _, alias := range opAliases(op) {
+		if ippOperationNames()[strings.ToLower(alias)] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,132 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+}
+
+func TestValidateReportsLineNumberedProblems(t *testing.T) {
+	dir := t.TempDir()
+	writeConfFiles(t, dir, map[string]string{
+		"cupsd.conf": strings.Join([]string{
+			`Listen localhost:631`,
+			`WebInterface maybe`,
+			`FooBar 1`,
+			`<Policy default>`,
+			`  <Limit Print-Job>`,
+			`    Order deny,allow`,
+			`  </Limit>`,
+			`  <Limit Print-Job Bogus-Op>`,
+			`    Allow all`,
+			`  </Limit>`,
+			`</Policy>`,
+			`<Location /admin>`,
+			"",
+		}, "\n"),
+		"mime.types":    "application/pdf pdf\n",
+		"mime.convs":    "application/pdf application/vnd.cups-pdf 66\n",
+		"printers.conf": "<Printer A>\nDeviceURI ipp://a/ipp/print\n</Printer>\n",
+		"classes.conf":  "<Class All>\nMember B\n</Class>\n",
+		"bad.ppd":       "*PPD-Adobe: \"4.3\"\n*cupsFilter: \"application/vnd.cups-raster 0 no-such-filter-cupsgolang\"\n",
+	})
+
+	rep := Validate(Config{ConfDir: dir, PPDDir: dir}, filepath.Join(dir, "cupsd.conf"))
+	var got []string
+	for _, d := range rep.Diagnostics {
+		got = append(got, strings.TrimPrefix(d.String(), dir+string(filepath.Separator)))
+	}
+	text := strings.Join(got, "\n")
+	for _, want := range []string{
+		`cupsd.conf:2: error: WebInterface: invalid boolean "maybe"`,
+		`cupsd.conf:3: warning: unknown directive FooBar`,
+		`cupsd.conf:5: warning: <Limit> is unreachable`,
+		`cupsd.conf:8: warning: unknown operation Bogus-Op`,
+		`cupsd.conf:9: error: Allow: expected "Allow from <address>"`,
+		`cupsd.conf:12: error: <Location /admin> is never closed`,
+		`mime.convs:1: error: expected "source destination cost filter"`,
+		`classes.conf:1: warning: class "All" member "B" is not defined in printers.conf`,
+		`bad.ppd:2: error: filter "no-such-filter-cupsgolang" not found`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+	if !rep.HasErrors() {
+		t.Fatalf("HasErrors = false")
+	}
+}
+
+func TestValidateCleanConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeConfFiles(t, dir, map[string]string{
+		"cupsd.conf": strings.Join([]string{
+			`Listen localhost:631`,
+			`DefaultPolicy default`,
+			`<Location />`,
+			`  Order allow,deny`,
+			`  Allow from all`,
+			`</Location>`,
+			`<Policy default>`,
+			`  <Limit All>`,
+			`    Order deny,allow`,
+			`  </Limit>`,
+			`</Policy>`,
+			"",
+		}, "\n"),
+		"cups-files.conf": "ErrorLog stderr\n",
+		"mime.types":      "application/pdf pdf\napplication/vnd.cups-raw\n",
+		"mime.convs":      "application/pdf application/vnd.cups-raw 0 -\n",
+	})
+
+	rep := Validate(Config{ConfDir: dir, PPDDir: dir}, "")
+	if len(rep.Diagnostics) != 0 {
+		t.Fatalf("diagnostics = %v", rep.Diagnostics)
+	}
+}
+
+func TestValidateConnectionAndJobDirectives(t *testing.T) {
+	dir := t.TempDir()
+	writeConfFiles(t, dir, map[string]string{
+		"cupsd.conf": strings.Join([]string{
+			`MaxClients 0`,
+			`ServerTokens Everything`,
+			`SSLOptions AllowDH Bogus`,
+			`ServerAdmin root@example.com`,
+			`<Location /upload>`,
+			`  LimitRequestBody lots`,
+			`</Location>`,
+			"",
+		}, "\n"),
+		"cups-files.conf": "LogFilePerm rw\n",
+	})
+
+	rep := Validate(Config{ConfDir: dir, PPDDir: dir}, "")
+	var got []string
+	for _, d := range rep.Diagnostics {
+		got = append(got, strings.TrimPrefix(d.String(), dir+string(filepath.Separator)))
+	}
+	text := strings.Join(got, "\n")
+	for _, want := range []string{
+		`cupsd.conf:1: error: MaxClients: invalid number "0"`,
+		`cupsd.conf:2: error: ServerTokens: invalid value "Everything"`,
+		`cupsd.conf:3: error: SSLOptions: unknown option "Bogus"`,
+		`cupsd.conf:4: warning: ServerAdmin is accepted but has no effect in this server`,
+		`cupsd.conf:6: error: LimitRequestBody: invalid size "lots"`,
+		`cups-files.conf:1: error: LogFilePerm: invalid permissions "rw"`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("missing %q in:\n%s", want, text)
+		}
+	}
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -266,6 +268,128 @@ func (c *Client) SendWithPayload(ctx context.Context, msg *goipp.Message, data i
 	return out, rest, nil
 }
 
+// Request is one IPP exchange for tools such as ipptool that address a
+// resource path directly and look at the HTTP response as well.
+type Request struct {
+	// Resource is the HTTP path, for example "/printers/Office".
+	Resource string
+	Message  *goipp.Message
+	// Document is sent after the attributes when set.
+	Document io.Reader
+	// Chunked forces Transfer-Encoding: chunked and Length forces a
+	// Content-Length header, which reads Document into memory. By default
+	// requests with a document are chunked and others are not.
+	Chunked bool
+	Length  bool
+	// Network is "tcp4" or "tcp6" to force an address family.
+	Network string
+	// Timeout bounds the exchange; it defaults to 60 seconds.
+	Timeout time.Duration
+}
+
+// Do sends req and decodes the IPP response. The HTTP response is returned
+// with its body closed, also when its status is not 2xx; then the error
+// reports the status and the message is nil.
+func (c *Client) Do(ctx context.Context, req Request) (*goipp.Message, *http.Response, error) {
+	if req.Message == nil {
+		return nil, nil, errors.New("missing ipp message")
+	}
+	payload, err := req.Message.EncodeBytes()
+	if err != nil {
+		return nil, nil, err
+	}
+	var body io.Reader = bytes.NewReader(payload)
+	length := int64(len(payload))
+	if req.Document != nil {
+		body = io.MultiReader(body, req.Document)
+		length = -1
+	}
+	if req.Length && length < 0 {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		body, length = bytes.NewReader(data), int64(len(data))
+	}
+	if req.Chunked {
+		length = -1
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.ippURLForPath(req.Resource), io.NopCloser(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	httpReq.ContentLength = length
+	if length < 0 {
+		httpReq.TransferEncoding = []string{"chunked"}
+	}
+	httpReq.Header.Set("Content-Type", goipp.ContentType)
+	httpReq.Header.Set("Accept", goipp.ContentType)
+	if c.User != "" {
+		httpReq.SetBasicAuth(c.User, c.Password)
+	}
+	transport := &http.Transport{TLSClientConfig: tlsConfig(c)}
+	if req.Network != "" {
+		dialer := &net.Dialer{}
+		transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, req.Network, addr)
+		}
+	}
+	timeout := req.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	client := &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		// A redirect is reported, not followed: IPP requests cannot be
+		// replayed as a GET.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return nil, resp, errors.New(resp.Status)
+	}
+	out := &goipp.Message{}
+	if err := out.Decode(resp.Body); err != nil {
+		return nil, resp, err
+	}
+	return out, resp, nil
+}
+
+// GetJSON fetches a scheduler HTTP resource (for example /admin/audit) and
+// decodes its JSON body into out.
+func (c *Client) GetJSON(ctx context.Context, path string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.ippURLForPath(path), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.User != "" {
+		req.SetBasicAuth(c.User, c.Password)
+	}
+	client := &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: tlsConfig(c),
+		},
+	}
+	resp, err := client.Do(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
 func tlsConfig(c *Client) *tls.Config {
 	skipVerify := false
 	if c != nil {
@@ -277,6 +401,12 @@ func tlsConfig(c *Client) *tls.Config {
 	return &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: skipVerify}
 }
 
+// ResourceFor returns the HTTP path a request is posted to, derived from
+// its operation and printer-uri or job-uri.
+func ResourceFor(msg *goipp.Message) string {
+	return ippPathForMessage(msg)
+}
+
 func ippPathForMessage(msg *goipp.Message) string {
 	if msg == nil {
 		return "/"
@@ -239,6 +239,12 @@ func defaultUser() string {
 	return "unknown"
 }
 
+// ConfDirs returns the system and per-user client configuration
+// directories; the user one is empty when there is no home directory.
+func ConfDirs() (system, user string) {
+	return defaultClientConfDir(), userClientConfDir()
+}
+
 func defaultClientConfDir() string {
 	if v := os.Getenv("CUPS_CLIENT_CONF_DIR"); v != "" {
 		return v
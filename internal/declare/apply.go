@@ -0,0 +1,480 @@
+package declare
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+type ApplyOptions struct {
+	// DryRun makes every change inside a transaction that is rolled back,
+	// so the result shows what a real run would do.
+	DryRun bool
+	// Prune removes the printers and classes the document does not list.
+	// Without it they are left alone.
+	Prune bool
+	// PPDDir is where ppd settings must name a file; empty skips the check.
+	PPDDir string
+}
+
+// Change is one difference between the document and the store. Op is "+"
+// for a queue that is added, "-" for one that is removed and "~" for a
+// changed setting.
+type Change struct {
+	Op    string
+	Kind  string
+	Name  string
+	Field string
+	From  string
+	To    string
+}
+
+func (c Change) String() string {
+	if c.Op != "~" {
+		return fmt.Sprintf("%s %s %s", c.Op, c.Kind, c.Name)
+	}
+	return fmt.Sprintf("~ %s %s: %s %q -> %q", c.Kind, c.Name, c.Field, c.From, c.To)
+}
+
+// Result lists the changes Apply made, or would make for a dry run.
+type Result struct {
+	DryRun  bool
+	Changes []Change
+}
+
+// WriteText renders the result for the command line.
+func (r Result) WriteText(w io.Writer) {
+	for _, c := range r.Changes {
+		fmt.Fprintln(w, c.String())
+	}
+	switch {
+	case len(r.Changes) == 0:
+		fmt.Fprintln(w, "Nothing to change.")
+	case r.DryRun:
+		fmt.Fprintf(w, "Would apply %d change(s).\n", len(r.Changes))
+	default:
+		fmt.Fprintf(w, "Applied %d change(s).\n", len(r.Changes))
+	}
+}
+
+var errDryRun = errors.New("dry run")
+
+type applier struct {
+	st     store.Repository
+	opts   ApplyOptions
+	result *Result
+}
+
+func (a *applier) record(c Change) {
+	a.result.Changes = append(a.result.Changes, c)
+}
+
+// Apply makes the store match doc. Printers are added or updated first, then
+// classes, then (with Prune) unlisted classes and printers are removed.
+// Everything happens in one transaction, so an error leaves the store
+// untouched. A printer that still has queued jobs is never removed.
+func Apply(ctx context.Context, st store.Repository, doc Document, opts ApplyOptions) (Result, error) {
+	result := Result{DryRun: opts.DryRun}
+	if st == nil {
+		return result, errors.New("declare: no store")
+	}
+	if err := doc.validate(); err != nil {
+		return result, err
+	}
+	a := &applier{st: st, opts: opts, result: &result}
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		for _, p := range doc.Printers {
+			if err := a.printer(ctx, tx, p); err != nil {
+				return fmt.Errorf("printer %s: %w", p.Name, err)
+			}
+		}
+		for _, c := range doc.Classes {
+			if err := a.class(ctx, tx, c); err != nil {
+				return fmt.Errorf("class %s: %w", c.Name, err)
+			}
+		}
+		if opts.Prune {
+			if err := a.prune(ctx, tx, doc); err != nil {
+				return err
+			}
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return result, err
+}
+
+// queueField is one setting in the form the diff compares.
+type queueField struct {
+	name, value string
+}
+
+func boolValue(v *bool) string {
+	return strconv.FormatBool(v == nil || *v)
+}
+
+func (q Queue) fields() []queueField {
+	out := []queueField{
+		{"info", q.Info},
+		{"location", q.Location},
+		{"accepting", boolValue(q.Accepting)},
+		{"enabled", boolValue(q.Enabled)},
+		{"job-sheets", strings.Join(jobSheets(strings.Join(q.JobSheets, ",")), ",")},
+		{"error-policy", q.ErrorPolicy},
+		{"op-policy", q.OpPolicy},
+		{"allowed-users", strings.Join(q.AllowedUsers, ",")},
+		{"denied-users", strings.Join(q.DeniedUsers, ",")},
+	}
+	// The default can only be moved to a queue, not taken away.
+	if q.Default {
+		out = append(out, queueField{"default", "true"})
+	}
+	names := make([]string, 0, len(q.Options))
+	for k := range q.Options {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		out = append(out, queueField{"options." + k, q.Options[k]})
+	}
+	return out
+}
+
+func (p Printer) fields() []queueField {
+	ppd := p.PPD
+	if ppd == "" {
+		ppd = model.DefaultPPDName
+	}
+	out := []queueField{
+		{"device-uri", p.DeviceURI},
+		{"ppd", ppd},
+		{"geo-location", p.GeoLocation},
+		{"organization", p.Organization},
+		{"organizational-unit", p.OrganizationalUnit},
+		{"shared", boolValue(p.Shared)},
+	}
+	return append(out, p.Queue.fields()...)
+}
+
+// fields lists members sorted; their order carries no meaning.
+func (c Class) fields() []queueField {
+	members := make([]string, len(c.Members))
+	for i, m := range c.Members {
+		members[i] = strings.ToLower(m)
+	}
+	sort.Strings(members)
+	return append([]queueField{{"members", strings.Join(members, ",")}}, c.Queue.fields()...)
+}
+
+// diffFields returns the settings of want that differ from cur, in the
+// order of want. Options only cur has are reported as changing to "".
+func diffFields(cur, want []queueField) []Change {
+	have := map[string]string{}
+	for _, f := range cur {
+		have[f.name] = f.value
+	}
+	var out []Change
+	seen := map[string]bool{}
+	for _, f := range want {
+		seen[f.name] = true
+		if have[f.name] != f.value {
+			out = append(out, Change{Op: "~", Field: f.name, From: have[f.name], To: f.value})
+		}
+	}
+	for _, f := range cur {
+		if !seen[f.name] && strings.HasPrefix(f.name, "options.") {
+			out = append(out, Change{Op: "~", Field: f.name, From: f.value})
+		}
+	}
+	return out
+}
+
+// optionsJSON folds the policies back into the default options, where the
+// server keeps them.
+func (q Queue) optionsJSON() string {
+	opts := map[string]string{}
+	for k, v := range q.Options {
+		opts[k] = v
+	}
+	if q.ErrorPolicy != "" {
+		opts["printer-error-policy"] = q.ErrorPolicy
+	}
+	if q.OpPolicy != "" {
+		opts["printer-op-policy"] = q.OpPolicy
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	raw, _ := json.Marshal(opts)
+	return string(raw)
+}
+
+func (q Queue) storedJobSheets() string {
+	sheets := jobSheets(strings.Join(q.JobSheets, ","))
+	if len(sheets) == 0 {
+		return "none"
+	}
+	return strings.Join(sheets, ",")
+}
+
+func (q Queue) state() int {
+	if q.Enabled != nil && !*q.Enabled {
+		return 5
+	}
+	return 3
+}
+
+// setUsers stores the access lists under the keys the IPP server reads for
+// requesting-user-name-allowed/denied.
+func (a *applier) setUsers(ctx context.Context, tx store.Tx, keyPrefix string, q Queue) error {
+	if err := a.st.SetSetting(ctx, tx, keyPrefix+".allowed_users", strings.Join(q.AllowedUsers, ",")); err != nil {
+		return err
+	}
+	return a.st.SetSetting(ctx, tx, keyPrefix+".denied_users", strings.Join(q.DeniedUsers, ","))
+}
+
+func (a *applier) checkPPD(name string) error {
+	if a.opts.PPDDir == "" || name == "" || name == model.DefaultPPDName {
+		return nil
+	}
+	if filepath.Base(name) != name {
+		return fmt.Errorf("ppd %q must be a file name in the PPD directory", name)
+	}
+	if _, err := os.Stat(filepath.Join(a.opts.PPDDir, name)); err != nil {
+		return fmt.Errorf("ppd %q: %w", name, err)
+	}
+	return nil
+}
+
+func (a *applier) printer(ctx context.Context, tx store.Tx, want Printer) error {
+	st := a.st
+	cur, err := st.GetPrinterByName(ctx, tx, want.Name)
+	created := false
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := st.GetClassByName(ctx, tx, want.Name); err == nil {
+			return errors.New("a class has this name")
+		}
+		if err := a.checkPPD(want.PPD); err != nil {
+			return err
+		}
+		shared := want.Shared == nil || *want.Shared
+		accepting := want.Accepting == nil || *want.Accepting
+		cur, err = st.CreatePrinter(ctx, tx, want.Name, want.DeviceURI, want.Location, want.Info, want.PPD,
+			accepting, false, shared, want.storedJobSheets(), want.optionsJSON())
+		if err != nil {
+			return err
+		}
+		created = true
+		a.record(Change{Op: "+", Kind: "printer", Name: want.Name})
+	} else if err != nil {
+		return err
+	}
+	if cur.IsTemporary {
+		if err := st.UpdatePrinterTemporary(ctx, tx, cur.ID, false); err != nil {
+			return err
+		}
+	}
+
+	keyPrefix := "printer." + strconv.FormatInt(cur.ID, 10)
+	have, err := exportPrinter(ctx, st, tx, cur)
+	if err != nil {
+		return err
+	}
+	optionsChanged, usersChanged := false, false
+	for _, c := range diffFields(have.fields(), want.fields()) {
+		if !created {
+			c.Kind, c.Name = "printer", cur.Name
+			a.record(c)
+		}
+		to := c.To
+		v := &to
+		switch {
+		case c.Field == "device-uri":
+			err = st.UpdatePrinterURI(ctx, tx, cur.ID, c.To)
+		case c.Field == "ppd":
+			if err = a.checkPPD(c.To); err == nil {
+				err = st.UpdatePrinterPPDName(ctx, tx, cur.ID, c.To)
+			}
+		case c.Field == "info":
+			err = st.UpdatePrinterAttributes(ctx, tx, cur.ID, v, nil, nil, nil, nil)
+		case c.Field == "location":
+			err = st.UpdatePrinterAttributes(ctx, tx, cur.ID, nil, v, nil, nil, nil)
+		case c.Field == "geo-location":
+			err = st.UpdatePrinterAttributes(ctx, tx, cur.ID, nil, nil, v, nil, nil)
+		case c.Field == "organization":
+			err = st.UpdatePrinterAttributes(ctx, tx, cur.ID, nil, nil, nil, v, nil)
+		case c.Field == "organizational-unit":
+			err = st.UpdatePrinterAttributes(ctx, tx, cur.ID, nil, nil, nil, nil, v)
+		case c.Field == "accepting":
+			err = st.UpdatePrinterAccepting(ctx, tx, cur.ID, c.To == "true")
+		case c.Field == "enabled":
+			err = st.UpdatePrinterState(ctx, tx, cur.ID, want.state())
+		case c.Field == "shared":
+			err = st.UpdatePrinterSharing(ctx, tx, cur.ID, c.To == "true")
+		case c.Field == "default":
+			err = st.SetDefaultPrinter(ctx, tx, cur.ID)
+		case c.Field == "job-sheets":
+			err = st.UpdatePrinterJobSheetsDefault(ctx, tx, cur.ID, want.storedJobSheets())
+		case c.Field == "allowed-users" || c.Field == "denied-users":
+			usersChanged = true
+		default:
+			optionsChanged = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if optionsChanged {
+		if err := st.UpdatePrinterDefaultOptions(ctx, tx, cur.ID, want.optionsJSON()); err != nil {
+			return err
+		}
+	}
+	if usersChanged {
+		return a.setUsers(ctx, tx, keyPrefix, want.Queue)
+	}
+	return nil
+}
+
+func (a *applier) class(ctx context.Context, tx store.Tx, want Class) error {
+	st := a.st
+	memberIDs := make([]int64, 0, len(want.Members))
+	for _, name := range want.Members {
+		p, err := st.GetPrinterByName(ctx, tx, name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("member %s is not a printer", name)
+			}
+			return err
+		}
+		memberIDs = append(memberIDs, p.ID)
+	}
+
+	cur, err := st.GetClassByName(ctx, tx, want.Name)
+	created := false
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := st.GetPrinterByName(ctx, tx, want.Name); err == nil {
+			return errors.New("a printer has this name")
+		}
+		accepting := want.Accepting == nil || *want.Accepting
+		cur, err = st.CreateClass(ctx, tx, want.Name, want.Location, want.Info, accepting, false, memberIDs)
+		if err != nil {
+			return err
+		}
+		created = true
+		a.record(Change{Op: "+", Kind: "class", Name: want.Name})
+	} else if err != nil {
+		return err
+	}
+
+	keyPrefix := "class." + strconv.FormatInt(cur.ID, 10)
+	have, err := exportClass(ctx, st, tx, cur)
+	if err != nil {
+		return err
+	}
+	optionsChanged, usersChanged := false, false
+	for _, c := range diffFields(have.fields(), want.fields()) {
+		if !created {
+			c.Kind, c.Name = "class", cur.Name
+			a.record(c)
+		}
+		switch {
+		case c.Field == "members":
+			err = st.ReplaceClassMembers(ctx, tx, cur.ID, memberIDs)
+		case c.Field == "info" || c.Field == "location":
+			err = st.UpdateClassAttributes(ctx, tx, cur.ID, &want.Info, &want.Location)
+		case c.Field == "accepting":
+			err = st.UpdateClassAccepting(ctx, tx, cur.ID, c.To == "true")
+		case c.Field == "enabled":
+			err = st.UpdateClassState(ctx, tx, cur.ID, want.state())
+		case c.Field == "default":
+			err = st.SetDefaultClass(ctx, tx, cur.ID)
+		case c.Field == "job-sheets":
+			err = st.UpdateClassJobSheetsDefault(ctx, tx, cur.ID, want.storedJobSheets())
+		case c.Field == "allowed-users" || c.Field == "denied-users":
+			usersChanged = true
+		default:
+			optionsChanged = true
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if optionsChanged {
+		if err := st.UpdateClassDefaultOptions(ctx, tx, cur.ID, want.optionsJSON()); err != nil {
+			return err
+		}
+	}
+	if usersChanged {
+		return a.setUsers(ctx, tx, keyPrefix, want.Queue)
+	}
+	return nil
+}
+
+// prune removes the queues doc does not list: classes first, so a removed
+// printer is no longer a member of anything.
+func (a *applier) prune(ctx context.Context, tx store.Tx, doc Document) error {
+	st := a.st
+	listed := map[string]bool{}
+	for _, p := range doc.Printers {
+		listed[strings.ToLower(p.Name)] = true
+	}
+	for _, c := range doc.Classes {
+		listed[strings.ToLower(c.Name)] = true
+	}
+	classes, err := st.ListClasses(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, c := range classes {
+		if listed[strings.ToLower(c.Name)] {
+			continue
+		}
+		a.record(Change{Op: "-", Kind: "class", Name: c.Name})
+		if err := st.DeleteClass(ctx, tx, c.ID); err != nil {
+			return err
+		}
+		if err := a.setUsers(ctx, tx, "class."+strconv.FormatInt(c.ID, 10), Queue{}); err != nil {
+			return err
+		}
+	}
+	printers, err := st.ListPrinters(ctx, tx)
+	if err != nil {
+		return err
+	}
+	for _, p := range printers {
+		if p.IsTemporary || listed[strings.ToLower(p.Name)] {
+			continue
+		}
+		queued, err := st.CountQueuedJobsByPrinterIDs(ctx, tx, []int64{p.ID})
+		if err != nil {
+			return err
+		}
+		if queued > 0 {
+			return fmt.Errorf("printer %s: not removed, %d job(s) are still queued", p.Name, queued)
+		}
+		a.record(Change{Op: "-", Kind: "printer", Name: p.Name})
+		if err := st.DeletePrinter(ctx, tx, p.ID); err != nil {
+			return err
+		}
+		if err := a.setUsers(ctx, tx, "printer."+strconv.FormatInt(p.ID, 10), Queue{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,184 @@
+package declare
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"cupsgolang/internal/store"
+)
+
+const testDocument = `# desired queues
+printers:
+  - name: Office
+    device-uri: ipp://office.example/ipp/print
+    info: "Office: laser"   # quoted because of the colon
+    shared: false
+    default: true
+    job-sheets: [standard]
+    op-policy: default
+    allowed-users: [alice, "@staff"]
+    options:
+      copies: 2
+      media: iso_a4_210x297mm
+  - name: Lobby
+    device-uri: socket://lobby:9100
+    enabled: false
+classes:
+  - name: All
+    members:
+    - Office
+    - Lobby
+`
+
+func applyDoc(t *testing.T, st store.Repository, text string, opts ApplyOptions) Result {
+	t.Helper()
+	doc, err := Decode([]byte(text))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	res, err := Apply(context.Background(), st, doc, opts)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	return res
+}
+
+func TestApplyCreatesQueuesAndExportRoundTrips(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+
+	res := applyDoc(t, st, testDocument, ApplyOptions{DryRun: true})
+	if len(res.Changes) != 3 {
+		t.Fatalf("dry run changes = %v", res.Changes)
+	}
+	if doc, err := Export(ctx, st); err != nil || len(doc.Printers) != 0 {
+		t.Fatalf("dry run changed the store: %+v %v", doc, err)
+	}
+
+	applyDoc(t, st, testDocument, ApplyOptions{})
+	doc, err := Export(ctx, st)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(doc.Printers) != 2 || len(doc.Classes) != 1 {
+		t.Fatalf("exported %+v", doc)
+	}
+	office := doc.Printers[1]
+	if office.Name != "Office" || office.Info != "Office: laser" || *office.Shared || !office.Default ||
+		office.OpPolicy != "default" || office.Options["copies"] != "2" || strings.Join(office.AllowedUsers, ",") != "alice,@staff" {
+		t.Fatalf("Office = %+v", office)
+	}
+	if lobby := doc.Printers[0]; *lobby.Enabled {
+		t.Fatalf("Lobby is enabled")
+	}
+
+	var yaml bytes.Buffer
+	if err := doc.EncodeYAML(&yaml); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if res := applyDoc(t, st, yaml.String(), ApplyOptions{}); len(res.Changes) != 0 {
+		t.Fatalf("re-applying the export changed %v\n%s", res.Changes, yaml.String())
+	}
+	var js bytes.Buffer
+	if err := doc.EncodeJSON(&js); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if res := applyDoc(t, st, js.String(), ApplyOptions{}); len(res.Changes) != 0 {
+		t.Fatalf("re-applying the JSON export changed %v", res.Changes)
+	}
+}
+
+func TestApplyUpdatesAndPrunes(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	applyDoc(t, st, testDocument, ApplyOptions{})
+
+	edited := strings.Replace(testDocument, "copies: 2", "copies: 3", 1)
+	edited = edited[:strings.Index(edited, "  - name: Lobby")] + "classes:\n  - name: All\n    members: [Office]\n"
+	res := applyDoc(t, st, edited, ApplyOptions{Prune: true})
+	var got []string
+	for _, c := range res.Changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`~ printer Office: options.copies "2" -> "3"`,
+		`~ class All: members "lobby,office" -> "office"`,
+		`- printer Lobby`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	doc, err := Export(ctx, st)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(doc.Printers) != 1 || doc.Printers[0].Options["copies"] != "3" {
+		t.Fatalf("exported %+v", doc.Printers)
+	}
+}
+
+func TestApplyKeepsPrinterWithQueuedJobs(t *testing.T) {
+	ctx := context.Background()
+	st := store.NewMemory()
+	applyDoc(t, st, testDocument, ApplyOptions{})
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		p, err := st.GetPrinterByName(ctx, tx, "Lobby")
+		if err != nil {
+			return err
+		}
+		_, err = st.CreateJob(ctx, tx, p.ID, "report", "alice", "localhost", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+	doc, err := Decode([]byte("printers:\n  - name: Office\n    device-uri: ipp://office.example/ipp/print\n"))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if _, err := Apply(ctx, st, doc, ApplyOptions{Prune: true}); err == nil || !strings.Contains(err.Error(), "still queued") {
+		t.Fatalf("err = %v", err)
+	}
+	// The failed apply must not have removed the class either.
+	if doc, _ := Export(ctx, st); len(doc.Classes) != 1 {
+		t.Fatalf("classes = %+v", doc.Classes)
+	}
+}
+
+func TestDecodeRejectsBadDocuments(t *testing.T) {
+	for _, tc := range []struct{ text, want string }{
+		{"printers:\n  - name: A\n    devce-uri: x\n", `unknown field "devce-uri"`},
+		{"printers:\n  - name: A\n   device-uri: x\n", "line 3: unexpected indentation"},
+		{"printers:\n  - name: A\n", "device-uri is required"},
+		{"printers:\n  - name: A B\n    device-uri: x\n", "invalid name"},
+		{"printers:\n  - {name: A, device-uri: x}\nclasses:\n  - name: a\n    members: []\n", "name used twice"},
+		{"printers:\n  - name: A\n    device-uri: x\n    allowed-users: [a]\n    denied-users: [b]\n", "exclusive"},
+	} {
+		if _, err := Decode([]byte(tc.text)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("Decode(%q) = %v, want %q", tc.text, err, tc.want)
+		}
+	}
+}
+
+func TestYAMLScalarsRoundTrip(t *testing.T) {
+	values := []string{"", "true", "no", "123", "1.5e3", "- dash", "a: b", "a #b", "it's", `say "hi"`, "tab\there", "  padded", "null", "ipp://h:631/x"}
+	doc := Document{Printers: []Printer{{Name: "A", DeviceURI: "x", Queue: Queue{Options: Options{}}}}}
+	for i, v := range values {
+		doc.Printers[0].Options["k"+strings.Repeat("x", i)] = v
+	}
+	var buf bytes.Buffer
+	if err := doc.EncodeYAML(&buf); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	back, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("decode: %v\n%s", err, buf.String())
+	}
+	for k, v := range doc.Printers[0].Options {
+		if got := back.Printers[0].Options[k]; got != v {
+			t.Errorf("%s = %q, want %q\n%s", k, got, v, buf.String())
+		}
+	}
+}
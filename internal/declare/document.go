@@ -0,0 +1,335 @@
+// Package declare describes the server's printers and classes as one
+// declarative YAML or JSON document, so the desired queue configuration can
+// be kept in version control. Export writes the document for the current
+// store; Apply compares a document with the store and makes the changes in
+// one transaction.
+package declare
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+// Document is the desired set of queues.
+type Document struct {
+	Printers []Printer `json:"printers"`
+	Classes  []Class   `json:"classes"`
+}
+
+// Queue holds the settings printers and classes share. Boolean settings
+// left out of a document take their CUPS defaults: accepting, enabled and
+// (for printers) shared. Other settings left out are empty, so a document
+// states the whole configuration of the queues it lists.
+type Queue struct {
+	Info     string `json:"info,omitempty"`
+	Location string `json:"location,omitempty"`
+	// Accepting is false for a queue that rejects jobs (cupsreject).
+	Accepting *bool `json:"accepting,omitempty"`
+	// Enabled is false for a stopped queue (cupsdisable).
+	Enabled *bool `json:"enabled,omitempty"`
+	// Default makes the queue the server default. There is no way to have
+	// no default, so "default: false" never clears it; mark another queue
+	// instead.
+	Default bool `json:"default,omitempty"`
+	// JobSheets is the start and end banner, as in job-sheets-default.
+	JobSheets    []string `json:"job-sheets,omitempty"`
+	ErrorPolicy  string   `json:"error-policy,omitempty"`
+	OpPolicy     string   `json:"op-policy,omitempty"`
+	AllowedUsers []string `json:"allowed-users,omitempty"`
+	DeniedUsers  []string `json:"denied-users,omitempty"`
+	Options      Options  `json:"options,omitempty"`
+}
+
+// Printer is one printer queue.
+type Printer struct {
+	Name      string `json:"name"`
+	DeviceURI string `json:"device-uri"`
+	// PPD names a file in the PPD directory.
+	PPD                string `json:"ppd,omitempty"`
+	Shared             *bool  `json:"shared,omitempty"`
+	GeoLocation        string `json:"geo-location,omitempty"`
+	Organization       string `json:"organization,omitempty"`
+	OrganizationalUnit string `json:"organizational-unit,omitempty"`
+	Queue
+}
+
+// Class is one printer class.
+type Class struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+	Queue
+}
+
+// Options are the queue's default job options (lpadmin -o name-default).
+// Numbers and booleans are accepted and kept as text.
+type Options map[string]string
+
+func (o *Options) UnmarshalJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return err
+	}
+	out := make(Options, len(raw))
+	for k, v := range raw {
+		switch t := v.(type) {
+		case nil:
+			out[k] = ""
+		case string:
+			out[k] = t
+		case []any:
+			parts := make([]string, 0, len(t))
+			for _, p := range t {
+				parts = append(parts, fmt.Sprint(p))
+			}
+			out[k] = strings.Join(parts, ",")
+		case map[string]any:
+			return fmt.Errorf("option %s: nested values are not supported", k)
+		default:
+			out[k] = fmt.Sprint(t)
+		}
+	}
+	*o = out
+	return nil
+}
+
+// Decode reads a document in YAML or JSON; a document starting with "{" is
+// JSON. Unknown settings are errors, so a typo is not silently ignored.
+func Decode(data []byte) (Document, error) {
+	var doc Document
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\ufeff")))
+	if !bytes.HasPrefix(trimmed, []byte("{")) {
+		converted, err := yamlToJSON(data)
+		if err != nil {
+			return doc, err
+		}
+		trimmed = converted
+	}
+	dec := json.NewDecoder(bytes.NewReader(trimmed))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return doc, err
+	}
+	return doc, doc.validate()
+}
+
+// EncodeJSON writes the document as indented JSON.
+func (d Document) EncodeJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(d)
+}
+
+// EncodeYAML writes the document as YAML that Decode reads back.
+func (d Document) EncodeYAML(w io.Writer) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	return jsonToYAML(data, w)
+}
+
+func (d Document) validate() error {
+	names := map[string]bool{}
+	defaults := 0
+	check := func(kind, name string, q Queue) error {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("%s without a name", kind)
+		}
+		if !validName(name) {
+			return fmt.Errorf("%s %q: invalid name", kind, name)
+		}
+		key := strings.ToLower(name)
+		if names[key] {
+			return fmt.Errorf("%s %q: name used twice", kind, name)
+		}
+		names[key] = true
+		if len(q.AllowedUsers) > 0 && len(q.DeniedUsers) > 0 {
+			return fmt.Errorf("%s %q: allowed-users and denied-users are exclusive", kind, name)
+		}
+		if len(q.JobSheets) > 2 {
+			return fmt.Errorf("%s %q: job-sheets takes a start and an end banner", kind, name)
+		}
+		if q.Default {
+			defaults++
+		}
+		return nil
+	}
+	for _, p := range d.Printers {
+		if err := check("printer", p.Name, p.Queue); err != nil {
+			return err
+		}
+		if strings.TrimSpace(p.DeviceURI) == "" {
+			return fmt.Errorf("printer %q: device-uri is required", p.Name)
+		}
+	}
+	for _, c := range d.Classes {
+		if err := check("class", c.Name, c.Queue); err != nil {
+			return err
+		}
+	}
+	if defaults > 1 {
+		return fmt.Errorf("%d queues are marked default", defaults)
+	}
+	return nil
+}
+
+// Export returns the document describing the store's printers and classes.
+// Temporary queues are left out.
+func Export(ctx context.Context, st store.Repository) (Document, error) {
+	doc := Document{Printers: []Printer{}, Classes: []Class{}}
+	err := st.WithTx(ctx, true, func(tx store.Tx) error {
+		printers, err := st.ListPrinters(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, p := range printers {
+			if p.IsTemporary {
+				continue
+			}
+			d, err := exportPrinter(ctx, st, tx, p)
+			if err != nil {
+				return err
+			}
+			doc.Printers = append(doc.Printers, d)
+		}
+		classes, err := st.ListClasses(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, c := range classes {
+			d, err := exportClass(ctx, st, tx, c)
+			if err != nil {
+				return err
+			}
+			doc.Classes = append(doc.Classes, d)
+		}
+		return nil
+	})
+	sort.Slice(doc.Printers, func(i, j int) bool {
+		return strings.ToLower(doc.Printers[i].Name) < strings.ToLower(doc.Printers[j].Name)
+	})
+	sort.Slice(doc.Classes, func(i, j int) bool {
+		return strings.ToLower(doc.Classes[i].Name) < strings.ToLower(doc.Classes[j].Name)
+	})
+	return doc, err
+}
+
+func exportQueue(ctx context.Context, st store.Repository, tx store.Tx, keyPrefix string, name, info, location string, state int, accepting, isDefault bool, sheets, optionsJSON string) (Queue, error) {
+	q := Queue{
+		Info:      info,
+		Location:  location,
+		Accepting: boolPtr(accepting),
+		Enabled:   boolPtr(state != 5),
+		Default:   isDefault,
+		JobSheets: jobSheets(sheets),
+		Options:   Options{},
+	}
+	if strings.TrimSpace(optionsJSON) != "" {
+		var opts map[string]string
+		if err := json.Unmarshal([]byte(optionsJSON), &opts); err != nil {
+			return q, fmt.Errorf("%s: bad default options: %w", name, err)
+		}
+		for k, v := range opts {
+			switch k {
+			case "printer-error-policy":
+				q.ErrorPolicy = v
+			case "printer-op-policy":
+				q.OpPolicy = v
+			default:
+				q.Options[k] = v
+			}
+		}
+	}
+	allowed, err := st.GetSetting(ctx, tx, keyPrefix+".allowed_users", "")
+	if err != nil {
+		return q, err
+	}
+	denied, err := st.GetSetting(ctx, tx, keyPrefix+".denied_users", "")
+	if err != nil {
+		return q, err
+	}
+	q.AllowedUsers, q.DeniedUsers = userList(allowed), userList(denied)
+	return q, nil
+}
+
+func exportPrinter(ctx context.Context, st store.Repository, tx store.Tx, p model.Printer) (Printer, error) {
+	q, err := exportQueue(ctx, st, tx, "printer."+strconv.FormatInt(p.ID, 10), p.Name, p.Info, p.Location, p.State, p.Accepting, p.IsDefault, p.JobSheetsDefault, p.DefaultOptions)
+	return Printer{
+		Name:               p.Name,
+		Queue:              q,
+		DeviceURI:          p.URI,
+		PPD:                p.PPDName,
+		GeoLocation:        p.Geo,
+		Organization:       p.Org,
+		OrganizationalUnit: p.OrgUnit,
+		Shared:             boolPtr(p.Shared),
+	}, err
+}
+
+func exportClass(ctx context.Context, st store.Repository, tx store.Tx, c model.Class) (Class, error) {
+	q, err := exportQueue(ctx, st, tx, "class."+strconv.FormatInt(c.ID, 10), c.Name, c.Info, c.Location, c.State, c.Accepting, c.IsDefault, c.JobSheetsDefault, c.DefaultOptions)
+	if err != nil {
+		return Class{}, err
+	}
+	members, err := st.ListClassMembers(ctx, tx, c.ID)
+	if err != nil {
+		return Class{}, err
+	}
+	out := Class{Name: c.Name, Queue: q, Members: []string{}}
+	for _, m := range members {
+		out.Members = append(out.Members, m.Name)
+	}
+	return out, nil
+}
+
+// validName applies the CUPS rules for queue names: at most 127 printable
+// characters, without spaces, "/", "\\", "?", "#", quotes or commas.
+func validName(name string) bool {
+	if len(name) > 127 {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("/\\?#'\",", r) {
+			return false
+		}
+	}
+	return true
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
+
+// jobSheets splits the stored "start,end" banners; a trailing "none" is
+// dropped, since it is what an unset end banner means.
+func jobSheets(value string) []string {
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	for len(parts) > 0 && parts[len(parts)-1] == "none" {
+		parts = parts[:len(parts)-1]
+	}
+	return parts
+}
+
+// userList splits a stored user list the way the IPP server does.
+func userList(value string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, u := range strings.FieldsFunc(value, func(r rune) bool { return strings.ContainsRune(",; \t\r\n", r) }) {
+		if !seen[u] {
+			seen[u] = true
+			out = append(out, u)
+		}
+	}
+	return out
+}
@@ -0,0 +1,405 @@
+package declare
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"cupsgolang/internal/yamlenc"
+)
+
+// The documents are small and regular, so instead of a YAML dependency this
+// file parses the block-style subset they need: mappings, sequences, plain
+// and quoted scalars, comments and single-line flow collections; yamlenc
+// writes it. YAML is converted to JSON and back, so encoding/json does the
+// typing.
+
+// jsonNode is a decoded JSON value that keeps the key order of objects.
+type jsonNode struct {
+	scalar any // string, json.Number, bool or nil
+	keys   []string
+	values []*jsonNode
+	list   bool
+	object bool
+}
+
+func readJSONNode(dec *json.Decoder) (*jsonNode, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		n := &jsonNode{list: t == '[', object: t == '{'}
+		for dec.More() {
+			if n.object {
+				key, err := dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				n.keys = append(n.keys, key.(string))
+			}
+			v, err := readJSONNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			n.values = append(n.values, v)
+		}
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+		return n, nil
+	default:
+		return &jsonNode{scalar: t}, nil
+	}
+}
+
+// jsonToYAML re-encodes a JSON document as block-style YAML.
+func jsonToYAML(data []byte, w io.Writer) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	root, err := readJSONNode(dec)
+	if err != nil {
+		return err
+	}
+	return yamlenc.Write(w, root.value())
+}
+
+// value converts the node to the yamlenc types.
+func (n *jsonNode) value() any {
+	switch {
+	case n.object:
+		m := make(yamlenc.Map, len(n.keys))
+		for i, key := range n.keys {
+			m[i] = yamlenc.Field{Key: key, Value: n.values[i].value()}
+		}
+		return m
+	case n.list:
+		items := make([]any, len(n.values))
+		for i, v := range n.values {
+			items[i] = v.value()
+		}
+		return items
+	}
+	return n.scalar
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// yamlToJSON converts a YAML document in the supported subset to JSON.
+func yamlToJSON(data []byte) ([]byte, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if i == 0 {
+			raw = strings.TrimPrefix(raw, "\ufeff")
+		}
+		if raw == "---" || raw == "..." {
+			continue
+		}
+		text := stripYAMLComment(raw)
+		trimmed := strings.TrimLeft(text, " ")
+		if strings.TrimSpace(trimmed) == "" {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", i+1)
+		}
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(text) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+	if len(p.lines) == 0 {
+		return []byte("null"), nil
+	}
+	v, err := p.block(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, fmt.Errorf("line %d: unexpected indentation", p.lines[p.pos].num)
+	}
+	return json.Marshal(v)
+}
+
+// stripYAMLComment removes a "#" comment that is not inside quotes.
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || line[i-1] == ' ' || strings.ContainsRune("[{,:-", rune(line[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) block(indent int) (any, error) {
+	if isSeqItem(p.lines[p.pos].text) {
+		return p.sequence(indent)
+	}
+	return p.mapping(indent)
+}
+
+func (p *yamlParser) sequence(indent int) ([]any, error) {
+	out := []any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent {
+			break
+		}
+		if l.indent > indent || !isSeqItem(l.text) {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.num)
+		}
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		switch {
+		case rest == "":
+			p.pos++
+			v, err := p.child(indent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		case isSeqItem(rest) || mappingKey(rest) >= 0:
+			// "- key: value" starts a block one level in.
+			p.lines[p.pos] = yamlLine{num: l.num, indent: l.indent + len(l.text) - len(rest), text: rest}
+			v, err := p.block(p.lines[p.pos].indent)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		default:
+			v, err := parseYAMLValue(rest, l.num)
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+			out = append(out, v)
+		}
+	}
+	return out, nil
+}
+
+func (p *yamlParser) mapping(indent int) (map[string]any, error) {
+	out := map[string]any{}
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.indent < indent || (l.indent == indent && isSeqItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.num)
+		}
+		i := mappingKey(l.text)
+		if i < 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", l.num)
+		}
+		key, err := parseYAMLKey(l.text[:i], l.num)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := out[key]; dup {
+			return nil, fmt.Errorf("line %d: duplicate key %q", l.num, key)
+		}
+		rest := strings.TrimSpace(l.text[i+1:])
+		p.pos++
+		if rest != "" {
+			if out[key], err = parseYAMLValue(rest, l.num); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		// A sequence may sit at the indentation of its key.
+		if p.pos < len(p.lines) && p.lines[p.pos].indent == indent && isSeqItem(p.lines[p.pos].text) {
+			if out[key], err = p.sequence(indent); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if out[key], err = p.child(indent); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// child parses the block nested under the line at indent, or null when
+// there is none.
+func (p *yamlParser) child(indent int) (any, error) {
+	if p.pos >= len(p.lines) || p.lines[p.pos].indent <= indent {
+		return nil, nil
+	}
+	return p.block(p.lines[p.pos].indent)
+}
+
+// mappingKey returns the index of the colon that ends a mapping key, or -1.
+func mappingKey(text string) int {
+	if text == "" || strings.ContainsRune("[{", rune(text[0])) {
+		return -1
+	}
+	start := 0
+	if q := text[0]; q == '"' || q == '\'' {
+		start = -1
+		for i := 1; i < len(text); i++ {
+			if text[i] == '\\' && q == '"' {
+				i++
+			} else if text[i] == q {
+				start = i + 1
+				break
+			}
+		}
+		if start < 0 {
+			return -1
+		}
+	}
+	for i := start; i < len(text); i++ {
+		if text[i] == ':' && (i+1 == len(text) || text[i+1] == ' ') {
+			return i
+		}
+	}
+	return -1
+}
+
+func parseYAMLKey(s string, num int) (string, error) {
+	v, err := parseYAMLValue(strings.TrimSpace(s), num)
+	if err != nil {
+		return "", err
+	}
+	switch t := v.(type) {
+	case string:
+		return t, nil
+	case nil:
+		return "", fmt.Errorf("line %d: empty key", num)
+	}
+	return fmt.Sprint(v), nil
+}
+
+func parseYAMLValue(s string, num int) (any, error) {
+	switch {
+	case strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return nil, fmt.Errorf("line %d: block scalars are not supported; use a quoted string", num)
+	case strings.HasPrefix(s, "&") || strings.HasPrefix(s, "*") || strings.HasPrefix(s, "!"):
+		return nil, fmt.Errorf("line %d: anchors, aliases and tags are not supported", num)
+	case strings.HasPrefix(s, "["):
+		if !strings.HasSuffix(s, "]") {
+			return nil, fmt.Errorf("line %d: unterminated flow sequence", num)
+		}
+		out := []any{}
+		parts, err := splitFlow(s[1:len(s)-1], num)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			v, err := parseYAMLValue(part, num)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case strings.HasPrefix(s, "{"):
+		if !strings.HasSuffix(s, "}") {
+			return nil, fmt.Errorf("line %d: unterminated flow mapping", num)
+		}
+		out := map[string]any{}
+		parts, err := splitFlow(s[1:len(s)-1], num)
+		if err != nil {
+			return nil, err
+		}
+		for _, part := range parts {
+			i := mappingKey(part)
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: expected \"key: value\" in flow mapping", num)
+			}
+			key, err := parseYAMLKey(part[:i], num)
+			if err != nil {
+				return nil, err
+			}
+			if out[key], err = parseYAMLValue(strings.TrimSpace(part[i+1:]), num); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: bad double-quoted string %s", num, s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return nil, fmt.Errorf("line %d: unterminated single-quoted string", num)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	switch strings.ToLower(s) {
+	case "", "null", "~":
+		return nil, nil
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	if yamlenc.IsNumber(s) {
+		return json.Number(strings.TrimPrefix(s, "+")), nil
+	}
+	return s, nil
+}
+
+// splitFlow splits the inside of a flow collection at top-level commas.
+func splitFlow(s string, num int) ([]string, error) {
+	var parts []string
+	depth, start := 0, 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	if quote != 0 || depth != 0 {
+		return nil, fmt.Errorf("line %d: unbalanced flow collection", num)
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" || len(parts) > 0 {
+		parts = append(parts, last)
+	}
+	return parts, nil
+}
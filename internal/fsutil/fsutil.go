@@ -0,0 +1,45 @@
+// Package fsutil holds file helpers shared by the server, its configuration
+// writers and the backup tools.
+package fsutil
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WriteFile replaces path with data and gives it mode perm. See
+// WriteFileFrom.
+func WriteFile(path string, data []byte, perm fs.FileMode) error {
+	return WriteFileFrom(path, bytes.NewReader(data), perm)
+}
+
+// WriteFileFrom replaces path with the contents of r and gives it mode perm.
+// The data is written to a temporary file in the same directory, synced and
+// renamed over path, so a reader sees either the old file or the complete
+// new one, never a partial write. The temporary file is removed on failure.
+func WriteFileFrom(path string, r io.Reader, perm fs.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm.Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
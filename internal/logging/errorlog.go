@@ -0,0 +1,383 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cupsd LogLevel names mapped onto slog levels. The standard slog levels keep
+// their meaning (debug/info/warn/error) so third-party handlers stay sensible.
+const (
+	LevelDebug2 = slog.Level(-8)
+	LevelDebug  = slog.LevelDebug
+	LevelInfo   = slog.LevelInfo
+	LevelNotice = slog.Level(2)
+	LevelWarn   = slog.LevelWarn
+	LevelError  = slog.LevelError
+	LevelCrit   = slog.Level(12)
+	LevelAlert  = slog.Level(14)
+	LevelEmerg  = slog.Level(16)
+
+	levelNone = slog.Level(100)
+)
+
+// ParseLevel converts a cupsd LogLevel value to a slog level.
+func ParseLevel(value string) (slog.Level, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "none":
+		return levelNone, true
+	case "emerg":
+		return LevelEmerg, true
+	case "alert":
+		return LevelAlert, true
+	case "crit":
+		return LevelCrit, true
+	case "error":
+		return LevelError, true
+	case "warn", "warning":
+		return LevelWarn, true
+	case "notice":
+		return LevelNotice, true
+	case "info":
+		return LevelInfo, true
+	case "debug":
+		return LevelDebug, true
+	case "debug2":
+		return LevelDebug2, true
+	}
+	return LevelInfo, false
+}
+
+// LevelName returns the cupsd LogLevel name for a slog level.
+func LevelName(level slog.Level) string {
+	switch {
+	case level >= LevelEmerg:
+		return "emerg"
+	case level >= LevelAlert:
+		return "alert"
+	case level >= LevelCrit:
+		return "crit"
+	case level >= LevelError:
+		return "error"
+	case level >= LevelWarn:
+		return "warn"
+	case level >= LevelNotice:
+		return "notice"
+	case level >= LevelInfo:
+		return "info"
+	case level >= LevelDebug:
+		return "debug"
+	default:
+		return "debug2"
+	}
+}
+
+// levelLetter matches the single-letter prefix used in the CUPS error_log.
+func levelLetter(level slog.Level) byte {
+	switch {
+	case level >= LevelEmerg:
+		return 'X'
+	case level >= LevelAlert:
+		return 'A'
+	case level >= LevelCrit:
+		return 'C'
+	case level >= LevelError:
+		return 'E'
+	case level >= LevelWarn:
+		return 'W'
+	case level >= LevelNotice:
+		return 'N'
+	case level >= LevelInfo:
+		return 'I'
+	case level >= LevelDebug:
+		return 'D'
+	default:
+		return 'd'
+	}
+}
+
+func normalizeLogFormat(format string) string {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "json":
+		return "json"
+	default:
+		return "text"
+	}
+}
+
+// logSink receives fully formatted records. Sinks that understand severity
+// (syslog) use the level; plain writers ignore it.
+type logSink interface {
+	writeRecord(level slog.Level, line []byte) error
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s writerSink) writeRecord(_ slog.Level, line []byte) error {
+	_, err := s.w.Write(line)
+	return err
+}
+
+// errorLogHandler renders records either in the classic CUPS error_log layout
+// ("E [date] message key=value") or as one JSON object per line.
+type errorLogHandler struct {
+	mu     *sync.Mutex
+	sink   logSink
+	level  slog.Leveler
+	json   bool
+	bare   bool
+	attrs  []slog.Attr
+	groups []string
+}
+
+func newErrorLogHandler(sink logSink, level slog.Leveler, format string) *errorLogHandler {
+	return &errorLogHandler{
+		mu:    &sync.Mutex{},
+		sink:  sink,
+		level: level,
+		json:  normalizeLogFormat(format) == "json",
+	}
+}
+
+func (h *errorLogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	min := LevelInfo
+	if h.level != nil {
+		min = h.level.Level()
+	}
+	return level >= min && min < levelNone
+}
+
+func (h *errorLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	next := *h
+	next.attrs = append(append([]slog.Attr{}, h.attrs...), qualifyAttrs(h.groups, attrs)...)
+	return &next
+}
+
+func (h *errorLogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	next := *h
+	next.groups = append(append([]string{}, h.groups...), name)
+	return &next
+}
+
+func (h *errorLogHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := append([]slog.Attr{}, h.attrs...)
+	if r.NumAttrs() > 0 {
+		recAttrs := make([]slog.Attr, 0, r.NumAttrs())
+		r.Attrs(func(a slog.Attr) bool {
+			recAttrs = append(recAttrs, a)
+			return true
+		})
+		attrs = append(attrs, qualifyAttrs(h.groups, recAttrs)...)
+	}
+	ts := r.Time
+	if ts.IsZero() {
+		ts = time.Now()
+	}
+	var line []byte
+	if h.json {
+		line = formatJSONRecord(ts, r.Level, r.Message, attrs, h.bare)
+	} else {
+		line = formatTextRecord(ts, r.Level, r.Message, attrs, h.bare)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.sink.writeRecord(r.Level, line)
+}
+
+func qualifyAttrs(groups []string, attrs []slog.Attr) []slog.Attr {
+	out := make([]slog.Attr, 0, len(attrs))
+	prefix := ""
+	if len(groups) > 0 {
+		prefix = strings.Join(groups, ".") + "."
+	}
+	for _, a := range attrs {
+		a.Value = a.Value.Resolve()
+		if a.Equal(slog.Attr{}) {
+			continue
+		}
+		if a.Value.Kind() == slog.KindGroup {
+			sub := a.Value.Group()
+			if a.Key != "" {
+				out = append(out, qualifyAttrs(append(append([]string{}, groups...), a.Key), sub)...)
+			} else {
+				out = append(out, qualifyAttrs(groups, sub)...)
+			}
+			continue
+		}
+		a.Key = prefix + a.Key
+		out = append(out, a)
+	}
+	return out
+}
+
+// formatTextRecord renders a record in the error_log layout. A bare record
+// leaves out the level letter and date, for sinks that add their own.
+func formatTextRecord(ts time.Time, level slog.Level, msg string, attrs []slog.Attr, bare bool) []byte {
+	var b bytes.Buffer
+	if !bare {
+		b.WriteByte(levelLetter(level))
+		b.WriteString(" [")
+		b.WriteString(ts.Format("02/Jan/2006:15:04:05 -0700"))
+		b.WriteString("] ")
+	}
+	rest := attrs[:0:0]
+	// CUPS prefixes job messages with "[Job N]"; keep that convention so
+	// existing log tooling continues to work.
+	for _, a := range attrs {
+		if a.Key == "job-id" {
+			b.WriteString("[Job ")
+			b.WriteString(a.Value.String())
+			b.WriteString("] ")
+			continue
+		}
+		rest = append(rest, a)
+	}
+	b.WriteString(strings.TrimRight(msg, "\n"))
+	for _, a := range rest {
+		b.WriteByte(' ')
+		b.WriteString(a.Key)
+		b.WriteByte('=')
+		b.WriteString(quoteTextValue(a.Value))
+	}
+	b.WriteByte('\n')
+	return b.Bytes()
+}
+
+func quoteTextValue(v slog.Value) string {
+	s := v.String()
+	if v.Kind() == slog.KindTime {
+		s = v.Time().Format(time.RFC3339)
+	}
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func formatJSONRecord(ts time.Time, level slog.Level, msg string, attrs []slog.Attr, bare bool) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	if !bare {
+		b.WriteString(`"time":`)
+		writeJSON(&b, ts.Format(time.RFC3339Nano))
+		b.WriteString(`,"level":`)
+		writeJSON(&b, LevelName(level))
+		b.WriteByte(',')
+	}
+	b.WriteString(`"msg":`)
+	writeJSON(&b, strings.TrimRight(msg, "\n"))
+	for _, a := range attrs {
+		b.WriteByte(',')
+		writeJSON(&b, a.Key)
+		b.WriteByte(':')
+		writeJSON(&b, jsonValue(a.Value))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+func jsonValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindBool:
+		return v.Bool()
+	case slog.KindInt64:
+		return v.Int64()
+	case slog.KindUint64:
+		return v.Uint64()
+	case slog.KindFloat64:
+		return v.Float64()
+	case slog.KindDuration:
+		return v.Duration().Seconds()
+	case slog.KindTime:
+		return v.Time().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		if err, ok := v.Any().(error); ok {
+			return err.Error()
+		}
+		return v.Any()
+	default:
+		return v.String()
+	}
+}
+
+func writeJSON(b *bytes.Buffer, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(data)
+}
+
+var (
+	errorLevel          = new(slog.LevelVar)
+	errorSink   logSink = writerSink{w: os.Stderr}
+	errorLogger         = slog.New(newErrorLogHandler(errorSink, errorLevel, "text"))
+)
+
+// ConfigureErrorLog rebuilds the error logger from the cupsd ErrorLog target,
+// LogLevel and LogFormat. It must be called after Configure.
+func ConfigureErrorLog(level, format string) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	lvl, ok := ParseLevel(level)
+	if !ok {
+		lvl = LevelInfo
+	}
+	errorLevel.Set(lvl)
+
+	var sink logSink = writerSink{w: os.Stderr}
+	bare := false
+	if global.errorLog != nil {
+		if global.errorLog.mode == targetSyslog {
+			if s, err := newSyslogSink(); err == nil {
+				// syslog stamps the time and carries the level as the
+				// priority, so it only gets the message.
+				sink, bare = s, true
+			}
+		} else if global.errorLog.Enabled() {
+			sink = writerSink{w: global.errorLog}
+		} else {
+			sink = writerSink{w: io.Discard}
+		}
+	}
+	if c, ok := errorSink.(io.Closer); ok {
+		_ = c.Close()
+	}
+	errorSink = sink
+	h := newErrorLogHandler(sink, errorLevel, format)
+	h.bare = bare
+	errorLogger = slog.New(h)
+}
+
+// Logger returns the scheduler error logger.
+func Logger() *slog.Logger {
+	globalMu.RLock()
+	defer globalMu.RUnlock()
+	return errorLogger
+}
+
+// SetLogLevel changes the active LogLevel without rebuilding the logger.
+func SetLogLevel(level string) bool {
+	lvl, ok := ParseLevel(level)
+	if ok {
+		errorLevel.Set(lvl)
+	}
+	return ok
+}
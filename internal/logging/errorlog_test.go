@@ -0,0 +1,123 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevelCupsNames(t *testing.T) {
+	cases := map[string]slog.Level{
+		"emerg":  LevelEmerg,
+		"alert":  LevelAlert,
+		"crit":   LevelCrit,
+		"error":  LevelError,
+		"warn":   LevelWarn,
+		"notice": LevelNotice,
+		"info":   LevelInfo,
+		"debug":  LevelDebug,
+		"debug2": LevelDebug2,
+	}
+	for name, want := range cases {
+		got, ok := ParseLevel(name)
+		if !ok || got != want {
+			t.Fatalf("ParseLevel(%q) = %v, %v; want %v", name, got, ok, want)
+		}
+		if LevelName(got) != name {
+			t.Fatalf("LevelName(%v) = %q, want %q", got, LevelName(got), name)
+		}
+	}
+	if _, ok := ParseLevel("chatty"); ok {
+		t.Fatal("expected unknown level to be rejected")
+	}
+}
+
+func TestErrorLogTextFormat(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(LevelWarn)
+	logger := slog.New(newErrorLogHandler(writerSink{w: &buf}, level, "text"))
+
+	logger.Info("not shown")
+	logger.With("job-id", int64(42)).Error("Job stopped", "printer", "Office", "reason", "job-stopped")
+
+	out := buf.String()
+	if strings.Contains(out, "not shown") {
+		t.Fatalf("info record should be filtered at warn level: %q", out)
+	}
+	if !strings.HasPrefix(out, "E [") {
+		t.Fatalf("expected CUPS level letter prefix, got %q", out)
+	}
+	if !strings.Contains(out, "] [Job 42] Job stopped printer=Office reason=job-stopped") {
+		t.Fatalf("unexpected text record: %q", out)
+	}
+}
+
+func TestErrorLogJSONFormat(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	level.Set(LevelDebug)
+	logger := slog.New(newErrorLogHandler(writerSink{w: &buf}, level, "json"))
+
+	logger.With("request-id", 7).Log(context.Background(), LevelNotice, "IPP request", "operation", "Print-Job")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid JSON record %q: %v", buf.String(), err)
+	}
+	if rec["level"] != "notice" || rec["msg"] != "IPP request" {
+		t.Fatalf("unexpected record: %#v", rec)
+	}
+	if rec["request-id"] != float64(7) || rec["operation"] != "Print-Job" {
+		t.Fatalf("missing attributes: %#v", rec)
+	}
+}
+
+func TestErrorLogLevelNoneDisables(t *testing.T) {
+	var buf bytes.Buffer
+	level := new(slog.LevelVar)
+	lvl, _ := ParseLevel("none")
+	level.Set(lvl)
+	logger := slog.New(newErrorLogHandler(writerSink{w: &buf}, level, "text"))
+	logger.Log(context.Background(), LevelEmerg, "boom")
+	if buf.Len() != 0 {
+		t.Fatalf("expected no output with LogLevel none, got %q", buf.String())
+	}
+}
+
+func TestErrorLogBareRecordOmitsLevelAndDate(t *testing.T) {
+	var buf bytes.Buffer
+	h := newErrorLogHandler(writerSink{w: &buf}, new(slog.LevelVar), "text")
+	h.bare = true
+	slog.New(h).With("job-id", int64(7)).Warn("Printer not responding", "printer", "Office")
+
+	if out := buf.String(); out != "[Job 7] Printer not responding printer=Office\n" {
+		t.Fatalf("unexpected bare record: %q", out)
+	}
+}
+
+type closeRecorder struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestConfigureClosesReplacedSyslogWriters(t *testing.T) {
+	Configure("syslog", "syslog", "", 0, "actions", "")
+	old := &closeRecorder{}
+	globalMu.Lock()
+	global.accessLog.syslog = old
+	globalMu.Unlock()
+
+	Configure("stderr", "", "", 0, "actions", "")
+	if !old.closed {
+		t.Fatal("the replaced access log kept its syslog connection open")
+	}
+}
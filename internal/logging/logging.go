@@ -11,6 +11,7 @@ type manager struct {
 	errorLog       *RotatingFile
 	accessLog      *RotatingFile
 	pageLog        *RotatingFile
+	auditLog       *RotatingFile
 	accessLogLevel string
 	pageLogFormat  string
 }
@@ -23,6 +24,11 @@ var (
 func Configure(errorPath, accessPath, pagePath string, maxSize int64, accessLevel, pageFormat string) {
 	globalMu.Lock()
 	defer globalMu.Unlock()
+	// A reload replaces the writers; close the old ones so their syslog
+	// connections are not leaked.
+	_ = global.errorLog.Close()
+	_ = global.accessLog.Close()
+	_ = global.pageLog.Close()
 	global.errorLog = NewRotatingFile(errorPath, maxSize)
 	global.accessLog = NewRotatingFile(accessPath, maxSize)
 	global.pageLog = NewRotatingFile(pagePath, maxSize)
@@ -60,6 +66,27 @@ func Page(line string) {
 	}
 }
 
+// ConfigureAudit sets the optional dedicated audit log. An empty path keeps
+// the audit trail in the store only.
+func ConfigureAudit(path string, maxSize int64) {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	_ = global.auditLog.Close()
+	global.auditLog = NewRotatingFile(path, maxSize)
+}
+
+func Audit(line string) {
+	globalMu.RLock()
+	logger := global.auditLog
+	globalMu.RUnlock()
+	if line == "" {
+		return
+	}
+	if logger != nil {
+		_ = logger.WriteLine(line)
+	}
+}
+
 func AccessLogLevel() string {
 	globalMu.RLock()
 	defer globalMu.RUnlock()
@@ -6,8 +6,18 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 )
 
+// filePerm is the mode log files are created with; zero means 0644.
+var filePerm atomic.Uint32
+
+// SetFilePerm sets the mode new log files are created with (the
+// cups-files.conf LogFilePerm directive).
+func SetFilePerm(mode os.FileMode) {
+	filePerm.Store(uint32(mode.Perm()))
+}
+
 // RotatingFile writes UTF-8 log lines to a file and rotates to "<path>.O"
 // when MaxSize is reached, matching CUPS-style single backup behavior.
 type RotatingFile struct {
@@ -15,6 +25,7 @@ type RotatingFile struct {
 	maxSize int64
 	mu      sync.Mutex
 	mode    targetMode
+	syslog  io.Writer
 }
 
 type targetMode int
@@ -24,6 +35,7 @@ const (
 	targetStderr
 	targetStdout
 	targetDiscard
+	targetSyslog
 )
 
 func NewRotatingFile(path string, maxSize int64) *RotatingFile {
@@ -32,7 +44,7 @@ func NewRotatingFile(path string, maxSize int64) *RotatingFile {
 	case "", "none", "off":
 		r.mode = targetDiscard
 	case "syslog":
-		r.mode = targetDiscard
+		r.mode = targetSyslog
 	case "stderr", "-":
 		r.mode = targetStderr
 	case "stdout":
@@ -69,6 +81,15 @@ func (r *RotatingFile) Write(p []byte) (int, error) {
 		return os.Stderr.Write(p)
 	case targetStdout:
 		return os.Stdout.Write(p)
+	case targetSyslog:
+		if r.syslog == nil {
+			w, err := openSyslogWriter()
+			if err != nil {
+				return os.Stderr.Write(p)
+			}
+			r.syslog = w
+		}
+		return r.syslog.Write(p)
 	default:
 		if err := r.ensureDir(); err != nil {
 			return 0, err
@@ -76,7 +97,11 @@ func (r *RotatingFile) Write(p []byte) (int, error) {
 		if err := r.rotateIfNeeded(int64(len(p))); err != nil {
 			return 0, err
 		}
-		f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		perm := os.FileMode(filePerm.Load())
+		if perm == 0 {
+			perm = 0o644
+		}
+		f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, perm)
 		if err != nil {
 			return 0, err
 		}
@@ -85,6 +110,22 @@ func (r *RotatingFile) Write(p []byte) (int, error) {
 	}
 }
 
+// Close releases the syslog connection, if one was opened. Files are
+// opened per write and need no closing; a later write reopens syslog.
+func (r *RotatingFile) Close() error {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.syslog.(io.Closer)
+	r.syslog = nil
+	if !ok {
+		return nil
+	}
+	return c.Close()
+}
+
 func (r *RotatingFile) ensureDir() error {
 	if r.mode != targetFile {
 		return nil
@@ -0,0 +1,52 @@
+//go:build !windows
+
+package logging
+
+import (
+	"io"
+	"log/slog"
+	"log/syslog"
+	"strings"
+)
+
+type syslogSink struct {
+	w *syslog.Writer
+}
+
+func newSyslogSink() (logSink, error) {
+	w, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "cupsd")
+	if err != nil {
+		return nil, err
+	}
+	return syslogSink{w: w}, nil
+}
+
+func (s syslogSink) writeRecord(level slog.Level, line []byte) error {
+	msg := strings.TrimRight(string(line), "\n")
+	switch {
+	case level >= LevelEmerg:
+		return s.w.Emerg(msg)
+	case level >= LevelAlert:
+		return s.w.Alert(msg)
+	case level >= LevelCrit:
+		return s.w.Crit(msg)
+	case level >= LevelError:
+		return s.w.Err(msg)
+	case level >= LevelWarn:
+		return s.w.Warning(msg)
+	case level >= LevelNotice:
+		return s.w.Notice(msg)
+	case level >= LevelInfo:
+		return s.w.Info(msg)
+	default:
+		return s.w.Debug(msg)
+	}
+}
+
+func (s syslogSink) Close() error {
+	return s.w.Close()
+}
+
+func openSyslogWriter() (io.Writer, error) {
+	return syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, "cupsd")
+}
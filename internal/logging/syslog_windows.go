@@ -0,0 +1,18 @@
+//go:build windows
+
+package logging
+
+import (
+	"errors"
+	"io"
+)
+
+var errSyslogUnavailable = errors.New("syslog is not available on this platform")
+
+func newSyslogSink() (logSink, error) {
+	return nil, errSyslogUnavailable
+}
+
+func openSyslogWriter() (io.Writer, error) {
+	return nil, errSyslogUnavailable
+}
@@ -0,0 +1,50 @@
+package metrics
+
+// Default is the process-wide registry served on /metrics.
+var Default = NewRegistry()
+
+var (
+	IPPOperations = Default.NewCounterVec(
+		"cups_ipp_operations_total",
+		"IPP operations handled, by operation and response status.",
+		"operation", "status",
+	)
+	IPPOperationDuration = Default.NewHistogramVec(
+		"cups_ipp_operation_duration_seconds",
+		"Time spent handling IPP operations, by operation and response status.",
+		DefaultBuckets,
+		"operation", "status",
+	)
+	JobOutcomes = Default.NewCounterVec(
+		"cups_job_outcomes_total",
+		"Jobs finished by the scheduler, by printer and job-state-reasons outcome.",
+		"printer", "reason",
+	)
+	FilterDuration = Default.NewHistogramVec(
+		"cups_filter_duration_seconds",
+		"Time spent running the filter pipeline for a document.",
+		LongBuckets,
+		"printer",
+	)
+	BackendDuration = Default.NewHistogramVec(
+		"cups_backend_duration_seconds",
+		"Time spent submitting a document to the printer backend.",
+		LongBuckets,
+		"printer", "scheme",
+	)
+	AuthFailures = Default.NewCounterVec(
+		"cups_auth_failures_total",
+		"Rejected authentication attempts, by scheme.",
+		"scheme",
+	)
+	AuthThrottled = Default.NewCounterVec(
+		"cups_auth_throttled_total",
+		"Authentication attempts refused without checking credentials because of backoff, lockout or nonce replay.",
+		"scheme", "reason",
+	)
+	ConnectionsRejected = Default.NewCounterVec(
+		"cups_http_connections_rejected_total",
+		"Connections answered with 503 because of MaxClients or MaxClientsPerHost, by limit.",
+		"limit",
+	)
+)
@@ -0,0 +1,289 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Registry holds metric families and renders them in the Prometheus text
+// exposition format (version 0.0.4).
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+}
+
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+}
+
+// WriteText writes every registered family followed by the supplied
+// scrape-time snapshots.
+func (r *Registry) WriteText(w io.Writer, snapshots ...Snapshot) error {
+	bw := bufio.NewWriter(w)
+	r.mu.Lock()
+	families := append([]family{}, r.families...)
+	r.mu.Unlock()
+	for _, snap := range snapshots {
+		families = append(families, snap)
+	}
+	sort.SliceStable(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+type labelSet struct {
+	key    string
+	values []string
+}
+
+func makeLabelSet(names []string, values []string) labelSet {
+	vals := make([]string, len(names))
+	copy(vals, values)
+	return labelSet{key: strings.Join(vals, "\xff"), values: vals}
+}
+
+type CounterVec struct {
+	fname  string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels labelSet
+	value  float64
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{fname: name, help: help, labels: labels, series: map[string]*counterSeries{}}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if c == nil || delta < 0 {
+		return
+	}
+	ls := makeLabelSet(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[ls.key]
+	if !ok {
+		s = &counterSeries{labels: ls}
+		c.series[ls.key] = s
+	}
+	s.value += delta
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Value returns the current counter value for the given labels.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	if c == nil {
+		return 0
+	}
+	ls := makeLabelSet(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[ls.key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) name() string { return c.fname }
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.fname, c.help, "counter")
+	for _, key := range sortedKeys(c.series) {
+		s := c.series[key]
+		writeSample(w, c.fname, c.labels, s.labels.values, nil, s.value)
+	}
+}
+
+type HistogramVec struct {
+	fname   string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels labelSet
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+var (
+	// DefaultBuckets suits request latencies.
+	DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	// LongBuckets suits filter and backend runs that may take minutes.
+	LongBuckets = []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+)
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	h := &HistogramVec{fname: name, help: help, labels: labels, buckets: b, series: map[string]*histogramSeries{}}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	if h == nil || math.IsNaN(value) {
+		return
+	}
+	ls := makeLabelSet(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[ls.key]
+	if !ok {
+		s = &histogramSeries{labels: ls, counts: make([]uint64, len(h.buckets))}
+		h.series[ls.key] = s
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += value
+}
+
+// ObserveSince records the time elapsed since start in seconds.
+func (h *HistogramVec) ObserveSince(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *HistogramVec) name() string { return h.fname }
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.fname, h.help, "histogram")
+	for _, key := range sortedKeys(h.series) {
+		s := h.series[key]
+		for i, upper := range h.buckets {
+			writeSample(w, h.fname+"_bucket", h.labels, s.labels.values, []string{"le", formatFloat(upper)}, float64(s.counts[i]))
+		}
+		writeSample(w, h.fname+"_bucket", h.labels, s.labels.values, []string{"le", "+Inf"}, float64(s.count))
+		writeSample(w, h.fname+"_sum", h.labels, s.labels.values, nil, s.sum)
+		writeSample(w, h.fname+"_count", h.labels, s.labels.values, nil, float64(s.count))
+	}
+}
+
+// Snapshot is a gauge family computed at scrape time (for example from the
+// store) rather than accumulated in-process.
+type Snapshot struct {
+	Name    string
+	Help    string
+	Labels  []string
+	Samples []Sample
+}
+
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+func (s Snapshot) name() string { return s.Name }
+
+func (s Snapshot) write(w *bufio.Writer) {
+	writeHeader(w, s.Name, s.Help, "gauge")
+	samples := append([]Sample{}, s.Samples...)
+	sort.SliceStable(samples, func(i, j int) bool {
+		return strings.Join(samples[i].LabelValues, "\xff") < strings.Join(samples[j].LabelValues, "\xff")
+	})
+	for _, sample := range samples {
+		writeSample(w, s.Name, s.Labels, sample.LabelValues, nil, sample.Value)
+	}
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, escapeHelp(help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func writeSample(w *bufio.Writer, name string, labels, values []string, extra []string, value float64) {
+	w.WriteString(name)
+	pairs := make([]string, 0, len(labels)+1)
+	for i, label := range labels {
+		v := ""
+		if i < len(values) {
+			v = values[i]
+		}
+		pairs = append(pairs, label+`="`+escapeLabel(v)+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeLabel(extra[1])+`"`)
+	}
+	if len(pairs) > 0 {
+		w.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	w.WriteString(" ")
+	w.WriteString(formatFloat(value))
+	w.WriteString("\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, "\n", `\n`)
+	return strings.ReplaceAll(v, `"`, `\"`)
+}
+
+func escapeHelp(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesPrometheusText(t *testing.T) {
+	reg := NewRegistry()
+	ops := reg.NewCounterVec("test_ops_total", "Operations.", "operation", "status")
+	lat := reg.NewHistogramVec("test_latency_seconds", "Latency.", []float64{0.1, 1}, "operation")
+
+	ops.Inc("Print-Job", "successful-ok")
+	ops.Inc("Print-Job", "successful-ok")
+	lat.Observe(0.5, "Print-Job")
+
+	var buf bytes.Buffer
+	err := reg.WriteText(&buf, Snapshot{
+		Name:    "test_printer_state",
+		Help:    "State.",
+		Labels:  []string{"printer"},
+		Samples: []Sample{{LabelValues: []string{`Off"ice`}, Value: 3}},
+	})
+	if err != nil {
+		t.Fatalf("WriteText: %v", err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE test_ops_total counter",
+		`test_ops_total{operation="Print-Job",status="successful-ok"} 2`,
+		"# TYPE test_latency_seconds histogram",
+		`test_latency_seconds_bucket{operation="Print-Job",le="0.1"} 0`,
+		`test_latency_seconds_bucket{operation="Print-Job",le="1"} 1`,
+		`test_latency_seconds_bucket{operation="Print-Job",le="+Inf"} 1`,
+		`test_latency_seconds_sum{operation="Print-Job"} 0.5`,
+		"# TYPE test_printer_state gauge",
+		`test_printer_state{printer="Off\"ice"} 3`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("missing %q in output:\n%s", want, out)
+		}
+	}
+	if got := ops.Value("Print-Job", "successful-ok"); got != 2 {
+		t.Fatalf("counter value = %v, want 2", got)
+	}
+}
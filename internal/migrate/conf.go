@@ -0,0 +1,124 @@
+package migrate
+
+import (
+	"bufio"
+	"os"
+	"strings"
+)
+
+// confBlock is one <Kind Name> ... </Kind> section of a CUPS state file
+// (printers.conf, classes.conf, subscriptions.conf, job.cache).
+type confBlock struct {
+	kind       string
+	name       string
+	line       int
+	directives []confDirective
+}
+
+type confDirective struct {
+	key   string
+	value string
+	line  int
+}
+
+// parseConfBlocks reads the blocks whose opening tag is one of kinds.
+// Top-level directives (NextPrinterId, NextJobId, ...) are skipped.
+func parseConfBlocks(path string, kinds ...string) ([]confBlock, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	allowed := map[string]bool{}
+	for _, k := range kinds {
+		allowed[strings.ToLower(k)] = true
+	}
+	var out []confBlock
+	var cur *confBlock
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "</") {
+			if cur != nil {
+				out = append(out, *cur)
+			}
+			cur = nil
+			continue
+		}
+		if strings.HasPrefix(line, "<") && strings.HasSuffix(line, ">") {
+			kind, name, _ := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(line, "<"), ">"), " ")
+			if !allowed[strings.ToLower(kind)] {
+				cur = nil
+				continue
+			}
+			cur = &confBlock{kind: kind, name: strings.TrimSpace(name), line: lineNo}
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		cur.directives = append(cur.directives, confDirective{key: key, value: strings.TrimSpace(value), line: lineNo})
+	}
+	return out, sc.Err()
+}
+
+func (b confBlock) get(key string) string {
+	for _, d := range b.directives {
+		if strings.EqualFold(d.key, key) {
+			return d.value
+		}
+	}
+	return ""
+}
+
+func confBool(value string) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "on", "true", "1":
+		return true
+	}
+	return false
+}
+
+// decodeUserData reverses the escaping cupsd applies to subscription
+// notify-user-data: printable bytes are written as-is and everything else
+// (and '<') as <XX>.
+func decodeUserData(value string) []byte {
+	out := make([]byte, 0, len(value))
+	for i := 0; i < len(value); i++ {
+		if value[i] == '<' && i+3 < len(value) && value[i+3] == '>' {
+			if b, ok := hexByte(value[i+1], value[i+2]); ok {
+				out = append(out, b)
+				i += 3
+				continue
+			}
+		}
+		out = append(out, value[i])
+	}
+	return out
+}
+
+func hexByte(hi, lo byte) (byte, bool) {
+	h, ok1 := hexNibble(hi)
+	l, ok2 := hexNibble(lo)
+	return h<<4 | l, ok1 && ok2
+}
+
+func hexNibble(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
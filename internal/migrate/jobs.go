@@ -0,0 +1,429 @@
+package migrate
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/store"
+)
+
+// cupsJob merges what job.cache and the c<id> control file know about a job.
+type cupsJob struct {
+	id      int
+	state   int
+	created time.Time
+	user    string
+	name    string
+	dest    string
+	files   []cupsJobFile
+	attrs   *goipp.Message
+}
+
+type cupsJobFile struct {
+	format      string
+	compression int
+}
+
+// CUPS job states, as in ipp_jstate_t.
+const (
+	jobPending    = 3
+	jobHeld       = 4
+	jobProcessing = 5
+	jobStopped    = 6
+)
+
+var nowUnix = func() int64 { return time.Now().Unix() }
+
+// loadJobs reads job.cache and every c<id> control file in the CUPS spool
+// directory. Jobs missing from job.cache (cupsd writes it lazily) are
+// recovered from their control file alone.
+func loadJobs(report *Report, spoolDir string) []cupsJob {
+	if strings.TrimSpace(spoolDir) == "" {
+		return nil
+	}
+	jobs := map[int]*cupsJob{}
+	if blocks, err := parseConfBlocks(filepath.Join(spoolDir, "job.cache"), "Job"); err == nil {
+		for _, b := range blocks {
+			id, err := strconv.Atoi(b.name)
+			if err != nil || id <= 0 {
+				continue
+			}
+			j := &cupsJob{id: id}
+			j.state, _ = strconv.Atoi(b.get("State"))
+			if ts, err := strconv.ParseInt(b.get("Created"), 10, 64); err == nil && ts > 0 {
+				j.created = time.Unix(ts, 0)
+			}
+			j.user = b.get("Username")
+			j.name = b.get("Name")
+			j.dest = b.get("Destination")
+			for _, d := range b.directives {
+				if !strings.EqualFold(d.key, "File") {
+					continue
+				}
+				// File <number> <super/type> <compression>
+				fields := strings.Fields(d.value)
+				f := cupsJobFile{format: "application/octet-stream"}
+				if len(fields) > 1 {
+					f.format = fields[1]
+				}
+				if len(fields) > 2 {
+					f.compression, _ = strconv.Atoi(fields[2])
+				}
+				j.files = append(j.files, f)
+			}
+			jobs[id] = j
+		}
+	} else if !os.IsNotExist(err) {
+		report.skip("job.cache: %v", err)
+	}
+
+	entries, err := os.ReadDir(spoolDir)
+	if err != nil {
+		report.skip("%s: %v", spoolDir, err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || len(name) < 2 || name[0] != 'c' {
+			continue
+		}
+		id, err := strconv.Atoi(name[1:])
+		if err != nil || id <= 0 {
+			continue
+		}
+		msg, err := readControlFile(filepath.Join(spoolDir, name))
+		if err != nil {
+			report.skip("%s: %v", name, err)
+			continue
+		}
+		j := jobs[id]
+		if j == nil {
+			j = &cupsJob{id: id}
+			jobs[id] = j
+		}
+		j.attrs = msg
+		j.fillFromAttrs(spoolDir)
+	}
+
+	out := make([]cupsJob, 0, len(jobs))
+	for _, j := range jobs {
+		out = append(out, *j)
+	}
+	sort.Slice(out, func(i, k int) bool { return out[i].id < out[k].id })
+	return out
+}
+
+func readControlFile(path string) (*goipp.Message, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var msg goipp.Message
+	if err := msg.DecodeBytes(data); err != nil {
+		return nil, fmt.Errorf("decode control file: %w", err)
+	}
+	return &msg, nil
+}
+
+func (j *cupsJob) fillFromAttrs(spoolDir string) {
+	attrs := j.attrs
+	if j.state == 0 {
+		if v, ok := intAttr(attrs.Job, "job-state"); ok {
+			j.state = v
+		}
+	}
+	if j.user == "" {
+		j.user = stringAttr(attrs.Job, "job-originating-user-name")
+	}
+	if name := stringAttr(attrs.Job, "job-name"); name != "" {
+		j.name = name
+	}
+	if j.dest == "" {
+		if raw := stringAttr(attrs.Job, "job-printer-uri"); raw != "" {
+			if u, err := url.Parse(raw); err == nil {
+				j.dest = path.Base(u.Path)
+			}
+		}
+	}
+	if j.created.IsZero() {
+		if v, ok := intAttr(attrs.Job, "time-at-creation"); ok && v > 0 {
+			j.created = time.Unix(int64(v), 0)
+		}
+	}
+	if len(j.files) == 0 {
+		format := stringAttr(attrs.Job, "document-format-supplied")
+		if format == "" {
+			format = stringAttr(attrs.Operation, "document-format")
+		}
+		if format == "" {
+			format = "application/octet-stream"
+		}
+		for i := 1; ; i++ {
+			if _, err := os.Stat(documentPath(spoolDir, j.id, i)); err != nil {
+				break
+			}
+			j.files = append(j.files, cupsJobFile{format: format})
+		}
+	}
+}
+
+func documentPath(spoolDir string, jobID, n int) string {
+	return filepath.Join(spoolDir, fmt.Sprintf("d%05d-%03d", jobID, n))
+}
+
+func (m *migrator) importJob(ctx context.Context, tx store.Tx, j cupsJob) error {
+	where := "job " + strconv.Itoa(j.id)
+	state := j.state
+	reason := ""
+	switch state {
+	case jobPending, jobProcessing:
+		// A job cupsd was printing when it stopped is restarted from the
+		// beginning, as cupsd itself would do.
+		state = jobPending
+	case jobHeld:
+		reason = "job-hold-until-specified"
+	case jobStopped:
+		reason = "job-stopped"
+	default:
+		// Completed, canceled and aborted jobs are history, not work.
+		return nil
+	}
+	if len(j.files) == 0 {
+		m.report.skip("%s: no document files", where)
+		return nil
+	}
+	for i := range j.files {
+		if _, err := os.Stat(documentPath(m.opts.SpoolDir, j.id, i+1)); err != nil {
+			m.report.skip("%s: document %d: %v", where, i+1, err)
+			return nil
+		}
+	}
+
+	printer, err := m.st.GetPrinterByName(ctx, tx, j.dest)
+	if err != nil {
+		class, cerr := m.st.GetClassByName(ctx, tx, j.dest)
+		if cerr != nil {
+			m.report.skip("%s: destination %q was not migrated", where, j.dest)
+			return nil
+		}
+		members, merr := m.st.ListClassMembers(ctx, tx, class.ID)
+		if merr != nil || len(members) == 0 {
+			m.report.skip("%s: class %q has no members", where, j.dest)
+			return nil
+		}
+		printer = members[0]
+		m.report.skip("%s: queued on class %s, assigned to member %s", where, class.Name, printer.Name)
+	}
+
+	opts := map[string]string{}
+	if j.attrs != nil {
+		opts = jobOptionsFromAttrs(j.attrs.Job, func(name string) {
+			m.report.skip("%s: attribute %s", where, name)
+		})
+	}
+	if state == jobHeld {
+		if hold := strings.TrimSpace(opts["job-hold-until"]); hold == "" || hold == "no-hold" {
+			opts["job-hold-until"] = "indefinite"
+		}
+	}
+	raw, _ := json.Marshal(opts)
+	user := j.user
+	if user == "" {
+		user = "anonymous"
+	}
+	name := j.name
+	if name == "" {
+		name = "Untitled"
+	}
+	originHost := ""
+	if j.attrs != nil {
+		originHost = stringAttr(j.attrs.Job, "job-originating-host-name")
+	}
+
+	job, err := m.st.CreateJob(ctx, tx, printer.ID, name, user, originHost, string(raw))
+	if err != nil {
+		return err
+	}
+	if !j.created.IsZero() {
+		if err := m.st.SetJobSubmittedAt(ctx, tx, job.ID, j.created); err != nil {
+			return err
+		}
+	}
+	formatSupplied := ""
+	if j.attrs != nil {
+		formatSupplied = stringAttr(j.attrs.Job, "document-format-supplied")
+	}
+	docName := ""
+	if j.attrs != nil {
+		docName = stringAttr(j.attrs.Job, "document-name-supplied")
+	}
+	if docName == "" {
+		docName = name
+	}
+	for i, f := range j.files {
+		src := documentPath(m.opts.SpoolDir, j.id, i+1)
+		dst, size, err := m.copyDocument(job.ID, name, src, f.compression)
+		if err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+		if _, err := m.st.AddDocument(ctx, tx, job.ID, docName, f.format, dst, size, docName, formatSupplied); err != nil {
+			return err
+		}
+		m.report.Documents++
+	}
+	if reason != "" {
+		if err := m.st.UpdateJobState(ctx, tx, job.ID, state, reason, nil); err != nil {
+			return err
+		}
+	}
+	m.report.Jobs[j.id] = job.ID
+	return nil
+}
+
+// copyDocument moves a d<id>-<n> file into the spool, inflating gzip
+// documents since jobs are stored uncompressed here. In a dry run it only
+// checks the file is readable.
+func (m *migrator) copyDocument(jobID int64, name, src string, compression int) (string, int64, error) {
+	f, err := os.Open(src)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if compression != 0 {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: %w", filepath.Base(src), err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	if m.opts.DryRun {
+		n, err := io.Copy(io.Discard, r)
+		return src, n, err
+	}
+	dst, n, err := m.opts.Spool.Save(jobID, name, r)
+	if dst != "" {
+		m.created = append(m.created, dst)
+	}
+	return dst, n, err
+}
+
+// readOnlyJobAttrs are job-status attributes cupsd keeps in the control
+// file; they are recomputed by the scheduler and not carried as options.
+var readOnlyJobAttrs = map[string]bool{
+	"job-id":                      true,
+	"job-uri":                     true,
+	"job-name":                    true,
+	"job-state":                   true,
+	"job-state-reasons":           true,
+	"job-state-message":           true,
+	"job-printer-uri":             true,
+	"job-printer-up-time":         true,
+	"job-printer-state-message":   true,
+	"job-printer-state-reasons":   true,
+	"job-originating-user-name":   true,
+	"job-originating-host-name":   true,
+	"job-k-octets":                true,
+	"job-k-octets-processed":      true,
+	"job-impressions":             true,
+	"job-impressions-completed":   true,
+	"job-media-sheets":            true,
+	"job-media-sheets-completed":  true,
+	"job-more-info":               true,
+	"job-detailed-status-message": true,
+	"job-authorization-uri":       true,
+	"job-hold-until-time":         true,
+	"document-format-supplied":    true,
+	"document-name-supplied":      true,
+	"document-format-detected":    true,
+	"number-of-documents":         true,
+	"number-of-intervening-jobs":  true,
+	"time-at-creation":            true,
+	"time-at-processing":          true,
+	"time-at-completed":           true,
+	"date-time-at-creation":       true,
+	"date-time-at-processing":     true,
+	"date-time-at-completed":      true,
+	"job-printer-state":           true,
+	"job-account-type":            true,
+	"printer-uri":                 true,
+	"attributes-charset":          true,
+	"attributes-natural-language": true,
+}
+
+// jobOptionsFromAttrs turns the job-template attributes of a control file
+// into the option map stored with each job. Collections other than media-col
+// have no flat form and are reported through unmapped.
+func jobOptionsFromAttrs(attrs goipp.Attributes, unmapped func(name string)) map[string]string {
+	opts := map[string]string{}
+	for _, attr := range attrs {
+		if len(attr.Values) == 0 || readOnlyJobAttrs[attr.Name] {
+			continue
+		}
+		if col, ok := attr.Values[0].V.(goipp.Collection); ok {
+			if attr.Name == "media-col" {
+				if v := collectionString(col, "media-size-name"); v != "" {
+					opts["media"] = v
+				}
+				if v := collectionString(col, "media-type"); v != "" {
+					opts["media-type"] = v
+				}
+				if v := collectionString(col, "media-source"); v != "" {
+					opts["media-source"] = v
+				}
+				continue
+			}
+			unmapped(attr.Name)
+			continue
+		}
+		parts := make([]string, 0, len(attr.Values))
+		for _, v := range attr.Values {
+			parts = append(parts, v.V.String())
+		}
+		opts[attr.Name] = strings.Join(parts, ",")
+	}
+	return opts
+}
+
+func collectionString(col goipp.Collection, name string) string {
+	for _, attr := range col {
+		if attr.Name == name && len(attr.Values) > 0 {
+			return attr.Values[0].V.String()
+		}
+	}
+	return ""
+}
+
+func stringAttr(attrs goipp.Attributes, name string) string {
+	for _, attr := range attrs {
+		if attr.Name == name && len(attr.Values) > 0 {
+			return strings.TrimSpace(attr.Values[0].V.String())
+		}
+	}
+	return ""
+}
+
+func intAttr(attrs goipp.Attributes, name string) (int, bool) {
+	for _, attr := range attrs {
+		if attr.Name != name || len(attr.Values) == 0 {
+			continue
+		}
+		if v, ok := attr.Values[0].V.(goipp.Integer); ok {
+			return int(v), true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,507 @@
+// Package migrate imports the state of an existing CUPS installation:
+// printers.conf, classes.conf, per-queue PPDs, subscriptions.conf and the
+// job.cache/c*/d* spool files of pending and held jobs.
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/spool"
+	"cupsgolang/internal/store"
+)
+
+type Options struct {
+	// From is the CUPS ServerRoot (normally /etc/cups).
+	From string
+	// SpoolDir is the CUPS RequestRoot (normally /var/spool/cups).
+	SpoolDir string
+	// PPDDir receives the per-queue PPD files.
+	PPDDir string
+	// Spool receives the document files of migrated jobs.
+	Spool spool.Spool
+	// DryRun maps everything inside a transaction that is rolled back and
+	// copies no files, so the report shows what a real run would do.
+	DryRun bool
+}
+
+// Report summarizes a migration. Skipped lists every directive, job or
+// subscription that could not be mapped, with the file and line it came from.
+type Report struct {
+	DryRun        bool
+	Printers      []string
+	Classes       []string
+	PPDs          int
+	Jobs          map[int]int64
+	Documents     int
+	Subscriptions int
+	Skipped       []string
+}
+
+func (r *Report) skip(format string, args ...any) {
+	r.Skipped = append(r.Skipped, fmt.Sprintf(format, args...))
+}
+
+// WriteText renders the report for the command line.
+func (r Report) WriteText(w io.Writer) {
+	verb := "Imported"
+	if r.DryRun {
+		verb = "Would import"
+	}
+	fmt.Fprintf(w, "%s %d printer(s): %s\n", verb, len(r.Printers), strings.Join(r.Printers, " "))
+	fmt.Fprintf(w, "%s %d class(es): %s\n", verb, len(r.Classes), strings.Join(r.Classes, " "))
+	fmt.Fprintf(w, "%s %d PPD file(s)\n", verb, r.PPDs)
+	fmt.Fprintf(w, "%s %d job(s) with %d document(s)\n", verb, len(r.Jobs), r.Documents)
+	ids := make([]int, 0, len(r.Jobs))
+	for id := range r.Jobs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		if r.DryRun {
+			fmt.Fprintf(w, "  job %d\n", id)
+			continue
+		}
+		fmt.Fprintf(w, "  job %d -> %d\n", id, r.Jobs[id])
+	}
+	fmt.Fprintf(w, "%s %d subscription(s)\n", verb, r.Subscriptions)
+	if len(r.Skipped) == 0 {
+		fmt.Fprintln(w, "Everything was mapped.")
+		return
+	}
+	fmt.Fprintf(w, "Not mapped (%d):\n", len(r.Skipped))
+	for _, line := range r.Skipped {
+		fmt.Fprintf(w, "  %s\n", line)
+	}
+}
+
+var errDryRun = errors.New("dry run")
+
+type migrator struct {
+	st     store.Repository
+	opts   Options
+	report *Report
+	// created holds files written during the run so they can be removed if
+	// the transaction fails.
+	created []string
+}
+
+// Run imports the CUPS installation described by opts into st. Everything
+// happens in one transaction, so a failure leaves the store untouched.
+func Run(ctx context.Context, st store.Repository, opts Options) (Report, error) {
+	report := Report{DryRun: opts.DryRun, Jobs: map[int]int64{}}
+	if st == nil {
+		return report, errors.New("migrate: no store")
+	}
+	if strings.TrimSpace(opts.From) == "" {
+		return report, errors.New("migrate: no CUPS configuration directory")
+	}
+	if info, err := os.Stat(opts.From); err != nil || !info.IsDir() {
+		return report, fmt.Errorf("migrate: %s is not a directory", opts.From)
+	}
+	printers := readBlocks(&report, filepath.Join(opts.From, "printers.conf"), "Printer", "DefaultPrinter")
+	classes := readBlocks(&report, filepath.Join(opts.From, "classes.conf"), "Class", "DefaultClass")
+	subs := readBlocks(&report, filepath.Join(opts.From, "subscriptions.conf"), "Subscription")
+	jobs := loadJobs(&report, opts.SpoolDir)
+
+	m := &migrator{st: st, opts: opts, report: &report}
+	err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		for _, b := range printers {
+			if err := m.importPrinter(ctx, tx, b); err != nil {
+				return err
+			}
+		}
+		for _, b := range classes {
+			if err := m.importClass(ctx, tx, b); err != nil {
+				return err
+			}
+		}
+		for _, j := range jobs {
+			if err := m.importJob(ctx, tx, j); err != nil {
+				return err
+			}
+		}
+		for _, b := range subs {
+			if err := m.importSubscription(ctx, tx, b); err != nil {
+				return err
+			}
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	if err != nil {
+		for _, path := range m.created {
+			_ = os.Remove(path)
+		}
+	}
+	return report, err
+}
+
+func readBlocks(report *Report, path string, kinds ...string) []confBlock {
+	blocks, err := parseConfBlocks(path, kinds...)
+	if err != nil {
+		if os.IsNotExist(err) {
+			report.skip("%s: not found", filepath.Base(path))
+		} else {
+			report.skip("%s: %v", filepath.Base(path), err)
+		}
+	}
+	return blocks
+}
+
+// Directives cupsd writes for its own bookkeeping; they have no equivalent
+// here and are regenerated, so they are not reported.
+var ignoredPrinterKeys = map[string]bool{
+	"printerid":    true,
+	"uuid":         true,
+	"statetime":    true,
+	"configtime":   true,
+	"type":         true,
+	"makemodel":    true,
+	"attribute":    true,
+	"reason":       true,
+	"statemessage": true,
+	"product":      true,
+}
+
+// destination holds the settings printers.conf and classes.conf share.
+type destination struct {
+	info, location    string
+	stopped           bool
+	accepting         bool
+	shared            bool
+	sharedSet         bool
+	jobSheets         string
+	options           map[string]string
+	allowed, denied   []string
+	geo, org, orgUnit string
+	deviceURI         string
+	members           []string
+}
+
+func (m *migrator) parseDestination(file string, b confBlock) destination {
+	d := destination{accepting: true, options: map[string]string{}}
+	for _, dir := range b.directives {
+		key := strings.ToLower(dir.key)
+		switch key {
+		case "info":
+			d.info = dir.value
+		case "location":
+			d.location = dir.value
+		case "deviceuri":
+			d.deviceURI = dir.value
+		case "geolocation":
+			d.geo = dir.value
+		case "organization":
+			d.org = dir.value
+		case "organizationalunit":
+			d.orgUnit = dir.value
+		case "state":
+			d.stopped = strings.EqualFold(dir.value, "stopped")
+		case "accepting":
+			d.accepting = confBool(dir.value)
+		case "shared":
+			d.shared = confBool(dir.value)
+			d.sharedSet = true
+		case "jobsheets":
+			sheets := strings.Fields(dir.value)
+			for len(sheets) < 2 {
+				sheets = append(sheets, "none")
+			}
+			d.jobSheets = sheets[0] + "," + sheets[1]
+		case "option":
+			name, value, _ := strings.Cut(dir.value, " ")
+			if name = strings.TrimSpace(name); name != "" {
+				d.options[name] = strings.TrimSpace(value)
+			}
+		case "errorpolicy":
+			d.options["printer-error-policy"] = dir.value
+		case "oppolicy":
+			d.options["printer-op-policy"] = dir.value
+		case "portmonitor":
+			if !strings.EqualFold(dir.value, "none") {
+				d.options["port-monitor"] = dir.value
+			}
+		case "quotaperiod", "pagelimit", "klimit":
+			if dir.value == "0" {
+				continue
+			}
+			// Quotas are kept with the queue defaults so they are not lost,
+			// but the scheduler does not enforce them.
+			d.options[quotaOption[key]] = dir.value
+			m.report.skip("%s:%d: %s %s %s imported but quotas are not enforced", file, dir.line, b.name, dir.key, dir.value)
+		case "allowuser":
+			d.allowed = append(d.allowed, dir.value)
+		case "denyuser":
+			d.denied = append(d.denied, dir.value)
+		case "member":
+			d.members = append(d.members, dir.value)
+		default:
+			if !ignoredPrinterKeys[key] {
+				m.report.skip("%s:%d: %s %s %s", file, dir.line, b.name, dir.key, dir.value)
+			}
+		}
+	}
+	return d
+}
+
+var quotaOption = map[string]string{
+	"quotaperiod": "job-quota-period",
+	"pagelimit":   "job-page-limit",
+	"klimit":      "job-k-limit",
+}
+
+func (m *migrator) importPrinter(ctx context.Context, tx store.Tx, b confBlock) error {
+	if b.name == "" {
+		return nil
+	}
+	d := m.parseDestination("printers.conf", b)
+	for _, member := range d.members {
+		m.report.skip("printers.conf: %s Member %s", b.name, member)
+	}
+	uri := d.deviceURI
+	if uri == "" {
+		uri = "file:///dev/null"
+		m.report.skip("printers.conf:%d: %s has no DeviceURI, using %s", b.line, b.name, uri)
+	}
+	printer, err := m.st.UpsertPrinter(ctx, tx, b.name, uri, d.location, d.info, d.accepting)
+	if err != nil {
+		return err
+	}
+	var geo, org, orgUnit *string
+	if d.geo != "" {
+		geo = &d.geo
+	}
+	if d.org != "" {
+		org = &d.org
+	}
+	if d.orgUnit != "" {
+		orgUnit = &d.orgUnit
+	}
+	if geo != nil || org != nil || orgUnit != nil {
+		if err := m.st.UpdatePrinterAttributes(ctx, tx, printer.ID, nil, nil, geo, org, orgUnit); err != nil {
+			return err
+		}
+	}
+	if d.sharedSet {
+		if err := m.st.UpdatePrinterSharing(ctx, tx, printer.ID, d.shared); err != nil {
+			return err
+		}
+	}
+	state := 3
+	if d.stopped {
+		state = 5
+	}
+	if err := m.st.UpdatePrinterState(ctx, tx, printer.ID, state); err != nil {
+		return err
+	}
+	if d.jobSheets != "" {
+		if err := m.st.UpdatePrinterJobSheetsDefault(ctx, tx, printer.ID, d.jobSheets); err != nil {
+			return err
+		}
+	}
+	if len(d.options) > 0 {
+		raw, _ := json.Marshal(d.options)
+		if err := m.st.UpdatePrinterDefaultOptions(ctx, tx, printer.ID, string(raw)); err != nil {
+			return err
+		}
+	}
+	if err := m.setUserAccess(ctx, tx, "printer."+strconv.FormatInt(printer.ID, 10), d); err != nil {
+		return err
+	}
+	if strings.EqualFold(b.kind, "DefaultPrinter") {
+		if err := m.st.SetDefaultPrinter(ctx, tx, printer.ID); err != nil {
+			return err
+		}
+	}
+	if err := m.importPPD(ctx, tx, printer); err != nil {
+		return err
+	}
+	m.report.Printers = append(m.report.Printers, printer.Name)
+	return nil
+}
+
+func (m *migrator) importPPD(ctx context.Context, tx store.Tx, printer model.Printer) error {
+	src := filepath.Join(m.opts.From, "ppd", printer.Name+".ppd")
+	if _, err := os.Stat(src); err != nil {
+		return nil
+	}
+	name := printer.Name + ".ppd"
+	if !m.opts.DryRun {
+		if strings.TrimSpace(m.opts.PPDDir) == "" {
+			m.report.skip("ppd/%s: no PPD directory configured", name)
+			return nil
+		}
+		if err := os.MkdirAll(m.opts.PPDDir, 0o755); err != nil {
+			return err
+		}
+		dst := filepath.Join(m.opts.PPDDir, name)
+		if err := copyFile(src, dst); err != nil {
+			return fmt.Errorf("copy %s: %w", src, err)
+		}
+		m.created = append(m.created, dst)
+	}
+	if err := m.st.UpdatePrinterPPDName(ctx, tx, printer.ID, name); err != nil {
+		return err
+	}
+	m.report.PPDs++
+	return nil
+}
+
+func (m *migrator) importClass(ctx context.Context, tx store.Tx, b confBlock) error {
+	if b.name == "" {
+		return nil
+	}
+	d := m.parseDestination("classes.conf", b)
+	if d.deviceURI != "" {
+		m.report.skip("classes.conf: %s DeviceURI %s", b.name, d.deviceURI)
+	}
+	if d.sharedSet && !d.shared {
+		m.report.skip("classes.conf: %s Shared No (classes are always shared)", b.name)
+	}
+	memberIDs := make([]int64, 0, len(d.members))
+	for _, name := range d.members {
+		p, err := m.st.GetPrinterByName(ctx, tx, name)
+		if err != nil {
+			m.report.skip("classes.conf: %s Member %s: no such printer", b.name, name)
+			continue
+		}
+		memberIDs = append(memberIDs, p.ID)
+	}
+	class, err := m.st.UpsertClass(ctx, tx, b.name, d.location, d.info, d.accepting, memberIDs)
+	if err != nil {
+		return err
+	}
+	state := 3
+	if d.stopped {
+		state = 5
+	}
+	if err := m.st.UpdateClassState(ctx, tx, class.ID, state); err != nil {
+		return err
+	}
+	if d.jobSheets != "" {
+		if err := m.st.UpdateClassJobSheetsDefault(ctx, tx, class.ID, d.jobSheets); err != nil {
+			return err
+		}
+	}
+	if len(d.options) > 0 {
+		raw, _ := json.Marshal(d.options)
+		if err := m.st.UpdateClassDefaultOptions(ctx, tx, class.ID, string(raw)); err != nil {
+			return err
+		}
+	}
+	if err := m.setUserAccess(ctx, tx, "class."+strconv.FormatInt(class.ID, 10), d); err != nil {
+		return err
+	}
+	if strings.EqualFold(b.kind, "DefaultClass") {
+		if err := m.st.SetDefaultClass(ctx, tx, class.ID); err != nil {
+			return err
+		}
+	}
+	m.report.Classes = append(m.report.Classes, class.Name)
+	return nil
+}
+
+// setUserAccess stores AllowUser/DenyUser lists under the same settings keys
+// the IPP requesting-user-name-allowed/denied attributes use.
+func (m *migrator) setUserAccess(ctx context.Context, tx store.Tx, keyPrefix string, d destination) error {
+	if len(d.allowed) > 0 {
+		if err := m.st.SetSetting(ctx, tx, keyPrefix+".allowed_users", strings.Join(d.allowed, ",")); err != nil {
+			return err
+		}
+		return m.st.SetSetting(ctx, tx, keyPrefix+".denied_users", "")
+	}
+	if len(d.denied) > 0 {
+		if err := m.st.SetSetting(ctx, tx, keyPrefix+".denied_users", strings.Join(d.denied, ",")); err != nil {
+			return err
+		}
+		return m.st.SetSetting(ctx, tx, keyPrefix+".allowed_users", "")
+	}
+	return nil
+}
+
+func (m *migrator) importSubscription(ctx context.Context, tx store.Tx, b confBlock) error {
+	where := "subscriptions.conf:" + strconv.Itoa(b.line) + ": subscription " + b.name
+	events := strings.Join(strings.Fields(b.get("Events")), ",")
+	owner := b.get("Owner")
+	recipient := b.get("Recipient")
+	interval, _ := strconv.ParseInt(b.get("Interval"), 10, 64)
+	lease, _ := strconv.ParseInt(b.get("LeaseDuration"), 10, 64)
+	if exp, _ := strconv.ParseInt(b.get("ExpirationTime"), 10, 64); exp > 0 {
+		remaining := exp - nowUnix()
+		if remaining <= 0 {
+			m.report.skip("%s: expired", where)
+			return nil
+		}
+		lease = remaining
+	}
+	var printerID, jobID *int64
+	if name := b.get("PrinterName"); name != "" {
+		if p, err := m.st.GetPrinterByName(ctx, tx, name); err == nil {
+			printerID = &p.ID
+		} else if _, err := m.st.GetClassByName(ctx, tx, name); err == nil {
+			m.report.skip("%s: class subscriptions (%s) are not supported", where, name)
+			return nil
+		} else {
+			m.report.skip("%s: printer %s was not migrated", where, name)
+			return nil
+		}
+	}
+	if raw := b.get("JobId"); raw != "" {
+		oldID, _ := strconv.Atoi(raw)
+		newID, ok := m.report.Jobs[oldID]
+		if !ok {
+			m.report.skip("%s: job %s was not migrated", where, raw)
+			return nil
+		}
+		jobID = &newID
+	}
+	var userData []byte
+	if raw := b.get("UserData"); raw != "" {
+		userData = decodeUserData(raw)
+	}
+	for _, d := range b.directives {
+		switch strings.ToLower(d.key) {
+		case "events", "owner", "recipient", "interval", "leaseduration", "expirationtime",
+			"printername", "jobid", "userdata", "nexteventid":
+		default:
+			m.report.skip("%s: %s %s", where, d.key, d.value)
+		}
+	}
+	if _, err := m.st.CreateSubscription(ctx, tx, store.SubscriptionLimits{}, printerID, jobID, events, lease, owner, recipient, "", interval, userData); err != nil {
+		return err
+	}
+	m.report.Subscriptions++
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
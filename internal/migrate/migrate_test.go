@@ -0,0 +1,317 @@
+package migrate
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/spool"
+	"cupsgolang/internal/store"
+)
+
+const testPrintersConf = `# Printer configuration file for CUPS v2.4.7
+NextPrinterId 3
+<DefaultPrinter office>
+PrinterId 1
+UUID urn:uuid:0b0d7d4e-0000-0000-0000-000000000001
+Info Office Laser
+Location Room 2
+DeviceURI ipp://10.0.0.5/ipp/print
+State Stopped
+StateTime 1700000000
+Type 8425500
+Accepting No
+Shared No
+JobSheets standard none
+QuotaPeriod 0
+PageLimit 0
+KLimit 0
+OpPolicy default
+ErrorPolicy abort-job
+AllowUser alice
+AllowUser @staff
+Option media iso_a4_210x297mm
+Filter application/vnd.cups-raster 0 /usr/lib/cups/filter/custom
+</DefaultPrinter>
+<Printer lab>
+Info Lab
+DeviceURI socket://10.0.0.6
+State Idle
+Accepting Yes
+DenyUser mallory
+</Printer>
+`
+
+const testClassesConf = `<Class all>
+Info Everything
+Member lab
+Member office
+Member missing
+State Idle
+Accepting Yes
+</Class>
+`
+
+const testSubscriptionsConf = `NextSubscriptionId 12
+<Subscription 10>
+Events printer-state-changed job-completed
+Owner alice
+Recipient rss://
+LeaseDuration 0
+Interval 0
+ExpirationTime 0
+PrinterName office
+UserData abc<00>
+NextEventId 1
+</Subscription>
+<Subscription 11>
+Events job-completed
+Owner bob
+LeaseDuration 0
+Interval 0
+ExpirationTime 0
+JobId 5
+NextEventId 1
+</Subscription>
+`
+
+const testJobCache = `NextJobId 8
+<Job 5>
+State 4
+Created 1700000100
+Priority 50
+Username bob
+Name report.pdf
+Destination office
+DestType 0
+NumFiles 1
+File 1 application/pdf 1
+</Job>
+<Job 6>
+State 9
+Created 1700000000
+Username bob
+Destination lab
+NumFiles 1
+File 1 text/plain 0
+</Job>
+`
+
+func writeControlFile(t *testing.T, path string, jobAttrs goipp.Attributes) {
+	t.Helper()
+	msg := goipp.NewRequest(goipp.DefaultVersion, goipp.OpPrintJob, 1)
+	msg.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	msg.Job = jobAttrs
+	data, err := msg.EncodeBytes()
+	if err != nil {
+		t.Fatalf("encode control file: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatalf("write control file: %v", err)
+	}
+}
+
+func newTestInstall(t *testing.T) (string, string) {
+	t.Helper()
+	from := t.TempDir()
+	spoolDir := t.TempDir()
+	files := map[string]string{
+		filepath.Join(from, "printers.conf"):      testPrintersConf,
+		filepath.Join(from, "classes.conf"):       testClassesConf,
+		filepath.Join(from, "subscriptions.conf"): testSubscriptionsConf,
+		filepath.Join(from, "ppd", "office.ppd"):  "*PPD-Adobe: \"4.3\"\n",
+		filepath.Join(spoolDir, "job.cache"):      testJobCache,
+		filepath.Join(spoolDir, "d00006-001"):     "done\n",
+		filepath.Join(spoolDir, "d00007-001"):     "plain text\n",
+	}
+	for path, data := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, _ = zw.Write([]byte("%PDF-1.4\n"))
+	_ = zw.Close()
+	if err := os.WriteFile(filepath.Join(spoolDir, "d00005-001"), gz.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var job5 goipp.Attributes
+	job5.Add(goipp.MakeAttribute("job-id", goipp.TagInteger, goipp.Integer(5)))
+	job5.Add(goipp.MakeAttribute("job-name", goipp.TagName, goipp.String("report.pdf")))
+	job5.Add(goipp.MakeAttribute("job-originating-user-name", goipp.TagName, goipp.String("bob")))
+	job5.Add(goipp.MakeAttribute("job-originating-host-name", goipp.TagName, goipp.String("10.0.0.20")))
+	job5.Add(goipp.MakeAttribute("job-hold-until", goipp.TagKeyword, goipp.String("night")))
+	job5.Add(goipp.MakeAttribute("copies", goipp.TagInteger, goipp.Integer(2)))
+	job5.Add(goipp.MakeAttribute("sides", goipp.TagKeyword, goipp.String("two-sided-long-edge")))
+	job5.Add(goipp.MakeAttribute("job-uuid", goipp.TagURI, goipp.String("urn:uuid:11111111-2222-3333-4444-555555555555")))
+	writeControlFile(t, filepath.Join(spoolDir, "c00005"), job5)
+
+	// Job 7 is not in job.cache and must be recovered from its control file.
+	var job7 goipp.Attributes
+	job7.Add(goipp.MakeAttribute("job-state", goipp.TagEnum, goipp.Integer(3)))
+	job7.Add(goipp.MakeAttribute("job-name", goipp.TagName, goipp.String("notes")))
+	job7.Add(goipp.MakeAttribute("job-originating-user-name", goipp.TagName, goipp.String("carol")))
+	job7.Add(goipp.MakeAttribute("job-printer-uri", goipp.TagURI, goipp.String("ipp://localhost:631/printers/lab")))
+	job7.Add(goipp.MakeAttribute("document-format-supplied", goipp.TagMimeType, goipp.String("text/plain")))
+	job7.Add(goipp.MakeAttribute("time-at-creation", goipp.TagInteger, goipp.Integer(1700000200)))
+	writeControlFile(t, filepath.Join(spoolDir, "c00007"), job7)
+	return from, spoolDir
+}
+
+func openTestStore(t *testing.T) store.Repository {
+	t.Helper()
+	st, err := store.Open(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	return st
+}
+
+func TestRunImportsCUPSInstallation(t *testing.T) {
+	from, spoolDir := newTestInstall(t)
+	st := openTestStore(t)
+	ppdDir := t.TempDir()
+	dest := spool.Spool{Dir: t.TempDir()}
+	ctx := context.Background()
+
+	report, err := Run(ctx, st, Options{From: from, SpoolDir: spoolDir, PPDDir: ppdDir, Spool: dest})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Printers) != 2 || len(report.Classes) != 1 || report.PPDs != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if len(report.Jobs) != 2 || report.Documents != 2 || report.Subscriptions != 2 {
+		t.Fatalf("jobs=%v documents=%d subscriptions=%d", report.Jobs, report.Documents, report.Subscriptions)
+	}
+	skipped := strings.Join(report.Skipped, "\n")
+	for _, want := range []string{"Filter application/vnd.cups-raster", "Member missing: no such printer"} {
+		if !strings.Contains(skipped, want) {
+			t.Fatalf("skipped report missing %q:\n%s", want, skipped)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(ppdDir, "office.ppd")); err != nil {
+		t.Fatalf("PPD not copied: %v", err)
+	}
+
+	err = st.WithTx(ctx, true, func(tx store.Tx) error {
+		office, err := st.GetPrinterByName(ctx, tx, "office")
+		if err != nil {
+			return err
+		}
+		if office.State != 5 || office.Accepting || office.Shared || !office.IsDefault {
+			t.Fatalf("office = %+v", office)
+		}
+		if office.PPDName != "office.ppd" || office.JobSheetsDefault != "standard,none" {
+			t.Fatalf("office ppd/sheets = %q/%q", office.PPDName, office.JobSheetsDefault)
+		}
+		for _, want := range []string{`"media":"iso_a4_210x297mm"`, `"printer-error-policy":"abort-job"`} {
+			if !strings.Contains(office.DefaultOptions, want) {
+				t.Fatalf("office options %s missing %s", office.DefaultOptions, want)
+			}
+		}
+		allowed, _ := st.GetSetting(ctx, tx, "printer."+strconv.FormatInt(office.ID, 10)+".allowed_users", "")
+		if allowed != "alice,@staff" {
+			t.Fatalf("allowed users = %q", allowed)
+		}
+		class, err := st.GetClassByName(ctx, tx, "all")
+		if err != nil {
+			return err
+		}
+		members, _ := st.ListClassMembers(ctx, tx, class.ID)
+		if len(members) != 2 {
+			t.Fatalf("class members = %d, want 2", len(members))
+		}
+
+		held, err := st.GetJob(ctx, tx, report.Jobs[5])
+		if err != nil {
+			return err
+		}
+		if held.State != 4 || held.UserName != "bob" || held.OriginHost != "10.0.0.20" {
+			t.Fatalf("held job = %+v", held)
+		}
+		for _, want := range []string{`"copies":"2"`, `"job-hold-until":"night"`, `"job-uuid":"urn:uuid:11111111`} {
+			if !strings.Contains(held.Options, want) {
+				t.Fatalf("held job options %s missing %s", held.Options, want)
+			}
+		}
+		docs, err := st.ListDocumentsByJob(ctx, tx, held.ID)
+		if err != nil || len(docs) != 1 {
+			t.Fatalf("documents = %v, %v", docs, err)
+		}
+		data, _ := os.ReadFile(docs[0].Path)
+		if string(data) != "%PDF-1.4\n" || docs[0].MimeType != "application/pdf" {
+			t.Fatalf("document %q (%s) not decompressed", data, docs[0].MimeType)
+		}
+
+		pending, err := st.GetJob(ctx, tx, report.Jobs[7])
+		if err != nil {
+			return err
+		}
+		if pending.State != 3 || pending.Name != "notes" || pending.SubmittedAt.Unix() != 1700000200 {
+			t.Fatalf("recovered job = %+v", pending)
+		}
+		subs, err := st.ListSubscriptions(ctx, tx, nil, nil, "", 0)
+		if err != nil {
+			return err
+		}
+		if len(subs) != 2 {
+			t.Fatalf("subscriptions = %d, want 2", len(subs))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunDryRunChangesNothing(t *testing.T) {
+	from, spoolDir := newTestInstall(t)
+	st := openTestStore(t)
+	ppdDir := t.TempDir()
+	spoolOut := t.TempDir()
+	ctx := context.Background()
+
+	report, err := Run(ctx, st, Options{From: from, SpoolDir: spoolDir, PPDDir: ppdDir, Spool: spool.Spool{Dir: spoolOut}, DryRun: true})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(report.Printers) != 2 || len(report.Jobs) != 2 {
+		t.Fatalf("dry-run report = %+v", report)
+	}
+	var out bytes.Buffer
+	report.WriteText(&out)
+	if !strings.Contains(out.String(), "Would import 2 printer(s)") || !strings.Contains(out.String(), "Not mapped") {
+		t.Fatalf("report text:\n%s", out.String())
+	}
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
+		if _, err := st.GetPrinterByName(ctx, tx, "lab"); err == nil {
+			t.Fatalf("dry run created printer lab")
+		}
+		return nil
+	})
+	for _, dir := range []string{ppdDir, spoolOut} {
+		if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+			t.Fatalf("dry run wrote files to %s", dir)
+		}
+	}
+}
+
+func TestDecodeUserData(t *testing.T) {
+	if got := string(decodeUserData("a<3C>b<00>")); got != "a<b\x00" {
+		t.Fatalf("decodeUserData = %q", got)
+	}
+}
@@ -2,6 +2,9 @@ package model
 
 import (
 	"database/sql"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -28,6 +31,11 @@ type Printer struct {
 
 const DefaultPPDName = "CUPS-Golang-Generic.ppd"
 
+// OpBackupServer is the vendor IPP operation (CUPS-Golang-Backup) that
+// returns a backup archive of the whole server state after the response.
+// CUPS's own extensions stop at 0x4027.
+const OpBackupServer = 0x4100
+
 type Class struct {
 	ID               int64
 	Name             string
@@ -99,3 +107,37 @@ type Notification struct {
 	Event          string
 	CreatedAt      time.Time
 }
+
+// AuditEntry is one record of an administrative action. Changes maps each
+// modified attribute to its [before, after] values.
+type AuditEntry struct {
+	ID         int64
+	User       string
+	RemoteAddr string
+	Operation  string
+	Target     string
+	Changes    map[string][2]string
+	CreatedAt  time.Time
+}
+
+// ChangeSummary renders Changes as "name: old -> new" pairs in attribute
+// order, quoting empty values and values containing separators.
+func (e AuditEntry) ChangeSummary() string {
+	keys := make([]string, 0, len(e.Changes))
+	for k := range e.Changes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	quote := func(v string) string {
+		if v == "" || strings.ContainsAny(v, " ;") {
+			return strconv.Quote(v)
+		}
+		return v
+	}
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		c := e.Changes[k]
+		parts = append(parts, k+": "+quote(c[0])+" -> "+quote(c[1]))
+	}
+	return strings.Join(parts, "; ")
+}
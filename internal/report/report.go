@@ -0,0 +1,333 @@
+// Package report renders what the client commands list (printers, jobs,
+// classes, devices, models, options) as JSON, YAML or CSV for scripts.
+//
+// Every document is an object holding the schema version and one list of
+// records per kind, for example
+//
+//	{"version": 1, "printers": [{"name": "Office", ...}]}
+//
+// Records keep their field order, and each kind always has the same fields,
+// so columns and keys are stable. Fields are only added within a version;
+// renaming, removing or retyping one bumps SchemaVersion. Records that come
+// from IPP also carry the full attribute set under "attributes", where each
+// attribute is a list of values whatever its cardinality.
+package report
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// SchemaVersion is the version of the record layouts.
+const SchemaVersion = 1
+
+// Format selects how records are written.
+type Format int
+
+const (
+	// FormatText is each command's classic human-readable output.
+	FormatText Format = iota
+	FormatJSON
+	FormatYAML
+	FormatCSV
+)
+
+// ParseFormat reads a --format argument.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "text", "":
+		return FormatText, nil
+	case "json":
+		return FormatJSON, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "csv":
+		return FormatCSV, nil
+	}
+	return FormatText, fmt.Errorf("unknown format %q (want json, yaml or csv)", s)
+}
+
+// Field is one named value of a record. Values are nil, strings, integers,
+// booleans, []string, []any, Record or []Record.
+type Field struct {
+	Name  string
+	Value any
+}
+
+// Record is an ordered set of fields.
+type Record []Field
+
+// Add appends a field.
+func (r *Record) Add(name string, value any) {
+	*r = append(*r, Field{Name: name, Value: value})
+}
+
+// Get returns the value of the named field, or nil.
+func (r Record) Get(name string) any {
+	for _, f := range r {
+		if f.Name == name {
+			return f.Value
+		}
+	}
+	return nil
+}
+
+// MarshalJSON writes the record as an object in field order.
+func (r Record) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range r {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(f.Name)
+		b.Write(key)
+		b.WriteByte(':')
+		value, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f.Name, err)
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// Section is the list of records of one kind.
+type Section struct {
+	Kind    string
+	Records []Record
+}
+
+// Writer collects sections and writes them as one document, so a command
+// that shows several kinds (lpstat -t) still emits a single object.
+type Writer struct {
+	Format   Format
+	sections []Section
+}
+
+// Add appends records of a kind, merging with an earlier section of the
+// same kind. An empty section is kept so the key is always present.
+func (w *Writer) Add(kind string, records ...Record) {
+	for i := range w.sections {
+		if w.sections[i].Kind == kind {
+			w.sections[i].Records = append(w.sections[i].Records, records...)
+			return
+		}
+	}
+	if records == nil {
+		records = []Record{}
+	}
+	w.sections = append(w.sections, Section{Kind: kind, Records: records})
+}
+
+// Flush writes the collected sections.
+func (w *Writer) Flush(out io.Writer) error {
+	switch w.Format {
+	case FormatJSON:
+		return writeJSON(out, w.sections)
+	case FormatYAML:
+		return writeYAML(out, w.sections)
+	case FormatCSV:
+		return writeCSV(out, w.sections)
+	}
+	return fmt.Errorf("format %d is not structured", w.Format)
+}
+
+func document(sections []Section) Record {
+	doc := Record{{Name: "version", Value: SchemaVersion}}
+	for _, s := range sections {
+		doc.Add(s.Kind, s.Records)
+	}
+	return doc
+}
+
+func writeJSON(out io.Writer, sections []Section) error {
+	data, err := json.Marshal(document(sections))
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		return err
+	}
+	b.WriteByte('\n')
+	_, err = out.Write(b.Bytes())
+	return err
+}
+
+// writeCSV writes one table per section with a header row of the field
+// names; several sections are separated by a blank line. Lists are joined
+// with commas and nested values are written as JSON.
+func writeCSV(out io.Writer, sections []Section) error {
+	cw := csv.NewWriter(out)
+	for i, s := range sections {
+		if i > 0 {
+			cw.Flush()
+			if _, err := io.WriteString(out, "\n"); err != nil {
+				return err
+			}
+		}
+		if len(s.Records) == 0 {
+			continue
+		}
+		header := make([]string, len(s.Records[0]))
+		for j, f := range s.Records[0] {
+			header[j] = f.Name
+		}
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		for _, r := range s.Records {
+			row := make([]string, len(header))
+			for j, name := range header {
+				cell, err := csvCell(r.Get(name))
+				if err != nil {
+					return err
+				}
+				row[j] = cell
+			}
+			if err := cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func csvCell(v any) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case []string:
+		return strings.Join(t, ","), nil
+	case bool, int, int64:
+		return fmt.Sprint(t), nil
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+// Time is a Unix time as an RFC 3339 string in UTC, or nil when unset.
+func Time(epoch int64) any {
+	if epoch <= 0 {
+		return nil
+	}
+	return time.Unix(epoch, 0).UTC().Format(time.RFC3339)
+}
+
+// Strings returns values without empty entries, which is how no-value
+// attributes read, as a list that encodes as [] rather than null.
+func Strings(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Attributes converts an IPP attribute group to a record of value lists.
+func Attributes(attrs goipp.Attributes) Record {
+	out := make(Record, 0, len(attrs))
+	for _, a := range attrs {
+		values := make([]any, 0, len(a.Values))
+		for _, v := range a.Values {
+			values = append(values, Value(v.V))
+		}
+		out.Add(a.Name, values)
+	}
+	return out
+}
+
+// Value converts one IPP value to its record form: integers and enums as
+// numbers, booleans, dateTime as RFC 3339, ranges as {lower, upper},
+// resolutions as {x, y, units}, collections as records, octetStrings that
+// are not text as base64 and out-of-band values as nil.
+func Value(v goipp.Value) any {
+	switch t := v.(type) {
+	case goipp.Integer:
+		return int(t)
+	case goipp.Boolean:
+		return bool(t)
+	case goipp.String:
+		return string(t)
+	case goipp.Time:
+		return t.Time.UTC().Format(time.RFC3339)
+	case goipp.Range:
+		return Record{{Name: "lower", Value: t.Lower}, {Name: "upper", Value: t.Upper}}
+	case goipp.Resolution:
+		units := "dpi"
+		if t.Units == goipp.UnitsDpcm {
+			units = "dpcm"
+		}
+		return Record{{Name: "x", Value: t.Xres}, {Name: "y", Value: t.Yres}, {Name: "units", Value: units}}
+	case goipp.Collection:
+		return Attributes(goipp.Attributes(t))
+	case goipp.TextWithLang:
+		return t.Text
+	case goipp.Binary:
+		if isText(t) {
+			return string(t)
+		}
+		return base64.StdEncoding.EncodeToString(t)
+	case goipp.Void:
+		return nil
+	}
+	return v.String()
+}
+
+func isText(b []byte) bool {
+	for _, c := range string(b) {
+		if c == 0xfffd || (c < 0x20 && c != '\t' && c != '\n' && c != '\r') {
+			return false
+		}
+	}
+	return true
+}
+
+// PrinterState names a printer-state enum value.
+func PrinterState(state int) string {
+	switch state {
+	case 3:
+		return "idle"
+	case 4:
+		return "processing"
+	case 5:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// JobState names a job-state enum value.
+func JobState(state int) string {
+	switch state {
+	case 3:
+		return "pending"
+	case 4:
+		return "pending-held"
+	case 5:
+		return "processing"
+	case 6:
+		return "processing-stopped"
+	case 7:
+		return "canceled"
+	case 8:
+		return "aborted"
+	case 9:
+		return "completed"
+	}
+	return "unknown"
+}
@@ -0,0 +1,106 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+func sampleWriter(format Format) *Writer {
+	attrs := goipp.Attributes{
+		goipp.MakeAttribute("printer-state", goipp.TagEnum, goipp.Integer(3)),
+		goipp.MakeAttr("printer-state-reasons", goipp.TagKeyword, goipp.String("none")),
+		goipp.MakeAttribute("printer-resolution-default", goipp.TagResolution, goipp.Resolution{Xres: 600, Yres: 600, Units: goipp.UnitsDpi}),
+	}
+	w := &Writer{Format: format}
+	w.Add("printers", Record{
+		{Name: "name", Value: "Office"},
+		{Name: "state", Value: PrinterState(3)},
+		{Name: "accepting", Value: true},
+		{Name: "state_reasons", Value: []string{"none", "toner-low"}},
+		{Name: "state_change_time", Value: Time(0)},
+		{Name: "attributes", Value: Attributes(attrs)},
+	})
+	w.Add("jobs")
+	return w
+}
+
+func TestJSONKeepsOrderAndVersion(t *testing.T) {
+	var out bytes.Buffer
+	if err := sampleWriter(FormatJSON).Flush(&out); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	var doc struct {
+		Version  int `json:"version"`
+		Printers []struct {
+			Name       string           `json:"name"`
+			Attributes map[string][]any `json:"attributes"`
+		} `json:"printers"`
+		Jobs []any `json:"jobs"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &doc); err != nil {
+		t.Fatalf("decode %s: %v", out.String(), err)
+	}
+	if doc.Version != SchemaVersion || len(doc.Printers) != 1 || doc.Jobs == nil {
+		t.Fatalf("unexpected document %s", out.String())
+	}
+	if v := doc.Printers[0].Attributes["printer-state"]; len(v) != 1 || v[0] != float64(3) {
+		t.Fatalf("printer-state = %v", v)
+	}
+	if bytes.Index(out.Bytes(), []byte(`"name"`)) > bytes.Index(out.Bytes(), []byte(`"state"`)) {
+		t.Fatalf("field order lost: %s", out.String())
+	}
+}
+
+func TestYAMLAndCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := sampleWriter(FormatYAML).Flush(&out); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	want := `version: 1
+printers:
+  - name: Office
+    state: idle
+    accepting: true
+    state_reasons:
+      - none
+      - toner-low
+    state_change_time: null
+    attributes:
+      printer-state:
+        - 3
+      printer-state-reasons:
+        - none
+      printer-resolution-default:
+        - x: 600
+          y: 600
+          units: dpi
+jobs: []
+`
+	if out.String() != want {
+		t.Fatalf("yaml:\n%s\nwant:\n%s", out.String(), want)
+	}
+
+	out.Reset()
+	if err := sampleWriter(FormatCSV).Flush(&out); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	want = "name,state,accepting,state_reasons,state_change_time,attributes\n" +
+		`Office,idle,true,"none,toner-low",,"{""printer-state"":[3],""printer-state-reasons"":[""none""],""printer-resolution-default"":[{""x"":600,""y"":600,""units"":""dpi""}]}"` + "\n\n"
+	if out.String() != want {
+		t.Fatalf("csv:\n%q\nwant:\n%q", out.String(), want)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for in, want := range map[string]Format{"": FormatText, "JSON": FormatJSON, "yml": FormatYAML, "csv": FormatCSV} {
+		if got, err := ParseFormat(in); err != nil || got != want {
+			t.Errorf("ParseFormat(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Fatalf("expected an error for xml")
+	}
+}
@@ -0,0 +1,43 @@
+package report
+
+import (
+	"io"
+
+	"cupsgolang/internal/yamlenc"
+)
+
+func writeYAML(out io.Writer, sections []Section) error {
+	return yamlenc.Write(out, yamlValue(document(sections)))
+}
+
+// yamlValue converts records and lists to the yamlenc types; scalars pass
+// through.
+func yamlValue(v any) any {
+	switch t := v.(type) {
+	case Record:
+		m := make(yamlenc.Map, len(t))
+		for i, f := range t {
+			m[i] = yamlenc.Field{Key: f.Name, Value: yamlValue(f.Value)}
+		}
+		return m
+	case []Record:
+		items := make([]any, len(t))
+		for i, r := range t {
+			items[i] = yamlValue(r)
+		}
+		return items
+	case []string:
+		items := make([]any, len(t))
+		for i, s := range t {
+			items[i] = s
+		}
+		return items
+	case []any:
+		items := make([]any, len(t))
+		for i, item := range t {
+			items[i] = yamlValue(item)
+		}
+		return items
+	}
+	return v
+}
@@ -63,7 +63,7 @@ func TestRunFilterPipelineReturnsErrorWhenFilterExecutionFails(t *testing.T) {
 	}
 
 	job := model.Job{
-		ID:      42,
+		ID:       42,
 		UserName: "alice",
 		Name:     "doc",
 	}
@@ -78,7 +78,7 @@ func TestRunFilterPipelineReturnsErrorWhenFilterExecutionFails(t *testing.T) {
 		Path:     inPath,
 	}
 
-	_, err := s.runFilterPipeline(job, printer, doc, outPath)
+	_, err := s.runFilterPipeline(context.Background(), job, printer, doc, outPath)
 	if err == nil {
 		t.Fatalf("expected filter pipeline error, got nil")
 	}
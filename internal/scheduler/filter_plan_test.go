@@ -0,0 +1,66 @@
+package scheduler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/model"
+)
+
+func writeScript(t *testing.T, dir, name, body string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestPlanAndRunFiltersThroughPPDChain(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	upper := writeScript(t, dir, "upper", `tr a-z A-Z < "${6:-/dev/stdin}"`)
+	wrap := writeScript(t, dir, "wrap", `printf '[%s|%s]' "$(cat)" "$FINAL_CONTENT_TYPE"`)
+	ppd := "*PPD-Adobe: \"4.3\"\n*cupsFilter2: \"application/vnd.test-upper application/vnd.test-printer 10 " + wrap + "\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "Office.ppd"), []byte(ppd), 0o644); err != nil {
+		t.Fatalf("write ppd: %v", err)
+	}
+	in := filepath.Join(dir, "in.txt")
+	os.WriteFile(in, []byte("hello"), 0o644)
+
+	mime := &config.MimeDB{Convs: []config.MimeConv{
+		{Source: "text/plain", Dest: "application/vnd.test-upper", Cost: 20, Program: upper},
+		{Source: "text/plain", Dest: "application/pdf", Cost: 50, Program: "texttopdf"},
+	}}
+	cfg := config.Config{PPDDir: dir}
+	printer := model.Printer{Name: "Office", PPDName: "Office.ppd"}
+	doc := model.Document{FileName: "in.txt", MimeType: "text/plain", Path: in}
+
+	plan := PlanFilters(mime, cfg, model.Job{}, printer, doc, "")
+	if plan.Final != "application/vnd.test-printer" || len(plan.Convs) != 2 || plan.Cost() != 30 {
+		t.Fatalf("unexpected plan: %+v", plan)
+	}
+	var out bytes.Buffer
+	if err := RunFilters(context.Background(), cfg, plan, model.Job{ID: 1}, printer, doc, &out, os.Stderr); err != nil {
+		t.Fatalf("RunFilters: %v", err)
+	}
+	if out.String() != "[HELLO|application/vnd.test-printer]" {
+		t.Fatalf("output = %q", out.String())
+	}
+
+	// An explicit destination ignores the printer's types.
+	plan = PlanFilters(mime, cfg, model.Job{}, printer, doc, "application/pdf")
+	if plan.Final != "application/pdf" || len(plan.Convs) != 1 || plan.Convs[0].Program != "texttopdf" {
+		t.Fatalf("unexpected plan for application/pdf: %+v", plan)
+	}
+	if plan = PlanFilters(mime, cfg, model.Job{}, printer, doc, "image/png"); len(plan.Convs) != 0 {
+		t.Fatalf("expected no chain to image/png, got %+v", plan)
+	}
+}
@@ -2,7 +2,6 @@ package scheduler
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,25 +12,56 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"cupsgolang/internal/backend"
 	"cupsgolang/internal/config"
 	"cupsgolang/internal/logging"
+	"cupsgolang/internal/metrics"
 	"cupsgolang/internal/model"
 	"cupsgolang/internal/spool"
 	"cupsgolang/internal/store"
 )
 
 type Scheduler struct {
-	Store    *store.Store
+	Store    store.Repository
 	Spool    spool.Spool
 	Interval time.Duration
 	StopChan chan struct{}
-	Mime     *config.MimeDB
-	Config   config.Config
+	// Mime and Config are the startup settings; Reload swaps in newer ones.
+	Mime   *config.MimeDB
+	Config config.Config
 
 	lastTempCleanup time.Time
+	runtime         atomic.Pointer[runtimeConfig]
+}
+
+type runtimeConfig struct {
+	cfg  config.Config
+	mime *config.MimeDB
+}
+
+// Reload replaces the configuration and MIME database used for jobs started
+// from now on. Filters and backends already running keep what they were
+// started with.
+func (s *Scheduler) Reload(cfg config.Config, mime *config.MimeDB) {
+	s.runtime.Store(&runtimeConfig{cfg: cfg, mime: mime})
+}
+
+func (s *Scheduler) currentConfig() config.Config {
+	if rc := s.runtime.Load(); rc != nil {
+		return rc.cfg
+	}
+	return s.Config
+}
+
+func (s *Scheduler) currentMime() *config.MimeDB {
+	if rc := s.runtime.Load(); rc != nil {
+		return rc.mime
+	}
+	return s.Mime
 }
 
 var errFilterPipeline = errors.New("filter-pipeline-failed")
@@ -75,7 +105,7 @@ func (s *Scheduler) processOnce(ctx context.Context) {
 	historySecs, filesSecs := s.preserveIntervals(ctx)
 
 	var jobs []model.Job
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		jobs, err = s.Store.ListPendingJobs(ctx, tx, 50)
 		return err
@@ -101,21 +131,22 @@ func (s *Scheduler) processOnce(ctx context.Context) {
 	for _, candidate := range candidates {
 		job := candidate.job
 		opts := candidate.options
-		if shouldCancelJob(job, opts, now, s.Config.MaxJobTime) {
-			_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		if shouldCancelJob(job, opts, now, s.currentConfig().MaxJobTime) {
+			logging.Logger().Log(ctx, logging.LevelNotice, "Canceling job that exceeded its time limit", "job-id", job.ID)
+			_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 				completed := time.Now().UTC()
 				return s.Store.UpdateJobState(ctx, tx, job.ID, 7, "job-canceled-at-device", &completed)
 			})
 			continue
 		}
 		if holdReason := shouldHoldJob(job, opts, now); holdReason != "" {
-			_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+			_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 				return s.Store.UpdateJobState(ctx, tx, job.ID, 4, holdReason, nil)
 			})
 			continue
 		}
 		claimed := false
-		_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			var err error
 			claimed, err = s.Store.ClaimPendingJob(ctx, tx, job.ID)
 			return err
@@ -126,7 +157,7 @@ func (s *Scheduler) processOnce(ctx context.Context) {
 
 		var docs []model.Document
 		var printer model.Printer
-		_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			var err error
 			docs, err = s.Store.ListDocumentsByJob(ctx, tx, job.ID)
 			if err != nil {
@@ -136,12 +167,16 @@ func (s *Scheduler) processOnce(ctx context.Context) {
 			return err
 		})
 
+		jobLog := logging.Logger().With("job-id", job.ID, "printer", printer.Name)
+		jobLog.Debug("Processing job", "user", job.UserName, "documents", len(docs))
+
 		failed := false
 		failReason := "document-unprintable-error"
 		docList, err := s.buildJobDocuments(ctx, job, printer, docs)
 		if err != nil {
 			failed = true
 			failReason = "document-unprintable-error"
+			jobLog.Error("Unable to build job documents", "err", err)
 		}
 		for _, doc := range docList {
 			outPath := s.Spool.OutputPath(job.ID, doc.FileName)
@@ -151,13 +186,14 @@ func (s *Scheduler) processOnce(ctx context.Context) {
 			if err := s.processDocument(ctx, job, printer, doc, outPath); err != nil {
 				failed = true
 				failReason = failureReasonForError(err)
+				jobLog.Error("Document processing failed", "document", doc.FileName, "reason", failReason, "err", err)
 				break
 			}
 		}
 
 		finalState := 0
 		pageResult := ""
-		err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			if failed {
 				if handled, err := s.applyErrorPolicy(ctx, tx, job, printer, opts, failReason); err != nil {
 					return err
@@ -187,6 +223,15 @@ func (s *Scheduler) processOnce(ctx context.Context) {
 			pageResult = "ok"
 			return nil
 		})
+		if err != nil {
+			jobLog.Error("Unable to update job state", "err", err)
+		} else if failed {
+			jobLog.Warn("Job stopped", "reason", failReason, "state", finalState)
+			metrics.JobOutcomes.Inc(printer.Name, failReason)
+		} else {
+			jobLog.Info("Job completed")
+			metrics.JobOutcomes.Inc(printer.Name, "job-completed-successfully")
+		}
 		if err == nil && finalState != 0 {
 			copies := optionInt(opts, "copies")
 			logging.Page(logging.PageLogLine(logging.PageLogEntry{
@@ -205,7 +250,7 @@ func (s *Scheduler) processOnce(ctx context.Context) {
 				},
 			}))
 		}
-		_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			details := map[string]string{
 				"printer": printer.Name,
 				"result":  pageResult,
@@ -235,7 +280,7 @@ type jobCandidate struct {
 
 func (s *Scheduler) releaseHeldJobs(ctx context.Context) {
 	var jobs []model.Job
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		jobs, err = s.Store.ListHeldJobs(ctx, tx, 50)
 		return err
@@ -244,10 +289,11 @@ func (s *Scheduler) releaseHeldJobs(ctx context.Context) {
 		return
 	}
 	now := time.Now()
+	maxHold := time.Duration(s.currentConfig().MaxHoldTime) * time.Second
 	for _, job := range jobs {
 		opts := parseOptionsJSON(job.Options)
-		if shouldCancelJob(job, opts, now, s.Config.MaxJobTime) {
-			_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		if shouldCancelJob(job, opts, now, s.currentConfig().MaxJobTime) || maxHold > 0 && now.Sub(job.SubmittedAt) > maxHold {
+			_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 				completed := time.Now().UTC()
 				return s.Store.UpdateJobState(ctx, tx, job.ID, 7, "job-canceled-at-device", &completed)
 			})
@@ -269,7 +315,7 @@ func (s *Scheduler) releaseHeldJobs(ctx context.Context) {
 				optionsJSON = string(b)
 			}
 		}
-		_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			if optionsJSON != job.Options {
 				if err := s.Store.UpdateJobAttributes(ctx, tx, job.ID, nil, &optionsJSON); err != nil {
 					return err
@@ -280,7 +326,7 @@ func (s *Scheduler) releaseHeldJobs(ctx context.Context) {
 	}
 }
 
-func (s *Scheduler) scheduleRetry(ctx context.Context, tx *sql.Tx, job model.Job, opts map[string]string) (bool, error) {
+func (s *Scheduler) scheduleRetry(ctx context.Context, tx store.Tx, job model.Job, opts map[string]string) (bool, error) {
 	retries := optionInt(opts, "number-of-retries")
 	if retries <= 0 {
 		return false, nil
@@ -326,7 +372,7 @@ const (
 	defaultJobRetryInterval = 300
 )
 
-func (s *Scheduler) applyErrorPolicy(ctx context.Context, tx *sql.Tx, job model.Job, printer model.Printer, opts map[string]string, reason string) (bool, error) {
+func (s *Scheduler) applyErrorPolicy(ctx context.Context, tx store.Tx, job model.Job, printer model.Printer, opts map[string]string, reason string) (bool, error) {
 	if reason != "job-stopped" {
 		return false, nil
 	}
@@ -368,26 +414,26 @@ func (s *Scheduler) errorPolicyForJob(printer model.Printer, opts map[string]str
 		return v
 	}
 	if s != nil {
-		if v := normalizeErrorPolicy(s.Config.ErrorPolicy); v != "" {
+		if v := normalizeErrorPolicy(s.currentConfig().ErrorPolicy); v != "" {
 			return v
 		}
 	}
 	return "stop-printer"
 }
 
-func (s *Scheduler) retryJobPolicy(ctx context.Context, tx *sql.Tx, job model.Job, opts map[string]string) error {
+func (s *Scheduler) retryJobPolicy(ctx context.Context, tx store.Tx, job model.Job, opts map[string]string) error {
 	limit := optionInt(opts, "cups-retry-limit")
 	if limit <= 0 {
-		if s != nil && s.Config.JobRetryLimit > 0 {
-			limit = s.Config.JobRetryLimit
+		if s != nil && s.currentConfig().JobRetryLimit > 0 {
+			limit = s.currentConfig().JobRetryLimit
 		} else {
 			limit = defaultJobRetryLimit
 		}
 	}
 	interval := optionInt(opts, "cups-retry-interval")
 	if interval <= 0 {
-		if s != nil && s.Config.JobRetryInterval > 0 {
-			interval = s.Config.JobRetryInterval
+		if s != nil && s.currentConfig().JobRetryInterval > 0 {
+			interval = s.currentConfig().JobRetryInterval
 		} else {
 			interval = defaultJobRetryInterval
 		}
@@ -494,7 +540,7 @@ func (s *Scheduler) loadBannerTemplate(banner string) (string, bool) {
 	if name == "" || name == "none" {
 		return "", false
 	}
-	baseDir := filepath.Join(s.Config.DataDir, "banners")
+	baseDir := filepath.Join(s.currentConfig().DataDir, "banners")
 	lang := strings.TrimSpace(os.Getenv("CUPS_LANG"))
 	if lang == "" {
 		lang = strings.TrimSpace(os.Getenv("LANG"))
@@ -588,12 +634,13 @@ func copyFile(src, dst string) error {
 }
 
 func (s *Scheduler) processDocument(ctx context.Context, job model.Job, printer model.Printer, doc model.Document, outPath string) error {
-	docMime := resolveDocMime(s.Mime, doc)
+	mime := s.currentMime()
+	docMime := resolveDocMime(mime, doc)
 	if docMime == "" {
 		docMime = "application/octet-stream"
 	}
 	doc.MimeType = docMime
-	if s.Mime == nil {
+	if mime == nil {
 		if err := copyFile(doc.Path, outPath); err != nil {
 			return err
 		}
@@ -605,7 +652,9 @@ func (s *Scheduler) processDocument(ctx context.Context, job model.Job, printer
 		}
 		return s.submitToBackend(ctx, printer, job, doc, outPath)
 	}
-	finalType, err := s.runFilterPipeline(job, printer, doc, outPath)
+	filterStart := time.Now()
+	finalType, err := s.runFilterPipeline(ctx, job, printer, doc, outPath)
+	metrics.FilterDuration.ObserveSince(filterStart, printer.Name)
 	if err != nil {
 		return err
 	}
@@ -615,17 +664,76 @@ func (s *Scheduler) processDocument(ctx context.Context, job model.Job, printer
 	return s.submitToBackend(ctx, printer, job, doc, outPath)
 }
 
-func (s *Scheduler) runFilterPipeline(job model.Job, printer model.Printer, doc model.Document, outPath string) (string, error) {
-	if s.Mime == nil {
+// runFilterPipeline runs the filters converting doc into outPath. When ctx
+// ends the filters are sent SIGTERM and killed JobKillDelay seconds later.
+func (s *Scheduler) runFilterPipeline(ctx context.Context, job model.Job, printer model.Printer, doc model.Document, outPath string) (string, error) {
+	mime, cfg := s.currentMime(), s.currentConfig()
+	if mime == nil {
 		return doc.MimeType, copyFile(doc.Path, outPath)
 	}
+	plan := PlanFilters(mime, cfg, job, printer, doc, "")
+	if len(plan.Programs()) == 0 {
+		return plan.Source, copyFile(doc.Path, outPath)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return plan.Source, err
+	}
+	out, err := os.Create(outPath)
+	if err != nil {
+		return plan.Source, err
+	}
+	defer out.Close()
+	if err := RunFilters(ctx, cfg, plan, job, printer, doc, out, os.Stderr); err != nil {
+		return plan.Source, err
+	}
+	return plan.Final, out.Sync()
+}
+
+// FilterPlan is the filter chain chosen for a document.
+type FilterPlan struct {
+	// Source is the document type the chain starts from.
+	Source string
+	// Final is the type the chain produces, passed to the filters as
+	// FINAL_CONTENT_TYPE.
+	Final string
+	// Convs are the conversions in order; an empty chain means the
+	// document goes to the backend as is.
+	Convs []config.MimeConv
+}
+
+// Cost is the total cost of the chain.
+func (p FilterPlan) Cost() int {
+	return pipelineCost(p.Convs)
+}
+
+// Programs returns the command lines of the filters to run, skipping the
+// "-" pass-through conversions.
+func (p FilterPlan) Programs() [][]string {
+	cmds := make([][]string, 0, len(p.Convs))
+	for _, conv := range p.Convs {
+		if strings.TrimSpace(conv.Program) == "-" {
+			continue
+		}
+		if parts := strings.Fields(conv.Program); len(parts) > 0 {
+			cmds = append(cmds, parts)
+		}
+	}
+	return cmds
+}
+
+// PlanFilters chooses the filters for doc on printer the way jobs do: the
+// conversions in mime plus the cupsFilter/cupsFilter2 lines of the
+// printer's PPD, cheapest first. dest, when set, replaces the printer's
+// destination types with a single MIME type.
+func PlanFilters(mime *config.MimeDB, cfg config.Config, job model.Job, printer model.Printer, doc model.Document, dest string) FilterPlan {
 	docMime := strings.TrimSpace(doc.MimeType)
 	if docMime == "" {
 		docMime = "application/octet-stream"
 	}
+	plan := FilterPlan{Source: docMime, Final: docMime}
 
-	ppdPath := ppdPathForPrinter(s.Config, printer)
-	ppd, _ := config.LoadPPD(ppdPath)
+	ppd, _ := config.LoadPPD(ppdPathForPrinter(cfg, printer))
 	extra := []config.MimeConv{}
 	destSet := map[string]bool{}
 	hasFilter2 := false
@@ -637,62 +745,57 @@ func (s *Scheduler) runFilterPipeline(job model.Job, printer model.Printer, doc
 			}
 		}
 		for _, f := range ppd.Filters {
-			dest := strings.TrimSpace(f.Dest)
-			if hasFilter2 && dest == "" {
+			fdest := strings.TrimSpace(f.Dest)
+			if (hasFilter2 || dest != "") && fdest == "" {
+				// Old-style cupsFilter lines end at the printer, which
+				// is not a MIME type an explicit dest can name.
 				continue
 			}
-			if dest != "" {
-				destSet[dest] = true
+			if fdest != "" {
+				destSet[fdest] = true
 			}
 			extra = append(extra, config.MimeConv{
 				Source:  f.Source,
-				Dest:    dest,
+				Dest:    fdest,
 				Cost:    f.Cost,
 				Program: f.Program,
 			})
 		}
 	}
 
-	convs, finalType := selectFilterPipeline(s.Mime, docMime, extra, destSet, isTruthy(getJobOption(job.Options, "print-as-raster")))
-	if len(convs) == 0 {
-		return docMime, copyFile(doc.Path, outPath)
+	var convs []config.MimeConv
+	finalType := ""
+	if dest != "" {
+		convs, finalType = findFilterPipeline(mime, docMime, dest, extra), dest
+	} else {
+		convs, finalType = selectFilterPipeline(mime, docMime, extra, destSet, isTruthy(getJobOption(job.Options, "print-as-raster")))
 	}
-	cmds := make([][]string, 0, len(convs))
-	for _, conv := range convs {
-		if conv.Program == "" {
-			continue
-		}
-		if strings.TrimSpace(conv.Program) == "-" {
-			continue
-		}
-		parts := strings.Fields(conv.Program)
-		if len(parts) == 0 {
-			continue
-		}
-		cmds = append(cmds, parts)
+	if len(convs) == 0 {
+		return plan
 	}
-	if len(cmds) == 0 {
-		return docMime, copyFile(doc.Path, outPath)
+	plan.Convs = convs
+	if finalType != "" {
+		plan.Final = finalType
 	}
+	return plan
+}
 
-	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
-		return docMime, err
-	}
+// RunFilters runs the filters of plan on doc.Path, writing the result to out
+// and the filters' messages to stderr. The first filter gets the file name
+// argument, the others read their standard input, as in CUPS.
+func RunFilters(ctx context.Context, cfg config.Config, plan FilterPlan, job model.Job, printer model.Printer, doc model.Document, out, stderr io.Writer) error {
+	cmds := plan.Programs()
 	in, err := os.Open(doc.Path)
 	if err != nil {
-		return docMime, err
+		return err
 	}
 	defer in.Close()
-	out, err := os.Create(outPath)
-	if err != nil {
-		return docMime, err
-	}
-	defer out.Close()
-
-	if finalType == "" {
-		finalType = docMime
+	if len(cmds) == 0 {
+		_, err := io.Copy(out, in)
+		return err
 	}
-	env := buildFilterEnv(job, printer, doc, s.Config, finalType)
+	doc.MimeType = plan.Source
+	env := buildFilterEnv(job, printer, doc, cfg, plan.Final)
 	filterArgs := func(includeFile bool) []string {
 		user := strings.TrimSpace(job.UserName)
 		if user == "" {
@@ -723,38 +826,58 @@ func (s *Scheduler) runFilterPipeline(job model.Job, printer model.Printer, doc
 		}
 		return args
 	}
+	// Filters are joined with OS pipes; the parent closes its copies once
+	// both ends are started so each filter sees EOF when the previous one
+	// exits.
 	var prev io.Reader = in
+	var prevPipe *os.File
+	defer func() {
+		if prevPipe != nil {
+			prevPipe.Close()
+		}
+	}()
 	cmdsRun := make([]*exec.Cmd, 0, len(cmds))
-	pipeClosers := make([]io.Closer, 0, len(cmds))
 	for i, parts := range cmds {
 		args := append([]string{}, parts[1:]...)
 		args = append(args, filterArgs(i == 0)...)
-		cmd := exec.Command(parts[0], args...)
+		cmd := exec.CommandContext(ctx, parts[0], args...)
+		cmd.Cancel = func() error { return cmd.Process.Signal(syscall.SIGTERM) }
+		cmd.WaitDelay = time.Duration(cfg.JobKillDelay) * time.Second
 		cmd.Env = env
 		cmd.Stdin = prev
+		cmd.Stderr = stderr
+		var pipeR, pipeW *os.File
 		if i == len(cmds)-1 {
 			cmd.Stdout = out
 		} else {
-			pipeR, pipeW := io.Pipe()
+			if pipeR, pipeW, err = os.Pipe(); err != nil {
+				return fmt.Errorf("%w: %v", errFilterPipeline, err)
+			}
 			cmd.Stdout = pipeW
-			prev = pipeR
-			pipeClosers = append(pipeClosers, pipeW)
 		}
-		cmd.Stderr = os.Stderr
-		if err := cmd.Start(); err != nil {
-			return docMime, fmt.Errorf("%w: %v", errFilterPipeline, err)
+		err := cmd.Start()
+		if pipeW != nil {
+			pipeW.Close()
 		}
-		cmdsRun = append(cmdsRun, cmd)
-		if i < len(pipeClosers) {
-			_ = pipeClosers[i].Close()
+		if prevPipe != nil {
+			prevPipe.Close()
 		}
+		prev, prevPipe = pipeR, pipeR
+		if err != nil {
+			for _, started := range cmdsRun {
+				_ = started.Process.Kill()
+				_ = started.Wait()
+			}
+			return fmt.Errorf("%w: %v", errFilterPipeline, err)
+		}
+		cmdsRun = append(cmdsRun, cmd)
 	}
 	for _, cmd := range cmdsRun {
 		if err := cmd.Wait(); err != nil {
-			return docMime, fmt.Errorf("%w: %v", errFilterPipeline, err)
+			return fmt.Errorf("%w: %v", errFilterPipeline, err)
 		}
 	}
-	return finalType, out.Sync()
+	return nil
 }
 
 func (s *Scheduler) submitToBackend(ctx context.Context, printer model.Printer, job model.Job, doc model.Document, outPath string) error {
@@ -765,7 +888,18 @@ func (s *Scheduler) submitToBackend(ctx context.Context, printer model.Printer,
 	if b == nil {
 		return backend.ErrUnsupported
 	}
-	return b.SubmitJob(ctx, printer, job, doc, outPath)
+	start := time.Now()
+	err := b.SubmitJob(ctx, printer, job, doc, outPath)
+	metrics.BackendDuration.ObserveSince(start, printer.Name, uriScheme(printer.URI))
+	return err
+}
+
+func uriScheme(uri string) string {
+	scheme, _, found := strings.Cut(strings.TrimSpace(uri), ":")
+	if !found {
+		return ""
+	}
+	return strings.ToLower(scheme)
 }
 
 func failureReasonForError(err error) string {
@@ -805,7 +939,11 @@ func buildFilterEnv(job model.Job, printer model.Printer, doc model.Document, cf
 	if finalType == "" {
 		finalType = fileType
 	}
-	return append(os.Environ(),
+	tmpDir := cfg.TempDir
+	if tmpDir == "" {
+		tmpDir = os.TempDir()
+	}
+	env := append(os.Environ(),
 		"LANG=en_US.UTF-8",
 		"LC_ALL=en_US.UTF-8",
 		"CHARSET=utf-8",
@@ -826,11 +964,15 @@ func buildFilterEnv(job model.Job, printer model.Printer, doc model.Document, cf
 		"PRINTER_LOCATION="+printer.Location,
 		"PPD="+ppdPath,
 		"CUPS_PPD="+ppdPath,
-		"TMPDIR="+os.TempDir(),
+		"TMPDIR="+tmpDir,
 		"CUPS_SERVERROOT="+cfg.ConfDir,
 		"CUPS_DATADIR="+cfg.DataDir,
 		"CUPS_STATEDIR="+cfg.DataDir,
 	)
+	if cfg.RIPCache != "" {
+		env = append(env, "RIP_MAX_CACHE="+cfg.RIPCache)
+	}
+	return append(env, cfg.SetEnv...)
 }
 
 func ppdPathForPrinter(cfg config.Config, printer model.Printer) string {
@@ -1152,17 +1294,25 @@ func (s *Scheduler) preserveIntervals(ctx context.Context) (historySecs int, fil
 	if s == nil || s.Store == nil {
 		return intMax(), defaultFilesSecs
 	}
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		settings, err = s.Store.ListSettings(ctx, tx)
 		return err
 	})
 
+	// Settings made with cupsctl or the web interface override cupsd.conf.
+	cfg := s.currentConfig()
 	historyVal := firstSetting(settings, "PreserveJobHistory", "_preserve_job_history", "preserve_job_history")
+	if strings.TrimSpace(historyVal) == "" {
+		historyVal = cfg.PreserveJobHistory
+	}
 	if strings.TrimSpace(historyVal) == "" {
 		historyVal = "Yes"
 	}
 	filesVal := firstSetting(settings, "PreserveJobFiles", "_preserve_job_files", "preserve_job_files")
+	if strings.TrimSpace(filesVal) == "" {
+		filesVal = cfg.PreserveJobFiles
+	}
 	if strings.TrimSpace(filesVal) == "" {
 		filesVal = "1d"
 	}
@@ -1192,7 +1342,7 @@ func (s *Scheduler) cleanTerminalJobs(ctx context.Context, historySecs int, file
 
 	// Decide which terminal jobs need cleanup. We do the decisions inside a
 	// consistent read transaction and then do file IO + deletes outside.
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		jobs, err := s.Store.ListTerminalJobs(ctx, tx, 200)
 		if err != nil {
 			return err
@@ -1255,7 +1405,7 @@ func (s *Scheduler) cleanTerminalJobs(ctx context.Context, historySecs int, file
 		}
 	}
 
-	_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		for _, c := range cleanups {
 			if c.deleteJob {
 				if err := s.Store.DeleteJob(ctx, tx, c.id); err != nil {
@@ -1296,7 +1446,7 @@ func (s *Scheduler) cleanupTemporaryPrinters(ctx context.Context, force bool) {
 	cleanups := []cleanupPrinter{}
 	var candidates []model.Printer
 
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		candidates, err = s.Store.ListTemporaryPrinters(ctx, tx, force, unusedBefore, 100)
 		if err != nil {
@@ -1329,7 +1479,7 @@ func (s *Scheduler) cleanupTemporaryPrinters(ctx context.Context, force bool) {
 			if ppdName := strings.TrimSpace(p.PPDName); ppdName != "" && !strings.EqualFold(ppdName, model.DefaultPPDName) {
 				base := filepath.Base(ppdName)
 				if strings.EqualFold(base, p.Name+".ppd") {
-					ppdPath = filepath.Join(s.Config.PPDDir, base)
+					ppdPath = filepath.Join(s.currentConfig().PPDDir, base)
 				}
 			}
 			cleanups = append(cleanups, cleanupPrinter{printerID: p.ID, docPaths: docPaths, outPaths: outPaths, ppdPath: ppdPath})
@@ -1354,7 +1504,7 @@ func (s *Scheduler) cleanupTemporaryPrinters(ctx context.Context, force bool) {
 		}
 	}
 
-	_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		for _, candidate := range candidates {
 			p, err := s.Store.GetPrinterByID(ctx, tx, candidate.ID)
 			if err != nil {
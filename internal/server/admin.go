@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -19,6 +18,7 @@ import (
 	"cupsgolang/internal/config"
 	"cupsgolang/internal/model"
 	"cupsgolang/internal/spool"
+	"cupsgolang/internal/store"
 	"cupsgolang/internal/web"
 )
 
@@ -33,6 +33,13 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 	case http.MethodPost:
 		r.ParseForm()
 		op := r.FormValue("OP")
+		if webAdminAuditOps[op] {
+			target := auditTarget{name: firstNonEmpty(r.FormValue("PRINTER_NAME"), r.FormValue("printer_name"))}
+			if op == "config-server" {
+				target = auditTarget{}
+			}
+			defer s.beginAudit(r, authUserFromRequest(r), "web:"+op, target)(false)
+		}
 		switch op {
 		case "config-server":
 			if r.FormValue("CHANGESETTINGS") != "" {
@@ -199,6 +206,25 @@ func (s *Server) handleAdmin(w http.ResponseWriter, r *http.Request) {
 				"printer_name": r.FormValue("PRINTER_NAME"),
 			}, nil)
 			return
+		case "set-job-presets":
+			name := r.FormValue("printer_name")
+			if name == "" {
+				web.RenderAdmin(w, r, s.Store, "error.tmpl", map[string]string{"error": "missing printer name"}, nil)
+				return
+			}
+			if err := s.renderJobPresets(w, r, name, r.FormValue("IS_CLASS") != ""); err != nil {
+				web.RenderAdmin(w, r, s.Store, "error.tmpl", map[string]string{"error": err.Error()}, nil)
+			}
+			return
+		case "set-job-presets-confirm":
+			if err := s.applyJobPresetsFromForm(r); err != nil {
+				web.RenderAdmin(w, r, s.Store, "error.tmpl", map[string]string{"error": err.Error()}, nil)
+				return
+			}
+			web.RenderAdmin(w, r, s.Store, "printer-modified.tmpl", map[string]string{
+				"printer_name": r.FormValue("PRINTER_NAME"),
+			}, nil)
+			return
 		case "delete-printer":
 			name := r.FormValue("printer_name")
 			if name == "" {
@@ -239,6 +265,9 @@ func (s *Server) handlePrinterPost(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	op := r.FormValue("OP")
 	name := path.Base(r.URL.Path)
+	if op != "" && op != "print-test-page" {
+		defer s.beginAudit(r, authUserFromRequest(r), "web:"+op, auditTarget{name: name})(false)
+	}
 	switch op {
 	case "print-test-page":
 		_ = s.printTestPage(r, name)
@@ -267,6 +296,9 @@ func (s *Server) handleClassPost(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	op := r.FormValue("OP")
 	name := path.Base(r.URL.Path)
+	if op != "" && op != "print-test-page" {
+		defer s.beginAudit(r, authUserFromRequest(r), "web:"+op, auditTarget{name: name})(false)
+	}
 	switch op {
 	case "print-test-page":
 		_ = s.printTestPageForClass(r, name)
@@ -293,6 +325,9 @@ func (s *Server) handleJobsPost(w http.ResponseWriter, r *http.Request) {
 	r.ParseForm()
 	op := r.FormValue("OP")
 	jobID, _ := strconv.ParseInt(r.FormValue("job_id"), 10, 64)
+	if op != "" && jobID > 0 {
+		defer s.beginAudit(r, authUserFromRequest(r), "web:"+op, auditTarget{jobID: jobID})(false)
+	}
 	switch op {
 	case "cancel-job":
 		s.cancelJob(r, jobID)
@@ -317,7 +352,7 @@ func (s *Server) createPrinterFromForm(r *http.Request) error {
 	}
 	ppdName := strings.TrimSpace(firstNonEmpty(r.FormValue("PPD_NAME"), r.FormValue("ppd_name")))
 	shared := r.FormValue("PRINTER_IS_SHARED") != ""
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		_, err := s.Store.CreatePrinter(r.Context(), tx, name, uri, loc, info, ppdName, true, false, shared, "none", "")
 		if err != nil {
 			return err
@@ -335,7 +370,7 @@ func (s *Server) createClassFromForm(r *http.Request) error {
 	loc := r.FormValue("PRINTER_LOCATION")
 	memberURIs := r.Form["MEMBER_URIS"]
 
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		memberIDs := make([]int64, 0, len(memberURIs))
 		for _, uri := range memberURIs {
 			printerName := path.Base(uri)
@@ -361,7 +396,7 @@ func (s *Server) deletePrinterByName(r *http.Request, name string) error {
 	ppdToRemove := ""
 
 	// Gather file paths first so we can delete them even though DB deletes cascade.
-	if err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	if err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.GetPrinterByName(ctx, tx, name)
 		if err != nil {
@@ -406,10 +441,10 @@ func (s *Server) deletePrinterByName(r *http.Request, name string) error {
 		_ = os.Remove(p)
 	}
 	if ppdToRemove != "" {
-		_ = os.Remove(safePPDPath(s.Config.PPDDir, ppdToRemove))
+		_ = os.Remove(safePPDPath(s.currentConfig().PPDDir, ppdToRemove))
 	}
 
-	return s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		// Re-check the printer still exists before deleting.
 		p, err := s.Store.GetPrinterByID(ctx, tx, printer.ID)
 		if err != nil {
@@ -420,7 +455,7 @@ func (s *Server) deletePrinterByName(r *http.Request, name string) error {
 }
 
 func (s *Server) deleteClassByName(r *http.Request, name string) error {
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		c, err := s.Store.GetClassByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -430,7 +465,7 @@ func (s *Server) deleteClassByName(r *http.Request, name string) error {
 }
 
 func (s *Server) updatePrinterAccepting(r *http.Request, name string, accepting bool) {
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		p, err := s.Store.GetPrinterByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -440,7 +475,7 @@ func (s *Server) updatePrinterAccepting(r *http.Request, name string, accepting
 }
 
 func (s *Server) updatePrinterState(r *http.Request, name string, state int) {
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		p, err := s.Store.GetPrinterByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -450,7 +485,7 @@ func (s *Server) updatePrinterState(r *http.Request, name string, state int) {
 }
 
 func (s *Server) setDefaultPrinter(r *http.Request, name string) {
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		p, err := s.Store.GetPrinterByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -460,7 +495,7 @@ func (s *Server) setDefaultPrinter(r *http.Request, name string) {
 }
 
 func (s *Server) setDefaultClass(r *http.Request, name string) {
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		c, err := s.Store.GetClassByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -470,7 +505,7 @@ func (s *Server) setDefaultClass(r *http.Request, name string) {
 }
 
 func (s *Server) cancelJobs(r *http.Request, name string) {
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		p, err := s.Store.GetPrinterByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -480,7 +515,7 @@ func (s *Server) cancelJobs(r *http.Request, name string) {
 }
 
 func (s *Server) updateClassAccepting(r *http.Request, name string, accepting bool) {
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		c, err := s.Store.GetClassByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -490,7 +525,7 @@ func (s *Server) updateClassAccepting(r *http.Request, name string, accepting bo
 }
 
 func (s *Server) updateClassState(r *http.Request, name string, state int) {
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		c, err := s.Store.GetClassByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -503,7 +538,7 @@ func (s *Server) cancelJob(r *http.Request, jobID int64) {
 	if jobID == 0 {
 		return
 	}
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		completed := time.Now().UTC()
 		return s.Store.UpdateJobState(r.Context(), tx, jobID, 7, "job-canceled-by-user", &completed)
 	})
@@ -513,14 +548,14 @@ func (s *Server) updateJobState(r *http.Request, jobID int64, state int, reason
 	if jobID == 0 {
 		return
 	}
-	_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		return s.Store.UpdateJobState(r.Context(), tx, jobID, state, reason, nil)
 	})
 }
 
 func (s *Server) memberOptions(r *http.Request) map[string][]string {
 	var printers []model.Printer
-	_ = s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printers, err = s.Store.ListPrinters(r.Context(), tx)
 		return err
@@ -543,7 +578,7 @@ func (s *Server) applyServerSettingsFromForm(r *http.Request) error {
 		return nil
 	}
 	ctx := r.Context()
-	return s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		setBool := func(formKey, settingKey string) error {
 			val := "0"
 			if strings.TrimSpace(r.FormValue(formKey)) != "" {
@@ -634,7 +669,7 @@ func (s *Server) renderAvailablePrinters(w http.ResponseWriter, r *http.Request)
 
 func (s *Server) renderModifyPrinter(w http.ResponseWriter, r *http.Request, name string) error {
 	var printer model.Printer
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.GetPrinterByName(r.Context(), tx, name)
 		return err
@@ -668,7 +703,7 @@ func (s *Server) modifyPrinterFromForm(r *http.Request) error {
 	uri := r.FormValue("DEVICE_URI")
 	shared := r.FormValue("PRINTER_IS_SHARED") != ""
 	ppdName := strings.TrimSpace(firstNonEmpty(r.FormValue("PPD_NAME"), r.FormValue("ppd_name")))
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		p, err := s.Store.GetPrinterByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -692,7 +727,7 @@ func (s *Server) renderModifyClass(w http.ResponseWriter, r *http.Request, name
 	var class model.Class
 	var members []model.Printer
 	var printers []model.Printer
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		class, err = s.Store.GetClassByName(r.Context(), tx, name)
 		if err != nil {
@@ -747,7 +782,7 @@ func (s *Server) modifyClassFromForm(r *http.Request) error {
 	info := r.FormValue("PRINTER_INFO")
 	loc := r.FormValue("PRINTER_LOCATION")
 	memberURIs := r.Form["MEMBER_URIS"]
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		c, err := s.Store.GetClassByName(r.Context(), tx, name)
 		if err != nil {
 			return err
@@ -771,7 +806,7 @@ func (s *Server) modifyClassFromForm(r *http.Request) error {
 
 func (s *Server) renderSetPrinterOptions(w http.ResponseWriter, r *http.Request, name string) error {
 	var printer model.Printer
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.GetPrinterByName(r.Context(), tx, name)
 		return err
@@ -1053,7 +1088,7 @@ func (s *Server) applyPrinterOptionsFromForm(r *http.Request) error {
 	}
 
 	var printer model.Printer
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.GetPrinterByName(r.Context(), tx, name)
 		return err
@@ -1164,7 +1199,7 @@ func (s *Server) applyPrinterOptionsFromForm(r *http.Request) error {
 	jobSheetsDefault := strings.Join(parseJobSheetsValues(start+","+end), ",")
 
 	optsJSON, _ := json.Marshal(defaults)
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		if err := s.Store.UpdatePrinterDefaultOptions(r.Context(), tx, printer.ID, string(optsJSON)); err != nil {
 			return err
 		}
@@ -1174,7 +1209,7 @@ func (s *Server) applyPrinterOptionsFromForm(r *http.Request) error {
 
 func (s *Server) renderSetClassOptions(w http.ResponseWriter, r *http.Request, name string) error {
 	var class model.Class
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		class, err = s.Store.GetClassByName(r.Context(), tx, name)
 		return err
@@ -1313,7 +1348,7 @@ func (s *Server) applyClassOptionsFromForm(r *http.Request) error {
 		return fmt.Errorf("missing class name")
 	}
 	var class model.Class
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		class, err = s.Store.GetClassByName(r.Context(), tx, name)
 		return err
@@ -1344,7 +1379,7 @@ func (s *Server) applyClassOptionsFromForm(r *http.Request) error {
 	}
 	optsJSON, _ := json.Marshal(defaults)
 
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		if err := s.Store.UpdateClassJobSheetsDefault(r.Context(), tx, class.ID, jobSheetsDefault); err != nil {
 			return err
 		}
@@ -1365,7 +1400,7 @@ func (s *Server) renderAllowedUsers(w http.ResponseWriter, r *http.Request, name
 
 	var allowed string
 	var denied string
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		keyPrefix := "printer."
 		if isClass {
@@ -1414,7 +1449,7 @@ func (s *Server) applyAllowedUsersFromForm(r *http.Request) error {
 	isClass := r.FormValue("IS_CLASS") != ""
 	users := strings.TrimSpace(r.FormValue("users"))
 	policy := strings.TrimSpace(r.FormValue("type"))
-	return s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
 		keyPrefix := "printer."
 		id := int64(0)
 		if isClass {
@@ -1448,10 +1483,110 @@ func (s *Server) applyAllowedUsersFromForm(r *http.Request) error {
 	})
 }
 
+func (s *Server) renderJobPresets(w http.ResponseWriter, r *http.Request, name string, isClass bool) error {
+	ctx := web.NewTemplateContext()
+	ctx.SetVar("title", "Job Presets")
+	ctx.SetVar("SECTION", "admin")
+	ctx.SetVar("org.cups.sid", "")
+	ctx.SetVar("OP", "set-job-presets-confirm")
+	ctx.SetVar("printer_name", name)
+	if isClass {
+		ctx.SetVar("IS_CLASS", "1")
+	}
+
+	var presets []jobPreset
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
+		keyPrefix, _, err := s.jobPresetDestination(r.Context(), tx, name, isClass)
+		if err != nil {
+			return err
+		}
+		presets, err = loadJobPresets(r.Context(), tx, s.Store, keyPrefix)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 0, len(presets))
+	for _, p := range presets {
+		lines = append(lines, formatJobPreset(p))
+	}
+	ctx.SetVar("job_presets", strings.Join(lines, "\n"))
+
+	web.RenderTemplates(w, r, ctx, "header.tmpl.in", "job-presets.tmpl", "trailer.tmpl")
+	return nil
+}
+
+// applyJobPresetsFromForm replaces a destination's presets with the ones
+// in the form, one "name: option=value ..." per line.
+func (s *Server) applyJobPresetsFromForm(r *http.Request) error {
+	name := r.FormValue("PRINTER_NAME")
+	if name == "" {
+		return fmt.Errorf("missing printer name")
+	}
+	isClass := r.FormValue("IS_CLASS") != ""
+	var presets []jobPreset
+	for _, line := range strings.Split(r.FormValue("presets"), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		preset, err := parseJobPreset(line)
+		if err != nil {
+			return err
+		}
+		presets = setJobPreset(presets, preset)
+	}
+	return s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
+		keyPrefix, ppds, err := s.jobPresetDestination(r.Context(), tx, name, isClass)
+		if err != nil {
+			return err
+		}
+		for _, preset := range presets {
+			for _, ppd := range ppds {
+				if err := validateJobPreset(ppd, preset); err != nil {
+					return err
+				}
+			}
+		}
+		return saveJobPresets(r.Context(), tx, s.Store, keyPrefix, presets)
+	})
+}
+
+// jobPresetDestination returns the settings prefix of a printer or class
+// and the PPDs its presets are checked against.
+func (s *Server) jobPresetDestination(ctx context.Context, tx store.Tx, name string, isClass bool) (string, []*config.PPD, error) {
+	printers := []model.Printer{}
+	keyPrefix := ""
+	if isClass {
+		c, err := s.Store.GetClassByName(ctx, tx, name)
+		if err != nil {
+			return "", nil, err
+		}
+		keyPrefix = "class." + strconv.FormatInt(c.ID, 10)
+		if printers, err = s.Store.ListClassMembers(ctx, tx, c.ID); err != nil {
+			return "", nil, err
+		}
+	} else {
+		p, err := s.Store.GetPrinterByName(ctx, tx, name)
+		if err != nil {
+			return "", nil, err
+		}
+		keyPrefix = "printer." + strconv.FormatInt(p.ID, 10)
+		printers = append(printers, p)
+	}
+	ppds := []*config.PPD{}
+	for _, p := range printers {
+		if ppd, err := loadPPDForPrinter(p); err == nil {
+			ppds = append(ppds, ppd)
+		}
+	}
+	return keyPrefix, ppds, nil
+}
+
 func (s *Server) policyNames() []string {
 	names := []string{}
 	if s != nil {
-		for _, name := range s.Policy.Policies {
+		for _, name := range s.currentPolicy().Policies {
 			name = strings.TrimSpace(name)
 			if name == "" {
 				continue
@@ -2080,7 +2215,7 @@ func jobSheetsPairFromDefault(value string) (string, string) {
 
 func (s *Server) printTestPage(r *http.Request, printerName string) error {
 	var printer model.Printer
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.GetPrinterByName(r.Context(), tx, printerName)
 		return err
@@ -2093,7 +2228,7 @@ func (s *Server) printTestPage(r *http.Request, printerName string) error {
 
 func (s *Server) printTestPageForClass(r *http.Request, className string) error {
 	var member model.Printer
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		class, err := s.Store.GetClassByName(r.Context(), tx, className)
 		if err != nil {
 			return err
@@ -2127,7 +2262,7 @@ func (s *Server) enqueueTestPage(ctx context.Context, printer model.Printer) err
 	content.WriteString(time.Now().Format(time.RFC1123))
 	content.WriteString("\n")
 	sp := spool.Spool{Dir: s.Spool.Dir, OutputDir: s.Spool.OutputDir}
-	return s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	return s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		job, err := s.Store.CreateJob(ctx, tx, printer.ID, jobName, "admin", "localhost", string(optionsJSON))
 		if err != nil {
 			return err
@@ -1,25 +1,30 @@
 package server
 
 import (
+	"sync/atomic"
+
 	"cupsgolang/internal/config"
 	"cupsgolang/internal/store"
 )
 
-var appCfg config.Config
-var appSt *store.Store
+var appCfg atomic.Pointer[config.Config]
+var appSt store.Repository
 
 func SetAppConfig(cfg config.Config) {
-	appCfg = cfg
+	appCfg.Store(&cfg)
 }
 
-func SetAppStore(st *store.Store) {
+func SetAppStore(st store.Repository) {
 	appSt = st
 }
 
 func appConfig() config.Config {
-	return appCfg
+	if cfg := appCfg.Load(); cfg != nil {
+		return *cfg
+	}
+	return config.Config{}
 }
 
-func appStore() *store.Store {
+func appStore() store.Repository {
 	return appSt
 }
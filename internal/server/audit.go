@@ -0,0 +1,300 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/logging"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+	"cupsgolang/internal/web"
+)
+
+// auditTarget identifies what an administrative action touched: a printer or
+// class by name, a single job, or (when both are empty) the server itself.
+type auditTarget struct {
+	name  string
+	jobID int64
+}
+
+func (t auditTarget) String() string {
+	if t.jobID > 0 {
+		return "job:" + strconv.FormatInt(t.jobID, 10)
+	}
+	return t.name
+}
+
+// isAuditedOp reports whether an IPP operation changes server, queue or
+// job-routing state and therefore belongs in the audit trail.
+func isAuditedOp(op goipp.Op) bool {
+	switch op {
+	case goipp.OpRenewSubscription, goipp.OpCancelSubscription:
+		return false
+	case goipp.OpCancelJobs, opBackupServer:
+		return true
+	}
+	return isAdminOnlyOp(op)
+}
+
+func ippAuditTarget(req *goipp.Message) auditTarget {
+	if req == nil {
+		return auditTarget{}
+	}
+	if goipp.Op(req.Code) == goipp.OpCupsMoveJob {
+		if id, ok := attrIntPresent(req.Operation, "job-id"); ok && id > 0 {
+			return auditTarget{jobID: id}
+		}
+		if id, ok := parseMoveJobURI(attrString(req.Operation, "job-uri")); ok {
+			return auditTarget{jobID: id}
+		}
+	}
+	name := strings.TrimSpace(attrString(req.Operation, "printer-name"))
+	if name == "" {
+		name = printerNameFromURI(attrString(req.Operation, "printer-uri"))
+	}
+	return auditTarget{name: auditDestName(name)}
+}
+
+func auditDestName(name string) string {
+	name = strings.TrimSpace(name)
+	switch name {
+	case "", ".", "/", "printers", "classes", "jobs", "admin":
+		return ""
+	}
+	return name
+}
+
+// beginAudit snapshots the target before an action runs. The returned
+// function snapshots it again and appends an entry; when always is false the
+// entry is only written if something actually changed, which is how the web
+// forms (which do not report success centrally) are audited. claimed is the
+// name the client gave, recorded only when the request did not authenticate.
+func (s *Server) beginAudit(r *http.Request, claimed, operation string, target auditTarget) func(always bool) {
+	if s == nil || s.Store == nil || r == nil {
+		return func(bool) {}
+	}
+	ctx := r.Context()
+	before := s.auditSnapshot(ctx, target)
+	return func(always bool) {
+		after := s.auditSnapshot(ctx, target)
+		changes := auditDiff(before, after)
+		if !always && len(changes) == 0 {
+			return
+		}
+		s.recordAudit(ctx, model.AuditEntry{
+			User:       auditUser(r, claimed),
+			RemoteAddr: remoteIPForRequest(r),
+			Operation:  operation,
+			Target:     target.String(),
+			Changes:    changes,
+		})
+	}
+}
+
+// auditUser names who performed an action: the user the request
+// authenticated as, or else the requesting-user-name or Authorization
+// username the client claimed, marked as unverified so it cannot pass for
+// a real identity.
+func auditUser(r *http.Request, claimed string) string {
+	if user, ok := verifiedUser(r); ok {
+		return user
+	}
+	claimed = strings.TrimSpace(claimed)
+	if claimed == "" {
+		return "anonymous"
+	}
+	return claimed + " (unauthenticated)"
+}
+
+func (s *Server) recordAudit(ctx context.Context, entry model.AuditEntry) {
+	if strings.TrimSpace(entry.User) == "" {
+		entry.User = "anonymous"
+	}
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		var err error
+		entry, err = s.Store.AddAuditEntry(ctx, tx, entry)
+		return err
+	})
+	if err != nil {
+		logging.Logger().Error("Unable to record audit entry", "operation", entry.Operation, "target", entry.Target, "err", err)
+		return
+	}
+	logging.Audit(auditLogLine(entry))
+}
+
+// auditLogLine renders an entry as one JSON object for the AuditLog file.
+func auditLogLine(e model.AuditEntry) string {
+	line := struct {
+		Time       string               `json:"time"`
+		ID         int64                `json:"id"`
+		User       string               `json:"user"`
+		RemoteAddr string               `json:"remote-addr"`
+		Operation  string               `json:"operation"`
+		Target     string               `json:"target"`
+		Changes    map[string][2]string `json:"changes,omitempty"`
+	}{
+		Time:       e.CreatedAt.UTC().Format(time.RFC3339),
+		ID:         e.ID,
+		User:       e.User,
+		RemoteAddr: e.RemoteAddr,
+		Operation:  e.Operation,
+		Target:     e.Target,
+		Changes:    e.Changes,
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+// auditSnapshot flattens the administrator-visible state of a target into
+// attribute/value pairs so two snapshots can be diffed. A missing target
+// yields an empty map, so creation and deletion show up as changes too.
+func (s *Server) auditSnapshot(ctx context.Context, target auditTarget) map[string]string {
+	out := map[string]string{}
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		if target.jobID > 0 {
+			job, err := s.Store.GetJob(ctx, tx, target.jobID)
+			if err != nil {
+				return nil
+			}
+			out["job-state"] = strconv.Itoa(job.State)
+			out["job-state-reasons"] = job.StateReason
+			if p, err := s.Store.GetPrinterByID(ctx, tx, job.PrinterID); err == nil {
+				out["job-printer"] = p.Name
+			}
+			return nil
+		}
+		if target.name == "" {
+			settings, err := s.Store.ListSettings(ctx, tx)
+			if err != nil {
+				return nil
+			}
+			for k, v := range settings {
+				out[k] = v
+			}
+			return nil
+		}
+		if p, err := s.Store.GetPrinterByName(ctx, tx, target.name); err == nil {
+			out["device-uri"] = p.URI
+			out["ppd-name"] = p.PPDName
+			out["printer-info"] = p.Info
+			out["printer-location"] = p.Location
+			out["printer-geo-location"] = p.Geo
+			out["printer-organization"] = p.Org
+			out["printer-organizational-unit"] = p.OrgUnit
+			out["printer-state"] = strconv.Itoa(p.State)
+			out["printer-is-accepting-jobs"] = strconv.FormatBool(p.Accepting)
+			out["printer-is-shared"] = strconv.FormatBool(p.Shared)
+			out["printer-is-default"] = strconv.FormatBool(p.IsDefault)
+			out["job-sheets-default"] = p.JobSheetsDefault
+			for k, v := range parseJobOptions(p.DefaultOptions) {
+				out[k+"-default"] = v
+			}
+			if n, err := s.Store.CountQueuedJobsByPrinterIDs(ctx, tx, []int64{p.ID}); err == nil {
+				out["queued-job-count"] = strconv.Itoa(n)
+			}
+			return nil
+		}
+		if c, err := s.Store.GetClassByName(ctx, tx, target.name); err == nil {
+			out["printer-info"] = c.Info
+			out["printer-location"] = c.Location
+			out["printer-state"] = strconv.Itoa(c.State)
+			out["printer-is-accepting-jobs"] = strconv.FormatBool(c.Accepting)
+			out["printer-is-default"] = strconv.FormatBool(c.IsDefault)
+			out["job-sheets-default"] = c.JobSheetsDefault
+			for k, v := range parseJobOptions(c.DefaultOptions) {
+				out[k+"-default"] = v
+			}
+			if members, err := s.Store.ListClassMembers(ctx, tx, c.ID); err == nil {
+				names := make([]string, 0, len(members))
+				for _, m := range members {
+					names = append(names, m.Name)
+				}
+				sort.Strings(names)
+				out["member-names"] = strings.Join(names, ",")
+			}
+		}
+		return nil
+	})
+	return out
+}
+
+func auditDiff(before, after map[string]string) map[string][2]string {
+	changes := map[string][2]string{}
+	for k, v := range before {
+		if nv, ok := after[k]; !ok || nv != v {
+			changes[k] = [2]string{v, after[k]}
+		}
+	}
+	for k, v := range after {
+		if _, ok := before[k]; !ok {
+			changes[k] = [2]string{"", v}
+		}
+	}
+	return changes
+}
+
+// webAdminAuditOps lists the /admin form operations that modify state.
+var webAdminAuditOps = map[string]bool{
+	"config-server":               true,
+	"add-printer-confirm":         true,
+	"add-class-confirm":           true,
+	"modify-printer-confirm":      true,
+	"modify-class-confirm":        true,
+	"set-printer-options-confirm": true,
+	"set-class-options-confirm":   true,
+	"set-allowed-users-confirm":   true,
+	"set-job-presets-confirm":     true,
+	"set-as-default":              true,
+	"delete-printer":              true,
+	"delete-class":                true,
+}
+
+func (s *Server) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAdminOr401(w, r) {
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	filter := store.AuditFilter{
+		User:   q.Get("user"),
+		Target: q.Get("target"),
+		Limit:  200,
+	}
+	if v, err := strconv.Atoi(q.Get("limit")); err == nil && v > 0 {
+		filter.Limit = v
+	}
+	if v := strings.TrimSpace(q.Get("since")); v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			filter.Since = t
+		}
+	}
+	var entries []model.AuditEntry
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
+		var err error
+		entries, err = s.Store.ListAuditEntries(r.Context(), tx, filter)
+		return err
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if q.Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(entries)
+		return
+	}
+	web.RenderAudit(w, r, entries)
+}
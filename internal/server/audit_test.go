@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+func TestAuditRecordsSetPrinterAttributesDiff(t *testing.T) {
+	s := newMoveTestServer(t)
+	ctx := context.Background()
+
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		if err := s.Store.CreateUser(ctx, tx, "admin", "secret", true); err != nil {
+			return err
+		}
+		_, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "L1", "Info", model.DefaultPPDName, true, false, false, "none", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("setup store: %v", err)
+	}
+
+	req := newSetPrinterAttrsRequest("ipp://localhost/printers/Office")
+	req.Printer.Add(goipp.MakeAttribute("printer-location", goipp.TagText, goipp.String("L2")))
+	r := withAuthMemo(httptest.NewRequest(http.MethodPost, "http://localhost/ipp/print", nil))
+	r.RemoteAddr = "192.0.2.7:631"
+	r.SetBasicAuth("admin", "secret")
+	if _, ok := s.authenticate(r, "basic"); !ok {
+		t.Fatal("admin did not authenticate")
+	}
+
+	finish := s.beginAudit(r, requestingUserName(req, r), goipp.OpSetPrinterAttributes.String(), ippAuditTarget(req))
+	if _, err := s.handleSetPrinterAttributes(ctx, r, req); err != nil {
+		t.Fatalf("handleSetPrinterAttributes error: %v", err)
+	}
+	finish(true)
+
+	var entries []model.AuditEntry
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		var err error
+		entries, err = s.Store.ListAuditEntries(ctx, tx, store.AuditFilter{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("entries = %d, want 1", len(entries))
+	}
+	e := entries[0]
+	if e.User != "admin" || e.RemoteAddr != "192.0.2.7" || e.Target != "Office" || e.Operation != "Set-Printer-Attributes" {
+		t.Fatalf("unexpected entry: %+v", e)
+	}
+	if len(e.Changes) != 1 || e.Changes["printer-location"] != [2]string{"L1", "L2"} {
+		t.Fatalf("unexpected changes: %v", e.Changes)
+	}
+}
+
+func TestAuditSkipsUnchangedWebForms(t *testing.T) {
+	s := newMoveTestServer(t)
+	r := httptest.NewRequest(http.MethodPost, "http://localhost/admin/", strings.NewReader(""))
+
+	s.beginAudit(r, "admin", "web:set-as-default", auditTarget{name: "Missing"})(false)
+
+	err := s.Store.WithTx(context.Background(), true, func(tx store.Tx) error {
+		entries, err := s.Store.ListAuditEntries(context.Background(), tx, store.AuditFilter{})
+		if err != nil {
+			return err
+		}
+		if len(entries) != 0 {
+			t.Fatalf("expected no entries, got %+v", entries)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+}
+
+func TestAuditMarksUnauthenticatedRequestingUserName(t *testing.T) {
+	s := newMoveTestServer(t)
+	ctx := context.Background()
+
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		_, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "L1", "Info", model.DefaultPPDName, true, false, false, "none", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("setup store: %v", err)
+	}
+
+	// With AuthType None nothing verifies the requesting-user-name, and a
+	// Basic header with a wrong password proves nothing either.
+	req := newSetPrinterAttrsRequest("ipp://localhost/printers/Office")
+	req.Operation.Add(goipp.MakeAttribute("requesting-user-name", goipp.TagName, goipp.String("admin")))
+	req.Printer.Add(goipp.MakeAttribute("printer-location", goipp.TagText, goipp.String("L2")))
+	r := withAuthMemo(httptest.NewRequest(http.MethodPost, "http://localhost/ipp/print", nil))
+	r.SetBasicAuth("root", "guess")
+	_, _ = s.authenticate(r, "basic")
+
+	finish := s.beginAudit(r, requestingUserName(req, r), goipp.OpSetPrinterAttributes.String(), ippAuditTarget(req))
+	if _, err := s.handleSetPrinterAttributes(ctx, r, req); err != nil {
+		t.Fatalf("handleSetPrinterAttributes error: %v", err)
+	}
+	finish(true)
+
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		entries, err := s.Store.ListAuditEntries(ctx, tx, store.AuditFilter{})
+		if err != nil {
+			return err
+		}
+		if len(entries) != 1 {
+			t.Fatalf("entries = %d, want 1", len(entries))
+		}
+		if user := entries[0].User; user == "admin" || user == "root" || !strings.HasSuffix(user, " (unauthenticated)") {
+			t.Fatalf("audit user = %q, want a claim marked unauthenticated", user)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list audit: %v", err)
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"crypto/md5"
 	"crypto/rand"
 	"crypto/sha256"
-	"database/sql"
+	"crypto/subtle"
 	"encoding/base64"
 	"encoding/hex"
 	"fmt"
@@ -16,7 +16,10 @@ import (
 
 	goipp "github.com/OpenPrinting/goipp"
 
+	"cupsgolang/internal/logging"
+	"cupsgolang/internal/metrics"
 	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
 )
 
 const authRealm = "CUPS-Golang"
@@ -36,9 +39,10 @@ func (s *Server) authTypeForRequest(r *http.Request, op string) string {
 	if r == nil {
 		return ""
 	}
-	if rule := s.Policy.Match(r.URL.Path); rule != nil {
+	policy := s.requestPolicy(r)
+	if rule := policy.Match(r.URL.Path); rule != nil {
 		if op != "" {
-			if limit := s.Policy.LimitFor(r.URL.Path, op); limit != nil {
+			if limit := policy.LimitFor(r.URL.Path, op); limit != nil {
 				if limit.AuthType != "" {
 					return s.normalizeAuthType(limit.AuthType)
 				}
@@ -54,11 +58,11 @@ func (s *Server) authTypeForRequest(r *http.Request, op string) string {
 func (s *Server) normalizeAuthType(authType string) string {
 	authType = strings.TrimSpace(authType)
 	if authType == "" {
-		return strings.TrimSpace(s.Config.DefaultAuthType)
+		return strings.TrimSpace(s.currentConfig().DefaultAuthType)
 	}
 	// cupsd.conf supports `AuthType Default`, which maps to DefaultAuthType.
 	if strings.EqualFold(authType, "default") {
-		return strings.TrimSpace(s.Config.DefaultAuthType)
+		return strings.TrimSpace(s.currentConfig().DefaultAuthType)
 	}
 	return authType
 }
@@ -138,12 +142,39 @@ func (s *Server) authenticate(r *http.Request, authType string) (model.User, boo
 }
 
 func (s *Server) authenticateBasic(r *http.Request) (model.User, bool) {
+	return memoizeAuth(r, "basic", s.verifyBasic)
+}
+
+func (s *Server) verifyBasic(r *http.Request) (model.User, bool) {
 	user, pass, ok := r.BasicAuth()
 	if !ok || user == "" {
 		return model.User{}, false
 	}
+	now := time.Now()
+	guard := s.authGuard()
+	limits := s.authLimits()
+	if cached, ok := guard.cachedBasic(user, pass, now); ok {
+		// The account may have changed since it was cached: the cache only
+		// stands in for bcrypt while the stored password hash is the one
+		// that was verified, and the stored record is what is returned.
+		var current model.User
+		err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
+			var err error
+			current, err = s.Store.GetUserByUsername(r.Context(), tx, user)
+			return err
+		})
+		if err == nil && current.PasswordHash == cached.PasswordHash {
+			return current, true
+		}
+		guard.forgetBasic(user, pass)
+	}
+	ip := remoteIPForRequest(r)
+	if guard.throttled(ip, user, now, limits) {
+		metrics.AuthThrottled.Inc("basic", "backoff")
+		return model.User{}, false
+	}
 	var result model.User
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		u, err := s.Store.VerifyUser(r.Context(), tx, user, pass)
 		if err != nil {
 			return err
@@ -152,20 +183,26 @@ func (s *Server) authenticateBasic(r *http.Request) (model.User, bool) {
 		return nil
 	})
 	if err != nil {
+		s.authFailed(r, "basic", user, now)
 		return model.User{}, false
 	}
+	guard.succeed(ip, user)
 	if result.DigestHA1 == "" && pass != "" {
 		digest := computeDigestHA1(result.Username, pass)
-		_ = s.Store.WithTx(r.Context(), false, func(tx *sql.Tx) error {
-			_, err := tx.ExecContext(r.Context(), `UPDATE users SET digest_ha1 = ? WHERE username = ?`, digest, result.Username)
-			return err
+		_ = s.Store.WithTx(r.Context(), false, func(tx store.Tx) error {
+			return s.Store.SetUserDigestHA1(r.Context(), tx, result.Username, digest)
 		})
 		result.DigestHA1 = digest
 	}
+	guard.rememberBasic(user, pass, result, now, limits.cacheTTL)
 	return result, true
 }
 
 func (s *Server) authenticateDigest(r *http.Request) (model.User, bool) {
+	return memoizeAuth(r, "digest", s.verifyDigest)
+}
+
+func (s *Server) verifyDigest(r *http.Request) (model.User, bool) {
 	auth := r.Header.Get("Authorization")
 	if auth == "" || !strings.HasPrefix(strings.ToLower(auth), "digest ") {
 		return model.User{}, false
@@ -188,9 +225,16 @@ func (s *Server) authenticateDigest(r *http.Request) (model.User, bool) {
 	if !validateNonce(nonce) {
 		return model.User{}, false
 	}
+	now := time.Now()
+	guard := s.authGuard()
+	ip := remoteIPForRequest(r)
+	if guard.throttled(ip, username, now, s.authLimits()) {
+		metrics.AuthThrottled.Inc("digest", "backoff")
+		return model.User{}, false
+	}
 
 	var user model.User
-	err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 		u, err := s.Store.GetUserByUsername(r.Context(), tx, username)
 		if err != nil {
 			return err
@@ -199,6 +243,7 @@ func (s *Server) authenticateDigest(r *http.Request) (model.User, bool) {
 		return nil
 	})
 	if err != nil || user.DigestHA1 == "" {
+		s.authFailed(r, "digest", username, now)
 		return model.User{}, false
 	}
 
@@ -209,13 +254,26 @@ func (s *Server) authenticateDigest(r *http.Request) (model.User, bool) {
 	} else {
 		expected = md5Hex(fmt.Sprintf("%s:%s:%s", user.DigestHA1, nonce, ha2))
 	}
-	if strings.EqualFold(expected, response) {
-		return user, true
+	if !strings.EqualFold(expected, response) {
+		s.authFailed(r, "digest", username, now)
+		return model.User{}, false
+	}
+	// RFC 2069 clients send no qop/nc; only qop=auth exchanges carry a
+	// nonce-count that can be checked for replay.
+	if qop != "" && !guard.acceptNonceCount(nonce, nc, now) {
+		metrics.AuthThrottled.Inc("digest", "replay")
+		logging.Logger().Warn("Rejected replayed digest nonce-count", "user", username, "remote", ip, "nc", nc)
+		return model.User{}, false
 	}
-	return model.User{}, false
+	guard.succeed(ip, username)
+	return user, true
 }
 
 func (s *Server) authenticateNegotiate(r *http.Request) (model.User, bool) {
+	return memoizeAuth(r, "negotiate", s.verifyNegotiate)
+}
+
+func (s *Server) verifyNegotiate(r *http.Request) (model.User, bool) {
 	auth := strings.TrimSpace(r.Header.Get("Authorization"))
 	if auth == "" || !strings.HasPrefix(strings.ToLower(auth), "negotiate ") {
 		return model.User{}, false
@@ -232,7 +290,7 @@ func (s *Server) authenticateNegotiate(r *http.Request) (model.User, bool) {
 	// If user exists in local store, return full record (including admin flag).
 	if s != nil && s.Store != nil {
 		var user model.User
-		err := s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+		err := s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 			u, err := s.Store.GetUserByUsername(r.Context(), tx, username)
 			if err != nil {
 				return err
@@ -311,33 +369,41 @@ func parseDigestAuth(value string) map[string]string {
 	return out
 }
 
+// generateNonce returns "timestamp:salt:signature" (base64). The random salt
+// keeps nonces issued in the same second distinct, so each client gets its
+// own nonce-count sequence.
 func generateNonce() string {
 	ts := strconv.FormatInt(time.Now().Unix(), 10)
-	sum := sha256.Sum256([]byte(ts + ":" + hex.EncodeToString(nonceSecret)))
-	raw := ts + ":" + hex.EncodeToString(sum[:])
+	saltBuf := make([]byte, 12)
+	_, _ = rand.Read(saltBuf)
+	salt := hex.EncodeToString(saltBuf)
+	raw := ts + ":" + salt + ":" + nonceSignature(ts, salt)
 	return base64.StdEncoding.EncodeToString([]byte(raw))
 }
 
+func nonceSignature(ts, salt string) string {
+	sum := sha256.Sum256([]byte(ts + ":" + salt + ":" + hex.EncodeToString(nonceSecret)))
+	return hex.EncodeToString(sum[:])
+}
+
 func validateNonce(nonce string) bool {
 	raw, err := base64.StdEncoding.DecodeString(nonce)
 	if err != nil {
 		return false
 	}
-	parts := strings.SplitN(string(raw), ":", 2)
-	if len(parts) != 2 {
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 {
 		return false
 	}
-	ts, sig := parts[0], parts[1]
+	ts, salt, sig := parts[0], parts[1], parts[2]
 	t, err := strconv.ParseInt(ts, 10, 64)
 	if err != nil {
 		return false
 	}
-	if time.Since(time.Unix(t, 0)) > 10*time.Minute {
+	if time.Since(time.Unix(t, 0)) > nonceLifetime {
 		return false
 	}
-	sum := sha256.Sum256([]byte(ts + ":" + hex.EncodeToString(nonceSecret)))
-	expected := hex.EncodeToString(sum[:])
-	return expected == sig
+	return subtle.ConstantTimeCompare([]byte(nonceSignature(ts, salt)), []byte(sig)) == 1
 }
 
 func md5Hex(value string) string {
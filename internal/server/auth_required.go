@@ -38,10 +38,11 @@ func (s *Server) authInfoRequiredForDestination(isClass bool, name string, defau
 
 	// Otherwise, fall back to the queue's operation policy for Print-Job.
 	policyName := s.policyNameForDefaultOptions(defaultOptionsJSON)
-	limit := s.Policy.PolicyLimitFor(policyName, goipp.OpPrintJob.String())
+	policy := s.currentPolicy()
+	limit := policy.PolicyLimitFor(policyName, goipp.OpPrintJob.String())
 	if limit == nil && !strings.EqualFold(policyName, s.defaultPolicyName()) {
 		// Unknown policy references fall back to default policy (CUPS behavior).
-		limit = s.Policy.PolicyLimitFor(s.defaultPolicyName(), goipp.OpPrintJob.String())
+		limit = policy.PolicyLimitFor(s.defaultPolicyName(), goipp.OpPrintJob.String())
 	}
 	if limit == nil {
 		return nil
@@ -71,13 +72,14 @@ func (s *Server) authInfoRequiredForLocation(path string, method string) []strin
 		return nil
 	}
 
-	rule := s.Policy.Match(path)
+	policy := s.currentPolicy()
+	rule := policy.Match(path)
 	if rule == nil {
 		return nil
 	}
 
 	// Check the most specific <Limit METHOD> first.
-	if limit := s.Policy.LimitFor(path, method); limit != nil {
+	if limit := policy.LimitFor(path, method); limit != nil {
 		if !limitRequiresAuth(limit) {
 			return nil
 		}
@@ -109,7 +111,7 @@ func (s *Server) defaultAuthTypeFallback() string {
 	if s == nil {
 		return "basic"
 	}
-	if v := strings.TrimSpace(s.Config.DefaultAuthType); v != "" && !strings.EqualFold(v, "default") {
+	if v := strings.TrimSpace(s.currentConfig().DefaultAuthType); v != "" && !strings.EqualFold(v, "default") {
 		return v
 	}
 	// CUPS defaults to Basic when authentication is required but no explicit
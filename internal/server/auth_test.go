@@ -2,9 +2,10 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net/http/httptest"
 	"testing"
+
+	"cupsgolang/internal/store"
 )
 
 func TestSetAuthChallengeNegotiate(t *testing.T) {
@@ -34,7 +35,7 @@ func TestAuthenticateNegotiateTrustedLoopbackHeader(t *testing.T) {
 func TestAuthenticateNegotiateLoadsAdminFromStore(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
-	if err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	if err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		return s.Store.CreateUser(ctx, tx, "bob", "secret", true)
 	}); err != nil {
 		t.Fatalf("create user: %v", err)
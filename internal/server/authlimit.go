@@ -0,0 +1,315 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cupsgolang/internal/logging"
+	"cupsgolang/internal/metrics"
+	"cupsgolang/internal/model"
+)
+
+const (
+	// nonceLifetime bounds how long a digest nonce (and its nonce-count
+	// record) stays valid.
+	nonceLifetime = 10 * time.Minute
+	// maxAuthEntries caps each tracking table so a flood of distinct
+	// addresses or usernames cannot grow memory without bound.
+	maxAuthEntries = 4096
+)
+
+// authGuard throttles credential checks. It tracks failed attempts per
+// remote address and per username with exponential backoff and a temporary
+// lockout, remembers the highest digest nonce-count seen for each nonce, and
+// caches recently verified Basic credentials so repeat requests skip bcrypt
+// while the stored password hash is unchanged.
+type authGuard struct {
+	mu       sync.Mutex
+	failures map[string]*authFailure
+	nonces   map[string]nonceUse
+	cache    map[[sha256.Size]byte]cachedCredential
+}
+
+type authFailure struct {
+	count        int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+type nonceUse struct {
+	nc      uint64
+	expires time.Time
+}
+
+type cachedCredential struct {
+	user    model.User
+	expires time.Time
+}
+
+func newAuthGuard() *authGuard {
+	return &authGuard{
+		failures: map[string]*authFailure{},
+		nonces:   map[string]nonceUse{},
+		cache:    map[[sha256.Size]byte]cachedCredential{},
+	}
+}
+
+func (s *Server) authGuard() *authGuard {
+	s.authGuardOnce.Do(func() {
+		s.authGuardState = newAuthGuard()
+	})
+	return s.authGuardState
+}
+
+func authFailureKeys(ip, user string) []string {
+	keys := make([]string, 0, 2)
+	if ip != "" {
+		keys = append(keys, "ip:"+ip)
+	}
+	if user != "" {
+		keys = append(keys, "user:"+strings.ToLower(user))
+	}
+	return keys
+}
+
+// throttled reports whether the address or username is still inside a
+// backoff or lockout window; such attempts are rejected without checking the
+// password.
+func (g *authGuard) throttled(ip, user string, now time.Time, cfg authLimits) bool {
+	if !cfg.enabled() {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range authFailureKeys(ip, user) {
+		if f, ok := g.failures[key]; ok && now.Before(f.blockedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records a failed attempt and returns true when it pushed the address
+// or username into lockout.
+func (g *authGuard) fail(ip, user string, now time.Time, cfg authLimits) bool {
+	if !cfg.enabled() {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pruneFailuresLocked(now, cfg)
+	locked := false
+	for _, key := range authFailureKeys(ip, user) {
+		f, ok := g.failures[key]
+		if !ok || now.Sub(f.last) > cfg.lockout {
+			f = &authFailure{}
+			g.failures[key] = f
+		}
+		f.count++
+		f.last = now
+		if f.count >= cfg.maxFailures {
+			f.blockedUntil = now.Add(cfg.lockout)
+			if f.count == cfg.maxFailures {
+				locked = true
+			}
+			continue
+		}
+		if cfg.backoff <= 0 {
+			continue
+		}
+		delay := cfg.lockout
+		if shift := f.count - 1; shift < 32 {
+			if d := cfg.backoff << shift; d > 0 && d < delay {
+				delay = d
+			}
+		}
+		f.blockedUntil = now.Add(delay)
+	}
+	return locked
+}
+
+func (g *authGuard) succeed(ip, user string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, key := range authFailureKeys(ip, user) {
+		delete(g.failures, key)
+	}
+}
+
+func (g *authGuard) pruneFailuresLocked(now time.Time, cfg authLimits) {
+	if len(g.failures) < maxAuthEntries {
+		return
+	}
+	for key, f := range g.failures {
+		if now.After(f.blockedUntil) && now.Sub(f.last) > cfg.lockout {
+			delete(g.failures, key)
+		}
+	}
+}
+
+// acceptNonceCount enforces a strictly increasing nc for each nonce, which is
+// what keeps a captured Digest Authorization header from being replayed.
+func (g *authGuard) acceptNonceCount(nonce, nc string, now time.Time) bool {
+	count, err := strconv.ParseUint(strings.TrimSpace(nc), 16, 64)
+	if err != nil || count == 0 {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.nonces) >= maxAuthEntries {
+		for key, use := range g.nonces {
+			if now.After(use.expires) {
+				delete(g.nonces, key)
+			}
+		}
+	}
+	if use, ok := g.nonces[nonce]; ok && now.Before(use.expires) && count <= use.nc {
+		return false
+	}
+	g.nonces[nonce] = nonceUse{nc: count, expires: now.Add(nonceLifetime)}
+	return true
+}
+
+func credentialKey(user, pass string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(user + "\x00" + pass))
+}
+
+func (g *authGuard) cachedBasic(user, pass string, now time.Time) (model.User, bool) {
+	key := credentialKey(user, pass)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	entry, ok := g.cache[key]
+	if !ok {
+		return model.User{}, false
+	}
+	if now.After(entry.expires) || subtle.ConstantTimeCompare([]byte(entry.user.Username), []byte(user)) != 1 {
+		delete(g.cache, key)
+		return model.User{}, false
+	}
+	return entry.user, true
+}
+
+func (g *authGuard) forgetBasic(user, pass string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.cache, credentialKey(user, pass))
+}
+
+func (g *authGuard) rememberBasic(user, pass string, u model.User, now time.Time, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(g.cache) >= maxAuthEntries {
+		for key, entry := range g.cache {
+			if now.After(entry.expires) {
+				delete(g.cache, key)
+			}
+		}
+		if len(g.cache) >= maxAuthEntries {
+			return
+		}
+	}
+	g.cache[credentialKey(user, pass)] = cachedCredential{user: u, expires: now.Add(ttl)}
+}
+
+// authLimits is the cupsd.conf view of the throttling settings.
+type authLimits struct {
+	maxFailures int
+	backoff     time.Duration
+	lockout     time.Duration
+	cacheTTL    time.Duration
+}
+
+func (l authLimits) enabled() bool {
+	return l.maxFailures > 0 && l.lockout > 0
+}
+
+func (s *Server) authLimits() authLimits {
+	cfg := s.currentConfig()
+	return authLimits{
+		maxFailures: cfg.AuthMaxFailures,
+		backoff:     time.Duration(cfg.AuthBackoff) * time.Second,
+		lockout:     time.Duration(cfg.AuthLockoutTime) * time.Second,
+		cacheTTL:    time.Duration(cfg.AuthCacheTime) * time.Second,
+	}
+}
+
+func (s *Server) authFailed(r *http.Request, scheme, user string, now time.Time) {
+	metrics.AuthFailures.Inc(scheme)
+	ip := remoteIPForRequest(r)
+	if s.authGuard().fail(ip, user, now, s.authLimits()) {
+		logging.Logger().Warn("Too many failed authentication attempts, locking out",
+			"scheme", scheme, "user", user, "remote", ip, "lockout", s.authLimits().lockout.String())
+	}
+}
+
+// authMemo caches authentication results for the lifetime of one HTTP
+// request. A request is often checked more than once (location policy, then
+// operation policy), and re-verifying would repeat the bcrypt work, count a
+// bad password twice, and trip digest replay detection on its own nc.
+type authMemo struct {
+	mu      sync.Mutex
+	results map[string]authResult
+}
+
+type authResult struct {
+	user model.User
+	ok   bool
+}
+
+type authMemoKey struct{}
+
+func withAuthMemo(r *http.Request) *http.Request {
+	if r == nil {
+		return r
+	}
+	return r.WithContext(context.WithValue(r.Context(), authMemoKey{}, &authMemo{results: map[string]authResult{}}))
+}
+
+func authMemoFromRequest(r *http.Request) *authMemo {
+	if r == nil {
+		return nil
+	}
+	memo, _ := r.Context().Value(authMemoKey{}).(*authMemo)
+	return memo
+}
+
+func memoizeAuth(r *http.Request, scheme string, verify func(*http.Request) (model.User, bool)) (model.User, bool) {
+	memo := authMemoFromRequest(r)
+	if memo == nil {
+		return verify(r)
+	}
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+	if res, ok := memo.results[scheme]; ok {
+		return res.user, res.ok
+	}
+	u, ok := verify(r)
+	memo.results[scheme] = authResult{user: u, ok: ok}
+	return u, ok
+}
+
+// verifiedUser returns the user the request authenticated as, if any
+// credentials were checked and accepted while serving it.
+func verifiedUser(r *http.Request) (string, bool) {
+	memo := authMemoFromRequest(r)
+	if memo == nil {
+		return "", false
+	}
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+	for _, scheme := range []string{"basic", "digest", "negotiate"} {
+		if res, ok := memo.results[scheme]; ok && res.ok && strings.TrimSpace(res.user.Username) != "" {
+			return strings.TrimSpace(res.user.Username), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,215 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/store"
+)
+
+func TestAuthGuardBackoffAndLockout(t *testing.T) {
+	g := newAuthGuard()
+	limits := authLimits{maxFailures: 3, backoff: time.Second, lockout: time.Minute}
+	now := time.Unix(1_700_000_000, 0)
+
+	if g.fail("10.0.0.1", "bob", now, limits) {
+		t.Fatalf("first failure should not lock out")
+	}
+	if !g.throttled("10.0.0.1", "", now.Add(500*time.Millisecond), limits) {
+		t.Fatalf("expected backoff after first failure")
+	}
+	if g.throttled("10.0.0.1", "", now.Add(1500*time.Millisecond), limits) {
+		t.Fatalf("backoff should expire after 1s")
+	}
+	now = now.Add(2 * time.Second)
+	g.fail("10.0.0.1", "bob", now, limits)
+	if !g.throttled("", "bob", now.Add(1500*time.Millisecond), limits) {
+		t.Fatalf("second failure should back off for 2s")
+	}
+	now = now.Add(3 * time.Second)
+	if !g.fail("10.0.0.2", "bob", now, limits) {
+		t.Fatalf("third failure for bob should lock out")
+	}
+	if !g.throttled("10.0.0.9", "bob", now.Add(30*time.Second), limits) {
+		t.Fatalf("bob should be locked out from any address")
+	}
+	if g.throttled("10.0.0.9", "alice", now.Add(30*time.Second), limits) {
+		t.Fatalf("other users should not be locked out")
+	}
+	if g.throttled("10.0.0.9", "bob", now.Add(61*time.Second), limits) {
+		t.Fatalf("lockout should expire")
+	}
+	g.succeed("10.0.0.1", "bob")
+	if g.throttled("10.0.0.1", "bob", now, limits) {
+		t.Fatalf("success should clear failures")
+	}
+}
+
+func TestAuthGuardNonceCountReplay(t *testing.T) {
+	g := newAuthGuard()
+	now := time.Now()
+	if !g.acceptNonceCount("n1", "00000001", now) {
+		t.Fatalf("first nc rejected")
+	}
+	if g.acceptNonceCount("n1", "00000001", now) {
+		t.Fatalf("replayed nc accepted")
+	}
+	if !g.acceptNonceCount("n1", "00000002", now) {
+		t.Fatalf("increasing nc rejected")
+	}
+	if !g.acceptNonceCount("n2", "00000001", now) {
+		t.Fatalf("nc for a different nonce rejected")
+	}
+	if g.acceptNonceCount("n3", "zz", now) {
+		t.Fatalf("malformed nc accepted")
+	}
+}
+
+func TestGenerateNonceUniqueAndValid(t *testing.T) {
+	a, b := generateNonce(), generateNonce()
+	if a == b {
+		t.Fatalf("nonces issued in the same second must differ")
+	}
+	if !validateNonce(a) || !validateNonce(b) {
+		t.Fatalf("generated nonce failed validation")
+	}
+}
+
+func TestAuthenticateBasicLockout(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Config.AuthMaxFailures = 2
+	s.Config.AuthBackoff = 0
+	s.Config.AuthLockoutTime = 60
+	s.Config.AuthCacheTime = 60
+	ctx := context.Background()
+	if err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		return s.Store.CreateUser(ctx, tx, "bob", "secret", false)
+	}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	try := func(pass string) bool {
+		req := withAuthMemo(httptest.NewRequest("GET", "http://localhost/admin", nil))
+		req.RemoteAddr = "192.0.2.10:5000"
+		req.SetBasicAuth("bob", pass)
+		_, ok := s.authenticate(req, "basic")
+		return ok
+	}
+	if !try("secret") {
+		t.Fatalf("valid password rejected")
+	}
+	for i := 0; i < 2; i++ {
+		if try(fmt.Sprintf("wrong%d", i)) {
+			t.Fatalf("wrong password accepted")
+		}
+	}
+	if try("other") {
+		t.Fatalf("locked out attempt accepted")
+	}
+	// Credentials verified before the lockout are served from the cache
+	// without another bcrypt check.
+	if !try("secret") {
+		t.Fatalf("cached credentials rejected")
+	}
+}
+
+func TestAuthenticateBasicCacheFollowsPasswordChange(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	st, err := store.Open(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	s := &Server{Config: config.Config{AuthCacheTime: 60}, Store: st}
+	if err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		return st.CreateUser(ctx, tx, "bob", "secret", false)
+	}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	try := func(pass string) bool {
+		req := withAuthMemo(httptest.NewRequest("GET", "http://localhost/admin", nil))
+		req.SetBasicAuth("bob", pass)
+		_, ok := s.authenticate(req, "basic")
+		return ok
+	}
+	if !try("secret") {
+		t.Fatalf("valid password rejected")
+	}
+
+	// Replace the account behind the server's back, the way a restore or
+	// another process would.
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.ExecContext(ctx, "DELETE FROM users WHERE username = 'bob'"); err != nil {
+		t.Fatalf("delete user: %v", err)
+	}
+	if try("secret") {
+		t.Fatalf("cached password accepted for a deleted user")
+	}
+	if err := st.WithTx(ctx, false, func(tx store.Tx) error {
+		return st.CreateUser(ctx, tx, "bob", "changed", true)
+	}); err != nil {
+		t.Fatalf("recreate user: %v", err)
+	}
+	if try("secret") {
+		t.Fatalf("old password accepted after a password change")
+	}
+	req := withAuthMemo(httptest.NewRequest("GET", "http://localhost/admin", nil))
+	req.SetBasicAuth("bob", "changed")
+	if u, ok := s.authenticate(req, "basic"); !ok || !u.IsAdmin {
+		t.Fatalf("new password: ok = %v, user = %+v", ok, u)
+	}
+	// A cached login reports the account as it is stored now.
+	req = withAuthMemo(httptest.NewRequest("GET", "http://localhost/admin", nil))
+	req.SetBasicAuth("bob", "changed")
+	if u, ok := s.authenticate(req, "basic"); !ok || !u.IsAdmin {
+		t.Fatalf("cached login: ok = %v, user = %+v", ok, u)
+	}
+}
+
+func TestAuthenticateDigestRejectsReplay(t *testing.T) {
+	s := newMoveTestServer(t)
+	ctx := context.Background()
+	if err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		if err := s.Store.CreateUser(ctx, tx, "bob", "secret", false); err != nil {
+			return err
+		}
+		return s.Store.SetUserDigestHA1(ctx, tx, "bob", computeDigestHA1("bob", "secret"))
+	}); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	nonce := generateNonce()
+	header := func(nc string) string {
+		ha2 := md5Hex("GET:/admin")
+		resp := md5Hex(computeDigestHA1("bob", "secret") + ":" + nonce + ":" + nc + ":abc:auth:" + ha2)
+		return fmt.Sprintf(`Digest username="bob", realm="%s", nonce="%s", uri="/admin", qop=auth, nc=%s, cnonce="abc", response="%s"`, authRealm, nonce, nc, resp)
+	}
+	try := func(nc string) bool {
+		req := withAuthMemo(httptest.NewRequest("GET", "http://localhost/admin", nil))
+		req.Header.Set("Authorization", header(nc))
+		if _, ok := s.authenticate(req, "digest"); !ok {
+			return false
+		}
+		// A second check within the same request must not count as a replay.
+		_, ok := s.authenticate(req, "digest")
+		return ok
+	}
+	if !try("00000001") {
+		t.Fatalf("valid digest rejected")
+	}
+	if try("00000001") {
+		t.Fatalf("replayed digest accepted")
+	}
+	if !try("00000002") {
+		t.Fatalf("next nonce-count rejected")
+	}
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/backup"
+	"cupsgolang/internal/logging"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+const opBackupServer = goipp.Op(model.OpBackupServer)
+
+// handleBackupServer streams a backup archive (see package backup) after the
+// IPP response. The boolean operation attribute "include-spool" adds the
+// spooled documents. Only administrators may take a backup: the archive holds
+// password hashes and the TLS key.
+func (s *Server) handleBackupServer(ctx context.Context, r *http.Request, req *goipp.Message) (*goipp.Message, io.ReadCloser, error) {
+	// An anonymous location still needs an identity for this operation, so
+	// fall back to DefaultAuthType and then Basic.
+	authType := s.authTypeForRequest(r, "")
+	if authType == "" || strings.EqualFold(authType, "none") {
+		authType = strings.TrimSpace(s.currentConfig().DefaultAuthType)
+	}
+	if authType == "" || strings.EqualFold(authType, "none") {
+		authType = "Basic"
+	}
+	u, ok := s.authenticate(r, authType)
+	if !ok {
+		return nil, nil, &ippHTTPError{status: http.StatusUnauthorized, authType: authType}
+	}
+	if !u.IsAdmin {
+		resp := goipp.NewResponse(req.Version, goipp.StatusErrorNotAuthorized, req.RequestID)
+		addOperationDefaults(resp)
+		return resp, nil, nil
+	}
+
+	// Only the SQLite store has files to archive.
+	st, ok := s.Store.(*store.Store)
+	if !ok {
+		resp := goipp.NewResponse(req.Version, goipp.StatusErrorOperationNotSupported, req.RequestID)
+		addOperationDefaults(resp)
+		resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String("Backups require the SQLite store")))
+		return resp, nil, nil
+	}
+
+	opts := backup.Options{IncludeSpool: attrBool(req.Operation, "include-spool")}
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := backup.Create(ctx, st, s.currentConfig(), pw, opts)
+		if err != nil {
+			logging.Logger().Error("Backup failed", "err", err)
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	go func() {
+		// Unblock the writer if the client goes away before reading it all.
+		<-ctx.Done()
+		_ = pr.CloseWithError(ctx.Err())
+	}()
+
+	resp := goipp.NewResponse(req.Version, goipp.StatusOk, req.RequestID)
+	addOperationDefaults(resp)
+	return resp, pr, nil
+}
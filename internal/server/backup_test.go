@@ -0,0 +1,61 @@
+package server
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+func TestBackupServerRequiresAdmin(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Config.DefaultAuthType = "Basic"
+	t.Setenv("CUPS_ADMIN_USER", "root")
+	t.Setenv("CUPS_ADMIN_PASS", "secret")
+	if err := s.Store.EnsureAdminUser(context.Background()); err != nil {
+		t.Fatalf("ensure admin: %v", err)
+	}
+	req := goipp.NewRequest(goipp.DefaultVersion, opBackupServer, 1)
+
+	anon := httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil)
+	if _, _, err := s.handleBackupServer(anon.Context(), anon, req); err == nil {
+		t.Fatalf("expected unauthenticated backup to be challenged")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil)
+	r.SetBasicAuth("root", "secret")
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	resp, payload, err := s.handleBackupServer(ctx, r, req)
+	if err != nil {
+		t.Fatalf("handleBackupServer: %v", err)
+	}
+	if goipp.Status(resp.Code) != goipp.StatusOk || payload == nil {
+		t.Fatalf("expected archive, got status %v", goipp.Status(resp.Code))
+	}
+	defer payload.Close()
+	gz, err := gzip.NewReader(payload)
+	if err != nil {
+		t.Fatalf("archive is not gzip: %v", err)
+	}
+	tr := tar.NewReader(gz)
+	names := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("read archive: %v", err)
+		}
+		names[hdr.Name] = true
+	}
+	if !names["manifest.json"] || !names["db/cupsgolang.db"] {
+		t.Fatalf("archive is missing manifest or database: %v", names)
+	}
+}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -12,6 +11,7 @@ import (
 
 	"cupsgolang/internal/config"
 	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
 )
 
 func TestHandleCancelJobsAllPrintersScopeRespectsOwner(t *testing.T) {
@@ -22,7 +22,7 @@ func TestHandleCancelJobsAllPrintersScopeRespectsOwner(t *testing.T) {
 	var aliceJob model.Job
 	var bobJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -48,7 +48,7 @@ func TestHandleCancelJobsAllPrintersScopeRespectsOwner(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -78,7 +78,7 @@ func TestHandleCancelJobsReturnsNotAuthorizedWhenNoOwnedJobs(t *testing.T) {
 	var printer model.Printer
 	var bobJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -100,7 +100,7 @@ func TestHandleCancelJobsReturnsNotAuthorizedWhenNoOwnedJobs(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorNotAuthorized)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, bobJob.ID)
 		if err != nil {
 			return err
@@ -123,7 +123,7 @@ func TestHandleCancelJobsWithJobIDsRespectsDestinationScope(t *testing.T) {
 	var lab model.Printer
 	var labJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		office, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -159,7 +159,7 @@ func TestHandleCancelJobsWithJobIDsRejectsUnauthorized(t *testing.T) {
 	var printer model.Printer
 	var bobJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -191,7 +191,7 @@ func TestHandleCancelJobsWithJobIDsCancelsSelectedJob(t *testing.T) {
 	var aliceJob model.Job
 	var otherJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -218,7 +218,7 @@ func TestHandleCancelJobsWithJobIDsCancelsSelectedJob(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -249,7 +249,7 @@ func TestHandleCancelJobsAllPrintersScopeMixedOwnership(t *testing.T) {
 	var bobJob model.Job
 	var aliceJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		office, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -279,7 +279,7 @@ func TestHandleCancelJobsAllPrintersScopeMixedOwnership(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -310,7 +310,7 @@ func TestHandleCancelJobsClassScopeMixedMembershipOwnership(t *testing.T) {
 	var bobJob model.Job
 	var aliceJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		office, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -343,7 +343,7 @@ func TestHandleCancelJobsClassScopeMixedMembershipOwnership(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -374,7 +374,7 @@ func TestHandleCancelJobsClassScopeViaPrintersPath(t *testing.T) {
 	var bobJob model.Job
 	var aliceJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		office, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -407,7 +407,7 @@ func TestHandleCancelJobsClassScopeViaPrintersPath(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -437,7 +437,7 @@ func TestHandleCancelJobsDefaultDoesNotPurgeCompletedJobs(t *testing.T) {
 	var activeJob model.Job
 	var completedJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -472,7 +472,7 @@ func TestHandleCancelJobsDefaultDoesNotPurgeCompletedJobs(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, activeJob.ID)
 		if err != nil {
 			return err
@@ -516,7 +516,7 @@ func TestHandleCancelJobsMyJobsFlagDoesNotRequireRequestingUserName(t *testing.T
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		printer, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
 			return err
@@ -551,7 +551,7 @@ func TestHandleCancelJobsInvalidPrinterURIFallsBackToAllPrinters(t *testing.T) {
 	var lab model.Printer
 	var officeJob model.Job
 	var labJob model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		office, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -586,7 +586,7 @@ func TestHandleCancelJobsInvalidPrinterURIFallsBackToAllPrinters(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, officeJob.ID)
 		if err != nil {
 			return err
@@ -653,7 +653,7 @@ func TestHandleCancelMyJobsUsesAuthenticatedUserBeforeRequestingUserName(t *test
 	var printer model.Printer
 	var aliceJob model.Job
 	var bobJob model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if err := s.Store.CreateUser(ctx, tx, "alice", "alicepass", false); err != nil {
 			return err
 		}
@@ -692,7 +692,7 @@ func TestHandleCancelMyJobsUsesAuthenticatedUserBeforeRequestingUserName(t *test
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -722,7 +722,7 @@ func TestHandleCancelMyJobsClassScopeCancelsAcrossClassMembers(t *testing.T) {
 	var lab model.Printer
 	var officeJob model.Job
 	var labJob model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		office, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -760,7 +760,7 @@ func TestHandleCancelMyJobsClassScopeCancelsAcrossClassMembers(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, officeJob.ID)
 		if err != nil {
 			return err
@@ -790,7 +790,7 @@ func TestHandleCancelMyJobsInvalidPrinterURIFallsBackToAllPrinters(t *testing.T)
 	var lab model.Printer
 	var officeJob model.Job
 	var labJob model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		office, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -825,7 +825,7 @@ func TestHandleCancelMyJobsInvalidPrinterURIFallsBackToAllPrinters(t *testing.T)
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, officeJob.ID)
 		if err != nil {
 			return err
@@ -855,7 +855,7 @@ func TestHandleCancelMyJobsIgnoresPurgeAttribute(t *testing.T) {
 	var activeJob model.Job
 	var completedJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -891,7 +891,7 @@ func TestHandleCancelMyJobsIgnoresPurgeAttribute(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, activeJob.ID)
 		if err != nil {
 			return err
@@ -920,7 +920,7 @@ func TestHandleCancelMyJobsWithJobIDsRejectsOtherUsersJobAsNotFound(t *testing.T
 	var printer model.Printer
 	var aliceJob model.Job
 	var bobJob model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -952,7 +952,7 @@ func TestHandleCancelMyJobsWithJobIDsRejectsOtherUsersJobAsNotFound(t *testing.T
 		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorNotFound)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -981,7 +981,7 @@ func TestHandleCancelMyJobsWithJobIDsCancelsSelectedOwnedJobs(t *testing.T) {
 	var printer model.Printer
 	var firstJob model.Job
 	var secondJob model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -1013,7 +1013,7 @@ func TestHandleCancelMyJobsWithJobIDsCancelsSelectedOwnedJobs(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, firstJob.ID)
 		if err != nil {
 			return err
@@ -1061,7 +1061,7 @@ func TestHandlePurgeJobsMyJobsPurgesOnlyRequestingUsersJobs(t *testing.T) {
 	var printer model.Printer
 	var aliceJob model.Job
 	var bobJob model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -1094,7 +1094,7 @@ func TestHandlePurgeJobsMyJobsPurgesOnlyRequestingUsersJobs(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		if _, err := s.Store.GetJob(ctx, tx, aliceJob.ID); err == nil {
 			t.Fatalf("alice job still exists after purge")
 		}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +11,7 @@ import (
 	goipp "github.com/OpenPrinting/goipp"
 
 	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
 )
 
 func TestHandleCancelJobCompletedWithoutPurgeReturnsNotPossible(t *testing.T) {
@@ -20,7 +20,7 @@ func TestHandleCancelJobCompletedWithoutPurgeReturnsNotPossible(t *testing.T) {
 
 	var printer model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -46,7 +46,7 @@ func TestHandleCancelJobCompletedWithoutPurgeReturnsNotPossible(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorNotPossible)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		got, err := s.Store.GetJob(ctx, tx, job.ID)
 		if err != nil {
 			return err
@@ -67,7 +67,7 @@ func TestHandleCancelJobCompletedWithPurgeDeletesJob(t *testing.T) {
 
 	var printer model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -93,7 +93,7 @@ func TestHandleCancelJobCompletedWithPurgeDeletesJob(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		_, err := s.Store.GetJob(ctx, tx, job.ID)
 		if err == nil {
 			t.Fatalf("job still exists after purge")
@@ -128,7 +128,7 @@ func TestHandleCancelJobCurrentJobNotFoundReturnsNotPossible(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		_, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		return err
 	})
@@ -158,7 +158,7 @@ func TestHandleCancelJobIgnoresPurgeJobsAttribute(t *testing.T) {
 
 	var printer model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -190,7 +190,7 @@ func TestHandleCancelJobIgnoresPurgeJobsAttribute(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorNotPossible)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		_, err := s.Store.GetJob(ctx, tx, job.ID)
 		return err
 	})
@@ -205,7 +205,7 @@ func TestHandleCancelJobRejectsNonDestinationPrinterURIPath(t *testing.T) {
 
 	var printer model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -240,7 +240,7 @@ func TestHandleCancelJobJobURIWithTrailingPathUsesLeadingJobID(t *testing.T) {
 
 	var printer model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -267,7 +267,7 @@ func TestHandleCancelJobJobURIWithTrailingPathUsesLeadingJobID(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		got, err := s.Store.GetJob(ctx, tx, job.ID)
 		if err != nil {
 			return err
@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"cupsgolang/internal/metrics"
+)
+
+// connRetryAfter is the Retry-After value, in seconds, sent to clients
+// turned away by MaxClients or MaxClientsPerHost.
+const connRetryAfter = "30"
+
+const (
+	// connRejectTimeout is how long a connection over a limit has to send
+	// its request and read the 503 before it is closed.
+	connRejectTimeout = 5 * time.Second
+	// connRejectBacklog is how many connections over a limit may wait for
+	// their 503 at once; beyond it they are closed as soon as accepted.
+	connRejectBacklog = 64
+)
+
+// ConnLimiter enforces MaxClients and MaxClientsPerHost. Listener counts
+// the connections accepted on a listener against the limits. A connection
+// over a limit is still accepted, so that Handler can answer its first
+// request with 503 Service Unavailable and Retry-After (over TLS as well),
+// and the connection is closed after that response. Rejected connections
+// are not counted against the limits; they get a short deadline so idle
+// ones cannot pile up, and past a backlog they are closed outright.
+type ConnLimiter struct {
+	mu            sync.Mutex
+	maxClients    int
+	maxPerHost    int
+	open          int
+	perHost       map[string]int
+	rejected      int
+	rejectTimeout time.Duration
+	rejectBacklog int
+}
+
+// NewConnLimiter returns a limiter; a limit of zero or less means none.
+func NewConnLimiter(maxClients, maxPerHost int) *ConnLimiter {
+	return &ConnLimiter{
+		maxClients:    maxClients,
+		maxPerHost:    maxPerHost,
+		perHost:       map[string]int{},
+		rejectTimeout: connRejectTimeout,
+		rejectBacklog: connRejectBacklog,
+	}
+}
+
+// SetLimits changes the limits for new connections; open connections are
+// kept.
+func (l *ConnLimiter) SetLimits(maxClients, maxPerHost int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxClients, l.maxPerHost = maxClients, maxPerHost
+}
+
+// Open returns the number of connections counted against the limits.
+func (l *ConnLimiter) Open() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.open
+}
+
+// Listener wraps ln so its connections are counted. Wrap the TCP listener,
+// below any TLS listener, so a connection is counted from accept to close
+// whatever happens to its handshake.
+func (l *ConnLimiter) Listener(ln net.Listener) net.Listener {
+	return &limitListener{Listener: ln, limiter: l}
+}
+
+// ConnContext is an http.Server ConnContext hook that makes the
+// connection's admission visible to Handler.
+func (l *ConnLimiter) ConnContext(ctx context.Context, c net.Conn) context.Context {
+	for c != nil {
+		switch v := c.(type) {
+		case *limitedConn:
+			return context.WithValue(ctx, limitedConnKey{}, v)
+		case interface{ NetConn() net.Conn }:
+			c = v.NetConn()
+		default:
+			return ctx
+		}
+	}
+	return ctx
+}
+
+// Handler answers requests on connections over a limit with 503.
+func (l *ConnLimiter) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c, _ := r.Context().Value(limitedConnKey{}).(*limitedConn); c != nil && c.rejected != "" {
+			metrics.ConnectionsRejected.Inc(c.rejected)
+			w.Header().Set("Retry-After", connRetryAfter)
+			w.Header().Set("Connection", "close")
+			http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// admit counts c against the limits, or marks it rejected. It returns nil
+// when c is over a limit and the rejected backlog is full, in which case
+// the caller closes it without a response.
+func (l *ConnLimiter) admit(c net.Conn) *limitedConn {
+	host := c.RemoteAddr().String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	lc := &limitedConn{Conn: c, limiter: l, host: host}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case l.maxClients > 0 && l.open >= l.maxClients:
+		lc.rejected = "MaxClients"
+	case l.maxPerHost > 0 && l.perHost[host] >= l.maxPerHost:
+		lc.rejected = "MaxClientsPerHost"
+	default:
+		l.open++
+		l.perHost[host]++
+		return lc
+	}
+	if l.rejected >= l.rejectBacklog {
+		metrics.ConnectionsRejected.Inc(lc.rejected)
+		return nil
+	}
+	l.rejected++
+	// The server's own read and write deadlines are far longer; keep
+	// them from extending this one.
+	lc.expires = time.Now().Add(l.rejectTimeout)
+	_ = c.SetDeadline(lc.expires)
+	return lc
+}
+
+func (l *ConnLimiter) release(c *limitedConn) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if c.rejected != "" {
+		l.rejected--
+		return
+	}
+	l.open--
+	if l.perHost[c.host]--; l.perHost[c.host] <= 0 {
+		delete(l.perHost, c.host)
+	}
+}
+
+type limitedConnKey struct{}
+
+type limitListener struct {
+	net.Listener
+	limiter *ConnLimiter
+}
+
+func (ln *limitListener) Accept() (net.Conn, error) {
+	for {
+		c, err := ln.Listener.Accept()
+		if err != nil {
+			return c, err
+		}
+		if lc := ln.limiter.admit(c); lc != nil {
+			return lc, nil
+		}
+		_ = c.Close()
+	}
+}
+
+type limitedConn struct {
+	net.Conn
+	limiter *ConnLimiter
+	host    string
+	// rejected names the limit the connection is over, if any, and
+	// expires is when a rejected connection is closed regardless.
+	rejected string
+	expires  time.Time
+	once     sync.Once
+}
+
+func (c *limitedConn) Close() error {
+	c.once.Do(func() { c.limiter.release(c) })
+	return c.Conn.Close()
+}
+
+// clamp keeps a deadline set by the HTTP server from outliving a rejected
+// connection's own.
+func (c *limitedConn) clamp(t time.Time) time.Time {
+	if c.rejected != "" && (t.IsZero() || t.After(c.expires)) {
+		return c.expires
+	}
+	return t
+}
+
+func (c *limitedConn) SetDeadline(t time.Time) error {
+	return c.Conn.SetDeadline(c.clamp(t))
+}
+
+func (c *limitedConn) SetReadDeadline(t time.Time) error {
+	return c.Conn.SetReadDeadline(c.clamp(t))
+}
+
+func (c *limitedConn) SetWriteDeadline(t time.Time) error {
+	return c.Conn.SetWriteDeadline(c.clamp(t))
+}
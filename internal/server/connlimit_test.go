@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func startLimitedServer(t *testing.T, limiter *ConnLimiter, handler http.Handler) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	hs := &http.Server{Handler: limiter.Handler(handler), ConnContext: limiter.ConnContext}
+	go hs.Serve(limiter.Listener(ln))
+	t.Cleanup(func() { hs.Close() })
+	return ln.Addr().String()
+}
+
+// get sends one keep-alive request on conn and returns the response.
+func get(t *testing.T, conn net.Conn, br *bufio.Reader) *http.Response {
+	t.Helper()
+	if _, err := io.WriteString(conn, "GET / HTTP/1.1\r\nHost: test\r\n\r\n"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestConnLimiterRejectsOverLimitWith503(t *testing.T) {
+	limiter := NewConnLimiter(2, 1)
+	addr := startLimitedServer(t, limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer first.Close()
+	if resp := get(t, first, bufio.NewReader(first)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("first connection status = %d", resp.StatusCode)
+	}
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer second.Close()
+	resp := get(t, second, bufio.NewReader(second))
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != connRetryAfter || !resp.Close {
+		t.Fatalf("second connection: status=%d Retry-After=%q close=%v", resp.StatusCode, resp.Header.Get("Retry-After"), resp.Close)
+	}
+	if n := limiter.Open(); n != 1 {
+		t.Fatalf("Open = %d, want 1", n)
+	}
+
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for limiter.Open() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("closed connection still counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	third, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer third.Close()
+	if resp := get(t, third, bufio.NewReader(third)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("third connection status = %d", resp.StatusCode)
+	}
+}
+
+// closedWithin reports whether the server closes conn within d.
+func closedWithin(conn net.Conn, d time.Duration) bool {
+	_ = conn.SetReadDeadline(time.Now().Add(d))
+	_, err := conn.Read(make([]byte, 1))
+	var ne net.Error
+	return err != nil && !(errors.As(err, &ne) && ne.Timeout())
+}
+
+func TestConnLimiterClosesIdleOverLimitConnections(t *testing.T) {
+	limiter := NewConnLimiter(1, 0)
+	limiter.rejectTimeout = 200 * time.Millisecond
+	limiter.rejectBacklog = 1
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	// ReadHeaderTimeout stands in for cupsd's Timeout (900s by default); it
+	// must not keep rejected connections alive.
+	hs := &http.Server{Handler: limiter.Handler(http.NotFoundHandler()), ConnContext: limiter.ConnContext, ReadHeaderTimeout: time.Minute}
+	go hs.Serve(limiter.Listener(ln))
+	t.Cleanup(func() { hs.Close() })
+	addr := ln.Addr().String()
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer first.Close()
+	if resp := get(t, first, bufio.NewReader(first)); resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("first connection status = %d", resp.StatusCode)
+	}
+
+	// An over-limit connection that never writes is closed after the
+	// reject timeout, not the server's header timeout.
+	idle, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer idle.Close()
+	// With the one reject slot taken, the next is closed straight away.
+	extra, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer extra.Close()
+	if !closedWithin(extra, 100*time.Millisecond) {
+		t.Fatal("connection beyond the reject backlog was not closed at once")
+	}
+	if !closedWithin(idle, 5*time.Second) {
+		t.Fatal("idle over-limit connection was not closed")
+	}
+	if n := limiter.Open(); n != 1 {
+		t.Fatalf("Open = %d, want 1", n)
+	}
+}
+
+func TestDeadlinesAllowSlowUploadsButNotStalls(t *testing.T) {
+	timeout := 300 * time.Millisecond
+	limiter := NewConnLimiter(0, 0)
+	addr := startLimitedServer(t, limiter, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = withDeadlines(w, r, timeout)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestTimeout)
+			return
+		}
+		io.WriteString(w, strings.TrimSpace(string(body)))
+	}))
+
+	upload := func(chunks int, pause time.Duration) (*http.Response, error) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		defer conn.Close()
+		io.WriteString(conn, "POST / HTTP/1.1\r\nHost: test\r\nContent-Length: "+strconv.Itoa(chunks)+"\r\n\r\n")
+		for i := 0; i < chunks; i++ {
+			time.Sleep(pause)
+			if _, err := io.WriteString(conn, "x"); err != nil {
+				break
+			}
+		}
+		return http.ReadResponse(bufio.NewReader(conn), nil)
+	}
+
+	// Six chunks 100ms apart take twice the timeout in total.
+	resp, err := upload(6, 100*time.Millisecond)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("slow upload: resp=%v err=%v", resp, err)
+	}
+	// A pause longer than the timeout fails the read.
+	resp, err = upload(2, time.Second)
+	if err == nil && resp.StatusCode == http.StatusOK {
+		t.Fatalf("stalled upload succeeded")
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// The http.Server only bounds reading the request headers. The body and the
+// response get inactivity deadlines of Timeout instead of a fixed total, so
+// a large Print-Job upload on a slow link goes on as long as data keeps
+// arriving, and a long-polling Get-Notifications can push its write deadline
+// past the wait.
+
+type deadlineKey struct{}
+
+type requestDeadlines struct {
+	rc      *http.ResponseController
+	timeout time.Duration
+}
+
+// extend moves the read and write deadlines to timeout+extra from now.
+// Errors are ignored: a ResponseWriter that cannot set deadlines (as in
+// tests) simply has none.
+func (d *requestDeadlines) extend(extra time.Duration) {
+	at := time.Now().Add(d.timeout + extra)
+	_ = d.rc.SetReadDeadline(at)
+	_ = d.rc.SetWriteDeadline(at)
+}
+
+// withDeadlines starts the request's deadlines and extends them whenever
+// body data arrives. A timeout of zero leaves the request without.
+func withDeadlines(w http.ResponseWriter, r *http.Request, timeout time.Duration) *http.Request {
+	if timeout <= 0 {
+		return r
+	}
+	d := &requestDeadlines{rc: http.NewResponseController(w), timeout: timeout}
+	d.extend(0)
+	if r.Body != nil && r.Body != http.NoBody {
+		r.Body = &deadlineReader{ReadCloser: r.Body, deadlines: d}
+	}
+	return r.WithContext(context.WithValue(r.Context(), deadlineKey{}, d))
+}
+
+// extendDeadline gives the request in ctx extra time on top of Timeout, for
+// handlers that hold the response back on purpose.
+func extendDeadline(ctx context.Context, extra time.Duration) {
+	if d, _ := ctx.Value(deadlineKey{}).(*requestDeadlines); d != nil {
+		d.extend(extra)
+	}
+}
+
+type deadlineReader struct {
+	io.ReadCloser
+	deadlines *requestDeadlines
+}
+
+func (b *deadlineReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		b.deadlines.extend(0)
+	}
+	return n, err
+}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net"
 	"os"
 	"strconv"
@@ -26,7 +25,7 @@ type Device struct {
 
 const deviceCacheTTL = 45 * time.Second
 
-func discoverDevices(ctx context.Context, st *store.Store, useCache bool) []Device {
+func discoverDevices(ctx context.Context, st store.Repository, useCache bool) []Device {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -36,7 +35,7 @@ func discoverDevices(ctx context.Context, st *store.Store, useCache bool) []Devi
 				return cached
 			}
 		}
-		_ = st.WithTx(ctx, false, func(tx *sql.Tx) error {
+		_ = st.WithTx(ctx, false, func(tx store.Tx) error {
 			_ = st.PruneDeviceCache(ctx, tx, 24*time.Hour)
 			return nil
 		})
@@ -54,12 +53,12 @@ func discoverDevices(ctx context.Context, st *store.Store, useCache bool) []Devi
 	return devices
 }
 
-func loadDeviceCache(ctx context.Context, st *store.Store) []Device {
+func loadDeviceCache(ctx context.Context, st store.Repository) []Device {
 	if st == nil {
 		return nil
 	}
 	items := []store.DeviceCacheEntry{}
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		items, err = st.ListDeviceCache(ctx, tx, deviceCacheTTL, 4096)
 		return err
@@ -84,12 +83,12 @@ func loadDeviceCache(ctx context.Context, st *store.Store) []Device {
 	return uniqueDevices(out)
 }
 
-func persistDeviceCache(ctx context.Context, st *store.Store, devices []Device) {
+func persistDeviceCache(ctx context.Context, st store.Repository, devices []Device) {
 	if st == nil || len(devices) == 0 {
 		return
 	}
 	now := time.Now().UTC()
-	_ = st.WithTx(ctx, false, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, false, func(tx store.Tx) error {
 		for _, d := range devices {
 			if strings.TrimSpace(d.URI) == "" {
 				continue
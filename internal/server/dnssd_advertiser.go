@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"net"
 	"sort"
@@ -16,6 +15,7 @@ import (
 
 	"cupsgolang/internal/config"
 	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
 )
 
 // DNSSDAdvertiser provides a CUPS-like DNS-SD (mDNS) broadcaster for shared queues.
@@ -63,7 +63,7 @@ func StartDNSSDAdvertiser(ctx context.Context, srv *Server) (*DNSSDAdvertiser, e
 	if srv == nil || srv.Store == nil {
 		return nil, nil
 	}
-	if !dnssdEnabled(srv.Config) {
+	if !dnssdEnabled(srv.currentConfig()) {
 		return nil, nil
 	}
 	if ctx == nil {
@@ -127,7 +127,7 @@ func (a *DNSSDAdvertiser) refresh(ctx context.Context) {
 		return
 	}
 
-	cfg := a.srv.Config
+	cfg := a.srv.currentConfig()
 	st := a.srv.Store
 	if !dnssdEnabled(cfg) || st == nil {
 		a.zone.SetServices(nil)
@@ -159,7 +159,7 @@ func (a *DNSSDAdvertiser) refresh(ctx context.Context) {
 	var classes []model.Class
 	memberMap := map[int64][]model.Printer{}
 
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		printers, err = st.ListPrinters(ctx, tx)
 		if err != nil {
@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/store"
+)
+
+func newFakeEverywherePrinter(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &goipp.Message{}
+		if err := req.Decode(r.Body); err != nil || goipp.Op(req.Code) != goipp.OpGetPrinterAttributes {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		resp := goipp.NewResponse(req.Version, goipp.StatusOk, req.RequestID)
+		resp.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+		resp.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en")))
+		resp.Printer.Add(goipp.MakeAttribute("printer-make-and-model", goipp.TagText, goipp.String("Acme LaserJet 9")))
+		resp.Printer.Add(goipp.MakeAttribute("printer-info", goipp.TagText, goipp.String("Acme in Room 12")))
+		resp.Printer.Add(goipp.MakeAttribute("printer-location", goipp.TagText, goipp.String("Room 12")))
+		var media []goipp.Value
+		for _, size := range [][2]int{{21000, 29700}, {21590, 27940}} {
+			var dims goipp.Collection
+			dims.Add(goipp.MakeAttribute("x-dimension", goipp.TagInteger, goipp.Integer(size[0])))
+			dims.Add(goipp.MakeAttribute("y-dimension", goipp.TagInteger, goipp.Integer(size[1])))
+			var col goipp.Collection
+			col.Add(goipp.MakeAttribute("media-size", goipp.TagBeginCollection, dims))
+			media = append(media, col)
+		}
+		resp.Printer.Add(goipp.MakeAttr("media-col-database", goipp.TagBeginCollection, media[0], media[1:]...))
+		resp.Printer.Add(goipp.MakeAttr("media-supported", goipp.TagKeyword, goipp.String("iso_a4_210x297mm"), goipp.String("na_letter_8.5x11in")))
+		resp.Printer.Add(goipp.MakeAttribute("media-default", goipp.TagKeyword, goipp.String("iso_a4_210x297mm")))
+		resp.Printer.Add(goipp.MakeAttr("document-format-supported", goipp.TagMimeType, goipp.String("application/pdf"), goipp.String("image/pwg-raster")))
+		data, err := resp.EncodeBytes()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", goipp.ContentType)
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func buildEverywhereRequest(name, deviceURI, location string) *goipp.Message {
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCupsAddModifyPrinter, 1)
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String("ipp://localhost/printers/"+name)))
+	if deviceURI != "" {
+		req.Printer.Add(goipp.MakeAttribute("device-uri", goipp.TagURI, goipp.String(deviceURI)))
+	}
+	if location != "" {
+		req.Printer.Add(goipp.MakeAttribute("printer-location", goipp.TagText, goipp.String(location)))
+	}
+	req.Printer.Add(goipp.MakeAttribute("ppd-name", goipp.TagName, goipp.String("everywhere")))
+	return req
+}
+
+func TestHandleCupsAddModifyPrinterEverywhereGeneratesPPD(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Config.PPDDir = t.TempDir()
+	ctx := context.Background()
+	device := "ipp" + strings.TrimPrefix(newFakeEverywherePrinter(t).URL, "http") + "/ipp/print"
+
+	resp, err := s.handleCupsAddModifyPrinter(ctx, httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), buildEverywhereRequest("Acme", device, "Lab"), nil)
+	if err != nil {
+		t.Fatalf("handleCupsAddModifyPrinter error: %v", err)
+	}
+	if got := goipp.Status(resp.Code); got != goipp.StatusOk {
+		t.Fatalf("status = %v, want %v (%s)", got, goipp.StatusOk, attrString(resp.Operation, "status-message"))
+	}
+
+	// Modifying without -v keeps the device URI and queries it again.
+	resp, err = s.handleCupsAddModifyPrinter(ctx, httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), buildEverywhereRequest("Acme", "", ""), nil)
+	if err != nil || goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("modify: %v %v", err, resp)
+	}
+
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		p, err := s.Store.GetPrinterByName(ctx, tx, "Acme")
+		if err != nil {
+			return err
+		}
+		if p.URI != device {
+			t.Errorf("device URI = %q, want %q", p.URI, device)
+		}
+		if p.Info != "Acme in Room 12" || p.Location != "Lab" {
+			t.Errorf("info, location = %q, %q", p.Info, p.Location)
+		}
+		if p.PPDName == "" || strings.EqualFold(p.PPDName, "everywhere") {
+			t.Fatalf("ppd name = %q, want a generated PPD", p.PPDName)
+		}
+		data, err := os.ReadFile(safePPDPath(s.Config.PPDDir, p.PPDName))
+		if err != nil {
+			return err
+		}
+		if !strings.Contains(string(data), "*ModelName:") || !strings.Contains(string(data), "*DefaultPageSize:") {
+			t.Errorf("generated PPD:\n%s", data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("verify printer: %v", err)
+	}
+}
+
+func TestHandleCupsAddModifyPrinterEverywhereNeedsIPP(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Config.PPDDir = t.TempDir()
+
+	resp, err := s.handleCupsAddModifyPrinter(context.Background(), httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), buildEverywhereRequest("Serial", "serial:/dev/ttyS0", ""), nil)
+	if err != nil {
+		t.Fatalf("handleCupsAddModifyPrinter error: %v", err)
+	}
+	if got := goipp.Status(resp.Code); got != goipp.StatusErrorNotPossible {
+		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorNotPossible)
+	}
+	if msg := attrString(resp.Operation, "status-message"); msg != errEverywhereNeedsIPP.Error() {
+		t.Fatalf("status-message = %q", msg)
+	}
+}
+
+func TestHandleCupsAddModifyPrinterEverywhereKeepsPPDOnFailure(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Config.PPDDir = t.TempDir()
+	ctx := context.Background()
+	device := "ipp" + strings.TrimPrefix(newFakeEverywherePrinter(t).URL, "http") + "/ipp/print"
+	// A preset without a name fails inside the store transaction, after
+	// the PPD has been generated.
+	badPreset := func(req *goipp.Message) *goipp.Message {
+		var col goipp.Collection
+		col.Add(goipp.MakeAttribute("sides", goipp.TagKeyword, goipp.String("one-sided")))
+		req.Printer.Add(goipp.MakeAttribute("job-presets-supported", goipp.TagBeginCollection, col))
+		return req
+	}
+	listPPDDir := func() []string {
+		entries, err := os.ReadDir(s.Config.PPDDir)
+		if err != nil {
+			t.Fatalf("read PPD dir: %v", err)
+		}
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.Name())
+		}
+		return names
+	}
+
+	resp, err := s.handleCupsAddModifyPrinter(ctx, httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), badPreset(buildEverywhereRequest("Acme", device, "")), nil)
+	if err != nil {
+		t.Fatalf("handleCupsAddModifyPrinter error: %v", err)
+	}
+	if got := goipp.Status(resp.Code); got != goipp.StatusErrorBadRequest {
+		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorBadRequest)
+	}
+	if names := listPPDDir(); len(names) != 0 {
+		t.Fatalf("failed add left %v in the PPD directory", names)
+	}
+
+	resp, err = s.handleCupsAddModifyPrinter(ctx, httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), buildEverywhereRequest("Acme", device, ""), nil)
+	if err != nil || goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("add: %v %v", err, resp)
+	}
+	ppdPath := safePPDPath(s.Config.PPDDir, "Acme.ppd")
+	const existing = "*PPD-Adobe: \"4.3\"\n*ModelName: \"Existing\"\n"
+	if err := os.WriteFile(ppdPath, []byte(existing), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	resp, err = s.handleCupsAddModifyPrinter(ctx, httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), badPreset(buildEverywhereRequest("Acme", "", "")), nil)
+	if err != nil {
+		t.Fatalf("handleCupsAddModifyPrinter error: %v", err)
+	}
+	if got := goipp.Status(resp.Code); got != goipp.StatusErrorBadRequest {
+		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorBadRequest)
+	}
+	if data, err := os.ReadFile(ppdPath); err != nil || string(data) != existing {
+		t.Fatalf("failed modify replaced the queue's PPD: %q %v", data, err)
+	}
+	if names := listPPDDir(); len(names) != 1 {
+		t.Fatalf("failed modify left %v in the PPD directory", names)
+	}
+}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,13 +9,14 @@ import (
 	goipp "github.com/OpenPrinting/goipp"
 
 	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
 )
 
 func TestHandleGetPrinterSupportedValuesIgnoresRequestedAttributesFilter(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		_, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		return err
 	})
@@ -56,7 +56,7 @@ func TestHandleGetPrinterSupportedValuesForClass(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		printer, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
 			return err
@@ -98,7 +98,7 @@ func TestHandleGetPrinterSupportedValuesClassAddressedViaPrintersPath(t *testing
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		printer, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
 			return err
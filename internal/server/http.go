@@ -1,39 +1,66 @@
 package server
 
 import (
-	"log"
 	"net"
 	"net/http"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"cupsgolang/internal/config"
+	"cupsgolang/internal/logging"
 	"cupsgolang/internal/spool"
 	"cupsgolang/internal/store"
 	"cupsgolang/internal/web"
 )
 
 type Server struct {
+	// Config and Policy are the settings the server starts with; Reload
+	// replaces them at runtime without touching these fields.
 	Config config.Config
-	Store  *store.Store
+	Store  store.Repository
 	Spool  spool.Spool
 	Policy config.Policy
+	// Reloader re-reads the configuration files (SIGHUP does the same) and
+	// is invoked by Restart-System. It is optional.
+	Reloader func() error
+
+	runtime        atomic.Pointer[runtimeConfig]
+	authGuardOnce  sync.Once
+	authGuardState *authGuard
 }
 
 func (s *Server) Handler() http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if s.Config.MaxRequestSize > 0 {
-			r.Body = http.MaxBytesReader(w, r.Body, s.Config.MaxRequestSize)
+		// The location checks below, and the operation checks made while
+		// serving the request, share one snapshot so a concurrent reload
+		// cannot mix old and new rules within them.
+		cfg, policy := s.currentConfig(), s.currentPolicy()
+		if header := serverHeader(cfg.ServerTokens); header != "" {
+			w.Header().Set("Server", header)
+		}
+		r = withDeadlines(w, r, time.Duration(cfg.Timeout)*time.Second)
+		limit := cfg.MaxRequestSize
+		if rule := policy.Match(r.URL.Path); rule != nil && rule.HasLimitRequestBody {
+			limit = rule.LimitRequestBody
+		}
+		if limit > 0 {
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
 		}
+		r = withAuthMemo(r)
+		r = withPolicySnapshot(r, policy)
 		remoteIP := r.RemoteAddr
 		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
 			remoteIP = host
 		}
-		if rule := s.Policy.Match(r.URL.Path); rule != nil {
-			if !s.Policy.Allowed(r.URL.Path, remoteIP) {
+		if rule := policy.Match(r.URL.Path); rule != nil {
+			if !policy.Allowed(r.URL.Path, remoteIP) {
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
-			if limit := s.Policy.LimitFor(r.URL.Path, r.Method); limit != nil {
+			if limit := policy.LimitFor(r.URL.Path, r.Method); limit != nil {
 				if limit.DenyAll {
 					http.Error(w, "Forbidden", http.StatusForbidden)
 					return
@@ -76,12 +103,14 @@ func (s *Server) Handler() http.Handler {
 			web.CupsHelpHandler().ServeHTTP(w, r)
 		case strings.HasPrefix(r.URL.Path, "/ui/"):
 			http.StripPrefix("/ui/", web.AssetHandler()).ServeHTTP(w, r)
+		case r.URL.Path == "/admin/audit":
+			s.handleAudit(w, r)
 		case r.URL.Path == "/admin" || r.URL.Path == "/admin/":
 			s.handleAdmin(w, r)
 		case r.URL.Path == "/classes" || r.URL.Path == "/classes/":
 			web.RenderClasses(w, r, s.Store)
 		case strings.HasPrefix(r.URL.Path, "/classes/"):
-			if r.Method == http.MethodPost {
+			if r.Method == http.MethodPost && !isIPP(r) {
 				s.handleClassPost(w, r)
 				return
 			}
@@ -89,15 +118,17 @@ func (s *Server) Handler() http.Handler {
 		case r.URL.Path == "/printers" || r.URL.Path == "/printers/":
 			s.handlePrinters(w, r)
 		case strings.HasPrefix(r.URL.Path, "/printers/"):
-			if r.Method == http.MethodPost {
+			if r.Method == http.MethodPost && !isIPP(r) {
 				s.handlePrinterPost(w, r)
 				return
 			}
 			s.handlePrinter(w, r)
+		case r.URL.Path == "/metrics":
+			s.handleMetrics(w, r)
 		case r.URL.Path == "/ipp/print":
 			s.handleIPP(w, r)
 		case r.URL.Path == "/jobs" || r.URL.Path == "/jobs/":
-			if r.Method == http.MethodPost {
+			if r.Method == http.MethodPost && !isIPP(r) {
 				s.handleJobsPost(w, r)
 				return
 			}
@@ -115,6 +146,10 @@ func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	if r.Method == http.MethodPost && isIPP(r) {
+		s.handleIPP(w, r)
+		return
+	}
 	http.Redirect(w, r, "/printers/", http.StatusFound)
 }
 
@@ -172,7 +207,7 @@ func (s *Server) handleIPP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if err := s.handleIPPRequest(w, r); err != nil {
-		log.Printf("IPP error: %v", err)
+		logging.Logger().Error("IPP error", "err", err, "path", r.URL.Path, "remote", remoteIPForRequest(r))
 	}
 }
 
@@ -180,3 +215,22 @@ func isIPP(r *http.Request) bool {
 	ct := r.Header.Get("Content-Type")
 	return strings.HasPrefix(ct, "application/ipp")
 }
+
+// serverHeader is the HTTP Server header for the ServerTokens directive.
+func serverHeader(tokens string) string {
+	switch strings.ToLower(strings.TrimSpace(tokens)) {
+	case "none":
+		return ""
+	case "productonly":
+		return "CUPS IPP"
+	case "major":
+		return "CUPS/2 IPP/2"
+	case "minor":
+		return "CUPS/2.4 IPP/2.1"
+	case "os":
+		return "CUPS/2.4.16 (" + runtime.GOOS + ") IPP/2.1"
+	case "full":
+		return "CUPS/2.4.16 (" + runtime.GOOS + "; " + runtime.GOARCH + ") IPP/2.1"
+	}
+	return "CUPS/2.4.16 IPP/2.1"
+}
@@ -34,6 +34,8 @@ import (
 
 	"cupsgolang/internal/backend"
 	"cupsgolang/internal/config"
+	"cupsgolang/internal/logging"
+	"cupsgolang/internal/metrics"
 	"cupsgolang/internal/model"
 	"cupsgolang/internal/spool"
 	"cupsgolang/internal/store"
@@ -62,7 +64,6 @@ var (
 	errNotAuthorized  = errors.New("not-authorized")
 	errNotPossible    = errors.New("not-possible")
 	errBadRequest     = errors.New("bad-request")
-	errTooManySubs    = errors.New("too-many-subscriptions")
 )
 
 var readOnlyJobAttrs = map[string]bool{
@@ -207,7 +208,7 @@ func (s *Server) defaultPolicyName() string {
 	if s == nil {
 		return "default"
 	}
-	if v := strings.TrimSpace(s.Config.DefaultPolicy); v != "" {
+	if v := strings.TrimSpace(s.currentConfig().DefaultPolicy); v != "" {
 		return v
 	}
 	return "default"
@@ -218,7 +219,7 @@ func (s *Server) policyNameForDefaultOptions(defaultOptionsJSON string) string {
 	return choiceOrDefault(defaultOpts["printer-op-policy"], supportedOpPolicies(), s.defaultPolicyName())
 }
 
-func (s *Server) resolveClassOrPrinterPolicy(ctx context.Context, tx *sql.Tx, printerURI string) (string, error) {
+func (s *Server) resolveClassOrPrinterPolicy(ctx context.Context, tx store.Tx, printerURI string) (string, error) {
 	if s == nil || s.Store == nil || tx == nil {
 		return s.defaultPolicyName(), nil
 	}
@@ -275,7 +276,7 @@ func (s *Server) ippPolicyCheckContexts(ctx context.Context, r *http.Request, re
 			return nil, nil
 		}
 		out := make([]ippPolicyCheckContext, 0, len(subIDs))
-		err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			for _, id := range subIDs {
 				sub, err := s.Store.GetSubscription(ctx, tx, id)
 				if err != nil {
@@ -326,7 +327,7 @@ func (s *Server) ippPolicyCheckContexts(ctx context.Context, r *http.Request, re
 		if subID == 0 {
 			return []ippPolicyCheckContext{ctxItem}, nil
 		}
-		err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			sub, err := s.Store.GetSubscription(ctx, tx, subID)
 			if err != nil {
 				return err
@@ -382,7 +383,7 @@ func (s *Server) ippPolicyCheckContexts(ctx context.Context, r *http.Request, re
 			// Let handler return bad-request/not-found for invalid explicit job refs.
 			return nil, nil
 		}
-		err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			pol, err := s.resolveClassOrPrinterPolicy(ctx, tx, destURI)
 			if err != nil {
 				return err
@@ -407,7 +408,7 @@ func (s *Server) ippPolicyCheckContexts(ctx context.Context, r *http.Request, re
 	}
 
 	if jobID != 0 {
-		err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			job, err := s.Store.GetJob(ctx, tx, jobID)
 			if err != nil {
 				return err
@@ -433,7 +434,7 @@ func (s *Server) ippPolicyCheckContexts(ctx context.Context, r *http.Request, re
 
 	// Destination-based operations: printer-uri identifies printer/class op policy.
 	if printerURI := strings.TrimSpace(attrString(req.Operation, "printer-uri")); printerURI != "" {
-		err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			pol, err := s.resolveClassOrPrinterPolicy(ctx, tx, printerURI)
 			if err == nil {
 				ctxItem.policyName = pol
@@ -457,8 +458,9 @@ func (s *Server) enforceIPPOpPolicy(ctx context.Context, r *http.Request, req *g
 	if s == nil || req == nil {
 		return nil
 	}
+	policy := s.requestPolicy(r)
 	// No parsed policies -> nothing to enforce.
-	if len(s.Policy.PolicyLimits) == 0 {
+	if len(policy.PolicyLimits) == 0 {
 		return nil
 	}
 
@@ -474,16 +476,16 @@ func (s *Server) enforceIPPOpPolicy(ctx context.Context, r *http.Request, req *g
 		if policyName == "" {
 			policyName = s.defaultPolicyName()
 		}
-		limit := s.Policy.PolicyLimitFor(policyName, opName)
+		limit := policy.PolicyLimitFor(policyName, opName)
 		if limit == nil && !strings.EqualFold(policyName, s.defaultPolicyName()) {
 			// Fallback to the default policy name when a queue references an unknown policy.
-			limit = s.Policy.PolicyLimitFor(s.defaultPolicyName(), opName)
+			limit = policy.PolicyLimitFor(s.defaultPolicyName(), opName)
 			policyName = s.defaultPolicyName()
 		}
 		if limit == nil {
 			continue
 		}
-		if limit.DenyAll || !s.Policy.AllowedByLimit(limit, remoteIP) {
+		if limit.DenyAll || !policy.AllowedByLimit(limit, remoteIP) {
 			return &ippHTTPError{status: http.StatusForbidden}
 		}
 		if !limitRequiresAuth(limit) {
@@ -492,7 +494,7 @@ func (s *Server) enforceIPPOpPolicy(ctx context.Context, r *http.Request, req *g
 
 		authType := s.normalizeAuthType(limit.AuthType)
 		if authType == "" {
-			authType = strings.TrimSpace(s.Config.DefaultAuthType)
+			authType = strings.TrimSpace(s.currentConfig().DefaultAuthType)
 		}
 
 		u, ok := s.authenticateUser(ctx, r, authType)
@@ -512,18 +514,19 @@ func (s *Server) enforceHTTPLocationPolicy(ctx context.Context, r *http.Request)
 		return nil
 	}
 	remoteIP := remoteIPForRequest(r)
-	if rule := s.Policy.Match(r.URL.Path); rule != nil {
-		if !s.Policy.Allowed(r.URL.Path, remoteIP) {
+	policy := s.requestPolicy(r)
+	if rule := policy.Match(r.URL.Path); rule != nil {
+		if !policy.Allowed(r.URL.Path, remoteIP) {
 			return &ippHTTPError{status: http.StatusForbidden}
 		}
-		if limit := s.Policy.LimitFor(r.URL.Path, r.Method); limit != nil {
-			if limit.DenyAll || !s.Policy.AllowedByLimit(limit, remoteIP) {
+		if limit := policy.LimitFor(r.URL.Path, r.Method); limit != nil {
+			if limit.DenyAll || !policy.AllowedByLimit(limit, remoteIP) {
 				return &ippHTTPError{status: http.StatusForbidden}
 			}
 			if limitRequiresAuth(limit) {
 				authType := s.normalizeAuthType(limit.AuthType)
 				if authType == "" {
-					authType = strings.TrimSpace(s.Config.DefaultAuthType)
+					authType = strings.TrimSpace(s.currentConfig().DefaultAuthType)
 				}
 				u, ok := s.authenticateUser(ctx, r, authType)
 				if !ok {
@@ -536,7 +539,7 @@ func (s *Server) enforceHTTPLocationPolicy(ctx context.Context, r *http.Request)
 		} else if locationRequiresAuth(rule) {
 			authType := s.normalizeAuthType(rule.AuthType)
 			if authType == "" {
-				authType = strings.TrimSpace(s.Config.DefaultAuthType)
+				authType = strings.TrimSpace(s.currentConfig().DefaultAuthType)
 			}
 			u, ok := s.authenticateUser(ctx, r, authType)
 			if !ok {
@@ -564,6 +567,14 @@ func (s *Server) handleIPPRequest(w http.ResponseWriter, r *http.Request) error
 
 	op := goipp.Op(req.Code)
 	ctx := r.Context()
+	logger := logging.Logger().With("request-id", req.RequestID, "operation", op.String())
+	logger.Debug("IPP request", "remote", remoteIPForRequest(r), "path", r.URL.Path)
+	start := time.Now()
+	metricStatus := "unknown"
+	defer func() {
+		metrics.IPPOperations.Inc(op.String(), metricStatus)
+		metrics.IPPOperationDuration.ObserveSince(start, op.String(), metricStatus)
+	}()
 	if err := s.enforceHTTPLocationPolicy(ctx, r); err != nil {
 		var httpErr *ippHTTPError
 		if errors.As(err, &httpErr) {
@@ -574,6 +585,7 @@ func (s *Server) handleIPPRequest(w http.ResponseWriter, r *http.Request) error
 			if msg == "" {
 				msg = http.StatusText(httpErr.status)
 			}
+			metricStatus = "http-" + strconv.Itoa(httpErr.status)
 			http.Error(w, msg, httpErr.status)
 			return nil
 		}
@@ -586,6 +598,7 @@ func (s *Server) handleIPPRequest(w http.ResponseWriter, r *http.Request) error
 		resp := goipp.NewResponse(req.Version, goipp.StatusErrorForbidden, req.RequestID)
 		addOperationDefaults(resp)
 		resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String("Only local users can create a local printer.")))
+		metricStatus = goipp.StatusErrorForbidden.String()
 		w.Header().Set("Content-Type", goipp.ContentType)
 		w.WriteHeader(http.StatusOK)
 		_ = resp.Encode(w)
@@ -602,12 +615,18 @@ func (s *Server) handleIPPRequest(w http.ResponseWriter, r *http.Request) error
 			if msg == "" {
 				msg = http.StatusText(httpErr.status)
 			}
+			metricStatus = "http-" + strconv.Itoa(httpErr.status)
 			http.Error(w, msg, httpErr.status)
 			return nil
 		}
 		return err
 	}
 
+	var finishAudit func(always bool)
+	if isAuditedOp(op) {
+		finishAudit = s.beginAudit(r, requestingUserName(&req, r), op.String(), ippAuditTarget(&req))
+	}
+
 	var resp *goipp.Message
 	var payload []byte
 	var payloadReader io.ReadCloser
@@ -728,6 +747,8 @@ func (s *Server) handleIPPRequest(w http.ResponseWriter, r *http.Request) error
 		resp, err = s.handleCupsAuthenticateJob(ctx, r, &req)
 	case goipp.OpCupsGetDocument:
 		resp, payloadReader, err = s.handleCupsGetDocument(ctx, r, &req)
+	case opBackupServer:
+		resp, payloadReader, err = s.handleBackupServer(ctx, r, &req)
 	default:
 		resp = goipp.NewResponse(req.Version, goipp.StatusErrorOperationNotSupported, req.RequestID)
 		addOperationDefaults(resp)
@@ -743,12 +764,19 @@ func (s *Server) handleIPPRequest(w http.ResponseWriter, r *http.Request) error
 			if msg == "" {
 				msg = http.StatusText(httpErr.status)
 			}
+			metricStatus = "http-" + strconv.Itoa(httpErr.status)
 			http.Error(w, msg, httpErr.status)
 			return nil
 		}
+		logger.Error("IPP operation failed", "err", err)
 		resp = goipp.NewResponse(req.Version, goipp.StatusErrorInternal, req.RequestID)
 		addOperationDefaults(resp)
 	}
+	metricStatus = goipp.Status(resp.Code).String()
+	logger.Debug("IPP response", "status", metricStatus)
+	if finishAudit != nil && goipp.Status(resp.Code) < goipp.StatusRedirectionOtherSite {
+		finishAudit(true)
+	}
 
 	w.Header().Set("Content-Type", goipp.ContentType)
 	w.WriteHeader(http.StatusOK)
@@ -812,16 +840,16 @@ func (s *Server) handleGetPrinterAttributes(ctx context.Context, r *http.Request
 	addOperationDefaults(resp)
 	if dest.IsClass {
 		var members []model.Printer
-		_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			var err error
 			members, err = s.Store.ListClassMembers(ctx, tx, dest.Class.ID)
 			return err
 		})
 		authInfo := s.authInfoRequiredForDestination(true, dest.Class.Name, dest.Class.DefaultOptions)
-		addClassAttributes(ctx, resp, dest.Class, members, r, req, s.Store, s.Config, authInfo)
+		addClassAttributes(ctx, resp, dest.Class, members, r, req, s.Store, s.currentConfig(), authInfo)
 	} else {
 		authInfo := s.authInfoRequiredForDestination(false, dest.Printer.Name, dest.Printer.DefaultOptions)
-		addPrinterAttributes(ctx, resp, dest.Printer, r, req, s.Store, s.Config, authInfo)
+		addPrinterAttributes(ctx, resp, dest.Printer, r, req, s.Store, s.currentConfig(), authInfo)
 	}
 	return resp, nil
 }
@@ -837,7 +865,7 @@ func (s *Server) handleGetPrinterSupportedValues(ctx context.Context, r *http.Re
 	isClass := dest.IsClass
 	printer := dest.Printer
 	if isClass {
-		_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			members, err := s.Store.ListClassMembers(ctx, tx, dest.Class.ID)
 			if err != nil {
 				return err
@@ -894,7 +922,7 @@ func (s *Server) handleSetPrinterAttributes(ctx context.Context, r *http.Request
 		orgUnitPtr = &orgUnitVal
 	}
 
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if dest.IsClass {
 			return s.Store.UpdateClassAttributes(ctx, tx, dest.Class.ID, infoPtr, locPtr)
 		}
@@ -908,7 +936,7 @@ func (s *Server) handleSetPrinterAttributes(ctx context.Context, r *http.Request
 	resp := goipp.NewResponse(req.Version, goipp.StatusOk, req.RequestID)
 	addOperationDefaults(resp)
 	authInfo := s.authInfoRequiredForDestination(false, updated.Name, updated.DefaultOptions)
-	addPrinterAttributes(ctx, resp, updated, r, req, s.Store, s.Config, authInfo)
+	addPrinterAttributes(ctx, resp, updated, r, req, s.Store, s.currentConfig(), authInfo)
 	return resp, nil
 }
 
@@ -916,7 +944,7 @@ func (s *Server) handleCupsGetPrinters(ctx context.Context, r *http.Request, req
 	var printers []model.Printer
 	var classes []model.Class
 	memberMap := map[int64][]model.Printer{}
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		printers, err = s.Store.ListPrinters(ctx, tx)
 		if err != nil {
@@ -1050,13 +1078,13 @@ func (s *Server) handleCupsGetPrinters(ctx context.Context, r *http.Request, req
 		}
 		if e.isClass {
 			authInfo := s.authInfoRequiredForDestination(true, e.class.Name, e.class.DefaultOptions)
-			attrs := classAttributesWithMembers(ctx, e.class, e.members, r, req, s.Store, s.Config, authInfo)
+			attrs := classAttributesWithMembers(ctx, e.class, e.members, r, req, s.Store, s.currentConfig(), authInfo)
 			groups = append(groups, goipp.Group{Tag: goipp.TagPrinterGroup, Attrs: attrs})
 			count++
 			continue
 		}
 		authInfo := s.authInfoRequiredForDestination(false, e.printer.Name, e.printer.DefaultOptions)
-		attrs := buildPrinterAttributes(ctx, e.printer, r, req, s.Store, s.Config, authInfo)
+		attrs := buildPrinterAttributes(ctx, e.printer, r, req, s.Store, s.currentConfig(), authInfo)
 		groups = append(groups, goipp.Group{Tag: goipp.TagPrinterGroup, Attrs: attrs})
 		count++
 	}
@@ -1068,7 +1096,7 @@ func (s *Server) handleCupsGetClasses(ctx context.Context, r *http.Request, req
 	var classes []model.Class
 	printerCount := 0
 	memberMap := map[int64][]model.Printer{}
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		classes, err = s.Store.ListClasses(ctx, tx)
 		if err != nil {
@@ -1146,7 +1174,7 @@ func (s *Server) handleCupsGetClasses(ctx context.Context, r *http.Request, req
 			continue
 		}
 		authInfo := s.authInfoRequiredForDestination(true, c.Name, c.DefaultOptions)
-		attrs := classAttributesWithMembers(ctx, c, memberMap[c.ID], r, req, s.Store, s.Config, authInfo)
+		attrs := classAttributesWithMembers(ctx, c, memberMap[c.ID], r, req, s.Store, s.currentConfig(), authInfo)
 		groups = append(groups, goipp.Group{Tag: goipp.TagPrinterGroup, Attrs: attrs})
 		count++
 	}
@@ -1228,7 +1256,7 @@ func (s *Server) handleCupsGetDevices(ctx context.Context, r *http.Request, req
 }
 
 func (s *Server) handleCupsGetPpds(ctx context.Context, r *http.Request, req *goipp.Message) (*goipp.Message, error) {
-	ppdDir := s.Config.PPDDir
+	ppdDir := s.currentConfig().PPDDir
 	names := listPPDNames(ppdDir)
 	if len(names) == 0 {
 		names = []string{model.DefaultPPDName}
@@ -1410,10 +1438,10 @@ func (s *Server) handleCupsGetPpd(ctx context.Context, r *http.Request, req *goi
 		ppdName = model.DefaultPPDName
 	}
 
-	ppdPath := safePPDPath(s.Config.PPDDir, ppdName)
+	ppdPath := safePPDPath(s.currentConfig().PPDDir, ppdName)
 	ppd, err := os.ReadFile(ppdPath)
 	if err != nil && ppdName != model.DefaultPPDName {
-		ppdPath = safePPDPath(s.Config.PPDDir, model.DefaultPPDName)
+		ppdPath = safePPDPath(s.currentConfig().PPDDir, model.DefaultPPDName)
 		ppd, err = os.ReadFile(ppdPath)
 	}
 	if err != nil {
@@ -1497,13 +1525,13 @@ func (s *Server) handleCupsCreateLocalPrinter(ctx context.Context, r *http.Reque
 	info := optionalStringAttr(req.Printer, "printer-info", goipp.TagText)
 	location := optionalStringAttr(req.Printer, "printer-location", goipp.TagText)
 
-	localizedDeviceURI := localizeDeviceURIForLocalQueue(deviceURI, s.Config)
+	localizedDeviceURI := localizeDeviceURIForLocalQueue(deviceURI, s.currentConfig())
 
 	var printer model.Printer
 	alreadyExists := false
 	existsName := ""
 	createdNew := false
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		// Prefer name match (CUPS does name match first).
 		if p, err := s.Store.GetPrinterByName(ctx, tx, name); err == nil {
 			printer = p
@@ -1581,7 +1609,7 @@ func (s *Server) handleCupsCreateLocalPrinter(ctx context.Context, r *http.Reque
 	if strings.Contains(resolvedURI, "._tcp") || strings.HasPrefix(strings.ToLower(resolvedURI), "dnssd://") {
 		u, rerr := resolveMDNSURI(ctx, resolvedURI)
 		if rerr != nil {
-			_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+			_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 				p, err2 := s.Store.GetPrinterByID(ctx, tx, printer.ID)
 				if err2 == nil && p.IsTemporary {
 					_ = s.Store.DeletePrinter(ctx, tx, p.ID)
@@ -1594,14 +1622,14 @@ func (s *Server) handleCupsCreateLocalPrinter(ctx context.Context, r *http.Reque
 			return resp, nil
 		}
 		if strings.TrimSpace(u) != "" {
-			resolvedURI = localizeDeviceURIForLocalQueue(u, s.Config)
+			resolvedURI = localizeDeviceURIForLocalQueue(u, s.currentConfig())
 		}
 	}
 
 	supported, err := getPrinterAttributesForLocalQueue(ctx, resolvedURI)
 	if err != nil {
 		// Best-effort cleanup of the temporary queue on failure.
-		_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			p, err2 := s.Store.GetPrinterByID(ctx, tx, printer.ID)
 			if err2 == nil && p.IsTemporary {
 				_ = s.Store.DeletePrinter(ctx, tx, p.ID)
@@ -1615,9 +1643,9 @@ func (s *Server) handleCupsCreateLocalPrinter(ctx context.Context, r *http.Reque
 		return resp, nil
 	}
 
-	ppdName, err := generatePPDFromIPP(s.Config.PPDDir, printer.Name, supported)
+	ppdName, err := generatePPDFromIPP(s.currentConfig().PPDDir, printer.Name, supported)
 	if err != nil {
-		_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			p, err2 := s.Store.GetPrinterByID(ctx, tx, printer.ID)
 			if err2 == nil && p.IsTemporary {
 				_ = s.Store.DeletePrinter(ctx, tx, p.ID)
@@ -1633,7 +1661,7 @@ func (s *Server) handleCupsCreateLocalPrinter(ctx context.Context, r *http.Reque
 	remoteInfo := strings.TrimSpace(attrString(supported.Printer, "printer-info"))
 	remoteLocation := strings.TrimSpace(attrString(supported.Printer, "printer-location"))
 	remoteGeo := strings.TrimSpace(attrString(supported.Printer, "printer-geo-location"))
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		p, err := s.Store.GetPrinterByID(ctx, tx, printer.ID)
 		if err != nil {
 			return err
@@ -1674,8 +1702,8 @@ func (s *Server) handleCupsCreateLocalPrinter(ctx context.Context, r *http.Reque
 		return nil
 	})
 	if err != nil {
-		_ = os.Remove(safePPDPath(s.Config.PPDDir, ppdName))
-		_ = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		_ = os.Remove(safePPDPath(s.currentConfig().PPDDir, ppdName))
+		_ = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			p, err2 := s.Store.GetPrinterByID(ctx, tx, printer.ID)
 			if err2 == nil && p.IsTemporary {
 				_ = s.Store.DeletePrinter(ctx, tx, p.ID)
@@ -1817,7 +1845,7 @@ func (s *Server) handleCupsMoveJob(ctx context.Context, r *http.Request, req *go
 
 	var target model.Printer
 	authType := s.authTypeForRequest(r, goipp.Op(req.Code).String())
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		target, err = s.printerFromURI(ctx, tx, destURI)
 		if err != nil {
@@ -1910,7 +1938,7 @@ func (s *Server) handleCupsAddModifyPrinter(ctx context.Context, r *http.Request
 	// temporary queue.
 	if sharedPtr != nil || jobSheetsOk || len(defaultOpts) > 0 {
 		var existing model.Printer
-		_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			if p, err := s.Store.GetPrinterByName(ctx, tx, name); err == nil {
 				existing = p
 			}
@@ -1939,6 +1967,55 @@ func (s *Server) handleCupsAddModifyPrinter(ctx context.Context, r *http.Request
 			return resp, nil
 		}
 	}
+	// The "everywhere" driver generates the queue's PPD from the printer's
+	// own IPP attributes, which also fill in a missing info and location.
+	// The PPD is written to a temporary file and only replaces the queue's
+	// PPD once the changes below are stored.
+	generatedPPD := ""
+	defer func() {
+		if generatedPPD != "" {
+			_ = os.Remove(generatedPPD)
+		}
+	}()
+	if strings.EqualFold(ppdName, "everywhere") {
+		var existing model.Printer
+		_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+			if p, err := s.Store.GetPrinterByName(ctx, tx, name); err == nil {
+				existing = p
+			}
+			return nil
+		})
+		if uri == "" {
+			uri = existing.URI
+		}
+		supported, err := getEverywherePrinterAttributes(ctx, uri)
+		if err == nil {
+			generatedPPD, err = writeTempPPDFromIPP(s.currentConfig().PPDDir, name, supported)
+			ppdName = filepath.Base(safePPDPath(s.currentConfig().PPDDir, name+".ppd"))
+		}
+		if err != nil {
+			status := goipp.StatusErrorDevice
+			if errors.Is(err, errEverywhereNeedsIPP) {
+				status = goipp.StatusErrorNotPossible
+			}
+			resp := goipp.NewResponse(req.Version, status, req.RequestID)
+			addOperationDefaults(resp)
+			resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String(err.Error())))
+			return resp, nil
+		}
+		fill := func(value *string, candidates ...string) {
+			for _, c := range candidates {
+				if *value == "" {
+					*value = strings.TrimSpace(c)
+				}
+			}
+		}
+		fill(&info, existing.Info, attrString(supported.Printer, "printer-info"), attrString(supported.Printer, "printer-make-and-model"))
+		fill(&location, existing.Location, attrString(supported.Printer, "printer-location"))
+		if existing.Geo == "" {
+			fill(&geo, attrString(supported.Printer, "printer-geo-location"))
+		}
+	}
 	if uri == "" {
 		uri = attrString(req.Operation, "printer-uri")
 	}
@@ -1946,12 +2023,18 @@ func (s *Server) handleCupsAddModifyPrinter(ctx context.Context, r *http.Request
 		uri = "file:///dev/null"
 	}
 	var printer model.Printer
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		_, lookupErr := s.Store.GetPrinterByName(ctx, tx, name)
+		created := errors.Is(lookupErr, sql.ErrNoRows)
 		var err error
 		printer, err = s.Store.UpsertPrinter(ctx, tx, name, uri, location, info, true)
 		if err != nil {
 			return err
 		}
+		if created && sharedPtr == nil && !s.currentConfig().DefaultShared {
+			shared := false
+			sharedPtr = &shared
+		}
 		// Optional inline PPD payload (only when ppd-name isn't explicitly set).
 		if ppdName == "" && payload != nil && payload.Len() > 0 {
 			ppdData, err := io.ReadAll(payload)
@@ -1960,7 +2043,7 @@ func (s *Server) handleCupsAddModifyPrinter(ctx context.Context, r *http.Request
 			}
 			if len(ppdData) > 0 {
 				targetName := name + ".ppd"
-				ppdPath := safePPDPath(s.Config.PPDDir, targetName)
+				ppdPath := safePPDPath(s.currentConfig().PPDDir, targetName)
 				if err := os.MkdirAll(filepath.Dir(ppdPath), 0o755); err != nil {
 					return err
 				}
@@ -2019,15 +2102,28 @@ func (s *Server) handleCupsAddModifyPrinter(ctx context.Context, r *http.Request
 		if err := applyDestinationUserAccessAttrs(ctx, tx, s.Store, "printer."+strconv.FormatInt(printer.ID, 10), req.Printer); err != nil {
 			return err
 		}
-		return nil
+		ppd, _ := loadPPDForPrinter(printer)
+		if generatedPPD != "" {
+			ppd, _ = config.LoadPPD(generatedPPD)
+		}
+		return applyDestinationJobPresetAttrs(ctx, tx, s.Store, "printer."+strconv.FormatInt(printer.ID, 10), req.Printer, []*config.PPD{ppd})
 	})
+	if resp, ok := jobPresetErrorResponse(req, err); ok {
+		return resp, nil
+	}
 	if err != nil {
 		return nil, err
 	}
+	if generatedPPD != "" {
+		if err := os.Rename(generatedPPD, safePPDPath(s.currentConfig().PPDDir, ppdName)); err != nil {
+			return nil, err
+		}
+		generatedPPD = ""
+	}
 	resp := goipp.NewResponse(req.Version, goipp.StatusOk, req.RequestID)
 	addOperationDefaults(resp)
 	authInfo := s.authInfoRequiredForDestination(false, printer.Name, printer.DefaultOptions)
-	addPrinterAttributes(ctx, resp, printer, r, req, s.Store, s.Config, authInfo)
+	addPrinterAttributes(ctx, resp, printer, r, req, s.Store, s.currentConfig(), authInfo)
 	return resp, nil
 }
 
@@ -2047,7 +2143,7 @@ func (s *Server) handleCupsDeletePrinter(ctx context.Context, r *http.Request, r
 
 	// Collect document/output paths first so we don't orphan spool files after the
 	// DB rows cascade-delete.
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.GetPrinterByName(ctx, tx, name)
 		if err != nil {
@@ -2090,9 +2186,9 @@ func (s *Server) handleCupsDeletePrinter(ctx context.Context, r *http.Request, r
 			_ = os.Remove(p)
 		}
 		if ppdToRemove != "" {
-			_ = os.Remove(safePPDPath(s.Config.PPDDir, ppdToRemove))
+			_ = os.Remove(safePPDPath(s.currentConfig().PPDDir, ppdToRemove))
 		}
-		err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+		err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 			// Re-check the printer still exists before deleting.
 			p, err := s.Store.GetPrinterByID(ctx, tx, printer.ID)
 			if err != nil {
@@ -2114,7 +2210,7 @@ func (s *Server) handleCupsAcceptJobs(ctx context.Context, r *http.Request, req
 	if err != nil {
 		return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
 	}
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if dest.IsClass {
 			return s.Store.UpdateClassAccepting(ctx, tx, dest.Class.ID, true)
 		}
@@ -2133,7 +2229,7 @@ func (s *Server) handleCupsRejectJobs(ctx context.Context, r *http.Request, req
 	if err != nil {
 		return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
 	}
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if dest.IsClass {
 			return s.Store.UpdateClassAccepting(ctx, tx, dest.Class.ID, false)
 		}
@@ -2161,7 +2257,7 @@ func (s *Server) handleCupsAddModifyClass(ctx context.Context, r *http.Request,
 	defaultOpts, jobSheetsDefault, jobSheetsOk, _ := collectPrinterDefaultOptions(req.Printer)
 
 	var class model.Class
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		memberIDs := make([]int64, 0, len(memberURIs))
 		for _, uri := range memberURIs {
@@ -2199,21 +2295,34 @@ func (s *Server) handleCupsAddModifyClass(ctx context.Context, r *http.Request,
 		if err := applyDestinationUserAccessAttrs(ctx, tx, s.Store, "class."+strconv.FormatInt(class.ID, 10), req.Printer); err != nil {
 			return err
 		}
-		return nil
+		members, err := s.Store.ListClassMembers(ctx, tx, class.ID)
+		if err != nil {
+			return err
+		}
+		ppds := make([]*config.PPD, 0, len(members))
+		for _, member := range members {
+			if ppd, err := loadPPDForPrinter(member); err == nil {
+				ppds = append(ppds, ppd)
+			}
+		}
+		return applyDestinationJobPresetAttrs(ctx, tx, s.Store, "class."+strconv.FormatInt(class.ID, 10), req.Printer, ppds)
 	})
+	if resp, ok := jobPresetErrorResponse(req, err); ok {
+		return resp, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 	resp := goipp.NewResponse(req.Version, goipp.StatusOk, req.RequestID)
 	addOperationDefaults(resp)
 	var members []model.Printer
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		members, err = s.Store.ListClassMembers(ctx, tx, class.ID)
 		return err
 	})
 	authInfo := s.authInfoRequiredForDestination(true, class.Name, class.DefaultOptions)
-	addClassAttributes(ctx, resp, class, members, r, req, s.Store, s.Config, authInfo)
+	addClassAttributes(ctx, resp, class, members, r, req, s.Store, s.currentConfig(), authInfo)
 	return resp, nil
 }
 
@@ -2225,7 +2334,7 @@ func (s *Server) handleCupsDeleteClass(ctx context.Context, r *http.Request, req
 	if name == "" {
 		return goipp.NewResponse(req.Version, goipp.StatusErrorBadRequest, req.RequestID), nil
 	}
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		c, err := s.Store.GetClassByName(ctx, tx, name)
 		if err != nil {
 			return err
@@ -2242,7 +2351,7 @@ func (s *Server) handleCupsDeleteClass(ctx context.Context, r *http.Request, req
 
 func (s *Server) handleCupsGetDefault(ctx context.Context, r *http.Request, req *goipp.Message) (*goipp.Message, error) {
 	var dest destination
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		dest, err = s.defaultDestination(ctx, tx)
 		return err
@@ -2254,16 +2363,16 @@ func (s *Server) handleCupsGetDefault(ctx context.Context, r *http.Request, req
 	addOperationDefaults(resp)
 	if dest.IsClass {
 		var members []model.Printer
-		_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			var err error
 			members, err = s.Store.ListClassMembers(ctx, tx, dest.Class.ID)
 			return err
 		})
 		authInfo := s.authInfoRequiredForDestination(true, dest.Class.Name, dest.Class.DefaultOptions)
-		addClassAttributes(ctx, resp, dest.Class, members, r, req, s.Store, s.Config, authInfo)
+		addClassAttributes(ctx, resp, dest.Class, members, r, req, s.Store, s.currentConfig(), authInfo)
 	} else {
 		authInfo := s.authInfoRequiredForDestination(false, dest.Printer.Name, dest.Printer.DefaultOptions)
-		addPrinterAttributes(ctx, resp, dest.Printer, r, req, s.Store, s.Config, authInfo)
+		addPrinterAttributes(ctx, resp, dest.Printer, r, req, s.Store, s.currentConfig(), authInfo)
 	}
 	return resp, nil
 }
@@ -2276,7 +2385,7 @@ func (s *Server) handleCupsSetDefault(ctx context.Context, r *http.Request, req
 	if name == "" {
 		return goipp.NewResponse(req.Version, goipp.StatusErrorBadRequest, req.RequestID), nil
 	}
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if p, err := s.Store.GetPrinterByName(ctx, tx, name); err == nil {
 			return s.Store.SetDefaultPrinter(ctx, tx, p.ID)
 		}
@@ -2294,9 +2403,18 @@ func (s *Server) handleCupsSetDefault(ctx context.Context, r *http.Request, req
 }
 
 func (s *Server) handleCreatePrinterSubscription(ctx context.Context, r *http.Request, req *goipp.Message) (*goipp.Message, error) {
-	dest, err := s.resolveDestination(ctx, r, req)
-	if err != nil || dest.IsClass {
-		return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
+	// As in CUPS, a printer-uri naming the server itself ("ipp://host/")
+	// subscribes to the events of every printer and job.
+	var dest destination
+	printerURI := attrString(req.Operation, "printer-uri")
+	scope, _, _, ok := parseSubscriptionScopeURI(printerURI)
+	serverWide := printerURI != "" && ok && scope == subscriptionScopeAll
+	if !serverWide {
+		var err error
+		dest, err = s.resolveDestination(ctx, r, req)
+		if err != nil || dest.IsClass {
+			return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
+		}
 	}
 	events, lease, leasePresent, recipient, pullMethod, interval, userData, err := parseSubscriptionRequest(req)
 	if err != nil {
@@ -2305,55 +2423,38 @@ func (s *Server) handleCreatePrinterSubscription(ctx context.Context, r *http.Re
 		}
 		return nil, err
 	}
-	defaultEvents, defaultLease := subscriptionDefaultsForPrinter(dest.Printer, s.Config)
+	defaultEvents, defaultLease := subscriptionDefaultsForPrinter(dest.Printer, s.currentConfig())
 	if strings.TrimSpace(events) == "" {
 		events = defaultEvents
 	}
 	if !leasePresent {
 		lease = defaultLease
 	}
-	lease = clampLeaseDuration(lease, s.Config)
+	lease = clampLeaseDuration(lease, s.currentConfig())
 	if strings.TrimSpace(recipient) != "" {
 		u, err := url.Parse(recipient)
 		if err != nil || strings.TrimSpace(u.Scheme) == "" {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorAttributesOrValues, req.RequestID), nil
 		}
 		if !strings.EqualFold(u.Scheme, "ippget") {
-			if schemes := notifySchemesSupported(s.Config); !stringInList(u.Scheme, schemes) {
+			if schemes := notifySchemesSupported(s.currentConfig()); !stringInList(u.Scheme, schemes) {
 				return goipp.NewResponse(req.Version, goipp.StatusErrorAttributesOrValues, req.RequestID), nil
 			}
 		}
 	}
 	owner := requestingUserName(req, r)
 	var sub model.Subscription
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
-		if s.Config.MaxSubscriptions > 0 {
-			if count, err := s.Store.CountSubscriptions(ctx, tx); err != nil {
-				return err
-			} else if count >= s.Config.MaxSubscriptions {
-				return errTooManySubs
-			}
-		}
-		if s.Config.MaxSubscriptionsPerPrinter > 0 {
-			if count, err := s.Store.CountSubscriptionsForPrinter(ctx, tx, dest.Printer.ID); err != nil {
-				return err
-			} else if count >= s.Config.MaxSubscriptionsPerPrinter {
-				return errTooManySubs
-			}
-		}
-		if s.Config.MaxSubscriptionsPerUser > 0 {
-			if count, err := s.Store.CountSubscriptionsForUser(ctx, tx, owner); err != nil {
-				return err
-			} else if count >= s.Config.MaxSubscriptionsPerUser {
-				return errTooManySubs
-			}
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		var printerID *int64
+		if !serverWide {
+			printerID = &dest.Printer.ID
 		}
 		var err error
-		sub, err = s.Store.CreateSubscription(ctx, tx, &dest.Printer.ID, nil, events, lease, owner, recipient, pullMethod, interval, userData)
+		sub, err = s.Store.CreateSubscription(ctx, tx, subscriptionLimits(s.currentConfig()), printerID, nil, events, lease, owner, recipient, pullMethod, interval, userData)
 		return err
 	})
 	if err != nil {
-		if errors.Is(err, errTooManySubs) {
+		if errors.Is(err, store.ErrTooManySubscriptions) {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorTooManySubscriptions, req.RequestID), nil
 		}
 		return nil, err
@@ -2380,16 +2481,16 @@ func (s *Server) handleCreateJobSubscription(ctx context.Context, r *http.Reques
 		return nil, err
 	}
 	if !leasePresent {
-		lease = int64(s.Config.DefaultLeaseDuration)
+		lease = int64(s.currentConfig().DefaultLeaseDuration)
 	}
-	lease = clampLeaseDuration(lease, s.Config)
+	lease = clampLeaseDuration(lease, s.currentConfig())
 	if strings.TrimSpace(recipient) != "" {
 		u, err := url.Parse(recipient)
 		if err != nil || strings.TrimSpace(u.Scheme) == "" {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorAttributesOrValues, req.RequestID), nil
 		}
 		if !strings.EqualFold(u.Scheme, "ippget") {
-			if schemes := notifySchemesSupported(s.Config); !stringInList(u.Scheme, schemes) {
+			if schemes := notifySchemesSupported(s.currentConfig()); !stringInList(u.Scheme, schemes) {
 				return goipp.NewResponse(req.Version, goipp.StatusErrorAttributesOrValues, req.RequestID), nil
 			}
 		}
@@ -2400,7 +2501,7 @@ func (s *Server) handleCreateJobSubscription(ctx context.Context, r *http.Reques
 	}
 	owner := requestingUserName(req, r)
 	var sub model.Subscription
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
 			return err
@@ -2409,9 +2510,9 @@ func (s *Server) handleCreateJobSubscription(ctx context.Context, r *http.Reques
 			return errNotAuthorized
 		}
 		defaultEvents := "job-completed"
-		defaultLease := int64(s.Config.DefaultLeaseDuration)
+		defaultLease := int64(s.currentConfig().DefaultLeaseDuration)
 		if printer, err := s.Store.GetPrinterByID(ctx, tx, job.PrinterID); err == nil {
-			defaultEvents, defaultLease = subscriptionDefaultsForPrinter(printer, s.Config)
+			defaultEvents, defaultLease = subscriptionDefaultsForPrinter(printer, s.currentConfig())
 		}
 		if strings.TrimSpace(events) == "" {
 			events = defaultEvents
@@ -2419,35 +2520,14 @@ func (s *Server) handleCreateJobSubscription(ctx context.Context, r *http.Reques
 		if !leasePresent {
 			lease = defaultLease
 		}
-		if s.Config.MaxSubscriptions > 0 {
-			if count, err := s.Store.CountSubscriptions(ctx, tx); err != nil {
-				return err
-			} else if count >= s.Config.MaxSubscriptions {
-				return errTooManySubs
-			}
-		}
-		if s.Config.MaxSubscriptionsPerJob > 0 {
-			if count, err := s.Store.CountSubscriptionsForJob(ctx, tx, jobID); err != nil {
-				return err
-			} else if count >= s.Config.MaxSubscriptionsPerJob {
-				return errTooManySubs
-			}
-		}
-		if s.Config.MaxSubscriptionsPerUser > 0 {
-			if count, err := s.Store.CountSubscriptionsForUser(ctx, tx, owner); err != nil {
-				return err
-			} else if count >= s.Config.MaxSubscriptionsPerUser {
-				return errTooManySubs
-			}
-		}
-		sub, err = s.Store.CreateSubscription(ctx, tx, nil, &jobID, events, lease, owner, recipient, pullMethod, interval, userData)
+		sub, err = s.Store.CreateSubscription(ctx, tx, subscriptionLimits(s.currentConfig()), nil, &jobID, events, lease, owner, recipient, pullMethod, interval, userData)
 		return err
 	})
 	if err != nil {
 		if errors.Is(err, errNotAuthorized) {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorNotAuthorized, req.RequestID), nil
 		}
-		if errors.Is(err, errTooManySubs) {
+		if errors.Is(err, store.ErrTooManySubscriptions) {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorTooManySubscriptions, req.RequestID), nil
 		}
 		if errors.Is(err, sql.ErrNoRows) {
@@ -2461,6 +2541,10 @@ func (s *Server) handleCreateJobSubscription(ctx context.Context, r *http.Reques
 	return resp, nil
 }
 
+// notifyWaitPoll is how often a Get-Notifications request with notify-wait
+// looks for new events.
+const notifyWaitPoll = time.Second
+
 func (s *Server) handleGetNotifications(ctx context.Context, r *http.Request, req *goipp.Message) (*goipp.Message, error) {
 	subIDs := attrInts(req.Operation, "notify-subscription-ids")
 	if len(subIDs) == 0 {
@@ -2474,7 +2558,7 @@ func (s *Server) handleGetNotifications(ctx context.Context, r *http.Request, re
 		}
 	}
 
-	limit := s.Config.MaxEvents
+	limit := s.currentConfig().MaxEvents
 	if limit <= 0 {
 		limit = 10000000
 	}
@@ -2488,10 +2572,10 @@ func (s *Server) handleGetNotifications(ctx context.Context, r *http.Request, re
 		notes      []model.Notification
 		printerURI string
 	}
-	collected := []subWithNotes{}
+	var collected []subWithNotes
 	interval := 60
-
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	collect := func(tx store.Tx) error {
+		collected, interval = collected[:0], 60
 		for i, id := range subIDs {
 			sub, err := s.Store.GetSubscription(ctx, tx, id)
 			if err != nil {
@@ -2546,15 +2630,48 @@ func (s *Server) handleGetNotifications(ctx context.Context, r *http.Request, re
 			collected = append(collected, item)
 		}
 		return nil
-	})
-	if err != nil {
-		if errors.Is(err, errNotAuthorized) {
-			return goipp.NewResponse(req.Version, goipp.StatusErrorNotAuthorized, req.RequestID), nil
+	}
+
+	// With notify-wait the request is held until an event arrives or
+	// notify-get-interval passes, so clients can long-poll instead of
+	// polling at the interval.
+	wait := attrBool(req.Operation, "notify-wait")
+	pending := func() bool {
+		for _, item := range collected {
+			if len(item.notes) > 0 {
+				return true
+			}
 		}
-		if errors.Is(err, sql.ErrNoRows) {
-			return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
+		return false
+	}
+	var waitUntil time.Time
+poll:
+	for {
+		err := s.Store.WithTx(ctx, true, collect)
+		if err != nil {
+			if errors.Is(err, errNotAuthorized) {
+				return goipp.NewResponse(req.Version, goipp.StatusErrorNotAuthorized, req.RequestID), nil
+			}
+			if errors.Is(err, sql.ErrNoRows) {
+				return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
+			}
+			return nil, err
+		}
+		if !wait || interval == 0 || pending() {
+			break
+		}
+		if waitUntil.IsZero() {
+			waitUntil = time.Now().Add(time.Duration(interval) * time.Second)
+			extendDeadline(ctx, time.Duration(interval)*time.Second)
+		}
+		if !time.Now().Before(waitUntil) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			break poll
+		case <-time.After(notifyWaitPoll):
 		}
-		return nil, err
 	}
 
 	now := time.Now().Unix()
@@ -2618,7 +2735,7 @@ func (s *Server) handleGetSubscriptionAttributes(ctx context.Context, r *http.Re
 	if authType == "" {
 		authType = "basic"
 	}
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		sub, err = s.Store.GetSubscription(ctx, tx, subID)
 		if err != nil {
@@ -2729,7 +2846,7 @@ func (s *Server) handleGetSubscriptions(ctx context.Context, r *http.Request, re
 	var printerID *int64
 	var jobID *int64
 	classScoped := false
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		switch scopeKind {
 		case subscriptionScopePrinter:
 			p, err := s.Store.GetPrinterByName(ctx, tx, scopeName)
@@ -2797,7 +2914,7 @@ func (s *Server) handleGetSubscriptions(ctx context.Context, r *http.Request, re
 	}
 
 	var subs []model.Subscription
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		if err := s.Store.PruneExpiredSubscriptions(ctx, tx); err != nil {
 			return err
 		}
@@ -2837,7 +2954,7 @@ func (s *Server) handleRenewSubscription(ctx context.Context, r *http.Request, r
 	if authType == "" {
 		authType = "basic"
 	}
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		sub, err := s.Store.GetSubscription(ctx, tx, subID)
 		if err != nil {
 			return err
@@ -2855,7 +2972,7 @@ func (s *Server) handleRenewSubscription(ctx context.Context, r *http.Request, r
 		if !ok {
 			lease = sub.LeaseSecs
 		}
-		lease = clampLeaseDuration(lease, s.Config)
+		lease = clampLeaseDuration(lease, s.currentConfig())
 		updated, err = s.Store.UpdateSubscriptionLease(ctx, tx, subID, lease)
 		return err
 	})
@@ -2890,7 +3007,7 @@ func (s *Server) handleCancelSubscription(ctx context.Context, r *http.Request,
 	if authType == "" {
 		authType = "basic"
 	}
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		sub, err := s.Store.GetSubscription(ctx, tx, subID)
 		if err != nil {
 			return err
@@ -2947,7 +3064,13 @@ func (s *Server) handlePrintJob(ctx context.Context, r *http.Request, req *goipp
 	if err := s.enforceAuthInfo(r, req, goipp.OpPrintJob); err != nil {
 		return nil, err
 	}
+	if s.tooManyJobs(ctx, printer.ID, userName) {
+		return goipp.NewResponse(req.Version, goipp.StatusErrorTooManyJobs, req.RequestID), nil
+	}
 	stripReadOnlyJobAttributes(req)
+	if resp := s.applyJobPreset(ctx, req, dest, printer); resp != nil {
+		return resp, nil
+	}
 	originHost := jobOriginatingHostFromRequest(r, req)
 	documentFormat := attrString(req.Operation, "document-format")
 	documentFormatSupplied := strings.TrimSpace(documentFormat)
@@ -2975,7 +3098,7 @@ func (s *Server) handlePrintJob(ctx context.Context, r *http.Request, req *goipp
 
 	var job model.Job
 	var doc model.Document
-	warn, err := validateRequestOptions(req, printer)
+	warn, err := validateRequestOptions(req, printer, s.currentConfig())
 	if err != nil {
 		if errors.Is(err, errBadRequest) {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorBadRequest, req.RequestID), nil
@@ -3014,7 +3137,7 @@ func (s *Server) handlePrintJob(ctx context.Context, r *http.Request, req *goipp
 		defer gz.Close()
 		reader = gz
 	}
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.CreateJob(ctx, tx, printer.ID, jobName, userName, originHost, options)
 		if err != nil {
@@ -3085,11 +3208,17 @@ func (s *Server) handleCreateJob(ctx context.Context, r *http.Request, req *goip
 	if err := s.enforceAuthInfo(r, req, goipp.OpCreateJob); err != nil {
 		return nil, err
 	}
+	if s.tooManyJobs(ctx, printer.ID, userName) {
+		return goipp.NewResponse(req.Version, goipp.StatusErrorTooManyJobs, req.RequestID), nil
+	}
 	stripReadOnlyJobAttributes(req)
+	if resp := s.applyJobPreset(ctx, req, dest, printer); resp != nil {
+		return resp, nil
+	}
 	originHost := jobOriginatingHostFromRequest(r, req)
 
 	var job model.Job
-	warn, err := validateRequestOptions(req, printer)
+	warn, err := validateRequestOptions(req, printer, s.currentConfig())
 	if err != nil {
 		if errors.Is(err, errBadRequest) {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorBadRequest, req.RequestID), nil
@@ -3111,7 +3240,7 @@ func (s *Server) handleCreateJob(ctx context.Context, r *http.Request, req *goip
 	internalHold := false
 	if !holdRequested {
 		opts := parseJobOptions(options)
-		timeout := s.Config.MultipleOperationTimeout
+		timeout := s.currentConfig().MultipleOperationTimeout
 		if timeout <= 0 {
 			timeout = 900
 		}
@@ -3121,7 +3250,7 @@ func (s *Server) handleCreateJob(ctx context.Context, r *http.Request, req *goip
 			internalHold = true
 		}
 	}
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.CreateJob(ctx, tx, printer.ID, jobName, userName, originHost, options)
 		if err != nil {
@@ -3193,7 +3322,7 @@ func (s *Server) handleSendDocument(ctx context.Context, r *http.Request, req *g
 	var printer model.Printer
 	var doc model.Document
 	var docs []model.Document
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
@@ -3262,7 +3391,7 @@ func (s *Server) handleSendDocument(ctx context.Context, r *http.Request, req *g
 		reader = gz
 	}
 
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		sp := spool.Spool{Dir: s.Spool.Dir, OutputDir: s.Spool.OutputDir}
 		path, size, err := sp.Save(job.ID, job.Name, reader)
 		if err != nil {
@@ -3275,7 +3404,7 @@ func (s *Server) handleSendDocument(ctx context.Context, r *http.Request, req *g
 		opts := parseJobOptions(job.Options)
 		holdRequested := jobHoldRequested(job.Options)
 		if !holdRequested {
-			timeout := s.Config.MultipleOperationTimeout
+			timeout := s.currentConfig().MultipleOperationTimeout
 			if timeout <= 0 {
 				timeout = 900
 			}
@@ -3349,7 +3478,7 @@ func (s *Server) handleGetJobs(ctx context.Context, r *http.Request, req *goipp.
 	}
 	var jobs []model.Job
 	printerMap := map[int64]model.Printer{}
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		if dest.IsClass {
 			members, err := s.Store.ListClassMembers(ctx, tx, dest.Class.ID)
@@ -3385,7 +3514,7 @@ func (s *Server) handleGetJobs(ctx context.Context, r *http.Request, req *goipp.
 		for _, job := range jobs {
 			jobIDs = append(jobIDs, job.ID)
 		}
-		if err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		if err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			var err error
 			docStats, err = s.Store.ListDocumentStatsByJobIDs(ctx, tx, jobIDs)
 			return err
@@ -3419,7 +3548,7 @@ func (s *Server) handleGetJobAttributes(ctx context.Context, r *http.Request, re
 	var job model.Job
 	var printer model.Printer
 	var docs []model.Document
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
@@ -3478,7 +3607,7 @@ func (s *Server) handleGetDocuments(ctx context.Context, r *http.Request, req *g
 	var job model.Job
 	var printer model.Printer
 	var docs []model.Document
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
@@ -3602,7 +3731,7 @@ func (s *Server) handleGetDocumentAttributes(ctx context.Context, r *http.Reques
 	var job model.Job
 	var printer model.Printer
 	var docs []model.Document
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
@@ -4349,7 +4478,7 @@ func ensureSubscriptionDescriptionDefaults(attrs *goipp.Attributes, sub model.Su
 	}
 	var printerURI string
 	if sub.PrinterID.Valid && s != nil && r != nil {
-		_ = s.Store.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(r.Context(), true, func(tx store.Tx) error {
 			p, err := s.Store.GetPrinterByID(r.Context(), tx, sub.PrinterID.Int64)
 			if err != nil {
 				return err
@@ -4541,7 +4670,7 @@ func (s *Server) handleSetJobAttributes(ctx context.Context, r *http.Request, re
 
 	var job model.Job
 	var printer model.Printer
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
@@ -4626,7 +4755,7 @@ func (s *Server) handleCancelJob(ctx context.Context, r *http.Request, req *goip
 	}
 	if jobID == 0 && printerURI != "" {
 		var resolvedID int64
-		err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			printer, err := s.printerFromURI(ctx, tx, printerURI)
 			if err != nil {
 				return err
@@ -4657,7 +4786,7 @@ func (s *Server) handleCancelJob(ctx context.Context, r *http.Request, req *goip
 	purgeJob, _ := attrBoolPresent(req.Operation, "purge-job")
 	deleteFiles := purgeJob
 	paths := []string{}
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
 			return err
@@ -4766,7 +4895,7 @@ func (s *Server) cancelMyJobsForUser(ctx context.Context, r *http.Request, req *
 		reason = "job-purged"
 	}
 	paths := []string{}
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if len(jobIDs) > 0 {
 			for _, jobID := range jobIDs {
 				job, err := s.Store.GetJob(ctx, tx, jobID)
@@ -4864,8 +4993,11 @@ func (s *Server) handleValidateJob(ctx context.Context, r *http.Request, req *go
 		return nil, err
 	}
 	stripReadOnlyJobAttributes(req)
+	if resp := s.applyJobPreset(ctx, req, dest, printer); resp != nil {
+		return resp, nil
+	}
 	_ = sanitizeJobName(req)
-	warn, err := validateRequestOptions(req, printer)
+	warn, err := validateRequestOptions(req, printer, s.currentConfig())
 	if err != nil {
 		if errors.Is(err, errBadRequest) {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorBadRequest, req.RequestID), nil
@@ -4936,7 +5068,7 @@ func (s *Server) handleValidateDocument(ctx context.Context, r *http.Request, re
 		return resp, nil
 	}
 
-	warn, err := validateRequestOptions(req, printer)
+	warn, err := validateRequestOptions(req, printer, s.currentConfig())
 	if err != nil {
 		if errors.Is(err, errBadRequest) {
 			return goipp.NewResponse(req.Version, goipp.StatusErrorBadRequest, req.RequestID), nil
@@ -4994,7 +5126,7 @@ func (s *Server) handleCupsAuthenticateJob(ctx context.Context, r *http.Request,
 	}
 
 	var job model.Job
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		return err
@@ -5030,7 +5162,7 @@ func (s *Server) handleCupsAuthenticateJob(ctx context.Context, r *http.Request,
 	options := mergeJobOptions(job.Options, map[string]string{
 		"job-hold-until": "no-hold",
 	})
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if err := s.Store.UpdateJobAttributes(ctx, tx, job.ID, nil, &options); err != nil {
 			return err
 		}
@@ -5066,7 +5198,7 @@ func (s *Server) handleCupsGetDocument(ctx context.Context, r *http.Request, req
 	var job model.Job
 	var doc model.Document
 	var printer model.Printer
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
@@ -5142,7 +5274,7 @@ func (s *Server) handleCloseJob(ctx context.Context, r *http.Request, req *goipp
 
 	var job model.Job
 	var printer model.Printer
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		job, err = s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
@@ -5185,7 +5317,7 @@ func (s *Server) updateJobStateFromRequest(ctx context.Context, r *http.Request,
 		return goipp.NewResponse(req.Version, goipp.StatusErrorBadRequest, req.RequestID), nil
 	}
 	authType := s.authTypeForRequest(r, goipp.Op(req.Code).String())
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, jobID)
 		if err != nil {
 			return err
@@ -5246,7 +5378,7 @@ func (s *Server) updateDestinationState(ctx context.Context, r *http.Request, re
 	if err != nil {
 		return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
 	}
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if dest.IsClass {
 			if err := s.Store.UpdateClassState(ctx, tx, dest.Class.ID, state); err != nil {
 				return err
@@ -5271,7 +5403,7 @@ func (s *Server) updateDestinationAccepting(ctx context.Context, r *http.Request
 	if err != nil {
 		return goipp.NewResponse(req.Version, goipp.StatusErrorNotFound, req.RequestID), nil
 	}
-	err = s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if dest.IsClass {
 			return s.Store.UpdateClassAccepting(ctx, tx, dest.Class.ID, accepting)
 		}
@@ -5369,7 +5501,7 @@ func (s *Server) cancelJobsForResolvedDestination(ctx context.Context, r *http.R
 	paths := []string{}
 	scopeJobs := 0
 	acted := 0
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if dest.IsClass {
 			members, err := s.Store.ListClassMembers(ctx, tx, dest.Class.ID)
 			if err != nil {
@@ -5414,7 +5546,7 @@ func (s *Server) cancelJobsForAllPrinters(ctx context.Context, r *http.Request,
 	paths := []string{}
 	scopeJobs := 0
 	acted := 0
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		printers, err := s.Store.ListPrinters(ctx, tx)
 		if err != nil {
 			return err
@@ -5453,7 +5585,7 @@ func (s *Server) cancelSelectedJobs(ctx context.Context, r *http.Request, req *g
 	authType := s.authTypeForRequest(r, goipp.Op(req.Code).String())
 
 	paths := []string{}
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		for _, jobID := range jobIDs {
 			job, err := s.Store.GetJob(ctx, tx, jobID)
 			if err != nil {
@@ -5503,7 +5635,7 @@ func (s *Server) purgeDestinationJobs(ctx context.Context, dest destination, del
 		return nil
 	}
 	paths := []string{}
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		collect := func(printerID int64) error {
 			jobIDs, err := s.Store.ListJobIDsByPrinter(ctx, tx, printerID)
 			if err != nil {
@@ -5542,7 +5674,7 @@ func (s *Server) purgeDestinationJobs(ctx context.Context, dest destination, del
 	return nil
 }
 
-func (s *Server) purgeSingleJobWithPaths(ctx context.Context, tx *sql.Tx, jobID int64, deleteFiles bool, paths *[]string) error {
+func (s *Server) purgeSingleJobWithPaths(ctx context.Context, tx store.Tx, jobID int64, deleteFiles bool, paths *[]string) error {
 	if deleteFiles {
 		docs, err := s.Store.ListDocumentsByJob(ctx, tx, jobID)
 		if err != nil {
@@ -5560,7 +5692,7 @@ func (s *Server) purgeSingleJobWithPaths(ctx context.Context, tx *sql.Tx, jobID
 	return s.Store.DeleteJob(ctx, tx, jobID)
 }
 
-func (s *Server) cancelJobsForPrinter(ctx context.Context, r *http.Request, req *goipp.Message, authType string, tx *sql.Tx, printerID int64, reason string, purge bool, paths *[]string) (scopeJobs int, acted int, err error) {
+func (s *Server) cancelJobsForPrinter(ctx context.Context, r *http.Request, req *goipp.Message, authType string, tx store.Tx, printerID int64, reason string, purge bool, paths *[]string) (scopeJobs int, acted int, err error) {
 	jobIDs, err := s.Store.ListJobIDsByPrinter(ctx, tx, printerID)
 	if err != nil {
 		return 0, 0, err
@@ -5593,7 +5725,7 @@ func (s *Server) cancelJobsForPrinter(ctx context.Context, r *http.Request, req
 	return scopeJobs, acted, nil
 }
 
-func (s *Server) findCurrentJobIDForPrinter(ctx context.Context, tx *sql.Tx, printerID int64) (int64, error) {
+func (s *Server) findCurrentJobIDForPrinter(ctx context.Context, tx store.Tx, printerID int64) (int64, error) {
 	jobs, err := s.Store.ListJobsByPrinter(ctx, tx, printerID, 50)
 	if err != nil {
 		return 0, err
@@ -5615,7 +5747,7 @@ func (s *Server) preserveJobFiles(ctx context.Context) bool {
 		return false
 	}
 	enabled := false
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		val, err := s.Store.GetSetting(ctx, tx, "_preserve_job_files", "0")
 		if err != nil {
 			return err
@@ -5639,11 +5771,21 @@ func (s *Server) handleResumeAllPrinters(ctx context.Context, r *http.Request, r
 }
 
 func (s *Server) handleRestartSystem(ctx context.Context, r *http.Request, req *goipp.Message) (*goipp.Message, error) {
+	// Restarting re-reads cupsd.conf, the policies and the MIME database in
+	// place; the process and its listeners stay up.
+	if s.Reloader != nil {
+		if err := s.Reloader(); err != nil {
+			resp := goipp.NewResponse(req.Version, goipp.StatusErrorInternal, req.RequestID)
+			addOperationDefaults(resp)
+			resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String("Unable to reload configuration: "+err.Error())))
+			return resp, nil
+		}
+	}
 	return s.updateAllPrinters(ctx, req, 3, true)
 }
 
 func (s *Server) updateAllPrinters(ctx context.Context, req *goipp.Message, state int, accepting bool) (*goipp.Message, error) {
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if err := s.Store.UpdateAllPrintersState(ctx, tx, state); err != nil {
 			return err
 		}
@@ -5675,19 +5817,19 @@ func buildOperationDefaults() goipp.Attributes {
 	return attrs
 }
 
-func addPrinterAttributes(ctx context.Context, resp *goipp.Message, printer model.Printer, r *http.Request, req *goipp.Message, st *store.Store, cfg config.Config, authInfo []string) {
+func addPrinterAttributes(ctx context.Context, resp *goipp.Message, printer model.Printer, r *http.Request, req *goipp.Message, st store.Repository, cfg config.Config, authInfo []string) {
 	for _, attr := range buildPrinterAttributes(ctx, printer, r, req, st, cfg, authInfo) {
 		resp.Printer.Add(attr)
 	}
 }
 
-func addClassAttributes(ctx context.Context, resp *goipp.Message, class model.Class, members []model.Printer, r *http.Request, req *goipp.Message, st *store.Store, cfg config.Config, authInfo []string) {
+func addClassAttributes(ctx context.Context, resp *goipp.Message, class model.Class, members []model.Printer, r *http.Request, req *goipp.Message, st store.Repository, cfg config.Config, authInfo []string) {
 	for _, attr := range classAttributesWithMembers(ctx, class, members, r, req, st, cfg, authInfo) {
 		resp.Printer.Add(attr)
 	}
 }
 
-func buildPrinterAttributes(ctx context.Context, printer model.Printer, r *http.Request, req *goipp.Message, st *store.Store, cfg config.Config, authInfo []string) goipp.Attributes {
+func buildPrinterAttributes(ctx context.Context, printer model.Printer, r *http.Request, req *goipp.Message, st store.Repository, cfg config.Config, authInfo []string) goipp.Attributes {
 	uri := printerURIFor(printer, r)
 	attrs := goipp.Attributes{}
 	ppd, _ := loadPPDForPrinter(printer)
@@ -5929,11 +6071,7 @@ func buildPrinterAttributes(ctx context.Context, printer model.Printer, r *http.
 	}
 	attrs.Add(goipp.MakeAttribute("multiple-operation-time-out", goipp.TagInteger, goipp.Integer(timeout)))
 	attrs.Add(goipp.MakeAttribute("multiple-operation-time-out-action", goipp.TagKeyword, goipp.String("process-job")))
-	maxCopies := caps.maxCopies
-	if maxCopies <= 0 {
-		maxCopies = 9999
-	}
-	attrs.Add(goipp.MakeAttribute("copies-supported", goipp.TagRange, goipp.Range{Lower: 1, Upper: maxCopies}))
+	attrs.Add(goipp.MakeAttribute("copies-supported", goipp.TagRange, goipp.Range{Lower: 1, Upper: copiesUpper(caps, cfg)}))
 	attrs.Add(goipp.MakeAttribute("copies-default", goipp.TagInteger, goipp.Integer(1)))
 	attrs.Add(goipp.MakeAttribute("job-quota-period", goipp.TagInteger, goipp.Integer(0)))
 	attrs.Add(goipp.MakeAttribute("job-k-limit", goipp.TagInteger, goipp.Integer(0)))
@@ -5994,7 +6132,7 @@ func buildPrinterAttributes(ctx context.Context, printer model.Printer, r *http.
 	attrs.Add(makeKeywordsAttr("job-settable-attributes-supported", jobSettableAttributesSupported()))
 	attrs.Add(makeKeywordsAttr("job-creation-attributes-supported", []string{
 		"copies", "finishings", "finishings-col", "ipp-attribute-fidelity", "job-hold-until",
-		"job-name", "job-priority", "job-sheets", "media", "media-col",
+		"job-name", "job-preset-name", "job-priority", "job-sheets", "media", "media-col",
 		"multiple-document-handling", "number-up", "number-up-layout", "orientation-requested",
 		"output-bin", "page-delivery", "page-ranges", "print-color-mode", "print-quality",
 		"print-scaling", "printer-resolution", "sides",
@@ -6065,7 +6203,7 @@ func buildPrinterAttributes(ctx context.Context, printer model.Printer, r *http.
 	attrs.Add(makeTextsAttr("marker-message", []string{markerMsg}))
 	attrs.Add(makeStringsAttr("printer-supply", supplyVals))
 	attrs.Add(makeTextsAttr("printer-supply-description", supplyDesc))
-	if presetAttr, ok := makeJobPresetsSupportedAttr(ppd); ok {
+	if presetAttr, ok := makeJobPresetsSupportedAttr(loadDestinationJobPresets(ctx, st, "printer."+strconv.FormatInt(printer.ID, 10)), ppd); ok {
 		attrs.Add(presetAttr)
 	}
 	ppm := 1
@@ -6166,7 +6304,7 @@ func buildPrinterAttributes(ctx context.Context, printer model.Printer, r *http.
 	return filterAttributesForRequest(attrs, req)
 }
 
-func buildClassAttributes(ctx context.Context, class model.Class, r *http.Request, req *goipp.Message, st *store.Store, cfg config.Config, authInfo []string) goipp.Attributes {
+func buildClassAttributes(ctx context.Context, class model.Class, r *http.Request, req *goipp.Message, st store.Repository, cfg config.Config, authInfo []string) goipp.Attributes {
 	uri := classURIFor(class, r)
 	attrs := goipp.Attributes{}
 	attrs.Add(goipp.MakeAttribute("printer-name", goipp.TagName, goipp.String(class.Name)))
@@ -6312,11 +6450,14 @@ func buildClassAttributes(ctx context.Context, class model.Class, r *http.Reques
 	attrs.Add(makeKeywordsAttr("job-settable-attributes-supported", jobSettableAttributesSupported()))
 	attrs.Add(makeKeywordsAttr("job-creation-attributes-supported", []string{
 		"copies", "finishings", "finishings-col", "ipp-attribute-fidelity", "job-hold-until",
-		"job-name", "job-priority", "job-sheets", "media", "media-col",
+		"job-name", "job-preset-name", "job-priority", "job-sheets", "media", "media-col",
 		"multiple-document-handling", "number-up", "number-up-layout", "orientation-requested",
 		"output-bin", "page-delivery", "page-ranges", "print-color-mode", "print-quality",
 		"print-scaling", "printer-resolution", "sides",
 	}))
+	if presetAttr, ok := makeJobPresetsSupportedAttr(loadDestinationJobPresets(ctx, st, "class."+strconv.FormatInt(class.ID, 10)), nil); ok {
+		attrs.Add(presetAttr)
+	}
 	attrs.Add(makeKeywordsAttr("which-jobs-supported", []string{
 		"completed", "not-completed", "aborted", "all", "canceled", "pending", "pending-held",
 		"processing", "processing-stopped",
@@ -6421,7 +6562,7 @@ func buildClassAttributes(ctx context.Context, class model.Class, r *http.Reques
 	return attrs
 }
 
-func classAttributesWithMembers(ctx context.Context, class model.Class, members []model.Printer, r *http.Request, req *goipp.Message, st *store.Store, cfg config.Config, authInfo []string) goipp.Attributes {
+func classAttributesWithMembers(ctx context.Context, class model.Class, members []model.Printer, r *http.Request, req *goipp.Message, st store.Repository, cfg config.Config, authInfo []string) goipp.Attributes {
 	attrs := buildClassAttributes(ctx, class, r, req, st, cfg, authInfo)
 	memberIDs := make([]int64, 0, len(members))
 	for _, p := range members {
@@ -6527,7 +6668,7 @@ func buildSubscriptionAttributes(sub model.Subscription, r *http.Request, s *Ser
 	if sub.PrinterID.Valid && s != nil && r != nil {
 		var uri string
 		ctx := r.Context()
-		_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+		_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 			p, err := s.Store.GetPrinterByID(ctx, tx, sub.PrinterID.Int64)
 			if err != nil {
 				return err
@@ -6551,7 +6692,7 @@ func addJobAttributes(resp *goipp.Message, job model.Job, printer model.Printer,
 	}
 }
 
-func ensureJobUUID(ctx context.Context, tx *sql.Tx, s *Server, job *model.Job, printer model.Printer, r *http.Request) error {
+func ensureJobUUID(ctx context.Context, tx store.Tx, s *Server, job *model.Job, printer model.Printer, r *http.Request) error {
 	if job == nil || job.ID == 0 || s == nil || s.Store == nil {
 		return nil
 	}
@@ -7106,6 +7247,17 @@ func parseSubscriptionRequest(req *goipp.Message) (events string, lease int64, l
 	return events, lease, leasePresent, recipient, pullMethod, interval, userData, nil
 }
 
+// subscriptionLimits maps the MaxSubscriptions* directives onto the caps the
+// store enforces when a subscription is created.
+func subscriptionLimits(cfg config.Config) store.SubscriptionLimits {
+	return store.SubscriptionLimits{
+		Total:      cfg.MaxSubscriptions,
+		PerPrinter: cfg.MaxSubscriptionsPerPrinter,
+		PerJob:     cfg.MaxSubscriptionsPerJob,
+		PerUser:    cfg.MaxSubscriptionsPerUser,
+	}
+}
+
 func subscriptionDefaultsForPrinter(printer model.Printer, cfg config.Config) (string, int64) {
 	opts := parseJobOptions(printer.DefaultOptions)
 	events := strings.TrimSpace(opts["notify-events"])
@@ -8258,6 +8410,19 @@ var ippFinishingsNames = []string{
 	"fold-engineering-z",
 }
 
+// copiesUpper is the largest copies value a printer accepts: the PPD's
+// limit, capped by the MaxCopies directive.
+func copiesUpper(caps printerCaps, cfg config.Config) int {
+	n := caps.maxCopies
+	if n <= 0 {
+		n = 9999
+	}
+	if cfg.MaxCopies > 0 && n > cfg.MaxCopies {
+		n = cfg.MaxCopies
+	}
+	return n
+}
+
 func computePrinterCaps(ppd *config.PPD, defaultOpts map[string]string) printerCaps {
 	caps := printerCaps{
 		mediaSupported:                    []string{"A4"},
@@ -9015,7 +9180,7 @@ func refreshPPDCache(ppdName, ppdPath string) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	_ = st.WithTx(ctx, false, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, false, func(tx store.Tx) error {
 		cachedHash, cachedAttrs, _, exists, err := st.GetPPDCache(ctx, tx, ppdName)
 		if err != nil {
 			return nil
@@ -9305,8 +9470,8 @@ func safePPDPath(baseDir, name string) string {
 	return full
 }
 
-func validateRequestOptions(req *goipp.Message, printer model.Printer) (*ippWarning, error) {
-	warn, err := validateIppOptions(req, printer)
+func validateRequestOptions(req *goipp.Message, printer model.Printer, cfg config.Config) (*ippWarning, error) {
+	warn, err := validateIppOptions(req, printer, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -9324,7 +9489,7 @@ func validateRequestOptions(req *goipp.Message, printer model.Printer) (*ippWarn
 	return warn, nil
 }
 
-func validateIppOptions(req *goipp.Message, printer model.Printer) (*ippWarning, error) {
+func validateIppOptions(req *goipp.Message, printer model.Printer, cfg config.Config) (*ippWarning, error) {
 	if req == nil {
 		return nil, nil
 	}
@@ -9394,11 +9559,7 @@ func validateIppOptions(req *goipp.Message, printer model.Printer) (*ippWarning,
 			}
 		case "copies":
 			if n, ok := valueInt(attr.Values[0].V); ok {
-				maxCopies := caps.maxCopies
-				if maxCopies <= 0 {
-					maxCopies = 9999
-				}
-				if n < 1 || n > maxCopies {
+				if n < 1 || n > copiesUpper(caps, cfg) {
 					return errUnsupported
 				}
 			}
@@ -10223,7 +10384,7 @@ func makeURISchemesAttr(name string, values []string) goipp.Attribute {
 	return goipp.MakeAttr(name, goipp.TagURIScheme, vals[0], vals[1:]...)
 }
 
-func sharingEnabled(r *http.Request, st *store.Store) bool {
+func sharingEnabled(r *http.Request, st store.Repository) bool {
 	if st == nil {
 		return true
 	}
@@ -10232,7 +10393,7 @@ func sharingEnabled(r *http.Request, st *store.Store) bool {
 		ctx = r.Context()
 	}
 	enabled := true
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		val, err := st.GetSetting(ctx, tx, "_share_printers", "1")
 		if err != nil {
 			return err
@@ -10244,7 +10405,7 @@ func sharingEnabled(r *http.Request, st *store.Store) bool {
 	return enabled
 }
 
-func serverIsSharingPrinters(cfg config.Config, st *store.Store, r *http.Request) bool {
+func serverIsSharingPrinters(cfg config.Config, st store.Repository, r *http.Request) bool {
 	if !cfg.BrowseLocal {
 		return false
 	}
@@ -10276,6 +10437,53 @@ func isLocalRequest(r *http.Request) bool {
 	return ip.IsLoopback()
 }
 
+// tooManyJobs applies MaxJobs, MaxJobsPerPrinter and MaxJobsPerUser to a
+// new job for printerID. Only jobs that have not finished count, since
+// finished ones are purged by the PreserveJobHistory rules instead.
+func (s *Server) tooManyJobs(ctx context.Context, printerID int64, user string) bool {
+	cfg := s.currentConfig()
+	if cfg.MaxJobs <= 0 && cfg.MaxJobsPerPrinter <= 0 && cfg.MaxJobsPerUser <= 0 {
+		return false
+	}
+	full := false
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		stats, err := s.Store.ListPrinterJobStats(ctx, tx)
+		if err != nil {
+			return err
+		}
+		total := 0
+		for id, st := range stats {
+			active := 0
+			for _, n := range st.StateCounts {
+				active += n
+			}
+			total += active
+			if id == printerID && cfg.MaxJobsPerPrinter > 0 && active >= cfg.MaxJobsPerPrinter {
+				full = true
+			}
+		}
+		if cfg.MaxJobs > 0 && total >= cfg.MaxJobs {
+			full = true
+		}
+		if full || cfg.MaxJobsPerUser <= 0 {
+			return nil
+		}
+		jobs, err := s.Store.ListJobsByUser(ctx, tx, user, nil, -1)
+		if err != nil {
+			return err
+		}
+		active := 0
+		for _, job := range jobs {
+			if job.State >= 3 && job.State <= 6 {
+				active++
+			}
+		}
+		full = active >= cfg.MaxJobsPerUser
+		return nil
+	})
+	return full
+}
+
 func (s *Server) userAllowedForPrinter(ctx context.Context, printer model.Printer, user string) bool {
 	if s == nil || s.Store == nil {
 		return true
@@ -10286,7 +10494,7 @@ func (s *Server) userAllowedForPrinter(ctx context.Context, printer model.Printe
 	}
 	allowed := ""
 	denied := ""
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		keyPrefix := "printer." + strconv.FormatInt(printer.ID, 10)
 		allowed, err = s.Store.GetSetting(ctx, tx, keyPrefix+".allowed_users", "")
@@ -10317,7 +10525,7 @@ func (s *Server) userAllowedForClass(ctx context.Context, class model.Class, use
 	}
 	allowed := ""
 	denied := ""
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		keyPrefix := "class." + strconv.FormatInt(class.ID, 10)
 		allowed, err = s.Store.GetSetting(ctx, tx, keyPrefix+".allowed_users", "")
@@ -10343,7 +10551,7 @@ func (s *Server) selectClassMember(ctx context.Context, classID int64) (model.Pr
 		return model.Printer{}, sql.ErrNoRows
 	}
 	var selected model.Printer
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		members, err := s.Store.ListClassMembers(ctx, tx, classID)
 		if err != nil {
 			return err
@@ -10408,7 +10616,7 @@ func splitUserList(list string) []string {
 	return out
 }
 
-func applyDestinationUserAccessAttrs(ctx context.Context, tx *sql.Tx, st *store.Store, keyPrefix string, attrs goipp.Attributes) error {
+func applyDestinationUserAccessAttrs(ctx context.Context, tx store.Tx, st store.Repository, keyPrefix string, attrs goipp.Attributes) error {
 	if st == nil || tx == nil || strings.TrimSpace(keyPrefix) == "" || len(attrs) == 0 {
 		return nil
 	}
@@ -10476,13 +10684,13 @@ func userInList(user string, list []string) bool {
 	return false
 }
 
-func loadUserAccessLists(ctx context.Context, st *store.Store, keyPrefix string) ([]string, []string) {
+func loadUserAccessLists(ctx context.Context, st store.Repository, keyPrefix string) ([]string, []string) {
 	if st == nil || keyPrefix == "" {
 		return nil, nil
 	}
 	allowed := ""
 	denied := ""
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		allowed, err = st.GetSetting(ctx, tx, keyPrefix+".allowed_users", "")
 		if err != nil {
@@ -10552,10 +10760,10 @@ func makeNamesAttr(name string, values []string) goipp.Attribute {
 func makeStringsAttr(name string, values []string) goipp.Attribute {
 	vals := make([]goipp.Value, 0, len(values))
 	for _, v := range values {
-		vals = append(vals, goipp.String(v))
+		vals = append(vals, goipp.Binary(v))
 	}
 	if len(vals) == 0 {
-		vals = append(vals, goipp.String(""))
+		vals = append(vals, goipp.Binary(""))
 	}
 	return goipp.MakeAttr(name, goipp.TagString, vals[0], vals[1:]...)
 }
@@ -12512,8 +12720,8 @@ func lookupFinishings() {
 	})
 }
 
-func makeJobPresetsSupportedAttr(ppd *config.PPD) (goipp.Attribute, bool) {
-	presets := jobPresetsSupportedFromPPD(ppd)
+func makeJobPresetsSupportedAttr(admin []jobPreset, ppd *config.PPD) (goipp.Attribute, bool) {
+	presets := jobPresetCollections(admin, ppd)
 	if len(presets) == 0 {
 		return goipp.Attribute{}, false
 	}
@@ -13075,7 +13283,7 @@ func loadCachedDocumentFormats(ppdName, ppdHash string) []string {
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	formats := []string{}
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		cachedHash, cachedAttrs, _, ok, err := st.GetPPDCache(ctx, tx, ppdName)
 		if err != nil || !ok || cachedHash != ppdHash {
 			return nil
@@ -13108,7 +13316,7 @@ func storeCachedDocumentFormats(ppdName, ppdHash, size, mtime string, formats []
 	raw := marshalPPDCachePayload(payload)
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
-	_ = st.WithTx(ctx, false, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, false, func(tx store.Tx) error {
 		return st.SetPPDCache(ctx, tx, ppdName, ppdHash, raw)
 	})
 }
@@ -14894,35 +15102,6 @@ func (s *Server) resolvePrinter(ctx context.Context, r *http.Request, req *goipp
 	return dest.Printer, nil
 }
 
-func (s *Server) defaultPrinter(ctx context.Context, tx *sql.Tx) (model.Printer, error) {
-	var p model.Printer
-	var accepting int
-	var isDefault int
-	var shared int
-	var jobSheets string
-	var defaultOptions string
-	var ppdName string
-	err := tx.QueryRowContext(ctx, `
-        SELECT id, name, uri, ppd_name, location, info, geo_location, organization, organizational_unit, state, accepting, shared, is_default, job_sheets_default, default_options, created_at, updated_at
-        FROM printers
-        ORDER BY is_default DESC, id ASC
-        LIMIT 1
-    `).Scan(&p.ID, &p.Name, &p.URI, &ppdName, &p.Location, &p.Info, &p.Geo, &p.Org, &p.OrgUnit, &p.State, &accepting, &shared, &isDefault, &jobSheets, &defaultOptions, &p.CreatedAt, &p.UpdatedAt)
-	if err != nil {
-		return model.Printer{}, err
-	}
-	p.Accepting = accepting != 0
-	p.Shared = shared != 0
-	p.IsDefault = isDefault != 0
-	p.PPDName = strings.TrimSpace(ppdName)
-	if strings.TrimSpace(jobSheets) == "" {
-		jobSheets = "none"
-	}
-	p.JobSheetsDefault = jobSheets
-	p.DefaultOptions = defaultOptions
-	return p, nil
-}
-
 type destination struct {
 	IsClass bool
 	Printer model.Printer
@@ -14955,7 +15134,7 @@ func (s *Server) resolveDestination(ctx context.Context, r *http.Request, req *g
 		}
 	}
 	var dest destination
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		if printerName != "" {
 			dest.Printer, err = s.Store.GetPrinterByName(ctx, tx, printerName)
@@ -15003,7 +15182,7 @@ func (s *Server) resolveCancelScope(ctx context.Context, printerURI string) (can
 	}
 
 	scope.all = false
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		switch {
 		case strings.HasPrefix(resource, "/printers/"):
 			name := strings.TrimSpace(strings.TrimPrefix(resource, "/printers/"))
@@ -15061,7 +15240,7 @@ func (s *Server) cancelScopePrinterIDs(ctx context.Context, scope cancelScope) (
 	}
 
 	ids := map[int64]bool{}
-	err := s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		members, err := s.Store.ListClassMembers(ctx, tx, scope.dest.Class.ID)
 		if err != nil {
 			return err
@@ -15079,70 +15258,21 @@ func (s *Server) cancelScopePrinterIDs(ctx context.Context, scope cancelScope) (
 	return ids, true, nil
 }
 
-func (s *Server) defaultDestination(ctx context.Context, tx *sql.Tx) (destination, error) {
-	var dest destination
-	row := tx.QueryRowContext(ctx, `
-        SELECT 'printer' AS kind, id, name, uri, ppd_name, location, info, geo_location, organization, organizational_unit, state, accepting, shared, is_default, job_sheets_default, default_options, created_at, updated_at
-        FROM printers
-        WHERE is_default = 1
-        UNION ALL
-        SELECT 'class' AS kind, id, name, '' AS uri, '' AS ppd_name, location, info, '' AS geo_location, '' AS organization, '' AS organizational_unit, state, accepting, 0 AS shared, is_default, job_sheets_default, default_options, created_at, updated_at
-        FROM classes
-        WHERE is_default = 1
-        LIMIT 1
-    `)
-	var kind string
-	var accepting int
-	var shared int
-	var isDefault int
-	var createdAt, updatedAt time.Time
-	var uri string
-	var ppdName string
-	var jobSheets string
-	var defaultOptions string
-	err := row.Scan(&kind, &dest.Printer.ID, &dest.Printer.Name, &uri, &ppdName, &dest.Printer.Location, &dest.Printer.Info, &dest.Printer.Geo, &dest.Printer.Org, &dest.Printer.OrgUnit, &dest.Printer.State, &accepting, &shared, &isDefault, &jobSheets, &defaultOptions, &createdAt, &updatedAt)
-	if err == nil && kind == "printer" {
-		dest.Printer.URI = uri
-		dest.Printer.Accepting = accepting != 0
-		dest.Printer.Shared = shared != 0
-		dest.Printer.IsDefault = isDefault != 0
-		dest.Printer.PPDName = strings.TrimSpace(ppdName)
-		if strings.TrimSpace(jobSheets) == "" {
-			jobSheets = "none"
-		}
-		dest.Printer.JobSheetsDefault = jobSheets
-		dest.Printer.DefaultOptions = defaultOptions
-		dest.Printer.CreatedAt = createdAt
-		dest.Printer.UpdatedAt = updatedAt
-		dest.IsClass = false
-		return dest, nil
-	}
-	if err == nil && kind == "class" {
-		dest.Class.ID = dest.Printer.ID
-		dest.Class.Name = dest.Printer.Name
-		dest.Class.Location = dest.Printer.Location
-		dest.Class.Info = dest.Printer.Info
-		dest.Class.State = dest.Printer.State
-		dest.Class.Accepting = accepting != 0
-		dest.Class.IsDefault = isDefault != 0
-		if strings.TrimSpace(jobSheets) == "" {
-			jobSheets = "none"
-		}
-		dest.Class.JobSheetsDefault = jobSheets
-		dest.Class.DefaultOptions = defaultOptions
-		dest.Class.CreatedAt = createdAt
-		dest.Class.UpdatedAt = updatedAt
-		dest.IsClass = true
-		return dest, nil
+func (s *Server) defaultDestination(ctx context.Context, tx store.Tx) (destination, error) {
+	p, err := s.Store.GetDefaultPrinter(ctx, tx)
+	if err == nil && p.IsDefault {
+		return destination{Printer: p}, nil
+	}
+	if c, cerr := s.Store.GetDefaultClass(ctx, tx); cerr == nil {
+		return destination{IsClass: true, Class: c}, nil
+	} else if !errors.Is(cerr, sql.ErrNoRows) {
+		return destination{}, cerr
 	}
 	// fallback to first printer
-	p, err2 := s.defaultPrinter(ctx, tx)
-	if err2 != nil {
-		return destination{}, err2
+	if err != nil {
+		return destination{}, err
 	}
-	dest.Printer = p
-	dest.IsClass = false
-	return dest, nil
+	return destination{Printer: p}, nil
 }
 
 func printerURIFor(printer model.Printer, r *http.Request) string {
@@ -15449,12 +15579,12 @@ func langBase(tag string) string {
 	return tag
 }
 
-func queuedJobCountForPrinters(ctx context.Context, st *store.Store, printerIDs []int64) int {
+func queuedJobCountForPrinters(ctx context.Context, st store.Repository, printerIDs []int64) int {
 	if st == nil || len(printerIDs) == 0 {
 		return 0
 	}
 	count := 0
-	if err := st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	if err := st.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		count, err = st.CountQueuedJobsByPrinterIDs(ctx, tx, printerIDs)
 		return err
@@ -15563,7 +15693,7 @@ func (s *Server) userCancelAnyEnabled(ctx context.Context) bool {
 		return false
 	}
 	enabled := false
-	_ = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		val, err := s.Store.GetSetting(ctx, tx, "_user_cancel_any", "0")
 		if err != nil {
 			return err
@@ -15574,7 +15704,7 @@ func (s *Server) userCancelAnyEnabled(ctx context.Context) bool {
 	return enabled
 }
 
-func loadPrinterSupplies(ctx context.Context, st *store.Store, printer model.Printer) (string, map[string]string) {
+func loadPrinterSupplies(ctx context.Context, st store.Repository, printer model.Printer) (string, map[string]string) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
@@ -15584,7 +15714,7 @@ func loadPrinterSupplies(ctx context.Context, st *store.Store, printer model.Pri
 
 	var cached store.PrinterSupplies
 	var hasCached bool
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		cached, hasCached, err = st.GetPrinterSupplies(ctx, tx, printer.ID)
 		return err
@@ -15610,7 +15740,7 @@ func loadPrinterSupplies(ctx context.Context, st *store.Store, printer model.Pri
 		return "", nil
 	}
 	now := time.Now().UTC()
-	_ = st.WithTx(ctx, false, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, false, func(tx store.Tx) error {
 		return st.UpsertPrinterSupplies(ctx, tx, printer.ID, status.State, status.Details, now)
 	})
 	return status.State, status.Details
@@ -15868,7 +15998,7 @@ func parseMoveSourceURI(raw string) (isClass bool, name string, ok bool) {
 	return parseQueueURI(raw)
 }
 
-func (s *Server) moveSourcePrinterIDs(ctx context.Context, tx *sql.Tx, sourceURI string) ([]int64, error) {
+func (s *Server) moveSourcePrinterIDs(ctx context.Context, tx store.Tx, sourceURI string) ([]int64, error) {
 	isClass, name, ok := parseMoveSourceURI(sourceURI)
 	if !ok {
 		return nil, sql.ErrNoRows
@@ -15934,7 +16064,7 @@ func (s *Server) moveSourcePrinterIDs(ctx context.Context, tx *sql.Tx, sourceURI
 	return ids, nil
 }
 
-func (s *Server) printerFromURI(ctx context.Context, tx *sql.Tx, uri string) (model.Printer, error) {
+func (s *Server) printerFromURI(ctx context.Context, tx store.Tx, uri string) (model.Printer, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
 		return model.Printer{}, err
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+func TestIPPPostToPrinterAndRootResources(t *testing.T) {
+	s := newMoveTestServer(t)
+	ctx := context.Background()
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		_, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, true, false, "none", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create printer: %v", err)
+	}
+
+	post := func(path string, op goipp.Op) *goipp.Message {
+		t.Helper()
+		req := goipp.NewRequest(goipp.DefaultVersion, op, 1)
+		req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+		req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en")))
+		req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String("ipp://localhost/printers/Office")))
+		payload, _ := req.EncodeBytes()
+		r := httptest.NewRequest(http.MethodPost, "http://localhost"+path, bytes.NewReader(payload))
+		r.Header.Set("Content-Type", goipp.ContentType)
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("POST %s: status %d, body %q", path, rec.Code, rec.Body.String())
+		}
+		var resp goipp.Message
+		if err := resp.DecodeBytes(rec.Body.Bytes()); err != nil {
+			t.Fatalf("POST %s: decode response: %v", path, err)
+		}
+		return &resp
+	}
+
+	// The full attribute set includes octetString values such as
+	// printer-supply, which must decode.
+	resp := post("/printers/Office", goipp.OpGetPrinterAttributes)
+	if goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("Get-Printer-Attributes status = %v", goipp.Status(resp.Code))
+	}
+	found := false
+	for _, a := range resp.Printer {
+		if a.Name == "printer-supply" {
+			found = a.Values[0].T == goipp.TagString
+		}
+	}
+	if !found {
+		t.Fatalf("printer-supply missing or not an octetString")
+	}
+
+	if resp := post("/", goipp.OpCupsGetPrinters); goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("CUPS-Get-Printers on / status = %v", goipp.Status(resp.Code))
+	}
+	if resp := post("/jobs", goipp.OpGetJobs); goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("Get-Jobs on /jobs status = %v", goipp.Status(resp.Code))
+	}
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+// Job presets are named sets of job template values an administrator
+// defines for a printer or class, such as "booklet" or "draft-duplex-bw".
+// They are kept in the "<printer|class>.<id>.job_presets" setting,
+// reported in job-presets-supported ahead of the PPD's own presets, and
+// applied at job creation when the request names one in job-preset-name.
+// Options the user supplies always win over the preset's.
+
+// jobPreset is a stored preset. Options use the same keys and values as
+// the job options collectJobOptions records.
+type jobPreset struct {
+	Name    string            `json:"name"`
+	Options map[string]string `json:"options"`
+}
+
+func loadJobPresets(ctx context.Context, tx store.Tx, st store.Repository, keyPrefix string) ([]jobPreset, error) {
+	raw, err := st.GetSetting(ctx, tx, keyPrefix+".job_presets", "")
+	if err != nil || strings.TrimSpace(raw) == "" {
+		return nil, err
+	}
+	var presets []jobPreset
+	if err := json.Unmarshal([]byte(raw), &presets); err != nil {
+		return nil, err
+	}
+	return presets, nil
+}
+
+func saveJobPresets(ctx context.Context, tx store.Tx, st store.Repository, keyPrefix string, presets []jobPreset) error {
+	if len(presets) == 0 {
+		return st.SetSetting(ctx, tx, keyPrefix+".job_presets", "")
+	}
+	b, err := json.Marshal(presets)
+	if err != nil {
+		return err
+	}
+	return st.SetSetting(ctx, tx, keyPrefix+".job_presets", string(b))
+}
+
+// loadDestinationJobPresets reads the presets of a printer or class
+// outside of any transaction, for building attributes and creating jobs.
+func loadDestinationJobPresets(ctx context.Context, st store.Repository, keyPrefix string) []jobPreset {
+	if st == nil {
+		return nil
+	}
+	var presets []jobPreset
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
+		var err error
+		presets, err = loadJobPresets(ctx, tx, st, keyPrefix)
+		return err
+	})
+	return presets
+}
+
+func findJobPreset(presets []jobPreset, name string) (jobPreset, bool) {
+	for _, p := range presets {
+		if strings.EqualFold(p.Name, strings.TrimSpace(name)) {
+			return p, true
+		}
+	}
+	return jobPreset{}, false
+}
+
+// setJobPreset replaces the preset with the same name, or appends it.
+// A preset without options removes it.
+func setJobPreset(presets []jobPreset, preset jobPreset) []jobPreset {
+	out := make([]jobPreset, 0, len(presets)+1)
+	replaced := false
+	for _, p := range presets {
+		if !strings.EqualFold(p.Name, preset.Name) {
+			out = append(out, p)
+			continue
+		}
+		if !replaced && len(preset.Options) > 0 {
+			out = append(out, preset)
+		}
+		replaced = true
+	}
+	if !replaced && len(preset.Options) > 0 {
+		out = append(out, preset)
+	}
+	return out
+}
+
+// jobPresetFromCollection reads a job-presets-supported collection.
+func jobPresetFromCollection(col goipp.Collection) jobPreset {
+	name := strings.TrimSpace(collectionString(col, "preset-name"))
+	members := goipp.Attributes{}
+	for _, attr := range col {
+		if attr.Name != "preset-name" {
+			members = append(members, attr)
+		}
+	}
+	opts := collectJobOptions(&goipp.Message{Job: members})
+	for k, v := range opts {
+		if strings.TrimSpace(v) == "" {
+			delete(opts, k)
+		}
+	}
+	return jobPreset{Name: name, Options: opts}
+}
+
+// parseJobPreset reads a preset written as "name: option=value ...", the
+// form the web interface edits, normalizing the values the way an IPP
+// request carrying them would be.
+func parseJobPreset(line string) (jobPreset, error) {
+	name, rest, ok := strings.Cut(line, ":")
+	name = strings.TrimSpace(name)
+	if !ok || name == "" {
+		return jobPreset{}, fmt.Errorf("expected \"name: option=value ...\", got %q", strings.TrimSpace(line))
+	}
+	opts := map[string]string{}
+	for _, word := range strings.Fields(rest) {
+		k, v, _ := strings.Cut(word, "=")
+		if k = strings.TrimSpace(k); k == "" {
+			continue
+		}
+		if v == "" {
+			v = "true"
+		}
+		opts[k] = v
+	}
+	if len(opts) == 0 {
+		return jobPreset{}, fmt.Errorf("job preset %q has no options", name)
+	}
+	col := goipp.Collection(jobPresetAttrs(opts))
+	col.Add(goipp.MakeAttribute("preset-name", goipp.TagName, goipp.String(name)))
+	return jobPresetFromCollection(col), nil
+}
+
+// formatJobPreset is the inverse of parseJobPreset.
+func formatJobPreset(p jobPreset) string {
+	keys := make([]string, 0, len(p.Options))
+	for k := range p.Options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	words := make([]string, 0, len(keys))
+	for _, k := range keys {
+		words = append(words, k+"="+p.Options[k])
+	}
+	return p.Name + ": " + strings.Join(words, " ")
+}
+
+// validateJobPreset checks a preset against the PPD constraints, on top
+// of the PPD's defaults as a job using it would be.
+func validateJobPreset(ppd *config.PPD, preset jobPreset) error {
+	if ppd == nil || len(ppd.Constraints) == 0 {
+		return nil
+	}
+	opts := make(map[string]string, len(preset.Options))
+	for k, v := range preset.Options {
+		opts[k] = v
+	}
+	opts = applyPPDDefaults(opts, ppd)
+	opts = mapJobOptionsToPWG(opts, ppd)
+	if err := validatePPDConstraints(ppd, opts); err != nil {
+		return fmt.Errorf("job preset %q: %w", preset.Name, err)
+	}
+	return nil
+}
+
+// applyDestinationJobPresetAttrs stores the job-presets-supported values
+// of a CUPS-Add-Modify-Printer or CUPS-Add-Modify-Class request. Each
+// collection adds or replaces the preset it names, one with nothing but
+// a preset-name removes it, and the delete-attribute value removes them
+// all. Presets are checked against the PPDs they will be used with.
+func applyDestinationJobPresetAttrs(ctx context.Context, tx store.Tx, st store.Repository, keyPrefix string, attrs goipp.Attributes, ppds []*config.PPD) error {
+	attr := attrByName(attrs, "job-presets-supported")
+	if st == nil || tx == nil || attr == nil || len(attr.Values) == 0 {
+		return nil
+	}
+	if attr.Values[0].T == goipp.TagDeleteAttr {
+		return saveJobPresets(ctx, tx, st, keyPrefix, nil)
+	}
+	presets, err := loadJobPresets(ctx, tx, st, keyPrefix)
+	if err != nil {
+		return err
+	}
+	for _, v := range attr.Values {
+		col, ok := v.V.(goipp.Collection)
+		if !ok {
+			return fmt.Errorf("job-presets-supported values must be collections: %w", errBadRequest)
+		}
+		preset := jobPresetFromCollection(col)
+		if preset.Name == "" {
+			return fmt.Errorf("job preset without preset-name: %w", errBadRequest)
+		}
+		for _, ppd := range ppds {
+			if err := validateJobPreset(ppd, preset); err != nil {
+				return err
+			}
+		}
+		presets = setJobPreset(presets, preset)
+	}
+	return saveJobPresets(ctx, tx, st, keyPrefix, presets)
+}
+
+// jobPresetErrorResponse answers an Add-Modify request whose presets
+// could not be stored, or returns false for other errors.
+func jobPresetErrorResponse(req *goipp.Message, err error) (*goipp.Message, bool) {
+	status := goipp.StatusErrorAttributesOrValues
+	switch {
+	case errors.Is(err, errBadRequest):
+		status = goipp.StatusErrorBadRequest
+	case !errors.Is(err, errPPDConstraint):
+		return nil, false
+	}
+	resp := goipp.NewResponse(req.Version, status, req.RequestID)
+	addOperationDefaults(resp)
+	resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String(err.Error())))
+	return resp, true
+}
+
+// jobPresetCollections lists a destination's presets for
+// job-presets-supported: the administrator's first, then the PPD's that
+// they do not override.
+func jobPresetCollections(presets []jobPreset, ppd *config.PPD) []goipp.Collection {
+	out := []goipp.Collection{}
+	for _, p := range presets {
+		col := goipp.Collection{}
+		col.Add(goipp.MakeAttribute("preset-name", goipp.TagName, goipp.String(p.Name)))
+		col = append(col, jobPresetAttrs(p.Options)...)
+		out = append(out, col)
+	}
+	for _, col := range jobPresetsSupportedFromPPD(ppd) {
+		if _, ok := findJobPreset(presets, collectionString(col, "preset-name")); !ok {
+			out = append(out, col)
+		}
+	}
+	return out
+}
+
+// jobPresetAttrs turns preset options back into job template attributes.
+func jobPresetAttrs(opts map[string]string) goipp.Attributes {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	attrs := goipp.Attributes{}
+	mediaType := strings.TrimSpace(opts["media-type"])
+	mediaSource := strings.TrimSpace(opts["media-source"])
+	for _, k := range keys {
+		v := strings.TrimSpace(opts[k])
+		if v == "" || strings.HasPrefix(k, "job-sheets-col-") {
+			continue
+		}
+		switch k {
+		case "media-type", "media-source":
+			continue
+		case "media":
+			if mediaType == "" && mediaSource == "" {
+				attrs.Add(goipp.MakeAttribute(k, goipp.TagKeyword, goipp.String(v)))
+			}
+			continue
+		case "output-mode":
+			if opts["print-color-mode"] != "" {
+				continue
+			}
+		case "copies", "job-priority", "number-up", "job-cancel-after", "number-of-retries", "retry-interval", "retry-time-out":
+			if n, err := strconv.Atoi(v); err == nil {
+				attrs.Add(goipp.MakeAttribute(k, goipp.TagInteger, goipp.Integer(n)))
+				continue
+			}
+		case "print-quality":
+			if n, ok := parsePrintQualityValue(v); ok {
+				attrs.Add(goipp.MakeAttribute(k, goipp.TagEnum, goipp.Integer(n)))
+				continue
+			}
+		case "orientation-requested":
+			if n, err := strconv.Atoi(v); err == nil {
+				attrs.Add(goipp.MakeAttribute(k, goipp.TagEnum, goipp.Integer(n)))
+				continue
+			}
+		case "finishings":
+			if enums := parseFinishingsList(v); len(enums) > 0 {
+				vals := make([]goipp.Value, 0, len(enums))
+				for _, n := range enums {
+					vals = append(vals, goipp.Integer(n))
+				}
+				attrs.Add(goipp.MakeAttr(k, goipp.TagEnum, vals[0], vals[1:]...))
+				continue
+			}
+		case "finishing-template":
+			col := goipp.Collection{}
+			col.Add(goipp.MakeAttribute("finishing-template", finishingTemplateTag(v), goipp.String(v)))
+			attrs.Add(goipp.MakeAttribute("finishings-col", goipp.TagBeginCollection, col))
+			continue
+		case "page-ranges":
+			if ranges, ok := parsePageRangesList(v); ok && len(ranges) > 0 {
+				vals := make([]goipp.Value, 0, len(ranges))
+				for _, r := range ranges {
+					vals = append(vals, r)
+				}
+				attrs.Add(goipp.MakeAttr(k, goipp.TagRange, vals[0], vals[1:]...))
+				continue
+			}
+		case "printer-resolution":
+			if res, ok := parseResolution(v); ok {
+				attrs.Add(goipp.MakeAttribute(k, goipp.TagResolution, res))
+				continue
+			}
+		case "job-sheets":
+			attrs.Add(makeNamesAttr(k, strings.Split(v, ",")))
+			continue
+		}
+		attrs.Add(goipp.MakeAttribute(k, goipp.TagKeyword, goipp.String(v)))
+	}
+	if mediaType != "" || mediaSource != "" {
+		col := goipp.Collection{}
+		if media := strings.TrimSpace(opts["media"]); media != "" {
+			col.Add(goipp.MakeAttribute("media-size", goipp.TagBeginCollection, mediaSizeCollectionFor(media, nil)))
+			col.Add(goipp.MakeAttribute("media-size-name", goipp.TagKeyword, goipp.String(media)))
+		}
+		if mediaType != "" {
+			col.Add(goipp.MakeAttribute("media-type", goipp.TagKeyword, goipp.String(mediaType)))
+		}
+		if mediaSource != "" {
+			col.Add(goipp.MakeAttribute("media-source", goipp.TagKeyword, goipp.String(mediaSource)))
+		}
+		attrs.Add(goipp.MakeAttribute("media-col", goipp.TagBeginCollection, col))
+	}
+	return attrs
+}
+
+// applyJobPreset adds the attributes of the preset named by job-preset-name
+// to a job creation request, except those the request already has. It
+// returns a response to send instead when the destination has no such
+// preset.
+func (s *Server) applyJobPreset(ctx context.Context, req *goipp.Message, dest destination, printer model.Printer) *goipp.Message {
+	name := strings.TrimSpace(attrString(req.Job, "job-preset-name"))
+	if name == "" {
+		name = strings.TrimSpace(attrString(req.Operation, "job-preset-name"))
+	}
+	if name == "" {
+		return nil
+	}
+	keyPrefix := "printer." + strconv.FormatInt(dest.Printer.ID, 10)
+	if dest.IsClass {
+		keyPrefix = "class." + strconv.FormatInt(dest.Class.ID, 10)
+	}
+	ppd, _ := loadPPDForPrinter(printer)
+	var col goipp.Collection
+	for _, c := range jobPresetCollections(loadDestinationJobPresets(ctx, s.Store, keyPrefix), ppd) {
+		if strings.EqualFold(collectionString(c, "preset-name"), name) {
+			col = c
+			break
+		}
+	}
+	if col == nil {
+		resp := goipp.NewResponse(req.Version, goipp.StatusErrorAttributesOrValues, req.RequestID)
+		addOperationDefaults(resp)
+		resp.Unsupported.Add(goipp.MakeAttribute("job-preset-name", goipp.TagName, goipp.String(name)))
+		return resp
+	}
+	has := func(name string) bool {
+		return attrByName(req.Job, name) != nil || attrByName(req.Operation, name) != nil
+	}
+	// Members that stand in for each other count as supplied together.
+	alternates := map[string]string{
+		"media": "media-col", "media-col": "media",
+		"finishings": "finishings-col", "finishings-col": "finishings",
+		"print-color-mode": "output-mode", "output-mode": "print-color-mode",
+	}
+	for _, attr := range col {
+		if attr.Name == "preset-name" || has(attr.Name) || (alternates[attr.Name] != "" && has(alternates[attr.Name])) {
+			continue
+		}
+		req.Job.Add(attr)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+func jobPresetCollection(name string, attrs ...goipp.Attribute) goipp.Collection {
+	col := goipp.Collection{}
+	col.Add(goipp.MakeAttribute("preset-name", goipp.TagName, goipp.String(name)))
+	for _, a := range attrs {
+		col.Add(a)
+	}
+	return col
+}
+
+func addModifyJobPresets(t *testing.T, s *Server, name string, presets ...goipp.Value) *goipp.Message {
+	t.Helper()
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCupsAddModifyPrinter, 1)
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String("ipp://localhost/printers/"+name)))
+	req.Printer.Add(goipp.MakeAttribute("device-uri", goipp.TagURI, goipp.String("ipp://printer.example/ipp/print")))
+	if len(presets) > 0 {
+		req.Printer.Add(goipp.MakeAttr("job-presets-supported", goipp.TagBeginCollection, presets[0], presets[1:]...))
+	}
+	resp, err := s.handleCupsAddModifyPrinter(context.Background(), httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), req, nil)
+	if err != nil {
+		t.Fatalf("handleCupsAddModifyPrinter error: %v", err)
+	}
+	return resp
+}
+
+func TestHandleCupsAddModifyPrinterStoresJobPresets(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Config.PPDDir = t.TempDir()
+	ctx := context.Background()
+
+	booklet := jobPresetCollection("booklet",
+		goipp.MakeAttribute("sides", goipp.TagKeyword, goipp.String("two-sided-short-edge")),
+		goipp.MakeAttribute("number-up", goipp.TagInteger, goipp.Integer(2)))
+	draft := jobPresetCollection("draft-duplex-bw",
+		goipp.MakeAttribute("print-color-mode", goipp.TagKeyword, goipp.String("monochrome")),
+		goipp.MakeAttribute("sides", goipp.TagKeyword, goipp.String("two-sided-long-edge")))
+	if resp := addModifyJobPresets(t, s, "Office", booklet, draft); goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("add presets: status %v", goipp.Status(resp.Code))
+	}
+	// Redefine booklet and drop draft-duplex-bw; other presets are kept.
+	booklet = jobPresetCollection("booklet", goipp.MakeAttribute("number-up", goipp.TagInteger, goipp.Integer(4)))
+	if resp := addModifyJobPresets(t, s, "Office", booklet, jobPresetCollection("draft-duplex-bw")); goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("modify presets: status %v", goipp.Status(resp.Code))
+	}
+
+	var printer model.Printer
+	var presets []jobPreset
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		var err error
+		if printer, err = s.Store.GetPrinterByName(ctx, tx, "Office"); err != nil {
+			return err
+		}
+		presets, err = loadJobPresets(ctx, tx, s.Store, "printer."+strconv.FormatInt(printer.ID, 10))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("load presets: %v", err)
+	}
+	if len(presets) != 1 || presets[0].Name != "booklet" || presets[0].Options["number-up"] != "4" || presets[0].Options["sides"] != "" {
+		t.Fatalf("presets = %+v", presets)
+	}
+
+	attrs := buildPrinterAttributes(ctx, printer, nil, nil, s.Store, s.Config, nil)
+	found := false
+	for _, v := range attrByName(attrs, "job-presets-supported").Values {
+		if col, ok := v.V.(goipp.Collection); ok && collectionString(col, "preset-name") == "booklet" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("job-presets-supported does not list booklet")
+	}
+}
+
+func TestApplyJobPresetKeepsUserOptions(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Config.PPDDir = t.TempDir()
+	ctx := context.Background()
+	preset := jobPresetCollection("letterhead-tray2",
+		goipp.MakeAttribute("media-source", goipp.TagKeyword, goipp.String("tray-2")),
+		goipp.MakeAttribute("sides", goipp.TagKeyword, goipp.String("one-sided")),
+		goipp.MakeAttribute("copies", goipp.TagInteger, goipp.Integer(2)))
+	if resp := addModifyJobPresets(t, s, "Office", preset); goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("add preset: status %v", goipp.Status(resp.Code))
+	}
+	var printer model.Printer
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		var err error
+		printer, err = s.Store.GetPrinterByName(ctx, tx, "Office")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("get printer: %v", err)
+	}
+
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCreateJob, 2)
+	req.Job.Add(goipp.MakeAttribute("job-preset-name", goipp.TagName, goipp.String("Letterhead-Tray2")))
+	req.Job.Add(goipp.MakeAttribute("copies", goipp.TagInteger, goipp.Integer(5)))
+	if resp := s.applyJobPreset(ctx, req, destination{Printer: printer}, printer); resp != nil {
+		t.Fatalf("applyJobPreset status %v", goipp.Status(resp.Code))
+	}
+	opts := collectJobOptions(req)
+	if opts["copies"] != "5" || opts["sides"] != "one-sided" {
+		t.Fatalf("job options = %v", opts)
+	}
+	if col := attrByName(req.Job, "media-col"); col == nil || collectionString(col.Values[0].V.(goipp.Collection), "media-source") != "tray-2" {
+		t.Fatalf("preset media source not applied: %v", req.Job)
+	}
+
+	req = goipp.NewRequest(goipp.DefaultVersion, goipp.OpCreateJob, 3)
+	req.Job.Add(goipp.MakeAttribute("job-preset-name", goipp.TagName, goipp.String("booklet")))
+	resp := s.applyJobPreset(ctx, req, destination{Printer: printer}, printer)
+	if resp == nil || goipp.Status(resp.Code) != goipp.StatusErrorAttributesOrValues {
+		t.Fatalf("unknown preset response = %v", resp)
+	}
+	if attrString(resp.Unsupported, "job-preset-name") != "booklet" {
+		t.Fatalf("unsupported = %v", resp.Unsupported)
+	}
+}
+
+func TestParseJobPresetRoundTrip(t *testing.T) {
+	p, err := parseJobPreset("booklet: sides=two-sided-short-edge number-up=2 page-ranges=1-4")
+	if err != nil {
+		t.Fatalf("parseJobPreset: %v", err)
+	}
+	if p.Name != "booklet" || p.Options["number-up"] != "2" || p.Options["sides"] != "two-sided-short-edge" {
+		t.Fatalf("preset = %+v", p)
+	}
+	back, err := parseJobPreset(formatJobPreset(p))
+	if err != nil || formatJobPreset(back) != formatJobPreset(p) {
+		t.Fatalf("round trip %q -> %q (%v)", formatJobPreset(p), formatJobPreset(back), err)
+	}
+	if _, err := parseJobPreset("no options here"); err == nil {
+		t.Fatalf("expected error for a line without a name")
+	}
+	if _, err := parseJobPreset("empty:"); err == nil {
+		t.Fatalf("expected error for a preset without options")
+	}
+}
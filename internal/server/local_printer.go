@@ -275,6 +275,30 @@ func getPrinterAttributesForLocalQueue(ctx context.Context, deviceURI string) (*
 	return resp, nil
 }
 
+var errEverywhereNeedsIPP = errors.New("IPP Everywhere driver requires an IPP connection.")
+
+// getEverywherePrinterAttributes queries the printer behind a permanent
+// queue's device URI for the "everywhere" driver. DNS-SD URIs are resolved
+// for the query only; the queue keeps the URI it was given.
+func getEverywherePrinterAttributes(ctx context.Context, deviceURI string) (*goipp.Message, error) {
+	target := strings.TrimSpace(deviceURI)
+	if strings.Contains(target, "._tcp") || strings.HasPrefix(strings.ToLower(target), "dnssd://") {
+		u, err := resolveMDNSURI(ctx, target)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(u) != "" {
+			target = u
+		}
+	}
+	switch scheme, _, _ := strings.Cut(target, ":"); strings.ToLower(scheme) {
+	case "ipp", "ipps":
+	default:
+		return nil, errEverywhereNeedsIPP
+	}
+	return getPrinterAttributesForLocalQueue(ctx, target)
+}
+
 func removeAttr(attrs goipp.Attributes, name string) goipp.Attributes {
 	if len(attrs) == 0 || name == "" {
 		return attrs
@@ -492,6 +516,22 @@ func extractPPDSizes(supported *goipp.Message) ([]ippPPDSize, string) {
 }
 
 func generatePPDFromIPP(ppdDir string, printerName string, supported *goipp.Message) (string, error) {
+	tmpPath, err := writeTempPPDFromIPP(ppdDir, printerName, supported)
+	if err != nil {
+		return "", err
+	}
+	ppdPath := safePPDPath(ppdDir, printerName+".ppd")
+	if err := os.Rename(tmpPath, ppdPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return "", err
+	}
+	return filepath.Base(ppdPath), nil
+}
+
+// writeTempPPDFromIPP writes the PPD for printerName to a temporary file in
+// the queue's PPD directory and returns its path. The caller renames it into
+// place or removes it.
+func writeTempPPDFromIPP(ppdDir string, printerName string, supported *goipp.Message) (path string, err error) {
 	if supported == nil {
 		return "", errors.New("no IPP attributes")
 	}
@@ -533,7 +573,9 @@ func generatePPDFromIPP(ppdDir string, printerName string, supported *goipp.Mess
 	tmpPath := tmp.Name()
 	defer func() {
 		_ = tmp.Close()
-		_ = os.Remove(tmpPath)
+		if err != nil {
+			_ = os.Remove(tmpPath)
+		}
 	}()
 
 	writeLine := func(format string, args ...any) error {
@@ -878,10 +920,7 @@ func generatePPDFromIPP(ppdDir string, printerName string, supported *goipp.Mess
 	if err := tmp.Close(); err != nil {
 		return "", err
 	}
-	if err := os.Rename(tmpPath, ppdPath); err != nil {
-		return "", err
-	}
-	return filepath.Base(ppdPath), nil
+	return tmpPath, nil
 }
 
 func splitMakeModel(makeModel string) (string, string) {
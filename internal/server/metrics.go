@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cupsgolang/internal/metrics"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	snapshots, err := s.metricsSnapshots(r.Context(), time.Now().UTC())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", metricsContentType)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = metrics.Default.WriteText(w, snapshots...)
+}
+
+// jobStateMetricLabels lists the job states reported by cups_printer_jobs,
+// in the order they are emitted.
+var jobStateMetricLabels = []struct {
+	code  int
+	label string
+}{
+	{3, "queued"},
+	{4, "held"},
+	{5, "processing"},
+	{6, "stopped"},
+}
+
+func (s *Server) metricsSnapshots(ctx context.Context, now time.Time) ([]metrics.Snapshot, error) {
+	if s == nil || s.Store == nil {
+		return nil, nil
+	}
+	var printers []model.Printer
+	var stats map[int64]store.PrinterJobStats
+	supplies := map[int64]store.PrinterSupplies{}
+	err := s.Store.WithTx(ctx, true, func(tx store.Tx) error {
+		var err error
+		printers, err = s.Store.ListPrinters(ctx, tx)
+		if err != nil {
+			return err
+		}
+		stats, err = s.Store.ListPrinterJobStats(ctx, tx)
+		if err != nil {
+			return err
+		}
+		for _, p := range printers {
+			sup, ok, err := s.Store.GetPrinterSupplies(ctx, tx, p.ID)
+			if err != nil {
+				return err
+			}
+			if ok {
+				supplies[p.ID] = sup
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := metrics.Snapshot{
+		Name:   "cups_printer_jobs",
+		Help:   "Active jobs per printer by job state.",
+		Labels: []string{"printer", "state"},
+	}
+	oldest := metrics.Snapshot{
+		Name:   "cups_printer_oldest_queued_job_age_seconds",
+		Help:   "Age of the oldest pending job per printer; 0 when the queue is empty.",
+		Labels: []string{"printer"},
+	}
+	state := metrics.Snapshot{
+		Name:   "cups_printer_state",
+		Help:   "IPP printer-state (3 idle, 4 processing, 5 stopped).",
+		Labels: []string{"printer"},
+	}
+	accepting := metrics.Snapshot{
+		Name:   "cups_printer_accepting_jobs",
+		Help:   "Whether the printer is accepting jobs.",
+		Labels: []string{"printer"},
+	}
+	supplyLevel := metrics.Snapshot{
+		Name:   "cups_printer_supply_level_percent",
+		Help:   "Supply level reported by the printer, in percent.",
+		Labels: []string{"printer", "supply", "description"},
+	}
+	for _, p := range printers {
+		st := stats[p.ID]
+		for _, js := range jobStateMetricLabels {
+			jobs.Samples = append(jobs.Samples, metrics.Sample{
+				LabelValues: []string{p.Name, js.label},
+				Value:       float64(st.StateCounts[js.code]),
+			})
+		}
+		age := 0.0
+		if !st.OldestQueued.IsZero() {
+			age = now.Sub(st.OldestQueued.UTC()).Seconds()
+			if age < 0 {
+				age = 0
+			}
+		}
+		oldest.Samples = append(oldest.Samples, metrics.Sample{LabelValues: []string{p.Name}, Value: age})
+		state.Samples = append(state.Samples, metrics.Sample{LabelValues: []string{p.Name}, Value: float64(p.State)})
+		acc := 0.0
+		if p.Accepting {
+			acc = 1
+		}
+		accepting.Samples = append(accepting.Samples, metrics.Sample{LabelValues: []string{p.Name}, Value: acc})
+		if sup, ok := supplies[p.ID]; ok {
+			for _, level := range supplyLevels(sup.Details) {
+				supplyLevel.Samples = append(supplyLevel.Samples, metrics.Sample{
+					LabelValues: []string{p.Name, level.index, level.desc},
+					Value:       level.percent,
+				})
+			}
+		}
+	}
+	return []metrics.Snapshot{jobs, oldest, state, accepting, supplyLevel}, nil
+}
+
+type supplyLevel struct {
+	index   string
+	desc    string
+	percent float64
+}
+
+// supplyLevels extracts "supply.N.percent"/"supply.N.desc" pairs stored by
+// the backends in printer_supplies.details.
+func supplyLevels(details map[string]string) []supplyLevel {
+	out := []supplyLevel{}
+	for key, value := range details {
+		if !strings.HasPrefix(key, "supply.") || !strings.HasSuffix(key, ".percent") {
+			continue
+		}
+		idx := strings.TrimSuffix(strings.TrimPrefix(key, "supply."), ".percent")
+		pct, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			continue
+		}
+		out = append(out, supplyLevel{
+			index:   idx,
+			desc:    strings.TrimSpace(details["supply."+idx+".desc"]),
+			percent: pct,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].index < out[j].index })
+	return out
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+func TestHandleMetricsReportsQueuesAndSupplies(t *testing.T) {
+	s := newMoveTestServer(t)
+	ctx := context.Background()
+
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		printer, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://printer.local/ipp/print", "", "", model.DefaultPPDName, true, false, true, "none", "")
+		if err != nil {
+			return err
+		}
+		for i := 0; i < 2; i++ {
+			if _, err := s.Store.CreateJob(ctx, tx, printer.ID, "doc", "alice", "", "{}"); err != nil {
+				return err
+			}
+		}
+		return s.Store.UpsertPrinterSupplies(ctx, tx, printer.ID, "ok", map[string]string{
+			"supply.1.desc":    "Black Toner",
+			"supply.1.percent": "4",
+		}, time.Now().UTC())
+	})
+	if err != nil {
+		t.Fatalf("setup store: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %q", rec.Code, rec.Body.String())
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		`cups_printer_jobs{printer="Office",state="queued"} 2`,
+		`cups_printer_state{printer="Office"} 3`,
+		`cups_printer_accepting_jobs{printer="Office"} 1`,
+		`cups_printer_supply_level_percent{printer="Office",supply="1",description="Black Toner"} 4`,
+		"# TYPE cups_ipp_operations_total counter",
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in metrics:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandleMetricsOutputIsStable(t *testing.T) {
+	s := newMoveTestServer(t)
+	ctx := context.Background()
+
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		for _, name := range []string{"Lobby", "Office"} {
+			if _, err := s.Store.CreatePrinter(ctx, tx, name, "ipp://"+strings.ToLower(name)+".local/ipp/print", "", "", model.DefaultPPDName, true, false, true, "none", ""); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("setup store: %v", err)
+	}
+
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCupsGetPrinters, 1)
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	payload, err := req.EncodeBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ippReq := httptest.NewRequest(http.MethodPost, "http://localhost/", bytes.NewReader(payload))
+	ippReq.Header.Set("Content-Type", goipp.ContentType)
+	s.Handler().ServeHTTP(httptest.NewRecorder(), ippReq)
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "http://localhost/metrics", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %q", rec.Code, rec.Body.String())
+		}
+		return rec.Body.String()
+	}
+	body := scrape()
+	for i := 0; i < 5; i++ {
+		if again := scrape(); again != body {
+			t.Fatalf("metrics output changed between scrapes:\n%s\n---\n%s", body, again)
+		}
+	}
+
+	var jobs []string
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "cups_printer_jobs{") {
+			jobs = append(jobs, line)
+		}
+	}
+	want := []string{
+		`cups_printer_jobs{printer="Lobby",state="held"} 0`,
+		`cups_printer_jobs{printer="Lobby",state="processing"} 0`,
+		`cups_printer_jobs{printer="Lobby",state="queued"} 0`,
+		`cups_printer_jobs{printer="Lobby",state="stopped"} 0`,
+		`cups_printer_jobs{printer="Office",state="held"} 0`,
+		`cups_printer_jobs{printer="Office",state="processing"} 0`,
+		`cups_printer_jobs{printer="Office",state="queued"} 0`,
+		`cups_printer_jobs{printer="Office",state="stopped"} 0`,
+	}
+	if strings.Join(jobs, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("cups_printer_jobs lines:\n%s\nwant:\n%s", strings.Join(jobs, "\n"), strings.Join(want, "\n"))
+	}
+	if want := `cups_ipp_operation_duration_seconds_count{operation="CUPS-Get-Printers",status="successful-ok"}`; !strings.Contains(body, want) {
+		t.Fatalf("missing %q in metrics:\n%s", want, body)
+	}
+}
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"os"
@@ -27,7 +26,7 @@ func TestHandleCupsMoveJobMoveAllHonorsOwnerScope(t *testing.T) {
 	var aliceJob model.Job
 	var bobJob model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		source, err = s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -57,7 +56,7 @@ func TestHandleCupsMoveJobMoveAllHonorsOwnerScope(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, aliceJob.ID)
 		if err != nil {
 			return err
@@ -103,7 +102,7 @@ func TestHandleCupsMoveJobRejectsNonDestinationURIPath(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		if _, err := s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", ""); err != nil {
 			return err
 		}
@@ -130,7 +129,7 @@ func TestHandleCupsMoveJobWithZeroJobIDReturnsNotFound(t *testing.T) {
 
 	var source model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		source, err = s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -163,7 +162,7 @@ func TestHandleCupsMoveJobWithZeroJobIDReturnsNotFound(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusErrorNotFound)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		got, err := s.Store.GetJob(ctx, tx, job.ID)
 		if err != nil {
 			return err
@@ -182,7 +181,7 @@ func TestHandleCupsMoveJobWithInvalidJobURIReturnsBadRequest(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		_, err := s.Store.CreatePrinter(ctx, tx, "Destination", "ipp://localhost/printers/Destination", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		return err
 	})
@@ -210,7 +209,7 @@ func TestHandleCupsMoveJobWithJobURIZeroReturnsNotFound(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		_, err := s.Store.CreatePrinter(ctx, tx, "Destination", "ipp://localhost/printers/Destination", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		return err
 	})
@@ -241,7 +240,7 @@ func TestHandleCupsMoveJobWithJobURIExtraPathStillTargetsJobID(t *testing.T) {
 	var source model.Printer
 	var destination model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		source, err = s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -273,7 +272,7 @@ func TestHandleCupsMoveJobWithJobURIExtraPathStillTargetsJobID(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		got, err := s.Store.GetJob(ctx, tx, job.ID)
 		if err != nil {
 			return err
@@ -298,7 +297,7 @@ func TestHandleCupsMoveJobMoveAllFromClass(t *testing.T) {
 	var jobA model.Job
 	var jobB model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		sourceA, err = s.Store.CreatePrinter(ctx, tx, "SourceA", "ipp://localhost/printers/SourceA", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -335,7 +334,7 @@ func TestHandleCupsMoveJobMoveAllFromClass(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, jobA.ID)
 		if err != nil {
 			return err
@@ -368,7 +367,7 @@ func TestHandleCupsMoveJobMoveAllFromClassViaPrintersPath(t *testing.T) {
 	var jobA model.Job
 	var jobB model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		sourceA, err = s.Store.CreatePrinter(ctx, tx, "SourceA", "ipp://localhost/printers/SourceA", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -405,7 +404,7 @@ func TestHandleCupsMoveJobMoveAllFromClassViaPrintersPath(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		job, err := s.Store.GetJob(ctx, tx, jobA.ID)
 		if err != nil {
 			return err
@@ -437,7 +436,7 @@ func TestHandleCupsMoveJobDestinationClassViaPrintersPath(t *testing.T) {
 	var memberB model.Printer
 	var job model.Job
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		source, err = s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -476,7 +475,7 @@ func TestHandleCupsMoveJobDestinationClassViaPrintersPath(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		got, err := s.Store.GetJob(ctx, tx, job.ID)
 		if err != nil {
 			return err
@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -11,6 +10,7 @@ import (
 	goipp "github.com/OpenPrinting/goipp"
 
 	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
 )
 
 func TestIPPMovePolicyContextsSkipWhenDestinationURIIsInvalid(t *testing.T) {
@@ -19,7 +19,7 @@ func TestIPPMovePolicyContextsSkipWhenDestinationURIIsInvalid(t *testing.T) {
 
 	var source model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		source, err = s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -53,7 +53,7 @@ func TestIPPMovePolicyContextsSkipWhenDestinationDoesNotExist(t *testing.T) {
 
 	var source model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		source, err = s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -88,7 +88,7 @@ func TestIPPMovePolicyContextsSkipWhenDestinationPathIsMalformed(t *testing.T) {
 	var source model.Printer
 	var destination model.Printer
 	var job model.Job
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		source, err = s.Store.CreatePrinter(ctx, tx, "Source", "ipp://localhost/printers/Source", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
@@ -125,7 +125,7 @@ func TestIPPMovePolicyContextsSkipWhenExplicitJobIDIsZero(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		_, err := s.Store.CreatePrinter(ctx, tx, "Destination", "ipp://localhost/printers/Destination", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		return err
 	})
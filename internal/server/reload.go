@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"net/http"
+
+	"cupsgolang/internal/config"
+)
+
+// runtimeConfig is the configuration snapshot installed by Reload.
+type runtimeConfig struct {
+	cfg    config.Config
+	policy config.Policy
+}
+
+// Reload atomically replaces the configuration and policy used for new
+// requests. Listeners, the store and the spool are not affected.
+func (s *Server) Reload(cfg config.Config, policy config.Policy) {
+	s.runtime.Store(&runtimeConfig{cfg: cfg, policy: policy})
+	SetAppConfig(cfg)
+}
+
+func (s *Server) currentConfig() config.Config {
+	if rc := s.runtime.Load(); rc != nil {
+		return rc.cfg
+	}
+	return s.Config
+}
+
+func (s *Server) currentPolicy() config.Policy {
+	if rc := s.runtime.Load(); rc != nil {
+		return rc.policy
+	}
+	return s.Policy
+}
+
+type policySnapshotKey struct{}
+
+// withPolicySnapshot pins the policy Handler loaded to the request.
+func withPolicySnapshot(r *http.Request, policy config.Policy) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), policySnapshotKey{}, &policy))
+}
+
+// requestPolicy returns the policy snapshot taken for r, so every check
+// made while serving one request uses the same rules even if a reload
+// happens part way through. Requests that did not come through Handler
+// get the current policy.
+func (s *Server) requestPolicy(r *http.Request) config.Policy {
+	if r != nil {
+		if p, ok := r.Context().Value(policySnapshotKey{}).(*config.Policy); ok {
+			return *p
+		}
+	}
+	return s.currentPolicy()
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/config"
+)
+
+func TestReloadSwapsConfigAndPolicy(t *testing.T) {
+	prev := appConfig()
+	t.Cleanup(func() { SetAppConfig(prev) })
+	s := &Server{
+		Config: config.Config{ServerName: "before"},
+		Policy: config.Policy{Policies: []string{"default"}},
+	}
+	if got := s.currentConfig().ServerName; got != "before" {
+		t.Fatalf("expected startup config, got %q", got)
+	}
+
+	s.Reload(config.Config{ServerName: "after"}, config.Policy{Policies: []string{"default", "strict"}})
+	if got := s.currentConfig().ServerName; got != "after" {
+		t.Fatalf("expected reloaded config, got %q", got)
+	}
+	if got := len(s.currentPolicy().Policies); got != 2 {
+		t.Fatalf("expected reloaded policy, got %d policies", got)
+	}
+	if got := appConfig().ServerName; got != "after" {
+		t.Fatalf("expected app config to follow reload, got %q", got)
+	}
+	if s.Config.ServerName != "before" {
+		t.Fatalf("startup config must not be modified")
+	}
+}
+
+func TestRestartSystemCallsReloader(t *testing.T) {
+	s := newMoveTestServer(t)
+	calls := 0
+	s.Reloader = func() error {
+		calls++
+		return nil
+	}
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpRestartSystem, 1)
+	r := httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil)
+
+	resp, err := s.handleRestartSystem(context.Background(), r, req)
+	if err != nil {
+		t.Fatalf("handleRestartSystem error: %v", err)
+	}
+	if calls != 1 {
+		t.Fatalf("expected reloader to run once, ran %d times", calls)
+	}
+	if goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("expected successful-ok, got %v", goipp.Status(resp.Code))
+	}
+
+	s.Reloader = func() error { return errors.New("bad config") }
+	resp, err = s.handleRestartSystem(context.Background(), r, req)
+	if err != nil {
+		t.Fatalf("handleRestartSystem error: %v", err)
+	}
+	if goipp.Status(resp.Code) != goipp.StatusErrorInternal {
+		t.Fatalf("expected server-error-internal-error, got %v", goipp.Status(resp.Code))
+	}
+}
+
+func TestRequestKeepsPolicySnapshotAcrossReload(t *testing.T) {
+	prev := appConfig()
+	t.Cleanup(func() { SetAppConfig(prev) })
+	s := &Server{Policy: config.Policy{Locations: []config.LocationRule{{Path: "/", AuthType: "Basic"}}}}
+
+	r := withPolicySnapshot(httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), s.currentPolicy())
+	s.Reload(config.Config{}, config.Policy{Locations: []config.LocationRule{{Path: "/", AuthType: "None"}}})
+
+	if got := s.authTypeForRequest(r, ""); got != "Basic" {
+		t.Fatalf("in-flight request auth type = %q, want the snapshot's Basic", got)
+	}
+	if got := s.authTypeForRequest(httptest.NewRequest(http.MethodPost, "http://localhost/admin/", nil), ""); got != "None" {
+		t.Fatalf("new request auth type = %q, want the reloaded None", got)
+	}
+}
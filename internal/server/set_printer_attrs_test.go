@@ -2,7 +2,6 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -10,6 +9,7 @@ import (
 	goipp "github.com/OpenPrinting/goipp"
 
 	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
 )
 
 func TestHandleSetPrinterAttributesUpdatesOnlyBasicPrinterFields(t *testing.T) {
@@ -17,7 +17,7 @@ func TestHandleSetPrinterAttributesUpdatesOnlyBasicPrinterFields(t *testing.T) {
 	ctx := context.Background()
 
 	var printer model.Printer
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		var err error
 		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "L1", "Old Info", model.DefaultPPDName, true, false, false, "none", `{"printer-error-policy":"abort-job"}`)
 		if err != nil {
@@ -48,7 +48,7 @@ func TestHandleSetPrinterAttributesUpdatesOnlyBasicPrinterFields(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		got, err := s.Store.GetPrinterByName(ctx, tx, "Office")
 		if err != nil {
 			return err
@@ -70,7 +70,7 @@ func TestHandleSetPrinterAttributesClassUpdatesInfoLocationOnly(t *testing.T) {
 	s := newMoveTestServer(t)
 	ctx := context.Background()
 
-	err := s.Store.WithTx(ctx, false, func(tx *sql.Tx) error {
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
 		printer, err := s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
 		if err != nil {
 			return err
@@ -95,7 +95,7 @@ func TestHandleSetPrinterAttributesClassUpdatesInfoLocationOnly(t *testing.T) {
 		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
 	}
 
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		class, err := s.Store.GetClassByName(ctx, tx, "Team")
 		if err != nil {
 			return err
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/store"
+)
+
+func buildSubscriptionRequest(op goipp.Op, printerURI, user string) *goipp.Message {
+	req := goipp.NewRequest(goipp.DefaultVersion, op, 1)
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	if printerURI != "" {
+		req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String(printerURI)))
+	}
+	req.Operation.Add(goipp.MakeAttribute("requesting-user-name", goipp.TagName, goipp.String(user)))
+	return req
+}
+
+func TestCreatePrinterSubscriptionServerWideGetsJobEvents(t *testing.T) {
+	s := newMoveTestServer(t)
+	s.Store.(*store.Store).MaxEvents = s.Config.MaxEvents
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodPost, "http://localhost/", nil)
+
+	var printer model.Printer
+	err := s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		var err error
+		printer, err = s.Store.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "", model.DefaultPPDName, true, false, false, "none", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create printer: %v", err)
+	}
+
+	req := buildSubscriptionRequest(goipp.OpCreatePrinterSubscriptions, "ipp://localhost/", "alice")
+	req.Subscription.Add(goipp.MakeAttribute("notify-pull-method", goipp.TagKeyword, goipp.String("ippget")))
+	req.Subscription.Add(goipp.MakeAttr("notify-events", goipp.TagKeyword, goipp.String("job-created"), goipp.String("printer-state-changed")))
+	resp, err := s.handleCreatePrinterSubscription(ctx, r, req)
+	if err != nil {
+		t.Fatalf("handleCreatePrinterSubscription error: %v", err)
+	}
+	if got := goipp.Status(resp.Code); got != goipp.StatusOk {
+		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
+	}
+	subID := attrInt(resp.Subscription, "notify-subscription-id")
+	if subID == 0 {
+		t.Fatalf("no notify-subscription-id in %v", resp.Subscription)
+	}
+
+	err = s.Store.WithTx(ctx, false, func(tx store.Tx) error {
+		_, err := s.Store.CreateJob(ctx, tx, printer.ID, "bob-payroll.pdf", "bob", "localhost", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create job: %v", err)
+	}
+
+	req = buildSubscriptionRequest(goipp.OpGetNotifications, "", "alice")
+	req.Operation.Add(goipp.MakeAttribute("notify-subscription-ids", goipp.TagInteger, goipp.Integer(subID)))
+	resp, err = s.handleGetNotifications(ctx, r, req)
+	if err != nil {
+		t.Fatalf("handleGetNotifications error: %v", err)
+	}
+	if got := goipp.Status(resp.Code); got != goipp.StatusOk {
+		t.Fatalf("status = %v, want %v", got, goipp.StatusOk)
+	}
+	created := 0
+	for _, g := range resp.Groups {
+		if g.Tag != goipp.TagEventNotificationGroup {
+			continue
+		}
+		if attrString(g.Attrs, "notify-event") == "job-created" {
+			created++
+		}
+		// A server-wide subscription learns that a job event happened, but
+		// nothing that identifies someone else's job.
+		for _, a := range g.Attrs {
+			switch a.Name {
+			case "notify-job-id", "job-id", "job-name", "job-originating-user-name":
+				t.Fatalf("event for bob's job discloses %s to alice: %v", a.Name, g.Attrs)
+			}
+			for _, v := range a.Values {
+				if v.V.String() == "bob" || v.V.String() == "bob-payroll.pdf" {
+					t.Fatalf("event for bob's job discloses %q in %s", v.V.String(), a.Name)
+				}
+			}
+		}
+	}
+	if created != 1 {
+		t.Fatalf("job-created events = %d, want 1 (%v)", created, resp.Groups)
+	}
+
+	// Only the subscriber may read its events.
+	req = buildSubscriptionRequest(goipp.OpGetNotifications, "", "bob")
+	req.Operation.Add(goipp.MakeAttribute("notify-subscription-ids", goipp.TagInteger, goipp.Integer(subID)))
+	resp, err = s.handleGetNotifications(ctx, r, req)
+	if err != nil {
+		t.Fatalf("handleGetNotifications error: %v", err)
+	}
+	if got := goipp.Status(resp.Code); got != goipp.StatusErrorNotAuthorized {
+		t.Fatalf("status for another user = %v, want %v", got, goipp.StatusErrorNotAuthorized)
+	}
+}
+
+func TestCreatePrinterSubscriptionServerWideCountsAgainstLimits(t *testing.T) {
+	ctx := context.Background()
+	r := httptest.NewRequest(http.MethodPost, "http://localhost/", nil)
+	subscribe := func(s *Server, user string) goipp.Status {
+		t.Helper()
+		req := buildSubscriptionRequest(goipp.OpCreatePrinterSubscriptions, "ipp://localhost/", user)
+		req.Subscription.Add(goipp.MakeAttribute("notify-pull-method", goipp.TagKeyword, goipp.String("ippget")))
+		resp, err := s.handleCreatePrinterSubscription(ctx, r, req)
+		if err != nil {
+			t.Fatalf("handleCreatePrinterSubscription error: %v", err)
+		}
+		return goipp.Status(resp.Code)
+	}
+
+	s := newMoveTestServer(t)
+	s.Config.MaxSubscriptions = 2
+	s.Config.MaxSubscriptionsPerUser = 0
+	for i, want := range []goipp.Status{goipp.StatusOk, goipp.StatusOk, goipp.StatusErrorTooManySubscriptions} {
+		if got := subscribe(s, "user"+string(rune('a'+i))); got != want {
+			t.Fatalf("MaxSubscriptions: subscription %d status = %v, want %v", i+1, got, want)
+		}
+	}
+
+	s = newMoveTestServer(t)
+	s.Config.MaxSubscriptions = 0
+	s.Config.MaxSubscriptionsPerUser = 1
+	if got := subscribe(s, "alice"); got != goipp.StatusOk {
+		t.Fatalf("first subscription status = %v", got)
+	}
+	if got := subscribe(s, "alice"); got != goipp.StatusErrorTooManySubscriptions {
+		t.Fatalf("MaxSubscriptionsPerUser: second subscription status = %v, want %v", got, goipp.StatusErrorTooManySubscriptions)
+	}
+	if got := subscribe(s, "bob"); got != goipp.StatusOk {
+		t.Fatalf("another user's subscription status = %v", got)
+	}
+}
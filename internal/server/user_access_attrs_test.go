@@ -2,13 +2,14 @@ package server
 
 import (
 	"context"
-	"database/sql"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
 	"testing"
 
 	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/store"
 )
 
 func TestHandleCupsAddModifyPrinterStoresAllowedUsers(t *testing.T) {
@@ -38,7 +39,7 @@ func TestHandleCupsAddModifyPrinterStoresAllowedUsers(t *testing.T) {
 	var printerID int64
 	var allowed string
 	var denied string
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		printer, err := s.Store.GetPrinterByName(ctx, tx, "Office")
 		if err != nil {
 			return err
@@ -91,7 +92,7 @@ func TestHandleCupsAddModifyClassStoresDeniedUsers(t *testing.T) {
 
 	var allowed string
 	var denied string
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		class, err := s.Store.GetClassByName(ctx, tx, "Team")
 		if err != nil {
 			return err
@@ -136,7 +137,7 @@ func TestHandleCupsAddModifyPrinterUserAccessLastAttributeWins(t *testing.T) {
 
 	var allowed string
 	var denied string
-	err = s.Store.WithTx(ctx, true, func(tx *sql.Tx) error {
+	err = s.Store.WithTx(ctx, true, func(tx store.Tx) error {
 		printer, err := s.Store.GetPrinterByName(ctx, tx, "Office")
 		if err != nil {
 			return err
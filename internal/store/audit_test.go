@@ -0,0 +1,74 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"cupsgolang/internal/model"
+)
+
+func TestAuditLogAppendOnly(t *testing.T) {
+	ctx := context.Background()
+	st, err := Open(ctx, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = st.Close()
+	})
+	st.MaxEvents = 10
+
+	var subID int64
+	err = st.WithTx(ctx, false, func(tx Tx) error {
+		p, err := st.CreatePrinter(ctx, tx, "Office", "ipp://office/ipp/print", "", "", "", true, false, true, "none", "")
+		if err != nil {
+			return err
+		}
+		sub, err := st.CreateSubscription(ctx, tx, SubscriptionLimits{}, &p.ID, nil, "server-audit", 0, "admin", "", "", 0, nil)
+		if err != nil {
+			return err
+		}
+		subID = sub.ID
+		_, err = st.AddAuditEntry(ctx, tx, model.AuditEntry{
+			User:       "admin",
+			RemoteAddr: "10.0.0.5",
+			Operation:  "CUPS-Add-Modify-Printer",
+			Target:     "Office",
+			Changes:    map[string][2]string{"printer-location": {"", "Lab"}},
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("add entry: %v", err)
+	}
+
+	err = st.WithTx(ctx, true, func(tx Tx) error {
+		entries, err := st.ListAuditEntries(ctx, tx, AuditFilter{Target: "Office"})
+		if err != nil {
+			return err
+		}
+		if len(entries) != 1 || entries[0].User != "admin" || entries[0].Changes["printer-location"][1] != "Lab" {
+			t.Fatalf("entries = %+v", entries)
+		}
+		notes, err := st.ListNotifications(ctx, tx, subID, 10)
+		if err != nil {
+			return err
+		}
+		if len(notes) != 1 || notes[0].Event != "server-audit" {
+			t.Fatalf("notifications = %+v", notes)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+
+	err = st.WithTx(ctx, false, func(tx Tx) error {
+		_, err := sqlTx(tx).ExecContext(ctx, `DELETE FROM audit_log`)
+		return err
+	})
+	if err == nil {
+		t.Fatalf("expected delete from audit_log to be rejected")
+	}
+}
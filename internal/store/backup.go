@@ -0,0 +1,115 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"modernc.org/sqlite"
+)
+
+type backuper interface {
+	NewBackup(dstURI string) (*sqlite.Backup, error)
+}
+
+// Backup writes a consistent copy of the database to dst using SQLite's
+// online backup API; the store stays usable while the copy is taken. An
+// existing file at dst is replaced.
+func (s *Store) Backup(ctx context.Context, dst string) error {
+	if s == nil || s.db == nil {
+		return errors.New("store not initialized")
+	}
+	if err := os.Remove(dst); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	return conn.Raw(func(driverConn any) error {
+		src, ok := driverConn.(backuper)
+		if !ok {
+			return errors.New("sqlite driver does not support online backup")
+		}
+		b, err := src.NewBackup(dst)
+		if err != nil {
+			return err
+		}
+		for {
+			if err := ctx.Err(); err != nil {
+				_ = b.Finish()
+				return err
+			}
+			more, err := b.Step(256)
+			if err != nil {
+				_ = b.Finish()
+				return err
+			}
+			if !more {
+				break
+			}
+		}
+		return b.Finish()
+	})
+}
+
+type restorer interface {
+	NewRestore(srcURI string) (*sqlite.Backup, error)
+}
+
+// Restore replaces the contents of the database with the SQLite database at
+// src. Both databases must be at the same schema version; Restore never
+// migrates either of them.
+func (s *Store) Restore(ctx context.Context, src string) error {
+	if s == nil || s.db == nil {
+		return errors.New("store not initialized")
+	}
+	if err := s.checkSameSchema(ctx, src); err != nil {
+		return err
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	err = conn.Raw(func(driverConn any) error {
+		dst, ok := driverConn.(restorer)
+		if !ok {
+			return errors.New("sqlite driver does not support online restore")
+		}
+		b, err := dst.NewRestore(src)
+		if err != nil {
+			return err
+		}
+		if _, err := b.Step(-1); err != nil {
+			_ = b.Finish()
+			return err
+		}
+		return b.Finish()
+	})
+	_ = conn.Close()
+	return err
+}
+
+// checkSameSchema fails unless the database at src has the schema version of
+// s.
+func (s *Store) checkSameSchema(ctx context.Context, src string) error {
+	other, err := OpenExisting(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+	want, err := s.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	got, err := other.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if got != want {
+		return fmt.Errorf("database schema version %d does not match the current database (%d)", got, want)
+	}
+	return nil
+}
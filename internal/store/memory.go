@@ -0,0 +1,1739 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"cupsgolang/internal/model"
+)
+
+// memLockTimeout matches the busy_timeout the SQLite store opens with.
+const memLockTimeout = 5 * time.Second
+
+var (
+	errMemLocked   = errors.New("database is locked")
+	errMemReadOnly = errors.New("attempt to write a readonly database")
+	errMemFK       = errors.New("FOREIGN KEY constraint failed")
+)
+
+func errMemUnique(column string) error {
+	return fmt.Errorf("UNIQUE constraint failed: %s", column)
+}
+
+// Memory is a Repository that keeps all state in process memory; nothing
+// survives a restart. It suits tests and ephemeral deployments that are
+// configured from scratch on every start.
+//
+// Write transactions are serialized. Each one works on a private copy of the
+// data that replaces the committed state only when the callback succeeds, so
+// a failed callback leaves nothing behind. Read transactions see the state
+// committed when they began and never block.
+//
+// The copy is shallow but covers every table, so each write transaction
+// costs time and garbage proportional to the number of stored rows, whatever
+// it touches. That is cheap for the queue counts Memory is meant for; keep
+// large job histories in the SQLite Store.
+type Memory struct {
+	MaxEvents int
+
+	writer     chan struct{}
+	data       atomic.Pointer[memData]
+	generation atomic.Uint64
+}
+
+type memData struct {
+	printers      map[int64]model.Printer
+	classes       map[int64]model.Class
+	members       map[int64][]int64
+	jobs          map[int64]model.Job
+	documents     map[int64]model.Document
+	jobEvents     map[int64][]memJobEvent
+	users         map[string]model.User
+	settings      map[string]string
+	subscriptions map[int64]model.Subscription
+	notifications map[int64][]model.Notification
+	supplies      map[int64]PrinterSupplies
+	options       map[int64]map[string]string
+	ppdCache      map[string]memPPDCache
+	devices       map[string]DeviceCacheEntry
+	audit         []model.AuditEntry
+	seq           memSeq
+}
+
+// memSeq holds the last ID handed out per table. Like SQLite AUTOINCREMENT,
+// IDs are never reused.
+type memSeq struct {
+	printer, class, job, document, jobEvent, user, subscription, notification, audit int64
+}
+
+type memJobEvent struct {
+	ID        int64
+	Event     string
+	Details   map[string]string
+	CreatedAt time.Time
+}
+
+type memPPDCache struct {
+	hash      string
+	attrs     string
+	updatedAt time.Time
+}
+
+type memTx struct {
+	data     *memData
+	readOnly bool
+}
+
+func (*memTx) storeTx() {}
+
+var _ Repository = (*Memory)(nil)
+
+// NewMemory returns an empty in-memory repository.
+func NewMemory() *Memory {
+	m := &Memory{writer: make(chan struct{}, 1)}
+	m.data.Store(&memData{
+		printers:      map[int64]model.Printer{},
+		classes:       map[int64]model.Class{},
+		members:       map[int64][]int64{},
+		jobs:          map[int64]model.Job{},
+		documents:     map[int64]model.Document{},
+		jobEvents:     map[int64][]memJobEvent{},
+		users:         map[string]model.User{},
+		settings:      map[string]string{},
+		subscriptions: map[int64]model.Subscription{},
+		notifications: map[int64][]model.Notification{},
+		supplies:      map[int64]PrinterSupplies{},
+		options:       map[int64]map[string]string{},
+		ppdCache:      map[string]memPPDCache{},
+		devices:       map[string]DeviceCacheEntry{},
+	})
+	return m
+}
+
+// clone copies the tables, which is O(rows) for every write transaction.
+// Slices and nested maps are shared with the original and must be replaced,
+// never modified in place.
+func (d *memData) clone() *memData {
+	c := *d
+	c.printers = maps.Clone(d.printers)
+	c.classes = maps.Clone(d.classes)
+	c.members = maps.Clone(d.members)
+	c.jobs = maps.Clone(d.jobs)
+	c.documents = maps.Clone(d.documents)
+	c.jobEvents = maps.Clone(d.jobEvents)
+	c.users = maps.Clone(d.users)
+	c.settings = maps.Clone(d.settings)
+	c.subscriptions = maps.Clone(d.subscriptions)
+	c.notifications = maps.Clone(d.notifications)
+	c.supplies = maps.Clone(d.supplies)
+	c.options = maps.Clone(d.options)
+	c.ppdCache = maps.Clone(d.ppdCache)
+	c.devices = maps.Clone(d.devices)
+	c.audit = slices.Clip(d.audit)
+	return &c
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
+
+func (m *Memory) WithTx(ctx context.Context, readOnly bool, fn func(tx Tx) error) error {
+	if m == nil || m.writer == nil {
+		return fmt.Errorf("store not initialized")
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if readOnly {
+		return fn(&memTx{data: m.data.Load(), readOnly: true})
+	}
+	timer := time.NewTimer(memLockTimeout)
+	defer timer.Stop()
+	select {
+	case m.writer <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return errMemLocked
+	}
+	defer func() { <-m.writer }()
+	tx := &memTx{data: m.data.Load().clone()}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.data.Store(tx.data)
+	m.generation.Add(1)
+	return nil
+}
+
+// Generation counts the write transactions committed to m.
+func (m *Memory) Generation() uint64 {
+	return m.generation.Load()
+}
+
+// read unwraps a transaction opened by Memory.WithTx.
+func (m *Memory) read(t Tx) *memData {
+	tx, ok := t.(*memTx)
+	if !ok {
+		panic(fmt.Sprintf("store: %T is not an in-memory transaction", t))
+	}
+	return tx.data
+}
+
+// write unwraps a transaction that is about to change data.
+func (m *Memory) write(t Tx) (*memData, error) {
+	tx, ok := t.(*memTx)
+	if !ok {
+		panic(fmt.Sprintf("store: %T is not an in-memory transaction", t))
+	}
+	if tx.readOnly {
+		return nil, errMemReadOnly
+	}
+	return tx.data, nil
+}
+
+func (m *Memory) EnsureDefaultPrinter(ctx context.Context) error {
+	return m.WithTx(ctx, false, func(tx Tx) error {
+		d, _ := m.write(tx)
+		if len(d.printers) > 0 {
+			return nil
+		}
+		now := time.Now().UTC()
+		d.seq.printer++
+		d.printers[d.seq.printer] = model.Printer{
+			ID:               d.seq.printer,
+			Name:             "Default",
+			URI:              "http://localhost:631/printers/Default",
+			PPDName:          model.DefaultPPDName,
+			Info:             "Default Printer",
+			State:            3,
+			Accepting:        true,
+			Shared:           true,
+			IsDefault:        true,
+			JobSheetsDefault: "none",
+			CreatedAt:        now,
+			UpdatedAt:        now,
+		}
+		return nil
+	})
+}
+
+func (m *Memory) EnsureAdminUser(ctx context.Context) error {
+	user, pass := adminCredentials()
+	return m.WithTx(ctx, false, func(tx Tx) error {
+		u, err := m.GetUserByUsername(ctx, tx, user)
+		if err == nil {
+			if u.DigestHA1 == "" && pass != "" && checkPassword(u.PasswordHash, pass) == nil {
+				_ = m.SetUserDigestHA1(ctx, tx, user, digestHA1(user, pass))
+			}
+			return nil
+		}
+		return m.CreateUser(ctx, tx, user, pass, true)
+	})
+}
+
+// limitRows applies SQL LIMIT semantics: a negative limit means no limit.
+func limitRows[T any](rows []T, limit int) []T {
+	if limit >= 0 && len(rows) > limit {
+		return rows[:limit]
+	}
+	return rows
+}
+
+func sortedKeys[K int64 | string, V any](in map[K]V) []K {
+	keys := make([]K, 0, len(in))
+	for k := range in {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// Printers
+
+func (m *Memory) ListPrinters(ctx context.Context, tx Tx) ([]model.Printer, error) {
+	d := m.read(tx)
+	out := make([]model.Printer, 0, len(d.printers))
+	for _, p := range d.printers {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *Memory) ListTemporaryPrinters(ctx context.Context, tx Tx, force bool, unusedBefore time.Time, limit int) ([]model.Printer, error) {
+	if limit <= 0 {
+		limit = 1000
+	}
+	d := m.read(tx)
+	out := []model.Printer{}
+	for _, p := range d.printers {
+		if p.IsTemporary && (force || (p.State != 4 && p.UpdatedAt.Before(unusedBefore))) {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.Before(out[j].UpdatedAt) })
+	return limitRows(out, limit), nil
+}
+
+func (m *Memory) findPrinter(d *memData, match func(model.Printer) bool) (model.Printer, error) {
+	for _, id := range sortedKeys(d.printers) {
+		if p := d.printers[id]; match(p) {
+			return p, nil
+		}
+	}
+	return model.Printer{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetPrinterByName(ctx context.Context, tx Tx, name string) (model.Printer, error) {
+	return m.findPrinter(m.read(tx), func(p model.Printer) bool { return p.Name == name })
+}
+
+func (m *Memory) GetPrinterByID(ctx context.Context, tx Tx, id int64) (model.Printer, error) {
+	p, ok := m.read(tx).printers[id]
+	if !ok {
+		return model.Printer{}, sql.ErrNoRows
+	}
+	return p, nil
+}
+
+func (m *Memory) GetPrinterByURI(ctx context.Context, tx Tx, uri string) (model.Printer, error) {
+	return m.findPrinter(m.read(tx), func(p model.Printer) bool { return p.URI == uri })
+}
+
+func (m *Memory) GetDefaultPrinter(ctx context.Context, tx Tx) (model.Printer, error) {
+	d := m.read(tx)
+	if p, err := m.findPrinter(d, func(p model.Printer) bool { return p.IsDefault }); err == nil {
+		return p, nil
+	}
+	return m.findPrinter(d, func(model.Printer) bool { return true })
+}
+
+// checkPrinterUnique enforces the UNIQUE constraints on printers.name and
+// printers.uri for the printer with the given ID.
+func (m *Memory) checkPrinterUnique(d *memData, id int64, name, uri string) error {
+	for _, p := range d.printers {
+		if p.ID == id {
+			continue
+		}
+		if p.Name == name {
+			return errMemUnique("printers.name")
+		}
+		if p.URI == uri {
+			return errMemUnique("printers.uri")
+		}
+	}
+	return nil
+}
+
+// updatePrinter applies fn to a printer and stamps updated_at. A missing
+// printer is not an error, as with an UPDATE that matches no rows.
+func (m *Memory) updatePrinter(tx Tx, id int64, fn func(p *model.Printer) error) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	p, ok := d.printers[id]
+	if !ok {
+		return nil
+	}
+	if err := fn(&p); err != nil {
+		return err
+	}
+	p.UpdatedAt = time.Now().UTC()
+	d.printers[id] = p
+	return nil
+}
+
+// updatePrinterConfig is updatePrinter followed by the notifications every
+// printer configuration change sends.
+func (m *Memory) updatePrinterConfig(tx Tx, id int64, fn func(p *model.Printer) error) error {
+	if err := m.updatePrinter(tx, id, fn); err != nil {
+		return err
+	}
+	d, _ := m.write(tx)
+	m.notifyPrinter(d, id, "printer-changed")
+	m.notifyPrinter(d, id, "printer-config-changed")
+	m.notifyPrinter(d, id, "printer-modified")
+	return nil
+}
+
+func (m *Memory) CreatePrinter(ctx context.Context, tx Tx, name, uri, location, info, ppdName string, accepting bool, isDefault bool, shared bool, jobSheetsDefault, defaultOptions string) (model.Printer, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Printer{}, err
+	}
+	if err := m.checkPrinterUnique(d, 0, name, uri); err != nil {
+		return model.Printer{}, err
+	}
+	if strings.TrimSpace(jobSheetsDefault) == "" {
+		jobSheetsDefault = "none"
+	}
+	ppdName = strings.TrimSpace(ppdName)
+	if ppdName == "" {
+		ppdName = model.DefaultPPDName
+	}
+	now := time.Now().UTC()
+	d.seq.printer++
+	p := model.Printer{
+		ID:               d.seq.printer,
+		Name:             name,
+		URI:              uri,
+		PPDName:          ppdName,
+		Location:         location,
+		Info:             info,
+		State:            3,
+		Accepting:        accepting,
+		Shared:           shared,
+		IsDefault:        isDefault,
+		JobSheetsDefault: jobSheetsDefault,
+		DefaultOptions:   defaultOptions,
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	d.printers[p.ID] = p
+	m.notifyPrinter(d, p.ID, "printer-added")
+	return p, nil
+}
+
+func (m *Memory) UpsertPrinter(ctx context.Context, tx Tx, name, uri, location, info string, accepting bool) (model.Printer, error) {
+	existing, err := m.GetPrinterByName(ctx, tx, name)
+	if err != nil {
+		return m.CreatePrinter(ctx, tx, name, uri, location, info, "", accepting, false, true, "none", "")
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Printer{}, err
+	}
+	if err := m.checkPrinterUnique(d, existing.ID, name, uri); err != nil {
+		return model.Printer{}, err
+	}
+	err = m.updatePrinterConfig(tx, existing.ID, func(p *model.Printer) error {
+		p.URI = uri
+		p.Location = location
+		p.Info = info
+		p.Accepting = accepting
+		return nil
+	})
+	if err != nil {
+		return model.Printer{}, err
+	}
+	return d.printers[existing.ID], nil
+}
+
+func (m *Memory) TouchPrinter(ctx context.Context, tx Tx, id int64) error {
+	return m.updatePrinter(tx, id, func(*model.Printer) error { return nil })
+}
+
+func (m *Memory) UpdatePrinterTemporary(ctx context.Context, tx Tx, id int64, temporary bool) error {
+	return m.updatePrinter(tx, id, func(p *model.Printer) error {
+		p.IsTemporary = temporary
+		return nil
+	})
+}
+
+func (m *Memory) DeleteTemporaryPrinters(ctx context.Context, tx Tx, force bool, unusedBefore time.Time) (int64, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return 0, err
+	}
+	var n int64
+	for _, id := range sortedKeys(d.printers) {
+		p := d.printers[id]
+		if p.IsTemporary && (force || (p.State != 4 && p.UpdatedAt.Before(unusedBefore))) {
+			m.deletePrinter(d, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *Memory) UpdatePrinterAttributes(ctx context.Context, tx Tx, id int64, info, location, geo, org, orgUnit *string) error {
+	if info == nil && location == nil && geo == nil && org == nil && orgUnit == nil {
+		return nil
+	}
+	return m.updatePrinterConfig(tx, id, func(p *model.Printer) error {
+		if info != nil {
+			p.Info = *info
+		}
+		if location != nil {
+			p.Location = *location
+		}
+		if geo != nil {
+			p.Geo = *geo
+		}
+		if org != nil {
+			p.Org = *org
+		}
+		if orgUnit != nil {
+			p.OrgUnit = *orgUnit
+		}
+		return nil
+	})
+}
+
+func (m *Memory) UpdatePrinterSharing(ctx context.Context, tx Tx, id int64, shared bool) error {
+	return m.updatePrinterConfig(tx, id, func(p *model.Printer) error {
+		p.Shared = shared
+		return nil
+	})
+}
+
+func (m *Memory) UpdatePrinterURI(ctx context.Context, tx Tx, id int64, uri string) error {
+	uri = strings.TrimSpace(uri)
+	if uri == "" {
+		return fmt.Errorf("empty printer uri")
+	}
+	return m.updatePrinterConfig(tx, id, func(p *model.Printer) error {
+		d, _ := m.write(tx)
+		if err := m.checkPrinterUnique(d, id, p.Name, uri); err != nil {
+			return err
+		}
+		p.URI = uri
+		return nil
+	})
+}
+
+func (m *Memory) UpdatePrinterPPDName(ctx context.Context, tx Tx, id int64, ppdName string) error {
+	ppdName = strings.TrimSpace(ppdName)
+	if ppdName == "" {
+		ppdName = model.DefaultPPDName
+	}
+	return m.updatePrinterConfig(tx, id, func(p *model.Printer) error {
+		p.PPDName = ppdName
+		return nil
+	})
+}
+
+func (m *Memory) UpdatePrinterJobSheetsDefault(ctx context.Context, tx Tx, id int64, sheets string) error {
+	if strings.TrimSpace(sheets) == "" {
+		sheets = "none"
+	}
+	return m.updatePrinterConfig(tx, id, func(p *model.Printer) error {
+		p.JobSheetsDefault = sheets
+		return nil
+	})
+}
+
+func (m *Memory) UpdatePrinterDefaultOptions(ctx context.Context, tx Tx, id int64, optionsJSON string) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if err := m.updatePrinter(tx, id, func(p *model.Printer) error {
+		p.DefaultOptions = optionsJSON
+		return nil
+	}); err != nil {
+		return err
+	}
+	delete(d.options, id)
+	parsed := map[string]string{}
+	if strings.TrimSpace(optionsJSON) != "" {
+		if err := json.Unmarshal([]byte(optionsJSON), &parsed); err == nil {
+			for k, v := range parsed {
+				if err := m.SetPrinterOption(ctx, tx, id, k, v); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	m.notifyPrinter(d, id, "printer-changed")
+	m.notifyPrinter(d, id, "printer-config-changed")
+	m.notifyPrinter(d, id, "printer-modified")
+	return nil
+}
+
+func (m *Memory) UpdatePrinterAccepting(ctx context.Context, tx Tx, id int64, accepting bool) error {
+	return m.updatePrinterConfig(tx, id, func(p *model.Printer) error {
+		p.Accepting = accepting
+		return nil
+	})
+}
+
+func (m *Memory) UpdateAllPrintersAccepting(ctx context.Context, tx Tx, accepting bool) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	for id := range d.printers {
+		_ = m.updatePrinter(tx, id, func(p *model.Printer) error {
+			p.Accepting = accepting
+			return nil
+		})
+	}
+	return nil
+}
+
+func (m *Memory) UpdatePrinterState(ctx context.Context, tx Tx, id int64, state int) error {
+	err := m.updatePrinter(tx, id, func(p *model.Printer) error {
+		p.State = state
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d, _ := m.write(tx)
+	m.notifyPrinter(d, id, "printer-state-changed")
+	if state == 5 {
+		m.notifyPrinter(d, id, "printer-stopped")
+	} else if state == 3 {
+		m.notifyPrinter(d, id, "printer-restarted")
+	}
+	return nil
+}
+
+func (m *Memory) UpdateAllPrintersState(ctx context.Context, tx Tx, state int) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	for id := range d.printers {
+		_ = m.updatePrinter(tx, id, func(p *model.Printer) error {
+			p.State = state
+			return nil
+		})
+	}
+	return nil
+}
+
+// clearDefaults unsets is_default everywhere without touching updated_at.
+func (m *Memory) clearDefaults(d *memData) {
+	for id, p := range d.printers {
+		if p.IsDefault {
+			p.IsDefault = false
+			d.printers[id] = p
+		}
+	}
+	for id, c := range d.classes {
+		if c.IsDefault {
+			c.IsDefault = false
+			d.classes[id] = c
+		}
+	}
+}
+
+func (m *Memory) SetDefaultPrinter(ctx context.Context, tx Tx, id int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	m.clearDefaults(d)
+	return m.updatePrinter(tx, id, func(p *model.Printer) error {
+		p.IsDefault = true
+		return nil
+	})
+}
+
+func (m *Memory) DeletePrinter(ctx context.Context, tx Tx, id int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	m.notifyPrinter(d, id, "printer-deleted")
+	m.deletePrinter(d, id)
+	return nil
+}
+
+// deletePrinter removes a printer and everything that references it, as the
+// ON DELETE CASCADE foreign keys do in SQLite.
+func (m *Memory) deletePrinter(d *memData, id int64) {
+	delete(d.printers, id)
+	for jobID, j := range d.jobs {
+		if j.PrinterID == id {
+			m.deleteJob(d, jobID)
+		}
+	}
+	for classID, members := range d.members {
+		if slices.Contains(members, id) {
+			d.members[classID] = slices.DeleteFunc(slices.Clone(members), func(pid int64) bool { return pid == id })
+		}
+	}
+	for subID, sub := range d.subscriptions {
+		if sub.PrinterID.Valid && sub.PrinterID.Int64 == id {
+			m.deleteSubscription(d, subID)
+		}
+	}
+	delete(d.supplies, id)
+	delete(d.options, id)
+}
+
+func (m *Memory) SetPrinterOption(ctx context.Context, tx Tx, printerID int64, key, value string) error {
+	key = strings.TrimSpace(key)
+	if key == "" {
+		return nil
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.printers[printerID]; !ok {
+		return errMemFK
+	}
+	opts := maps.Clone(d.options[printerID])
+	if opts == nil {
+		opts = map[string]string{}
+	}
+	opts[key] = value
+	d.options[printerID] = opts
+	return nil
+}
+
+func (m *Memory) GetPrinterSupplies(ctx context.Context, tx Tx, printerID int64) (PrinterSupplies, bool, error) {
+	s, ok := m.read(tx).supplies[printerID]
+	if !ok {
+		return PrinterSupplies{}, false, nil
+	}
+	s.Details = maps.Clone(s.Details)
+	return s, true, nil
+}
+
+func (m *Memory) UpsertPrinterSupplies(ctx context.Context, tx Tx, printerID int64, state string, details map[string]string, updated time.Time) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.printers[printerID]; !ok {
+		return errMemFK
+	}
+	if updated.IsZero() {
+		updated = time.Now().UTC()
+	}
+	copied := maps.Clone(details)
+	if copied == nil {
+		copied = map[string]string{}
+	}
+	d.supplies[printerID] = PrinterSupplies{PrinterID: printerID, State: state, Details: copied, UpdatedAt: updated}
+	return nil
+}
+
+// Classes
+
+func (m *Memory) ListClasses(ctx context.Context, tx Tx) ([]model.Class, error) {
+	d := m.read(tx)
+	out := make([]model.Class, 0, len(d.classes))
+	for _, c := range d.classes {
+		out = append(out, c)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *Memory) GetClassByName(ctx context.Context, tx Tx, name string) (model.Class, error) {
+	d := m.read(tx)
+	for _, c := range d.classes {
+		if c.Name == name {
+			return c, nil
+		}
+	}
+	return model.Class{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetDefaultClass(ctx context.Context, tx Tx) (model.Class, error) {
+	d := m.read(tx)
+	for _, id := range sortedKeys(d.classes) {
+		if c := d.classes[id]; c.IsDefault {
+			return c, nil
+		}
+	}
+	return model.Class{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListClassMembers(ctx context.Context, tx Tx, classID int64) ([]model.Printer, error) {
+	d := m.read(tx)
+	out := []model.Printer{}
+	for _, pid := range d.members[classID] {
+		if p, ok := d.printers[pid]; ok {
+			out = append(out, p)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *Memory) CreateClass(ctx context.Context, tx Tx, name, location, info string, accepting bool, isDefault bool, memberPrinterIDs []int64) (model.Class, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Class{}, err
+	}
+	for _, c := range d.classes {
+		if c.Name == name {
+			return model.Class{}, errMemUnique("classes.name")
+		}
+	}
+	now := time.Now().UTC()
+	d.seq.class++
+	c := model.Class{
+		ID:               d.seq.class,
+		Name:             name,
+		Location:         location,
+		Info:             info,
+		State:            3,
+		Accepting:        accepting,
+		IsDefault:        isDefault,
+		JobSheetsDefault: "none",
+		CreatedAt:        now,
+		UpdatedAt:        now,
+	}
+	d.classes[c.ID] = c
+	if err := m.ReplaceClassMembers(ctx, tx, c.ID, memberPrinterIDs); err != nil {
+		return model.Class{}, err
+	}
+	return c, nil
+}
+
+func (m *Memory) UpsertClass(ctx context.Context, tx Tx, name, location, info string, accepting bool, memberPrinterIDs []int64) (model.Class, error) {
+	existing, err := m.GetClassByName(ctx, tx, name)
+	if err != nil {
+		return m.CreateClass(ctx, tx, name, location, info, accepting, false, memberPrinterIDs)
+	}
+	err = m.updateClass(tx, existing.ID, func(c *model.Class) {
+		c.Location = location
+		c.Info = info
+		c.Accepting = accepting
+	})
+	if err != nil {
+		return model.Class{}, err
+	}
+	if err := m.ReplaceClassMembers(ctx, tx, existing.ID, memberPrinterIDs); err != nil {
+		return model.Class{}, err
+	}
+	return m.read(tx).classes[existing.ID], nil
+}
+
+func (m *Memory) ReplaceClassMembers(ctx context.Context, tx Tx, classID int64, memberPrinterIDs []int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	members := []int64{}
+	for _, pid := range memberPrinterIDs {
+		if _, ok := d.printers[pid]; !ok {
+			return errMemFK
+		}
+		if _, ok := d.classes[classID]; !ok {
+			return errMemFK
+		}
+		if !slices.Contains(members, pid) {
+			members = append(members, pid)
+		}
+	}
+	if len(members) == 0 {
+		delete(d.members, classID)
+		return nil
+	}
+	d.members[classID] = members
+	return nil
+}
+
+// updateClass applies fn to a class and stamps updated_at.
+func (m *Memory) updateClass(tx Tx, id int64, fn func(c *model.Class)) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	c, ok := d.classes[id]
+	if !ok {
+		return nil
+	}
+	fn(&c)
+	c.UpdatedAt = time.Now().UTC()
+	d.classes[id] = c
+	return nil
+}
+
+func (m *Memory) UpdateClassAttributes(ctx context.Context, tx Tx, id int64, info, location *string) error {
+	if info == nil && location == nil {
+		return nil
+	}
+	return m.updateClass(tx, id, func(c *model.Class) {
+		if info != nil {
+			c.Info = *info
+		}
+		if location != nil {
+			c.Location = *location
+		}
+	})
+}
+
+func (m *Memory) UpdateClassAccepting(ctx context.Context, tx Tx, id int64, accepting bool) error {
+	return m.updateClass(tx, id, func(c *model.Class) { c.Accepting = accepting })
+}
+
+func (m *Memory) UpdateClassState(ctx context.Context, tx Tx, id int64, state int) error {
+	return m.updateClass(tx, id, func(c *model.Class) { c.State = state })
+}
+
+func (m *Memory) UpdateClassJobSheetsDefault(ctx context.Context, tx Tx, id int64, sheets string) error {
+	if strings.TrimSpace(sheets) == "" {
+		sheets = "none"
+	}
+	return m.updateClass(tx, id, func(c *model.Class) { c.JobSheetsDefault = sheets })
+}
+
+func (m *Memory) UpdateClassDefaultOptions(ctx context.Context, tx Tx, id int64, optionsJSON string) error {
+	return m.updateClass(tx, id, func(c *model.Class) { c.DefaultOptions = optionsJSON })
+}
+
+func (m *Memory) UpdateAllClassesAccepting(ctx context.Context, tx Tx, accepting bool) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	for id := range d.classes {
+		_ = m.updateClass(tx, id, func(c *model.Class) { c.Accepting = accepting })
+	}
+	return nil
+}
+
+func (m *Memory) UpdateAllClassesState(ctx context.Context, tx Tx, state int) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	for id := range d.classes {
+		_ = m.updateClass(tx, id, func(c *model.Class) { c.State = state })
+	}
+	return nil
+}
+
+func (m *Memory) SetDefaultClass(ctx context.Context, tx Tx, id int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	m.clearDefaults(d)
+	return m.updateClass(tx, id, func(c *model.Class) { c.IsDefault = true })
+}
+
+func (m *Memory) DeleteClass(ctx context.Context, tx Tx, id int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	delete(d.classes, id)
+	delete(d.members, id)
+	return nil
+}
+
+// Jobs
+
+func (m *Memory) CreateJob(ctx context.Context, tx Tx, printerID int64, name, user, originHost, options string) (model.Job, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Job{}, err
+	}
+	if _, ok := d.printers[printerID]; !ok {
+		return model.Job{}, errMemFK
+	}
+	d.seq.job++
+	job := model.Job{
+		ID:          d.seq.job,
+		PrinterID:   printerID,
+		Name:        name,
+		UserName:    user,
+		OriginHost:  originHost,
+		Options:     options,
+		State:       3,
+		StateReason: "job-incoming",
+		SubmittedAt: time.Now().UTC(),
+	}
+	d.jobs[job.ID] = job
+	_ = m.AddJobEvent(ctx, tx, job.ID, "job-created", map[string]string{
+		"state":  "3",
+		"reason": "job-incoming",
+	})
+	m.notifyJob(d, job.ID, "job-created")
+	return job, nil
+}
+
+func (m *Memory) GetJob(ctx context.Context, tx Tx, jobID int64) (model.Job, error) {
+	job, ok := m.read(tx).jobs[jobID]
+	if !ok {
+		return model.Job{}, sql.ErrNoRows
+	}
+	return job, nil
+}
+
+// listJobs returns the jobs matching keep, ordered by less.
+func (m *Memory) listJobs(tx Tx, keep func(model.Job) bool, less func(a, b model.Job) bool, limit int) []model.Job {
+	d := m.read(tx)
+	out := []model.Job{}
+	for _, j := range d.jobs {
+		if keep(j) {
+			out = append(out, j)
+		}
+	}
+	sort.Slice(out, func(i, k int) bool {
+		if less(out[i], out[k]) {
+			return true
+		}
+		if less(out[k], out[i]) {
+			return false
+		}
+		return out[i].ID < out[k].ID
+	})
+	return limitRows(out, limit)
+}
+
+func newestFirst(a, b model.Job) bool {
+	return a.ID > b.ID
+}
+
+func (m *Memory) ListJobsByPrinter(ctx context.Context, tx Tx, printerID int64, limit int) ([]model.Job, error) {
+	return m.listJobs(tx, func(j model.Job) bool { return j.PrinterID == printerID }, newestFirst, limit), nil
+}
+
+func (m *Memory) ListJobsByUser(ctx context.Context, tx Tx, user string, printerID *int64, limit int) ([]model.Job, error) {
+	return m.listJobs(tx, func(j model.Job) bool {
+		return j.UserName == user && (printerID == nil || j.PrinterID == *printerID)
+	}, newestFirst, limit), nil
+}
+
+func (m *Memory) ListJobIDsByPrinter(ctx context.Context, tx Tx, printerID int64) ([]int64, error) {
+	out := []int64{}
+	for _, j := range m.listJobs(tx, func(j model.Job) bool { return j.PrinterID == printerID }, func(a, b model.Job) bool { return false }, -1) {
+		out = append(out, j.ID)
+	}
+	return out, nil
+}
+
+func (m *Memory) ListPendingJobs(ctx context.Context, tx Tx, limit int) ([]model.Job, error) {
+	d := m.read(tx)
+	return m.listJobs(tx, func(j model.Job) bool {
+		p, ok := d.printers[j.PrinterID]
+		return j.State == 3 && ok && p.Accepting && p.State != 5
+	}, func(a, b model.Job) bool { return a.SubmittedAt.Before(b.SubmittedAt) }, limit), nil
+}
+
+func (m *Memory) ListHeldJobs(ctx context.Context, tx Tx, limit int) ([]model.Job, error) {
+	return m.listJobs(tx, func(j model.Job) bool { return j.State == 4 },
+		func(a, b model.Job) bool { return a.SubmittedAt.Before(b.SubmittedAt) }, limit), nil
+}
+
+func (m *Memory) ListTerminalJobs(ctx context.Context, tx Tx, limit int) ([]model.Job, error) {
+	return m.listJobs(tx, func(j model.Job) bool { return j.State >= 7 && j.State <= 9 && j.CompletedAt != nil },
+		func(a, b model.Job) bool { return a.CompletedAt.Before(*b.CompletedAt) }, limit), nil
+}
+
+func (m *Memory) ListPrinterJobStats(ctx context.Context, tx Tx) (map[int64]PrinterJobStats, error) {
+	d := m.read(tx)
+	out := map[int64]PrinterJobStats{}
+	oldest := map[int64]int64{}
+	for _, j := range d.jobs {
+		if j.State < 3 || j.State > 6 {
+			continue
+		}
+		st, ok := out[j.PrinterID]
+		if !ok {
+			st = PrinterJobStats{PrinterID: j.PrinterID, StateCounts: map[int]int{}}
+		}
+		st.StateCounts[j.State]++
+		// Job IDs are monotonic, so the lowest pending ID is the oldest queued job.
+		if j.State == 3 {
+			if id, seen := oldest[j.PrinterID]; !seen || j.ID < id {
+				oldest[j.PrinterID] = j.ID
+				st.OldestQueued = j.SubmittedAt
+			}
+		}
+		out[j.PrinterID] = st
+	}
+	return out, nil
+}
+
+func (m *Memory) CountQueuedJobsByPrinterIDs(ctx context.Context, tx Tx, printerIDs []int64) (int, error) {
+	if len(printerIDs) == 0 {
+		return 0, nil
+	}
+	count := 0
+	for _, j := range m.read(tx).jobs {
+		if j.State >= 3 && j.State <= 6 && slices.Contains(printerIDs, j.PrinterID) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) ClaimPendingJob(ctx context.Context, tx Tx, jobID int64) (bool, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return false, err
+	}
+	job, ok := d.jobs[jobID]
+	if !ok || job.State != 3 {
+		return false, nil
+	}
+	job.State = 5
+	job.StateReason = "job-printing"
+	if job.ProcessingAt == nil {
+		now := time.Now().UTC()
+		job.ProcessingAt = &now
+	}
+	d.jobs[jobID] = job
+	return true, nil
+}
+
+func (m *Memory) UpdateJobState(ctx context.Context, tx Tx, jobID int64, state int, reason string, completedAt *time.Time) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	job, ok := d.jobs[jobID]
+	if !ok {
+		return nil
+	}
+	job.State = state
+	job.StateReason = reason
+	job.CompletedAt = nil
+	if completedAt != nil {
+		completed := *completedAt
+		job.CompletedAt = &completed
+	}
+	d.jobs[jobID] = job
+	_ = m.AddJobEvent(ctx, tx, jobID, reason, map[string]string{
+		"state":  strconv.Itoa(state),
+		"reason": reason,
+	})
+	m.notifyJob(d, jobID, "job-state-changed")
+	switch state {
+	case 9:
+		m.notifyJob(d, jobID, "job-completed")
+	case 5:
+		m.notifyJob(d, jobID, "job-progress")
+	case 4, 6, 7, 8:
+		m.notifyJob(d, jobID, "job-stopped")
+	}
+	return nil
+}
+
+func (m *Memory) UpdateJobAttributes(ctx context.Context, tx Tx, jobID int64, name *string, options *string) error {
+	if name == nil && options == nil {
+		return nil
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	job, ok := d.jobs[jobID]
+	if !ok {
+		return nil
+	}
+	if name != nil {
+		job.Name = *name
+	}
+	if options != nil {
+		job.Options = *options
+	}
+	d.jobs[jobID] = job
+	m.notifyJob(d, jobID, "job-config-changed")
+	return nil
+}
+
+func (m *Memory) SetJobSubmittedAt(ctx context.Context, tx Tx, jobID int64, submitted time.Time) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if job, ok := d.jobs[jobID]; ok {
+		job.SubmittedAt = submitted.UTC()
+		d.jobs[jobID] = job
+	}
+	return nil
+}
+
+func (m *Memory) MoveJob(ctx context.Context, tx Tx, jobID int64, printerID int64) (model.Job, error) {
+	job, err := m.GetJob(ctx, tx, jobID)
+	if err != nil {
+		return model.Job{}, err
+	}
+	if job.State >= 7 {
+		return job, ErrJobCompleted
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Job{}, err
+	}
+	if _, ok := d.printers[printerID]; !ok {
+		return model.Job{}, errMemFK
+	}
+	job.PrinterID = printerID
+	job.State = 3
+	job.StateReason = "job-moved"
+	job.CompletedAt = nil
+	d.jobs[jobID] = job
+	_ = m.AddJobEvent(ctx, tx, jobID, "job-moved", map[string]string{
+		"state":  "3",
+		"reason": "job-moved",
+	})
+	m.notifyJob(d, jobID, "job-config-changed")
+	m.notifyJob(d, jobID, "job-state-changed")
+	return job, nil
+}
+
+func (m *Memory) CancelJobsByPrinter(ctx context.Context, tx Tx, printerID int64, reason string) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	completed := time.Now().UTC()
+	for id, job := range d.jobs {
+		if job.PrinterID == printerID && job.State < 7 {
+			job.State = 7
+			job.StateReason = reason
+			job.CompletedAt = &completed
+			d.jobs[id] = job
+		}
+	}
+	return nil
+}
+
+func (m *Memory) DeleteJob(ctx context.Context, tx Tx, jobID int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	m.deleteJob(d, jobID)
+	return nil
+}
+
+// deleteJob removes a job with its documents, events and subscriptions.
+func (m *Memory) deleteJob(d *memData, jobID int64) {
+	delete(d.jobs, jobID)
+	delete(d.jobEvents, jobID)
+	for id, doc := range d.documents {
+		if doc.JobID == jobID {
+			delete(d.documents, id)
+		}
+	}
+	for subID, sub := range d.subscriptions {
+		if sub.JobID.Valid && sub.JobID.Int64 == jobID {
+			m.deleteSubscription(d, subID)
+		}
+	}
+}
+
+func (m *Memory) AddJobEvent(ctx context.Context, tx Tx, jobID int64, event string, details map[string]string) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.jobs[jobID]; !ok {
+		return errMemFK
+	}
+	if strings.TrimSpace(event) == "" {
+		event = "job-state-changed"
+	}
+	d.seq.jobEvent++
+	d.jobEvents[jobID] = append(slices.Clip(d.jobEvents[jobID]), memJobEvent{
+		ID:        d.seq.jobEvent,
+		Event:     event,
+		Details:   maps.Clone(details),
+		CreatedAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+// Documents
+
+func (m *Memory) AddDocument(ctx context.Context, tx Tx, jobID int64, fileName, mimeType, path string, sizeBytes int64, nameSupplied, formatSupplied string) (model.Document, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Document{}, err
+	}
+	if _, ok := d.jobs[jobID]; !ok {
+		return model.Document{}, errMemFK
+	}
+	d.seq.document++
+	doc := model.Document{
+		ID:             d.seq.document,
+		JobID:          jobID,
+		FileName:       fileName,
+		MimeType:       mimeType,
+		FormatSupplied: formatSupplied,
+		NameSupplied:   nameSupplied,
+		SizeBytes:      sizeBytes,
+		Path:           path,
+		CreatedAt:      time.Now().UTC(),
+	}
+	d.documents[doc.ID] = doc
+	return doc, nil
+}
+
+func (m *Memory) ListDocumentsByJob(ctx context.Context, tx Tx, jobID int64) ([]model.Document, error) {
+	d := m.read(tx)
+	out := []model.Document{}
+	for _, id := range sortedKeys(d.documents) {
+		if doc := d.documents[id]; doc.JobID == jobID {
+			out = append(out, doc)
+		}
+	}
+	return out, nil
+}
+
+func (m *Memory) ListDocumentStatsByJobIDs(ctx context.Context, tx Tx, jobIDs []int64) (map[int64]DocumentStats, error) {
+	stats := make(map[int64]DocumentStats, len(jobIDs))
+	for _, doc := range m.read(tx).documents {
+		if !slices.Contains(jobIDs, doc.JobID) {
+			continue
+		}
+		st, ok := stats[doc.JobID]
+		if !ok || doc.MimeType < st.MimeType {
+			st.MimeType = doc.MimeType
+		}
+		st.JobID = doc.JobID
+		st.Count++
+		st.SizeBytes += doc.SizeBytes
+		stats[doc.JobID] = st
+	}
+	return stats, nil
+}
+
+func (m *Memory) DeleteDocumentsByJob(ctx context.Context, tx Tx, jobID int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	for id, doc := range d.documents {
+		if doc.JobID == jobID {
+			delete(d.documents, id)
+		}
+	}
+	return nil
+}
+
+// Subscriptions
+
+func (m *Memory) CreateSubscription(ctx context.Context, tx Tx, limits SubscriptionLimits, printerID *int64, jobID *int64, events string, leaseSecs int64, owner string, recipientURI string, pullMethod string, timeInterval int64, userData []byte) (model.Subscription, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	events = normalizeEvents(events)
+	if owner == "" {
+		owner = "anonymous"
+	}
+	if err := checkSubscriptionLimits(ctx, m, tx, limits, printerID, jobID, owner); err != nil {
+		return model.Subscription{}, err
+	}
+	recipientURI = strings.TrimSpace(recipientURI)
+	pullMethod = strings.TrimSpace(pullMethod)
+	if pullMethod == "" && recipientURI == "" {
+		pullMethod = "ippget"
+	}
+	sub := model.Subscription{
+		Events:       events,
+		LeaseSecs:    leaseSecs,
+		Owner:        owner,
+		RecipientURI: recipientURI,
+		PullMethod:   pullMethod,
+		TimeInterval: timeInterval,
+		UserData:     slices.Clone(userData),
+		CreatedAt:    time.Now().UTC(),
+	}
+	if printerID != nil {
+		if _, ok := d.printers[*printerID]; !ok {
+			return model.Subscription{}, errMemFK
+		}
+		sub.PrinterID = sql.NullInt64{Int64: *printerID, Valid: true}
+	}
+	if jobID != nil {
+		if _, ok := d.jobs[*jobID]; !ok {
+			return model.Subscription{}, errMemFK
+		}
+		sub.JobID = sql.NullInt64{Int64: *jobID, Valid: true}
+	}
+	d.seq.subscription++
+	sub.ID = d.seq.subscription
+	d.subscriptions[sub.ID] = sub
+	return sub, nil
+}
+
+func (m *Memory) GetSubscription(ctx context.Context, tx Tx, id int64) (model.Subscription, error) {
+	sub, ok := m.read(tx).subscriptions[id]
+	if !ok {
+		return model.Subscription{}, sql.ErrNoRows
+	}
+	return sub, nil
+}
+
+func (m *Memory) ListSubscriptions(ctx context.Context, tx Tx, printerID *int64, jobID *int64, owner string, limit int) ([]model.Subscription, error) {
+	d := m.read(tx)
+	out := []model.Subscription{}
+	for _, id := range sortedKeys(d.subscriptions) {
+		sub := d.subscriptions[id]
+		if printerID != nil && (!sub.PrinterID.Valid || sub.PrinterID.Int64 != *printerID) {
+			continue
+		}
+		if jobID != nil && (!sub.JobID.Valid || sub.JobID.Int64 != *jobID) {
+			continue
+		}
+		if owner != "" && sub.Owner != owner {
+			continue
+		}
+		out = append(out, sub)
+	}
+	if limit > 0 {
+		out = limitRows(out, limit)
+	}
+	return out, nil
+}
+
+func (m *Memory) UpdateSubscriptionLease(ctx context.Context, tx Tx, id int64, leaseSecs int64) (model.Subscription, error) {
+	d, err := m.write(tx)
+	if err != nil {
+		return model.Subscription{}, err
+	}
+	if sub, ok := d.subscriptions[id]; ok {
+		sub.LeaseSecs = leaseSecs
+		sub.CreatedAt = time.Now().UTC()
+		d.subscriptions[id] = sub
+	}
+	return m.GetSubscription(ctx, tx, id)
+}
+
+func (m *Memory) CancelSubscription(ctx context.Context, tx Tx, id int64) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	m.deleteSubscription(d, id)
+	return nil
+}
+
+func (m *Memory) deleteSubscription(d *memData, id int64) {
+	delete(d.subscriptions, id)
+	delete(d.notifications, id)
+}
+
+// countSubscriptions prunes expired subscriptions, as the SQLite store does
+// before counting, and counts those matching keep.
+func (m *Memory) countSubscriptions(ctx context.Context, tx Tx, keep func(model.Subscription) bool) (int, error) {
+	if err := m.PruneExpiredSubscriptions(ctx, tx); err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, sub := range m.read(tx).subscriptions {
+		if keep(sub) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) CountSubscriptions(ctx context.Context, tx Tx) (int, error) {
+	return m.countSubscriptions(ctx, tx, func(model.Subscription) bool { return true })
+}
+
+func (m *Memory) CountSubscriptionsForPrinter(ctx context.Context, tx Tx, printerID int64) (int, error) {
+	return m.countSubscriptions(ctx, tx, func(sub model.Subscription) bool {
+		return sub.PrinterID.Valid && sub.PrinterID.Int64 == printerID
+	})
+}
+
+func (m *Memory) CountSubscriptionsForJob(ctx context.Context, tx Tx, jobID int64) (int, error) {
+	return m.countSubscriptions(ctx, tx, func(sub model.Subscription) bool {
+		return sub.JobID.Valid && sub.JobID.Int64 == jobID
+	})
+}
+
+func (m *Memory) CountSubscriptionsForUser(ctx context.Context, tx Tx, owner string) (int, error) {
+	return m.countSubscriptions(ctx, tx, func(sub model.Subscription) bool { return sub.Owner == owner })
+}
+
+// PruneExpiredSubscriptions drops subscriptions whose lease has run out. In
+// a read-only transaction it does nothing; expired subscriptions are then
+// removed by the next write.
+func (m *Memory) PruneExpiredSubscriptions(ctx context.Context, tx Tx) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return nil
+	}
+	m.pruneSubscriptions(d, time.Now().UTC())
+	return nil
+}
+
+func (m *Memory) pruneSubscriptions(d *memData, now time.Time) {
+	for id, sub := range d.subscriptions {
+		if !subscriptionActive(sub.CreatedAt, sub.LeaseSecs, now) {
+			m.deleteSubscription(d, id)
+		}
+	}
+}
+
+func (m *Memory) ListNotifications(ctx context.Context, tx Tx, subscriptionID int64, limit int) ([]model.Notification, error) {
+	if err := m.PruneExpiredSubscriptions(ctx, tx); err != nil {
+		return nil, err
+	}
+	notes := limitRows(m.read(tx).notifications[subscriptionID], limit)
+	if len(notes) == 0 {
+		return nil, nil
+	}
+	return slices.Clone(notes), nil
+}
+
+func (m *Memory) notifyPrinter(d *memData, printerID int64, event string) {
+	m.notify(d, event, func(sub model.Subscription) bool {
+		if sub.PrinterID.Valid {
+			return sub.PrinterID.Int64 == printerID
+		}
+		return !sub.JobID.Valid
+	})
+}
+
+// notifyJob delivers job events to the job's subscriptions and, like
+// addNotificationForJob, to those on its printer and server-wide ones.
+func (m *Memory) notifyJob(d *memData, jobID int64, event string) {
+	printerID := d.jobs[jobID].PrinterID
+	m.notify(d, event, func(sub model.Subscription) bool {
+		if sub.JobID.Valid {
+			return sub.JobID.Int64 == jobID
+		}
+		return !sub.PrinterID.Valid || sub.PrinterID.Int64 == printerID
+	})
+}
+
+// notifyServer delivers server-wide events to every printer or system
+// subscription, like addNotificationForServer.
+func (m *Memory) notifyServer(d *memData, event string) {
+	m.notify(d, event, func(sub model.Subscription) bool { return !sub.JobID.Valid })
+}
+
+// notify queues event for the active subscriptions matching match, keeping
+// at most MaxEvents notifications per subscription.
+func (m *Memory) notify(d *memData, event string, match func(model.Subscription) bool) {
+	if m.MaxEvents <= 0 {
+		return
+	}
+	now := time.Now().UTC()
+	m.pruneSubscriptions(d, now)
+	for _, id := range sortedKeys(d.subscriptions) {
+		sub := d.subscriptions[id]
+		if !match(sub) || !eventAllowed(sub.Events, event) {
+			continue
+		}
+		d.seq.notification++
+		notes := append(slices.Clip(d.notifications[id]), model.Notification{
+			ID:             d.seq.notification,
+			SubscriptionID: id,
+			Event:          event,
+			CreatedAt:      now,
+		})
+		if len(notes) > m.MaxEvents {
+			notes = slices.Clone(notes[len(notes)-m.MaxEvents:])
+		}
+		d.notifications[id] = notes
+	}
+}
+
+// Users
+
+func (m *Memory) CreateUser(ctx context.Context, tx Tx, username, password string, admin bool) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if _, ok := d.users[username]; ok {
+		return errMemUnique("users.username")
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	d.seq.user++
+	d.users[username] = model.User{
+		ID:           d.seq.user,
+		Username:     username,
+		PasswordHash: hash,
+		DigestHA1:    digestHA1(username, password),
+		IsAdmin:      admin,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	return nil
+}
+
+func (m *Memory) GetUserByUsername(ctx context.Context, tx Tx, username string) (model.User, error) {
+	u, ok := m.read(tx).users[username]
+	if !ok {
+		return model.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (m *Memory) VerifyUser(ctx context.Context, tx Tx, username, password string) (model.User, error) {
+	u, err := m.GetUserByUsername(ctx, tx, username)
+	if err != nil {
+		return model.User{}, err
+	}
+	if err := checkPassword(u.PasswordHash, password); err != nil {
+		return model.User{}, err
+	}
+	return u, nil
+}
+
+func (m *Memory) SetUserDigestHA1(ctx context.Context, tx Tx, username, digest string) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if u, ok := d.users[username]; ok {
+		u.DigestHA1 = digest
+		d.users[username] = u
+	}
+	return nil
+}
+
+// Settings
+
+func (m *Memory) SetSetting(ctx context.Context, tx Tx, key, value string) error {
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	d.settings[key] = value
+	return nil
+}
+
+func (m *Memory) GetSetting(ctx context.Context, tx Tx, key, fallback string) (string, error) {
+	if v, ok := m.read(tx).settings[key]; ok {
+		return v, nil
+	}
+	return fallback, nil
+}
+
+func (m *Memory) ListSettings(ctx context.Context, tx Tx) (map[string]string, error) {
+	return maps.Clone(m.read(tx).settings), nil
+}
+
+// Caches
+
+func (m *Memory) SetPPDCache(ctx context.Context, tx Tx, ppdName, ppdHash, ippAttrs string) error {
+	ppdName = strings.TrimSpace(ppdName)
+	if ppdName == "" {
+		return nil
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	d.ppdCache[ppdName] = memPPDCache{hash: ppdHash, attrs: ippAttrs, updatedAt: time.Now().UTC()}
+	return nil
+}
+
+func (m *Memory) GetPPDCache(ctx context.Context, tx Tx, ppdName string) (ppdHash string, ippAttrs string, updatedAt time.Time, ok bool, err error) {
+	entry, ok := m.read(tx).ppdCache[strings.TrimSpace(ppdName)]
+	if !ok {
+		return "", "", time.Time{}, false, nil
+	}
+	return entry.hash, entry.attrs, entry.updatedAt, true, nil
+}
+
+func (m *Memory) UpsertDeviceCache(ctx context.Context, tx Tx, entry DeviceCacheEntry) error {
+	entry.URI = strings.TrimSpace(entry.URI)
+	if entry.URI == "" {
+		return nil
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	if entry.UpdatedAt.IsZero() {
+		entry.UpdatedAt = time.Now().UTC()
+	}
+	d.devices[entry.URI] = entry
+	return nil
+}
+
+func (m *Memory) ListDeviceCache(ctx context.Context, tx Tx, freshWithin time.Duration, limit int) ([]DeviceCacheEntry, error) {
+	if limit <= 0 {
+		limit = 1024
+	}
+	threshold := time.Now().UTC().Add(-freshWithin)
+	out := []DeviceCacheEntry{}
+	for _, entry := range m.read(tx).devices {
+		if freshWithin > 0 && entry.UpdatedAt.Before(threshold) {
+			continue
+		}
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].UpdatedAt.After(out[j].UpdatedAt) })
+	return limitRows(out, limit), nil
+}
+
+func (m *Memory) PruneDeviceCache(ctx context.Context, tx Tx, olderThan time.Duration) error {
+	if olderThan <= 0 {
+		return nil
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return err
+	}
+	threshold := time.Now().UTC().Add(-olderThan)
+	for uri, entry := range d.devices {
+		if entry.UpdatedAt.Before(threshold) {
+			delete(d.devices, uri)
+		}
+	}
+	return nil
+}
+
+// Audit
+
+func (m *Memory) AddAuditEntry(ctx context.Context, tx Tx, entry model.AuditEntry) (model.AuditEntry, error) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	entry.Operation = strings.TrimSpace(entry.Operation)
+	if entry.Operation == "" {
+		return entry, fmt.Errorf("audit entry requires an operation")
+	}
+	d, err := m.write(tx)
+	if err != nil {
+		return entry, err
+	}
+	d.seq.audit++
+	entry.ID = d.seq.audit
+	if len(entry.Changes) > 0 {
+		entry.Changes = maps.Clone(entry.Changes)
+	} else {
+		entry.Changes = nil
+	}
+	d.audit = append(slices.Clip(d.audit), entry)
+	m.notifyServer(d, "server-audit")
+	return entry, nil
+}
+
+func (m *Memory) ListAuditEntries(ctx context.Context, tx Tx, filter AuditFilter) ([]model.AuditEntry, error) {
+	user := strings.TrimSpace(filter.User)
+	target := strings.TrimSpace(filter.Target)
+	entries := m.read(tx).audit
+	out := []model.AuditEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		if user != "" && e.User != user {
+			continue
+		}
+		if target != "" && e.Target != target {
+			continue
+		}
+		if !filter.Since.IsZero() && e.CreatedAt.Before(filter.Since) {
+			continue
+		}
+		e.Changes = maps.Clone(e.Changes)
+		out = append(out, e)
+		if filter.Limit > 0 && len(out) == filter.Limit {
+			break
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,284 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cupsgolang/internal/model"
+)
+
+// repositories returns every Repository implementation, each freshly
+// created, so behaviour can be checked against the SQLite store.
+func repositories(t *testing.T) map[string]Repository {
+	t.Helper()
+	st, err := Open(context.Background(), filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { _ = st.Close() })
+	st.MaxEvents = 2
+	mem := NewMemory()
+	mem.MaxEvents = 2
+	return map[string]Repository{"sqlite": st, "memory": mem}
+}
+
+func TestRepositoryPrintersAndJobs(t *testing.T) {
+	ctx := context.Background()
+	for name, r := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			var office, lobby model.Printer
+			var subID int64
+			err := r.WithTx(ctx, false, func(tx Tx) error {
+				var err error
+				if lobby, err = r.CreatePrinter(ctx, tx, "Lobby", "ipp://lobby/ipp/print", "", "", "", true, false, true, "", ""); err != nil {
+					return err
+				}
+				if office, err = r.CreatePrinter(ctx, tx, "Office", "ipp://office/ipp/print", "Lab", "", "", true, false, true, "", `{"media":"iso_a4_210x297mm"}`); err != nil {
+					return err
+				}
+				if _, err := r.CreatePrinter(ctx, tx, "Office", "ipp://other/ipp/print", "", "", "", true, false, true, "", ""); err == nil {
+					t.Errorf("duplicate printer name accepted")
+				}
+				if _, err := r.CreateClass(ctx, tx, "All", "", "", true, false, []int64{office.ID, lobby.ID}); err != nil {
+					return err
+				}
+				sub, err := r.CreateSubscription(ctx, tx, SubscriptionLimits{}, &office.ID, nil, "", 0, "alice", "", "", 0, nil)
+				subID = sub.ID
+				return err
+			})
+			if err != nil {
+				t.Fatalf("setup: %v", err)
+			}
+
+			err = r.WithTx(ctx, false, func(tx Tx) error {
+				p, err := r.GetDefaultPrinter(ctx, tx)
+				if err != nil || p.ID != lobby.ID {
+					t.Errorf("default printer without a flag = %+v, %v; want the oldest", p, err)
+				}
+				if _, err := r.GetDefaultClass(ctx, tx); !errors.Is(err, sql.ErrNoRows) {
+					t.Errorf("GetDefaultClass = %v, want sql.ErrNoRows", err)
+				}
+				if p.PPDName != model.DefaultPPDName || p.JobSheetsDefault != "none" {
+					t.Errorf("printer defaults not applied: %+v", p)
+				}
+				if err := r.SetDefaultPrinter(ctx, tx, office.ID); err != nil {
+					return err
+				}
+				if p, _ := r.GetDefaultPrinter(ctx, tx); p.ID != office.ID || !p.IsDefault {
+					t.Errorf("default printer = %+v, want Office", p)
+				}
+				c, _ := r.GetClassByName(ctx, tx, "All")
+				members, err := r.ListClassMembers(ctx, tx, c.ID)
+				if err != nil || len(members) != 2 || members[0].Name != "Lobby" {
+					t.Errorf("class members = %+v, %v", members, err)
+				}
+
+				job, err := r.CreateJob(ctx, tx, office.ID, "report", "alice", "localhost", "")
+				if err != nil {
+					return err
+				}
+				pending, _ := r.ListPendingJobs(ctx, tx, 10)
+				if len(pending) != 1 || pending[0].ID != job.ID {
+					t.Errorf("pending jobs = %+v", pending)
+				}
+				if ok, err := r.ClaimPendingJob(ctx, tx, job.ID); !ok || err != nil {
+					t.Errorf("ClaimPendingJob = %v, %v", ok, err)
+				}
+				if ok, _ := r.ClaimPendingJob(ctx, tx, job.ID); ok {
+					t.Errorf("job claimed twice")
+				}
+				now := time.Now().UTC()
+				if err := r.UpdateJobState(ctx, tx, job.ID, 9, "job-completed-successfully", &now); err != nil {
+					return err
+				}
+				terminal, _ := r.ListTerminalJobs(ctx, tx, 10)
+				if len(terminal) != 1 || terminal[0].ProcessingAt == nil || terminal[0].CompletedAt == nil {
+					t.Errorf("terminal jobs = %+v", terminal)
+				}
+				if _, err := r.MoveJob(ctx, tx, job.ID, lobby.ID); !errors.Is(err, ErrJobCompleted) {
+					t.Errorf("MoveJob on a completed job = %v", err)
+				}
+				return r.UpdatePrinterState(ctx, tx, office.ID, 5)
+			})
+			if err != nil {
+				t.Fatalf("update: %v", err)
+			}
+
+			err = r.WithTx(ctx, false, func(tx Tx) error {
+				// printer-added, then the stop: only the newest MaxEvents are kept.
+				notes, err := r.ListNotifications(ctx, tx, subID, 10)
+				if err != nil {
+					return err
+				}
+				if len(notes) != 2 || notes[0].Event != "printer-state-changed" || notes[1].Event != "printer-stopped" {
+					t.Errorf("notifications = %+v", notes)
+				}
+				if err := r.DeletePrinter(ctx, tx, office.ID); err != nil {
+					return err
+				}
+				if _, err := r.GetSubscription(ctx, tx, subID); !errors.Is(err, sql.ErrNoRows) {
+					t.Errorf("subscription survived its printer: %v", err)
+				}
+				ids, _ := r.ListJobIDsByPrinter(ctx, tx, office.ID)
+				if len(ids) != 0 {
+					t.Errorf("jobs survived their printer: %v", ids)
+				}
+				c, _ := r.GetClassByName(ctx, tx, "All")
+				members, _ := r.ListClassMembers(ctx, tx, c.ID)
+				if len(members) != 1 || members[0].ID != lobby.ID {
+					t.Errorf("class members after delete = %+v", members)
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("delete: %v", err)
+			}
+		})
+	}
+}
+
+func TestMemoryTransactions(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	boom := errors.New("boom")
+
+	err := m.WithTx(ctx, false, func(tx Tx) error {
+		if _, err := m.CreatePrinter(ctx, tx, "Office", "ipp://office/ipp/print", "", "", "", true, false, true, "", ""); err != nil {
+			return err
+		}
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("WithTx = %v, want boom", err)
+	}
+
+	err = m.WithTx(ctx, true, func(tx Tx) error {
+		if ps, _ := m.ListPrinters(ctx, tx); len(ps) != 0 {
+			t.Errorf("rolled back printer is visible: %+v", ps)
+		}
+		if err := m.SetSetting(ctx, tx, "k", "v"); err == nil {
+			t.Errorf("write accepted in a read-only transaction")
+		}
+
+		// A read-only transaction keeps its snapshot while others commit.
+		if err := m.WithTx(ctx, false, func(tx Tx) error {
+			return m.SetSetting(ctx, tx, "k", "v")
+		}); err != nil {
+			return err
+		}
+		if v, _ := m.GetSetting(ctx, tx, "k", "unset"); v != "unset" {
+			t.Errorf("snapshot saw a later commit: %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.WithTx(ctx, true, func(tx Tx) error {
+		if v, _ := m.GetSetting(ctx, tx, "k", "unset"); v != "v" {
+			t.Errorf("committed setting = %q", v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobEventsReachPrinterAndServerSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	for name, r := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			err := r.WithTx(ctx, false, func(tx Tx) error {
+				office, err := r.CreatePrinter(ctx, tx, "Office", "ipp://office/ipp/print", "", "", "", true, false, true, "", "")
+				if err != nil {
+					return err
+				}
+				lobby, err := r.CreatePrinter(ctx, tx, "Lobby", "ipp://lobby/ipp/print", "", "", "", true, false, true, "", "")
+				if err != nil {
+					return err
+				}
+				onOffice, _ := r.CreateSubscription(ctx, tx, SubscriptionLimits{}, &office.ID, nil, "job-created", 0, "alice", "", "", 0, nil)
+				onLobby, _ := r.CreateSubscription(ctx, tx, SubscriptionLimits{}, &lobby.ID, nil, "job-created", 0, "alice", "", "", 0, nil)
+				everywhere, _ := r.CreateSubscription(ctx, tx, SubscriptionLimits{}, nil, nil, "job-created,printer-stopped", 0, "alice", "", "", 0, nil)
+				if _, err := r.CreateJob(ctx, tx, office.ID, "report", "alice", "localhost", ""); err != nil {
+					return err
+				}
+				if err := r.UpdatePrinterState(ctx, tx, lobby.ID, 5); err != nil {
+					return err
+				}
+				for _, tc := range []struct {
+					id   int64
+					want string
+				}{
+					{onOffice.ID, "job-created"},
+					{onLobby.ID, ""},
+					{everywhere.ID, "job-created,printer-stopped"},
+				} {
+					notes, err := r.ListNotifications(ctx, tx, tc.id, 10)
+					if err != nil {
+						return err
+					}
+					var got []string
+					for _, n := range notes {
+						got = append(got, n.Event)
+					}
+					if strings.Join(got, ",") != tc.want {
+						t.Errorf("subscription %d got %v, want %q", tc.id, got, tc.want)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRepositorySubscriptionLimitsCountServerWide(t *testing.T) {
+	ctx := context.Background()
+	for name, r := range repositories(t) {
+		t.Run(name, func(t *testing.T) {
+			err := r.WithTx(ctx, false, func(tx Tx) error {
+				office, err := r.CreatePrinter(ctx, tx, "Office", "ipp://office/ipp/print", "", "", "", true, false, true, "", "")
+				if err != nil {
+					return err
+				}
+				if _, err := r.CreateSubscription(ctx, tx, SubscriptionLimits{}, &office.ID, nil, "", 0, "alice", "", "", 0, nil); err != nil {
+					return err
+				}
+				if _, err := r.CreateSubscription(ctx, tx, SubscriptionLimits{}, nil, nil, "", 0, "", "", "", 0, nil); err != nil {
+					return err
+				}
+				for _, tc := range []struct {
+					name   string
+					limits SubscriptionLimits
+					owner  string
+					want   error
+				}{
+					{"total", SubscriptionLimits{Total: 2}, "bob", ErrTooManySubscriptions},
+					{"per user", SubscriptionLimits{PerUser: 1}, "alice", ErrTooManySubscriptions},
+					{"per user counts anonymous", SubscriptionLimits{PerUser: 1}, "", ErrTooManySubscriptions},
+					{"per printer ignores server-wide", SubscriptionLimits{PerPrinter: 1}, "bob", nil},
+					{"other user", SubscriptionLimits{PerUser: 1}, "carol", nil},
+				} {
+					_, err := r.CreateSubscription(ctx, tx, tc.limits, nil, nil, "", 0, tc.owner, "", "", 0, nil)
+					if !errors.Is(err, tc.want) {
+						t.Errorf("%s: server-wide CreateSubscription = %v, want %v", tc.name, err, tc.want)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
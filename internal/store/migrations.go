@@ -3,13 +3,153 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"os"
 	"strings"
+	"time"
 )
 
+// migration is one numbered schema step. Steps run in version order, each in
+// its own transaction, and are recorded in schema_migrations once committed.
+// Append new steps to the end of migrations; never edit or renumber a step
+// that has shipped.
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	// Version 1 is the schema as it stood before migrations were versioned.
+	// Its statements are idempotent so databases created by older builds,
+	// which have no schema_migrations table, are brought up to date too.
+	{version: 1, name: "baseline schema", up: migrateBaseline},
+}
+
+// MigrationStep describes a schema migration that has not been applied yet.
+type MigrationStep struct {
+	Version int
+	Name    string
+}
+
+const schemaMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+    version INTEGER PRIMARY KEY,
+    name TEXT NOT NULL DEFAULT '',
+    applied_at DATETIME NOT NULL
+)`
+
+// PendingMigrations opens the database at dbPath without modifying it and
+// lists the migrations Open would apply.
+func PendingMigrations(ctx context.Context, dbPath string) ([]MigrationStep, error) {
+	if _, err := os.Stat(dbPath); errors.Is(err, os.ErrNotExist) {
+		return pendingSteps(0), nil
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?mode=ro&_pragma=busy_timeout(5000)", dbPath))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	return pendingSteps(current), nil
+}
+
+func pendingSteps(current int) []MigrationStep {
+	var out []MigrationStep
+	for _, m := range migrations {
+		if m.version > current {
+			out = append(out, MigrationStep{Version: m.version, Name: m.name})
+		}
+	}
+	return out
+}
+
+// schemaVersion returns the highest applied migration, or 0 for a new
+// database or one created before migrations were versioned.
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var n int
+	if err := db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`).Scan(&n); err != nil {
+		return 0, err
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	var version sql.NullInt64
+	if err := db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		return 0, err
+	}
+	current := int(version.Int64)
+	if latest := migrations[len(migrations)-1].version; current > latest {
+		return 0, fmt.Errorf("database schema version %d is newer than this build supports (%d)", current, latest)
+	}
+	return current, nil
+}
+
+// SchemaVersion returns the highest migration applied to the database.
+func (s *Store) SchemaVersion(ctx context.Context) (int, error) {
+	if s == nil || s.db == nil {
+		return 0, errors.New("store not initialized")
+	}
+	return schemaVersion(ctx, s.db)
+}
+
 func (s *Store) migrate(ctx context.Context) error {
-	return s.WithTx(ctx, false, func(tx *sql.Tx) error {
-		stmts := []string{
-			`CREATE TABLE IF NOT EXISTS printers (
+	current, err := schemaVersion(ctx, s.db)
+	if err != nil {
+		return err
+	}
+	pending := pendingSteps(current)
+	if len(pending) == 0 {
+		return nil
+	}
+	if err := s.backupBeforeMigrate(ctx, pending[len(pending)-1].Version); err != nil {
+		return fmt.Errorf("backup before schema migration: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, schemaMigrationsTable); err != nil {
+		return err
+	}
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		err := s.withTx(ctx, false, func(tx *sql.Tx) error {
+			if err := m.up(ctx, tx); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, ?, ?)`, m.version, m.name, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("schema migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// backupBeforeMigrate snapshots an existing database next to itself before
+// any migration runs, so a bad upgrade can be rolled back by restoring the
+// copy. New, empty databases are not copied.
+func (s *Store) backupBeforeMigrate(ctx context.Context, target int) error {
+	if s.path == "" || s.path == ":memory:" {
+		return nil
+	}
+	var tables int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'`).Scan(&tables); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+	dst := fmt.Sprintf("%s.pre-v%d-%s.bak", s.path, target, time.Now().UTC().Format("20060102T150405Z"))
+	return s.Backup(ctx, dst)
+}
+
+func migrateBaseline(ctx context.Context, tx *sql.Tx) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS printers (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 name TEXT NOT NULL UNIQUE,
                 uri TEXT NOT NULL UNIQUE,
@@ -28,8 +168,8 @@ func (s *Store) migrate(ctx context.Context) error {
                 default_options TEXT NOT NULL DEFAULT '',
                 created_at DATETIME NOT NULL,
                 updated_at DATETIME NOT NULL
-			)`,
-			`CREATE TABLE IF NOT EXISTS classes (
+		)`,
+		`CREATE TABLE IF NOT EXISTS classes (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 name TEXT NOT NULL UNIQUE,
                 location TEXT NOT NULL DEFAULT '',
@@ -42,14 +182,14 @@ func (s *Store) migrate(ctx context.Context) error {
                 created_at DATETIME NOT NULL,
                 updated_at DATETIME NOT NULL
             )`,
-			`CREATE TABLE IF NOT EXISTS class_members (
+		`CREATE TABLE IF NOT EXISTS class_members (
                 class_id INTEGER NOT NULL,
                 printer_id INTEGER NOT NULL,
                 PRIMARY KEY (class_id, printer_id),
                 FOREIGN KEY (class_id) REFERENCES classes(id) ON DELETE CASCADE,
                 FOREIGN KEY (printer_id) REFERENCES printers(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS jobs (
+		`CREATE TABLE IF NOT EXISTS jobs (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 printer_id INTEGER NOT NULL,
                 name TEXT NOT NULL DEFAULT '',
@@ -64,7 +204,7 @@ func (s *Store) migrate(ctx context.Context) error {
                 completed_at DATETIME,
                 FOREIGN KEY (printer_id) REFERENCES printers(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS documents (
+		`CREATE TABLE IF NOT EXISTS documents (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 job_id INTEGER NOT NULL,
                 file_name TEXT NOT NULL DEFAULT '',
@@ -76,7 +216,7 @@ func (s *Store) migrate(ctx context.Context) error {
                 created_at DATETIME NOT NULL,
                 FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS users (
+		`CREATE TABLE IF NOT EXISTS users (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 username TEXT NOT NULL UNIQUE,
                 password_hash TEXT NOT NULL,
@@ -85,11 +225,11 @@ func (s *Store) migrate(ctx context.Context) error {
                 created_at DATETIME NOT NULL,
                 updated_at DATETIME NOT NULL
             )`,
-			`CREATE TABLE IF NOT EXISTS settings (
+		`CREATE TABLE IF NOT EXISTS settings (
                 key TEXT PRIMARY KEY,
                 value TEXT NOT NULL
             )`,
-			`CREATE TABLE IF NOT EXISTS subscriptions (
+		`CREATE TABLE IF NOT EXISTS subscriptions (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 printer_id INTEGER,
                 job_id INTEGER,
@@ -104,21 +244,21 @@ func (s *Store) migrate(ctx context.Context) error {
                 FOREIGN KEY (printer_id) REFERENCES printers(id) ON DELETE CASCADE,
                 FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS notifications (
+		`CREATE TABLE IF NOT EXISTS notifications (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 subscription_id INTEGER NOT NULL,
                 event TEXT NOT NULL,
                 created_at DATETIME NOT NULL,
                 FOREIGN KEY (subscription_id) REFERENCES subscriptions(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS printer_supplies (
+		`CREATE TABLE IF NOT EXISTS printer_supplies (
                 printer_id INTEGER PRIMARY KEY,
                 state TEXT NOT NULL DEFAULT '',
                 details TEXT NOT NULL DEFAULT '',
                 updated_at DATETIME NOT NULL,
                 FOREIGN KEY (printer_id) REFERENCES printers(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS job_events (
+		`CREATE TABLE IF NOT EXISTS job_events (
                 id INTEGER PRIMARY KEY AUTOINCREMENT,
                 job_id INTEGER NOT NULL,
                 event TEXT NOT NULL,
@@ -126,7 +266,7 @@ func (s *Store) migrate(ctx context.Context) error {
                 created_at DATETIME NOT NULL,
                 FOREIGN KEY (job_id) REFERENCES jobs(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS printer_options (
+		`CREATE TABLE IF NOT EXISTS printer_options (
                 printer_id INTEGER NOT NULL,
                 option_key TEXT NOT NULL,
                 option_value TEXT NOT NULL DEFAULT '',
@@ -134,13 +274,13 @@ func (s *Store) migrate(ctx context.Context) error {
                 PRIMARY KEY (printer_id, option_key),
                 FOREIGN KEY (printer_id) REFERENCES printers(id) ON DELETE CASCADE
             )`,
-			`CREATE TABLE IF NOT EXISTS ppd_cache (
+		`CREATE TABLE IF NOT EXISTS ppd_cache (
                 ppd_name TEXT PRIMARY KEY,
                 ppd_hash TEXT NOT NULL DEFAULT '',
                 ipp_attrs TEXT NOT NULL DEFAULT '',
                 updated_at DATETIME NOT NULL
             )`,
-			`CREATE TABLE IF NOT EXISTS device_cache (
+		`CREATE TABLE IF NOT EXISTS device_cache (
                 uri TEXT PRIMARY KEY,
                 info TEXT NOT NULL DEFAULT '',
                 make_model TEXT NOT NULL DEFAULT '',
@@ -149,97 +289,113 @@ func (s *Store) migrate(ctx context.Context) error {
                 location TEXT NOT NULL DEFAULT '',
                 updated_at DATETIME NOT NULL
             )`,
-			`CREATE INDEX IF NOT EXISTS idx_jobs_printer_id ON jobs(printer_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs(state)`,
-			`CREATE INDEX IF NOT EXISTS idx_documents_job_id ON documents(job_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_class_members_class_id ON class_members(class_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_class_members_printer_id ON class_members(printer_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_users_username ON users(username)`,
-			`CREATE INDEX IF NOT EXISTS idx_subscriptions_printer_id ON subscriptions(printer_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_subscriptions_job_id ON subscriptions(job_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_notifications_subscription_id ON notifications(subscription_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_printer_supplies_printer_id ON printer_supplies(printer_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_job_events_job_id ON job_events(job_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_job_events_created_at ON job_events(created_at)`,
-			`CREATE INDEX IF NOT EXISTS idx_printer_options_printer_id ON printer_options(printer_id)`,
-			`CREATE INDEX IF NOT EXISTS idx_device_cache_updated_at ON device_cache(updated_at)`,
-		}
-		for _, stmt := range stmts {
-			if _, err := tx.ExecContext(ctx, stmt); err != nil {
-				return err
-			}
-		}
-		if err := ensureColumn(ctx, tx, "printers", "geo_location", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printers", "ppd_name", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printers", "organization", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printers", "organizational_unit", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printers", "shared", "INTEGER NOT NULL DEFAULT 1"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printers", "is_temporary", "INTEGER NOT NULL DEFAULT 0"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printers", "job_sheets_default", "TEXT NOT NULL DEFAULT 'none'"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printers", "default_options", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "jobs", "processing_at", "DATETIME"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "documents", "format_supplied", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "documents", "name_supplied", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "users", "digest_ha1", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "subscriptions", "owner", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "subscriptions", "recipient_uri", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "subscriptions", "pull_method", "TEXT NOT NULL DEFAULT 'ippget'"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "subscriptions", "time_interval", "INTEGER NOT NULL DEFAULT 0"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "subscriptions", "user_data", "BLOB"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "classes", "job_sheets_default", "TEXT NOT NULL DEFAULT 'none'"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "classes", "default_options", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "jobs", "origin_host", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printer_supplies", "state", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printer_supplies", "details", "TEXT NOT NULL DEFAULT ''"); err != nil {
-			return err
-		}
-		if err := ensureColumn(ctx, tx, "printer_supplies", "updated_at", "DATETIME NOT NULL"); err != nil {
+		`CREATE TABLE IF NOT EXISTS audit_log (
+                id INTEGER PRIMARY KEY AUTOINCREMENT,
+                user_name TEXT NOT NULL DEFAULT '',
+                remote_addr TEXT NOT NULL DEFAULT '',
+                operation TEXT NOT NULL,
+                target TEXT NOT NULL DEFAULT '',
+                changes TEXT NOT NULL DEFAULT '',
+                created_at DATETIME NOT NULL
+		)`,
+		// The audit trail is append-only: reject edits and deletes at the
+		// database level so a compromised admin session cannot rewrite it.
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+             BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+             BEGIN SELECT RAISE(ABORT, 'audit log is append-only'); END`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_printer_id ON jobs(printer_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_jobs_state ON jobs(state)`,
+		`CREATE INDEX IF NOT EXISTS idx_documents_job_id ON documents(job_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_class_members_class_id ON class_members(class_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_class_members_printer_id ON class_members(printer_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_users_username ON users(username)`,
+		`CREATE INDEX IF NOT EXISTS idx_subscriptions_printer_id ON subscriptions(printer_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_subscriptions_job_id ON subscriptions(job_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_notifications_subscription_id ON notifications(subscription_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_printer_supplies_printer_id ON printer_supplies(printer_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_events_job_id ON job_events(job_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_job_events_created_at ON job_events(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_printer_options_printer_id ON printer_options(printer_id)`,
+		`CREATE INDEX IF NOT EXISTS idx_device_cache_updated_at ON device_cache(updated_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at)`,
+		`CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
 			return err
 		}
-		return nil
-	})
+	}
+	if err := ensureColumn(ctx, tx, "printers", "geo_location", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printers", "ppd_name", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printers", "organization", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printers", "organizational_unit", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printers", "shared", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printers", "is_temporary", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printers", "job_sheets_default", "TEXT NOT NULL DEFAULT 'none'"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printers", "default_options", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "jobs", "processing_at", "DATETIME"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "documents", "format_supplied", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "documents", "name_supplied", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "users", "digest_ha1", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "subscriptions", "owner", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "subscriptions", "recipient_uri", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "subscriptions", "pull_method", "TEXT NOT NULL DEFAULT 'ippget'"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "subscriptions", "time_interval", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "subscriptions", "user_data", "BLOB"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "classes", "job_sheets_default", "TEXT NOT NULL DEFAULT 'none'"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "classes", "default_options", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "jobs", "origin_host", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printer_supplies", "state", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printer_supplies", "details", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if err := ensureColumn(ctx, tx, "printer_supplies", "updated_at", "DATETIME NOT NULL"); err != nil {
+		return err
+	}
+	return nil
 }
 
 func ensureColumn(ctx context.Context, tx *sql.Tx, table, column, definition string) error {
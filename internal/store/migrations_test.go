@@ -0,0 +1,114 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrationsRecordedAndBackedUp(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.db")
+
+	pending, err := PendingMigrations(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("pending on missing db: %v", err)
+	}
+	if len(pending) != len(migrations) {
+		t.Fatalf("expected %d pending steps for a new database, got %d", len(migrations), len(pending))
+	}
+
+	st, err := Open(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	_ = st.Close()
+	if backups, _ := filepath.Glob(dbPath + ".pre-v*.bak"); len(backups) != 0 {
+		t.Fatalf("new database should not be backed up, got %v", backups)
+	}
+	if pending, err := PendingMigrations(ctx, dbPath); err != nil || len(pending) != 0 {
+		t.Fatalf("expected no pending steps after open, got %v (err %v)", pending, err)
+	}
+
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	next := saved[len(saved)-1].version + 1
+	migrations = append(append([]migration{}, saved...), migration{
+		version: next,
+		name:    "add widgets",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, `CREATE TABLE widgets (id INTEGER PRIMARY KEY)`)
+			return err
+		},
+	})
+
+	pending, err = PendingMigrations(ctx, dbPath)
+	if err != nil || len(pending) != 1 || pending[0].Version != next {
+		t.Fatalf("expected step %d pending, got %v (err %v)", next, pending, err)
+	}
+
+	st, err = Open(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	defer st.Close()
+	backups, _ := filepath.Glob(dbPath + ".pre-v*.bak")
+	if len(backups) != 1 {
+		t.Fatalf("expected one pre-upgrade backup, got %v", backups)
+	}
+	var version int
+	if err := st.db.QueryRowContext(ctx, `SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil || version != next {
+		t.Fatalf("expected schema version %d, got %d (err %v)", next, version, err)
+	}
+
+	backup, err := sql.Open("sqlite", backups[0])
+	if err != nil {
+		t.Fatalf("open backup: %v", err)
+	}
+	defer backup.Close()
+	var widgets int
+	if err := backup.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'widgets'`).Scan(&widgets); err != nil || widgets != 0 {
+		t.Fatalf("backup should predate the migration (widgets=%d, err %v)", widgets, err)
+	}
+}
+
+func TestMigrationFailureRollsBackStep(t *testing.T) {
+	ctx := context.Background()
+	dbPath := filepath.Join(t.TempDir(), "test.db")
+	st, err := Open(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	_ = st.Close()
+
+	saved := migrations
+	t.Cleanup(func() { migrations = saved })
+	next := saved[len(saved)-1].version + 1
+	migrations = append(append([]migration{}, saved...), migration{
+		version: next,
+		name:    "broken",
+		up: func(ctx context.Context, tx *sql.Tx) error {
+			if _, err := tx.ExecContext(ctx, `CREATE TABLE half_done (id INTEGER)`); err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	})
+	if _, err := Open(ctx, dbPath); err == nil {
+		t.Fatalf("expected failing migration to abort open")
+	}
+
+	migrations = saved
+	st, err = Open(ctx, dbPath)
+	if err != nil {
+		t.Fatalf("reopen store: %v", err)
+	}
+	defer st.Close()
+	var n int
+	if err := st.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("failed step should be rolled back (tables=%d, err %v)", n, err)
+	}
+}
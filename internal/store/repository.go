@@ -0,0 +1,191 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"cupsgolang/internal/model"
+)
+
+// Tx is an open transaction handed to the callback of WithTx. Its concrete
+// type belongs to the repository that opened it, and it may only be passed
+// back to methods of that same repository. The unexported method keeps
+// values from outside this package, such as a bare *sql.Tx, from being used
+// as one.
+type Tx interface {
+	storeTx()
+}
+
+// Transactor opens transactions. Every repository method runs inside one.
+type Transactor interface {
+	WithTx(ctx context.Context, readOnly bool, fn func(tx Tx) error) error
+	// Generation counts the write transactions this process has committed,
+	// so a poller can tell that nothing changed without reading the data.
+	// Changes made by other processes are not counted.
+	Generation() uint64
+}
+
+// PrinterRepository stores print queues, their options and supply levels.
+type PrinterRepository interface {
+	ListPrinters(ctx context.Context, tx Tx) ([]model.Printer, error)
+	ListTemporaryPrinters(ctx context.Context, tx Tx, force bool, unusedBefore time.Time, limit int) ([]model.Printer, error)
+	GetPrinterByName(ctx context.Context, tx Tx, name string) (model.Printer, error)
+	GetPrinterByID(ctx context.Context, tx Tx, id int64) (model.Printer, error)
+	GetPrinterByURI(ctx context.Context, tx Tx, uri string) (model.Printer, error)
+	GetDefaultPrinter(ctx context.Context, tx Tx) (model.Printer, error)
+	CreatePrinter(ctx context.Context, tx Tx, name, uri, location, info, ppdName string, accepting bool, isDefault bool, shared bool, jobSheetsDefault, defaultOptions string) (model.Printer, error)
+	UpsertPrinter(ctx context.Context, tx Tx, name, uri, location, info string, accepting bool) (model.Printer, error)
+	TouchPrinter(ctx context.Context, tx Tx, id int64) error
+	UpdatePrinterTemporary(ctx context.Context, tx Tx, id int64, temporary bool) error
+	DeleteTemporaryPrinters(ctx context.Context, tx Tx, force bool, unusedBefore time.Time) (int64, error)
+	UpdatePrinterAttributes(ctx context.Context, tx Tx, id int64, info, location, geo, org, orgUnit *string) error
+	UpdatePrinterSharing(ctx context.Context, tx Tx, id int64, shared bool) error
+	UpdatePrinterURI(ctx context.Context, tx Tx, id int64, uri string) error
+	UpdatePrinterPPDName(ctx context.Context, tx Tx, id int64, ppdName string) error
+	UpdatePrinterJobSheetsDefault(ctx context.Context, tx Tx, id int64, sheets string) error
+	UpdatePrinterDefaultOptions(ctx context.Context, tx Tx, id int64, optionsJSON string) error
+	UpdatePrinterAccepting(ctx context.Context, tx Tx, id int64, accepting bool) error
+	UpdateAllPrintersAccepting(ctx context.Context, tx Tx, accepting bool) error
+	UpdatePrinterState(ctx context.Context, tx Tx, id int64, state int) error
+	UpdateAllPrintersState(ctx context.Context, tx Tx, state int) error
+	SetDefaultPrinter(ctx context.Context, tx Tx, id int64) error
+	DeletePrinter(ctx context.Context, tx Tx, id int64) error
+	SetPrinterOption(ctx context.Context, tx Tx, printerID int64, key, value string) error
+	GetPrinterSupplies(ctx context.Context, tx Tx, printerID int64) (PrinterSupplies, bool, error)
+	UpsertPrinterSupplies(ctx context.Context, tx Tx, printerID int64, state string, details map[string]string, updated time.Time) error
+}
+
+// ClassRepository stores printer classes and their members.
+type ClassRepository interface {
+	ListClasses(ctx context.Context, tx Tx) ([]model.Class, error)
+	GetClassByName(ctx context.Context, tx Tx, name string) (model.Class, error)
+	GetDefaultClass(ctx context.Context, tx Tx) (model.Class, error)
+	ListClassMembers(ctx context.Context, tx Tx, classID int64) ([]model.Printer, error)
+	CreateClass(ctx context.Context, tx Tx, name, location, info string, accepting bool, isDefault bool, memberPrinterIDs []int64) (model.Class, error)
+	UpsertClass(ctx context.Context, tx Tx, name, location, info string, accepting bool, memberPrinterIDs []int64) (model.Class, error)
+	ReplaceClassMembers(ctx context.Context, tx Tx, classID int64, memberPrinterIDs []int64) error
+	UpdateClassAttributes(ctx context.Context, tx Tx, id int64, info, location *string) error
+	UpdateClassAccepting(ctx context.Context, tx Tx, id int64, accepting bool) error
+	UpdateClassState(ctx context.Context, tx Tx, id int64, state int) error
+	UpdateClassJobSheetsDefault(ctx context.Context, tx Tx, id int64, sheets string) error
+	UpdateClassDefaultOptions(ctx context.Context, tx Tx, id int64, optionsJSON string) error
+	UpdateAllClassesAccepting(ctx context.Context, tx Tx, accepting bool) error
+	UpdateAllClassesState(ctx context.Context, tx Tx, state int) error
+	SetDefaultClass(ctx context.Context, tx Tx, id int64) error
+	DeleteClass(ctx context.Context, tx Tx, id int64) error
+}
+
+// JobRepository stores jobs and their event history.
+type JobRepository interface {
+	CreateJob(ctx context.Context, tx Tx, printerID int64, name, user, originHost, options string) (model.Job, error)
+	GetJob(ctx context.Context, tx Tx, jobID int64) (model.Job, error)
+	ListJobsByPrinter(ctx context.Context, tx Tx, printerID int64, limit int) ([]model.Job, error)
+	ListJobsByUser(ctx context.Context, tx Tx, user string, printerID *int64, limit int) ([]model.Job, error)
+	ListJobIDsByPrinter(ctx context.Context, tx Tx, printerID int64) ([]int64, error)
+	ListPendingJobs(ctx context.Context, tx Tx, limit int) ([]model.Job, error)
+	ListHeldJobs(ctx context.Context, tx Tx, limit int) ([]model.Job, error)
+	ListTerminalJobs(ctx context.Context, tx Tx, limit int) ([]model.Job, error)
+	ListPrinterJobStats(ctx context.Context, tx Tx) (map[int64]PrinterJobStats, error)
+	CountQueuedJobsByPrinterIDs(ctx context.Context, tx Tx, printerIDs []int64) (int, error)
+	ClaimPendingJob(ctx context.Context, tx Tx, jobID int64) (bool, error)
+	UpdateJobState(ctx context.Context, tx Tx, jobID int64, state int, reason string, completedAt *time.Time) error
+	UpdateJobAttributes(ctx context.Context, tx Tx, jobID int64, name *string, options *string) error
+	SetJobSubmittedAt(ctx context.Context, tx Tx, jobID int64, submitted time.Time) error
+	MoveJob(ctx context.Context, tx Tx, jobID int64, printerID int64) (model.Job, error)
+	CancelJobsByPrinter(ctx context.Context, tx Tx, printerID int64, reason string) error
+	DeleteJob(ctx context.Context, tx Tx, jobID int64) error
+	AddJobEvent(ctx context.Context, tx Tx, jobID int64, event string, details map[string]string) error
+}
+
+// DocumentRepository stores the documents attached to jobs.
+type DocumentRepository interface {
+	AddDocument(ctx context.Context, tx Tx, jobID int64, fileName, mimeType, path string, sizeBytes int64, nameSupplied, formatSupplied string) (model.Document, error)
+	ListDocumentsByJob(ctx context.Context, tx Tx, jobID int64) ([]model.Document, error)
+	ListDocumentStatsByJobIDs(ctx context.Context, tx Tx, jobIDs []int64) (map[int64]DocumentStats, error)
+	DeleteDocumentsByJob(ctx context.Context, tx Tx, jobID int64) error
+}
+
+// SubscriptionRepository stores event subscriptions and the notifications
+// queued for them.
+type SubscriptionRepository interface {
+	// CreateSubscription fails with ErrTooManySubscriptions when the new
+	// subscription would exceed limits.
+	CreateSubscription(ctx context.Context, tx Tx, limits SubscriptionLimits, printerID *int64, jobID *int64, events string, leaseSecs int64, owner string, recipientURI string, pullMethod string, timeInterval int64, userData []byte) (model.Subscription, error)
+	GetSubscription(ctx context.Context, tx Tx, id int64) (model.Subscription, error)
+	ListSubscriptions(ctx context.Context, tx Tx, printerID *int64, jobID *int64, owner string, limit int) ([]model.Subscription, error)
+	UpdateSubscriptionLease(ctx context.Context, tx Tx, id int64, leaseSecs int64) (model.Subscription, error)
+	CancelSubscription(ctx context.Context, tx Tx, id int64) error
+	CountSubscriptions(ctx context.Context, tx Tx) (int, error)
+	CountSubscriptionsForPrinter(ctx context.Context, tx Tx, printerID int64) (int, error)
+	CountSubscriptionsForJob(ctx context.Context, tx Tx, jobID int64) (int, error)
+	CountSubscriptionsForUser(ctx context.Context, tx Tx, owner string) (int, error)
+	PruneExpiredSubscriptions(ctx context.Context, tx Tx) error
+	ListNotifications(ctx context.Context, tx Tx, subscriptionID int64, limit int) ([]model.Notification, error)
+}
+
+// SubscriptionLimits caps the active subscriptions CreateSubscription
+// accepts; zero means no limit. Every subscription counts against Total and
+// PerUser, including server-wide ones that name neither a printer nor a job.
+type SubscriptionLimits struct {
+	Total      int
+	PerPrinter int
+	PerJob     int
+	PerUser    int
+}
+
+// ErrTooManySubscriptions is returned by CreateSubscription when a
+// SubscriptionLimits cap has been reached.
+var ErrTooManySubscriptions = errors.New("too many subscriptions")
+
+// UserRepository stores local accounts.
+type UserRepository interface {
+	CreateUser(ctx context.Context, tx Tx, username, password string, admin bool) error
+	GetUserByUsername(ctx context.Context, tx Tx, username string) (model.User, error)
+	VerifyUser(ctx context.Context, tx Tx, username, password string) (model.User, error)
+	SetUserDigestHA1(ctx context.Context, tx Tx, username, digest string) error
+}
+
+// SettingsRepository stores server-wide key/value settings.
+type SettingsRepository interface {
+	SetSetting(ctx context.Context, tx Tx, key, value string) error
+	GetSetting(ctx context.Context, tx Tx, key, fallback string) (string, error)
+	ListSettings(ctx context.Context, tx Tx) (map[string]string, error)
+}
+
+// CacheRepository stores the PPD attribute and device discovery caches.
+type CacheRepository interface {
+	SetPPDCache(ctx context.Context, tx Tx, ppdName, ppdHash, ippAttrs string) error
+	GetPPDCache(ctx context.Context, tx Tx, ppdName string) (ppdHash string, ippAttrs string, updatedAt time.Time, ok bool, err error)
+	UpsertDeviceCache(ctx context.Context, tx Tx, entry DeviceCacheEntry) error
+	ListDeviceCache(ctx context.Context, tx Tx, freshWithin time.Duration, limit int) ([]DeviceCacheEntry, error)
+	PruneDeviceCache(ctx context.Context, tx Tx, olderThan time.Duration) error
+}
+
+// AuditRepository stores the append-only administrative audit trail.
+type AuditRepository interface {
+	AddAuditEntry(ctx context.Context, tx Tx, entry model.AuditEntry) (model.AuditEntry, error)
+	ListAuditEntries(ctx context.Context, tx Tx, filter AuditFilter) ([]model.AuditEntry, error)
+}
+
+// Repository is everything the scheduler, IPP server and web interface need
+// from persistent state. Store implements it on SQLite and Memory keeps it
+// in process memory.
+type Repository interface {
+	Transactor
+	PrinterRepository
+	ClassRepository
+	JobRepository
+	DocumentRepository
+	SubscriptionRepository
+	UserRepository
+	SettingsRepository
+	CacheRepository
+	AuditRepository
+
+	EnsureDefaultPrinter(ctx context.Context) error
+	EnsureAdminUser(ctx context.Context) error
+	Close() error
+}
+
+var _ Repository = (*Store)(nil)
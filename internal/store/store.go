@@ -9,6 +9,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	_ "modernc.org/sqlite"
@@ -17,8 +18,10 @@ import (
 )
 
 type Store struct {
-	db        *sql.DB
-	MaxEvents int
+	db         *sql.DB
+	path       string
+	MaxEvents  int
+	generation atomic.Uint64
 }
 
 type PrinterSupplies struct {
@@ -56,7 +59,7 @@ func Open(ctx context.Context, dbPath string) (*Store, error) {
 	db.SetMaxIdleConns(5)
 	db.SetConnMaxLifetime(30 * time.Minute)
 
-	s := &Store{db: db}
+	s := &Store{db: db, path: dbPath}
 	if err := s.migrate(ctx); err != nil {
 		_ = db.Close()
 		return nil, err
@@ -64,6 +67,28 @@ func Open(ctx context.Context, dbPath string) (*Store, error) {
 	return s, nil
 }
 
+// OpenExisting opens the database at dbPath without applying migrations, for
+// tools that must not change the schema of a database the server owns. It
+// fails when dbPath does not exist.
+func OpenExisting(ctx context.Context, dbPath string) (*Store, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)", dbPath))
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(20)
+	db.SetMaxIdleConns(5)
+	db.SetConnMaxLifetime(30 * time.Minute)
+	s := &Store{db: db, path: dbPath}
+	if _, err := schemaVersion(ctx, db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
 func (s *Store) Close() error {
 	if s == nil || s.db == nil {
 		return nil
@@ -71,7 +96,22 @@ func (s *Store) Close() error {
 	return s.db.Close()
 }
 
-func (s *Store) WithTx(ctx context.Context, readOnly bool, fn func(tx *sql.Tx) error) error {
+// WithTx runs fn inside a database transaction, committing when fn returns
+// nil and rolling back otherwise.
+func (s *Store) WithTx(ctx context.Context, readOnly bool, fn func(tx Tx) error) error {
+	return s.withTx(ctx, readOnly, func(tx *sql.Tx) error {
+		return fn(sqliteTx{tx})
+	})
+}
+
+// sqliteTx is the Tx handed out by Store.WithTx.
+type sqliteTx struct {
+	*sql.Tx
+}
+
+func (sqliteTx) storeTx() {}
+
+func (s *Store) withTx(ctx context.Context, readOnly bool, fn func(tx *sql.Tx) error) error {
 	if s == nil || s.db == nil {
 		return fmt.Errorf("store not initialized")
 	}
@@ -88,11 +128,31 @@ func (s *Store) WithTx(ctx context.Context, readOnly bool, fn func(tx *sql.Tx) e
 		_ = tx.Rollback()
 		return err
 	}
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if !readOnly {
+		s.generation.Add(1)
+	}
+	return nil
+}
+
+// Generation counts the write transactions committed through this Store.
+func (s *Store) Generation() uint64 {
+	return s.generation.Load()
+}
+
+// sqlTx unwraps a transaction opened by Store.WithTx.
+func sqlTx(t Tx) *sql.Tx {
+	tx, ok := t.(sqliteTx)
+	if !ok {
+		panic(fmt.Sprintf("store: %T is not a SQLite transaction", t))
+	}
+	return tx.Tx
 }
 
 func (s *Store) EnsureDefaultPrinter(ctx context.Context) error {
-	return s.WithTx(ctx, false, func(tx *sql.Tx) error {
+	return s.withTx(ctx, false, func(tx *sql.Tx) error {
 		var count int
 		if err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM printers").Scan(&count); err != nil {
 			return err
@@ -110,20 +170,12 @@ func (s *Store) EnsureDefaultPrinter(ctx context.Context) error {
 }
 
 func (s *Store) EnsureAdminUser(ctx context.Context) error {
-	user := os.Getenv("CUPS_ADMIN_USER")
-	pass := os.Getenv("CUPS_ADMIN_PASS")
-	if user == "" {
-		user = "admin"
-	}
-	if pass == "" {
-		pass = "admin"
-	}
-	return s.WithTx(ctx, false, func(tx *sql.Tx) error {
+	user, pass := adminCredentials()
+	return s.WithTx(ctx, false, func(tx Tx) error {
 		u, err := s.GetUserByUsername(ctx, tx, user)
 		if err == nil {
 			if u.DigestHA1 == "" && pass != "" && checkPassword(u.PasswordHash, pass) == nil {
-				digest := digestHA1(user, pass)
-				_, _ = tx.ExecContext(ctx, `UPDATE users SET digest_ha1 = ? WHERE username = ?`, digest, user)
+				_ = s.SetUserDigestHA1(ctx, tx, user, digestHA1(user, pass))
 			}
 			return nil
 		}
@@ -131,7 +183,22 @@ func (s *Store) EnsureAdminUser(ctx context.Context) error {
 	})
 }
 
-func (s *Store) ListPrinters(ctx context.Context, tx *sql.Tx) ([]model.Printer, error) {
+// adminCredentials returns the bootstrap administrator account, taken from
+// CUPS_ADMIN_USER and CUPS_ADMIN_PASS with admin/admin as the fallback.
+func adminCredentials() (string, string) {
+	user := os.Getenv("CUPS_ADMIN_USER")
+	pass := os.Getenv("CUPS_ADMIN_PASS")
+	if user == "" {
+		user = "admin"
+	}
+	if pass == "" {
+		pass = "admin"
+	}
+	return user, pass
+}
+
+func (s *Store) ListPrinters(ctx context.Context, t Tx) ([]model.Printer, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, name, uri, ppd_name, location, info, geo_location, organization, organizational_unit, state, accepting, shared, is_temporary, is_default, job_sheets_default, default_options, created_at, updated_at
         FROM printers
@@ -170,7 +237,8 @@ func (s *Store) ListPrinters(ctx context.Context, tx *sql.Tx) ([]model.Printer,
 	return printers, rows.Err()
 }
 
-func (s *Store) ListTemporaryPrinters(ctx context.Context, tx *sql.Tx, force bool, unusedBefore time.Time, limit int) ([]model.Printer, error) {
+func (s *Store) ListTemporaryPrinters(ctx context.Context, t Tx, force bool, unusedBefore time.Time, limit int) ([]model.Printer, error) {
+	tx := sqlTx(t)
 	if limit <= 0 {
 		limit = 1000
 	}
@@ -221,7 +289,8 @@ func (s *Store) ListTemporaryPrinters(ctx context.Context, tx *sql.Tx, force boo
 	return out, rows.Err()
 }
 
-func (s *Store) CreateClass(ctx context.Context, tx *sql.Tx, name, location, info string, accepting bool, isDefault bool, memberPrinterIDs []int64) (model.Class, error) {
+func (s *Store) CreateClass(ctx context.Context, t Tx, name, location, info string, accepting bool, isDefault bool, memberPrinterIDs []int64) (model.Class, error) {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	acc := 0
 	def := 0
@@ -262,8 +331,9 @@ func (s *Store) CreateClass(ctx context.Context, tx *sql.Tx, name, location, inf
 	}, nil
 }
 
-func (s *Store) UpsertClass(ctx context.Context, tx *sql.Tx, name, location, info string, accepting bool, memberPrinterIDs []int64) (model.Class, error) {
-	existing, err := s.GetClassByName(ctx, tx, name)
+func (s *Store) UpsertClass(ctx context.Context, t Tx, name, location, info string, accepting bool, memberPrinterIDs []int64) (model.Class, error) {
+	tx := sqlTx(t)
+	existing, err := s.GetClassByName(ctx, t, name)
 	if err == nil {
 		acc := 0
 		if accepting {
@@ -277,7 +347,7 @@ func (s *Store) UpsertClass(ctx context.Context, tx *sql.Tx, name, location, inf
 		if err != nil {
 			return model.Class{}, err
 		}
-		if err := s.ReplaceClassMembers(ctx, tx, existing.ID, memberPrinterIDs); err != nil {
+		if err := s.ReplaceClassMembers(ctx, t, existing.ID, memberPrinterIDs); err != nil {
 			return model.Class{}, err
 		}
 		existing.Location = location
@@ -286,10 +356,11 @@ func (s *Store) UpsertClass(ctx context.Context, tx *sql.Tx, name, location, inf
 		existing.UpdatedAt = time.Now().UTC()
 		return existing, nil
 	}
-	return s.CreateClass(ctx, tx, name, location, info, accepting, false, memberPrinterIDs)
+	return s.CreateClass(ctx, t, name, location, info, accepting, false, memberPrinterIDs)
 }
 
-func (s *Store) ReplaceClassMembers(ctx context.Context, tx *sql.Tx, classID int64, memberPrinterIDs []int64) error {
+func (s *Store) ReplaceClassMembers(ctx context.Context, t Tx, classID int64, memberPrinterIDs []int64) error {
+	tx := sqlTx(t)
 	if _, err := tx.ExecContext(ctx, `DELETE FROM class_members WHERE class_id = ?`, classID); err != nil {
 		return err
 	}
@@ -301,7 +372,8 @@ func (s *Store) ReplaceClassMembers(ctx context.Context, tx *sql.Tx, classID int
 	return nil
 }
 
-func (s *Store) ListClasses(ctx context.Context, tx *sql.Tx) ([]model.Class, error) {
+func (s *Store) ListClasses(ctx context.Context, t Tx) ([]model.Class, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, name, location, info, state, accepting, is_default, job_sheets_default, default_options, created_at, updated_at
         FROM classes
@@ -334,7 +406,8 @@ func (s *Store) ListClasses(ctx context.Context, tx *sql.Tx) ([]model.Class, err
 	return classes, rows.Err()
 }
 
-func (s *Store) GetClassByName(ctx context.Context, tx *sql.Tx, name string) (model.Class, error) {
+func (s *Store) GetClassByName(ctx context.Context, t Tx, name string) (model.Class, error) {
+	tx := sqlTx(t)
 	var c model.Class
 	var accepting int
 	var isDefault int
@@ -358,7 +431,36 @@ func (s *Store) GetClassByName(ctx context.Context, tx *sql.Tx, name string) (mo
 	return c, nil
 }
 
-func (s *Store) ListClassMembers(ctx context.Context, tx *sql.Tx, classID int64) ([]model.Printer, error) {
+// GetDefaultClass returns the class flagged as the server default.
+func (s *Store) GetDefaultClass(ctx context.Context, t Tx) (model.Class, error) {
+	tx := sqlTx(t)
+	var c model.Class
+	var accepting int
+	var isDefault int
+	var jobSheets string
+	var defaultOptions string
+	err := tx.QueryRowContext(ctx, `
+        SELECT id, name, location, info, state, accepting, is_default, job_sheets_default, default_options, created_at, updated_at
+        FROM classes
+        WHERE is_default = 1
+        ORDER BY id
+        LIMIT 1
+    `).Scan(&c.ID, &c.Name, &c.Location, &c.Info, &c.State, &accepting, &isDefault, &jobSheets, &defaultOptions, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return model.Class{}, err
+	}
+	c.Accepting = accepting != 0
+	c.IsDefault = isDefault != 0
+	if strings.TrimSpace(jobSheets) == "" {
+		jobSheets = "none"
+	}
+	c.JobSheetsDefault = jobSheets
+	c.DefaultOptions = defaultOptions
+	return c, nil
+}
+
+func (s *Store) ListClassMembers(ctx context.Context, t Tx, classID int64) ([]model.Printer, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT p.id, p.name, p.uri, p.ppd_name, p.location, p.info, p.geo_location, p.organization, p.organizational_unit, p.state, p.accepting, p.shared, p.is_temporary, p.is_default, p.job_sheets_default, p.default_options, p.created_at, p.updated_at
         FROM class_members cm
@@ -398,7 +500,8 @@ func (s *Store) ListClassMembers(ctx context.Context, tx *sql.Tx, classID int64)
 	return printers, rows.Err()
 }
 
-func (s *Store) UpdateClassAccepting(ctx context.Context, tx *sql.Tx, id int64, accepting bool) error {
+func (s *Store) UpdateClassAccepting(ctx context.Context, t Tx, id int64, accepting bool) error {
+	tx := sqlTx(t)
 	acc := 0
 	if accepting {
 		acc = 1
@@ -411,7 +514,8 @@ func (s *Store) UpdateClassAccepting(ctx context.Context, tx *sql.Tx, id int64,
 	return err
 }
 
-func (s *Store) UpdateClassState(ctx context.Context, tx *sql.Tx, id int64, state int) error {
+func (s *Store) UpdateClassState(ctx context.Context, t Tx, id int64, state int) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         UPDATE classes
         SET state = ?, updated_at = ?
@@ -420,7 +524,8 @@ func (s *Store) UpdateClassState(ctx context.Context, tx *sql.Tx, id int64, stat
 	return err
 }
 
-func (s *Store) UpdateClassJobSheetsDefault(ctx context.Context, tx *sql.Tx, id int64, sheets string) error {
+func (s *Store) UpdateClassJobSheetsDefault(ctx context.Context, t Tx, id int64, sheets string) error {
+	tx := sqlTx(t)
 	if strings.TrimSpace(sheets) == "" {
 		sheets = "none"
 	}
@@ -432,7 +537,8 @@ func (s *Store) UpdateClassJobSheetsDefault(ctx context.Context, tx *sql.Tx, id
 	return err
 }
 
-func (s *Store) UpdateClassDefaultOptions(ctx context.Context, tx *sql.Tx, id int64, optionsJSON string) error {
+func (s *Store) UpdateClassDefaultOptions(ctx context.Context, t Tx, id int64, optionsJSON string) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         UPDATE classes
         SET default_options = ?, updated_at = ?
@@ -441,12 +547,14 @@ func (s *Store) UpdateClassDefaultOptions(ctx context.Context, tx *sql.Tx, id in
 	return err
 }
 
-func (s *Store) DeleteClass(ctx context.Context, tx *sql.Tx, id int64) error {
+func (s *Store) DeleteClass(ctx context.Context, t Tx, id int64) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `DELETE FROM classes WHERE id = ?`, id)
 	return err
 }
 
-func (s *Store) SetDefaultClass(ctx context.Context, tx *sql.Tx, id int64) error {
+func (s *Store) SetDefaultClass(ctx context.Context, t Tx, id int64) error {
+	tx := sqlTx(t)
 	if _, err := tx.ExecContext(ctx, `UPDATE printers SET is_default = 0`); err != nil {
 		return err
 	}
@@ -460,7 +568,8 @@ func (s *Store) SetDefaultClass(ctx context.Context, tx *sql.Tx, id int64) error
     `, time.Now().UTC(), id)
 	return err
 }
-func (s *Store) GetPrinterByName(ctx context.Context, tx *sql.Tx, name string) (model.Printer, error) {
+func (s *Store) GetPrinterByName(ctx context.Context, t Tx, name string) (model.Printer, error) {
+	tx := sqlTx(t)
 	var p model.Printer
 	var accepting int
 	var isDefault int
@@ -490,7 +599,8 @@ func (s *Store) GetPrinterByName(ctx context.Context, tx *sql.Tx, name string) (
 	return p, nil
 }
 
-func (s *Store) GetPrinterByID(ctx context.Context, tx *sql.Tx, id int64) (model.Printer, error) {
+func (s *Store) GetPrinterByID(ctx context.Context, t Tx, id int64) (model.Printer, error) {
+	tx := sqlTx(t)
 	var p model.Printer
 	var accepting int
 	var isDefault int
@@ -520,7 +630,8 @@ func (s *Store) GetPrinterByID(ctx context.Context, tx *sql.Tx, id int64) (model
 	return p, nil
 }
 
-func (s *Store) GetPrinterByURI(ctx context.Context, tx *sql.Tx, uri string) (model.Printer, error) {
+func (s *Store) GetPrinterByURI(ctx context.Context, t Tx, uri string) (model.Printer, error) {
+	tx := sqlTx(t)
 	var p model.Printer
 	var accepting int
 	var isDefault int
@@ -550,7 +661,42 @@ func (s *Store) GetPrinterByURI(ctx context.Context, tx *sql.Tx, uri string) (mo
 	return p, nil
 }
 
-func (s *Store) TouchPrinter(ctx context.Context, tx *sql.Tx, id int64) error {
+// GetDefaultPrinter returns the printer flagged as the server default or,
+// when none is, the oldest printer.
+func (s *Store) GetDefaultPrinter(ctx context.Context, t Tx) (model.Printer, error) {
+	tx := sqlTx(t)
+	var p model.Printer
+	var accepting int
+	var isDefault int
+	var shared int
+	var temporary int
+	var jobSheets string
+	var defaultOptions string
+	var ppdName string
+	err := tx.QueryRowContext(ctx, `
+        SELECT id, name, uri, ppd_name, location, info, geo_location, organization, organizational_unit, state, accepting, shared, is_temporary, is_default, job_sheets_default, default_options, created_at, updated_at
+        FROM printers
+        ORDER BY is_default DESC, id ASC
+        LIMIT 1
+    `).Scan(&p.ID, &p.Name, &p.URI, &ppdName, &p.Location, &p.Info, &p.Geo, &p.Org, &p.OrgUnit, &p.State, &accepting, &shared, &temporary, &isDefault, &jobSheets, &defaultOptions, &p.CreatedAt, &p.UpdatedAt)
+	if err != nil {
+		return model.Printer{}, err
+	}
+	p.Accepting = accepting != 0
+	p.Shared = shared != 0
+	p.IsTemporary = temporary != 0
+	p.IsDefault = isDefault != 0
+	p.PPDName = strings.TrimSpace(ppdName)
+	if strings.TrimSpace(jobSheets) == "" {
+		jobSheets = "none"
+	}
+	p.JobSheetsDefault = jobSheets
+	p.DefaultOptions = defaultOptions
+	return p, nil
+}
+
+func (s *Store) TouchPrinter(ctx context.Context, t Tx, id int64) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         UPDATE printers
         SET updated_at = ?
@@ -559,7 +705,8 @@ func (s *Store) TouchPrinter(ctx context.Context, tx *sql.Tx, id int64) error {
 	return err
 }
 
-func (s *Store) UpdatePrinterTemporary(ctx context.Context, tx *sql.Tx, id int64, temporary bool) error {
+func (s *Store) UpdatePrinterTemporary(ctx context.Context, t Tx, id int64, temporary bool) error {
+	tx := sqlTx(t)
 	val := 0
 	if temporary {
 		val = 1
@@ -572,7 +719,8 @@ func (s *Store) UpdatePrinterTemporary(ctx context.Context, tx *sql.Tx, id int64
 	return err
 }
 
-func (s *Store) DeleteTemporaryPrinters(ctx context.Context, tx *sql.Tx, force bool, unusedBefore time.Time) (int64, error) {
+func (s *Store) DeleteTemporaryPrinters(ctx context.Context, t Tx, force bool, unusedBefore time.Time) (int64, error) {
+	tx := sqlTx(t)
 	stmt := `DELETE FROM printers WHERE is_temporary = 1`
 	args := []any{}
 	if !force {
@@ -590,7 +738,8 @@ func (s *Store) DeleteTemporaryPrinters(ctx context.Context, tx *sql.Tx, force b
 	return n, nil
 }
 
-func (s *Store) CreateJob(ctx context.Context, tx *sql.Tx, printerID int64, name, user, originHost, options string) (model.Job, error) {
+func (s *Store) CreateJob(ctx context.Context, t Tx, printerID int64, name, user, originHost, options string) (model.Job, error) {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	res, err := tx.ExecContext(ctx, `
         INSERT INTO jobs (printer_id, name, user_name, origin_host, options, state, state_reason, impressions, submitted_at)
@@ -603,7 +752,7 @@ func (s *Store) CreateJob(ctx context.Context, tx *sql.Tx, printerID int64, name
 	if err != nil {
 		return model.Job{}, err
 	}
-	_ = s.AddJobEvent(ctx, tx, id, "job-created", map[string]string{
+	_ = s.AddJobEvent(ctx, t, id, "job-created", map[string]string{
 		"state":  "3",
 		"reason": "job-incoming",
 	})
@@ -622,7 +771,8 @@ func (s *Store) CreateJob(ctx context.Context, tx *sql.Tx, printerID int64, name
 	}, nil
 }
 
-func (s *Store) AddDocument(ctx context.Context, tx *sql.Tx, jobID int64, fileName, mimeType, path string, sizeBytes int64, nameSupplied, formatSupplied string) (model.Document, error) {
+func (s *Store) AddDocument(ctx context.Context, t Tx, jobID int64, fileName, mimeType, path string, sizeBytes int64, nameSupplied, formatSupplied string) (model.Document, error) {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	res, err := tx.ExecContext(ctx, `
         INSERT INTO documents (job_id, file_name, mime_type, format_supplied, name_supplied, size_bytes, path, created_at)
@@ -648,7 +798,8 @@ func (s *Store) AddDocument(ctx context.Context, tx *sql.Tx, jobID int64, fileNa
 	}, nil
 }
 
-func (s *Store) GetJob(ctx context.Context, tx *sql.Tx, jobID int64) (model.Job, error) {
+func (s *Store) GetJob(ctx context.Context, t Tx, jobID int64) (model.Job, error) {
+	tx := sqlTx(t)
 	var job model.Job
 	var processing sql.NullTime
 	var completed sql.NullTime
@@ -669,7 +820,8 @@ func (s *Store) GetJob(ctx context.Context, tx *sql.Tx, jobID int64) (model.Job,
 	return job, nil
 }
 
-func (s *Store) ListJobsByPrinter(ctx context.Context, tx *sql.Tx, printerID int64, limit int) ([]model.Job, error) {
+func (s *Store) ListJobsByPrinter(ctx context.Context, t Tx, printerID int64, limit int) ([]model.Job, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, printer_id, name, user_name, origin_host, options, state, state_reason, impressions, submitted_at, processing_at, completed_at
         FROM jobs
@@ -701,7 +853,8 @@ func (s *Store) ListJobsByPrinter(ctx context.Context, tx *sql.Tx, printerID int
 	return jobs, rows.Err()
 }
 
-func (s *Store) ListJobsByUser(ctx context.Context, tx *sql.Tx, user string, printerID *int64, limit int) ([]model.Job, error) {
+func (s *Store) ListJobsByUser(ctx context.Context, t Tx, user string, printerID *int64, limit int) ([]model.Job, error) {
+	tx := sqlTx(t)
 	query := `
         SELECT id, printer_id, name, user_name, origin_host, options, state, state_reason, impressions, submitted_at, processing_at, completed_at
         FROM jobs
@@ -740,7 +893,8 @@ func (s *Store) ListJobsByUser(ctx context.Context, tx *sql.Tx, user string, pri
 	return jobs, rows.Err()
 }
 
-func (s *Store) UpdateJobState(ctx context.Context, tx *sql.Tx, jobID int64, state int, reason string, completedAt *time.Time) error {
+func (s *Store) UpdateJobState(ctx context.Context, t Tx, jobID int64, state int, reason string, completedAt *time.Time) error {
+	tx := sqlTx(t)
 	var completed sql.NullTime
 	if completedAt != nil {
 		completed = sql.NullTime{Time: *completedAt, Valid: true}
@@ -751,7 +905,7 @@ func (s *Store) UpdateJobState(ctx context.Context, tx *sql.Tx, jobID int64, sta
         WHERE id = ?
     `, state, reason, completed, jobID)
 	if err == nil {
-		_ = s.AddJobEvent(ctx, tx, jobID, reason, map[string]string{
+		_ = s.AddJobEvent(ctx, t, jobID, reason, map[string]string{
 			"state":  strconv.Itoa(state),
 			"reason": reason,
 		})
@@ -768,7 +922,16 @@ func (s *Store) UpdateJobState(ctx context.Context, tx *sql.Tx, jobID int64, sta
 	return err
 }
 
-func (s *Store) UpdateJobAttributes(ctx context.Context, tx *sql.Tx, jobID int64, name *string, options *string) error {
+// SetJobSubmittedAt overrides a job's submission time, which is used when
+// importing queued jobs from another spooler so they keep their place in line.
+func (s *Store) SetJobSubmittedAt(ctx context.Context, t Tx, jobID int64, submitted time.Time) error {
+	tx := sqlTx(t)
+	_, err := tx.ExecContext(ctx, `UPDATE jobs SET submitted_at = ? WHERE id = ?`, submitted.UTC(), jobID)
+	return err
+}
+
+func (s *Store) UpdateJobAttributes(ctx context.Context, t Tx, jobID int64, name *string, options *string) error {
+	tx := sqlTx(t)
 	fields := []string{}
 	args := []any{}
 	if name != nil {
@@ -794,8 +957,9 @@ func (s *Store) UpdateJobAttributes(ctx context.Context, tx *sql.Tx, jobID int64
 	return err
 }
 
-func (s *Store) MoveJob(ctx context.Context, tx *sql.Tx, jobID int64, printerID int64) (model.Job, error) {
-	job, err := s.GetJob(ctx, tx, jobID)
+func (s *Store) MoveJob(ctx context.Context, t Tx, jobID int64, printerID int64) (model.Job, error) {
+	tx := sqlTx(t)
+	job, err := s.GetJob(ctx, t, jobID)
 	if err != nil {
 		return model.Job{}, err
 	}
@@ -814,7 +978,7 @@ func (s *Store) MoveJob(ctx context.Context, tx *sql.Tx, jobID int64, printerID
 	job.State = 3
 	job.StateReason = "job-moved"
 	job.CompletedAt = nil
-	_ = s.AddJobEvent(ctx, tx, jobID, "job-moved", map[string]string{
+	_ = s.AddJobEvent(ctx, t, jobID, "job-moved", map[string]string{
 		"state":  "3",
 		"reason": "job-moved",
 	})
@@ -823,7 +987,8 @@ func (s *Store) MoveJob(ctx context.Context, tx *sql.Tx, jobID int64, printerID
 	return job, nil
 }
 
-func (s *Store) CreateUser(ctx context.Context, tx *sql.Tx, username, password string, admin bool) error {
+func (s *Store) CreateUser(ctx context.Context, t Tx, username, password string, admin bool) error {
+	tx := sqlTx(t)
 	hash, err := hashPassword(password)
 	if err != nil {
 		return err
@@ -841,7 +1006,8 @@ func (s *Store) CreateUser(ctx context.Context, tx *sql.Tx, username, password s
 	return err
 }
 
-func (s *Store) GetUserByUsername(ctx context.Context, tx *sql.Tx, username string) (model.User, error) {
+func (s *Store) GetUserByUsername(ctx context.Context, t Tx, username string) (model.User, error) {
+	tx := sqlTx(t)
 	var u model.User
 	var isAdmin int
 	err := tx.QueryRowContext(ctx, `
@@ -856,8 +1022,8 @@ func (s *Store) GetUserByUsername(ctx context.Context, tx *sql.Tx, username stri
 	return u, nil
 }
 
-func (s *Store) VerifyUser(ctx context.Context, tx *sql.Tx, username, password string) (model.User, error) {
-	u, err := s.GetUserByUsername(ctx, tx, username)
+func (s *Store) VerifyUser(ctx context.Context, t Tx, username, password string) (model.User, error) {
+	u, err := s.GetUserByUsername(ctx, t, username)
 	if err != nil {
 		return model.User{}, err
 	}
@@ -867,7 +1033,16 @@ func (s *Store) VerifyUser(ctx context.Context, tx *sql.Tx, username, password s
 	return u, nil
 }
 
-func (s *Store) SetSetting(ctx context.Context, tx *sql.Tx, key, value string) error {
+// SetUserDigestHA1 stores the HTTP Digest hash for an account created
+// before digest authentication was supported.
+func (s *Store) SetUserDigestHA1(ctx context.Context, t Tx, username, digest string) error {
+	tx := sqlTx(t)
+	_, err := tx.ExecContext(ctx, `UPDATE users SET digest_ha1 = ? WHERE username = ?`, digest, username)
+	return err
+}
+
+func (s *Store) SetSetting(ctx context.Context, t Tx, key, value string) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         INSERT INTO settings (key, value) VALUES (?, ?)
         ON CONFLICT(key) DO UPDATE SET value = excluded.value
@@ -875,7 +1050,8 @@ func (s *Store) SetSetting(ctx context.Context, tx *sql.Tx, key, value string) e
 	return err
 }
 
-func (s *Store) GetSetting(ctx context.Context, tx *sql.Tx, key, fallback string) (string, error) {
+func (s *Store) GetSetting(ctx context.Context, t Tx, key, fallback string) (string, error) {
+	tx := sqlTx(t)
 	var v string
 	err := tx.QueryRowContext(ctx, `SELECT value FROM settings WHERE key = ?`, key).Scan(&v)
 	if err == sql.ErrNoRows {
@@ -887,7 +1063,8 @@ func (s *Store) GetSetting(ctx context.Context, tx *sql.Tx, key, fallback string
 	return v, nil
 }
 
-func (s *Store) ListSettings(ctx context.Context, tx *sql.Tx) (map[string]string, error) {
+func (s *Store) ListSettings(ctx context.Context, t Tx) (map[string]string, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `SELECT key, value FROM settings ORDER BY key`)
 	if err != nil {
 		return nil, err
@@ -904,7 +1081,8 @@ func (s *Store) ListSettings(ctx context.Context, tx *sql.Tx) (map[string]string
 	return out, rows.Err()
 }
 
-func (s *Store) CreatePrinter(ctx context.Context, tx *sql.Tx, name, uri, location, info, ppdName string, accepting bool, isDefault bool, shared bool, jobSheetsDefault, defaultOptions string) (model.Printer, error) {
+func (s *Store) CreatePrinter(ctx context.Context, t Tx, name, uri, location, info, ppdName string, accepting bool, isDefault bool, shared bool, jobSheetsDefault, defaultOptions string) (model.Printer, error) {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	acc := 0
 	def := 0
@@ -955,8 +1133,9 @@ func (s *Store) CreatePrinter(ctx context.Context, tx *sql.Tx, name, uri, locati
 	}, nil
 }
 
-func (s *Store) UpsertPrinter(ctx context.Context, tx *sql.Tx, name, uri, location, info string, accepting bool) (model.Printer, error) {
-	existing, err := s.GetPrinterByName(ctx, tx, name)
+func (s *Store) UpsertPrinter(ctx context.Context, t Tx, name, uri, location, info string, accepting bool) (model.Printer, error) {
+	tx := sqlTx(t)
+	existing, err := s.GetPrinterByName(ctx, t, name)
 	if err == nil {
 		acc := 0
 		if accepting {
@@ -980,10 +1159,11 @@ func (s *Store) UpsertPrinter(ctx context.Context, tx *sql.Tx, name, uri, locati
 		_ = s.addNotificationForPrinter(ctx, tx, existing.ID, "printer-modified")
 		return existing, nil
 	}
-	return s.CreatePrinter(ctx, tx, name, uri, location, info, "", accepting, false, true, "none", "")
+	return s.CreatePrinter(ctx, t, name, uri, location, info, "", accepting, false, true, "none", "")
 }
 
-func (s *Store) UpdatePrinterAttributes(ctx context.Context, tx *sql.Tx, id int64, info, location, geo, org, orgUnit *string) error {
+func (s *Store) UpdatePrinterAttributes(ctx context.Context, t Tx, id int64, info, location, geo, org, orgUnit *string) error {
+	tx := sqlTx(t)
 	fields := []string{}
 	args := []any{}
 	if info != nil {
@@ -1024,7 +1204,8 @@ func (s *Store) UpdatePrinterAttributes(ctx context.Context, tx *sql.Tx, id int6
 	return err
 }
 
-func (s *Store) UpdateClassAttributes(ctx context.Context, tx *sql.Tx, id int64, info, location *string) error {
+func (s *Store) UpdateClassAttributes(ctx context.Context, t Tx, id int64, info, location *string) error {
+	tx := sqlTx(t)
 	parts := []string{}
 	args := []any{}
 	if info != nil {
@@ -1045,7 +1226,8 @@ func (s *Store) UpdateClassAttributes(ctx context.Context, tx *sql.Tx, id int64,
 	return err
 }
 
-func (s *Store) UpdatePrinterSharing(ctx context.Context, tx *sql.Tx, id int64, shared bool) error {
+func (s *Store) UpdatePrinterSharing(ctx context.Context, t Tx, id int64, shared bool) error {
+	tx := sqlTx(t)
 	val := 0
 	if shared {
 		val = 1
@@ -1063,7 +1245,8 @@ func (s *Store) UpdatePrinterSharing(ctx context.Context, tx *sql.Tx, id int64,
 	return err
 }
 
-func (s *Store) UpdatePrinterURI(ctx context.Context, tx *sql.Tx, id int64, uri string) error {
+func (s *Store) UpdatePrinterURI(ctx context.Context, t Tx, id int64, uri string) error {
+	tx := sqlTx(t)
 	uri = strings.TrimSpace(uri)
 	if uri == "" {
 		return fmt.Errorf("empty printer uri")
@@ -1081,7 +1264,8 @@ func (s *Store) UpdatePrinterURI(ctx context.Context, tx *sql.Tx, id int64, uri
 	return err
 }
 
-func (s *Store) UpdatePrinterPPDName(ctx context.Context, tx *sql.Tx, id int64, ppdName string) error {
+func (s *Store) UpdatePrinterPPDName(ctx context.Context, t Tx, id int64, ppdName string) error {
+	tx := sqlTx(t)
 	ppdName = strings.TrimSpace(ppdName)
 	if ppdName == "" {
 		ppdName = model.DefaultPPDName
@@ -1099,7 +1283,8 @@ func (s *Store) UpdatePrinterPPDName(ctx context.Context, tx *sql.Tx, id int64,
 	return err
 }
 
-func (s *Store) UpdatePrinterJobSheetsDefault(ctx context.Context, tx *sql.Tx, id int64, sheets string) error {
+func (s *Store) UpdatePrinterJobSheetsDefault(ctx context.Context, t Tx, id int64, sheets string) error {
+	tx := sqlTx(t)
 	if strings.TrimSpace(sheets) == "" {
 		sheets = "none"
 	}
@@ -1116,7 +1301,8 @@ func (s *Store) UpdatePrinterJobSheetsDefault(ctx context.Context, tx *sql.Tx, i
 	return err
 }
 
-func (s *Store) UpdatePrinterDefaultOptions(ctx context.Context, tx *sql.Tx, id int64, optionsJSON string) error {
+func (s *Store) UpdatePrinterDefaultOptions(ctx context.Context, t Tx, id int64, optionsJSON string) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         UPDATE printers
         SET default_options = ?, updated_at = ?
@@ -1132,7 +1318,7 @@ func (s *Store) UpdatePrinterDefaultOptions(ctx context.Context, tx *sql.Tx, id
 	if strings.TrimSpace(optionsJSON) != "" {
 		if err := json.Unmarshal([]byte(optionsJSON), &parsed); err == nil {
 			for k, v := range parsed {
-				if err := s.SetPrinterOption(ctx, tx, id, k, v); err != nil {
+				if err := s.SetPrinterOption(ctx, t, id, k, v); err != nil {
 					return err
 				}
 			}
@@ -1146,7 +1332,8 @@ func (s *Store) UpdatePrinterDefaultOptions(ctx context.Context, tx *sql.Tx, id
 	return err
 }
 
-func (s *Store) GetPrinterSupplies(ctx context.Context, tx *sql.Tx, printerID int64) (PrinterSupplies, bool, error) {
+func (s *Store) GetPrinterSupplies(ctx context.Context, t Tx, printerID int64) (PrinterSupplies, bool, error) {
+	tx := sqlTx(t)
 	var state string
 	var details string
 	var updated time.Time
@@ -1173,7 +1360,8 @@ func (s *Store) GetPrinterSupplies(ctx context.Context, tx *sql.Tx, printerID in
 	return out, true, nil
 }
 
-func (s *Store) UpsertPrinterSupplies(ctx context.Context, tx *sql.Tx, printerID int64, state string, details map[string]string, updated time.Time) error {
+func (s *Store) UpsertPrinterSupplies(ctx context.Context, t Tx, printerID int64, state string, details map[string]string, updated time.Time) error {
+	tx := sqlTx(t)
 	if updated.IsZero() {
 		updated = time.Now().UTC()
 	}
@@ -1191,7 +1379,8 @@ func (s *Store) UpsertPrinterSupplies(ctx context.Context, tx *sql.Tx, printerID
 	return err
 }
 
-func (s *Store) UpdatePrinterAccepting(ctx context.Context, tx *sql.Tx, id int64, accepting bool) error {
+func (s *Store) UpdatePrinterAccepting(ctx context.Context, t Tx, id int64, accepting bool) error {
+	tx := sqlTx(t)
 	acc := 0
 	if accepting {
 		acc = 1
@@ -1209,7 +1398,8 @@ func (s *Store) UpdatePrinterAccepting(ctx context.Context, tx *sql.Tx, id int64
 	return err
 }
 
-func (s *Store) UpdateAllPrintersAccepting(ctx context.Context, tx *sql.Tx, accepting bool) error {
+func (s *Store) UpdateAllPrintersAccepting(ctx context.Context, t Tx, accepting bool) error {
+	tx := sqlTx(t)
 	acc := 0
 	if accepting {
 		acc = 1
@@ -1221,7 +1411,8 @@ func (s *Store) UpdateAllPrintersAccepting(ctx context.Context, tx *sql.Tx, acce
 	return err
 }
 
-func (s *Store) UpdatePrinterState(ctx context.Context, tx *sql.Tx, id int64, state int) error {
+func (s *Store) UpdatePrinterState(ctx context.Context, t Tx, id int64, state int) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         UPDATE printers
         SET state = ?, updated_at = ?
@@ -1238,7 +1429,8 @@ func (s *Store) UpdatePrinterState(ctx context.Context, tx *sql.Tx, id int64, st
 	return err
 }
 
-func (s *Store) UpdateAllPrintersState(ctx context.Context, tx *sql.Tx, state int) error {
+func (s *Store) UpdateAllPrintersState(ctx context.Context, t Tx, state int) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         UPDATE printers
         SET state = ?, updated_at = ?
@@ -1246,7 +1438,8 @@ func (s *Store) UpdateAllPrintersState(ctx context.Context, tx *sql.Tx, state in
 	return err
 }
 
-func (s *Store) UpdateAllClassesAccepting(ctx context.Context, tx *sql.Tx, accepting bool) error {
+func (s *Store) UpdateAllClassesAccepting(ctx context.Context, t Tx, accepting bool) error {
+	tx := sqlTx(t)
 	acc := 0
 	if accepting {
 		acc = 1
@@ -1258,7 +1451,8 @@ func (s *Store) UpdateAllClassesAccepting(ctx context.Context, tx *sql.Tx, accep
 	return err
 }
 
-func (s *Store) UpdateAllClassesState(ctx context.Context, tx *sql.Tx, state int) error {
+func (s *Store) UpdateAllClassesState(ctx context.Context, t Tx, state int) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `
         UPDATE classes
         SET state = ?, updated_at = ?
@@ -1266,7 +1460,8 @@ func (s *Store) UpdateAllClassesState(ctx context.Context, tx *sql.Tx, state int
 	return err
 }
 
-func (s *Store) SetDefaultPrinter(ctx context.Context, tx *sql.Tx, id int64) error {
+func (s *Store) SetDefaultPrinter(ctx context.Context, t Tx, id int64) error {
+	tx := sqlTx(t)
 	if _, err := tx.ExecContext(ctx, `UPDATE printers SET is_default = 0`); err != nil {
 		return err
 	}
@@ -1281,13 +1476,15 @@ func (s *Store) SetDefaultPrinter(ctx context.Context, tx *sql.Tx, id int64) err
 	return err
 }
 
-func (s *Store) DeletePrinter(ctx context.Context, tx *sql.Tx, id int64) error {
+func (s *Store) DeletePrinter(ctx context.Context, t Tx, id int64) error {
+	tx := sqlTx(t)
 	_ = s.addNotificationForPrinter(ctx, tx, id, "printer-deleted")
 	_, err := tx.ExecContext(ctx, `DELETE FROM printers WHERE id = ?`, id)
 	return err
 }
 
-func (s *Store) CancelJobsByPrinter(ctx context.Context, tx *sql.Tx, printerID int64, reason string) error {
+func (s *Store) CancelJobsByPrinter(ctx context.Context, t Tx, printerID int64, reason string) error {
+	tx := sqlTx(t)
 	completed := time.Now().UTC()
 	_, err := tx.ExecContext(ctx, `
         UPDATE jobs
@@ -1297,12 +1494,16 @@ func (s *Store) CancelJobsByPrinter(ctx context.Context, tx *sql.Tx, printerID i
 	return err
 }
 
-func (s *Store) CreateSubscription(ctx context.Context, tx *sql.Tx, printerID *int64, jobID *int64, events string, leaseSecs int64, owner string, recipientURI string, pullMethod string, timeInterval int64, userData []byte) (model.Subscription, error) {
+func (s *Store) CreateSubscription(ctx context.Context, t Tx, limits SubscriptionLimits, printerID *int64, jobID *int64, events string, leaseSecs int64, owner string, recipientURI string, pullMethod string, timeInterval int64, userData []byte) (model.Subscription, error) {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	events = normalizeEvents(events)
 	if owner == "" {
 		owner = "anonymous"
 	}
+	if err := checkSubscriptionLimits(ctx, s, t, limits, printerID, jobID, owner); err != nil {
+		return model.Subscription{}, err
+	}
 	recipientURI = strings.TrimSpace(recipientURI)
 	pullMethod = strings.TrimSpace(pullMethod)
 	if pullMethod == "" && recipientURI == "" {
@@ -1342,7 +1543,8 @@ func (s *Store) CreateSubscription(ctx context.Context, tx *sql.Tx, printerID *i
 	}, nil
 }
 
-func (s *Store) GetSubscription(ctx context.Context, tx *sql.Tx, id int64) (model.Subscription, error) {
+func (s *Store) GetSubscription(ctx context.Context, t Tx, id int64) (model.Subscription, error) {
+	tx := sqlTx(t)
 	var sub model.Subscription
 	var printerID sql.NullInt64
 	var jobID sql.NullInt64
@@ -1361,7 +1563,8 @@ func (s *Store) GetSubscription(ctx context.Context, tx *sql.Tx, id int64) (mode
 	return sub, nil
 }
 
-func (s *Store) UpdateSubscriptionLease(ctx context.Context, tx *sql.Tx, id int64, leaseSecs int64) (model.Subscription, error) {
+func (s *Store) UpdateSubscriptionLease(ctx context.Context, t Tx, id int64, leaseSecs int64) (model.Subscription, error) {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	_, err := tx.ExecContext(ctx, `
         UPDATE subscriptions
@@ -1371,10 +1574,11 @@ func (s *Store) UpdateSubscriptionLease(ctx context.Context, tx *sql.Tx, id int6
 	if err != nil {
 		return model.Subscription{}, err
 	}
-	return s.GetSubscription(ctx, tx, id)
+	return s.GetSubscription(ctx, t, id)
 }
 
-func (s *Store) ListSubscriptions(ctx context.Context, tx *sql.Tx, printerID *int64, jobID *int64, owner string, limit int) ([]model.Subscription, error) {
+func (s *Store) ListSubscriptions(ctx context.Context, t Tx, printerID *int64, jobID *int64, owner string, limit int) ([]model.Subscription, error) {
+	tx := sqlTx(t)
 	query := `
         SELECT id, printer_id, job_id, events, lease_seconds, owner, recipient_uri, pull_method, time_interval, user_data, created_at
         FROM subscriptions
@@ -1423,13 +1627,15 @@ func (s *Store) ListSubscriptions(ctx context.Context, tx *sql.Tx, printerID *in
 	return subs, rows.Err()
 }
 
-func (s *Store) CancelSubscription(ctx context.Context, tx *sql.Tx, id int64) error {
+func (s *Store) CancelSubscription(ctx context.Context, t Tx, id int64) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `DELETE FROM subscriptions WHERE id = ?`, id)
 	return err
 }
 
-func (s *Store) CountSubscriptions(ctx context.Context, tx *sql.Tx) (int, error) {
-	if err := s.PruneExpiredSubscriptions(ctx, tx); err != nil {
+func (s *Store) CountSubscriptions(ctx context.Context, t Tx) (int, error) {
+	tx := sqlTx(t)
+	if err := s.PruneExpiredSubscriptions(ctx, t); err != nil {
 		return 0, err
 	}
 	var count int
@@ -1439,8 +1645,9 @@ func (s *Store) CountSubscriptions(ctx context.Context, tx *sql.Tx) (int, error)
 	return count, nil
 }
 
-func (s *Store) CountSubscriptionsForPrinter(ctx context.Context, tx *sql.Tx, printerID int64) (int, error) {
-	if err := s.PruneExpiredSubscriptions(ctx, tx); err != nil {
+func (s *Store) CountSubscriptionsForPrinter(ctx context.Context, t Tx, printerID int64) (int, error) {
+	tx := sqlTx(t)
+	if err := s.PruneExpiredSubscriptions(ctx, t); err != nil {
 		return 0, err
 	}
 	var count int
@@ -1450,8 +1657,9 @@ func (s *Store) CountSubscriptionsForPrinter(ctx context.Context, tx *sql.Tx, pr
 	return count, nil
 }
 
-func (s *Store) CountSubscriptionsForJob(ctx context.Context, tx *sql.Tx, jobID int64) (int, error) {
-	if err := s.PruneExpiredSubscriptions(ctx, tx); err != nil {
+func (s *Store) CountSubscriptionsForJob(ctx context.Context, t Tx, jobID int64) (int, error) {
+	tx := sqlTx(t)
+	if err := s.PruneExpiredSubscriptions(ctx, t); err != nil {
 		return 0, err
 	}
 	var count int
@@ -1461,8 +1669,9 @@ func (s *Store) CountSubscriptionsForJob(ctx context.Context, tx *sql.Tx, jobID
 	return count, nil
 }
 
-func (s *Store) CountSubscriptionsForUser(ctx context.Context, tx *sql.Tx, owner string) (int, error) {
-	if err := s.PruneExpiredSubscriptions(ctx, tx); err != nil {
+func (s *Store) CountSubscriptionsForUser(ctx context.Context, t Tx, owner string) (int, error) {
+	tx := sqlTx(t)
+	if err := s.PruneExpiredSubscriptions(ctx, t); err != nil {
 		return 0, err
 	}
 	var count int
@@ -1472,8 +1681,9 @@ func (s *Store) CountSubscriptionsForUser(ctx context.Context, tx *sql.Tx, owner
 	return count, nil
 }
 
-func (s *Store) ListNotifications(ctx context.Context, tx *sql.Tx, subscriptionID int64, limit int) ([]model.Notification, error) {
-	if err := s.PruneExpiredSubscriptions(ctx, tx); err != nil {
+func (s *Store) ListNotifications(ctx context.Context, t Tx, subscriptionID int64, limit int) ([]model.Notification, error) {
+	tx := sqlTx(t)
+	if err := s.PruneExpiredSubscriptions(ctx, t); err != nil {
 		return nil, err
 	}
 	rows, err := tx.QueryContext(ctx, `
@@ -1503,13 +1713,15 @@ func (s *Store) addNotificationForPrinter(ctx context.Context, tx *sql.Tx, print
 	if s.MaxEvents <= 0 {
 		return nil
 	}
-	if err := s.PruneExpiredSubscriptions(ctx, tx); err != nil {
+	if err := s.PruneExpiredSubscriptions(ctx, sqliteTx{tx}); err != nil {
 		return err
 	}
+	// Server-wide subscriptions (no printer, no job) see every printer.
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, events, lease_seconds, created_at
         FROM subscriptions
         WHERE printer_id = ?
+           OR (printer_id IS NULL AND job_id IS NULL)
     `, printerID)
 	if err != nil {
 		return err
@@ -1561,14 +1773,18 @@ func (s *Store) addNotificationForJob(ctx context.Context, tx *sql.Tx, jobID int
 	if s.MaxEvents <= 0 {
 		return nil
 	}
-	if err := s.PruneExpiredSubscriptions(ctx, tx); err != nil {
+	if err := s.PruneExpiredSubscriptions(ctx, sqliteTx{tx}); err != nil {
 		return err
 	}
+	// Job events also reach the subscriptions on the job's printer and
+	// server-wide ones; their notify-events decide which they keep.
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, events, lease_seconds, created_at
         FROM subscriptions
         WHERE job_id = ?
-    `, jobID)
+           OR (job_id IS NULL AND (printer_id IS NULL
+               OR printer_id = (SELECT printer_id FROM jobs WHERE id = ?)))
+    `, jobID, jobID)
 	if err != nil {
 		return err
 	}
@@ -1614,7 +1830,8 @@ func (s *Store) addNotificationForJob(ctx context.Context, tx *sql.Tx, jobID int
 	return rows.Err()
 }
 
-func (s *Store) PruneExpiredSubscriptions(ctx context.Context, tx *sql.Tx) error {
+func (s *Store) PruneExpiredSubscriptions(ctx context.Context, t Tx) error {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	_, err := tx.ExecContext(ctx, `
         DELETE FROM subscriptions
@@ -1624,7 +1841,8 @@ func (s *Store) PruneExpiredSubscriptions(ctx context.Context, tx *sql.Tx) error
 	return err
 }
 
-func (s *Store) AddJobEvent(ctx context.Context, tx *sql.Tx, jobID int64, event string, details map[string]string) error {
+func (s *Store) AddJobEvent(ctx context.Context, t Tx, jobID int64, event string, details map[string]string) error {
+	tx := sqlTx(t)
 	now := time.Now().UTC()
 	if strings.TrimSpace(event) == "" {
 		event = "job-state-changed"
@@ -1642,7 +1860,8 @@ func (s *Store) AddJobEvent(ctx context.Context, tx *sql.Tx, jobID int64, event
 	return err
 }
 
-func (s *Store) SetPrinterOption(ctx context.Context, tx *sql.Tx, printerID int64, key, value string) error {
+func (s *Store) SetPrinterOption(ctx context.Context, t Tx, printerID int64, key, value string) error {
+	tx := sqlTx(t)
 	key = strings.TrimSpace(key)
 	if key == "" {
 		return nil
@@ -1656,7 +1875,8 @@ func (s *Store) SetPrinterOption(ctx context.Context, tx *sql.Tx, printerID int6
 	return err
 }
 
-func (s *Store) SetPPDCache(ctx context.Context, tx *sql.Tx, ppdName, ppdHash, ippAttrs string) error {
+func (s *Store) SetPPDCache(ctx context.Context, t Tx, ppdName, ppdHash, ippAttrs string) error {
+	tx := sqlTx(t)
 	ppdName = strings.TrimSpace(ppdName)
 	if ppdName == "" {
 		return nil
@@ -1670,7 +1890,8 @@ func (s *Store) SetPPDCache(ctx context.Context, tx *sql.Tx, ppdName, ppdHash, i
 	return err
 }
 
-func (s *Store) GetPPDCache(ctx context.Context, tx *sql.Tx, ppdName string) (ppdHash string, ippAttrs string, updatedAt time.Time, ok bool, err error) {
+func (s *Store) GetPPDCache(ctx context.Context, t Tx, ppdName string) (ppdHash string, ippAttrs string, updatedAt time.Time, ok bool, err error) {
+	tx := sqlTx(t)
 	ppdName = strings.TrimSpace(ppdName)
 	if ppdName == "" {
 		return "", "", time.Time{}, false, nil
@@ -1689,7 +1910,8 @@ func (s *Store) GetPPDCache(ctx context.Context, tx *sql.Tx, ppdName string) (pp
 	return ppdHash, ippAttrs, updatedAt, true, nil
 }
 
-func (s *Store) UpsertDeviceCache(ctx context.Context, tx *sql.Tx, entry DeviceCacheEntry) error {
+func (s *Store) UpsertDeviceCache(ctx context.Context, t Tx, entry DeviceCacheEntry) error {
+	tx := sqlTx(t)
 	entry.URI = strings.TrimSpace(entry.URI)
 	if entry.URI == "" {
 		return nil
@@ -1712,7 +1934,8 @@ func (s *Store) UpsertDeviceCache(ctx context.Context, tx *sql.Tx, entry DeviceC
 	return err
 }
 
-func (s *Store) ListDeviceCache(ctx context.Context, tx *sql.Tx, freshWithin time.Duration, limit int) ([]DeviceCacheEntry, error) {
+func (s *Store) ListDeviceCache(ctx context.Context, t Tx, freshWithin time.Duration, limit int) ([]DeviceCacheEntry, error) {
+	tx := sqlTx(t)
 	if limit <= 0 {
 		limit = 1024
 	}
@@ -1745,7 +1968,8 @@ func (s *Store) ListDeviceCache(ctx context.Context, tx *sql.Tx, freshWithin tim
 	return out, rows.Err()
 }
 
-func (s *Store) PruneDeviceCache(ctx context.Context, tx *sql.Tx, olderThan time.Duration) error {
+func (s *Store) PruneDeviceCache(ctx context.Context, t Tx, olderThan time.Duration) error {
+	tx := sqlTx(t)
 	if olderThan <= 0 {
 		return nil
 	}
@@ -1778,6 +2002,40 @@ func normalizeEvents(events string) string {
 	return strings.Join(out, ",")
 }
 
+// checkSubscriptionLimits returns ErrTooManySubscriptions when a new
+// subscription for printerID or jobID owned by owner would exceed limits. A
+// server-wide subscription, with neither, counts against Total and PerUser.
+func checkSubscriptionLimits(ctx context.Context, repo SubscriptionRepository, tx Tx, limits SubscriptionLimits, printerID, jobID *int64, owner string) error {
+	full := func(limit int, count func() (int, error)) error {
+		if limit <= 0 {
+			return nil
+		}
+		n, err := count()
+		if err != nil {
+			return err
+		}
+		if n >= limit {
+			return ErrTooManySubscriptions
+		}
+		return nil
+	}
+	if err := full(limits.Total, func() (int, error) { return repo.CountSubscriptions(ctx, tx) }); err != nil {
+		return err
+	}
+	if err := full(limits.PerUser, func() (int, error) { return repo.CountSubscriptionsForUser(ctx, tx, owner) }); err != nil {
+		return err
+	}
+	if printerID != nil {
+		if err := full(limits.PerPrinter, func() (int, error) { return repo.CountSubscriptionsForPrinter(ctx, tx, *printerID) }); err != nil {
+			return err
+		}
+	}
+	if jobID != nil {
+		return full(limits.PerJob, func() (int, error) { return repo.CountSubscriptionsForJob(ctx, tx, *jobID) })
+	}
+	return nil
+}
+
 func subscriptionActive(createdAt time.Time, leaseSecs int64, now time.Time) bool {
 	if leaseSecs <= 0 {
 		return true
@@ -1799,7 +2057,8 @@ func eventAllowed(events string, event string) bool {
 	return false
 }
 
-func (s *Store) ClaimPendingJob(ctx context.Context, tx *sql.Tx, jobID int64) (bool, error) {
+func (s *Store) ClaimPendingJob(ctx context.Context, t Tx, jobID int64) (bool, error) {
+	tx := sqlTx(t)
 	processingAt := time.Now().UTC()
 	res, err := tx.ExecContext(ctx, `
         UPDATE jobs
@@ -1816,7 +2075,8 @@ func (s *Store) ClaimPendingJob(ctx context.Context, tx *sql.Tx, jobID int64) (b
 	return rows == 1, nil
 }
 
-func (s *Store) ListPendingJobs(ctx context.Context, tx *sql.Tx, limit int) ([]model.Job, error) {
+func (s *Store) ListPendingJobs(ctx context.Context, t Tx, limit int) ([]model.Job, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, printer_id, name, user_name, origin_host, options, state, state_reason, impressions, submitted_at, processing_at, completed_at
         FROM jobs
@@ -1849,7 +2109,8 @@ func (s *Store) ListPendingJobs(ctx context.Context, tx *sql.Tx, limit int) ([]m
 	return jobs, rows.Err()
 }
 
-func (s *Store) ListHeldJobs(ctx context.Context, tx *sql.Tx, limit int) ([]model.Job, error) {
+func (s *Store) ListHeldJobs(ctx context.Context, t Tx, limit int) ([]model.Job, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, printer_id, name, user_name, origin_host, options, state, state_reason, impressions, submitted_at, processing_at, completed_at
         FROM jobs
@@ -1881,7 +2142,8 @@ func (s *Store) ListHeldJobs(ctx context.Context, tx *sql.Tx, limit int) ([]mode
 	return jobs, rows.Err()
 }
 
-func (s *Store) ListTerminalJobs(ctx context.Context, tx *sql.Tx, limit int) ([]model.Job, error) {
+func (s *Store) ListTerminalJobs(ctx context.Context, t Tx, limit int) ([]model.Job, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, printer_id, name, user_name, origin_host, options, state, state_reason, impressions, submitted_at, processing_at, completed_at
         FROM jobs
@@ -1914,7 +2176,8 @@ func (s *Store) ListTerminalJobs(ctx context.Context, tx *sql.Tx, limit int) ([]
 	return jobs, rows.Err()
 }
 
-func (s *Store) ListDocumentsByJob(ctx context.Context, tx *sql.Tx, jobID int64) ([]model.Document, error) {
+func (s *Store) ListDocumentsByJob(ctx context.Context, t Tx, jobID int64) ([]model.Document, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id, job_id, file_name, mime_type, format_supplied, name_supplied, size_bytes, path, created_at
         FROM documents
@@ -1937,7 +2200,8 @@ func (s *Store) ListDocumentsByJob(ctx context.Context, tx *sql.Tx, jobID int64)
 	return docs, rows.Err()
 }
 
-func (s *Store) ListDocumentStatsByJobIDs(ctx context.Context, tx *sql.Tx, jobIDs []int64) (map[int64]DocumentStats, error) {
+func (s *Store) ListDocumentStatsByJobIDs(ctx context.Context, t Tx, jobIDs []int64) (map[int64]DocumentStats, error) {
+	tx := sqlTx(t)
 	stats := make(map[int64]DocumentStats, len(jobIDs))
 	if len(jobIDs) == 0 {
 		return stats, nil
@@ -1972,12 +2236,14 @@ func (s *Store) ListDocumentStatsByJobIDs(ctx context.Context, tx *sql.Tx, jobID
 	return stats, rows.Err()
 }
 
-func (s *Store) DeleteDocumentsByJob(ctx context.Context, tx *sql.Tx, jobID int64) error {
+func (s *Store) DeleteDocumentsByJob(ctx context.Context, t Tx, jobID int64) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `DELETE FROM documents WHERE job_id = ?`, jobID)
 	return err
 }
 
-func (s *Store) ListJobIDsByPrinter(ctx context.Context, tx *sql.Tx, printerID int64) ([]int64, error) {
+func (s *Store) ListJobIDsByPrinter(ctx context.Context, t Tx, printerID int64) ([]int64, error) {
+	tx := sqlTx(t)
 	rows, err := tx.QueryContext(ctx, `
         SELECT id
         FROM jobs
@@ -1999,7 +2265,8 @@ func (s *Store) ListJobIDsByPrinter(ctx context.Context, tx *sql.Tx, printerID i
 	return out, rows.Err()
 }
 
-func (s *Store) CountQueuedJobsByPrinterIDs(ctx context.Context, tx *sql.Tx, printerIDs []int64) (int, error) {
+func (s *Store) CountQueuedJobsByPrinterIDs(ctx context.Context, t Tx, printerIDs []int64) (int, error) {
+	tx := sqlTx(t)
 	if len(printerIDs) == 0 {
 		return 0, nil
 	}
@@ -2017,7 +2284,221 @@ func (s *Store) CountQueuedJobsByPrinterIDs(ctx context.Context, tx *sql.Tx, pri
 	return count, nil
 }
 
-func (s *Store) DeleteJob(ctx context.Context, tx *sql.Tx, jobID int64) error {
+func (s *Store) DeleteJob(ctx context.Context, t Tx, jobID int64) error {
+	tx := sqlTx(t)
 	_, err := tx.ExecContext(ctx, `DELETE FROM jobs WHERE id = ?`, jobID)
 	return err
 }
+
+type PrinterJobStats struct {
+	PrinterID    int64
+	StateCounts  map[int]int
+	OldestQueued time.Time
+}
+
+func (s *Store) ListPrinterJobStats(ctx context.Context, t Tx) (map[int64]PrinterJobStats, error) {
+	tx := sqlTx(t)
+	out := map[int64]PrinterJobStats{}
+	entry := func(id int64) PrinterJobStats {
+		st, ok := out[id]
+		if !ok {
+			st = PrinterJobStats{PrinterID: id, StateCounts: map[int]int{}}
+		}
+		return st
+	}
+	rows, err := tx.QueryContext(ctx, `
+        SELECT printer_id, state, COUNT(1)
+        FROM jobs
+        WHERE state IN (3, 4, 5, 6)
+        GROUP BY printer_id, state
+    `)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var printerID int64
+		var state, count int
+		if err := rows.Scan(&printerID, &state, &count); err != nil {
+			_ = rows.Close()
+			return nil, err
+		}
+		st := entry(printerID)
+		st.StateCounts[state] = count
+		out[printerID] = st
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	// Job IDs are monotonic, so the lowest pending ID is the oldest queued job.
+	rows, err = tx.QueryContext(ctx, `
+        SELECT j.printer_id, j.submitted_at
+        FROM jobs j
+        JOIN (SELECT MIN(id) AS id FROM jobs WHERE state = 3 GROUP BY printer_id) m ON m.id = j.id
+    `)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var printerID int64
+		var submitted time.Time
+		if err := rows.Scan(&printerID, &submitted); err != nil {
+			return nil, err
+		}
+		st := entry(printerID)
+		st.OldestQueued = submitted
+		out[printerID] = st
+	}
+	return out, rows.Err()
+}
+
+// AuditFilter narrows ListAuditEntries. Zero values match everything.
+type AuditFilter struct {
+	User   string
+	Target string
+	Since  time.Time
+	Limit  int
+}
+
+// AddAuditEntry appends an administrative action to the audit trail and
+// queues a server-audit notification for interested subscriptions.
+func (s *Store) AddAuditEntry(ctx context.Context, t Tx, entry model.AuditEntry) (model.AuditEntry, error) {
+	tx := sqlTx(t)
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now().UTC()
+	}
+	entry.Operation = strings.TrimSpace(entry.Operation)
+	if entry.Operation == "" {
+		return entry, fmt.Errorf("audit entry requires an operation")
+	}
+	raw := ""
+	if len(entry.Changes) > 0 {
+		b, err := json.Marshal(entry.Changes)
+		if err != nil {
+			return entry, err
+		}
+		raw = string(b)
+	}
+	res, err := tx.ExecContext(ctx, `
+        INSERT INTO audit_log (user_name, remote_addr, operation, target, changes, created_at)
+        VALUES (?, ?, ?, ?, ?, ?)
+    `, entry.User, entry.RemoteAddr, entry.Operation, entry.Target, raw, entry.CreatedAt)
+	if err != nil {
+		return entry, err
+	}
+	entry.ID, _ = res.LastInsertId()
+	if err := s.addNotificationForServer(ctx, tx, "server-audit"); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// ListAuditEntries returns audit entries newest first.
+func (s *Store) ListAuditEntries(ctx context.Context, t Tx, filter AuditFilter) ([]model.AuditEntry, error) {
+	tx := sqlTx(t)
+	where := []string{}
+	args := []any{}
+	if u := strings.TrimSpace(filter.User); u != "" {
+		where = append(where, "user_name = ?")
+		args = append(args, u)
+	}
+	if t := strings.TrimSpace(filter.Target); t != "" {
+		where = append(where, "target = ?")
+		args = append(args, t)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	query := `SELECT id, user_name, remote_addr, operation, target, changes, created_at FROM audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []model.AuditEntry{}
+	for rows.Next() {
+		var e model.AuditEntry
+		var raw string
+		if err := rows.Scan(&e.ID, &e.User, &e.RemoteAddr, &e.Operation, &e.Target, &raw, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(raw) != "" {
+			_ = json.Unmarshal([]byte(raw), &e.Changes)
+		}
+		out = append(out, e)
+	}
+	return out, rows.Err()
+}
+
+// addNotificationForServer delivers server-wide events to every printer or
+// system subscription whose event mask includes them, as cupsd does for
+// server-* events.
+func (s *Store) addNotificationForServer(ctx context.Context, tx *sql.Tx, event string) error {
+	now := time.Now().UTC()
+	if s.MaxEvents <= 0 {
+		return nil
+	}
+	if err := s.PruneExpiredSubscriptions(ctx, sqliteTx{tx}); err != nil {
+		return err
+	}
+	rows, err := tx.QueryContext(ctx, `
+        SELECT id, events, lease_seconds, created_at
+        FROM subscriptions
+        WHERE job_id IS NULL
+    `)
+	if err != nil {
+		return err
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var events string
+		var lease int64
+		var createdAt time.Time
+		if err := rows.Scan(&id, &events, &lease, &createdAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if !subscriptionActive(createdAt, lease, now) || !eventAllowed(events, event) {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := tx.ExecContext(ctx, `
+            INSERT INTO notifications (subscription_id, event, created_at)
+            VALUES (?, ?, ?)
+        `, id, event, now); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `
+            DELETE FROM notifications
+            WHERE subscription_id = ?
+              AND id NOT IN (
+                SELECT id FROM notifications
+                WHERE subscription_id = ?
+                ORDER BY id DESC
+                LIMIT ?
+              )
+        `, id, id, s.MaxEvents); err != nil {
+			return err
+		}
+	}
+	return nil
+}
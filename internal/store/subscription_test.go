@@ -2,7 +2,6 @@ package store
 
 import (
 	"context"
-	"database/sql"
 	"path/filepath"
 	"testing"
 )
@@ -17,15 +16,15 @@ func TestCreateSubscriptionPullMethodDefaults(t *testing.T) {
 		_ = st.Close()
 	})
 
-	err = st.WithTx(ctx, false, func(tx *sql.Tx) error {
-		sub, err := st.CreateSubscription(ctx, tx, nil, nil, "job-completed", 60, "alice", "mailto:alice@example.com", "", 0, nil)
+	err = st.WithTx(ctx, false, func(tx Tx) error {
+		sub, err := st.CreateSubscription(ctx, tx, SubscriptionLimits{}, nil, nil, "job-completed", 60, "alice", "mailto:alice@example.com", "", 0, nil)
 		if err != nil {
 			return err
 		}
 		if sub.PullMethod != "" {
 			t.Fatalf("pullMethod with recipient = %q, want empty", sub.PullMethod)
 		}
-		sub2, err := st.CreateSubscription(ctx, tx, nil, nil, "job-completed", 60, "alice", "", "", 0, nil)
+		sub2, err := st.CreateSubscription(ctx, tx, SubscriptionLimits{}, nil, nil, "job-completed", 60, "alice", "", "", 0, nil)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,413 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	"cupsgolang/internal/fsutil"
+)
+
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+
+	acmeChallengePrefix = "/.well-known/acme-challenge/"
+)
+
+// ACMEConfig describes how certificates are requested from an ACME CA such
+// as Let's Encrypt (or pebble in tests).
+type ACMEConfig struct {
+	DirectoryURL string
+	Email        string
+	Domains      []string
+	// StateDir receives the account key and the issued certificate; files
+	// live under StateDir/acme.
+	StateDir string
+	// Challenge is http-01 (served by HTTPHandler) or dns-01 (via DNSHook).
+	Challenge string
+	// DNSHook is run as "hook present|cleanup <record-name> <txt-value>" for
+	// dns-01 challenges.
+	DNSHook string
+	// RenewBefore triggers renewal when the certificate expires within this
+	// window. Defaults to 30 days.
+	RenewBefore time.Duration
+	// HTTPClient is used to talk to the CA; tests point it at a CA whose
+	// root is not in the system pool.
+	HTTPClient *http.Client
+	Logger     *slog.Logger
+}
+
+// ACMEManager obtains and renews a certificate and serves it through
+// GetCertificate. It is safe for concurrent use.
+type ACMEManager struct {
+	cfg    ACMEConfig
+	client *acme.Client
+
+	mu     sync.RWMutex
+	cert   *tls.Certificate
+	leaf   *x509.Certificate
+	tokens map[string]string
+}
+
+func NewACMEManager(cfg ACMEConfig) (*ACMEManager, error) {
+	if strings.TrimSpace(cfg.DirectoryURL) == "" {
+		return nil, fmt.Errorf("acme: missing directory URL")
+	}
+	cfg.Domains = acmeDomains(cfg.Domains)
+	if len(cfg.Domains) == 0 {
+		return nil, fmt.Errorf("acme: no DNS names to request (set ServerName or ServerAlias)")
+	}
+	if strings.TrimSpace(cfg.StateDir) == "" {
+		return nil, fmt.Errorf("acme: missing state directory")
+	}
+	cfg.Challenge = strings.ToLower(strings.TrimSpace(cfg.Challenge))
+	if cfg.Challenge == "" {
+		cfg.Challenge = ChallengeHTTP01
+	}
+	if cfg.Challenge != ChallengeHTTP01 && cfg.Challenge != ChallengeDNS01 {
+		return nil, fmt.Errorf("acme: unsupported challenge %q", cfg.Challenge)
+	}
+	if cfg.Challenge == ChallengeDNS01 && strings.TrimSpace(cfg.DNSHook) == "" {
+		return nil, fmt.Errorf("acme: dns-01 requires a DNS hook command")
+	}
+	if cfg.RenewBefore <= 0 {
+		cfg.RenewBefore = 30 * 24 * time.Hour
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = slog.Default()
+	}
+	dir := filepath.Join(cfg.StateDir, "acme")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	key, err := loadOrCreateECKey(filepath.Join(dir, "account.key"))
+	if err != nil {
+		return nil, err
+	}
+	m := &ACMEManager{
+		cfg: cfg,
+		client: &acme.Client{
+			Key:          key,
+			DirectoryURL: cfg.DirectoryURL,
+			HTTPClient:   cfg.HTTPClient,
+			UserAgent:    "CUPS-Golang",
+		},
+		tokens: map[string]string{},
+	}
+	if cert, err := tls.LoadX509KeyPair(m.certPath(), m.keyPath()); err == nil {
+		m.setCertificate(&cert)
+	}
+	return m, nil
+}
+
+func (m *ACMEManager) certPath() string {
+	return filepath.Join(m.cfg.StateDir, "acme", "cert.pem")
+}
+
+func (m *ACMEManager) keyPath() string {
+	return filepath.Join(m.cfg.StateDir, "acme", "key.pem")
+}
+
+// GetCertificate returns the ACME certificate, or nil before one has been
+// issued so crypto/tls falls back to tls.Config.Certificates.
+func (m *ACMEManager) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.cert, nil
+}
+
+// HTTPHandler answers http-01 challenges and passes every other request to
+// next, so challenges can be served on the existing HTTP listener.
+func (m *ACMEManager) HTTPHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := strings.TrimPrefix(r.URL.Path, acmeChallengePrefix)
+		m.mu.RLock()
+		body, ok := m.tokens[token]
+		m.mu.RUnlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(body))
+	})
+}
+
+// NeedsRenewal reports whether there is no certificate yet, it no longer
+// covers the configured names, or it expires within RenewBefore.
+func (m *ACMEManager) NeedsRenewal(now time.Time) bool {
+	m.mu.RLock()
+	leaf := m.leaf
+	m.mu.RUnlock()
+	if leaf == nil {
+		return true
+	}
+	for _, d := range m.cfg.Domains {
+		if leaf.VerifyHostname(d) != nil {
+			return true
+		}
+	}
+	return leaf.NotAfter.Sub(now) < m.cfg.RenewBefore
+}
+
+// Run obtains a certificate when needed and then checks for renewal twice a
+// day until ctx is canceled. Failures are retried hourly.
+func (m *ACMEManager) Run(ctx context.Context) {
+	for {
+		wait := 12 * time.Hour
+		if m.NeedsRenewal(time.Now()) {
+			if err := m.Obtain(ctx); err != nil {
+				m.cfg.Logger.Error("ACME certificate request failed", "domains", strings.Join(m.cfg.Domains, ","), "err", err)
+				wait = time.Hour
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Obtain registers the account if necessary, completes an order for the
+// configured names and installs the resulting certificate.
+func (m *ACMEManager) Obtain(ctx context.Context) error {
+	acct := &acme.Account{}
+	if email := strings.TrimSpace(m.cfg.Email); email != "" {
+		acct.Contact = []string{"mailto:" + email}
+	}
+	if _, err := m.client.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("register account: %w", err)
+	}
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.cfg.Domains...))
+	if err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return fmt.Errorf("wait order: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: m.cfg.Domains[0]},
+		DNSNames: m.cfg.Domains,
+	}, key)
+	if err != nil {
+		return err
+	}
+	der, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("finalize order: %w", err)
+	}
+	if err := m.store(der, key); err != nil {
+		return err
+	}
+	m.cfg.Logger.Info("ACME certificate installed", "domains", strings.Join(m.cfg.Domains, ","))
+	return nil
+}
+
+func (m *ACMEManager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return fmt.Errorf("get authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == m.cfg.Challenge {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("%s: CA offered no %s challenge", authz.Identifier.Value, m.cfg.Challenge)
+	}
+
+	switch m.cfg.Challenge {
+	case ChallengeHTTP01:
+		body, err := m.client.HTTP01ChallengeResponse(chal.Token)
+		if err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.tokens[chal.Token] = body
+		m.mu.Unlock()
+		defer func() {
+			m.mu.Lock()
+			delete(m.tokens, chal.Token)
+			m.mu.Unlock()
+		}()
+	case ChallengeDNS01:
+		value, err := m.client.DNS01ChallengeRecord(chal.Token)
+		if err != nil {
+			return err
+		}
+		record := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+		if err := m.runDNSHook(ctx, "present", record, value); err != nil {
+			return err
+		}
+		defer func() {
+			if err := m.runDNSHook(context.Background(), "cleanup", record, value); err != nil {
+				m.cfg.Logger.Warn("ACME DNS cleanup hook failed", "record", record, "err", err)
+			}
+		}()
+	}
+
+	if _, err := m.client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("%s: accept challenge: %w", authz.Identifier.Value, err)
+	}
+	if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("%s: %w", authz.Identifier.Value, err)
+	}
+	return nil
+}
+
+func (m *ACMEManager) runDNSHook(ctx context.Context, action, record, value string) error {
+	cmd := exec.CommandContext(ctx, m.cfg.DNSHook, action, record, value)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("dns hook %s %s: %w: %s", action, record, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+func (m *ACMEManager) store(der [][]byte, key crypto.Signer) error {
+	var certPEM []byte
+	for _, b := range der {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+	if err := fsutil.WriteFile(m.keyPath(), keyPEM, 0600); err != nil {
+		return err
+	}
+	if err := fsutil.WriteFile(m.certPath(), certPEM, 0644); err != nil {
+		return err
+	}
+	m.setCertificate(&cert)
+	return nil
+}
+
+func (m *ACMEManager) setCertificate(cert *tls.Certificate) {
+	var leaf *x509.Certificate
+	if cert != nil && len(cert.Certificate) > 0 {
+		leaf, _ = x509.ParseCertificate(cert.Certificate[0])
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cert = cert
+	m.leaf = leaf
+}
+
+// acmeDomains keeps the names a public CA can validate: no IP addresses,
+// wildcards-for-all ("*"), localhost or single-label hosts.
+func acmeDomains(names []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, n := range names {
+		n = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(n), "."))
+		if n == "" || n == "*" || seen[n] || net.ParseIP(n) != nil {
+			continue
+		}
+		if n == "localhost" || strings.HasSuffix(n, ".local") || !strings.Contains(n, ".") {
+			continue
+		}
+		seen[n] = true
+		out = append(out, n)
+	}
+	// ServerName stays first since it becomes the certificate CommonName.
+	sort.Strings(out[min(1, len(out)):])
+	return out
+}
+
+func loadOrCreateECKey(path string) (*ecdsa.PrivateKey, error) {
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("acme: invalid key in %s", path)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := fsutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ACMEHTTPClient returns an HTTP client for talking to the CA. When
+// caRootsPath names a PEM bundle (pebble's test root, or a private CA) it is
+// trusted in addition to the system roots.
+func ACMEHTTPClient(caRootsPath string) (*http.Client, error) {
+	caRootsPath = strings.TrimSpace(caRootsPath)
+	if caRootsPath == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(caRootsPath)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("acme: no certificates found in %s", caRootsPath)
+	}
+	return &http.Client{
+		Timeout: 60 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+		},
+	}, nil
+}
@@ -0,0 +1,163 @@
+package tlsutil
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestACMEDomainsFiltersUnissuableNames(t *testing.T) {
+	got := acmeDomains([]string{"print.example.com", "localhost", "*", "10.0.0.1", "printer", "office.local", "b.example.com", "a.example.com", "PRINT.example.com."})
+	want := []string{"print.example.com", "a.example.com", "b.example.com"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("acmeDomains = %v, want %v", got, want)
+	}
+}
+
+func TestACMEManagerServesHTTP01Tokens(t *testing.T) {
+	m, err := NewACMEManager(ACMEConfig{
+		DirectoryURL: "https://acme.invalid/directory",
+		Domains:      []string{"print.example.com"},
+		StateDir:     t.TempDir(),
+	})
+	if err != nil {
+		t.Fatalf("NewACMEManager: %v", err)
+	}
+	m.tokens["tok"] = "tok.thumb"
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusTeapot) })
+	h := m.HTTPHandler(next)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/tok", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "tok.thumb" {
+		t.Fatalf("challenge response = %d %q", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/acme-challenge/other", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown token status = %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/printers/", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Fatalf("passthrough status = %d", rec.Code)
+	}
+}
+
+func TestACMEManagerNeedsRenewal(t *testing.T) {
+	m, err := NewACMEManager(ACMEConfig{
+		DirectoryURL: "https://acme.invalid/directory",
+		Domains:      []string{"print.example.com"},
+		StateDir:     t.TempDir(),
+		RenewBefore:  30 * 24 * time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewACMEManager: %v", err)
+	}
+	now := time.Now()
+	if !m.NeedsRenewal(now) {
+		t.Fatalf("expected renewal without a certificate")
+	}
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "print.example.com"},
+		DNSNames:     []string{"print.example.com"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(60 * 24 * time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	if err := m.store([][]byte{der}, key); err != nil {
+		t.Fatalf("store: %v", err)
+	}
+	if m.NeedsRenewal(now) {
+		t.Fatalf("fresh certificate should not need renewal")
+	}
+	if !m.NeedsRenewal(now.Add(45 * 24 * time.Hour)) {
+		t.Fatalf("certificate inside the renewal window should need renewal")
+	}
+
+	// A restarted manager picks the stored certificate back up.
+	again, err := NewACMEManager(m.cfg)
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if cert, _ := again.GetCertificate(nil); cert == nil {
+		t.Fatalf("expected stored certificate to be loaded")
+	}
+	if _, err := os.Stat(filepath.Join(m.cfg.StateDir, "acme", "account.key")); err != nil {
+		t.Fatalf("account key not persisted: %v", err)
+	}
+}
+
+// TestACMEPebble runs a full http-01 issuance against a local pebble
+// instance. Start pebble with PEBBLE_VA_NOSLEEP=1 and its http-01 port
+// pointed at CUPS_TEST_ACME_HTTP_ADDR, then set CUPS_TEST_ACME_DIRECTORY
+// (e.g. https://localhost:14000/dir) and CUPS_TEST_ACME_CA (pebble.minica.pem).
+func TestACMEPebble(t *testing.T) {
+	dirURL := os.Getenv("CUPS_TEST_ACME_DIRECTORY")
+	if dirURL == "" {
+		t.Skip("CUPS_TEST_ACME_DIRECTORY not set")
+	}
+	httpClient, err := ACMEHTTPClient(os.Getenv("CUPS_TEST_ACME_CA"))
+	if err != nil {
+		t.Fatalf("CA roots: %v", err)
+	}
+	domain := os.Getenv("CUPS_TEST_ACME_DOMAIN")
+	if domain == "" {
+		domain = "cups.example.test"
+	}
+	m, err := NewACMEManager(ACMEConfig{
+		DirectoryURL: dirURL,
+		Domains:      []string{domain},
+		StateDir:     t.TempDir(),
+		HTTPClient:   httpClient,
+	})
+	if err != nil {
+		t.Fatalf("NewACMEManager: %v", err)
+	}
+	addr := os.Getenv("CUPS_TEST_ACME_HTTP_ADDR")
+	if addr == "" {
+		addr = ":5002"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen %s: %v", addr, err)
+	}
+	srv := &http.Server{Handler: m.HTTPHandler(http.NotFoundHandler())}
+	go srv.Serve(ln)
+	t.Cleanup(func() { _ = srv.Close() })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	if err := m.Obtain(ctx); err != nil {
+		t.Fatalf("Obtain: %v", err)
+	}
+	if m.NeedsRenewal(time.Now()) {
+		t.Fatalf("issued certificate should not need renewal")
+	}
+	data, err := os.ReadFile(m.certPath())
+	if err != nil {
+		t.Fatalf("read cert: %v", err)
+	}
+	if block, _ := pem.Decode(data); block == nil {
+		t.Fatalf("stored certificate is not PEM")
+	}
+}
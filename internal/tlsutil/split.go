@@ -56,6 +56,11 @@ func (c *peekConn) Read(p []byte) (int, error) {
 	return c.reader.Read(p)
 }
 
+// NetConn returns the wrapped connection, as tls.Conn does.
+func (c *peekConn) NetConn() net.Conn {
+	return c.Conn
+}
+
 // SplitListener routes incoming connections based on TLS handshake detection.
 // It returns a plain listener and a TLS listener that can be served separately.
 func SplitListener(base net.Listener, tlsConfig *tls.Config, allowPlain bool) (net.Listener, net.Listener) {
@@ -1,8 +1,15 @@
-package main
+package cupsctl
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"path/filepath"
+	"regexp"
 	"testing"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/store"
 )
 
 func TestParseArgsSupportsShortAndLongOptions(t *testing.T) {
@@ -38,6 +45,45 @@ func TestParseArgsHelpSentinel(t *testing.T) {
 	}
 }
 
+func TestParseArgsDumpEffective(t *testing.T) {
+	opts, err := parseArgs([]string{"--dump-effective"})
+	if err != nil || !opts.dumpEffective || len(opts.updates) != 0 {
+		t.Fatalf("opts=%+v err=%v", opts, err)
+	}
+}
+
+func TestDumpEffectiveShowsSources(t *testing.T) {
+	ctx := context.Background()
+	st, err := store.Open(ctx, filepath.Join(t.TempDir(), "cups.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	defer st.Close()
+	err = st.WithTx(ctx, false, func(tx store.Tx) error {
+		return st.SetSetting(ctx, tx, "_preserve_job_history", "No")
+	})
+	if err != nil {
+		t.Fatalf("set setting: %v", err)
+	}
+
+	cfg := config.Config{Timeout: 900, KeepAlive: true, PreserveJobHistory: "Yes"}
+	var out bytes.Buffer
+	if err := dumpEffective(ctx, st, cfg, &out); err != nil {
+		t.Fatalf("dumpEffective: %v", err)
+	}
+	for _, want := range []string{
+		`(?m)^# cupsd\.conf$`,
+		`(?m)^# cups-files\.conf$`,
+		`(?m)^Timeout 900 +# default$`,
+		`(?m)^KeepAlive Yes +# default$`,
+		`(?m)^PreserveJobHistory No +# database _preserve_job_history$`,
+	} {
+		if !regexp.MustCompile(want).MatchString(out.String()) {
+			t.Errorf("missing %s in:\n%s", want, out.String())
+		}
+	}
+}
+
 func TestParseArgsRejectsUnknownInputs(t *testing.T) {
 	if _, err := parseArgs([]string{"--unknown-option"}); err == nil {
 		t.Fatalf("expected unknown long option error")
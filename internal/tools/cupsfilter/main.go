@@ -0,0 +1,410 @@
+package cupsfilter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/scheduler"
+	"cupsgolang/internal/store"
+)
+
+var errShowHelp = errors.New("show-help")
+
+type options struct {
+	file        string
+	listFilters bool
+	removeInput bool
+	ppdFile     string
+	printer     string
+	jobID       int64
+	docNum      int
+	user        string
+	inputType   string
+	outputType  string
+	title       string
+	jobOptions  map[string]string
+}
+
+// Main runs cupsfilter with os.Args.
+func Main() {
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, errShowHelp) {
+		usage()
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "cupsfilter:", err)
+		usage()
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, config.Load(), opts, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "cupsfilter:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: cupsfilter [ options ] [ -- ] filename")
+	fmt.Println("Options:")
+	fmt.Println("--list-filters          List filters that will be used")
+	fmt.Println("-D                      Remove the input file when finished")
+	fmt.Println("-P filename.ppd         Set PPD file")
+	fmt.Println("-U username             Specify username")
+	fmt.Println("-d printer              Use the named printer")
+	fmt.Println("-i mime/type            Set input MIME type (otherwise auto-typed)")
+	fmt.Println("-j job-id[,N]           Filter file N from the specified job (default is file 1)")
+	fmt.Println("-m mime/type            Set output MIME type (otherwise application/pdf,")
+	fmt.Println("                        or the printer's types with -d, -p or -j)")
+	fmt.Println("-n copies               Set number of copies")
+	fmt.Println("-o name=value           Set option(s)")
+	fmt.Println("-p filename.ppd         Set PPD file")
+	fmt.Println("-t title                Set title")
+}
+
+func parseArgs(args []string) (options, error) {
+	opts := options{jobOptions: map[string]string{}}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--help":
+			return opts, errShowHelp
+		case arg == "--list-filters":
+			opts.listFilters = true
+			continue
+		case arg == "--":
+			if i+1 < len(args) {
+				if opts.file != "" || i+2 < len(args) {
+					return opts, errors.New("only one file can be filtered")
+				}
+				opts.file = args[i+1]
+			}
+			i = len(args)
+			continue
+		case strings.HasPrefix(arg, "--"):
+			return opts, fmt.Errorf("unknown option %q", arg)
+		case !strings.HasPrefix(arg, "-") || arg == "-":
+			if opts.file != "" {
+				return opts, errors.New("only one file can be filtered")
+			}
+			opts.file = arg
+			continue
+		}
+		short := arg[1:]
+		for pos := 0; pos < len(short); pos++ {
+			ch := short[pos]
+			rest := short[pos+1:]
+			consume := func() (string, error) {
+				if rest != "" {
+					pos = len(short)
+					return rest, nil
+				}
+				if i+1 >= len(args) {
+					return "", fmt.Errorf("missing argument for -%c", ch)
+				}
+				i++
+				return args[i], nil
+			}
+			if ch == 'D' {
+				opts.removeInput = true
+				continue
+			}
+			v, err := consume()
+			if err != nil {
+				return opts, err
+			}
+			switch ch {
+			case 'P', 'p':
+				opts.ppdFile = v
+			case 'U':
+				opts.user = v
+			case 'd':
+				opts.printer = v
+			case 'i':
+				opts.inputType = strings.ToLower(v)
+			case 'm':
+				opts.outputType = strings.ToLower(v)
+			case 't':
+				opts.title = v
+			case 'n':
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					return opts, fmt.Errorf("bad copies %q", v)
+				}
+				opts.jobOptions["copies"] = strconv.Itoa(n)
+			case 'o':
+				for _, opt := range splitOptions(v) {
+					name, value, ok := strings.Cut(opt, "=")
+					if !ok {
+						value = "true"
+						if strings.HasPrefix(name, "no") && len(name) > 2 {
+							name, value = name[2:], "false"
+						}
+					}
+					opts.jobOptions[name] = value
+				}
+			case 'j':
+				idText, numText, hasNum := strings.Cut(v, ",")
+				id, err := strconv.ParseInt(idText, 10, 64)
+				if err != nil || id < 1 {
+					return opts, fmt.Errorf("bad job ID %q", v)
+				}
+				opts.jobID, opts.docNum = id, 1
+				if hasNum {
+					if opts.docNum, err = strconv.Atoi(numText); err != nil || opts.docNum < 1 {
+						return opts, fmt.Errorf("bad document number %q", v)
+					}
+				}
+			default:
+				return opts, fmt.Errorf("unknown option \"-%c\"", ch)
+			}
+		}
+	}
+	if opts.file == "" && opts.jobID == 0 {
+		return opts, errors.New("no file to filter")
+	}
+	if opts.file != "" && opts.jobID != 0 {
+		return opts, errors.New("-j cannot be combined with a file")
+	}
+	if opts.ppdFile != "" && (opts.printer != "" || opts.jobID != 0) {
+		return opts, errors.New("-p cannot be combined with -d or -j")
+	}
+	return opts, nil
+}
+
+// splitOptions splits an -o argument on spaces outside quotes, as lp does.
+func splitOptions(v string) []string {
+	var out []string
+	var cur strings.Builder
+	var quote rune
+	for _, r := range v {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				cur.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case r == ' ' || r == '\t':
+			if cur.Len() > 0 {
+				out = append(out, cur.String())
+				cur.Reset()
+			}
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if cur.Len() > 0 {
+		out = append(out, cur.String())
+	}
+	return out
+}
+
+// run builds the job, printer and document the scheduler would see, then
+// lists or runs the filter chain it would choose.
+func run(ctx context.Context, cfg config.Config, opts options, stdout, stderr io.Writer) error {
+	mime, err := config.LoadMimeDB(cfg.ConfDir)
+	if err != nil {
+		return fmt.Errorf("load MIME database: %w", err)
+	}
+
+	job := model.Job{ID: 1, Name: opts.title, UserName: opts.user}
+	printer := model.Printer{Name: "cupsfilter"}
+	doc := model.Document{}
+	if opts.printer != "" || opts.jobID != 0 {
+		if err := loadFromStore(ctx, cfg, opts, &job, &printer, &doc); err != nil {
+			return err
+		}
+	}
+	if opts.file != "" {
+		path := opts.file
+		if path == "-" {
+			tmp, err := spoolStdin()
+			if err != nil {
+				return err
+			}
+			defer os.Remove(tmp)
+			path = tmp
+		}
+		doc = model.Document{FileName: filepath.Base(opts.file), Path: path}
+	}
+	if job.UserName == "" {
+		job.UserName = currentUser()
+	}
+	if job.Name == "" {
+		job.Name = doc.FileName
+	}
+	if len(opts.jobOptions) > 0 {
+		merged := map[string]string{}
+		if job.Options != "" {
+			_ = json.Unmarshal([]byte(job.Options), &merged)
+		}
+		for k, v := range opts.jobOptions {
+			merged[k] = v
+		}
+		data, _ := json.Marshal(merged)
+		job.Options = string(data)
+	}
+
+	switch {
+	case opts.ppdFile != "":
+		// The scheduler finds a printer's PPD by name in PPDDir.
+		abs, err := filepath.Abs(opts.ppdFile)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(abs); err != nil {
+			return err
+		}
+		cfg.PPDDir, printer.PPDName = filepath.Dir(abs), filepath.Base(abs)
+	case opts.printer == "" && opts.jobID == 0:
+		// No printer: do not pick up the default PPD.
+		cfg.PPDDir, printer.PPDName = "", ""
+	}
+
+	if opts.inputType != "" {
+		doc.MimeType = opts.inputType
+	} else if doc.MimeType == "" || doc.MimeType == "application/octet-stream" {
+		doc.MimeType = autoType(mime, doc)
+	}
+	dest := opts.outputType
+	if dest == "" && opts.ppdFile == "" && opts.printer == "" && opts.jobID == 0 {
+		dest = "application/pdf"
+	}
+
+	plan := scheduler.PlanFilters(mime, cfg, job, printer, doc, dest)
+	if len(plan.Convs) == 0 && dest != "" && dest != plan.Source {
+		return fmt.Errorf("no filters to convert from %s to %s", plan.Source, dest)
+	}
+	if opts.listFilters {
+		writePlan(stdout, plan)
+		return nil
+	}
+	err = scheduler.RunFilters(ctx, cfg, plan, job, printer, doc, stdout, stderr)
+	if opts.removeInput && opts.file != "" && opts.file != "-" {
+		if rmErr := os.Remove(opts.file); rmErr != nil && err == nil {
+			err = rmErr
+		}
+	}
+	return err
+}
+
+// loadFromStore fills in the printer of -d, or the job, printer and
+// document of -j, from the scheduler database.
+func loadFromStore(ctx context.Context, cfg config.Config, opts options, job *model.Job, printer *model.Printer, doc *model.Document) error {
+	st, err := store.Open(ctx, cfg.DBPath)
+	if err != nil {
+		return err
+	}
+	defer st.Close()
+	return st.WithTx(ctx, true, func(tx store.Tx) error {
+		if opts.jobID != 0 {
+			stored, err := st.GetJob(ctx, tx, opts.jobID)
+			if err != nil {
+				return fmt.Errorf("job %d: %w", opts.jobID, err)
+			}
+			docs, err := st.ListDocumentsByJob(ctx, tx, stored.ID)
+			if err != nil {
+				return err
+			}
+			if opts.docNum > len(docs) {
+				return fmt.Errorf("job %d has %d document(s)", opts.jobID, len(docs))
+			}
+			*doc = docs[opts.docNum-1]
+			if job.Name == "" {
+				job.Name = stored.Name
+			}
+			if job.UserName == "" {
+				job.UserName = stored.UserName
+			}
+			job.ID, job.Options = stored.ID, stored.Options
+			if opts.printer == "" {
+				p, err := st.GetPrinterByID(ctx, tx, stored.PrinterID)
+				if err != nil {
+					return fmt.Errorf("printer of job %d: %w", opts.jobID, err)
+				}
+				*printer = p
+			}
+		}
+		if opts.printer != "" {
+			p, err := st.GetPrinterByName(ctx, tx, opts.printer)
+			if err != nil {
+				return fmt.Errorf("printer %q: %w", opts.printer, err)
+			}
+			*printer = p
+		}
+		return nil
+	})
+}
+
+// autoType types a document by its extension in the MIME database, then by
+// sniffing its content.
+func autoType(mime *config.MimeDB, doc model.Document) string {
+	if ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(doc.FileName)), "."); ext != "" {
+		if mt := mime.TypeForExtension(ext); mt != "" {
+			return mt
+		}
+	}
+	f, err := os.Open(doc.Path)
+	if err != nil {
+		return "application/octet-stream"
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	sniffed, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	if _, ok := mime.Types[sniffed]; ok {
+		return sniffed
+	}
+	return "application/octet-stream"
+}
+
+func spoolStdin() (string, error) {
+	f, err := os.CreateTemp("", "cupsfilter")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, os.Stdin); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+func currentUser() string {
+	for _, key := range []string{"USER", "LOGNAME", "USERNAME"} {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+	}
+	return "anonymous"
+}
+
+// writePlan prints the chain one conversion per line with its cost, then
+// the total, so unprintable documents can be traced to a missing filter.
+func writePlan(w io.Writer, plan scheduler.FilterPlan) {
+	if len(plan.Convs) == 0 {
+		fmt.Fprintf(w, "%s: no filters, sent as is\n", plan.Source)
+		return
+	}
+	for _, conv := range plan.Convs {
+		fmt.Fprintf(w, "%s -> %s\t%d\t%s\n", conv.Source, conv.Dest, conv.Cost, conv.Program)
+	}
+	fmt.Fprintf(w, "total cost %d, final type %s\n", plan.Cost(), plan.Final)
+}
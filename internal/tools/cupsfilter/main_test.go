@@ -0,0 +1,92 @@
+package cupsfilter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cupsgolang/internal/config"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"--list-filters", "-m", "Application/PDF", "-o", "media=a4 nocollate", "-n", "2", "-Ubob", "-t", "Report", "in.txt"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if !opts.listFilters || opts.outputType != "application/pdf" || opts.user != "bob" || opts.title != "Report" || opts.file != "in.txt" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if opts.jobOptions["media"] != "a4" || opts.jobOptions["collate"] != "false" || opts.jobOptions["copies"] != "2" {
+		t.Fatalf("unexpected job options: %+v", opts.jobOptions)
+	}
+	opts, err = parseArgs([]string{"-j", "12,3"})
+	if err != nil || opts.jobID != 12 || opts.docNum != 3 {
+		t.Fatalf("-j: %+v %v", opts, err)
+	}
+	if _, err := parseArgs([]string{"--help"}); !errors.Is(err, errShowHelp) {
+		t.Fatalf("expected errShowHelp, got %v", err)
+	}
+	for _, bad := range [][]string{
+		nil,
+		{"a", "b"},
+		{"-j", "1", "a"},
+		{"-p", "x.ppd", "-d", "Office", "a"},
+		{"-n", "0", "a"},
+		{"-m"},
+		{"-z", "a"},
+	} {
+		if _, err := parseArgs(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestListAndRunFilters(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	dir := t.TempDir()
+	filter := filepath.Join(dir, "shout")
+	script := "#!/bin/sh\nprintf '%s:%s:' \"$2\" \"$5\"\ntr a-z A-Z < \"${6:-/dev/stdin}\"\n"
+	if err := os.WriteFile(filter, []byte(script), 0o755); err != nil {
+		t.Fatalf("write filter: %v", err)
+	}
+	confDir := filepath.Join(dir, "conf")
+	os.MkdirAll(confDir, 0o755)
+	os.WriteFile(filepath.Join(confDir, "local.types"), []byte("application/vnd.shout\n"), 0o644)
+	os.WriteFile(filepath.Join(confDir, "local.convs"), []byte("text/plain application/vnd.shout 15 "+filter+"\n"), 0o644)
+	in := filepath.Join(dir, "note.txt")
+	os.WriteFile(in, []byte("hello"), 0o644)
+	cfg := config.Config{ConfDir: confDir}
+
+	opts, err := parseArgs([]string{"--list-filters", "-m", "application/vnd.shout", in})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	var out bytes.Buffer
+	if err := run(context.Background(), cfg, opts, &out, os.Stderr); err != nil {
+		t.Fatalf("--list-filters: %v", err)
+	}
+	if got := out.String(); !strings.Contains(got, "text/plain -> application/vnd.shout\t15\t"+filter) || !strings.Contains(got, "total cost 15") {
+		t.Fatalf("--list-filters output %q", got)
+	}
+
+	opts, _ = parseArgs([]string{"-m", "application/vnd.shout", "-U", "alice", "-n", "3", in})
+	out.Reset()
+	if err := run(context.Background(), cfg, opts, &out, os.Stderr); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if got := out.String(); !strings.HasPrefix(got, "alice:") || !strings.HasSuffix(got, ":HELLO") || !strings.Contains(got, "copies=3") {
+		t.Fatalf("filter output %q", got)
+	}
+
+	opts, _ = parseArgs([]string{"-m", "image/x-nothing", in})
+	if err := run(context.Background(), cfg, opts, &out, os.Stderr); err == nil || !strings.Contains(err.Error(), "no filters") {
+		t.Fatalf("expected a missing-chain error, got %v", err)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package cupsreject
 
 import (
 	"errors"
@@ -0,0 +1,514 @@
+package cupstop
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cupsgolang/pkg/cups"
+)
+
+var errShowHelp = errors.New("show-help")
+
+type options struct {
+	server   string
+	encrypt  bool
+	authUser string
+	// dests limits the view to these printers and their jobs.
+	dests []string
+	which cups.WhichJobs
+	// interval is the polling period used only when the scheduler refuses
+	// the subscription.
+	interval time.Duration
+}
+
+// followEvents are the notify-events of the subscription that drives
+// refreshes.
+var followEvents = []string{
+	"printer-added", "printer-deleted", "printer-modified", "printer-state-changed",
+	"job-created", "job-state-changed", "job-completed", "job-progress", "job-config-changed",
+}
+
+// Main runs cupstop with os.Args.
+func Main() {
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, errShowHelp) {
+		usage()
+		return
+	}
+	if err != nil {
+		fail(err)
+	}
+	client := cups.New(
+		cups.WithServer(opts.server),
+		cups.WithTLS(opts.encrypt),
+		cups.WithUser(opts.authUser),
+	)
+	if err := run(client, opts); err != nil {
+		fail(err)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: cupstop [options] [destination(s)]")
+	fmt.Println("Options:")
+	fmt.Println("-E                      Encrypt the connection to the server")
+	fmt.Println("-h server[:port]        Connect to the named server and port")
+	fmt.Println("-U username             Specify the username to use for authentication")
+	fmt.Println("-W which-jobs           Show not-completed (default), completed or all jobs")
+	fmt.Println("-i seconds              Poll interval when live updates are unavailable (default 5)")
+	fmt.Println()
+	fmt.Println("Keys:")
+	for _, line := range helpLines {
+		fmt.Println(line)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, "cupstop:", err)
+	os.Exit(1)
+}
+
+func parseArgs(args []string) (options, error) {
+	opts := options{which: cups.NotCompletedJobs, interval: 5 * time.Second}
+	for i := 0; i < len(args); i++ {
+		arg := strings.TrimSpace(args[i])
+		if arg == "" {
+			continue
+		}
+		if arg == "--help" {
+			return opts, errShowHelp
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			opts.dests = append(opts.dests, arg)
+			continue
+		}
+		value := func(name string) (string, error) {
+			if len(arg) > 2 {
+				return arg[2:], nil
+			}
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("missing argument for %s", name)
+			}
+			i++
+			return args[i], nil
+		}
+		switch arg[:2] {
+		case "-E":
+			opts.encrypt = true
+		case "-h":
+			v, err := value("-h")
+			if err != nil {
+				return opts, err
+			}
+			opts.server = v
+		case "-U":
+			v, err := value("-U")
+			if err != nil {
+				return opts, err
+			}
+			opts.authUser = v
+		case "-W":
+			v, err := value("-W")
+			if err != nil {
+				return opts, err
+			}
+			switch cups.WhichJobs(v) {
+			case cups.NotCompletedJobs, cups.CompletedJobs, cups.AllJobs:
+				opts.which = cups.WhichJobs(v)
+			default:
+				return opts, fmt.Errorf("bad which-jobs value %q", v)
+			}
+		case "-i":
+			v, err := value("-i")
+			if err != nil {
+				return opts, err
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return opts, fmt.Errorf("bad interval %q", v)
+			}
+			opts.interval = time.Duration(n) * time.Second
+		default:
+			return opts, fmt.Errorf("unknown option %q", arg)
+		}
+	}
+	return opts, nil
+}
+
+const (
+	panePrinters = iota
+	paneJobs
+)
+
+// prompt is a one-line question at the bottom of the screen.
+type prompt struct {
+	label  string
+	input  string
+	submit func(answer string)
+}
+
+// app is the monitor state. Only the run loop touches it.
+type app struct {
+	client *cups.Client
+	opts   options
+
+	printers []*cups.Destination
+	jobs     []*cups.Job
+	updated  time.Time
+
+	pane       int
+	selPrinter int
+	selJob     int
+	showHelp   bool
+	prompt     *prompt
+	// status is the result of the last action or refresh error.
+	status string
+	// live is true while the subscription delivers events.
+	live bool
+	quit bool
+}
+
+func run(client *cups.Client, opts options) error {
+	term, err := openTerminal()
+	if err != nil {
+		return err
+	}
+	defer term.restore()
+
+	a := &app{client: client, opts: opts, pane: paneJobs}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- append([]byte(nil), buf[:n]...)
+		}
+	}()
+	changed := make(chan struct{}, 1)
+	followErr := make(chan error, 1)
+	go func() { followErr <- follow(ctx, client, changed) }()
+	a.live = true
+
+	a.refresh(ctx)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for !a.quit {
+		width, height := term.size()
+		term.draw(render(a, width, height, time.Now()))
+		select {
+		case data, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			for _, k := range parseKeys(data) {
+				a.handleKey(ctx, k)
+			}
+		case <-changed:
+			a.refresh(ctx)
+		case err := <-followErr:
+			a.live = false
+			if err != nil {
+				a.status = fmt.Sprintf("live updates unavailable (%v); polling every %s", err, opts.interval)
+			}
+		case now := <-ticker.C:
+			// The tick redraws for the clock and terminal resizes; it only
+			// reaches the scheduler when there is no subscription.
+			if !a.live && now.Sub(a.updated) >= opts.interval {
+				a.refresh(ctx)
+			}
+		}
+	}
+	return nil
+}
+
+// follow keeps a server-wide ippget subscription and signals changed for
+// every event until ctx ends or the scheduler refuses it.
+func follow(ctx context.Context, client *cups.Client, changed chan<- struct{}) error {
+	sub, err := client.CreatePrinterSubscription(ctx, "", cups.SubscriptionRequest{Events: followEvents})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		cleanup, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		_ = client.CancelSubscription(cleanup, sub.ID)
+	}()
+	err = client.Watch(ctx, []int{sub.ID}, func(cups.Event) error {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil
+	}
+	if err == nil {
+		err = errors.New("subscription ended")
+	}
+	return err
+}
+
+func (a *app) refresh(ctx context.Context) {
+	dests, err := a.client.Destinations(ctx)
+	if err != nil {
+		a.status = err.Error()
+		return
+	}
+	a.printers = a.printers[:0]
+	for _, d := range dests {
+		if d.Instance == "" && a.wanted(d.Name) {
+			a.printers = append(a.printers, d)
+		}
+	}
+	jobs, err := a.client.Jobs(ctx, "", a.opts.which, false)
+	if err != nil {
+		a.status = err.Error()
+		return
+	}
+	a.jobs = a.jobs[:0]
+	for _, j := range jobs {
+		if a.wanted(j.Destination) {
+			a.jobs = append(a.jobs, j)
+		}
+	}
+	a.updated = time.Now()
+	a.selPrinter = clamp(a.selPrinter, len(a.printers))
+	a.selJob = clamp(a.selJob, len(a.jobs))
+}
+
+func (a *app) wanted(name string) bool {
+	if len(a.opts.dests) == 0 {
+		return true
+	}
+	for _, d := range a.opts.dests {
+		if strings.EqualFold(d, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func clamp(i, n int) int {
+	if i >= n {
+		i = n - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+func (a *app) selectedJob() *cups.Job {
+	if a.selJob < len(a.jobs) {
+		return a.jobs[a.selJob]
+	}
+	return nil
+}
+
+func (a *app) selectedPrinter() *cups.Destination {
+	if a.selPrinter < len(a.printers) {
+		return a.printers[a.selPrinter]
+	}
+	return nil
+}
+
+var helpLines = []string{
+	"  Tab, Left, Right  Switch between the printer and job lists",
+	"  Up/k, Down/j      Select",
+	"  c                 Cancel the job (asks first)",
+	"  h / r             Hold / release the job",
+	"  R                 Restart the job",
+	"  m                 Move the job to another destination",
+	"  e / d             Enable / disable the printer",
+	"  a / x             Accept / reject jobs on the printer",
+	"  g                 Refresh now",
+	"  ?                 Show or hide this help",
+	"  q                 Quit",
+}
+
+func (a *app) handleKey(ctx context.Context, k string) {
+	if a.prompt != nil {
+		a.promptKey(k)
+		return
+	}
+	switch k {
+	case "q", "ctrl-c":
+		a.quit = true
+	case "?":
+		a.showHelp = !a.showHelp
+	case "esc":
+		a.showHelp = false
+	case "tab", "left", "right":
+		a.pane = 1 - a.pane
+	case "up", "k":
+		a.move(-1)
+	case "down", "j":
+		a.move(1)
+	case "g":
+		a.refresh(ctx)
+	case "c", "h", "r", "R", "m":
+		a.jobAction(ctx, k)
+	case "e", "d", "a", "x":
+		a.printerAction(ctx, k)
+	}
+}
+
+func (a *app) move(delta int) {
+	if a.pane == panePrinters {
+		a.selPrinter = clamp(a.selPrinter+delta, len(a.printers))
+	} else {
+		a.selJob = clamp(a.selJob+delta, len(a.jobs))
+	}
+}
+
+func (a *app) promptKey(k string) {
+	p := a.prompt
+	switch k {
+	case "esc", "ctrl-c":
+		a.prompt = nil
+		a.status = ""
+	case "enter":
+		a.prompt = nil
+		p.submit(strings.TrimSpace(p.input))
+	case "backspace":
+		if r := []rune(p.input); len(r) > 0 {
+			p.input = string(r[:len(r)-1])
+		}
+	default:
+		if len([]rune(k)) == 1 {
+			p.input += k
+		}
+	}
+}
+
+// jobAction sends what cancel, lp -i -H and lpmove send for the selected
+// job.
+func (a *app) jobAction(ctx context.Context, k string) {
+	job := a.selectedJob()
+	if job == nil {
+		a.status = "no job selected"
+		return
+	}
+	done := func(what string, err error) {
+		if err != nil {
+			a.status = fmt.Sprintf("job %d: %v", job.ID, err)
+			return
+		}
+		a.status = fmt.Sprintf("job %d %s", job.ID, what)
+		if !a.live {
+			a.refresh(ctx)
+		}
+	}
+	switch k {
+	case "c":
+		a.prompt = &prompt{label: fmt.Sprintf("Cancel job %d (%s)? [y/N] ", job.ID, job.Name), submit: func(answer string) {
+			if strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes") {
+				done("canceled", a.client.CancelJob(ctx, job.ID, false))
+			}
+		}}
+	case "h":
+		done("held", a.client.HoldJob(ctx, job.ID, "indefinite"))
+	case "r":
+		done("released", a.client.ReleaseJob(ctx, job.ID))
+	case "R":
+		done("restarted", a.client.RestartJob(ctx, job.ID))
+	case "m":
+		a.prompt = &prompt{label: fmt.Sprintf("Move job %d to: ", job.ID), submit: func(dest string) {
+			if dest != "" {
+				done("moved to "+dest, a.client.MoveJob(ctx, job.ID, dest))
+			}
+		}}
+	}
+}
+
+// printerAction sends what cupsenable, cupsdisable, cupsaccept and
+// cupsreject send for the selected printer.
+func (a *app) printerAction(ctx context.Context, k string) {
+	p := a.selectedPrinter()
+	if p == nil {
+		a.status = "no printer selected"
+		return
+	}
+	done := func(what string, err error) {
+		if err != nil {
+			a.status = fmt.Sprintf("%s: %v", p.Name, err)
+			return
+		}
+		a.status = fmt.Sprintf("%s %s", p.Name, what)
+		if !a.live {
+			a.refresh(ctx)
+		}
+	}
+	switch k {
+	case "e":
+		done("enabled", a.client.ResumePrinter(ctx, p.Name))
+	case "a":
+		done("accepting jobs", a.client.AcceptJobs(ctx, p.Name))
+	case "d":
+		a.prompt = &prompt{label: fmt.Sprintf("Disable %s, reason (optional): ", p.Name), submit: func(reason string) {
+			done("disabled", a.client.PausePrinter(ctx, p.Name, reason))
+		}}
+	case "x":
+		a.prompt = &prompt{label: fmt.Sprintf("Reject jobs on %s, reason (optional): ", p.Name), submit: func(reason string) {
+			done("rejecting jobs", a.client.RejectJobs(ctx, p.Name, reason))
+		}}
+	}
+}
+
+// parseKeys splits terminal input into key names: printable characters as
+// themselves and named keys such as "up", "enter" or "ctrl-c".
+func parseKeys(data []byte) []string {
+	var keys []string
+	s := string(data)
+	for len(s) > 0 {
+		if strings.HasPrefix(s, "\x1b[") || strings.HasPrefix(s, "\x1bO") {
+			if len(s) >= 3 {
+				name := map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left"}[s[2]]
+				if name != "" {
+					keys = append(keys, name)
+					s = s[3:]
+					continue
+				}
+			}
+			// Skip other sequences up to their final byte.
+			end := 2
+			for end < len(s) && (s[end] < 0x40 || s[end] > 0x7e) {
+				end++
+			}
+			s = s[min(end+1, len(s)):]
+			continue
+		}
+		r := []rune(s)[0]
+		s = s[len(string(r)):]
+		switch r {
+		case 0x1b:
+			keys = append(keys, "esc")
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case '\t':
+			keys = append(keys, "tab")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl-c")
+		default:
+			if r >= 0x20 {
+				keys = append(keys, string(r))
+			}
+		}
+	}
+	return keys
+}
@@ -0,0 +1,222 @@
+package cupstop
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/pkg/cups"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-E", "-hlocalhost:8631", "-U", "alice", "-Wall", "-i", "2", "Office", "Lab"})
+	if err != nil {
+		t.Fatalf("parseArgs error: %v", err)
+	}
+	if !opts.encrypt || opts.server != "localhost:8631" || opts.authUser != "alice" {
+		t.Fatalf("unexpected connection options: %+v", opts)
+	}
+	if opts.which != cups.AllJobs || opts.interval != 2*time.Second {
+		t.Fatalf("which/interval = %q/%s", opts.which, opts.interval)
+	}
+	if len(opts.dests) != 2 || opts.dests[0] != "Office" || opts.dests[1] != "Lab" {
+		t.Fatalf("unexpected destinations: %v", opts.dests)
+	}
+	if _, err := parseArgs([]string{"--help"}); !errors.Is(err, errShowHelp) {
+		t.Fatalf("expected errShowHelp, got %v", err)
+	}
+	for _, bad := range [][]string{{"-W", "some"}, {"-i", "0"}, {"-h"}, {"-z"}} {
+		if _, err := parseArgs(bad); err == nil {
+			t.Fatalf("parseArgs(%v) succeeded", bad)
+		}
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	got := parseKeys([]byte("j\x1b[A\x1b[B\tR\r\x7f\x03\x1b\x1b[5~q"))
+	want := []string{"j", "up", "down", "tab", "R", "enter", "backspace", "ctrl-c", "esc", "q"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("parseKeys = %q, want %q", got, want)
+	}
+}
+
+func testApp() *app {
+	office := &cups.Destination{
+		Name: "Office", IsDefault: true, State: cups.PrinterStopped, Accepting: false,
+		StateReasons: []string{"paused", "toner-low-warning"}, StateMessage: "Paper jam",
+		Attributes: goipp.Attributes{
+			goipp.MakeAttr("marker-names", goipp.TagName, goipp.String("Black"), goipp.String("Cyan")),
+			goipp.MakeAttr("marker-levels", goipp.TagInteger, goipp.Integer(50), goipp.Integer(-1)),
+		},
+	}
+	lab := &cups.Destination{Name: "Lab", State: cups.PrinterIdle, Accepting: true, StateReasons: []string{"none"}}
+	return &app{
+		opts:     options{interval: 5 * time.Second},
+		printers: []*cups.Destination{office, lab},
+		jobs: []*cups.Job{
+			{ID: 7, Destination: "Office", User: "alice", State: cups.JobHeld, SizeKB: 12, Name: "report.pdf"},
+			{ID: 8, Destination: "Lab", User: "bob", State: cups.JobPending, SizeKB: 3, Name: "notes.txt"},
+		},
+		pane:   paneJobs,
+		selJob: 1,
+		live:   true,
+	}
+}
+
+func TestRender(t *testing.T) {
+	a := testApp()
+	lines := render(a, 100, 20, time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC))
+	if len(lines) != 20 {
+		t.Fatalf("render returned %d lines, want 20", len(lines))
+	}
+	screen := strings.Join(lines, "\n")
+	for _, want := range []string{
+		"2 printers, 2 jobs  [live]", "15:04:05",
+		"Office*", "stopped", "paused,toner-low - Paper jam",
+		"Black            [##########----------]  50%", "Cyan             [????????????????????]  unknown",
+		"report.pdf", "held",
+	} {
+		if !strings.Contains(screen, want) {
+			t.Fatalf("screen lacks %q:\n%s", want, screen)
+		}
+	}
+	if !strings.HasPrefix(findLine(lines, "notes.txt"), styleReverse) || strings.HasPrefix(findLine(lines, "report.pdf"), styleReverse) {
+		t.Fatalf("selected job is not highlighted:\n%s", screen)
+	}
+	for _, l := range lines {
+		if plain := strings.NewReplacer(styleReverse, "", styleBold, "", styleReset, "").Replace(l); len([]rune(plain)) > 100 {
+			t.Fatalf("line wider than the terminal: %q", plain)
+		}
+	}
+
+	a.live = false
+	a.prompt = &prompt{label: "Move job 8 to: ", input: "Off"}
+	lines = render(a, 100, 20, time.Now())
+	if !strings.Contains(lines[0], "polling every 5s") || !strings.HasPrefix(lines[len(lines)-1], "Move job 8 to: Off") {
+		t.Fatalf("unexpected header/footer: %q / %q", lines[0], lines[len(lines)-1])
+	}
+}
+
+func TestRenderScrollsToSelection(t *testing.T) {
+	a := testApp()
+	for i := 0; i < 40; i++ {
+		a.jobs = append(a.jobs, &cups.Job{ID: 100 + i, Destination: "Lab", Name: "bulk"})
+	}
+	a.selJob = len(a.jobs) - 1
+	lines := render(a, 80, 15, time.Now())
+	if findLine(lines, "139 ") == "" {
+		t.Fatalf("selected last job is not on screen:\n%s", strings.Join(lines, "\n"))
+	}
+	if findLine(lines, "Office") == "" {
+		t.Fatal("printers scrolled off by the job list")
+	}
+}
+
+func findLine(lines []string, substr string) string {
+	for _, l := range lines {
+		if strings.Contains(l, substr) {
+			return l
+		}
+	}
+	return ""
+}
+
+// recorder is a scheduler that accepts every request and keeps it.
+type recorder struct {
+	mu       sync.Mutex
+	requests []*goipp.Message
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &goipp.Message{}
+	if err := req.Decode(r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rec.mu.Lock()
+	rec.requests = append(rec.requests, req)
+	rec.mu.Unlock()
+	resp := goipp.NewResponse(goipp.DefaultVersion, goipp.StatusOk, req.RequestID)
+	data, _ := resp.EncodeBytes()
+	w.Header().Set("Content-Type", goipp.ContentType)
+	w.Write(data)
+}
+
+func (rec *recorder) last() *goipp.Message {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.requests) == 0 {
+		return nil
+	}
+	return rec.requests[len(rec.requests)-1]
+}
+
+func TestKeysSendCommandOperations(t *testing.T) {
+	t.Setenv("CUPS_CLIENT_CONF_DIR", t.TempDir())
+	t.Setenv("CUPS_USER_CONF_DIR", t.TempDir())
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	a := testApp()
+	a.client = cups.New(cups.WithServer(strings.TrimPrefix(srv.URL, "http://")), cups.WithUser("alice"), cups.WithLpOptions())
+	ctx := context.Background()
+	type check struct {
+		keys  string
+		op    goipp.Op
+		group func(*goipp.Message) goipp.Attributes
+		attr  string
+		value string
+	}
+	op := func(m *goipp.Message) goipp.Attributes { return m.Operation }
+	job := func(m *goipp.Message) goipp.Attributes { return m.Job }
+	for _, c := range []check{
+		{"cy\r", goipp.OpCancelJob, op, "job-uri", "ipp://localhost/jobs/8"},
+		{"h", goipp.OpHoldJob, op, "job-hold-until", "indefinite"},
+		{"r", goipp.OpReleaseJob, op, "job-uri", "ipp://localhost/jobs/8"},
+		{"R", goipp.OpRestartJob, op, "job-uri", "ipp://localhost/jobs/8"},
+		{"mOffice\r", goipp.OpCupsMoveJob, job, "job-printer-uri", "ipp://localhost/printers/Office"},
+		{"\tke", goipp.OpResumePrinter, op, "printer-uri", "ipp://localhost/printers/Office"},
+		{"dOut of paper\r", goipp.OpPausePrinter, op, "printer-state-message", "Out of paper"},
+		{"a", goipp.OpCupsAcceptJobs, op, "printer-uri", "ipp://localhost/printers/Office"},
+		{"xBroken\r", goipp.OpCupsRejectJobs, op, "printer-state-message", "Broken"},
+	} {
+		before := len(rec.requests)
+		for _, k := range parseKeys([]byte(c.keys)) {
+			a.handleKey(ctx, k)
+		}
+		req := rec.last()
+		if len(rec.requests) != before+1 || goipp.Op(req.Code) != c.op {
+			t.Fatalf("keys %q sent %d requests, last %v; want one %s (status %q)", c.keys, len(rec.requests)-before, req, c.op, a.status)
+		}
+		if got := attrValue(c.group(req), c.attr); got != c.value {
+			t.Fatalf("keys %q: %s = %q, want %q", c.keys, c.attr, got, c.value)
+		}
+	}
+
+	// Declining the confirmation sends nothing.
+	a.pane = paneJobs
+	before := len(rec.requests)
+	for _, k := range parseKeys([]byte("cn\r")) {
+		a.handleKey(ctx, k)
+	}
+	if len(rec.requests) != before || a.prompt != nil {
+		t.Fatalf("declined cancel sent a request or left the prompt open")
+	}
+}
+
+func attrValue(attrs goipp.Attributes, name string) string {
+	for _, attr := range attrs {
+		if attr.Name == name && len(attr.Values) > 0 {
+			return attr.Values[0].V.String()
+		}
+	}
+	return ""
+}
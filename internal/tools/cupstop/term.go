@@ -0,0 +1,47 @@
+package cupstop
+
+import (
+	"os"
+	"strings"
+)
+
+// terminal is the controlling terminal in raw mode on the alternate
+// screen.
+type terminal struct {
+	reset   func()
+	getSize func() (width, height int, ok bool)
+}
+
+func newTerminal(reset func(), getSize func() (int, int, bool)) *terminal {
+	// Alternate screen, hidden cursor.
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l")
+	return &terminal{reset: reset, getSize: getSize}
+}
+
+// size falls back to 80x24 when the terminal does not say.
+func (t *terminal) size() (int, int) {
+	if w, h, ok := t.getSize(); ok && w > 0 && h > 0 {
+		return w, h
+	}
+	return 80, 24
+}
+
+// draw repaints the screen from the top left corner.
+func (t *terminal) draw(lines []string) {
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i, l := range lines {
+		if i > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString(l)
+		b.WriteString("\x1b[K")
+	}
+	b.WriteString("\x1b[J")
+	os.Stdout.WriteString(b.String())
+}
+
+func (t *terminal) restore() {
+	os.Stdout.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	t.reset()
+}
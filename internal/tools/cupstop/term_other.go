@@ -0,0 +1,12 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !windows
+
+package cupstop
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func openTerminal() (*terminal, error) {
+	return nil, fmt.Errorf("terminal control is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package cupstop
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func openTerminal() (*terminal, error) {
+	in := windows.Handle(os.Stdin.Fd())
+	out := windows.Handle(os.Stdout.Fd())
+	var inMode, outMode uint32
+	if err := windows.GetConsoleMode(in, &inMode); err != nil {
+		return nil, errors.New("standard input is not a console")
+	}
+	if err := windows.GetConsoleMode(out, &outMode); err != nil {
+		return nil, errors.New("standard output is not a console")
+	}
+	raw := inMode &^ (windows.ENABLE_ECHO_INPUT | windows.ENABLE_PROCESSED_INPUT | windows.ENABLE_LINE_INPUT)
+	if err := windows.SetConsoleMode(in, raw|windows.ENABLE_VIRTUAL_TERMINAL_INPUT); err != nil {
+		return nil, err
+	}
+	if err := windows.SetConsoleMode(out, outMode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING); err != nil {
+		_ = windows.SetConsoleMode(in, inMode)
+		return nil, err
+	}
+	reset := func() {
+		_ = windows.SetConsoleMode(in, inMode)
+		_ = windows.SetConsoleMode(out, outMode)
+	}
+	getSize := func() (int, int, bool) {
+		var info windows.ConsoleScreenBufferInfo
+		if err := windows.GetConsoleScreenBufferInfo(out, &info); err != nil {
+			return 0, 0, false
+		}
+		return int(info.Window.Right-info.Window.Left) + 1, int(info.Window.Bottom-info.Window.Top) + 1, true
+	}
+	return newTerminal(reset, getSize), nil
+}
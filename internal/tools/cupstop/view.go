@@ -0,0 +1,235 @@
+package cupstop
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"cupsgolang/pkg/cups"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+const (
+	styleReverse = "\x1b[7m"
+	styleBold    = "\x1b[1m"
+	styleReset   = "\x1b[0m"
+)
+
+// barWidth is the width of a supply level bar.
+const barWidth = 20
+
+// row is one screen line; selected rows are drawn in reverse video.
+type row struct {
+	text     string
+	selected bool
+}
+
+// render lays out the whole screen as width-limited lines. It does not
+// touch the terminal so it can be tested.
+func render(a *app, width, height int, now time.Time) []string {
+	if width < 20 {
+		width = 20
+	}
+	if height < 8 {
+		height = 8
+	}
+	mode := "live"
+	if !a.live {
+		mode = "polling every " + a.opts.interval.String()
+	}
+	header := fmt.Sprintf("cupstop  %d printers, %d jobs  [%s]", len(a.printers), len(a.jobs), mode)
+	clock := now.Format("15:04:05")
+	if pad := width - len([]rune(header)) - len(clock); pad > 0 {
+		header += strings.Repeat(" ", pad) + clock
+	}
+	lines := []string{styleReverse + fit(header, width) + styleReset}
+
+	footer := a.footer()
+	body := height - len(lines) - 1
+	if a.showHelp {
+		lines = append(lines, "", styleBold+"Keys"+styleReset)
+		for _, l := range helpLines {
+			lines = append(lines, fit(l, width))
+		}
+	} else {
+		printers := a.printerRows()
+		jobs := a.jobRows()
+		// Each pane gets a title line; the printers take at most half of
+		// the body while there are jobs to show.
+		room := body - 2
+		pRoom := len(printers)
+		if pRoom > room/2 && len(jobs) > room-pRoom {
+			pRoom = max(room/2, room-len(jobs))
+		}
+		lines = append(lines, a.title("PRINTERS", panePrinters, fmt.Sprintf("%-20s %-11s %-9s %s", "NAME", "STATE", "ACCEPTING", "REASONS / MESSAGE"), width))
+		lines = appendRows(lines, window(printers, pRoom), width)
+		lines = append(lines, a.title("JOBS", paneJobs, fmt.Sprintf("%-6s %-16s %-10s %-18s %7s  %s", "ID", "PRINTER", "USER", "STATE", "SIZE", "NAME"), width))
+		lines = appendRows(lines, window(jobs, room-pRoom), width)
+	}
+	for len(lines) < height-1 {
+		lines = append(lines, "")
+	}
+	lines = lines[:height-1]
+	return append(lines, fit(footer, width))
+}
+
+// footer is the prompt, the last status or the key hints.
+func (a *app) footer() string {
+	switch {
+	case a.prompt != nil:
+		return a.prompt.label + a.prompt.input
+	case a.status != "":
+		return a.status
+	case a.pane == paneJobs:
+		return "c cancel  h hold  r release  R restart  m move  Tab printers  ? help  q quit"
+	default:
+		return "e enable  d disable  a accept  x reject  Tab jobs  ? help  q quit"
+	}
+}
+
+func (a *app) title(name string, pane int, columns string, width int) string {
+	if a.pane == pane {
+		name = "> " + name
+	} else {
+		name = "  " + name
+	}
+	return styleBold + fit(name+"  "+columns, width) + styleReset
+}
+
+func (a *app) printerRows() []row {
+	var rows []row
+	for i, p := range a.printers {
+		name := p.Name
+		if p.IsDefault {
+			name += "*"
+		}
+		accepting := "no"
+		if p.Accepting {
+			accepting = "yes"
+		}
+		detail := strings.Join(visibleReasons(p.StateReasons), ",")
+		if p.StateMessage != "" {
+			if detail != "" {
+				detail += " - "
+			}
+			detail += p.StateMessage
+		}
+		rows = append(rows, row{
+			text:     fmt.Sprintf("%-20s %-11s %-9s %s", name, p.State, accepting, detail),
+			selected: a.pane == panePrinters && i == a.selPrinter,
+		})
+		for _, s := range supplies(p.Attributes) {
+			rows = append(rows, row{text: "    " + s})
+		}
+	}
+	if len(rows) == 0 {
+		rows = append(rows, row{text: "no printers"})
+	}
+	return rows
+}
+
+func (a *app) jobRows() []row {
+	var rows []row
+	for i, j := range a.jobs {
+		state := j.State.String()
+		if j.State == cups.JobHeld {
+			state = "held"
+		}
+		rows = append(rows, row{
+			text:     fmt.Sprintf("%-6d %-16s %-10s %-18s %6dk  %s", j.ID, j.Destination, j.User, state, j.SizeKB, j.Name),
+			selected: a.pane == paneJobs && i == a.selJob,
+		})
+	}
+	if len(rows) == 0 {
+		rows = append(rows, row{text: "no jobs"})
+	}
+	return rows
+}
+
+// visibleReasons drops "none" and the severity suffixes.
+func visibleReasons(reasons []string) []string {
+	var out []string
+	for _, r := range reasons {
+		if r == "none" || r == "" {
+			continue
+		}
+		r = strings.TrimSuffix(r, "-report")
+		r = strings.TrimSuffix(r, "-warning")
+		r = strings.TrimSuffix(r, "-error")
+		out = append(out, r)
+	}
+	return out
+}
+
+// supplies formats marker-names and marker-levels as bars. Levels below
+// zero are unknown.
+func supplies(attrs goipp.Attributes) []string {
+	var names, levels goipp.Values
+	for _, a := range attrs {
+		switch a.Name {
+		case "marker-names":
+			names = a.Values
+		case "marker-levels":
+			levels = a.Values
+		}
+	}
+	var out []string
+	for i, n := range names {
+		name := n.V.String()
+		level := -1
+		if i < len(levels) {
+			if v, ok := levels[i].V.(goipp.Integer); ok {
+				level = int(v)
+			}
+		}
+		out = append(out, fmt.Sprintf("%-16s %s", name, bar(level)))
+	}
+	return out
+}
+
+func bar(level int) string {
+	if level < 0 || level > 100 {
+		return "[" + strings.Repeat("?", barWidth) + "]  unknown"
+	}
+	filled := level * barWidth / 100
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled) + "] " + fmt.Sprintf("%3d%%", level)
+}
+
+// window returns at most n rows, scrolled so the selected row is visible.
+func window(rows []row, n int) []row {
+	if n < 1 {
+		n = 1
+	}
+	if len(rows) <= n {
+		return rows
+	}
+	start := 0
+	for i, r := range rows {
+		if r.selected && i >= n {
+			start = i - n + 1
+		}
+	}
+	return rows[start : start+n]
+}
+
+func appendRows(lines []string, rows []row, width int) []string {
+	for _, r := range rows {
+		if r.selected {
+			lines = append(lines, styleReverse+fit(r.text, width)+styleReset)
+		} else {
+			lines = append(lines, fit(r.text, width))
+		}
+	}
+	return lines
+}
+
+// fit cuts s to width runes and pads it so a line overwrites what was
+// drawn before.
+func fit(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
@@ -0,0 +1,247 @@
+package ippeveprinter
+
+import (
+	"strconv"
+	"strings"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// mediaSize is a supported media size in hundredths of millimeters.
+type mediaSize struct {
+	name string
+	x, y int
+}
+
+var mediaSizes = []mediaSize{
+	{"iso_a4_210x297mm", 21000, 29700},
+	{"iso_a5_148x210mm", 14800, 21000},
+	{"na_letter_8.5x11in", 21590, 27940},
+	{"na_legal_8.5x14in", 21590, 35560},
+	{"na_index-4x6_4x6in", 10160, 15240},
+}
+
+const (
+	defaultMedia = "iso_a4_210x297mm"
+	// Bottom/top and left/right margins in hundredths of millimeters;
+	// IPP Everywhere requires 5mm or less.
+	marginTopBottom = 423
+	marginLeftRight = 318
+)
+
+var operationsSupported = []goipp.Op{
+	goipp.OpPrintJob,
+	goipp.OpValidateJob,
+	goipp.OpCreateJob,
+	goipp.OpSendDocument,
+	goipp.OpCancelJob,
+	goipp.OpGetJobAttributes,
+	goipp.OpGetJobs,
+	goipp.OpGetPrinterAttributes,
+}
+
+func mediaCol(m mediaSize, source string) goipp.Collection {
+	size := goipp.Collection{}
+	size.Add(goipp.MakeAttribute("x-dimension", goipp.TagInteger, goipp.Integer(m.x)))
+	size.Add(goipp.MakeAttribute("y-dimension", goipp.TagInteger, goipp.Integer(m.y)))
+	col := goipp.Collection{}
+	col.Add(goipp.MakeAttribute("media-size", goipp.TagBeginCollection, size))
+	col.Add(goipp.MakeAttribute("media-size-name", goipp.TagKeyword, goipp.String(m.name)))
+	col.Add(goipp.MakeAttribute("media-bottom-margin", goipp.TagInteger, goipp.Integer(marginTopBottom)))
+	col.Add(goipp.MakeAttribute("media-top-margin", goipp.TagInteger, goipp.Integer(marginTopBottom)))
+	col.Add(goipp.MakeAttribute("media-left-margin", goipp.TagInteger, goipp.Integer(marginLeftRight)))
+	col.Add(goipp.MakeAttribute("media-right-margin", goipp.TagInteger, goipp.Integer(marginLeftRight)))
+	if source != "" {
+		col.Add(goipp.MakeAttribute("media-source", goipp.TagKeyword, goipp.String(source)))
+	}
+	col.Add(goipp.MakeAttribute("media-type", goipp.TagKeyword, goipp.String("stationery")))
+	return col
+}
+
+// urfSupported is the urf-supported value for the configuration, which is
+// also advertised in the URF TXT key.
+func (cfg printerConfig) urfSupported() []string {
+	urf := []string{"V1.4", "CP1", "W8", "RS300", "IS1", "MT1"}
+	if cfg.color {
+		urf = append(urf, "SRGB24")
+	}
+	if cfg.duplex {
+		urf = append(urf, "DM1")
+	}
+	return urf
+}
+
+func (cfg printerConfig) supportsFormat(format string) bool {
+	for _, f := range cfg.formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// printerAttrs returns the Printer Description and Status attributes.
+// They cover what clients and the scheduler's IPP Everywhere PPD generator
+// query.
+func (p *printer) printerAttrs() goipp.Attributes {
+	cfg := p.cfg
+	var attrs goipp.Attributes
+	add := func(name string, tag goipp.Tag, values ...goipp.Value) {
+		a := goipp.Attribute{Name: name}
+		for _, v := range values {
+			a.Values.Add(tag, v)
+		}
+		attrs.Add(a)
+	}
+	strs := func(list ...string) []goipp.Value {
+		out := make([]goipp.Value, 0, len(list))
+		for _, s := range list {
+			out = append(out, goipp.String(s))
+		}
+		return out
+	}
+
+	state, reasons := p.state()
+	add("printer-name", goipp.TagName, goipp.String(cfg.name))
+	add("printer-info", goipp.TagText, goipp.String(cfg.name))
+	add("printer-location", goipp.TagText, goipp.String(cfg.location))
+	add("printer-make-and-model", goipp.TagText, goipp.String(cfg.makeModel))
+	add("printer-uuid", goipp.TagURI, goipp.String("urn:uuid:"+cfg.uuid))
+	add("printer-uri-supported", goipp.TagURI, goipp.String(p.uri))
+	add("uri-security-supported", goipp.TagKeyword, goipp.String("none"))
+	add("uri-authentication-supported", goipp.TagKeyword, goipp.String("none"))
+	add("printer-state", goipp.TagEnum, goipp.Integer(state))
+	add("printer-state-reasons", goipp.TagKeyword, strs(reasons...)...)
+	add("printer-state-message", goipp.TagText, goipp.String(strings.Join(reasons, ", ")))
+	add("printer-is-accepting-jobs", goipp.TagBoolean, goipp.Boolean(true))
+	add("printer-up-time", goipp.TagInteger, goipp.Integer(p.upTime()))
+	add("printer-more-info", goipp.TagURI, goipp.String(strings.Replace(strings.TrimSuffix(p.uri, ippPrintResource), "ipp://", "http://", 1)+"/"))
+	add("queued-job-count", goipp.TagInteger, goipp.Integer(p.queuedJobs()))
+	add("ipp-versions-supported", goipp.TagKeyword, strs("1.1", "2.0")...)
+	add("ipp-features-supported", goipp.TagKeyword, goipp.String("ipp-everywhere"))
+	ops := make([]goipp.Value, 0, len(operationsSupported))
+	for _, op := range operationsSupported {
+		ops = append(ops, goipp.Integer(op))
+	}
+	add("operations-supported", goipp.TagEnum, ops...)
+	add("charset-configured", goipp.TagCharset, goipp.String("utf-8"))
+	add("charset-supported", goipp.TagCharset, goipp.String("utf-8"))
+	add("natural-language-configured", goipp.TagLanguage, goipp.String("en"))
+	add("generated-natural-language-supported", goipp.TagLanguage, goipp.String("en"))
+	add("compression-supported", goipp.TagKeyword, goipp.String("none"))
+	add("pdl-override-supported", goipp.TagKeyword, goipp.String("attempted"))
+	add("multiple-document-jobs-supported", goipp.TagBoolean, goipp.Boolean(false))
+	add("multiple-operation-time-out", goipp.TagInteger, goipp.Integer(60))
+	add("job-ids-supported", goipp.TagBoolean, goipp.Boolean(true))
+	add("which-jobs-supported", goipp.TagKeyword, strs("completed", "not-completed", "all")...)
+
+	add("document-format-default", goipp.TagMimeType, goipp.String("application/octet-stream"))
+	add("document-format-supported", goipp.TagMimeType, strs(append([]string{"application/octet-stream"}, cfg.formats...)...)...)
+
+	add("color-supported", goipp.TagBoolean, goipp.Boolean(cfg.color))
+	if cfg.color {
+		add("print-color-mode-default", goipp.TagKeyword, goipp.String("auto"))
+		add("print-color-mode-supported", goipp.TagKeyword, strs("auto", "color", "monochrome")...)
+	} else {
+		add("print-color-mode-default", goipp.TagKeyword, goipp.String("monochrome"))
+		add("print-color-mode-supported", goipp.TagKeyword, goipp.String("monochrome"))
+	}
+	add("pages-per-minute", goipp.TagInteger, goipp.Integer(cfg.ppm))
+	if cfg.color && cfg.ppmColor > 0 {
+		add("pages-per-minute-color", goipp.TagInteger, goipp.Integer(cfg.ppmColor))
+	}
+	add("sides-default", goipp.TagKeyword, goipp.String("one-sided"))
+	if cfg.duplex {
+		add("sides-supported", goipp.TagKeyword, strs("one-sided", "two-sided-long-edge", "two-sided-short-edge")...)
+	} else {
+		add("sides-supported", goipp.TagKeyword, goipp.String("one-sided"))
+	}
+	add("copies-default", goipp.TagInteger, goipp.Integer(1))
+	add("copies-supported", goipp.TagRange, goipp.Range{Lower: 1, Upper: 99})
+	add("finishings-default", goipp.TagEnum, goipp.Integer(3))
+	add("finishings-supported", goipp.TagEnum, goipp.Integer(3))
+	add("orientation-requested-default", goipp.TagNoValue, goipp.Void{})
+	add("orientation-requested-supported", goipp.TagEnum, goipp.Integer(3), goipp.Integer(4), goipp.Integer(5), goipp.Integer(6))
+	add("output-bin-default", goipp.TagKeyword, goipp.String("face-down"))
+	add("output-bin-supported", goipp.TagKeyword, goipp.String("face-down"))
+	add("print-quality-default", goipp.TagEnum, goipp.Integer(4))
+	add("print-quality-supported", goipp.TagEnum, goipp.Integer(3), goipp.Integer(4), goipp.Integer(5))
+	res := goipp.Resolution{Xres: 300, Yres: 300, Units: goipp.UnitsDpi}
+	add("printer-resolution-default", goipp.TagResolution, res)
+	add("printer-resolution-supported", goipp.TagResolution, res)
+	add("job-creation-attributes-supported", goipp.TagKeyword, strs("copies", "finishings", "media", "media-col", "orientation-requested", "output-bin", "print-color-mode", "print-quality", "printer-resolution", "sides")...)
+
+	// Media.
+	var names, ready []string
+	var database, readyCols []goipp.Value
+	for _, m := range mediaSizes {
+		names = append(names, m.name)
+		database = append(database, mediaCol(m, ""))
+	}
+	for _, m := range mediaSizes {
+		if m.name == defaultMedia {
+			ready = append(ready, m.name)
+			readyCols = append(readyCols, mediaCol(m, "main"))
+			add("media-default", goipp.TagKeyword, goipp.String(m.name))
+			add("media-col-default", goipp.TagBeginCollection, mediaCol(m, "main"))
+		}
+	}
+	add("media-supported", goipp.TagKeyword, strs(names...)...)
+	add("media-ready", goipp.TagKeyword, strs(ready...)...)
+	add("media-col-database", goipp.TagBeginCollection, database...)
+	add("media-col-ready", goipp.TagBeginCollection, readyCols...)
+	add("media-col-supported", goipp.TagKeyword, strs("media-bottom-margin", "media-left-margin", "media-right-margin", "media-size", "media-size-name", "media-source", "media-top-margin", "media-type")...)
+	add("media-bottom-margin-supported", goipp.TagInteger, goipp.Integer(marginTopBottom))
+	add("media-top-margin-supported", goipp.TagInteger, goipp.Integer(marginTopBottom))
+	add("media-left-margin-supported", goipp.TagInteger, goipp.Integer(marginLeftRight))
+	add("media-right-margin-supported", goipp.TagInteger, goipp.Integer(marginLeftRight))
+	add("media-source-supported", goipp.TagKeyword, goipp.String("main"))
+	add("media-type-supported", goipp.TagKeyword, goipp.String("stationery"))
+
+	// Raster formats.
+	if cfg.supportsFormat("image/pwg-raster") {
+		add("pwg-raster-document-resolution-supported", goipp.TagResolution, res)
+		types := []string{"black_1", "sgray_8"}
+		if cfg.color {
+			types = append(types, "srgb_8")
+		}
+		add("pwg-raster-document-type-supported", goipp.TagKeyword, strs(types...)...)
+		if cfg.duplex {
+			add("pwg-raster-document-sheet-back", goipp.TagKeyword, goipp.String("normal"))
+		}
+	}
+	if cfg.supportsFormat("image/urf") {
+		add("urf-supported", goipp.TagKeyword, strs(cfg.urfSupported()...)...)
+	}
+
+	// Supplies, reported as full unless media is out.
+	level := 100
+	if p.faultActive(faultMediaEmpty) {
+		level = 0
+	}
+	if cfg.color {
+		add("marker-names", goipp.TagName, strs("Cyan Toner", "Magenta Toner", "Yellow Toner", "Black Toner")...)
+		add("marker-colors", goipp.TagName, strs("#00FFFF", "#FF00FF", "#FFFF00", "#000000")...)
+		add("marker-types", goipp.TagKeyword, strs("toner", "toner", "toner", "toner")...)
+		add("marker-levels", goipp.TagInteger, goipp.Integer(80), goipp.Integer(80), goipp.Integer(80), goipp.Integer(80))
+	} else {
+		add("marker-names", goipp.TagName, goipp.String("Black Toner"))
+		add("marker-colors", goipp.TagName, goipp.String("#000000"))
+		add("marker-types", goipp.TagKeyword, goipp.String("toner"))
+		add("marker-levels", goipp.TagInteger, goipp.Integer(80))
+	}
+	add("printer-input-tray", goipp.TagString, goipp.Binary("type=sheetFeedAutoRemovableTray;mediafeed=0;mediaxfeed=0;maxcapacity=250;level="+strconv.Itoa(level*250/100)+";status=0;name=main;"))
+	return attrs
+}
+
+func (p *printer) queuedJobs() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n := 0
+	for _, j := range p.jobs {
+		if j.state < jobCanceled {
+			n++
+		}
+	}
+	return n
+}
@@ -0,0 +1,332 @@
+package ippeveprinter
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/hashicorp/mdns"
+)
+
+var errShowHelp = errors.New("show-help")
+
+type options struct {
+	name         string
+	manufacturer string
+	model        string
+	location     string
+	hostname     string
+	port         int
+	spoolDir     string
+	formats      []string
+	ppm          int
+	ppmColor     int
+	duplex       bool
+	dnssd        bool
+	verbose      bool
+	faults       map[string]int
+}
+
+// Main runs ippeveprinter with os.Args.
+func Main() {
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, errShowHelp) {
+		usage()
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ippeveprinter:", err)
+		usage()
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "ippeveprinter:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: ippeveprinter [options] \"service name\"")
+	fmt.Println("Options:")
+	fmt.Println("--fault name[:count]    Inject a fault: offline, media-jam or media-empty,")
+	fmt.Println("                        for count job submissions or until cleared")
+	fmt.Println("--help                  Show this help")
+	fmt.Println("-2                      Set 2-sided printing support (default=1-sided)")
+	fmt.Println("-M manufacturer         Manufacturer name (default=Example)")
+	fmt.Println("-d spool-directory      Save documents in this directory")
+	fmt.Println("-f type/subtype[,...]   List of supported types (default=application/pdf,image/pwg-raster,image/urf)")
+	fmt.Println("-l location             Location of printer (default=empty string)")
+	fmt.Println("-m model                Model name (default=Printer)")
+	fmt.Println("-n hostname             Hostname for printer")
+	fmt.Println("-p port                 Port number (default=8631)")
+	fmt.Println("-r off                  Turn off DNS-SD service advertisements")
+	fmt.Println("-s speed[,color-speed]  Speed in pages per minute (default=10,0)")
+	fmt.Println("-v                      Be verbose")
+	fmt.Println("Faults can be changed while running with PUT and DELETE on /faults/name.")
+}
+
+func parseArgs(args []string) (options, error) {
+	opts := options{
+		manufacturer: "Example",
+		model:        "Printer",
+		port:         8631,
+		formats:      []string{"application/pdf", "image/pwg-raster", "image/urf"},
+		ppm:          10,
+		dnssd:        true,
+		faults:       map[string]int{},
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--help":
+			return opts, errShowHelp
+		case arg == "--fault" || strings.HasPrefix(arg, "--fault="):
+			value, ok := strings.CutPrefix(arg, "--fault=")
+			if !ok {
+				if i+1 >= len(args) {
+					return opts, errors.New("missing argument for --fault")
+				}
+				i++
+				value = args[i]
+			}
+			name, count, err := parseFault(value)
+			if err != nil {
+				return opts, err
+			}
+			opts.faults[name] = count
+			continue
+		case strings.HasPrefix(arg, "--"):
+			return opts, fmt.Errorf("unknown option %q", arg)
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+		default:
+			if opts.name != "" {
+				return opts, fmt.Errorf("unexpected argument %q", arg)
+			}
+			opts.name = arg
+			continue
+		}
+		short := arg[1:]
+		for pos := 0; pos < len(short); pos++ {
+			ch := short[pos]
+			rest := short[pos+1:]
+			consume := func() (string, error) {
+				if rest != "" {
+					pos = len(short)
+					return rest, nil
+				}
+				if i+1 >= len(args) {
+					return "", fmt.Errorf("missing argument for -%c", ch)
+				}
+				i++
+				return args[i], nil
+			}
+			switch ch {
+			case '2':
+				opts.duplex = true
+			case 'v':
+				opts.verbose = true
+			case 'M', 'm', 'l', 'n', 'd', 'f', 'p', 'r', 's':
+				v, err := consume()
+				if err != nil {
+					return opts, err
+				}
+				switch ch {
+				case 'M':
+					opts.manufacturer = v
+				case 'm':
+					opts.model = v
+				case 'l':
+					opts.location = v
+				case 'n':
+					opts.hostname = v
+				case 'd':
+					opts.spoolDir = v
+				case 'f':
+					opts.formats = nil
+					for _, f := range strings.Split(v, ",") {
+						if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+							opts.formats = append(opts.formats, f)
+						}
+					}
+					if len(opts.formats) == 0 {
+						return opts, fmt.Errorf("bad format list %q", v)
+					}
+				case 'p':
+					port, err := strconv.Atoi(v)
+					if err != nil || port < 1 || port > 65535 {
+						return opts, fmt.Errorf("bad port %q", v)
+					}
+					opts.port = port
+				case 'r':
+					if !strings.EqualFold(v, "off") {
+						return opts, fmt.Errorf("bad -r value %q (only \"off\" is supported)", v)
+					}
+					opts.dnssd = false
+				case 's':
+					ppm, color, hasColor := strings.Cut(v, ",")
+					n, err := strconv.Atoi(ppm)
+					if err != nil || n < 1 {
+						return opts, fmt.Errorf("bad speed %q", v)
+					}
+					opts.ppm = n
+					if hasColor {
+						c, err := strconv.Atoi(color)
+						if err != nil || c < 0 || c > n {
+							return opts, fmt.Errorf("bad color speed %q", v)
+						}
+						opts.ppmColor = c
+					}
+				}
+			default:
+				return opts, fmt.Errorf("unknown option \"-%c\"", ch)
+			}
+		}
+	}
+	if opts.name == "" {
+		return opts, errors.New("missing service name")
+	}
+	return opts, nil
+}
+
+// config builds the printer configuration; color is supported when a
+// color speed was given, as in CUPS's ippeveprinter.
+func (opts options) config() printerConfig {
+	return printerConfig{
+		name:      opts.name,
+		makeModel: strings.TrimSpace(opts.manufacturer + " " + opts.model),
+		location:  opts.location,
+		uuid:      printerUUID(opts.name, opts.port),
+		formats:   opts.formats,
+		color:     opts.ppmColor > 0,
+		duplex:    opts.duplex,
+		ppm:       opts.ppm,
+		ppmColor:  opts.ppmColor,
+		spoolDir:  opts.spoolDir,
+	}
+}
+
+// printerUUID derives a stable version 5-style UUID from the service name
+// and port so the printer keeps its identity across restarts.
+func printerUUID(name string, port int) string {
+	sum := sha256.Sum256([]byte(name + ":" + strconv.Itoa(port)))
+	sum[6] = sum[6]&0x0f | 0x50
+	sum[8] = sum[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
+
+func run(ctx context.Context, opts options) error {
+	level := slog.LevelInfo
+	if opts.verbose {
+		level = slog.LevelDebug
+	}
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+
+	if opts.spoolDir == "" {
+		dir, err := os.MkdirTemp("", "ippeveprinter")
+		if err != nil {
+			return err
+		}
+		opts.spoolDir = dir
+	} else if err := os.MkdirAll(opts.spoolDir, 0o755); err != nil {
+		return err
+	}
+	if opts.hostname == "" {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "localhost"
+		}
+		opts.hostname = strings.TrimSuffix(host, ".local") + ".local"
+	}
+
+	cfg := opts.config()
+	uri := fmt.Sprintf("ipp://%s%s", net.JoinHostPort(opts.hostname, strconv.Itoa(opts.port)), ippPrintResource)
+	p := newPrinter(cfg, uri, logger)
+	for name, count := range opts.faults {
+		p.setFault(name, count)
+	}
+
+	ln, err := net.Listen("tcp", ":"+strconv.Itoa(opts.port))
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: p, ReadHeaderTimeout: 30 * time.Second}
+	if opts.dnssd {
+		mdnsServer, err := advertise(cfg, opts.hostname, opts.port)
+		if err != nil {
+			logger.Warn("failed to start DNS-SD advertisement", "err", err)
+		} else {
+			defer mdnsServer.Shutdown()
+		}
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+	logger.Info("ippeveprinter listening", "uri", uri, "spool", cfg.spoolDir)
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// txtRecord is the _ipp._tcp TXT record from the IPP Everywhere
+// specification.
+func txtRecord(cfg printerConfig, hostname string, port int) []string {
+	adminURL := fmt.Sprintf("http://%s/", net.JoinHostPort(hostname, strconv.Itoa(port)))
+	txt := []string{
+		"txtvers=1",
+		"qtotal=1",
+		"rp=" + strings.TrimPrefix(ippPrintResource, "/"),
+		"ty=" + cfg.makeModel,
+		"adminurl=" + adminURL,
+		"note=" + cfg.location,
+		"priority=0",
+		"product=(" + cfg.makeModel + ")",
+		"pdl=" + strings.Join(cfg.formats, ","),
+		"Color=" + txtBool(cfg.color),
+		"Duplex=" + txtBool(cfg.duplex),
+		"UUID=" + cfg.uuid,
+		"kind=document",
+		"PaperMax=legal-A4",
+	}
+	if cfg.supportsFormat("image/urf") {
+		txt = append(txt, "URF="+strings.Join(cfg.urfSupported(), ","))
+	}
+	return txt
+}
+
+func txtBool(v bool) string {
+	if v {
+		return "T"
+	}
+	return "F"
+}
+
+// advertise registers the printer as an _ipp._tcp service with the same
+// mDNS responder the scheduler uses for shared queues.
+func advertise(cfg printerConfig, hostname string, port int) (*mdns.Server, error) {
+	host := hostname
+	if !strings.HasSuffix(host, ".") {
+		host += "."
+	}
+	svc, err := mdns.NewMDNSService(cfg.name, "_ipp._tcp", "local", host, port, nil, txtRecord(cfg, hostname, port))
+	if err != nil {
+		return nil, err
+	}
+	return mdns.NewServer(&mdns.Config{Zone: svc})
+}
@@ -0,0 +1,252 @@
+package ippeveprinter
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/backend"
+	"cupsgolang/internal/model"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-M", "Acme", "-mLaser 9", "-2", "-s", "20,10", "-f", "image/pwg-raster,application/pdf", "-r", "off", "--fault", "media-jam:2", "--fault=offline", "Test Printer"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if opts.name != "Test Printer" || opts.manufacturer != "Acme" || opts.model != "Laser 9" || !opts.duplex || opts.dnssd {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if opts.ppm != 20 || opts.ppmColor != 10 || strings.Join(opts.formats, ",") != "image/pwg-raster,application/pdf" {
+		t.Fatalf("unexpected speeds or formats: %+v", opts)
+	}
+	if opts.faults[faultMediaJam] != 2 || opts.faults[faultOffline] != faultPersistent {
+		t.Fatalf("unexpected faults: %v", opts.faults)
+	}
+	cfg := opts.config()
+	if !cfg.color || cfg.makeModel != "Acme Laser 9" || cfg.uuid != printerUUID("Test Printer", 8631) {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	if _, err := parseArgs([]string{"--help"}); !errors.Is(err, errShowHelp) {
+		t.Fatalf("expected errShowHelp, got %v", err)
+	}
+	for _, bad := range [][]string{
+		{},
+		{"-p", "0", "P"},
+		{"--fault", "toner-low", "P"},
+		{"--fault", "media-jam:0", "P"},
+		{"-s", "5,9", "P"},
+		{"A", "B"},
+	} {
+		if _, err := parseArgs(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	cases := map[string]string{
+		"%PDF-1.7\n":          "application/pdf",
+		"RaS2PwgRaster\x00":   "image/pwg-raster",
+		"UNIRAST\x00\x00\x00": "image/urf",
+		"plain text":          "",
+	}
+	for data, want := range cases {
+		if got := detectFormat([]byte(data)); got != want {
+			t.Errorf("detectFormat(%q) = %q, want %q", data, got, want)
+		}
+	}
+}
+
+func startPrinter(t *testing.T, faults map[string]int) (*printer, string) {
+	t.Helper()
+	cfg := options{name: "Test Printer", manufacturer: "Example", model: "Printer", port: 8631, ppm: 10, ppmColor: 5,
+		formats: []string{"application/pdf", "image/pwg-raster", "image/urf"}}.config()
+	cfg.spoolDir = t.TempDir()
+	p := newPrinter(cfg, "", slog.New(slog.NewTextHandler(io.Discard, nil)))
+	for name, count := range faults {
+		p.setFault(name, count)
+	}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	p.uri = strings.Replace(srv.URL, "http://", "ipp://", 1) + ippPrintResource
+	return p, p.uri
+}
+
+func submit(t *testing.T, uri, format, data string) error {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "doc")
+	os.WriteFile(file, []byte(data), 0o644)
+	return backend.ForURI(uri).SubmitJob(context.Background(),
+		model.Printer{Name: "Test", URI: uri},
+		model.Job{Name: "test job", UserName: "alice"},
+		model.Document{MimeType: format}, file)
+}
+
+func TestPrintJobSavesDocument(t *testing.T) {
+	p, uri := startPrinter(t, nil)
+	if err := submit(t, uri, "application/pdf", "%PDF-1.7\n%%EOF\n"); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(p.cfg.spoolDir, "1-1.pdf"))
+	if err != nil || !strings.HasPrefix(string(data), "%PDF") {
+		t.Fatalf("saved document: %q %v", data, err)
+	}
+	if p.jobs[0].state != jobCompleted || p.jobs[0].user != "alice" || p.jobs[0].name != "test job" {
+		t.Fatalf("unexpected job: %+v", p.jobs[0])
+	}
+
+	// Auto-detected documents keep their real type; mislabeled ones fail.
+	if err := submit(t, uri, "application/octet-stream", "UNIRAST\x00\x00\x00\x00\x02"); err != nil {
+		t.Fatalf("submit octet-stream: %v", err)
+	}
+	if p.jobs[1].format != "image/urf" || p.jobs[1].impressions != 2 {
+		t.Fatalf("unexpected detected job: %+v", p.jobs[1])
+	}
+	if err := submit(t, uri, "image/pwg-raster", "%PDF-1.7\n"); !backend.IsUnsupported(err) {
+		t.Fatalf("expected unsupported error for mislabeled document, got %v", err)
+	}
+	if err := submit(t, uri, "text/plain", "hello"); !backend.IsUnsupported(err) {
+		t.Fatalf("expected unsupported error for text/plain, got %v", err)
+	}
+}
+
+func TestFaultsFailJobsTemporarily(t *testing.T) {
+	p, uri := startPrinter(t, map[string]int{faultMediaJam: 1})
+	if err := submit(t, uri, "application/pdf", "%PDF-1.7\n"); !backend.IsTemporary(err) {
+		t.Fatalf("expected temporary error while jammed, got %v", err)
+	}
+	if err := submit(t, uri, "application/pdf", "%PDF-1.7\n"); err != nil {
+		t.Fatalf("submit after the jam cleared: %v", err)
+	}
+
+	p.setFault(faultMediaEmpty, faultPersistent)
+	resp := ippRequest(t, uri, goipp.OpGetPrinterAttributes, nil)
+	if state := attrString(resp.Printer, "printer-state"); state != "5" {
+		t.Fatalf("printer-state = %s, want 5", state)
+	}
+	if !strings.Contains(fmt.Sprint(resp.Printer), "media-empty-error") {
+		t.Fatalf("printer-state-reasons missing media-empty-error: %v", resp.Printer)
+	}
+	for i := 0; i < 2; i++ {
+		if err := submit(t, uri, "application/pdf", "%PDF-1.7\n"); !backend.IsTemporary(err) {
+			t.Fatalf("expected temporary error while out of media, got %v", err)
+		}
+	}
+
+	// offline is set over HTTP and answers IPP with 503.
+	base := strings.Replace(strings.TrimSuffix(uri, ippPrintResource), "ipp://", "http://", 1)
+	for _, step := range []struct{ method, path string }{
+		{http.MethodDelete, "/faults/media-empty"},
+		{http.MethodPut, "/faults/offline?count=1"},
+	} {
+		req, _ := http.NewRequest(step.method, base+step.path, nil)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil || res.StatusCode != http.StatusNoContent {
+			t.Fatalf("%s %s: %v %v", step.method, step.path, res, err)
+		}
+		res.Body.Close()
+	}
+	if got := p.faultList(); len(got) != 1 || got[0] != "offline:1" {
+		t.Fatalf("faults = %v", got)
+	}
+	if err := submit(t, uri, "application/pdf", "%PDF-1.7\n"); !backend.IsTemporary(err) {
+		t.Fatalf("expected temporary error while offline, got %v", err)
+	}
+}
+
+func ippRequest(t *testing.T, uri string, op goipp.Op, extra func(*goipp.Message), doc ...string) *goipp.Message {
+	t.Helper()
+	req := goipp.NewRequest(goipp.DefaultVersion, op, 1)
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en")))
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String(uri)))
+	if extra != nil {
+		extra(req)
+	}
+	payload, _ := req.EncodeBytes()
+	body := append(payload, strings.Join(doc, "")...)
+	url := strings.Replace(uri, "ipp://", "http://", 1)
+	res, err := http.Post(url, goipp.ContentType, bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer res.Body.Close()
+	resp := &goipp.Message{}
+	if err := resp.Decode(res.Body); err != nil {
+		t.Fatalf("decode %v response: %v", op, err)
+	}
+	return resp
+}
+
+func TestCreateJobSendDocument(t *testing.T) {
+	p, uri := startPrinter(t, nil)
+	resp := ippRequest(t, uri, goipp.OpCreateJob, func(m *goipp.Message) {
+		m.Operation.Add(goipp.MakeAttribute("requesting-user-name", goipp.TagName, goipp.String("bob")))
+	})
+	if goipp.Status(resp.Code) != goipp.StatusOk || attrString(resp.Job, "job-id") != "1" {
+		t.Fatalf("Create-Job: %v %v", goipp.Status(resp.Code), resp.Job)
+	}
+	withJob := func(m *goipp.Message) {
+		m.Operation.Add(goipp.MakeAttribute("job-id", goipp.TagInteger, goipp.Integer(1)))
+	}
+	if state := attrString(ippRequest(t, uri, goipp.OpGetJobAttributes, withJob).Job, "job-state"); state != "3" {
+		t.Fatalf("job-state before Send-Document = %s", state)
+	}
+	resp = ippRequest(t, uri, goipp.OpSendDocument, func(m *goipp.Message) {
+		withJob(m)
+		m.Operation.Add(goipp.MakeAttribute("document-format", goipp.TagMimeType, goipp.String("image/pwg-raster")))
+		m.Operation.Add(goipp.MakeAttribute("last-document", goipp.TagBoolean, goipp.Boolean(true)))
+	}, "RaS2PwgRaster\x00")
+	if goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("Send-Document: %v", goipp.Status(resp.Code))
+	}
+	resp = ippRequest(t, uri, goipp.OpGetJobAttributes, withJob)
+	if attrString(resp.Job, "job-state") != "9" || attrString(resp.Job, "job-originating-user-name") != "bob" || attrString(resp.Job, "document-format") != "image/pwg-raster" {
+		t.Fatalf("unexpected job attributes: %v", resp.Job)
+	}
+	if _, err := os.Stat(filepath.Join(p.cfg.spoolDir, "1-1.pwg")); err != nil {
+		t.Fatalf("saved document: %v", err)
+	}
+	resp = ippRequest(t, uri, goipp.OpGetJobAttributes, func(m *goipp.Message) {
+		m.Operation.Add(goipp.MakeAttribute("job-id", goipp.TagInteger, goipp.Integer(9)))
+	})
+	if goipp.Status(resp.Code) != goipp.StatusErrorNotFound {
+		t.Fatalf("Get-Job-Attributes for a missing job: %v", goipp.Status(resp.Code))
+	}
+}
+
+func TestGetPrinterAttributes(t *testing.T) {
+	_, uri := startPrinter(t, nil)
+	resp := ippRequest(t, uri, goipp.OpGetPrinterAttributes, nil)
+	if goipp.Status(resp.Code) != goipp.StatusOk {
+		t.Fatalf("Get-Printer-Attributes: %v", goipp.Status(resp.Code))
+	}
+	// These are what the scheduler needs to generate a PPD.
+	for _, name := range []string{"printer-make-and-model", "color-supported", "media-col-database", "media-default",
+		"document-format-supported", "pwg-raster-document-resolution-supported", "pwg-raster-document-type-supported",
+		"urf-supported", "marker-levels", "printer-uuid"} {
+		if !hasAttr(resp.Printer, name) {
+			t.Errorf("missing %s", name)
+		}
+	}
+
+	resp = ippRequest(t, uri, goipp.OpGetPrinterAttributes, func(m *goipp.Message) {
+		m.Operation.Add(goipp.MakeAttribute("requested-attributes", goipp.TagKeyword, goipp.String("printer-state")))
+	})
+	if len(resp.Printer) != 1 || attrString(resp.Printer, "printer-state") != "3" {
+		t.Fatalf("requested-attributes filter: %v", resp.Printer)
+	}
+}
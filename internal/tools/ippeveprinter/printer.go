@@ -0,0 +1,839 @@
+package ippeveprinter
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// Job states, from RFC 8011.
+const (
+	jobPending    = 3
+	jobHeld       = 4
+	jobProcessing = 5
+	jobCanceled   = 7
+	jobAborted    = 8
+	jobCompleted  = 9
+)
+
+// Printer states.
+const (
+	printerIdle       = 3
+	printerProcessing = 4
+	printerStopped    = 5
+)
+
+// Faults that can be injected. offline answers every IPP request with HTTP
+// 503; the media faults stop the printer and fail new jobs with a
+// temporary IPP status, which the scheduler's error policy acts on.
+const (
+	faultOffline     = "offline"
+	faultMediaJam    = "media-jam"
+	faultMediaEmpty  = "media-empty"
+	faultPersistent  = -1
+	ippPrintResource = "/ipp/print"
+)
+
+var knownFaults = []string{faultOffline, faultMediaJam, faultMediaEmpty}
+
+type printerConfig struct {
+	name      string
+	makeModel string
+	location  string
+	uuid      string
+	formats   []string
+	color     bool
+	duplex    bool
+	ppm       int
+	ppmColor  int
+	spoolDir  string
+}
+
+type job struct {
+	id          int
+	name        string
+	user        string
+	format      string
+	state       int
+	reasons     string
+	created     time.Time
+	processing  time.Time
+	completed   time.Time
+	files       []string
+	impressions int
+}
+
+// printer is the virtual printer: its configuration, jobs and the faults
+// currently injected. All fields after mu are guarded by it.
+type printer struct {
+	cfg   printerConfig
+	uri   string
+	start time.Time
+	log   *slog.Logger
+
+	mu        sync.Mutex
+	jobs      []*job
+	nextJobID int
+	// faults maps an active fault to the number of job submissions it
+	// still fails, or faultPersistent.
+	faults map[string]int
+}
+
+func newPrinter(cfg printerConfig, uri string, log *slog.Logger) *printer {
+	return &printer{
+		cfg:       cfg,
+		uri:       uri,
+		start:     time.Now(),
+		log:       log,
+		nextJobID: 1,
+		faults:    map[string]int{},
+	}
+}
+
+func (p *printer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.URL.Path == "/faults" || strings.HasPrefix(r.URL.Path, "/faults/"):
+		p.serveFaults(w, r)
+	case r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), goipp.ContentType):
+		if r.URL.Path != ippPrintResource && r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if p.faultActive(faultOffline) {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "printer offline", http.StatusServiceUnavailable)
+			return
+		}
+		p.serveIPP(w, r)
+	case r.Method == http.MethodGet && r.URL.Path == "/":
+		p.serveStatus(w)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveStatus is a plain-text status page for browsers and curl.
+func (p *printer) serveStatus(w http.ResponseWriter) {
+	state, reasons := p.state()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s (%s)\n", p.cfg.name, p.cfg.makeModel)
+	fmt.Fprintf(w, "URI: %s\n", p.uri)
+	fmt.Fprintf(w, "State: %s (%s)\n", printerStateName(state), strings.Join(reasons, ","))
+	fmt.Fprintf(w, "Spool: %s\n", p.cfg.spoolDir)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, j := range p.jobs {
+		fmt.Fprintf(w, "Job %d: %s %s %q %s\n", j.id, jobStateName(j.state), j.user, j.name, strings.Join(j.files, " "))
+	}
+}
+
+// serveFaults lists the active faults (GET /faults), sets one
+// (PUT or POST /faults/name[?count=n]) or clears one (DELETE /faults/name).
+func (p *printer) serveFaults(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/faults"), "/")
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range p.faultList() {
+			fmt.Fprintln(w, line)
+		}
+		return
+	case http.MethodPut, http.MethodPost:
+		count := faultPersistent
+		if v := r.URL.Query().Get("count"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "bad count", http.StatusBadRequest)
+				return
+			}
+			count = n
+		}
+		if err := p.setFault(name, count); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case http.MethodDelete:
+		if name == "" {
+			p.clearFaults()
+		} else if err := p.clearFault(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func validFault(name string) bool {
+	for _, f := range knownFaults {
+		if f == name {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFault reads the name[:count] form of --fault.
+func parseFault(s string) (string, int, error) {
+	name, countText, hasCount := strings.Cut(strings.ToLower(strings.TrimSpace(s)), ":")
+	if !validFault(name) {
+		return "", 0, fmt.Errorf("unknown fault %q (want %s)", name, strings.Join(knownFaults, ", "))
+	}
+	if !hasCount {
+		return name, faultPersistent, nil
+	}
+	n, err := strconv.Atoi(countText)
+	if err != nil || n < 1 {
+		return "", 0, fmt.Errorf("bad fault count %q", countText)
+	}
+	return name, n, nil
+}
+
+func (p *printer) setFault(name string, count int) error {
+	if !validFault(name) {
+		return fmt.Errorf("unknown fault %q", name)
+	}
+	p.mu.Lock()
+	p.faults[name] = count
+	p.mu.Unlock()
+	p.log.Info("Fault set", "fault", name, "count", count)
+	return nil
+}
+
+func (p *printer) clearFault(name string) error {
+	if !validFault(name) {
+		return fmt.Errorf("unknown fault %q", name)
+	}
+	p.mu.Lock()
+	delete(p.faults, name)
+	p.mu.Unlock()
+	p.log.Info("Fault cleared", "fault", name)
+	return nil
+}
+
+func (p *printer) clearFaults() {
+	p.mu.Lock()
+	p.faults = map[string]int{}
+	p.mu.Unlock()
+	p.log.Info("Faults cleared")
+}
+
+func (p *printer) faultActive(name string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	_, ok := p.faults[name]
+	return ok
+}
+
+func (p *printer) faultList() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var out []string
+	for name, count := range p.faults {
+		if count == faultPersistent {
+			out = append(out, name)
+		} else {
+			out = append(out, name+":"+strconv.Itoa(count))
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// jobFault consumes one use of the fault that fails a new job, if any.
+// offline is included for submissions that raced with setting it.
+func (p *printer) jobFault() (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, name := range knownFaults {
+		count, ok := p.faults[name]
+		if !ok {
+			continue
+		}
+		if count != faultPersistent {
+			if count <= 1 {
+				delete(p.faults, name)
+			} else {
+				p.faults[name] = count - 1
+			}
+		}
+		return name, true
+	}
+	return "", false
+}
+
+// state returns printer-state and printer-state-reasons.
+func (p *printer) state() (int, []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var reasons []string
+	if _, ok := p.faults[faultOffline]; ok {
+		reasons = append(reasons, "offline-report")
+	}
+	if _, ok := p.faults[faultMediaJam]; ok {
+		reasons = append(reasons, "media-jam-error")
+	}
+	if _, ok := p.faults[faultMediaEmpty]; ok {
+		reasons = append(reasons, "media-empty-error", "media-needed-error")
+	}
+	if len(reasons) > 0 {
+		return printerStopped, reasons
+	}
+	for _, j := range p.jobs {
+		if j.state == jobProcessing {
+			return printerProcessing, []string{"none"}
+		}
+	}
+	return printerIdle, []string{"none"}
+}
+
+func printerStateName(state int) string {
+	switch state {
+	case printerIdle:
+		return "idle"
+	case printerProcessing:
+		return "processing"
+	}
+	return "stopped"
+}
+
+func jobStateName(state int) string {
+	switch state {
+	case jobPending:
+		return "pending"
+	case jobHeld:
+		return "pending-held"
+	case jobProcessing:
+		return "processing"
+	case jobCanceled:
+		return "canceled"
+	case jobAborted:
+		return "aborted"
+	}
+	return "completed"
+}
+
+func (p *printer) serveIPP(w http.ResponseWriter, r *http.Request) {
+	body := bufio.NewReader(r.Body)
+	req := &goipp.Message{}
+	if err := req.Decode(body); err != nil {
+		http.Error(w, "bad IPP request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp := p.handle(req, body)
+	p.log.Debug("IPP request", "operation", goipp.Op(req.Code).String(), "status", goipp.Status(resp.Code).String())
+	data, err := resp.EncodeBytes()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", goipp.ContentType)
+	w.Write(data)
+}
+
+// response starts a response with the required operation attributes.
+func response(req *goipp.Message, status goipp.Status, message string) *goipp.Message {
+	resp := goipp.NewResponse(req.Version, status, req.RequestID)
+	resp.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	resp.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en")))
+	if message != "" {
+		resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String(message)))
+	}
+	return resp
+}
+
+func (p *printer) handle(req *goipp.Message, doc io.Reader) *goipp.Message {
+	if major := req.Version.Major(); major < 1 || major > 2 {
+		return response(req, goipp.StatusErrorVersionNotSupported, "")
+	}
+	if len(req.Operation) < 2 || req.Operation[0].Name != "attributes-charset" || req.Operation[1].Name != "attributes-natural-language" {
+		return response(req, goipp.StatusErrorBadRequest, "Missing attributes-charset or attributes-natural-language.")
+	}
+	switch goipp.Op(req.Code) {
+	case goipp.OpPrintJob:
+		return p.printJob(req, doc)
+	case goipp.OpValidateJob:
+		return p.validateJob(req)
+	case goipp.OpCreateJob:
+		return p.createJob(req)
+	case goipp.OpSendDocument:
+		return p.sendDocument(req, doc)
+	case goipp.OpCancelJob:
+		return p.cancelJob(req)
+	case goipp.OpGetJobAttributes:
+		return p.getJobAttributes(req)
+	case goipp.OpGetJobs:
+		return p.getJobs(req)
+	case goipp.OpGetPrinterAttributes:
+		return p.getPrinterAttributes(req)
+	}
+	return response(req, goipp.StatusErrorOperationNotSupported, "")
+}
+
+func attrValue(attrs goipp.Attributes, name string) (goipp.Value, bool) {
+	for _, a := range attrs {
+		if a.Name == name && len(a.Values) > 0 {
+			return a.Values[0].V, true
+		}
+	}
+	return nil, false
+}
+
+func attrString(attrs goipp.Attributes, name string) string {
+	if v, ok := attrValue(attrs, name); ok {
+		return v.String()
+	}
+	return ""
+}
+
+// checkFormat validates document-format and returns the format to use,
+// "application/octet-stream" meaning auto-detect.
+func (p *printer) checkFormat(req *goipp.Message) (string, *goipp.Message) {
+	format := attrString(req.Operation, "document-format")
+	if format == "" || format == "application/octet-stream" {
+		return "application/octet-stream", nil
+	}
+	for _, f := range p.cfg.formats {
+		if strings.EqualFold(f, format) {
+			return f, nil
+		}
+	}
+	resp := response(req, goipp.StatusErrorDocumentFormatNotSupported, fmt.Sprintf("Unsupported format %q.", format))
+	resp.Unsupported.Add(goipp.MakeAttribute("document-format", goipp.TagMimeType, goipp.String(format)))
+	return "", resp
+}
+
+// checkFault fails a job-creating request while a media fault is active.
+func (p *printer) checkFault(req *goipp.Message) *goipp.Message {
+	name, ok := p.jobFault()
+	if !ok {
+		return nil
+	}
+	p.log.Info("Job refused by fault", "fault", name)
+	switch name {
+	case faultMediaJam:
+		return response(req, goipp.StatusErrorDevice, "Media jam.")
+	case faultMediaEmpty:
+		return response(req, goipp.StatusErrorBusy, "Out of media.")
+	}
+	return response(req, goipp.StatusErrorServiceUnavailable, "Printer offline.")
+}
+
+func (p *printer) validateJob(req *goipp.Message) *goipp.Message {
+	if _, resp := p.checkFormat(req); resp != nil {
+		return resp
+	}
+	return response(req, goipp.StatusOk, "")
+}
+
+func (p *printer) newJob(req *goipp.Message, format string) *job {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	j := &job{
+		id:      p.nextJobID,
+		name:    attrString(req.Operation, "job-name"),
+		user:    attrString(req.Operation, "requesting-user-name"),
+		format:  format,
+		state:   jobPending,
+		reasons: "job-incoming",
+		created: time.Now(),
+	}
+	if j.name == "" {
+		j.name = "Untitled"
+	}
+	if j.user == "" {
+		j.user = "anonymous"
+	}
+	p.nextJobID++
+	p.jobs = append(p.jobs, j)
+	return j
+}
+
+func (p *printer) printJob(req *goipp.Message, doc io.Reader) *goipp.Message {
+	format, resp := p.checkFormat(req)
+	if resp != nil {
+		return resp
+	}
+	if resp := p.checkFault(req); resp != nil {
+		return resp
+	}
+	data, err := io.ReadAll(doc)
+	if err != nil {
+		return response(req, goipp.StatusErrorBadRequest, err.Error())
+	}
+	if len(data) == 0 {
+		return response(req, goipp.StatusErrorBadRequest, "No file in request.")
+	}
+	if _, status, msg := p.resolveFormat(format, data); status != goipp.StatusOk {
+		return response(req, status, msg)
+	}
+	j := p.newJob(req, format)
+	if status, msg := p.addDocument(j, format, data, true); status != goipp.StatusOk {
+		return response(req, status, msg)
+	}
+	return p.jobResponse(req, j)
+}
+
+func (p *printer) createJob(req *goipp.Message) *goipp.Message {
+	if resp := p.checkFault(req); resp != nil {
+		return resp
+	}
+	j := p.newJob(req, "")
+	return p.jobResponse(req, j)
+}
+
+func (p *printer) findJob(req *goipp.Message) (*job, *goipp.Message) {
+	id := 0
+	if v, ok := attrValue(req.Operation, "job-id"); ok {
+		if n, ok := v.(goipp.Integer); ok {
+			id = int(n)
+		}
+	} else if uri := attrString(req.Operation, "job-uri"); uri != "" {
+		id, _ = strconv.Atoi(uri[strings.LastIndexByte(uri, '/')+1:])
+	}
+	if id <= 0 {
+		return nil, response(req, goipp.StatusErrorBadRequest, "Missing job-id.")
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, j := range p.jobs {
+		if j.id == id {
+			return j, nil
+		}
+	}
+	return nil, response(req, goipp.StatusErrorNotFound, fmt.Sprintf("Job #%d does not exist.", id))
+}
+
+func (p *printer) sendDocument(req *goipp.Message, doc io.Reader) *goipp.Message {
+	j, resp := p.findJob(req)
+	if resp != nil {
+		return resp
+	}
+	format, resp := p.checkFormat(req)
+	if resp != nil {
+		return resp
+	}
+	p.mu.Lock()
+	state := j.state
+	p.mu.Unlock()
+	if state != jobPending {
+		return response(req, goipp.StatusErrorNotPossible, fmt.Sprintf("Job #%d is not accepting documents.", j.id))
+	}
+	last := false
+	if v, ok := attrValue(req.Operation, "last-document"); ok {
+		if b, ok := v.(goipp.Boolean); ok {
+			last = bool(b)
+		}
+	}
+	data, err := io.ReadAll(doc)
+	if err != nil {
+		return response(req, goipp.StatusErrorBadRequest, err.Error())
+	}
+	if len(data) > 0 {
+		if status, msg := p.addDocument(j, format, data, last); status != goipp.StatusOk {
+			return response(req, status, msg)
+		}
+	} else if last {
+		p.finish(j)
+	}
+	return p.jobResponse(req, j)
+}
+
+// resolveFormat checks data against format, detecting it when format is
+// application/octet-stream.
+func (p *printer) resolveFormat(format string, data []byte) (string, goipp.Status, string) {
+	detected := detectFormat(data)
+	if format == "application/octet-stream" {
+		if detected == "" {
+			return "", goipp.StatusErrorDocumentFormatError, "Unable to detect the document format."
+		}
+		for _, f := range p.cfg.formats {
+			if f == detected {
+				return detected, goipp.StatusOk, ""
+			}
+		}
+		return "", goipp.StatusErrorDocumentFormatNotSupported, fmt.Sprintf("Unsupported format %q.", detected)
+	}
+	if detected != "" && detected != format {
+		return "", goipp.StatusErrorDocumentFormatError, fmt.Sprintf("Document is %s, not %s.", detected, format)
+	}
+	return format, goipp.StatusOk, ""
+}
+
+// addDocument saves a document of j to the spool directory and, for the
+// last one, completes the job.
+func (p *printer) addDocument(j *job, format string, data []byte, last bool) (goipp.Status, string) {
+	format, status, msg := p.resolveFormat(format, data)
+	if status != goipp.StatusOk {
+		return status, msg
+	}
+	p.mu.Lock()
+	j.state = jobProcessing
+	j.reasons = "job-printing"
+	j.processing = time.Now()
+	j.format = format
+	name := filepath.Join(p.cfg.spoolDir, fmt.Sprintf("%d-%d.%s", j.id, len(j.files)+1, formatExt(format)))
+	j.files = append(j.files, name)
+	p.mu.Unlock()
+	if err := os.WriteFile(name, data, 0o644); err != nil {
+		p.mu.Lock()
+		j.state, j.reasons, j.completed = jobAborted, "aborted-by-system", time.Now()
+		p.mu.Unlock()
+		p.log.Error("Unable to save document", "job-id", j.id, "err", err)
+		return goipp.StatusErrorInternal, err.Error()
+	}
+	p.mu.Lock()
+	j.impressions += countPages(format, data)
+	p.mu.Unlock()
+	p.log.Info("Document received", "job-id", j.id, "format", format, "bytes", len(data), "file", name)
+	if last {
+		p.finish(j)
+	} else {
+		p.mu.Lock()
+		j.state, j.reasons = jobPending, "job-incoming"
+		p.mu.Unlock()
+	}
+	return goipp.StatusOk, ""
+}
+
+func (p *printer) finish(j *job) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if j.state == jobCanceled || j.state == jobAborted {
+		return
+	}
+	j.state = jobCompleted
+	j.reasons = "job-completed-successfully"
+	j.completed = time.Now()
+	if j.processing.IsZero() {
+		j.processing = j.completed
+	}
+}
+
+func (p *printer) cancelJob(req *goipp.Message) *goipp.Message {
+	j, resp := p.findJob(req)
+	if resp != nil {
+		return resp
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if j.state >= jobCanceled {
+		return response(req, goipp.StatusErrorNotPossible, fmt.Sprintf("Job #%d is already %s.", j.id, jobStateName(j.state)))
+	}
+	j.state, j.reasons, j.completed = jobCanceled, "job-canceled-by-user", time.Now()
+	return response(req, goipp.StatusOk, "")
+}
+
+func (p *printer) jobURI(j *job) string {
+	return strings.TrimSuffix(p.uri, ippPrintResource) + "/ipp/print/" + strconv.Itoa(j.id)
+}
+
+// jobAttrs returns the Job Status attributes of j.
+func (p *printer) jobAttrs(j *job) goipp.Attributes {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var attrs goipp.Attributes
+	add := func(name string, tag goipp.Tag, v goipp.Value) {
+		attrs.Add(goipp.MakeAttribute(name, tag, v))
+	}
+	add("job-id", goipp.TagInteger, goipp.Integer(j.id))
+	add("job-uri", goipp.TagURI, goipp.String(p.jobURI(j)))
+	add("job-printer-uri", goipp.TagURI, goipp.String(p.uri))
+	add("job-name", goipp.TagName, goipp.String(j.name))
+	add("job-originating-user-name", goipp.TagName, goipp.String(j.user))
+	add("job-state", goipp.TagEnum, goipp.Integer(j.state))
+	add("job-state-reasons", goipp.TagKeyword, goipp.String(j.reasons))
+	if j.format != "" {
+		add("document-format", goipp.TagMimeType, goipp.String(j.format))
+	}
+	add("number-of-documents", goipp.TagInteger, goipp.Integer(len(j.files)))
+	add("job-impressions-completed", goipp.TagInteger, goipp.Integer(j.impressions))
+	add("job-printer-up-time", goipp.TagInteger, goipp.Integer(p.upTime()))
+	add("time-at-creation", goipp.TagInteger, goipp.Integer(p.upTimeAt(j.created)))
+	for name, t := range map[string]time.Time{"time-at-processing": j.processing, "time-at-completed": j.completed} {
+		if t.IsZero() {
+			add(name, goipp.TagNoValue, goipp.Void{})
+		} else {
+			add(name, goipp.TagInteger, goipp.Integer(p.upTimeAt(t)))
+		}
+	}
+	return attrs
+}
+
+func (p *printer) upTime() int {
+	return p.upTimeAt(time.Now())
+}
+
+// upTimeAt is t in printer-up-time seconds, which start at 1.
+func (p *printer) upTimeAt(t time.Time) int {
+	return int(t.Sub(p.start).Seconds()) + 1
+}
+
+func (p *printer) jobResponse(req *goipp.Message, j *job) *goipp.Message {
+	resp := response(req, goipp.StatusOk, "")
+	for _, a := range p.jobAttrs(j) {
+		switch a.Name {
+		case "job-id", "job-uri", "job-state", "job-state-reasons":
+			resp.Job.Add(a)
+		}
+	}
+	return resp
+}
+
+// requested returns the filter for requested-attributes; nil means all.
+func requested(req *goipp.Message) map[string]bool {
+	var names map[string]bool
+	for _, a := range req.Operation {
+		if a.Name != "requested-attributes" {
+			continue
+		}
+		names = map[string]bool{}
+		for _, v := range a.Values {
+			switch name := v.V.String(); name {
+			case "all", "printer-description", "job-template", "job-description", "job-status":
+				return nil
+			default:
+				names[name] = true
+			}
+		}
+	}
+	return names
+}
+
+func filterAttrs(attrs goipp.Attributes, names map[string]bool) goipp.Attributes {
+	if names == nil {
+		return attrs
+	}
+	var out goipp.Attributes
+	for _, a := range attrs {
+		if names[a.Name] {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func (p *printer) getJobAttributes(req *goipp.Message) *goipp.Message {
+	j, resp := p.findJob(req)
+	if resp != nil {
+		return resp
+	}
+	resp = response(req, goipp.StatusOk, "")
+	resp.Job = filterAttrs(p.jobAttrs(j), requested(req))
+	return resp
+}
+
+func (p *printer) getJobs(req *goipp.Message) *goipp.Message {
+	which := attrString(req.Operation, "which-jobs")
+	switch which {
+	case "", "not-completed", "completed", "all":
+	default:
+		resp := response(req, goipp.StatusErrorAttributesOrValues, fmt.Sprintf("Unsupported which-jobs %q.", which))
+		resp.Unsupported.Add(goipp.MakeAttribute("which-jobs", goipp.TagKeyword, goipp.String(which)))
+		return resp
+	}
+	limit := 0
+	if v, ok := attrValue(req.Operation, "limit"); ok {
+		if n, ok := v.(goipp.Integer); ok {
+			limit = int(n)
+		}
+	}
+	p.mu.Lock()
+	var jobs []*job
+	for i := len(p.jobs) - 1; i >= 0; i-- {
+		j := p.jobs[i]
+		done := j.state >= jobCanceled
+		if which == "all" || which == "completed" && done || (which == "" || which == "not-completed") && !done {
+			jobs = append(jobs, j)
+		}
+	}
+	p.mu.Unlock()
+	if limit > 0 && len(jobs) > limit {
+		jobs = jobs[:limit]
+	}
+	names := requested(req)
+	if names == nil && !hasAttr(req.Operation, "requested-attributes") {
+		names = map[string]bool{"job-id": true, "job-uri": true}
+	}
+	resp := response(req, goipp.StatusOk, "")
+	for _, j := range jobs {
+		resp.Groups.Add(goipp.Group{Tag: goipp.TagJobGroup, Attrs: filterAttrs(p.jobAttrs(j), names)})
+	}
+	return resp
+}
+
+func hasAttr(attrs goipp.Attributes, name string) bool {
+	_, ok := attrValue(attrs, name)
+	return ok
+}
+
+func (p *printer) getPrinterAttributes(req *goipp.Message) *goipp.Message {
+	resp := response(req, goipp.StatusOk, "")
+	resp.Printer = filterAttrs(p.printerAttrs(), requested(req))
+	return resp
+}
+
+// detectFormat recognizes the formats an IPP Everywhere printer takes by
+// their leading bytes.
+func detectFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("%PDF")):
+		return "application/pdf"
+	case bytes.HasPrefix(data, []byte("RaS2")):
+		return "image/pwg-raster"
+	case bytes.HasPrefix(data, []byte("UNIRAST\x00")):
+		return "image/urf"
+	case bytes.HasPrefix(data, []byte("\xff\xd8\xff")):
+		return "image/jpeg"
+	}
+	return ""
+}
+
+func formatExt(format string) string {
+	switch format {
+	case "application/pdf":
+		return "pdf"
+	case "image/pwg-raster":
+		return "pwg"
+	case "image/urf":
+		return "urf"
+	case "image/jpeg":
+		return "jpg"
+	}
+	return "prn"
+}
+
+// countPages counts the pages of raster documents; PDF and JPEG count as
+// one impression, which is enough for a virtual printer.
+func countPages(format string, data []byte) int {
+	switch format {
+	case "image/pwg-raster":
+		// Each page starts with a 1796-byte header naming the media
+		// class; count the "PwgRaster" sync words.
+		if n := bytes.Count(data, []byte("PwgRaster\x00")); n > 0 {
+			return n
+		}
+	case "image/urf":
+		// The file header holds the page count as a big-endian uint32.
+		if len(data) >= 12 {
+			if n := int(data[8])<<24 | int(data[9])<<16 | int(data[10])<<8 | int(data[11]); n > 0 {
+				return n
+			}
+		}
+	}
+	return 1
+}
@@ -0,0 +1,298 @@
+package ippfind
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+	"github.com/hashicorp/mdns"
+
+	"cupsgolang/internal/cupsclient"
+)
+
+// service is one resolved DNS-SD service instance.
+type service struct {
+	name    string
+	regtype string
+	domain  string
+	host    string
+	addr    string
+	port    int
+	txt     map[string]string
+	// txtKeys keeps the TXT keys in record order for the environment of
+	// --exec.
+	txtKeys []string
+}
+
+// browser finds the services of regtype in domain, calling found for each
+// one as it resolves. family is "", "tcp4" or "tcp6".
+type browser func(ctx context.Context, regtype, domain string, timeout time.Duration, family string, found func(service))
+
+// browse is replaced in tests.
+var browse browser = browseMDNS
+
+func browseMDNS(ctx context.Context, regtype, domain string, timeout time.Duration, family string, found func(service)) {
+	// Instances of a subtype are named after the base type.
+	base := regtype
+	if _, after, ok := strings.Cut(regtype, "._sub."); ok {
+		base = after
+	}
+	entries := make(chan *mdns.ServiceEntry, 64)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for entry := range entries {
+			if entry == nil || entry.Port == 0 {
+				continue
+			}
+			found(serviceFromEntry(entry, base, domain))
+		}
+	}()
+	params := &mdns.QueryParam{
+		Service:     regtype,
+		Domain:      domain,
+		Timeout:     timeout,
+		Entries:     entries,
+		DisableIPv4: family == "tcp6",
+		DisableIPv6: family == "tcp4",
+	}
+	done := make(chan struct{})
+	go func() {
+		_ = mdns.Query(params)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		// mdns.Query has no context; its timeout still ends it.
+		<-done
+	}
+	close(entries)
+	wg.Wait()
+}
+
+func serviceFromEntry(entry *mdns.ServiceEntry, regtype, domain string) service {
+	s := service{
+		name:    instanceName(entry.Name, regtype, domain),
+		regtype: regtype,
+		domain:  domain,
+		host:    strings.TrimSuffix(entry.Host, "."),
+		port:    entry.Port,
+		txt:     map[string]string{},
+	}
+	if entry.AddrV4 != nil {
+		s.addr = entry.AddrV4.String()
+	} else if entry.AddrV6 != nil {
+		s.addr = entry.AddrV6.String()
+	}
+	if s.host == "" {
+		s.host = s.addr
+	}
+	for _, field := range entry.InfoFields {
+		key, value, _ := strings.Cut(field, "=")
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			if _, ok := s.txt[key]; !ok {
+				s.txtKeys = append(s.txtKeys, key)
+			}
+			s.txt[key] = value
+		}
+	}
+	return s
+}
+
+// instanceName strips the service type and domain from a full DNS-SD name
+// and undoes the DNS escaping of its instance label.
+func instanceName(full, regtype, domain string) string {
+	name := strings.TrimSuffix(full, ".")
+	name = strings.TrimSuffix(name, "."+domain)
+	name = strings.TrimSuffix(name, "."+regtype)
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '\\' && i+1 < len(name) {
+			if i+3 < len(name) && isDigit(name[i+1]) && isDigit(name[i+2]) && isDigit(name[i+3]) {
+				n, _ := strconv.Atoi(name[i+1 : i+4])
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+			i++
+		}
+		b.WriteByte(name[i])
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// scheme is the URI scheme for the service type, or "" when the service
+// has no URI form.
+func (s service) scheme() string {
+	switch strings.TrimSuffix(s.regtype, "._tcp") {
+	case "_ipp":
+		return "ipp"
+	case "_ipps", "_ipp-tls":
+		return "ipps"
+	case "_http":
+		return "http"
+	case "_https":
+		return "https"
+	case "_printer":
+		return "lpd"
+	case "_pdl-datastream":
+		return "socket"
+	}
+	return ""
+}
+
+// resource is the path from the rp TXT key.
+func (s service) resource() string {
+	return "/" + strings.TrimPrefix(s.txt["rp"], "/")
+}
+
+func (s service) uri() string {
+	scheme := s.scheme()
+	if scheme == "" {
+		return ""
+	}
+	host := net.JoinHostPort(s.host, strconv.Itoa(s.port))
+	if scheme == "socket" {
+		return scheme + "://" + host
+	}
+	return scheme + "://" + host + s.resource()
+}
+
+// isLocal reports whether the service runs on this host.
+func (s service) isLocal() bool {
+	host := strings.ToLower(strings.TrimSuffix(s.host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	if name, err := os.Hostname(); err == nil {
+		name = strings.ToLower(strings.TrimSuffix(name, ".local"))
+		if host == name || host == name+".local" {
+			return true
+		}
+	}
+	addr := net.ParseIP(s.addr)
+	if addr == nil {
+		addr = net.ParseIP(host)
+	}
+	if addr == nil {
+		return false
+	}
+	if addr.IsLoopback() {
+		return true
+	}
+	ifaddrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, a := range ifaddrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.Equal(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// probeResult is what --ls reports for a service.
+type probeResult struct {
+	available bool
+	state     string
+	accepting bool
+	reasons   []string
+}
+
+// probe asks an IPP service for its state with Get-Printer-Attributes and
+// checks that other services accept connections.
+func probe(ctx context.Context, s service, version goipp.Version, timeout time.Duration, family string) probeResult {
+	host := s.host
+	if s.addr != "" {
+		host = s.addr
+	}
+	addr := net.JoinHostPort(host, strconv.Itoa(s.port))
+	switch s.scheme() {
+	case "ipp", "ipps":
+	default:
+		network := family
+		if network == "" {
+			network = "tcp"
+		}
+		conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, network, addr)
+		if err != nil {
+			return probeResult{}
+		}
+		conn.Close()
+		return probeResult{available: true}
+	}
+	client := cupsclient.NewFromConfig(
+		cupsclient.WithServer(addr),
+		cupsclient.WithTLS(s.scheme() == "ipps"),
+	)
+	req := goipp.NewRequest(version, goipp.OpGetPrinterAttributes, 1)
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en")))
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String(s.uri())))
+	requested := goipp.MakeAttribute("requested-attributes", goipp.TagKeyword, goipp.String("printer-state"))
+	requested.Values.Add(goipp.TagKeyword, goipp.String("printer-state-reasons"))
+	requested.Values.Add(goipp.TagKeyword, goipp.String("printer-is-accepting-jobs"))
+	req.Operation.Add(requested)
+	resp, _, err := client.Do(ctx, cupsclient.Request{Resource: s.resource(), Message: req, Network: family, Timeout: timeout})
+	if err != nil || goipp.Status(resp.Code) >= goipp.StatusRedirectionOtherSite {
+		return probeResult{}
+	}
+	out := probeResult{available: true, state: "unknown"}
+	for _, a := range resp.Printer {
+		if len(a.Values) == 0 {
+			continue
+		}
+		switch a.Name {
+		case "printer-state":
+			if n, ok := a.Values[0].V.(goipp.Integer); ok {
+				switch n {
+				case 3:
+					out.state = "idle"
+				case 4:
+					out.state = "processing"
+				case 5:
+					out.state = "stopped"
+				}
+			}
+		case "printer-is-accepting-jobs":
+			if b, ok := a.Values[0].V.(goipp.Boolean); ok {
+				out.accepting = bool(b)
+			}
+		case "printer-state-reasons":
+			for _, v := range a.Values {
+				out.reasons = append(out.reasons, v.V.String())
+			}
+		}
+	}
+	if len(out.reasons) == 0 {
+		out.reasons = []string{"none"}
+	}
+	return out
+}
+
+// String formats r the way --ls prints it after the URI.
+func (r probeResult) String() string {
+	if !r.available {
+		return "unavailable"
+	}
+	if r.state == "" {
+		return "available"
+	}
+	accepting := "not-accepting-jobs"
+	if r.accepting {
+		accepting = "accepting-jobs"
+	}
+	return r.state + " " + accepting + " " + strings.Join(r.reasons, ",")
+}
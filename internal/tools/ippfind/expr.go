@@ -0,0 +1,417 @@
+package ippfind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// exprKind is the kind of an expression node.
+type exprKind int
+
+const (
+	exprTrue exprKind = iota
+	exprFalse
+	exprAnd
+	exprOr
+	exprNot
+	exprDomain
+	exprHost
+	exprName
+	exprPath
+	exprURI
+	exprPort
+	exprTxtExists
+	exprTxtMatch
+	exprLocal
+	exprRemote
+	exprExec
+	exprList
+	exprPrint
+	exprPrintName
+	exprQuiet
+)
+
+// expr is a node of the expression that selects and acts on services.
+type expr struct {
+	kind     exprKind
+	children []*expr
+	re       *regexp.Regexp
+	key      string
+	low      int
+	high     int
+	argv     []string
+}
+
+// isAction reports whether e prints or runs something, which turns off
+// the default --print.
+func (e *expr) isAction() bool {
+	switch e.kind {
+	case exprExec, exprList, exprPrint, exprPrintName, exprQuiet:
+		return true
+	}
+	for _, c := range e.children {
+		if c.isAction() {
+			return true
+		}
+	}
+	return false
+}
+
+// exprParser parses the expression tokens left after the options and
+// service types: primaries joined by --and (or juxtaposition), --or,
+// --not and parentheses, with the usual precedence.
+type exprParser struct {
+	tokens []string
+	pos    int
+}
+
+func parseExpr(tokens []string) (*expr, error) {
+	if len(tokens) == 0 {
+		return &expr{kind: exprTrue}, nil
+	}
+	p := &exprParser{tokens: tokens}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %q in expression", p.tokens[p.pos])
+	}
+	return e, nil
+}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", errors.New("unexpected end of expression")
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok, nil
+}
+
+func (p *exprParser) parseOr() (*expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "--or" || p.peek() == "-o" {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &expr{kind: exprOr, children: []*expr{left, right}}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (*expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		switch tok {
+		case "", ")", "--or", "-o":
+			return left, nil
+		case "--and", "-a":
+			p.pos++
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &expr{kind: exprAnd, children: []*expr{left, right}}
+	}
+}
+
+func (p *exprParser) parseUnary() (*expr, error) {
+	tok, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case "!", "--not":
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &expr{kind: exprNot, children: []*expr{e}}, nil
+	case "(":
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if close, err := p.next(); err != nil || close != ")" {
+			return nil, errors.New("missing \")\" in expression")
+		}
+		return e, nil
+	}
+	return p.parsePrimary(tok)
+}
+
+func (p *exprParser) regexArg(tok string) (*regexp.Regexp, error) {
+	arg, err := p.next()
+	if err != nil {
+		return nil, fmt.Errorf("missing regular expression after %s", tok)
+	}
+	re, err := regexp.Compile("(?i)" + arg)
+	if err != nil {
+		return nil, fmt.Errorf("bad regular expression %q: %v", arg, err)
+	}
+	return re, nil
+}
+
+func (p *exprParser) parsePrimary(tok string) (*expr, error) {
+	var kind exprKind
+	switch tok {
+	case "--true":
+		return &expr{kind: exprTrue}, nil
+	case "--false":
+		return &expr{kind: exprFalse}, nil
+	case "--local":
+		return &expr{kind: exprLocal}, nil
+	case "--remote", "-r":
+		return &expr{kind: exprRemote}, nil
+	case "--ls", "-l":
+		return &expr{kind: exprList}, nil
+	case "--print", "-p":
+		return &expr{kind: exprPrint}, nil
+	case "--print-name", "-s":
+		return &expr{kind: exprPrintName}, nil
+	case "--quiet", "-q":
+		return &expr{kind: exprQuiet}, nil
+	case "--domain", "-d":
+		kind = exprDomain
+	case "--host", "-h":
+		kind = exprHost
+	case "--name", "-N":
+		kind = exprName
+	case "--path":
+		kind = exprPath
+	case "--uri", "-u":
+		kind = exprURI
+	case "--txt", "-t":
+		key, err := p.next()
+		if err != nil {
+			return nil, fmt.Errorf("missing key after %s", tok)
+		}
+		return &expr{kind: exprTxtExists, key: strings.ToLower(key)}, nil
+	case "--port", "-P":
+		arg, err := p.next()
+		if err != nil {
+			return nil, fmt.Errorf("missing port after %s", tok)
+		}
+		low, high, err := parsePortRange(arg)
+		if err != nil {
+			return nil, err
+		}
+		return &expr{kind: exprPort, low: low, high: high}, nil
+	case "--exec", "-x":
+		var argv []string
+		for {
+			arg, err := p.next()
+			if err != nil {
+				return nil, fmt.Errorf("missing \";\" after %s", tok)
+			}
+			if arg == ";" {
+				break
+			}
+			argv = append(argv, arg)
+		}
+		if len(argv) == 0 {
+			return nil, fmt.Errorf("missing program after %s", tok)
+		}
+		return &expr{kind: exprExec, argv: argv}, nil
+	default:
+		if key, ok := strings.CutPrefix(tok, "--txt-"); ok && key != "" {
+			re, err := p.regexArg(tok)
+			if err != nil {
+				return nil, err
+			}
+			return &expr{kind: exprTxtMatch, key: strings.ToLower(key), re: re}, nil
+		}
+		return nil, fmt.Errorf("unknown expression %q", tok)
+	}
+	re, err := p.regexArg(tok)
+	if err != nil {
+		return nil, err
+	}
+	return &expr{kind: kind, re: re}, nil
+}
+
+func parsePortRange(arg string) (int, int, error) {
+	lowText, highText, isRange := strings.Cut(arg, "-")
+	low, err := strconv.Atoi(lowText)
+	if err != nil || low < 1 || low > 65535 {
+		return 0, 0, fmt.Errorf("bad port %q", arg)
+	}
+	high := low
+	if isRange {
+		if high, err = strconv.Atoi(highText); err != nil || high < low || high > 65535 {
+			return 0, 0, fmt.Errorf("bad port range %q", arg)
+		}
+	}
+	return low, high, nil
+}
+
+// evaluator holds what the actions need.
+type evaluator struct {
+	out   io.Writer
+	probe func(context.Context, service) probeResult
+}
+
+func (ev *evaluator) eval(ctx context.Context, e *expr, s service) bool {
+	switch e.kind {
+	case exprTrue, exprQuiet:
+		return true
+	case exprFalse:
+		return false
+	case exprAnd:
+		return ev.eval(ctx, e.children[0], s) && ev.eval(ctx, e.children[1], s)
+	case exprOr:
+		return ev.eval(ctx, e.children[0], s) || ev.eval(ctx, e.children[1], s)
+	case exprNot:
+		return !ev.eval(ctx, e.children[0], s)
+	case exprDomain:
+		return e.re.MatchString(s.domain)
+	case exprHost:
+		return e.re.MatchString(s.host)
+	case exprName:
+		return e.re.MatchString(s.name)
+	case exprPath:
+		return e.re.MatchString(s.resource())
+	case exprURI:
+		return e.re.MatchString(s.uri())
+	case exprPort:
+		return s.port >= e.low && s.port <= e.high
+	case exprTxtExists:
+		_, ok := s.txt[e.key]
+		return ok
+	case exprTxtMatch:
+		v, ok := s.txt[e.key]
+		return ok && e.re.MatchString(v)
+	case exprLocal:
+		return s.isLocal()
+	case exprRemote:
+		return !s.isLocal()
+	case exprPrint:
+		fmt.Fprintln(ev.out, serviceURIOrName(s))
+		return true
+	case exprPrintName:
+		fmt.Fprintln(ev.out, s.name)
+		return true
+	case exprList:
+		r := ev.probe(ctx, s)
+		fmt.Fprintln(ev.out, serviceURIOrName(s), r.String())
+		return r.available
+	case exprExec:
+		return ev.exec(ctx, e.argv, s)
+	}
+	return false
+}
+
+// serviceURIOrName is the URI, or the full DNS-SD name for service types
+// without one.
+func serviceURIOrName(s service) string {
+	if uri := s.uri(); uri != "" {
+		return uri
+	}
+	return s.name + "." + s.regtype + "." + s.domain
+}
+
+// exec runs argv with the service substituted and reports whether it
+// exited successfully.
+func (ev *evaluator) exec(ctx context.Context, argv []string, s service) bool {
+	args := make([]string, len(argv))
+	for i, arg := range argv {
+		args[i] = substitute(arg, s)
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdout = ev.out
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), serviceEnv(s)...)
+	return cmd.Run() == nil
+}
+
+// substitute expands {} and the {service_*} and {txt_*} placeholders of
+// an --exec argument.
+func substitute(arg string, s service) string {
+	var b strings.Builder
+	for {
+		start := strings.IndexByte(arg, '{')
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(arg[start:], '}')
+		if end < 0 {
+			break
+		}
+		end += start
+		b.WriteString(arg[:start])
+		name := arg[start+1 : end]
+		if value, ok := placeholder(name, s); ok {
+			b.WriteString(value)
+		} else {
+			b.WriteString(arg[start : end+1])
+		}
+		arg = arg[end+1:]
+	}
+	b.WriteString(arg)
+	return b.String()
+}
+
+func placeholder(name string, s service) (string, bool) {
+	switch name {
+	case "", "service_uri":
+		return serviceURIOrName(s), true
+	case "service_domain":
+		return s.domain, true
+	case "service_hostname":
+		return s.host, true
+	case "service_name":
+		return s.name, true
+	case "service_port":
+		return strconv.Itoa(s.port), true
+	case "service_regtype":
+		return s.regtype, true
+	case "service_scheme":
+		return s.scheme(), true
+	}
+	if key, ok := strings.CutPrefix(name, "txt_"); ok {
+		return s.txt[strings.ToLower(key)], true
+	}
+	return "", false
+}
+
+// serviceEnv is the IPPFIND_* environment for --exec programs.
+func serviceEnv(s service) []string {
+	env := []string{
+		"IPPFIND_SERVICE_DOMAIN=" + s.domain,
+		"IPPFIND_SERVICE_HOSTNAME=" + s.host,
+		"IPPFIND_SERVICE_NAME=" + s.name,
+		"IPPFIND_SERVICE_PORT=" + strconv.Itoa(s.port),
+		"IPPFIND_SERVICE_REGTYPE=" + s.regtype,
+		"IPPFIND_SERVICE_SCHEME=" + s.scheme(),
+		"IPPFIND_SERVICE_URI=" + serviceURIOrName(s),
+	}
+	for _, key := range s.txtKeys {
+		env = append(env, "IPPFIND_TXT_"+strings.ToUpper(strings.ReplaceAll(key, "-", "_"))+"="+s.txt[key])
+	}
+	return env
+}
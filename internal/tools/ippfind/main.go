@@ -0,0 +1,261 @@
+package ippfind
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+var errShowHelp = errors.New("show-help")
+
+// Exit statuses, as documented for CUPS's ippfind.
+const (
+	exitFalse  = 1
+	exitSyntax = 3
+)
+
+type options struct {
+	regtypes []string
+	expr     *expr
+	family   string
+	timeout  time.Duration
+	version  goipp.Version
+}
+
+// Main runs ippfind with os.Args.
+func Main() {
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, errShowHelp) {
+		usage()
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ippfind:", err)
+		usage()
+		os.Exit(exitSyntax)
+	}
+	// The mDNS client logs each query to the standard logger; keep the
+	// output clean for scripts.
+	log.SetOutput(io.Discard)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if !run(ctx, opts, os.Stdout) {
+		os.Exit(exitFalse)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: ippfind [options] regtype[,subtype][.domain.] ... [expression]")
+	fmt.Println("       ippfind [options] name[.regtype[.domain.]] ... [expression]")
+	fmt.Println("       ippfind --help")
+	fmt.Println("Options:")
+	fmt.Println("-4                      Connect using IPv4")
+	fmt.Println("-6                      Connect using IPv6")
+	fmt.Println("-T seconds              Set the browse timeout in seconds (default=1)")
+	fmt.Println("-V version              Set default IPP version for --ls")
+	fmt.Println("--help                  Show this help")
+	fmt.Println("Expressions:")
+	fmt.Println("-P number[-number]      Match port to number or range")
+	fmt.Println("-d regex                Match domain to regular expression")
+	fmt.Println("-h regex                Match hostname to regular expression")
+	fmt.Println("-l                      List attributes")
+	fmt.Println("-N regex                Match service name to regular expression")
+	fmt.Println("-p                      Print URI if true")
+	fmt.Println("-q                      Quietly report match via exit code")
+	fmt.Println("-r                      True if service is remote")
+	fmt.Println("-s                      Print service name if true")
+	fmt.Println("-t key                  True if the TXT record contains the key")
+	fmt.Println("-u regex                Match URI to regular expression")
+	fmt.Println("-x utility [argument ...] ;")
+	fmt.Println("                        Execute program if true")
+	fmt.Println("--domain regex          Match domain to regular expression")
+	fmt.Println("--exec utility [argument ...] ;")
+	fmt.Println("                        Execute program if true")
+	fmt.Println("--host regex            Match hostname to regular expression")
+	fmt.Println("--local                 True if service is local")
+	fmt.Println("--ls                    List attributes")
+	fmt.Println("--name regex            Match service name to regular expression")
+	fmt.Println("--path regex            Match resource path to regular expression")
+	fmt.Println("--port number[-number]  Match port to number or range")
+	fmt.Println("--print                 Print URI if true")
+	fmt.Println("--print-name            Print service name if true")
+	fmt.Println("--quiet                 Quietly report match via exit code")
+	fmt.Println("--remote                True if service is remote")
+	fmt.Println("--txt key               True if the TXT record contains the key")
+	fmt.Println("--txt-* regex           Match TXT record key to regular expression")
+	fmt.Println("--uri regex             Match URI to regular expression")
+	fmt.Println("Grouping and logic:")
+	fmt.Println("( expressions )         Group expressions")
+	fmt.Println("! expression            Unary NOT of expression")
+	fmt.Println("--not expression        Unary NOT of expression")
+	fmt.Println("--false                 Always false")
+	fmt.Println("--true                  Always true")
+	fmt.Println("expression expression   Logical AND")
+	fmt.Println("expression --and expression")
+	fmt.Println("                        Logical AND")
+	fmt.Println("expression --or expression")
+	fmt.Println("                        Logical OR")
+	fmt.Println("Substitutions for --exec:")
+	fmt.Println("{}                      URI")
+	fmt.Println("{service_domain}        Domain name")
+	fmt.Println("{service_hostname}      Fully-qualified domain name")
+	fmt.Println("{service_name}          Service instance name")
+	fmt.Println("{service_port}          Port number")
+	fmt.Println("{service_regtype}       DNS-SD registration type")
+	fmt.Println("{service_scheme}        URI scheme")
+	fmt.Println("{service_uri}           URI")
+	fmt.Println("{txt_*}                 Value of TXT record key")
+}
+
+// parseArgs reads the options and service types; everything from the
+// first expression token on is the expression.
+func parseArgs(args []string) (options, error) {
+	opts := options{timeout: time.Second, version: goipp.MakeVersion(2, 0)}
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--help":
+			return opts, errShowHelp
+		case "-4":
+			opts.family = "tcp4"
+			continue
+		case "-6":
+			opts.family = "tcp6"
+			continue
+		case "-T", "-V":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("missing argument for %s", arg)
+			}
+			i++
+			if arg == "-T" {
+				secs, err := strconv.ParseFloat(args[i], 64)
+				if err != nil || secs <= 0 {
+					return opts, fmt.Errorf("bad timeout %q", args[i])
+				}
+				opts.timeout = time.Duration(secs * float64(time.Second))
+			} else {
+				switch args[i] {
+				case "1.1":
+					opts.version = goipp.MakeVersion(1, 1)
+				case "2.0":
+					opts.version = goipp.MakeVersion(2, 0)
+				case "2.1":
+					opts.version = goipp.MakeVersion(2, 1)
+				case "2.2":
+					opts.version = goipp.MakeVersion(2, 2)
+				default:
+					return opts, fmt.Errorf("bad version %q", args[i])
+				}
+			}
+			continue
+		}
+		if strings.HasPrefix(arg, "-") || arg == "(" || arg == "!" {
+			break
+		}
+		opts.regtypes = append(opts.regtypes, arg)
+	}
+	if len(opts.regtypes) == 0 {
+		opts.regtypes = []string{"_ipp._tcp"}
+	}
+	e, err := parseExpr(args[i:])
+	if err != nil {
+		return opts, err
+	}
+	if !e.isAction() {
+		e = &expr{kind: exprAnd, children: []*expr{e, {kind: exprPrint}}}
+	}
+	opts.expr = e
+	return opts, nil
+}
+
+// query is a browse request built from a regtype argument.
+type query struct {
+	// service is what is browsed for, which includes a subtype.
+	service string
+	regtype string
+	domain  string
+	// name limits the results to one instance.
+	name string
+}
+
+// parseRegtype reads regtype[,subtype][.domain.] and
+// name[.regtype[.domain.]].
+func parseRegtype(arg string) query {
+	q := query{regtype: arg, domain: "local"}
+	idx := strings.Index(arg, "._tcp")
+	if idx < 0 {
+		if !strings.HasPrefix(arg, "_") {
+			q.name, q.regtype = arg, "_ipp._tcp"
+		}
+		q.service = q.regtype
+		return q
+	}
+	if start := strings.LastIndex(arg[:idx], "._"); start >= 0 && !strings.HasPrefix(arg, "_") {
+		q.name = arg[:start]
+		arg = arg[start+1:]
+		idx -= start + 1
+	}
+	q.regtype = arg[:idx+len("._tcp")]
+	q.service = q.regtype
+	rest := arg[idx+len("._tcp"):]
+	if sub, ok := strings.CutPrefix(rest, ","); ok {
+		sub, rest, _ = strings.Cut(sub, ".")
+		q.service = sub + "._sub." + q.regtype
+	}
+	if rest = strings.Trim(rest, "."); rest != "" {
+		q.domain = rest
+	}
+	return q
+}
+
+// run browses for the service types, evaluates the expression for each
+// service found and reports whether it was true for any of them.
+func run(ctx context.Context, opts options, out io.Writer) bool {
+	ev := &evaluator{
+		out: out,
+		probe: func(ctx context.Context, s service) probeResult {
+			return probe(ctx, s, opts.version, opts.timeout, opts.family)
+		},
+	}
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	matched := false
+	var wg sync.WaitGroup
+	for _, arg := range opts.regtypes {
+		q := parseRegtype(arg)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			browse(ctx, q.service, q.domain, opts.timeout, opts.family, func(s service) {
+				s.regtype = q.regtype
+				if q.name != "" && !strings.EqualFold(s.name, q.name) {
+					return
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				key := s.name + "." + s.regtype + "." + s.domain
+				if seen[key] {
+					return
+				}
+				seen[key] = true
+				if ev.eval(ctx, opts.expr, s) {
+					matched = true
+				}
+			})
+		}()
+	}
+	wg.Wait()
+	return matched
+}
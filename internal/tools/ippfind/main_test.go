@@ -0,0 +1,188 @@
+package ippfind
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-4", "-T", "2.5", "_ipp._tcp", "_ipps._tcp", "--name", "^office", "--or", "!", "--txt", "UUID", "--ls"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if opts.family != "tcp4" || opts.timeout != 2500*time.Millisecond || strings.Join(opts.regtypes, ",") != "_ipp._tcp,_ipps._tcp" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	// --and binds tighter than --or, and --ls turns off the default --print.
+	if opts.expr.kind != exprOr || opts.expr.children[0].kind != exprName || opts.expr.children[1].kind != exprAnd {
+		t.Fatalf("unexpected expression tree: %+v", opts.expr)
+	}
+
+	opts, err = parseArgs(nil)
+	if err != nil || opts.regtypes[0] != "_ipp._tcp" || !opts.expr.isAction() {
+		t.Fatalf("defaults: %+v %v", opts, err)
+	}
+	if _, err := parseArgs([]string{"--help"}); !errors.Is(err, errShowHelp) {
+		t.Fatalf("expected errShowHelp, got %v", err)
+	}
+	for _, bad := range [][]string{
+		{"--name"},
+		{"--name", "("},
+		{"(", "--true"},
+		{"--exec", "echo"},
+		{"--port", "10-5"},
+		{"--bogus"},
+		{"-T", "0"},
+	} {
+		if _, err := parseArgs(bad); err == nil {
+			t.Fatalf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseRegtype(t *testing.T) {
+	cases := map[string]query{
+		"_ipp._tcp":               {service: "_ipp._tcp", regtype: "_ipp._tcp", domain: "local"},
+		"_ipp._tcp,_print":        {service: "_print._sub._ipp._tcp", regtype: "_ipp._tcp", domain: "local"},
+		"_ipps._tcp.example.com.": {service: "_ipps._tcp", regtype: "_ipps._tcp", domain: "example.com"},
+		"Office._ipp._tcp.local.": {service: "_ipp._tcp", regtype: "_ipp._tcp", domain: "local", name: "Office"},
+		"Office":                  {service: "_ipp._tcp", regtype: "_ipp._tcp", domain: "local", name: "Office"},
+	}
+	for arg, want := range cases {
+		if got := parseRegtype(arg); got != want {
+			t.Errorf("parseRegtype(%q) = %+v, want %+v", arg, got, want)
+		}
+	}
+	if got := instanceName(`My\032Printer\.2._ipp._tcp.local.`, "_ipp._tcp", "local"); got != "My Printer.2" {
+		t.Fatalf("instanceName = %q", got)
+	}
+}
+
+// fakeBrowse serves services as if they were found on the network.
+func fakeBrowse(t *testing.T, services ...service) {
+	t.Helper()
+	saved := browse
+	browse = func(_ context.Context, regtype, domain string, _ time.Duration, _ string, found func(service)) {
+		for _, s := range services {
+			if s.regtype == regtype && s.domain == domain {
+				found(s)
+			}
+		}
+	}
+	t.Cleanup(func() { browse = saved })
+}
+
+func testService(name, host string, port int, txt map[string]string) service {
+	s := service{name: name, regtype: "_ipp._tcp", domain: "local", host: host, port: port, txt: txt}
+	for k := range txt {
+		s.txtKeys = append(s.txtKeys, k)
+	}
+	return s
+}
+
+func runArgs(t *testing.T, args ...string) (string, bool) {
+	t.Helper()
+	opts, err := parseArgs(args)
+	if err != nil {
+		t.Fatalf("parseArgs(%q): %v", args, err)
+	}
+	var out bytes.Buffer
+	ok := run(context.Background(), opts, &out)
+	return out.String(), ok
+}
+
+func TestExpressions(t *testing.T) {
+	fakeBrowse(t,
+		testService("Office Laser", "office.example.com", 631, map[string]string{"rp": "printers/office", "ty": "Acme Laser", "color": "F"}),
+		testService("Lab Color", "lab.example.com", 8631, map[string]string{"rp": "ipp/print", "ty": "Acme Color", "color": "T", "uuid": "1234"}),
+	)
+	cases := []struct {
+		args []string
+		want string
+		ok   bool
+	}{
+		{nil, "ipp://lab.example.com:8631/ipp/print\nipp://office.example.com:631/printers/office\n", true},
+		{[]string{"--name", "^office"}, "ipp://office.example.com:631/printers/office\n", true},
+		{[]string{"--txt-color", "^t$", "-s"}, "Lab Color\n", true},
+		{[]string{"(", "--txt", "uuid", "--or", "--port", "600-700", ")", "-s"}, "Lab Color\nOffice Laser\n", true},
+		{[]string{"--txt", "uuid", "--or", "--port", "600-700", "-s"}, "Office Laser\n", true},
+		{[]string{"!", "(", "--host", "lab", "--path", "^/ipp/", ")", "-s"}, "Office Laser\n", true},
+		{[]string{"--name", "nothing", "--quiet"}, "", false},
+		{[]string{"--remote", "--quiet"}, "", true},
+	}
+	for _, tc := range cases {
+		out, ok := runArgs(t, tc.args...)
+		lines := strings.SplitAfter(out, "\n")
+		// Services are evaluated in discovery order; compare sorted.
+		sort.Strings(lines)
+		if strings.Join(lines, "") != tc.want || ok != tc.ok {
+			t.Errorf("%q: got %q ok=%v, want %q ok=%v", tc.args, out, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestExecSubstitution(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	fakeBrowse(t, testService("Office", "office.example.com", 631, map[string]string{"rp": "ipp/print", "ty": "Acme Laser"}))
+	out, ok := runArgs(t, "--exec", "sh", "-c", `echo "$1|$2|$3|$IPPFIND_TXT_TY|$IPPFIND_SERVICE_PORT"`, "sh", "{}", "{service_name}", "{txt_ty}", ";")
+	if !ok || out != "ipp://office.example.com:631/ipp/print|Office|Acme Laser|Acme Laser|631\n" {
+		t.Fatalf("exec output %q ok=%v", out, ok)
+	}
+	if _, ok := runArgs(t, "--exec", "sh", "-c", "exit 1", ";", "--print"); ok {
+		t.Fatalf("expected a failing --exec to make the expression false")
+	}
+}
+
+func TestListProbesPrinter(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &goipp.Message{}
+		if err := req.Decode(r.Body); err != nil || goipp.Op(req.Code) != goipp.OpGetPrinterAttributes || r.URL.Path != "/ipp/print" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		resp := goipp.NewResponse(req.Version, goipp.StatusOk, req.RequestID)
+		resp.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+		resp.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en")))
+		resp.Printer.Add(goipp.MakeAttribute("printer-state", goipp.TagEnum, goipp.Integer(5)))
+		resp.Printer.Add(goipp.MakeAttribute("printer-is-accepting-jobs", goipp.TagBoolean, goipp.Boolean(true)))
+		reasons := goipp.MakeAttribute("printer-state-reasons", goipp.TagKeyword, goipp.String("media-jam-error"))
+		reasons.Values.Add(goipp.TagKeyword, goipp.String("offline-report"))
+		resp.Printer.Add(reasons)
+		data, _ := resp.EncodeBytes()
+		w.Header().Set("Content-Type", goipp.ContentType)
+		w.Write(data)
+	}))
+	defer srv.Close()
+	host, portText, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	port, _ := strconv.Atoi(portText)
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedPort := closed.Addr().(*net.TCPAddr).Port
+	closed.Close()
+
+	fakeBrowse(t,
+		testService("Jammed", host, port, map[string]string{"rp": "ipp/print"}),
+		testService("Gone", host, closedPort, map[string]string{"rp": "ipp/print"}),
+	)
+	out, ok := runArgs(t, "--name", "Jammed", "--ls")
+	if !ok || out != "ipp://"+net.JoinHostPort(host, portText)+"/ipp/print stopped accepting-jobs media-jam-error,offline-report\n" {
+		t.Fatalf("--ls output %q ok=%v", out, ok)
+	}
+	out, ok = runArgs(t, "--name", "Gone", "--ls")
+	if ok || !strings.HasSuffix(out, " unavailable\n") {
+		t.Fatalf("--ls for an unreachable printer: %q ok=%v", out, ok)
+	}
+}
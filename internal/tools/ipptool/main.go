@@ -0,0 +1,427 @@
+package ipptool
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"cupsgolang/internal/cupsclient"
+)
+
+var errShowHelp = errors.New("show-help")
+var errShowVersion = errors.New("show-version")
+
+type options struct {
+	uri              string
+	files            []string
+	vars             map[string]string
+	filename         string
+	mode             string
+	plistFile        string
+	junitFile        string
+	verbose          bool
+	version          string
+	timeout          time.Duration
+	network          string
+	encrypt          bool
+	transfer         string
+	ignoreErrors     bool
+	stopAfterInclude bool
+	validateHeaders  bool
+	interval         time.Duration
+	repeat           int
+}
+
+// Main runs ipptool with os.Args.
+func Main() {
+	opts, err := parseArgs(os.Args[1:])
+	if errors.Is(err, errShowHelp) {
+		usage()
+		return
+	}
+	if errors.Is(err, errShowVersion) {
+		fmt.Println("ipptool", buildVersion())
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ipptool:", err)
+		usage()
+		os.Exit(1)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ok, err := run(ctx, opts, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "ipptool:", err)
+		os.Exit(1)
+	}
+	if !ok {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: ipptool [options] URI filename [ ... filename ]")
+	fmt.Println("Options:")
+	fmt.Println("--help                  Show this help")
+	fmt.Println("--junit filename        Write a JUnit XML report to filename")
+	fmt.Println("--stop-after-include-error")
+	fmt.Println("                        Stop tests after a failed INCLUDE")
+	fmt.Println("--version               Show the program version")
+	fmt.Println("-4                      Connect using IPv4")
+	fmt.Println("-6                      Connect using IPv6")
+	fmt.Println("-C                      Send requests using chunking (default)")
+	fmt.Println("-E                      Test with encryption using HTTP Upgrade to TLS")
+	fmt.Println("-I                      Ignore errors")
+	fmt.Println("-L                      Send requests using content-length")
+	fmt.Println("-P filename.plist       Produce XML plist to a file and test report to standard output")
+	fmt.Println("-S                      Test with encryption using HTTPS")
+	fmt.Println("-T seconds              Set the receive/send timeout in seconds")
+	fmt.Println("-V version              Set default IPP version")
+	fmt.Println("-X                      Produce XML plist instead of plain text")
+	fmt.Println("-c                      Produce CSV output")
+	fmt.Println("-d name=value           Set named variable to value")
+	fmt.Println("-f filename             Set default request filename")
+	fmt.Println("-h                      Validate HTTP response headers")
+	fmt.Println("-i seconds              Repeat the last file with the given time interval")
+	fmt.Println("-l                      Produce plain text output")
+	fmt.Println("-n count                Repeat the last file the given number of times")
+	fmt.Println("-q                      Run silently")
+	fmt.Println("-t                      Produce a test report")
+	fmt.Println("-v                      Be verbose")
+}
+
+func parseArgs(args []string) (options, error) {
+	opts := options{
+		vars:     map[string]string{},
+		mode:     modeTest,
+		version:  "1.1",
+		timeout:  60 * time.Second,
+		transfer: "auto",
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "--help":
+			return opts, errShowHelp
+		case "--version":
+			return opts, errShowVersion
+		case "--stop-after-include-error":
+			opts.stopAfterInclude = true
+			continue
+		case "--junit":
+			if i+1 >= len(args) {
+				return opts, fmt.Errorf("missing argument for --junit")
+			}
+			i++
+			opts.junitFile = args[i]
+			continue
+		}
+		if strings.HasPrefix(arg, "--") {
+			return opts, fmt.Errorf("unknown option %q", arg)
+		}
+		if strings.HasPrefix(arg, "-") && arg != "-" {
+			short := arg[1:]
+			for pos := 0; pos < len(short); pos++ {
+				ch := short[pos]
+				rest := short[pos+1:]
+				consume := func() (string, error) {
+					if rest != "" {
+						pos = len(short)
+						return rest, nil
+					}
+					if i+1 >= len(args) {
+						return "", fmt.Errorf("missing argument for -%c", ch)
+					}
+					i++
+					return args[i], nil
+				}
+				switch ch {
+				case '4':
+					opts.network = "tcp4"
+				case '6':
+					opts.network = "tcp6"
+				case 'C':
+					opts.transfer = "chunked"
+				case 'L':
+					opts.transfer = "length"
+				case 'E', 'S':
+					opts.encrypt = true
+				case 'I':
+					opts.ignoreErrors = true
+				case 'X':
+					opts.mode = modePlist
+				case 'c':
+					opts.mode = modeCSV
+				case 'l':
+					opts.mode = modeList
+				case 'q':
+					opts.mode = modeQuiet
+				case 't':
+					opts.mode = modeTest
+				case 'h':
+					opts.validateHeaders = true
+				case 'v':
+					opts.verbose = true
+				case 'P':
+					v, err := consume()
+					if err != nil {
+						return opts, err
+					}
+					opts.plistFile = v
+				case 'T':
+					v, err := consume()
+					if err != nil {
+						return opts, err
+					}
+					secs, err := strconv.ParseFloat(v, 64)
+					if err != nil || secs <= 0 {
+						return opts, fmt.Errorf("bad timeout %q", v)
+					}
+					opts.timeout = time.Duration(secs * float64(time.Second))
+				case 'V':
+					v, err := consume()
+					if err != nil {
+						return opts, err
+					}
+					if _, err := parseVersion(v); err != nil {
+						return opts, fmt.Errorf("bad version %q", v)
+					}
+					opts.version = v
+				case 'd':
+					v, err := consume()
+					if err != nil {
+						return opts, err
+					}
+					name, value, _ := strings.Cut(v, "=")
+					if name == "" {
+						return opts, fmt.Errorf("bad variable %q", v)
+					}
+					opts.vars[name] = value
+				case 'f':
+					v, err := consume()
+					if err != nil {
+						return opts, err
+					}
+					opts.filename = v
+				case 'i':
+					v, err := consume()
+					if err != nil {
+						return opts, err
+					}
+					secs, err := strconv.ParseFloat(v, 64)
+					if err != nil || secs <= 0 {
+						return opts, fmt.Errorf("bad interval %q", v)
+					}
+					opts.interval = time.Duration(secs * float64(time.Second))
+				case 'n':
+					v, err := consume()
+					if err != nil {
+						return opts, err
+					}
+					n, err := strconv.Atoi(v)
+					if err != nil || n < 1 {
+						return opts, fmt.Errorf("bad repeat count %q", v)
+					}
+					opts.repeat = n
+				default:
+					return opts, fmt.Errorf("unknown option \"-%c\"", ch)
+				}
+			}
+			continue
+		}
+		if opts.uri == "" {
+			opts.uri = arg
+		} else {
+			opts.files = append(opts.files, arg)
+		}
+	}
+	if opts.uri == "" || len(opts.files) == 0 {
+		return opts, errors.New("expected a URI and at least one test file")
+	}
+	return opts, nil
+}
+
+// run runs the test files against opts.uri and reports whether every test
+// passed.
+func run(ctx context.Context, opts options, out io.Writer) (bool, error) {
+	u, err := url.Parse(opts.uri)
+	if err != nil || u.Hostname() == "" {
+		return false, fmt.Errorf("bad URI %q", opts.uri)
+	}
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	switch scheme {
+	case "ipp", "ipps":
+		if port == "" {
+			port = "631"
+		}
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return false, fmt.Errorf("unsupported URI scheme %q", u.Scheme)
+	}
+	client := cupsclient.NewFromConfig(
+		cupsclient.WithServer(net.JoinHostPort(u.Hostname(), port)),
+		cupsclient.WithTLS(opts.encrypt || scheme == "ipps" || scheme == "https"),
+		cupsclient.WithUser(u.User.Username()),
+	)
+	if pass, ok := u.User.Password(); ok {
+		client.Password = pass
+	}
+	resource := u.EscapedPath()
+	if resource == "" {
+		resource = "/"
+	}
+
+	mode := opts.mode
+	if mode == modePlist || mode == modeQuiet {
+		// The plist is written once at the end; -q prints nothing.
+		mode = modeQuiet
+	}
+	r := &runner{
+		client:           client,
+		resource:         resource,
+		vars:             map[string]string{},
+		version:          opts.version,
+		transfer:         opts.transfer,
+		ignoreErrors:     opts.ignoreErrors,
+		stopAfterInclude: opts.stopAfterInclude,
+		timeout:          opts.timeout,
+		network:          opts.network,
+		validateHeaders:  opts.validateHeaders,
+		report:           &reporter{w: out, mode: mode, verbose: opts.verbose},
+		in:               bufio.NewReader(os.Stdin),
+	}
+	r.vars["uri"] = opts.uri
+	r.vars["scheme"] = scheme
+	r.vars["hostname"] = u.Hostname()
+	r.vars["port"] = port
+	r.vars["resource"] = resource
+	r.vars["uriuser"] = u.User.Username()
+	r.vars["user"] = client.User
+	r.vars["date-start"] = time.Now().UTC().Format("2006-01-02T15:04:05Z")
+	if opts.filename != "" {
+		// Bundled suites read $filename too, so it must not depend on
+		// the directory of the test file.
+		filename, err := filepath.Abs(opts.filename)
+		if err != nil {
+			return false, err
+		}
+		r.vars["filename"] = filename
+		r.vars["filetype"] = fileType(opts.filename)
+	}
+	for k, v := range opts.vars {
+		r.vars[k] = v
+	}
+
+	ok := true
+	for i, name := range opts.files {
+		times := 1
+		if i == len(opts.files)-1 && (opts.repeat > 0 || opts.interval > 0) {
+			times = opts.repeat
+			if times == 0 {
+				times = -1 // -i alone repeats until interrupted
+			}
+		}
+		for n := 0; times < 0 || n < times; n++ {
+			if n > 0 && opts.interval > 0 && !sleep(ctx, opts.interval) {
+				break
+			}
+			tf, err := loadTestFile(source{dir: "."}, name)
+			if err != nil {
+				return false, err
+			}
+			r.fileID, r.stopped = "", false
+			r.report.beginFile(tf.name)
+			if !r.runFile(ctx, tf) {
+				ok = false
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+	}
+	r.report.summary(r.results)
+
+	if opts.mode == modePlist {
+		if err := writePlist(out, r.results, opts.verbose); err != nil {
+			return false, err
+		}
+	}
+	if opts.plistFile != "" {
+		if err := writeFile(opts.plistFile, func(w io.Writer) error { return writePlist(w, r.results, opts.verbose) }); err != nil {
+			return false, err
+		}
+	}
+	if opts.junitFile != "" {
+		if err := writeFile(opts.junitFile, func(w io.Writer) error { return writeJUnit(w, r.results) }); err != nil {
+			return false, err
+		}
+	}
+	for _, res := range r.results {
+		if !res.passed() {
+			ok = false
+		}
+	}
+	return ok, nil
+}
+
+func writeFile(name string, write func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// fileType guesses the document-format of -f filename from its extension.
+func fileType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".pdf":
+		return "application/pdf"
+	case ".ps":
+		return "application/postscript"
+	case ".txt", ".text":
+		return "text/plain"
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	case ".pwg":
+		return "image/pwg-raster"
+	case ".urf":
+		return "image/urf"
+	}
+	return "application/octet-stream"
+}
+
+// buildVersion is the module version the binary was built from.
+func buildVersion() string {
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	return "(devel)"
+}
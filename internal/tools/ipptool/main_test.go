@@ -0,0 +1,271 @@
+package ipptool
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/server"
+	"cupsgolang/internal/spool"
+	"cupsgolang/internal/store"
+)
+
+func TestParseArgs(t *testing.T) {
+	opts, err := parseArgs([]string{"-tv", "-d", "NOADMIN=1", "-V2.0", "-T", "5", "--junit", "out.xml", "-L", "ipp://localhost/printers/Office", "a.test", "b.test"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	if opts.mode != modeTest || !opts.verbose || opts.vars["NOADMIN"] != "1" || opts.version != "2.0" ||
+		opts.timeout != 5*time.Second || opts.junitFile != "out.xml" || opts.transfer != "length" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if opts.uri != "ipp://localhost/printers/Office" || strings.Join(opts.files, ",") != "a.test,b.test" {
+		t.Fatalf("uri=%q files=%v", opts.uri, opts.files)
+	}
+	if _, err := parseArgs([]string{"--help"}); !errors.Is(err, errShowHelp) {
+		t.Fatalf("expected errShowHelp, got %v", err)
+	}
+	if _, err := parseArgs([]string{"ipp://localhost/"}); err == nil {
+		t.Fatalf("expected error without a test file")
+	}
+	if _, err := parseArgs([]string{"-V", "3.0", "ipp://localhost/", "a.test"}); err == nil {
+		t.Fatalf("expected error for bad version")
+	}
+}
+
+func TestParseTestFile(t *testing.T) {
+	text := `# comment
+DEFINE greeting "hello world"
+{
+	NAME "Print with $greeting"
+	OPERATION Print-Job
+	GROUP operation-attributes-tag
+	ATTR charset attributes-charset utf-8
+	ATTR keyword requested-attributes job-id,job-state
+	GROUP job-attributes-tag
+	ATTR collection media-col {
+		MEMBER collection media-size {
+			MEMBER integer x-dimension 21000
+			MEMBER integer y-dimension 29700
+		}
+		MEMBER keyword media-source tray-1
+	}
+	STATUS successful-ok
+	STATUS client-error-busy REPEAT-MATCH REPEAT-LIMIT 3
+	EXPECT job-id OF-TYPE integer WITH-VALUE >0 COUNT 1
+	EXPECT !job-printer-state-message
+	EXPECT ?job-state IN-GROUP job-attributes-tag WITH-VALUE "/^[3-9]$/"
+	DISPLAY job-id
+}
+`
+	tf, err := parseTestFile("x.test", source{}, text)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(tf.items) != 2 || tf.items[0].directive != "DEFINE" || tf.items[0].args[1] != "hello world" {
+		t.Fatalf("unexpected items: %+v", tf.items)
+	}
+	tt := tf.items[1].test
+	if tt == nil || tt.name != "Print with $greeting" || tt.operation != "Print-Job" {
+		t.Fatalf("unexpected test: %+v", tt)
+	}
+	if len(tt.groups) != 2 || len(tt.groups[0].attrs) != 2 || tt.groups[0].attrs[1].value != "job-id,job-state" {
+		t.Fatalf("unexpected groups: %+v", tt.groups)
+	}
+	col := tt.groups[1].attrs[0]
+	if col.name != "media-col" || len(col.colls) != 1 || len(col.colls[0]) != 2 || len(col.colls[0][0].colls[0]) != 2 {
+		t.Fatalf("unexpected collection: %+v", col)
+	}
+	if len(tt.statuses) != 2 || !tt.statuses[1].repeatMatch || tt.statuses[1].repeatLimit != 3 {
+		t.Fatalf("unexpected statuses: %+v", tt.statuses)
+	}
+	if len(tt.expects) != 3 || tt.expects[0].count != 1 || !tt.expects[1].absent || !tt.expects[2].optional || tt.expects[2].inGroup != "job-attributes-tag" {
+		t.Fatalf("unexpected expects: %+v", tt.expects)
+	}
+	if len(tt.displays) != 1 || tt.displays[0] != "job-id" {
+		t.Fatalf("unexpected displays: %v", tt.displays)
+	}
+
+	for _, bad := range []string{
+		"{ OPERATION Get-Jobs",
+		"{ NAME x }",
+		"{ OPERATION Get-Jobs EXPECT job-id BOGUS-PREDICATE }",
+		"BOGUS-DIRECTIVE x",
+	} {
+		if _, err := parseTestFile("bad.test", source{}, bad); err == nil {
+			t.Fatalf("expected parse error for %q", bad)
+		}
+	}
+}
+
+func TestBundledSuitesParse(t *testing.T) {
+	entries, err := suites.ReadDir("suites")
+	if err != nil {
+		t.Fatalf("read suites: %v", err)
+	}
+	for _, e := range entries {
+		if !strings.HasSuffix(e.Name(), ".test") {
+			continue
+		}
+		if _, err := loadTestFile(source{embedded: true}, e.Name()); err != nil {
+			t.Errorf("%s: %v", e.Name(), err)
+		}
+	}
+}
+
+func TestMatchValue(t *testing.T) {
+	cases := []struct {
+		pattern string
+		tag     goipp.Tag
+		value   goipp.Value
+		want    bool
+	}{
+		{"3,4,5", goipp.TagEnum, goipp.Integer(4), true},
+		{"3,4,5", goipp.TagEnum, goipp.Integer(6), false},
+		{"0x000b", goipp.TagEnum, goipp.Integer(11), true},
+		{">0", goipp.TagInteger, goipp.Integer(1), true},
+		{"<7", goipp.TagEnum, goipp.Integer(7), false},
+		{"5", goipp.TagRange, goipp.Range{Lower: 1, Upper: 9}, true},
+		{"/^iso_a4/", goipp.TagKeyword, goipp.String("iso_a4_210x297mm"), true},
+		{"none", goipp.TagKeyword, goipp.String("none"), true},
+		{"300dpi", goipp.TagResolution, goipp.Resolution{Xres: 300, Yres: 300, Units: goipp.UnitsDpi}, true},
+	}
+	for _, tc := range cases {
+		if got := matchValue(tc.pattern, tc.tag, tc.value); got != tc.want {
+			t.Errorf("matchValue(%q, %v) = %v, want %v", tc.pattern, tc.value, got, tc.want)
+		}
+	}
+}
+
+func TestExpandVariables(t *testing.T) {
+	r := &runner{vars: map[string]string{"uri": "ipp://h/printers/P", "job-id": "7"}}
+	t.Setenv("IPPTOOL_TEST", "env")
+	if got := r.expand("$uri/$job-id $ENV[IPPTOOL_TEST] $$ $missing."); got != "ipp://h/printers/P/7 env $ ." {
+		t.Fatalf("expand = %q", got)
+	}
+}
+
+func startServer(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	ctx := context.Background()
+	st, err := store.Open(ctx, filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("open store: %v", err)
+	}
+	t.Cleanup(func() { st.Close() })
+	err = st.WithTx(ctx, false, func(tx store.Tx) error {
+		_, err := st.CreatePrinter(ctx, tx, "Office", "ipp://localhost/printers/Office", "", "Office printer", model.DefaultPPDName, true, true, false, "none", "")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("create printer: %v", err)
+	}
+	s := &server.Server{
+		Config: config.Config{DefaultAuthType: "none", MaxEvents: 100},
+		Store:  st,
+		Spool:  spool.Spool{Dir: filepath.Join(dir, "spool")},
+		Policy: config.Policy{Locations: []config.LocationRule{{Path: "/", AuthType: "none", AllowAll: true}}},
+	}
+	srv := httptest.NewServer(s.Handler())
+	t.Cleanup(srv.Close)
+	return strings.Replace(srv.URL, "http://", "ipp://", 1)
+}
+
+func TestBundledSuitesAgainstServer(t *testing.T) {
+	base := startServer(t)
+	junit := filepath.Join(t.TempDir(), "junit.xml")
+	opts, err := parseArgs([]string{"-t", "--junit", junit, base + "/printers/Office", "cupsgolang.test"})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	var out bytes.Buffer
+	ok, err := run(context.Background(), opts, &out)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if !ok {
+		t.Fatalf("suites failed:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "[PASS]") || strings.Contains(out.String(), "[FAIL]") {
+		t.Fatalf("unexpected report:\n%s", out.String())
+	}
+
+	data, err := os.ReadFile(junit)
+	if err != nil {
+		t.Fatalf("read junit: %v", err)
+	}
+	var doc struct {
+		Suites []struct {
+			Name     string `xml:"name,attr"`
+			Tests    int    `xml:"tests,attr"`
+			Failures int    `xml:"failures,attr"`
+		} `xml:"testsuite"`
+	}
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("junit is not XML: %v\n%s", err, data)
+	}
+	if len(doc.Suites) < 10 {
+		t.Fatalf("expected a testsuite per included file, got %+v", doc.Suites)
+	}
+	for _, s := range doc.Suites {
+		if s.Tests == 0 || s.Failures != 0 {
+			t.Fatalf("unexpected suite %+v", s)
+		}
+	}
+}
+
+func TestFailingTestReportsAndPlist(t *testing.T) {
+	base := startServer(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "fail.test")
+	os.WriteFile(file, []byte(`{
+	NAME "Wrong expectation"
+	OPERATION Get-Printer-Attributes
+	GROUP operation-attributes-tag
+	ATTR charset attributes-charset utf-8
+	ATTR naturalLanguage attributes-natural-language en
+	ATTR uri printer-uri $uri
+	STATUS successful-ok
+	EXPECT printer-name WITH-VALUE NotOffice
+}
+{
+	NAME "Skipped after error"
+	OPERATION Get-Printer-Attributes
+	SKIP-PREVIOUS-ERROR yes
+	GROUP operation-attributes-tag
+	ATTR charset attributes-charset utf-8
+	ATTR naturalLanguage attributes-natural-language en
+	ATTR uri printer-uri $uri
+}
+`), 0o644)
+	opts, err := parseArgs([]string{"-X", "-I", base + "/printers/Office", file})
+	if err != nil {
+		t.Fatalf("parseArgs: %v", err)
+	}
+	var out bytes.Buffer
+	ok, err := run(context.Background(), opts, &out)
+	if err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	if ok {
+		t.Fatalf("expected failure:\n%s", out.String())
+	}
+	plist := out.String()
+	for _, want := range []string{"<key>Name</key><string>Wrong expectation</string>", "EXPECTED: printer-name WITH-VALUE &#34;NotOffice&#34; (got Office)", "<key>Skipped</key><true />", "<key>Successful</key><false />"} {
+		if !strings.Contains(plist, want) {
+			t.Fatalf("plist missing %q:\n%s", want, plist)
+		}
+	}
+}
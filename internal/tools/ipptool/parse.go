@@ -0,0 +1,566 @@
+package ipptool
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// testFile is a parsed ipptool test file: its top-level directives and
+// tests in file order. Variables are expanded when the items run, so values
+// can refer to results of earlier tests.
+type testFile struct {
+	name  string
+	src   source
+	items []item
+}
+
+// item is a top-level directive or, when test is set, a test.
+type item struct {
+	line      int
+	directive string
+	args      []string
+	test      *test
+}
+
+type test struct {
+	line             int
+	name             string
+	testID           string
+	operation        string
+	version          string
+	requestID        string
+	resource         string
+	groups           []requestGroup
+	file             string
+	compression      string
+	transfer         string
+	delay            string
+	pause            string
+	ignoreErrors     string
+	skipIfDefined    string
+	skipIfNotDefined string
+	skipPrevError    bool
+	defines          [][2]string
+	statuses         []statusExpect
+	expects          []expect
+	displays         []string
+}
+
+type requestGroup struct {
+	tag   string
+	attrs []attrSpec
+}
+
+// attrSpec is an ATTR or MEMBER line. Collection values are in colls, one
+// member list per value; other values are still comma-separated in value.
+type attrSpec struct {
+	tag   string
+	name  string
+	value string
+	colls [][]attrSpec
+}
+
+type conditions struct {
+	defineMatch   string
+	defineNoMatch string
+	ifDefined     string
+	ifNotDefined  string
+	repeatMatch   bool
+	repeatNoMatch bool
+	repeatLimit   int
+}
+
+type statusExpect struct {
+	status string
+	conditions
+}
+
+// valueCheck is one WITH-* predicate. For the URI predicates part is
+// "scheme", "hostname" or "resource"; all requires every value to match.
+type valueCheck struct {
+	part    string
+	pattern string
+	all     bool
+}
+
+type expect struct {
+	name         string
+	optional     bool
+	absent       bool
+	all          bool
+	count        int
+	ofType       []string
+	inGroup      string
+	sameCountAs  string
+	values       []valueCheck
+	valueFrom    string
+	distinct     bool
+	defineValue  string
+	displayMatch string
+	conditions
+}
+
+// statusPredicates and expectPredicates map predicate keywords to the
+// number of arguments they take.
+var statusPredicates = map[string]int{
+	"DEFINE-MATCH": 1, "DEFINE-NO-MATCH": 1, "IF-DEFINED": 1, "IF-NOT-DEFINED": 1,
+	"REPEAT-LIMIT": 1, "REPEAT-MATCH": 0, "REPEAT-NO-MATCH": 0,
+}
+
+var expectPredicates = map[string]int{
+	"COUNT": 1, "DEFINE-MATCH": 1, "DEFINE-NO-MATCH": 1, "DEFINE-VALUE": 1,
+	"DISPLAY-MATCH": 1, "IF-DEFINED": 1, "IF-NOT-DEFINED": 1, "IN-GROUP": 1,
+	"OF-TYPE": 1, "REPEAT-LIMIT": 1, "REPEAT-MATCH": 0, "REPEAT-NO-MATCH": 0,
+	"SAME-COUNT-AS": 1, "WITH-ALL-HOSTNAMES": 1, "WITH-ALL-RESOURCES": 1,
+	"WITH-ALL-SCHEMES": 1, "WITH-ALL-VALUES": 1, "WITH-DISTINCT-VALUES": 0,
+	"WITH-HOSTNAME": 1, "WITH-RESOURCE": 1, "WITH-SCHEME": 1, "WITH-VALUE": 1,
+	"WITH-VALUE-FROM": 1,
+}
+
+// topDirectives map the top-level directives to their argument counts.
+var topDirectives = map[string]int{
+	"DEFINE": 2, "DEFINE-DEFAULT": 2, "FILE-ID": 1, "IGNORE-ERRORS": 1,
+	"INCLUDE": 1, "INCLUDE-IF-DEFINED": 2, "INCLUDE-IF-NOT-DEFINED": 2,
+	"SKIP-IF-DEFINED": 1, "SKIP-IF-NOT-DEFINED": 1, "STOP-AFTER-INCLUDE-ERROR": 1,
+	"TRANSFER": 1, "VERSION": 1,
+}
+
+// outOfBandTags take no value in ATTR and MEMBER lines.
+var outOfBandTags = map[string]bool{
+	"admin-define": true, "default": true, "delete-attribute": true, "no-value": true,
+	"not-settable": true, "unknown": true, "unsupported": true,
+}
+
+type token struct {
+	text   string
+	line   int
+	quoted bool
+}
+
+// tokenize splits a test file into tokens. Tokens are separated by white
+// space; "{", "}" and a leading "," are tokens of their own; "#" starts a
+// comment outside quotes. Quotes may surround all or part of a token and
+// "\" escapes the next character, except that "\," is kept for the value
+// splitting of ATTR lines.
+func tokenize(name, text string) ([]token, error) {
+	var tokens []token
+	line := 1
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '\n':
+			line++
+			i++
+			continue
+		case r == ' ' || r == '\t' || r == '\r' || r == '\f':
+			i++
+			continue
+		case r == '#':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			continue
+		case r == '{' || r == '}' || r == ',':
+			tokens = append(tokens, token{text: string(r), line: line})
+			i++
+			continue
+		}
+		start := line
+		var b strings.Builder
+		quoted := false
+		for i < len(runes) {
+			r := runes[i]
+			if r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == '\f' || r == '{' || r == '}' {
+				break
+			}
+			if r == '"' || r == '\'' {
+				quote := r
+				quoted = true
+				i++
+				closed := false
+				for i < len(runes) {
+					c := runes[i]
+					if c == '\\' && i+1 < len(runes) {
+						if runes[i+1] == ',' {
+							b.WriteRune('\\')
+						}
+						b.WriteRune(runes[i+1])
+						i += 2
+						continue
+					}
+					if c == quote {
+						closed = true
+						i++
+						break
+					}
+					if c == '\n' {
+						line++
+					}
+					b.WriteRune(c)
+					i++
+				}
+				if !closed {
+					return nil, fmt.Errorf("%s:%d: unterminated string", name, start)
+				}
+				continue
+			}
+			if r == '\\' && i+1 < len(runes) {
+				if runes[i+1] == ',' {
+					b.WriteRune('\\')
+				}
+				b.WriteRune(runes[i+1])
+				i += 2
+				continue
+			}
+			b.WriteRune(r)
+			i++
+		}
+		tokens = append(tokens, token{text: b.String(), line: start, quoted: quoted})
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	name   string
+	tokens []token
+	pos    int
+}
+
+func (p *parser) next() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, true
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+func (p *parser) errorf(line int, format string, args ...any) error {
+	return fmt.Errorf("%s:%d: %s", p.name, line, fmt.Sprintf(format, args...))
+}
+
+// arg returns the argument of the directive at line.
+func (p *parser) arg(directive string, line int) (string, error) {
+	t, ok := p.next()
+	if !ok || (!t.quoted && (t.text == "{" || t.text == "}")) {
+		return "", p.errorf(line, "missing value for %s", directive)
+	}
+	return t.text, nil
+}
+
+// parseTestFile parses the text of a test file.
+func parseTestFile(name string, src source, text string) (*testFile, error) {
+	tokens, err := tokenize(name, text)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{name: name, tokens: tokens}
+	tf := &testFile{name: name, src: src}
+	for {
+		t, ok := p.next()
+		if !ok {
+			return tf, nil
+		}
+		if t.text == "{" && !t.quoted {
+			tst, err := p.parseTest(t.line)
+			if err != nil {
+				return nil, err
+			}
+			tf.items = append(tf.items, item{line: t.line, test: tst})
+			continue
+		}
+		directive := strings.ToUpper(t.text)
+		n, known := topDirectives[directive]
+		if !known || t.quoted {
+			return nil, p.errorf(t.line, "unexpected token %q", t.text)
+		}
+		it := item{line: t.line, directive: directive}
+		for i := 0; i < n; i++ {
+			arg, err := p.arg(directive, t.line)
+			if err != nil {
+				return nil, err
+			}
+			it.args = append(it.args, arg)
+		}
+		tf.items = append(tf.items, it)
+	}
+}
+
+func (p *parser) parseTest(line int) (*test, error) {
+	tst := &test{line: line, requestID: "random"}
+	for {
+		t, ok := p.next()
+		if !ok {
+			return nil, p.errorf(line, "test is never closed")
+		}
+		if t.text == "}" && !t.quoted {
+			if tst.operation == "" {
+				return nil, p.errorf(line, "missing OPERATION")
+			}
+			return tst, nil
+		}
+		directive := strings.ToUpper(t.text)
+		var err error
+		str := func(target *string) {
+			*target, err = p.arg(directive, t.line)
+		}
+		switch directive {
+		case "NAME":
+			str(&tst.name)
+		case "TEST-ID":
+			str(&tst.testID)
+		case "OPERATION":
+			str(&tst.operation)
+		case "VERSION":
+			str(&tst.version)
+		case "REQUEST-ID":
+			str(&tst.requestID)
+		case "RESOURCE":
+			str(&tst.resource)
+		case "FILE":
+			str(&tst.file)
+		case "COMPRESSION":
+			str(&tst.compression)
+		case "TRANSFER":
+			str(&tst.transfer)
+		case "DELAY":
+			str(&tst.delay)
+		case "PAUSE":
+			str(&tst.pause)
+		case "IGNORE-ERRORS":
+			str(&tst.ignoreErrors)
+		case "SKIP-IF-DEFINED":
+			str(&tst.skipIfDefined)
+		case "SKIP-IF-NOT-DEFINED":
+			str(&tst.skipIfNotDefined)
+		case "SKIP-PREVIOUS-ERROR":
+			var v string
+			str(&v)
+			tst.skipPrevError = strings.EqualFold(v, "yes")
+		case "DISPLAY":
+			var v string
+			str(&v)
+			tst.displays = append(tst.displays, v)
+		case "DEFINE":
+			var name, value string
+			str(&name)
+			if err == nil {
+				str(&value)
+			}
+			tst.defines = append(tst.defines, [2]string{name, value})
+		case "GROUP":
+			var tag string
+			str(&tag)
+			tst.groups = append(tst.groups, requestGroup{tag: tag})
+		case "ATTR":
+			var attr attrSpec
+			attr, err = p.parseAttr(directive, t.line)
+			if err == nil {
+				if len(tst.groups) == 0 {
+					tst.groups = append(tst.groups, requestGroup{tag: "operation-attributes-tag"})
+				}
+				g := &tst.groups[len(tst.groups)-1]
+				g.attrs = append(g.attrs, attr)
+			}
+		case "STATUS":
+			var st statusExpect
+			str(&st.status)
+			if err == nil {
+				err = p.parsePredicates(statusPredicates, t.line, func(keyword, arg string) error {
+					return st.conditions.set(keyword, arg)
+				})
+			}
+			tst.statuses = append(tst.statuses, st)
+		case "EXPECT", "EXPECT-ALL":
+			var ex expect
+			ex, err = p.parseExpect(directive, t.line)
+			tst.expects = append(tst.expects, ex)
+		default:
+			return nil, p.errorf(t.line, "unknown directive %s", t.text)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseAttr parses the rest of an ATTR or MEMBER line.
+func (p *parser) parseAttr(directive string, line int) (attrSpec, error) {
+	var attr attrSpec
+	var err error
+	if attr.tag, err = p.arg(directive, line); err != nil {
+		return attr, err
+	}
+	if attr.name, err = p.arg(directive, line); err != nil {
+		return attr, err
+	}
+	tag := strings.ToLower(attr.tag)
+	if outOfBandTags[tag] {
+		return attr, nil
+	}
+	if tag != "collection" {
+		attr.value, err = p.arg(directive, line)
+		return attr, err
+	}
+	for {
+		t, ok := p.next()
+		if !ok || t.text != "{" || t.quoted {
+			return attr, p.errorf(line, "expected { after collection %s", attr.name)
+		}
+		var members []attrSpec
+		for {
+			t, ok := p.next()
+			if !ok {
+				return attr, p.errorf(line, "collection %s is never closed", attr.name)
+			}
+			if t.text == "}" && !t.quoted {
+				break
+			}
+			if !strings.EqualFold(t.text, "MEMBER") {
+				return attr, p.errorf(t.line, "expected MEMBER, got %q", t.text)
+			}
+			m, err := p.parseAttr("MEMBER", t.line)
+			if err != nil {
+				return attr, err
+			}
+			members = append(members, m)
+		}
+		attr.colls = append(attr.colls, members)
+		if t, ok := p.peek(); !ok || t.text != "," || t.quoted {
+			return attr, nil
+		}
+		p.next()
+	}
+}
+
+// parsePredicates consumes the predicate keywords that follow a STATUS or
+// EXPECT directive.
+func (p *parser) parsePredicates(known map[string]int, line int, set func(keyword, arg string) error) error {
+	for {
+		t, ok := p.peek()
+		if !ok || t.quoted {
+			return nil
+		}
+		keyword := strings.ToUpper(t.text)
+		n, isPredicate := known[keyword]
+		if !isPredicate {
+			return nil
+		}
+		p.next()
+		arg := ""
+		if n > 0 {
+			var err error
+			if arg, err = p.arg(keyword, t.line); err != nil {
+				return err
+			}
+		}
+		if err := set(keyword, arg); err != nil {
+			return p.errorf(t.line, "%v", err)
+		}
+	}
+}
+
+func (p *parser) parseExpect(directive string, line int) (expect, error) {
+	ex := expect{all: directive == "EXPECT-ALL", count: -1}
+	name, err := p.arg(directive, line)
+	if err != nil {
+		return ex, err
+	}
+	switch {
+	case strings.HasPrefix(name, "?"):
+		ex.optional, name = true, name[1:]
+	case strings.HasPrefix(name, "!"):
+		ex.absent, name = true, name[1:]
+	}
+	ex.name = name
+	err = p.parsePredicates(expectPredicates, line, func(keyword, arg string) error {
+		switch keyword {
+		case "COUNT":
+			n, err := strconv.Atoi(arg)
+			if err != nil || n < 0 {
+				return fmt.Errorf("bad COUNT %q", arg)
+			}
+			ex.count = n
+		case "DEFINE-VALUE":
+			ex.defineValue = arg
+		case "DISPLAY-MATCH":
+			ex.displayMatch = arg
+		case "IN-GROUP":
+			ex.inGroup = arg
+		case "OF-TYPE":
+			ex.ofType = strings.FieldsFunc(arg, func(r rune) bool { return r == '|' || r == ',' })
+		case "SAME-COUNT-AS":
+			ex.sameCountAs = arg
+		case "WITH-VALUE-FROM":
+			ex.valueFrom = arg
+		case "WITH-DISTINCT-VALUES":
+			ex.distinct = true
+		case "WITH-VALUE", "WITH-ALL-VALUES":
+			ex.values = append(ex.values, valueCheck{pattern: arg, all: keyword == "WITH-ALL-VALUES"})
+		case "WITH-SCHEME", "WITH-ALL-SCHEMES":
+			ex.values = append(ex.values, valueCheck{part: "scheme", pattern: arg, all: keyword == "WITH-ALL-SCHEMES"})
+		case "WITH-HOSTNAME", "WITH-ALL-HOSTNAMES":
+			ex.values = append(ex.values, valueCheck{part: "hostname", pattern: arg, all: keyword == "WITH-ALL-HOSTNAMES"})
+		case "WITH-RESOURCE", "WITH-ALL-RESOURCES":
+			ex.values = append(ex.values, valueCheck{part: "resource", pattern: arg, all: keyword == "WITH-ALL-RESOURCES"})
+		default:
+			return ex.conditions.set(keyword, arg)
+		}
+		return nil
+	})
+	return ex, err
+}
+
+func (c *conditions) set(keyword, arg string) error {
+	switch keyword {
+	case "DEFINE-MATCH":
+		c.defineMatch = arg
+	case "DEFINE-NO-MATCH":
+		c.defineNoMatch = arg
+	case "IF-DEFINED":
+		c.ifDefined = arg
+	case "IF-NOT-DEFINED":
+		c.ifNotDefined = arg
+	case "REPEAT-MATCH":
+		c.repeatMatch = true
+	case "REPEAT-NO-MATCH":
+		c.repeatNoMatch = true
+	case "REPEAT-LIMIT":
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return fmt.Errorf("bad REPEAT-LIMIT %q", arg)
+		}
+		c.repeatLimit = n
+	}
+	return nil
+}
+
+// splitValues splits an ATTR value at commas not escaped with "\".
+func splitValues(value string) []string {
+	var out []string
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c == '\\' && i+1 < len(value) && value[i+1] == ',' {
+			b.WriteByte(',')
+			i++
+			continue
+		}
+		if c == ',' {
+			out = append(out, b.String())
+			b.Reset()
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return append(out, b.String())
+}
@@ -0,0 +1,326 @@
+package ipptool
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// Output modes.
+const (
+	modeTest  = "test"
+	modeList  = "list"
+	modeCSV   = "csv"
+	modePlist = "plist"
+	modeQuiet = "quiet"
+)
+
+// reporter writes results as the tests run; the plist and JUnit documents
+// are written at the end from all the results.
+type reporter struct {
+	w       io.Writer
+	mode    string
+	verbose bool
+	csv     *csv.Writer
+	header  []string
+}
+
+func (p *reporter) beginFile(name string) {
+	if p.mode == modeTest {
+		fmt.Fprintf(p.w, "%q:\n", name)
+	}
+}
+
+func (p *reporter) fileError(err error) {
+	fmt.Fprintln(os.Stderr, "ipptool:", err)
+}
+
+func (p *reporter) test(res *result) {
+	switch p.mode {
+	case modeTest:
+		p.testLine(res)
+	case modeList:
+		for _, a := range res.displays {
+			fmt.Fprintf(p.w, "%s = %s\n", a.Name, valuesString(a.Values))
+		}
+	case modeCSV:
+		p.csvRows(res)
+	}
+}
+
+func (p *reporter) testLine(res *result) {
+	state := "PASS"
+	switch {
+	case res.skipped:
+		state = "SKIP"
+	case !res.passed():
+		state = "FAIL"
+	}
+	fmt.Fprintf(p.w, "    %-68.68s [%s]\n", res.name, state)
+	if p.verbose && res.request != nil {
+		printAttrs(p.w, res.request)
+	}
+	if !res.passed() {
+		if res.status != "" {
+			status := res.status
+			if res.message != "" {
+				status += " (" + res.message + ")"
+			}
+			fmt.Fprintf(p.w, "        status-code = %s\n", status)
+		}
+		for _, e := range res.errors {
+			fmt.Fprintf(p.w, "        %s\n", e)
+		}
+	}
+	for _, note := range res.notes {
+		fmt.Fprintf(p.w, "        %s\n", note)
+	}
+	if p.verbose && res.response != nil {
+		printAttrs(p.w, res.response)
+	} else {
+		for _, a := range res.displays {
+			fmt.Fprintf(p.w, "        %s (%s) = %s\n", a.Name, tagNames(a.Values), valuesString(a.Values))
+		}
+	}
+}
+
+func printAttrs(w io.Writer, msg *goipp.Message) {
+	for _, g := range msg.Groups {
+		fmt.Fprintf(w, "        %s:\n", g.Tag)
+		for _, a := range g.Attrs {
+			fmt.Fprintf(w, "            %s (%s) = %s\n", a.Name, tagNames(a.Values), valuesString(a.Values))
+		}
+	}
+}
+
+func tagNames(values goipp.Values) string {
+	var names []string
+	for _, v := range values {
+		name := v.T.String()
+		if len(names) == 0 || names[len(names)-1] != name {
+			names = append(names, name)
+		}
+	}
+	if len(values) > 1 {
+		return "1setOf " + strings.Join(names, "|")
+	}
+	return strings.Join(names, "|")
+}
+
+// csvRows writes one row per response group holding a displayed
+// attribute, under a header of the displayed names.
+func (p *reporter) csvRows(res *result) {
+	if len(res.displays) == 0 || res.response == nil {
+		return
+	}
+	if p.csv == nil {
+		p.csv = csv.NewWriter(p.w)
+	}
+	var names []string
+	seen := map[string]bool{}
+	for _, a := range res.displays {
+		if !seen[a.Name] {
+			seen[a.Name] = true
+			names = append(names, a.Name)
+		}
+	}
+	if strings.Join(names, ",") != strings.Join(p.header, ",") {
+		p.header = names
+		p.csv.Write(names)
+	}
+	for _, g := range res.response.Groups {
+		row := make([]string, len(names))
+		any := false
+		for _, a := range g.Attrs {
+			for i, name := range names {
+				if a.Name == name {
+					row[i], any = valuesString(a.Values), true
+				}
+			}
+		}
+		if any {
+			p.csv.Write(row)
+		}
+	}
+	p.csv.Flush()
+}
+
+// summary ends the test-mode report.
+func (p *reporter) summary(results []*result) {
+	if p.mode != modeTest {
+		return
+	}
+	passed, failed, skipped := 0, 0, 0
+	for _, res := range results {
+		switch {
+		case res.skipped:
+			skipped++
+		case res.passed():
+			passed++
+		default:
+			failed++
+		}
+	}
+	fmt.Fprintf(p.w, "Summary: %d tests, %d passed, %d failed, %d skipped\n", len(results), passed, failed, skipped)
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writePlist writes the results as the XML property list of ipptool -X.
+func writePlist(w io.Writer, results []*result, verbose bool) error {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<!DOCTYPE plist PUBLIC "-//Apple Computer//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">` + "\n")
+	b.WriteString("<plist version=\"1.0\">\n<dict>\n<key>Tests</key>\n<array>\n")
+	ok := true
+	for _, res := range results {
+		b.WriteString("<dict>\n")
+		key := func(k, v string) {
+			fmt.Fprintf(&b, "<key>%s</key><string>%s</string>\n", k, xmlText(v))
+		}
+		boolean := func(k string, v bool) {
+			fmt.Fprintf(&b, "<key>%s</key><%t />\n", k, v)
+		}
+		key("Name", res.name)
+		key("FileName", res.file)
+		if res.fileID != "" {
+			key("FileId", res.fileID)
+		}
+		if res.testID != "" {
+			key("TestId", res.testID)
+		}
+		if res.operation != "" {
+			key("Operation", res.operation)
+			fmt.Fprintf(&b, "<key>RequestId</key><integer>%d</integer>\n", res.requestID)
+		}
+		if verbose && res.request != nil {
+			b.WriteString("<key>RequestAttributes</key>\n")
+			plistGroups(&b, res.request)
+		}
+		if res.status != "" {
+			key("StatusCode", res.status)
+		}
+		if res.response != nil {
+			b.WriteString("<key>ResponseAttributes</key>\n")
+			plistGroups(&b, res.response)
+		}
+		boolean("Skipped", res.skipped)
+		boolean("Successful", res.passed())
+		if !res.passed() {
+			ok = false
+			b.WriteString("<key>Errors</key>\n<array>\n")
+			for _, e := range res.errors {
+				fmt.Fprintf(&b, "<string>%s</string>\n", xmlText(e))
+			}
+			b.WriteString("</array>\n")
+		}
+		b.WriteString("</dict>\n")
+	}
+	fmt.Fprintf(&b, "</array>\n<key>Successful</key><%t />\n</dict>\n</plist>\n", ok)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func plistGroups(b *strings.Builder, msg *goipp.Message) {
+	b.WriteString("<array>\n")
+	for _, g := range msg.Groups {
+		b.WriteString("<dict>\n")
+		for _, a := range g.Attrs {
+			fmt.Fprintf(b, "<key>%s</key>", xmlText(a.Name))
+			if len(a.Values) == 1 {
+				fmt.Fprintf(b, "<string>%s</string>\n", xmlText(valueString(a.Values[0].T, a.Values[0].V)))
+				continue
+			}
+			b.WriteString("<array>")
+			for _, v := range a.Values {
+				fmt.Fprintf(b, "<string>%s</string>", xmlText(valueString(v.T, v.V)))
+			}
+			b.WriteString("</array>\n")
+		}
+		b.WriteString("</dict>\n")
+	}
+	b.WriteString("</array>\n")
+}
+
+// writeJUnit writes the results as JUnit XML, one test suite per test
+// file, for CI systems.
+func writeJUnit(w io.Writer, results []*result) error {
+	type failure struct {
+		Message string `xml:"message,attr"`
+		Text    string `xml:",chardata"`
+	}
+	type testCase struct {
+		Name      string    `xml:"name,attr"`
+		ClassName string    `xml:"classname,attr"`
+		Time      string    `xml:"time,attr"`
+		Skipped   *struct{} `xml:"skipped"`
+		Failure   *failure  `xml:"failure"`
+	}
+	type testSuite struct {
+		Name     string     `xml:"name,attr"`
+		Tests    int        `xml:"tests,attr"`
+		Failures int        `xml:"failures,attr"`
+		Skipped  int        `xml:"skipped,attr"`
+		Time     string     `xml:"time,attr"`
+		Cases    []testCase `xml:"testcase"`
+	}
+	type testSuites struct {
+		XMLName xml.Name    `xml:"testsuites"`
+		Suites  []testSuite `xml:"testsuite"`
+	}
+	var doc testSuites
+	index := map[string]int{}
+	totals := map[string]time.Duration{}
+	for _, res := range results {
+		i, ok := index[res.file]
+		if !ok {
+			i = len(doc.Suites)
+			index[res.file] = i
+			doc.Suites = append(doc.Suites, testSuite{Name: res.file})
+		}
+		s := &doc.Suites[i]
+		tc := testCase{
+			Name:      res.name,
+			ClassName: strings.TrimSuffix(res.file, ".test"),
+			Time:      fmt.Sprintf("%.3f", res.duration.Seconds()),
+		}
+		s.Tests++
+		totals[res.file] += res.duration
+		switch {
+		case res.skipped:
+			tc.Skipped = &struct{}{}
+			s.Skipped++
+		case !res.passed():
+			text := strings.Join(res.errors, "\n")
+			if res.status != "" {
+				text = "status-code = " + res.status + "\n" + text
+			}
+			tc.Failure = &failure{Message: res.errors[0], Text: text}
+			s.Failures++
+		}
+		s.Cases = append(s.Cases, tc)
+	}
+	for i := range doc.Suites {
+		doc.Suites[i].Time = fmt.Sprintf("%.3f", totals[doc.Suites[i].Name].Seconds())
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
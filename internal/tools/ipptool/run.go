@@ -0,0 +1,782 @@
+package ipptool
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/cupsclient"
+)
+
+// suites are the bundled test files. A test file, INCLUDE or FILE that is
+// not found on disk is looked up here, and INCLUDE <name> always reads
+// from here, as from the CUPS ipptool data directory.
+//
+//go:embed suites
+var suites embed.FS
+
+// defaultRepeatLimit bounds REPEAT-MATCH and REPEAT-NO-MATCH.
+const defaultRepeatLimit = 1000
+
+// source is where a test file came from: a directory on disk, or the
+// bundled suites.
+type source struct {
+	dir      string
+	embedded bool
+}
+
+// readFile reads name relative to from. "<name>" reads a bundled file.
+func readFile(from source, name string) ([]byte, source, error) {
+	if strings.HasPrefix(name, "<") && strings.HasSuffix(name, ">") {
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "<"), ">")
+		data, err := fs.ReadFile(suites, path.Join("suites", name))
+		return data, source{embedded: true}, err
+	}
+	if !from.embedded || filepath.IsAbs(name) {
+		p := name
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(from.dir, name)
+		}
+		data, err := os.ReadFile(p)
+		if err == nil || filepath.IsAbs(name) || !errors.Is(err, fs.ErrNotExist) {
+			return data, source{dir: filepath.Dir(p)}, err
+		}
+	}
+	data, err := fs.ReadFile(suites, path.Join("suites", filepath.ToSlash(name)))
+	if err != nil {
+		return nil, from, fmt.Errorf("%s: %w", name, fs.ErrNotExist)
+	}
+	return data, source{embedded: true}, nil
+}
+
+func loadTestFile(from source, name string) (*testFile, error) {
+	data, src, err := readFile(from, name)
+	if err != nil {
+		return nil, err
+	}
+	return parseTestFile(strings.Trim(name, "<>"), src, string(data))
+}
+
+// result is the outcome of one test.
+type result struct {
+	file      string
+	fileID    string
+	name      string
+	testID    string
+	operation string
+	requestID uint32
+	status    string
+	message   string
+	request   *goipp.Message
+	response  *goipp.Message
+	displays  []goipp.Attribute
+	notes     []string
+	errors    []string
+	skipped   bool
+	duration  time.Duration
+}
+
+func (r *result) passed() bool {
+	return r.skipped || len(r.errors) == 0
+}
+
+type runner struct {
+	client           *cupsclient.Client
+	resource         string
+	vars             map[string]string
+	version          string
+	transfer         string
+	ignoreErrors     bool
+	stopAfterInclude bool
+	timeout          time.Duration
+	network          string
+	validateHeaders  bool
+	report           *reporter
+	results          []*result
+	prevFailed       bool
+	fileID           string
+	stopped          bool
+	in               *bufio.Reader
+}
+
+func (r *runner) defined(name string) bool {
+	_, ok := r.vars[name]
+	return ok
+}
+
+// runFile runs the items of tf and reports whether all its tests passed.
+func (r *runner) runFile(ctx context.Context, tf *testFile) bool {
+	ok := true
+	for _, it := range tf.items {
+		if r.stopped || ctx.Err() != nil {
+			break
+		}
+		if it.test != nil {
+			res := r.runTest(ctx, tf, it.test)
+			if !res.passed() {
+				ok = false
+				ignore := r.ignoreErrors
+				if it.test.ignoreErrors != "" {
+					ignore = strings.EqualFold(r.expand(it.test.ignoreErrors), "yes")
+				}
+				if !ignore {
+					r.stopped = true
+				}
+			}
+			continue
+		}
+		args := make([]string, len(it.args))
+		for i, a := range it.args {
+			args[i] = r.expand(a)
+		}
+		switch it.directive {
+		case "DEFINE":
+			r.vars[args[0]] = args[1]
+		case "DEFINE-DEFAULT":
+			if !r.defined(args[0]) {
+				r.vars[args[0]] = args[1]
+			}
+		case "FILE-ID":
+			r.fileID = args[0]
+		case "IGNORE-ERRORS":
+			r.ignoreErrors = strings.EqualFold(args[0], "yes")
+		case "STOP-AFTER-INCLUDE-ERROR":
+			r.stopAfterInclude = strings.EqualFold(args[0], "yes")
+		case "TRANSFER":
+			r.transfer = strings.ToLower(args[0])
+		case "VERSION":
+			r.version = args[0]
+		case "SKIP-IF-DEFINED":
+			if r.defined(args[0]) {
+				return ok
+			}
+		case "SKIP-IF-NOT-DEFINED":
+			if !r.defined(args[0]) {
+				return ok
+			}
+		case "INCLUDE", "INCLUDE-IF-DEFINED", "INCLUDE-IF-NOT-DEFINED":
+			name := args[len(args)-1]
+			if it.directive == "INCLUDE-IF-DEFINED" && !r.defined(args[0]) ||
+				it.directive == "INCLUDE-IF-NOT-DEFINED" && r.defined(args[0]) {
+				continue
+			}
+			child, err := loadTestFile(tf.src, name)
+			if err != nil {
+				r.report.fileError(fmt.Errorf("%s:%d: INCLUDE: %w", tf.name, it.line, err))
+				ok = false
+				continue
+			}
+			if !r.runFile(ctx, child) {
+				ok = false
+				if r.stopAfterInclude {
+					r.stopped = true
+				}
+			}
+		}
+	}
+	return ok
+}
+
+// expand replaces $name, $ENV[name] and $$ in s.
+func (r *runner) expand(s string) string {
+	if !strings.Contains(s, "$") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			b.WriteByte(s[i])
+			continue
+		}
+		rest := s[i+1:]
+		switch {
+		case strings.HasPrefix(rest, "$"):
+			b.WriteByte('$')
+			i++
+			continue
+		case strings.HasPrefix(rest, "ENV["):
+			if end := strings.IndexByte(rest, ']'); end > 0 {
+				b.WriteString(os.Getenv(rest[4:end]))
+				i += end + 1
+				continue
+			}
+		}
+		n := 0
+		for n < len(rest) && (isNameByte(rest[n])) {
+			n++
+		}
+		name := rest[:n]
+		if name == "date-current" {
+			b.WriteString(time.Now().UTC().Format("2006-01-02T15:04:05Z"))
+		} else if v, ok := r.vars[name]; ok {
+			b.WriteString(v)
+		} else if n == 0 {
+			b.WriteByte('$')
+		}
+		i += n
+	}
+	return b.String()
+}
+
+func isNameByte(c byte) bool {
+	return c == '-' || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// parseDelay reads "seconds[,repeat-seconds]".
+func parseDelay(s string) (time.Duration, time.Duration, error) {
+	first, second, hasSecond := strings.Cut(s, ",")
+	parse := func(v string) (time.Duration, error) {
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil || f < 0 {
+			return 0, fmt.Errorf("bad DELAY %q", s)
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	delay, err := parse(first)
+	if err != nil || !hasSecond {
+		return delay, 5 * time.Second, err
+	}
+	repeat, err := parse(second)
+	return delay, repeat, err
+}
+
+func (r *runner) runTest(ctx context.Context, tf *testFile, t *test) *result {
+	res := &result{
+		file:   tf.name,
+		fileID: r.fileID,
+		name:   r.expand(t.name),
+		testID: r.expand(t.testID),
+	}
+	if res.name == "" {
+		res.name = fmt.Sprintf("%s:%d", tf.name, t.line)
+	}
+	r.results = append(r.results, res)
+	defer func() {
+		if !res.skipped {
+			r.prevFailed = !res.passed()
+		}
+		r.report.test(res)
+	}()
+	if t.skipIfDefined != "" && r.defined(t.skipIfDefined) ||
+		t.skipIfNotDefined != "" && !r.defined(t.skipIfNotDefined) ||
+		t.skipPrevError && r.prevFailed {
+		res.skipped = true
+		return res
+	}
+	fail := func(format string, args ...any) *result {
+		res.errors = append(res.errors, fmt.Sprintf(format, args...))
+		return res
+	}
+	for _, d := range t.defines {
+		r.vars[d[0]] = r.expand(d[1])
+	}
+
+	delay, repeatDelay := time.Duration(0), 5*time.Second
+	if t.delay != "" {
+		var err error
+		if delay, repeatDelay, err = parseDelay(r.expand(t.delay)); err != nil {
+			return fail("%v", err)
+		}
+	}
+	if t.pause != "" {
+		fmt.Fprintf(os.Stderr, "%s\nPress RETURN to continue: ", r.expand(t.pause))
+		if r.in != nil {
+			r.in.ReadString('\n')
+		}
+	}
+	op, ok := lookupOperation(r.expand(t.operation))
+	if !ok {
+		return fail("bad OPERATION %q", t.operation)
+	}
+	res.operation = operationName(op)
+	version, err := parseVersion(r.version)
+	if t.version != "" {
+		version, err = parseVersion(r.expand(t.version))
+	}
+	if err != nil {
+		return fail("%v", err)
+	}
+	groups, err := r.buildGroups(t.groups)
+	if err != nil {
+		return fail("%v", err)
+	}
+	var document []byte
+	if t.file != "" {
+		data, _, err := readFile(tf.src, r.expand(t.file))
+		if err != nil {
+			return fail("FILE: %v", err)
+		}
+		if document, err = compress(data, strings.ToLower(r.expand(t.compression))); err != nil {
+			return fail("COMPRESSION: %v", err)
+		}
+	}
+	resource := r.resource
+	if t.resource != "" {
+		resource = r.expand(t.resource)
+	}
+	transfer := r.transfer
+	if t.transfer != "" {
+		transfer = strings.ToLower(r.expand(t.transfer))
+	}
+
+	if delay > 0 && !sleep(ctx, delay) {
+		return fail("interrupted")
+	}
+	start := time.Now()
+	defer func() { res.duration = time.Since(start) }()
+	for attempt := 1; ; attempt++ {
+		requestID := uint32(rand.Int31n(1<<30)) + 1
+		if !strings.EqualFold(t.requestID, "random") {
+			n, err := strconv.ParseUint(r.expand(t.requestID), 10, 31)
+			if err != nil {
+				return fail("bad REQUEST-ID %q", t.requestID)
+			}
+			requestID = uint32(n)
+		}
+		res.requestID = requestID
+		res.request = goipp.NewMessageWithGroups(version, goipp.Code(op), requestID, groups)
+		req := cupsclient.Request{
+			Resource: resource,
+			Message:  res.request,
+			Chunked:  transfer == "chunked",
+			Length:   transfer == "length",
+			Network:  r.network,
+			Timeout:  r.timeout,
+		}
+		if document != nil {
+			req.Document = bytes.NewReader(document)
+		}
+		resp, httpResp, err := r.client.Do(ctx, req)
+		res.response, res.errors, res.notes, res.displays = resp, nil, nil, nil
+		if err != nil {
+			if httpResp != nil && httpResp.StatusCode/100 != 2 {
+				return fail("Bad HTTP response: %s", httpResp.Status)
+			}
+			return fail("%v", err)
+		}
+		if r.validateHeaders {
+			res.errors = append(res.errors, checkHeaders(httpResp)...)
+		}
+		status := goipp.Status(resp.Code)
+		res.status = status.String()
+		res.message = attrText(resp.Operation, "status-message")
+		r.noteResponse(resp)
+		repeat, limit := r.check(t, res, resp, attempt)
+		if !repeat || attempt >= limit {
+			break
+		}
+		if !sleep(ctx, repeatDelay) {
+			return fail("interrupted")
+		}
+	}
+	for _, name := range t.displays {
+		for _, a := range findAttrs(r.expand(name), "", res.response) {
+			res.displays = append(res.displays, goipp.Attribute{Name: a.name, Values: a.values})
+		}
+	}
+	return res
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func parseVersion(s string) (goipp.Version, error) {
+	major, minor, ok := strings.Cut(s, ".")
+	ma, err1 := strconv.Atoi(major)
+	mi, err2 := strconv.Atoi(minor)
+	if !ok || err1 != nil || err2 != nil || ma < 1 || ma > 2 || mi < 0 || mi > 2 {
+		return 0, fmt.Errorf("bad VERSION %q", s)
+	}
+	return goipp.MakeVersion(uint8(ma), uint8(mi)), nil
+}
+
+func compress(data []byte, method string) ([]byte, error) {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch method {
+	case "", "none":
+		return data, nil
+	case "gzip":
+		w = gzip.NewWriter(&buf)
+	case "deflate":
+		w = zlib.NewWriter(&buf)
+	default:
+		return nil, fmt.Errorf("unknown compression %q", method)
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// checkHeaders is the -h validation of the HTTP response headers.
+func checkHeaders(resp *http.Response) []string {
+	var errs []string
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, goipp.ContentType) {
+		errs = append(errs, fmt.Sprintf("EXPECTED: Content-Type: %s (got %q)", goipp.ContentType, ct))
+	}
+	if resp.Header.Get("Date") == "" {
+		errs = append(errs, "EXPECTED: Date header")
+	}
+	return errs
+}
+
+func (r *runner) buildGroups(specs []requestGroup) (goipp.Groups, error) {
+	var groups goipp.Groups
+	for _, g := range specs {
+		tag, ok := lookupTag(r.expand(g.tag))
+		if !ok || !tag.IsGroup() {
+			return nil, fmt.Errorf("bad GROUP %q", g.tag)
+		}
+		attrs, err := r.buildAttrs(g.attrs)
+		if err != nil {
+			return nil, err
+		}
+		groups.Add(goipp.Group{Tag: tag, Attrs: attrs})
+	}
+	return groups, nil
+}
+
+func (r *runner) buildAttrs(specs []attrSpec) (goipp.Attributes, error) {
+	var attrs goipp.Attributes
+	for _, spec := range specs {
+		name := r.expand(spec.name)
+		if len(spec.colls) > 0 {
+			attr := goipp.Attribute{Name: name}
+			for _, members := range spec.colls {
+				coll, err := r.buildAttrs(members)
+				if err != nil {
+					return nil, err
+				}
+				attr.Values.Add(goipp.TagBeginCollection, goipp.Collection(coll))
+			}
+			attrs.Add(attr)
+			continue
+		}
+		tag, ok := lookupTag(r.expand(spec.tag))
+		if !ok || tag.IsGroup() || tag == goipp.TagBeginCollection {
+			return nil, fmt.Errorf("ATTR %s: bad value tag %q", name, spec.tag)
+		}
+		values, err := makeValues(tag, r.expand(spec.value))
+		if err != nil {
+			return nil, fmt.Errorf("ATTR %s: %v", name, err)
+		}
+		attrs.Add(goipp.Attribute{Name: name, Values: values})
+	}
+	return attrs, nil
+}
+
+// noteResponse keeps the job and subscription ids tests refer to as
+// $job-id, $job-uri and $notify-subscription-id.
+func (r *runner) noteResponse(resp *goipp.Message) {
+	for _, name := range []string{"job-id", "job-uri", "notify-subscription-id"} {
+		if found := findAttrs(name, "", resp); len(found) > 0 && len(found[0].values) > 0 {
+			r.vars[name] = valueString(found[0].values[0].T, found[0].values[0].V)
+		}
+	}
+}
+
+func attrText(attrs goipp.Attributes, name string) string {
+	for _, a := range attrs {
+		if a.Name == name && len(a.Values) > 0 {
+			return valueString(a.Values[0].T, a.Values[0].V)
+		}
+	}
+	return ""
+}
+
+// foundAttr is one occurrence of an attribute in a response, with the tag
+// of the group it is in. For member paths such as "media-col/media-size"
+// the values are those of the member across all the collection values.
+type foundAttr struct {
+	group  goipp.Tag
+	name   string
+	values goipp.Values
+}
+
+// findAttrs returns the occurrences of the attribute or member path name in
+// the response, limited to one group when group is set.
+func findAttrs(name, group string, resp *goipp.Message) []foundAttr {
+	if resp == nil {
+		return nil
+	}
+	var groupTag goipp.Tag
+	if group != "" {
+		tag, ok := lookupTag(group)
+		if !ok {
+			return nil
+		}
+		groupTag = tag
+	}
+	path := strings.Split(name, "/")
+	var out []foundAttr
+	for _, g := range resp.Groups {
+		if group != "" && g.Tag != groupTag {
+			continue
+		}
+		for _, a := range g.Attrs {
+			if a.Name != path[0] {
+				continue
+			}
+			values := a.Values
+			for _, member := range path[1:] {
+				var next goipp.Values
+				for _, v := range values {
+					coll, ok := v.V.(goipp.Collection)
+					if !ok {
+						continue
+					}
+					for _, m := range coll {
+						if m.Name == member {
+							next = append(next, m.Values...)
+						}
+					}
+				}
+				values = next
+			}
+			if len(values) > 0 {
+				out = append(out, foundAttr{group: g.Tag, name: name, values: values})
+			}
+		}
+	}
+	return out
+}
+
+func (r *runner) applies(c conditions) bool {
+	return (c.ifDefined == "" || r.defined(c.ifDefined)) && (c.ifNotDefined == "" || !r.defined(c.ifNotDefined))
+}
+
+// limit returns the REPEAT-LIMIT of c, or the default.
+func (c conditions) limit() int {
+	if c.repeatLimit > 0 {
+		return c.repeatLimit
+	}
+	return defaultRepeatLimit
+}
+
+// check evaluates the STATUS and EXPECT directives of t against resp. It
+// reports whether the test should be repeated and the repeat limit.
+func (r *runner) check(t *test, res *result, resp *goipp.Message, attempt int) (bool, int) {
+	repeat, limit := false, defaultRepeatLimit
+	wantRepeat := func(c conditions) bool {
+		if attempt < c.limit() {
+			repeat = true
+			limit = min(limit, c.limit())
+			return true
+		}
+		return false
+	}
+
+	got := goipp.Status(resp.Code)
+	var wanted []string
+	statusOK := false
+	for _, st := range t.statuses {
+		if !r.applies(st.conditions) {
+			continue
+		}
+		want, ok := lookupStatus(r.expand(st.status))
+		matched := ok && want == got
+		defines := st.defineMatch != "" || st.defineNoMatch != ""
+		if matched && st.defineMatch != "" {
+			r.vars[st.defineMatch] = "1"
+		}
+		if !matched && st.defineNoMatch != "" {
+			r.vars[st.defineNoMatch] = "1"
+		}
+		if matched && st.repeatMatch || !matched && st.repeatNoMatch {
+			wantRepeat(st.conditions)
+		}
+		if !defines {
+			wanted = append(wanted, r.expand(st.status))
+			statusOK = statusOK || matched
+		}
+	}
+	switch {
+	case len(wanted) > 0 && !statusOK:
+		res.errors = append(res.errors, fmt.Sprintf("EXPECTED: STATUS %s (got %s)", strings.Join(wanted, " or "), got))
+	case len(t.statuses) == 0 && got > goipp.StatusOkConflicting:
+		res.errors = append(res.errors, fmt.Sprintf("EXPECTED: STATUS successful-ok (got %s)", got))
+	}
+
+	for _, ex := range t.expects {
+		if !r.applies(ex.conditions) {
+			continue
+		}
+		matched, reason, found := r.matchExpect(ex, resp)
+		defines := ex.defineMatch != "" || ex.defineNoMatch != "" || ex.defineValue != ""
+		if matched {
+			if ex.defineMatch != "" {
+				r.vars[ex.defineMatch] = "1"
+			}
+			if ex.defineValue != "" && len(found) > 0 {
+				r.vars[ex.defineValue] = valuesString(found[0].values)
+			}
+			if ex.displayMatch != "" {
+				res.notes = append(res.notes, r.expand(ex.displayMatch))
+			}
+			if ex.repeatMatch {
+				wantRepeat(ex.conditions)
+			}
+			continue
+		}
+		if ex.defineNoMatch != "" {
+			r.vars[ex.defineNoMatch] = "1"
+		}
+		if ex.repeatNoMatch && wantRepeat(ex.conditions) {
+			continue
+		}
+		if !defines {
+			res.errors = append(res.errors, reason)
+		}
+	}
+	return repeat, limit
+}
+
+// matchExpect evaluates one EXPECT. It returns whether it matched, the
+// failure text when not, and the occurrences it looked at.
+func (r *runner) matchExpect(ex expect, resp *goipp.Message) (bool, string, []foundAttr) {
+	name := r.expand(ex.name)
+	found := findAttrs(name, "", resp)
+	if ex.absent {
+		return len(found) == 0, "EXPECTED: NOT " + name, found
+	}
+	if len(found) == 0 {
+		return ex.optional, "EXPECTED: " + name, found
+	}
+	targets := found[:1]
+	if ex.all {
+		targets = found
+	}
+	for _, f := range targets {
+		got := valuesString(f.values)
+		if ex.inGroup != "" {
+			if tag, ok := lookupTag(r.expand(ex.inGroup)); !ok || tag != f.group {
+				return false, fmt.Sprintf("EXPECTED: %s IN-GROUP %s (got %s)", name, ex.inGroup, f.group), found
+			}
+		}
+		if len(ex.ofType) > 0 {
+			for _, v := range f.values {
+				ok := false
+				for _, want := range ex.ofType {
+					ok = ok || tagMatches(v.T, want)
+				}
+				if !ok {
+					return false, fmt.Sprintf("EXPECTED: %s OF-TYPE %s (got %s)", name, strings.Join(ex.ofType, "|"), v.T), found
+				}
+			}
+		}
+		if ex.count >= 0 && len(f.values) != ex.count {
+			return false, fmt.Sprintf("EXPECTED: %s COUNT %d (got %d)", name, ex.count, len(f.values)), found
+		}
+		if ex.sameCountAs != "" {
+			other := findAttrs(r.expand(ex.sameCountAs), "", resp)
+			if len(other) == 0 || len(other[0].values) != len(f.values) {
+				return false, fmt.Sprintf("EXPECTED: %s SAME-COUNT-AS %s", name, ex.sameCountAs), found
+			}
+		}
+		for _, check := range ex.values {
+			pattern := r.expand(check.pattern)
+			matches := 0
+			for _, v := range f.values {
+				var ok bool
+				if check.part != "" {
+					ok = matchText(pattern, uriPart(check.part, valueString(v.T, v.V)))
+				} else {
+					ok = matchValue(pattern, v.T, v.V)
+				}
+				if ok {
+					matches++
+				}
+			}
+			if matches == 0 || check.all && matches != len(f.values) {
+				return false, fmt.Sprintf("EXPECTED: %s %s %q (got %s)", name, check.keyword(), pattern, got), found
+			}
+		}
+		if ex.valueFrom != "" {
+			if !valuesFrom(f.values, findAttrs(r.expand(ex.valueFrom), "", resp)) {
+				return false, fmt.Sprintf("EXPECTED: %s WITH-VALUE-FROM %s (got %s)", name, ex.valueFrom, got), found
+			}
+		}
+		if ex.distinct {
+			seen := map[string]bool{}
+			for _, v := range f.values {
+				s := valueString(v.T, v.V)
+				if seen[s] {
+					return false, fmt.Sprintf("EXPECTED: %s WITH-DISTINCT-VALUES (got %s twice)", name, s), found
+				}
+				seen[s] = true
+			}
+		}
+	}
+	return true, "", found
+}
+
+func (c valueCheck) keyword() string {
+	kind := "VALUE"
+	switch c.part {
+	case "scheme":
+		kind = "SCHEME"
+	case "hostname":
+		kind = "HOSTNAME"
+	case "resource":
+		kind = "RESOURCE"
+	}
+	if c.all {
+		if kind == "VALUE" {
+			return "WITH-ALL-VALUES"
+		}
+		return "WITH-ALL-" + kind + "S"
+	}
+	return "WITH-" + kind
+}
+
+// valuesFrom reports whether every value is one of the values of other;
+// an integer also matches a range that contains it.
+func valuesFrom(values goipp.Values, other []foundAttr) bool {
+	if len(other) == 0 {
+		return false
+	}
+	for _, v := range values {
+		ok := false
+		for _, o := range other[0].values {
+			if rng, isRange := o.V.(goipp.Range); isRange {
+				if n, isInt := v.V.(goipp.Integer); isInt && rng.Lower <= int(n) && int(n) <= rng.Upper {
+					ok = true
+				}
+			}
+			if valueString(v.T, v.V) == valueString(o.T, o.V) {
+				ok = true
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,302 @@
+package ipptool
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+var (
+	opsByName      = map[string]goipp.Op{}
+	statusesByName = map[string]goipp.Status{}
+	tagsByName     = map[string]goipp.Tag{}
+)
+
+func init() {
+	for i := 0; i < 0x4100; i++ {
+		if name := goipp.Op(i).String(); !strings.HasPrefix(name, "0x") {
+			opsByName[strings.ToLower(name)] = goipp.Op(i)
+		}
+	}
+	for i := 0; i < 0x1100; i++ {
+		if name := goipp.Status(i).String(); !strings.HasPrefix(name, "0x") {
+			statusesByName[strings.ToLower(name)] = goipp.Status(i)
+		}
+	}
+	for i := 0; i <= int(goipp.TagExtension); i++ {
+		if name := goipp.Tag(i).String(); !strings.HasPrefix(name, "0x") {
+			tagsByName[strings.ToLower(name)] = goipp.Tag(i)
+		}
+	}
+	// goipp misspells these two; accept the names from the IPP registry.
+	for name, op := range opNames {
+		opsByName[strings.ToLower(name)] = op
+	}
+	// The short names ipptool files use for the common value tags.
+	for alias, tag := range map[string]goipp.Tag{
+		"text":     goipp.TagText,
+		"name":     goipp.TagName,
+		"language": goipp.TagLanguage,
+		"mimetype": goipp.TagMimeType,
+		"string":   goipp.TagString,
+	} {
+		tagsByName[alias] = tag
+	}
+}
+
+// opNames are the registry names goipp spells differently.
+var opNames = map[string]goipp.Op{
+	"Get-Job-Attributes":      goipp.OpGetJobAttributes,
+	"Get-Print-Support-Files": goipp.OpGetPrintSupportFiles,
+}
+
+// operationName is the registry name of op.
+func operationName(op goipp.Op) string {
+	for name, o := range opNames {
+		if o == op {
+			return name
+		}
+	}
+	return op.String()
+}
+
+// parseHex reads the "0xHHHH" form operation and status codes may take.
+func parseHex(s string) (int, bool) {
+	if !strings.HasPrefix(strings.ToLower(s), "0x") {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[2:], 16, 16)
+	return int(n), err == nil
+}
+
+func lookupOperation(name string) (goipp.Op, bool) {
+	if n, ok := parseHex(name); ok {
+		return goipp.Op(n), true
+	}
+	op, ok := opsByName[strings.ToLower(name)]
+	return op, ok
+}
+
+func lookupStatus(name string) (goipp.Status, bool) {
+	if n, ok := parseHex(name); ok {
+		return goipp.Status(n), true
+	}
+	st, ok := statusesByName[strings.ToLower(name)]
+	return st, ok
+}
+
+// lookupTag finds a value tag, or a group tag with or without its
+// "-attributes-tag" suffix.
+func lookupTag(name string) (goipp.Tag, bool) {
+	name = strings.ToLower(name)
+	if tag, ok := tagsByName[name]; ok {
+		return tag, true
+	}
+	tag, ok := tagsByName[name+"-attributes-tag"]
+	return tag, ok
+}
+
+// tagMatches reports whether a value with tag satisfies the OF-TYPE name
+// want; "text" and "name" also accept the with-language forms.
+func tagMatches(tag goipp.Tag, want string) bool {
+	switch strings.ToLower(want) {
+	case "text":
+		return tag == goipp.TagText || tag == goipp.TagTextLang
+	case "name":
+		return tag == goipp.TagName || tag == goipp.TagNameLang
+	}
+	t, ok := lookupTag(want)
+	return ok && t == tag
+}
+
+var resolutionPattern = regexp.MustCompile(`^(\d+)(?:x(\d+))?(dpi|dpcm)$`)
+
+// makeValues converts the comma-separated text of an ATTR line.
+func makeValues(tag goipp.Tag, text string) (goipp.Values, error) {
+	var values goipp.Values
+	if tag.Type() == goipp.TypeVoid {
+		values.Add(tag, goipp.Void{})
+		return values, nil
+	}
+	for _, part := range splitValues(text) {
+		v, err := makeValue(tag, part)
+		if err != nil {
+			return nil, err
+		}
+		values.Add(tag, v)
+	}
+	return values, nil
+}
+
+func makeValue(tag goipp.Tag, text string) (goipp.Value, error) {
+	switch tag.Type() {
+	case goipp.TypeInteger:
+		n, err := strconv.ParseInt(text, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("bad %s value %q", tag, text)
+		}
+		return goipp.Integer(n), nil
+	case goipp.TypeBoolean:
+		switch strings.ToLower(text) {
+		case "true":
+			return goipp.Boolean(true), nil
+		case "false":
+			return goipp.Boolean(false), nil
+		}
+		return nil, fmt.Errorf("bad boolean value %q", text)
+	case goipp.TypeRange:
+		lo, hi, ok := strings.Cut(text, "-")
+		l, err1 := strconv.Atoi(lo)
+		h, err2 := strconv.Atoi(hi)
+		if !ok || err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("bad rangeOfInteger value %q", text)
+		}
+		return goipp.Range{Lower: l, Upper: h}, nil
+	case goipp.TypeResolution:
+		m := resolutionPattern.FindStringSubmatch(strings.ToLower(text))
+		if m == nil {
+			return nil, fmt.Errorf("bad resolution value %q", text)
+		}
+		x, _ := strconv.Atoi(m[1])
+		y := x
+		if m[2] != "" {
+			y, _ = strconv.Atoi(m[2])
+		}
+		units := goipp.UnitsDpi
+		if m[3] == "dpcm" {
+			units = goipp.UnitsDpcm
+		}
+		return goipp.Resolution{Xres: x, Yres: y, Units: units}, nil
+	case goipp.TypeDateTime:
+		t, err := time.Parse(time.RFC3339, text)
+		if err != nil {
+			return nil, fmt.Errorf("bad dateTime value %q", text)
+		}
+		return goipp.Time{Time: t}, nil
+	case goipp.TypeTextWithLang:
+		return goipp.TextWithLang{Lang: "en", Text: text}, nil
+	case goipp.TypeBinary:
+		return goipp.Binary(text), nil
+	}
+	return goipp.String(text), nil
+}
+
+// valueString formats a value the way reports and WITH-VALUE see it.
+func valueString(tag goipp.Tag, v goipp.Value) string {
+	switch val := v.(type) {
+	case goipp.Void:
+		return tag.String()
+	case goipp.Range:
+		return fmt.Sprintf("%d-%d", val.Lower, val.Upper)
+	case goipp.Resolution:
+		units := "dpi"
+		if val.Units == goipp.UnitsDpcm {
+			units = "dpcm"
+		}
+		if val.Xres == val.Yres {
+			return fmt.Sprintf("%d%s", val.Xres, units)
+		}
+		return fmt.Sprintf("%dx%d%s", val.Xres, val.Yres, units)
+	case goipp.Time:
+		return val.UTC().Format(time.RFC3339)
+	case goipp.TextWithLang:
+		return val.Text
+	case goipp.Binary:
+		return string(val)
+	case goipp.Collection:
+		parts := make([]string, 0, len(val))
+		for _, m := range val {
+			parts = append(parts, m.Name+"="+valuesString(m.Values))
+		}
+		return "{" + strings.Join(parts, " ") + "}"
+	}
+	return v.String()
+}
+
+func valuesString(values goipp.Values) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, valueString(v.T, v.V))
+	}
+	return strings.Join(parts, ",")
+}
+
+// isRegex reports whether a WITH-* pattern is a "/regular expression/".
+func isRegex(pattern string) bool {
+	return len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+func matchText(pattern, text string) bool {
+	if isRegex(pattern) {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		return err == nil && re.MatchString(text)
+	}
+	return pattern == text
+}
+
+// matchValue applies a WITH-VALUE pattern to one value: a regular
+// expression, "<n", ">n", "=n" or a list of numbers (decimal or 0x hex) for
+// integers and ranges (comparing the upper bound of a range), or a literal
+// string.
+func matchValue(pattern string, tag goipp.Tag, v goipp.Value) bool {
+	if isRegex(pattern) {
+		return matchText(pattern, valueString(tag, v))
+	}
+	lo, hi, numeric := 0, 0, false
+	switch val := v.(type) {
+	case goipp.Integer:
+		lo, hi, numeric = int(val), int(val), true
+	case goipp.Range:
+		lo, hi, numeric = val.Lower, val.Upper, true
+	}
+	if !numeric {
+		return pattern == valueString(tag, v)
+	}
+	for _, part := range strings.Split(pattern, ",") {
+		part = strings.TrimSpace(part)
+		op := ""
+		if part != "" && strings.ContainsRune("<>=", rune(part[0])) {
+			op, part = part[:1], part[1:]
+		}
+		n64, err := strconv.ParseInt(part, 0, 32)
+		if err != nil {
+			return false
+		}
+		n := int(n64)
+		switch op {
+		case "<":
+			if hi < n {
+				return true
+			}
+		case ">":
+			if hi > n {
+				return true
+			}
+		default:
+			if lo <= n && n <= hi {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// uriPart returns the scheme, hostname or resource of a URI value.
+func uriPart(part, value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		return ""
+	}
+	switch part {
+	case "scheme":
+		return u.Scheme
+	case "hostname":
+		return u.Hostname()
+	}
+	return u.Path
+}
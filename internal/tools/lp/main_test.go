@@ -1,9 +1,11 @@
-package main
+package lp
 
 import (
 	"errors"
 	"strings"
 	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
 )
 
 func TestParseArgsSupportsClustersAndAttachedValues(t *testing.T) {
@@ -120,3 +122,11 @@ func hasOption(options []string, want string) bool {
 	}
 	return false
 }
+
+func TestAddJobOptionJobPresetName(t *testing.T) {
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCreateJob, 1)
+	addJobOption(req, "job-preset-name", "booklet")
+	if len(req.Job) != 1 || req.Job[0].Name != "job-preset-name" || req.Job[0].Values[0].T != goipp.TagName {
+		t.Fatalf("unexpected job attributes: %v", req.Job)
+	}
+}
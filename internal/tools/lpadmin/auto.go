@@ -0,0 +1,316 @@
+package lpadmin
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/cupsclient"
+)
+
+// uuidLookupTimeout bounds the printer-uuid query sent to each ipp or
+// ipps device.
+const uuidLookupTimeout = 3 * time.Second
+
+// autoDevice is a discovered printer that can be set up with the
+// "everywhere" driver. Its key identifies the printer across URI forms:
+// the printer's UUID when known, otherwise its DNS-SD instance or its
+// host and resource.
+type autoDevice struct {
+	uri    string
+	name   string
+	key    string
+	secure bool
+}
+
+// autoAddPrinters implements --auto: every driverless printer the
+// scheduler discovers that has no queue yet gets a permanent, enabled
+// queue using the "everywhere" driver. The scheduler fills in the info,
+// location and defaults from the printer's own attributes.
+func autoAddPrinters(client *cupsclient.Client, opts options, out, errOut io.Writer) error {
+	groups, err := fetchAutoDevices(client)
+	if err != nil {
+		return err
+	}
+	names, uris, err := fetchQueues(client)
+	if err != nil {
+		return err
+	}
+	// A printer is often found both over DNS-SD and as an ipp URI, and its
+	// queue may have been set up through either; compare identities.
+	queued := map[string]bool{}
+	for _, uri := range uris {
+		queued[strings.ToLower(uri)] = true
+		if d, ok := parseAutoDevice(uri); ok {
+			queued[identifyAutoDevice(d, queryPrinterUUID).key] = true
+		}
+	}
+	added, failed := 0, 0
+	for _, d := range driverlessDevices(groups, queryPrinterUUID) {
+		if queued[strings.ToLower(d.uri)] || queued[d.key] {
+			continue
+		}
+		name := uniqueQueueName(queueName(d.name), names)
+		queue := options{printer: name, deviceURI: d.uri, ppdName: "everywhere", extraOpts: opts.extraOpts}
+		if err := addModifyPrinter(client, queue); err != nil {
+			fmt.Fprintf(errOut, "lpadmin: unable to add %s: %v\n", d.uri, err)
+			failed++
+			continue
+		}
+		names[strings.ToLower(name)] = true
+		if err := resumePrinter(client, name); err != nil {
+			return err
+		}
+		if err := acceptPrinter(client, name); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Added %s for %s\n", name, d.uri)
+		added++
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d driverless printers could not be added", failed, added+failed)
+	}
+	if added == 0 {
+		fmt.Fprintln(errOut, "lpadmin: no new driverless printers found")
+	}
+	return nil
+}
+
+func fetchAutoDevices(client *cupsclient.Client) (goipp.Groups, error) {
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCupsGetDevices, uint32(time.Now().UnixNano()))
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	req.Operation.Add(goipp.MakeAttr("include-schemes", goipp.TagName, goipp.String("dnssd"), goipp.String("ipp"), goipp.String("ipps")))
+	req.Operation.Add(goipp.MakeAttr("requested-attributes", goipp.TagKeyword, goipp.String("device-uri"), goipp.String("device-info")))
+	addRequestingUserName(&req.Operation, client)
+	resp, err := client.Send(context.Background(), req, nil)
+	if err != nil {
+		return nil, err
+	}
+	if goipp.Status(resp.Code) >= goipp.StatusRedirectionOtherSite {
+		return nil, statusError(resp)
+	}
+	return resp.Groups, nil
+}
+
+// fetchQueues returns the existing destination names, lower-cased, and
+// their device URIs.
+func fetchQueues(client *cupsclient.Client) (map[string]bool, []string, error) {
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCupsGetPrinters, uint32(time.Now().UnixNano()))
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	req.Operation.Add(goipp.MakeAttr("requested-attributes", goipp.TagKeyword, goipp.String("printer-name"), goipp.String("device-uri")))
+	addRequestingUserName(&req.Operation, client)
+	resp, err := client.Send(context.Background(), req, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	names, uris := map[string]bool{}, []string{}
+	if status := goipp.Status(resp.Code); status == goipp.StatusErrorNotFound {
+		return names, uris, nil
+	} else if status >= goipp.StatusRedirectionOtherSite {
+		return nil, nil, statusError(resp)
+	}
+	for _, g := range resp.Groups {
+		if g.Tag != goipp.TagPrinterGroup {
+			continue
+		}
+		if name := findAttr(g.Attrs, "printer-name"); name != "" {
+			names[strings.ToLower(name)] = true
+		}
+		if uri := findAttr(g.Attrs, "device-uri"); uri != "" {
+			uris = append(uris, uri)
+		}
+	}
+	return names, uris, nil
+}
+
+// driverlessDevices picks the IPP Everywhere candidates from a
+// CUPS-Get-Devices response: ipp, ipps and DNS-SD IPP services, leaving
+// out queues shared by other CUPS servers. A printer found under several
+// URIs is listed once, preferring an ipps URI; lookupUUID asks an ipp or
+// ipps device for its printer-uuid.
+func driverlessDevices(groups goipp.Groups, lookupUUID func(uri string) string) []autoDevice {
+	var devices []autoDevice
+	index := map[string]int{}
+	for _, g := range groups {
+		if g.Tag != goipp.TagPrinterGroup {
+			continue
+		}
+		d, ok := parseAutoDevice(findAttr(g.Attrs, "device-uri"))
+		if !ok {
+			continue
+		}
+		d = identifyAutoDevice(d, lookupUUID)
+		if i, seen := index[d.key]; seen {
+			if d.secure && !devices[i].secure {
+				devices[i] = d
+			}
+			continue
+		}
+		index[d.key] = len(devices)
+		devices = append(devices, d)
+	}
+	return devices
+}
+
+// identifyAutoDevice keys an ipp or ipps device by the printer-uuid it
+// reports, so it matches the DNS-SD URI of the same printer.
+func identifyAutoDevice(d autoDevice, lookupUUID func(uri string) string) autoDevice {
+	if strings.HasPrefix(d.key, "ipp:") && lookupUUID != nil {
+		if uuid := normalizeUUID(lookupUUID(d.uri)); uuid != "" {
+			d.key = "uuid:" + uuid
+		}
+	}
+	return d
+}
+
+func normalizeUUID(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.TrimPrefix(s, "urn:uuid:")
+}
+
+func parseAutoDevice(uri string) (autoDevice, bool) {
+	uri = strings.TrimSpace(uri)
+	scheme, rest, ok := strings.Cut(uri, "://")
+	if !ok {
+		return autoDevice{}, false
+	}
+	switch strings.ToLower(scheme) {
+	case "dnssd":
+		// dnssd://Instance%20Name._ipps._tcp.local/?uuid=...; CUPS shares
+		// its queues with a "/cups" path.
+		host, path, _ := strings.Cut(rest, "/")
+		path, query, _ := strings.Cut(path, "?")
+		if path == "cups" {
+			return autoDevice{}, false
+		}
+		for _, service := range []string{"._ipps._tcp.", "._ipp._tcp."} {
+			i := strings.Index(strings.ToLower(host), service)
+			if i <= 0 {
+				continue
+			}
+			instance, err := url.PathUnescape(host[:i])
+			if err != nil {
+				instance = host[:i]
+			}
+			key := "dnssd:" + strings.ToLower(instance)
+			if values, err := url.ParseQuery(query); err == nil && normalizeUUID(values.Get("uuid")) != "" {
+				key = "uuid:" + normalizeUUID(values.Get("uuid"))
+			}
+			return autoDevice{uri: uri, name: instance, key: key, secure: service == "._ipps._tcp."}, true
+		}
+		return autoDevice{}, false
+	case "ipp", "ipps":
+		u, err := url.Parse(uri)
+		if err != nil || u.Hostname() == "" {
+			return autoDevice{}, false
+		}
+		if strings.HasPrefix(u.Path, "/printers/") || strings.HasPrefix(u.Path, "/classes/") {
+			return autoDevice{}, false
+		}
+		host := strings.TrimSuffix(strings.TrimSuffix(u.Hostname(), "."), ".local")
+		return autoDevice{uri: uri, name: host, key: "ipp:" + strings.ToLower(u.Hostname()+u.Path), secure: strings.EqualFold(scheme, "ipps")}, true
+	}
+	return autoDevice{}, false
+}
+
+// queryPrinterUUID asks an ipp or ipps device for its printer-uuid and
+// returns "" when the device does not answer in time or has none.
+func queryPrinterUUID(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "ipp":
+		u.Scheme = "http"
+	case "ipps":
+		u.Scheme = "https"
+	default:
+		return ""
+	}
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpGetPrinterAttributes, uint32(time.Now().UnixNano()))
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String(uri)))
+	req.Operation.Add(goipp.MakeAttribute("requested-attributes", goipp.TagKeyword, goipp.String("printer-uuid")))
+	payload, err := req.EncodeBytes()
+	if err != nil {
+		return ""
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), uuidLookupTimeout)
+	defer cancel()
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(payload))
+	if err != nil {
+		return ""
+	}
+	httpReq.Header.Set("Content-Type", goipp.ContentType)
+	// Printers mostly have self-signed certificates; follow the IPP
+	// backend's CUPS_IPP_INSECURE setting.
+	insecure := strings.ToLower(os.Getenv("CUPS_IPP_INSECURE"))
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if insecure == "1" || insecure == "true" || insecure == "yes" || insecure == "on" {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return ""
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return ""
+	}
+	msg := &goipp.Message{}
+	if err := msg.Decode(resp.Body); err != nil {
+		return ""
+	}
+	return findAttr(msg.Printer, "printer-uuid")
+}
+
+// queueName turns a DNS-SD instance or host name into a queue name:
+// anything but ASCII letters and digits becomes an underscore, without
+// repeats at either end or in the middle.
+func queueName(s string) string {
+	var b strings.Builder
+	pending := false
+	for _, r := range s {
+		if r < 128 && (r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			if pending && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			pending = false
+			b.WriteRune(r)
+			continue
+		}
+		pending = true
+	}
+	name := b.String()
+	if len(name) > 120 {
+		name = strings.TrimRight(name[:120], "_")
+	}
+	if name == "" {
+		name = "Printer"
+	}
+	return name
+}
+
+// uniqueQueueName adds _2, _3, ... to base until it is not in taken.
+func uniqueQueueName(base string, taken map[string]bool) string {
+	name := base
+	for n := 2; taken[strings.ToLower(name)]; n++ {
+		name = base + "_" + strconv.Itoa(n)
+	}
+	return name
+}
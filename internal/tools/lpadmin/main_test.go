@@ -1,8 +1,12 @@
-package main
+package lpadmin
 
 import (
+	"bytes"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
 
 	goipp "github.com/OpenPrinting/goipp"
@@ -331,3 +335,186 @@ func TestNormalizeClassMembersAlignsAndDedups(t *testing.T) {
 		t.Fatalf("unexpected normalized uris: %v", uris)
 	}
 }
+
+func TestParseArgsAuto(t *testing.T) {
+	opts, err := parseArgs([]string{"-E", "--auto", "-o", "sides=two-sided-long-edge"})
+	if err != nil {
+		t.Fatalf("parseArgs error: %v", err)
+	}
+	if !opts.auto || !opts.encrypt || opts.extraOpts["sides"] != "two-sided-long-edge" {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if _, err := parseArgs([]string{"--auto", "-p", "Office"}); err == nil {
+		t.Fatal("expected --auto with -p to be rejected")
+	}
+}
+
+func TestDriverlessDevices(t *testing.T) {
+	var groups goipp.Groups
+	for _, uri := range []string{
+		"dnssd://HP%20LaserJet%20M404%20%5B1A2B3C%5D._ipp._tcp.local/?uuid=1",
+		"dnssd://HP%20LaserJet%20M404%20%5B1A2B3C%5D._ipps._tcp.local/?uuid=1",
+		"dnssd://Shared%20Queue._ipp._tcp.local/cups?uuid=2",
+		"dnssd://Old%20Box._printer._tcp.local/",
+		"ipp://printer.local/ipp/print",
+		"ipps://printer.local/ipp/print",
+		"ipp://server.local:631/printers/Office",
+		"socket://10.0.0.5:9100",
+		"dnssd://Lab._ipp._tcp.local/?uuid=9",
+		"ipp://lab.local/ipp/print",
+	} {
+		groups = append(groups, goipp.Group{Tag: goipp.TagPrinterGroup, Attrs: goipp.Attributes{
+			goipp.MakeAttribute("device-uri", goipp.TagURI, goipp.String(uri)),
+		}})
+	}
+	// The ipp URI of the Lab printer reports the UUID of its DNS-SD entry.
+	got := driverlessDevices(groups, func(uri string) string {
+		if uri == "ipp://lab.local/ipp/print" {
+			return "urn:uuid:9"
+		}
+		return ""
+	})
+	if len(got) != 3 {
+		t.Fatalf("devices = %+v", got)
+	}
+	if got[0].uri != "dnssd://HP%20LaserJet%20M404%20%5B1A2B3C%5D._ipps._tcp.local/?uuid=1" || got[0].name != "HP LaserJet M404 [1A2B3C]" {
+		t.Fatalf("dnssd device = %+v", got[0])
+	}
+	if got[1].uri != "ipps://printer.local/ipp/print" || got[1].name != "printer" {
+		t.Fatalf("ipp device = %+v", got[1])
+	}
+	if got[2].uri != "dnssd://Lab._ipp._tcp.local/?uuid=9" {
+		t.Fatalf("lab device = %+v", got[2])
+	}
+}
+
+func TestQueueName(t *testing.T) {
+	for in, want := range map[string]string{
+		"HP LaserJet M404 [1A2B3C]": "HP_LaserJet_M404_1A2B3C",
+		"  Büro--Drucker ":          "B_ro_Drucker",
+		"192.168.1.20":              "192_168_1_20",
+		"!!!":                       "Printer",
+	} {
+		if got := queueName(in); got != want {
+			t.Errorf("queueName(%q) = %q, want %q", in, got, want)
+		}
+	}
+	if got := uniqueQueueName("Lab", map[string]bool{"lab": true, "lab_2": true}); got != "Lab_3" {
+		t.Fatalf("uniqueQueueName = %q", got)
+	}
+}
+
+func TestAutoAddPrinters(t *testing.T) {
+	t.Setenv("CUPS_CLIENT_CONF_DIR", t.TempDir())
+	t.Setenv("CUPS_USER_CONF_DIR", t.TempDir())
+	var mu sync.Mutex
+	var added []goipp.Attributes
+	var ops []goipp.Op
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := &goipp.Message{}
+		if err := req.Decode(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		ops = append(ops, goipp.Op(req.Code))
+		resp := goipp.NewResponse(goipp.DefaultVersion, goipp.StatusOk, req.RequestID)
+		resp.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+		var groups goipp.Groups
+		printer := func(attrs ...goipp.Attribute) {
+			groups = append(groups, goipp.Group{Tag: goipp.TagPrinterGroup, Attrs: attrs})
+		}
+		switch goipp.Op(req.Code) {
+		case goipp.OpCupsGetDevices:
+			// The Lab and Old printers are also found as ipp URIs.
+			for _, uri := range []string{"dnssd://Lab._ipp._tcp.local/?uuid=lab", "ipp://" + r.Host + "/ipp/lab", "dnssd://Front%20Desk._ipps._tcp.local/", "ipp://" + r.Host + "/ipp/old", "ipp://" + r.Host + "/ipp/broken"} {
+				printer(goipp.MakeAttribute("device-uri", goipp.TagURI, goipp.String(uri)))
+			}
+		case goipp.OpGetPrinterAttributes:
+			// Devices answer on their own paths.
+			if uuid := map[string]string{"/ipp/lab": "urn:uuid:LAB", "/ipp/old": "urn:uuid:old"}[r.URL.Path]; uuid != "" {
+				printer(goipp.MakeAttribute("printer-uuid", goipp.TagURI, goipp.String(uuid)))
+			}
+		case goipp.OpCupsGetPrinters:
+			printer(goipp.MakeAttribute("printer-name", goipp.TagName, goipp.String("lab")),
+				goipp.MakeAttribute("device-uri", goipp.TagURI, goipp.String("file:///dev/null")))
+			// Old was set up through its DNS-SD URI.
+			printer(goipp.MakeAttribute("printer-name", goipp.TagName, goipp.String("Old")),
+				goipp.MakeAttribute("device-uri", goipp.TagURI, goipp.String("dnssd://Old._ipps._tcp.local/?uuid=old")))
+		case goipp.OpCupsAddModifyPrinter:
+			if strings.HasSuffix(findAttr(req.Printer, "device-uri"), "/ipp/broken") {
+				resp.Code = goipp.Code(goipp.StatusErrorDevice)
+				resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String("no media sizes in IPP response")))
+				break
+			}
+			added = append(added, req.Printer)
+		}
+		if len(groups) > 0 {
+			resp.Groups = append(goipp.Groups{{Tag: goipp.TagOperationGroup, Attrs: resp.Operation}}, groups...)
+		}
+		data, _ := resp.EncodeBytes()
+		w.Header().Set("Content-Type", goipp.ContentType)
+		w.Write(data)
+	}))
+	defer srv.Close()
+
+	client := cupsclient.NewFromConfig(cupsclient.WithServer(strings.TrimPrefix(srv.URL, "http://")))
+	var out, errOut bytes.Buffer
+	err := autoAddPrinters(client, options{extraOpts: map[string]string{"sides": "two-sided-long-edge"}}, &out, &errOut)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Fatalf("autoAddPrinters error = %v\n%s", err, errOut.String())
+	}
+	if out.String() != "Added Lab_2 for dnssd://Lab._ipp._tcp.local/?uuid=lab\nAdded Front_Desk for dnssd://Front%20Desk._ipps._tcp.local/\n" {
+		t.Fatalf("output:\n%s", out.String())
+	}
+	if !strings.Contains(errOut.String(), "/ipp/broken: server-error-device-error: no media sizes") {
+		t.Fatalf("errors:\n%s", errOut.String())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(added) != 2 || findAttr(added[0], "ppd-name") != "everywhere" || findAttr(added[0], "sides-default") != "two-sided-long-edge" {
+		t.Fatalf("added printers = %v", added)
+	}
+	accepts := 0
+	for _, op := range ops {
+		if op == goipp.OpCupsAcceptJobs {
+			accepts++
+		}
+	}
+	if accepts != 2 {
+		t.Fatalf("operations = %v", ops)
+	}
+}
+
+func TestApplyLpadminJobPresets(t *testing.T) {
+	opts, err := parseArgs([]string{"-p", "Office", "-o", "job-preset-booklet=sides=two-sided-short-edge number-up=2", "-o", "sides=one-sided", "-R", "job-preset-Draft"})
+	if err != nil {
+		t.Fatalf("parseArgs error: %v", err)
+	}
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpCupsAddModifyPrinter, 1)
+	applyLpadminOptions(req, opts.extraOpts)
+	applyLpadminRemovals(req, opts.removeOpts)
+	applyLpadminJobPresets(req, opts.extraOpts, opts.removeOpts)
+
+	if len(req.Printer) != 2 || req.Printer[0].Name != "sides-default" || req.Printer[1].Name != "job-presets-supported" {
+		t.Fatalf("unexpected printer attributes: %v", req.Printer)
+	}
+	presets := req.Printer[1].Values
+	if len(presets) != 2 {
+		t.Fatalf("job-presets-supported = %v", presets)
+	}
+	booklet := presets[0].V.(goipp.Collection)
+	if findAttr(goipp.Attributes(booklet), "preset-name") != "booklet" || findAttr(goipp.Attributes(booklet), "sides") != "two-sided-short-edge" {
+		t.Fatalf("booklet preset = %v", booklet)
+	}
+	for _, a := range booklet {
+		if a.Name == "number-up" && a.Values[0].T != goipp.TagInteger {
+			t.Fatalf("number-up encoded as %s", a.Values[0].T)
+		}
+	}
+	if draft := presets[1].V.(goipp.Collection); len(draft) != 1 || findAttr(goipp.Attributes(draft), "preset-name") != "Draft" {
+		t.Fatalf("removal preset = %v", draft)
+	}
+}
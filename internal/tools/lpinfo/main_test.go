@@ -1,8 +1,12 @@
-package main
+package lpinfo
 
 import (
 	"errors"
 	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/report"
 )
 
 func TestParseArgsSupportsShortClustersAndAttachedValues(t *testing.T) {
@@ -86,3 +90,21 @@ func TestEverywhereSchemeFilter(t *testing.T) {
 		t.Fatalf("did not expect everywhere when excluded")
 	}
 }
+
+func TestFormatOptionAndRecords(t *testing.T) {
+	opts, err := parseArgs([]string{"-v", "--format=csv"})
+	if err != nil || opts.format != report.FormatCSV {
+		t.Fatalf("parseArgs: %+v %v", opts, err)
+	}
+	dev := deviceRecord(deviceRow{uri: "usb://Acme/Laser", deviceID: "MFG:Acme;MDL:Laser;"})
+	if dev.Get("class") != "direct" || dev.Get("device_id") != "MFG:Acme;MDL:Laser;" {
+		t.Fatalf("unexpected device record: %+v", dev)
+	}
+	model := modelRecord(goipp.Attributes{
+		goipp.MakeAttribute("ppd-name", goipp.TagName, goipp.String("acme/laser.ppd")),
+		goipp.MakeAttribute("ppd-make", goipp.TagText, goipp.String("Acme")),
+	})
+	if model.Get("name") != "acme/laser.ppd" || model.Get("make") != "Acme" || model.Get("product") != "" {
+		t.Fatalf("unexpected model record: %+v", model)
+	}
+}
@@ -0,0 +1,78 @@
+package lpinfo
+
+import (
+	"os"
+	"strings"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/cupsclient"
+	"cupsgolang/internal/report"
+)
+
+// writeReport emits the -v devices and -m models as one --format document.
+func writeReport(client *cupsclient.Client, opts options) error {
+	w := &report.Writer{Format: opts.format}
+	if opts.showDevices {
+		rows, err := fetchDevices(client, opts)
+		if err != nil {
+			return err
+		}
+		w.Add("devices")
+		for _, row := range rows {
+			w.Add("devices", deviceRecord(row))
+		}
+	}
+	if opts.showModels {
+		models, err := fetchModels(client, opts)
+		if err != nil {
+			return err
+		}
+		w.Add("models")
+		seenEverywhere := false
+		for _, attrs := range models {
+			rec := modelRecord(attrs)
+			if strings.EqualFold(rec.Get("name").(string), "everywhere") {
+				seenEverywhere = true
+			}
+			w.Add("models", rec)
+		}
+		if shouldAppendEverywhere(opts.includeSchemes, opts.excludeSchemes) && !seenEverywhere {
+			w.Add("models", modelRecord(goipp.Attributes{
+				goipp.MakeAttribute("ppd-name", goipp.TagName, goipp.String("everywhere")),
+				goipp.MakeAttribute("ppd-make-and-model", goipp.TagText, goipp.String("IPP Everywhere")),
+				goipp.MakeAttribute("ppd-device-id", goipp.TagText, goipp.String("CMD:PwgRaster")),
+				goipp.MakeAttribute("ppd-natural-language", goipp.TagLanguage, goipp.String("en")),
+			}))
+		}
+	}
+	return w.Flush(os.Stdout)
+}
+
+func deviceRecord(row deviceRow) report.Record {
+	class := strings.TrimSpace(row.class)
+	if class == "" {
+		class = "direct"
+	}
+	return report.Record{
+		{Name: "uri", Value: row.uri},
+		{Name: "class", Value: class},
+		{Name: "info", Value: row.info},
+		{Name: "make_and_model", Value: row.make},
+		{Name: "device_id", Value: row.deviceID},
+		{Name: "location", Value: row.location},
+		{Name: "attributes", Value: report.Attributes(row.attrs)},
+	}
+}
+
+func modelRecord(attrs goipp.Attributes) report.Record {
+	return report.Record{
+		{Name: "name", Value: findAttr(attrs, "ppd-name")},
+		{Name: "make", Value: findAttr(attrs, "ppd-make")},
+		{Name: "make_and_model", Value: findAttr(attrs, "ppd-make-and-model")},
+		{Name: "device_id", Value: findAttr(attrs, "ppd-device-id")},
+		{Name: "natural_language", Value: findAttr(attrs, "ppd-natural-language")},
+		{Name: "product", Value: findAttr(attrs, "ppd-product")},
+		{Name: "attributes", Value: report.Attributes(attrs)},
+	}
+}
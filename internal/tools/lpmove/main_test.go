@@ -1,11 +1,9 @@
-package main
+package lpmove
 
 import (
 	"errors"
 	"testing"
 
-	goipp "github.com/OpenPrinting/goipp"
-
 	"cupsgolang/internal/cupsclient"
 )
 
@@ -144,12 +142,3 @@ func TestBuildMoveRequestUsesPrinterURIForSourceAndDestination(t *testing.T) {
 		t.Fatalf("expected printer destination URI, got %q", got)
 	}
 }
-
-func findAttr(attrs goipp.Attributes, name string) string {
-	for _, attr := range attrs {
-		if attr.Name == name && len(attr.Values) > 0 {
-			return attr.Values[0].V.String()
-		}
-	}
-	return ""
-}
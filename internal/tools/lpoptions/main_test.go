@@ -1,9 +1,12 @@
-package main
+package lpoptions
 
 import (
 	"errors"
 	"reflect"
 	"testing"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/report"
 )
 
 func TestParseArgsSupportsClustersAndAttachedValues(t *testing.T) {
@@ -88,3 +91,26 @@ func TestFormatOptionTokensQuotesValuesWithSpaces(t *testing.T) {
 		t.Fatalf("unexpected tokens: %#v", tokens)
 	}
 }
+
+func TestParseArgsFormatAndPPDOptionOrder(t *testing.T) {
+	opts, err := parseArgs([]string{"-pOffice", "--format", "json", "-l"})
+	if err != nil || opts.format != report.FormatJSON || !opts.list {
+		t.Fatalf("parseArgs: %+v %v", opts, err)
+	}
+	duplex := &config.PPDOption{Keyword: "Duplex"}
+	ppd := &config.PPD{
+		Groups: []config.PPDGroup{{Name: "General", Options: []*config.PPDOption{duplex, {Keyword: "PageRegion"}}}},
+		OptionDetails: map[string]*config.PPDOption{
+			"Duplex":     duplex,
+			"Resolution": {Keyword: "Resolution"},
+			"InputSlot":  {Keyword: "InputSlot"},
+		},
+	}
+	var got []string
+	for _, opt := range ppdOptions(ppd) {
+		got = append(got, opt.Keyword)
+	}
+	if want := []string{"Duplex", "InputSlot", "Resolution"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("ppdOptions = %v, want %v", got, want)
+	}
+}
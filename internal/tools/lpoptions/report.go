@@ -0,0 +1,88 @@
+package lpoptions
+
+import (
+	"os"
+	"sort"
+
+	"cupsgolang/internal/cupsclient"
+	"cupsgolang/internal/report"
+)
+
+// writeDefaultsReport emits the options lpoptions would print for dest,
+// one record per option, noting whether the value is the printer's
+// default or the user's lpoptions setting.
+func writeDefaultsReport(client *cupsclient.Client, dest string, store *lpOptionsFile, format report.Format) error {
+	remote, local, err := destinationDefaults(client, dest, store)
+	if err != nil {
+		return err
+	}
+	names := map[string]bool{}
+	for name := range remote {
+		names[name] = true
+	}
+	for name := range local {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	w := &report.Writer{Format: format}
+	w.Add("options")
+	for _, name := range sorted {
+		value, source := remote[name], "printer"
+		if v, ok := local[name]; ok {
+			value, source = v, "lpoptions"
+		}
+		w.Add("options", report.Record{
+			{Name: "destination", Value: dest},
+			{Name: "name", Value: name},
+			{Name: "value", Value: value},
+			{Name: "source", Value: source},
+		})
+	}
+	return w.Flush(os.Stdout)
+}
+
+// writeSupportedReport emits the PPD options -l lists, one record per
+// option with its choices and the selected ones.
+func writeSupportedReport(client *cupsclient.Client, dest string, store *lpOptionsFile, format report.Format) error {
+	ppd, destOpts, err := supportedOptions(client, dest, store)
+	if err != nil {
+		return err
+	}
+	w := &report.Writer{Format: format}
+	w.Add("ppd_options")
+	for _, opt := range ppdOptions(ppd) {
+		selectedSet := resolveSelectedChoices(opt, destOpts)
+		choices := []string{}
+		selected := []string{}
+		for _, choice := range opt.Choices {
+			if choice.Choice == "" {
+				continue
+			}
+			choices = append(choices, choice.Choice)
+			if selectedSet[choice.Choice] {
+				selected = append(selected, choice.Choice)
+			}
+		}
+		text := opt.Text
+		if text == "" {
+			text = opt.Keyword
+		}
+		w.Add("ppd_options", report.Record{
+			{Name: "destination", Value: dest},
+			{Name: "keyword", Value: opt.Keyword},
+			{Name: "text", Value: text},
+			{Name: "group", Value: opt.Group},
+			{Name: "ui", Value: opt.UI},
+			{Name: "default", Value: opt.Default},
+			{Name: "choices", Value: choices},
+			{Name: "selected", Value: selected},
+			{Name: "custom", Value: opt.Custom},
+		})
+	}
+	return w.Flush(os.Stdout)
+}
@@ -1,4 +1,4 @@
-package main
+package lpq
 
 import (
 	"errors"
@@ -6,6 +6,8 @@ import (
 	"testing"
 
 	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/report"
 )
 
 func TestParseArgsSupportsClusterAndInterval(t *testing.T) {
@@ -103,3 +105,27 @@ func TestDestinationURIEscapesName(t *testing.T) {
 		t.Fatalf("destinationURI = %q, want encoded path segment", got)
 	}
 }
+
+func TestParseArgsFormatAndJobRecord(t *testing.T) {
+	opts, err := parseArgs([]string{"--format=yaml", "-a"})
+	if err != nil || opts.format != report.FormatYAML || !opts.showAll {
+		t.Fatalf("parseArgs: %+v %v", opts, err)
+	}
+	if _, err := parseArgs([]string{"--format", "xml"}); err == nil {
+		t.Fatalf("expected an error for an unknown format")
+	}
+	job := parseJobView(goipp.Attributes{
+		goipp.MakeAttribute("job-id", goipp.TagInteger, goipp.Integer(7)),
+		goipp.MakeAttribute("job-state", goipp.TagEnum, goipp.Integer(4)),
+		goipp.MakeAttribute("job-printer-uri", goipp.TagURI, goipp.String("ipp://localhost/printers/Office")),
+		goipp.MakeAttr("job-state-reasons", goipp.TagKeyword, goipp.String("job-hold-until-specified")),
+		goipp.MakeAttribute("time-at-creation", goipp.TagInteger, goipp.Integer(1700000000)),
+	})
+	rec := jobRecord(job, "1st")
+	if rec.Get("id") != 7 || rec.Get("printer") != "Office" || rec.Get("state") != "pending-held" || rec.Get("created_at") != "2023-11-14T22:13:20Z" {
+		t.Fatalf("unexpected job record: %+v", rec)
+	}
+	if reasons := rec.Get("state_reasons").([]string); len(reasons) != 1 || reasons[0] != "job-hold-until-specified" {
+		t.Fatalf("unexpected reasons: %v", reasons)
+	}
+}
@@ -0,0 +1,87 @@
+package lpq
+
+import (
+	"os"
+	"strings"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/cupsclient"
+	"cupsgolang/internal/report"
+)
+
+// writeReport emits the destination status and queue as one --format
+// document and returns the number of jobs listed. With +interval each
+// refresh is a separate document.
+func writeReport(client *cupsclient.Client, opts options) (int, error) {
+	w := &report.Writer{Format: opts.format}
+	if dest := strings.TrimSpace(opts.destination); dest != "" {
+		attrs, err := fetchPrinter(client, dest)
+		if err != nil {
+			return 0, err
+		}
+		w.Add("printers", printerRecord(dest, attrs))
+	}
+	jobs, err := fetchJobs(client, opts)
+	if err != nil {
+		return 0, err
+	}
+	w.Add("jobs")
+	rank, count := 1, 0
+	for _, job := range jobs {
+		if !job.HasDest || job.ID == 0 {
+			continue
+		}
+		w.Add("jobs", jobRecord(job, rankString(job.State, rank)))
+		if job.State != 4 {
+			rank++
+		}
+		count++
+	}
+	return count, w.Flush(os.Stdout)
+}
+
+func printerRecord(name string, attrs goipp.Attributes) report.Record {
+	return report.Record{
+		{Name: "name", Value: name},
+		{Name: "state", Value: report.PrinterState(attrInt(attrs, "printer-state", 0))},
+		{Name: "state_reasons", Value: report.Strings(attrStrings(attrs, "printer-state-reasons"))},
+		{Name: "state_message", Value: findAttr(attrs, "printer-state-message")},
+		{Name: "accepting", Value: findAttr(attrs, "printer-is-accepting-jobs") == "true"},
+		{Name: "attributes", Value: report.Attributes(attrs)},
+	}
+}
+
+func jobRecord(job jobView, rank string) report.Record {
+	return report.Record{
+		{Name: "rank", Value: rank},
+		{Name: "id", Value: job.ID},
+		{Name: "name", Value: job.Name},
+		{Name: "user", Value: job.User},
+		{Name: "printer", Value: job.Dest},
+		{Name: "state", Value: report.JobState(job.State)},
+		{Name: "state_reasons", Value: report.Strings(attrStrings(job.Attrs, "job-state-reasons"))},
+		{Name: "state_message", Value: findAttr(job.Attrs, "job-printer-state-message")},
+		{Name: "size_kb", Value: job.SizeKB},
+		{Name: "copies", Value: job.Copies},
+		{Name: "priority", Value: attrInt(job.Attrs, "job-priority", 0)},
+		{Name: "created_at", Value: report.Time(int64(attrInt(job.Attrs, "time-at-creation", 0)))},
+		{Name: "processing_at", Value: report.Time(int64(attrInt(job.Attrs, "time-at-processing", 0)))},
+		{Name: "completed_at", Value: report.Time(int64(attrInt(job.Attrs, "time-at-completed", 0)))},
+		{Name: "attributes", Value: report.Attributes(job.Attrs)},
+	}
+}
+
+func attrStrings(attrs goipp.Attributes, name string) []string {
+	for _, a := range attrs {
+		if a.Name != name {
+			continue
+		}
+		out := make([]string, 0, len(a.Values))
+		for _, v := range a.Values {
+			out = append(out, v.V.String())
+		}
+		return out
+	}
+	return nil
+}
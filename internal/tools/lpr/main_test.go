@@ -1,4 +1,4 @@
-package main
+package lpr
 
 import (
 	"errors"
@@ -7,6 +7,8 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
 )
 
 func TestParseArgsSupportsCoreFlags(t *testing.T) {
@@ -142,3 +144,11 @@ func TestMergeDestinationOptionsPrefersCLIAndInstance(t *testing.T) {
 		t.Fatalf("media = %q, want A4", got["media"])
 	}
 }
+
+func TestAddJobOptionsJobPresetName(t *testing.T) {
+	req := goipp.NewRequest(goipp.DefaultVersion, goipp.OpPrintJob, 1)
+	addJobOptions(req, map[string]string{"job-preset-name": "draft-duplex-bw"})
+	if len(req.Job) != 1 || req.Job[0].Name != "job-preset-name" || req.Job[0].Values[0].T != goipp.TagName {
+		t.Fatalf("unexpected job attributes: %v", req.Job)
+	}
+}
@@ -1,4 +1,4 @@
-package main
+package lprm
 
 import (
 	"errors"
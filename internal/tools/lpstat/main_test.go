@@ -1,6 +1,12 @@
-package main
+package lpstat
 
-import "testing"
+import (
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/report"
+)
 
 func TestParseArgsSupportsShortClustersAndAttachedValues(t *testing.T) {
 	opts := parseArgs([]string{"-rD", "-pOffice", "-ualice,bob", "-Wcompleted", "-E"})
@@ -107,3 +113,56 @@ func TestNormalizeOptionsDefaultJobsUsesCaller(t *testing.T) {
 		t.Fatalf("expected default which-jobs, got %q", opts.whichJobs)
 	}
 }
+
+func TestParseArgsAudit(t *testing.T) {
+	opts := parseArgs([]string{"--audit", "-ualice", "Office"})
+	normalizeOptions(&opts, "bob")
+	if !opts.showAudit {
+		t.Fatalf("expected showAudit")
+	}
+	if len(opts.userFilter) != 1 || opts.userFilter[0] != "alice" {
+		t.Fatalf("unexpected user filter: %v", opts.userFilter)
+	}
+	if len(opts.printerFilter) != 1 || opts.printerFilter[0] != "Office" {
+		t.Fatalf("unexpected printer filter: %v", opts.printerFilter)
+	}
+}
+
+func TestParseArgsFormat(t *testing.T) {
+	opts := parseArgs([]string{"--format", "json", "-p"})
+	if opts.format != report.FormatJSON || !opts.showPrinters {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+	if opts = parseArgs([]string{"--format=csv"}); opts.format != report.FormatCSV {
+		t.Fatalf("expected csv, got %v", opts.format)
+	}
+}
+
+func TestPrinterAndJobRecords(t *testing.T) {
+	attrs := goipp.Attributes{
+		goipp.MakeAttr("marker-names", goipp.TagName, goipp.String("Black"), goipp.String("Cyan")),
+		goipp.MakeAttr("marker-types", goipp.TagKeyword, goipp.String("toner"), goipp.String("toner")),
+		goipp.MakeAttr("marker-levels", goipp.TagInteger, goipp.Integer(80), goipp.Integer(-1)),
+		goipp.MakeAttribute("printer-device-id", goipp.TagText, goipp.String("MFG:Acme;MDL:Laser;")),
+	}
+	rec := printerRecord(printerInfo{name: "Office", state: 5, reasons: []string{"media-jam-error"}, stateChange: 1700000000, attrs: attrs})
+	if rec.Get("state") != "stopped" || rec.Get("state_change_time") != "2023-11-14T22:13:20Z" || rec.Get("device_id") != "MFG:Acme;MDL:Laser;" {
+		t.Fatalf("unexpected printer record: %+v", rec)
+	}
+	supplies := rec.Get("supplies").([]report.Record)
+	if len(supplies) != 2 || supplies[0].Get("level") != 80 || supplies[1].Get("level") != nil {
+		t.Fatalf("unexpected supplies: %+v", supplies)
+	}
+	if rec.Get("users_allowed") == nil {
+		t.Fatalf("lists must encode as [] rather than null")
+	}
+
+	jobAttrs := goipp.Attributes{
+		goipp.MakeAttribute("job-state", goipp.TagEnum, goipp.Integer(9)),
+		goipp.MakeAttribute("time-at-creation", goipp.TagInteger, goipp.Integer(1700000000)),
+	}
+	job := jobRecord(jobInfo{id: "12", printerName: "Office", attrs: jobAttrs})
+	if job.Get("id") != 12 || job.Get("state") != "completed" || job.Get("created_at") != "2023-11-14T22:13:20Z" || job.Get("completed_at") != nil {
+		t.Fatalf("unexpected job record: %+v", job)
+	}
+}
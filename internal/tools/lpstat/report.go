@@ -0,0 +1,208 @@
+package lpstat
+
+import (
+	"os"
+	"sort"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/cupsclient"
+	"cupsgolang/internal/model"
+	"cupsgolang/internal/report"
+)
+
+// writeReport emits what the text output would show as one --format
+// document. The printer selections (-p, -a, -v, -P, -S, -e) all list the
+// same printer records.
+func writeReport(client *cupsclient.Client, opts options) error {
+	w := &report.Writer{Format: opts.format}
+	if opts.showHost {
+		w.Add("server", report.Record{{Name: "host", Value: client.Host}, {Name: "port", Value: client.Port}})
+	}
+	if opts.showAudit {
+		entries, err := fetchAudit(client, opts.printerFilter, opts.userFilter)
+		if err != nil {
+			return err
+		}
+		w.Add("audit")
+		for _, e := range entries {
+			w.Add("audit", auditRecord(e))
+		}
+		return w.Flush(os.Stdout)
+	}
+	if opts.showStatus {
+		w.Add("scheduler", report.Record{{Name: "running", Value: true}})
+	}
+	if opts.showDefault {
+		name, err := fetchDefault(client)
+		if err != nil {
+			return err
+		}
+		var value any
+		if name != "" {
+			value = name
+		}
+		w.Add("default", report.Record{{Name: "name", Value: value}})
+	}
+	if opts.showPrinters || opts.showAccepting || opts.showDevices || opts.showAllDests || opts.showPaper || opts.showCharsets {
+		printers, err := fetchPrinters(client)
+		if err != nil {
+			return err
+		}
+		filter := opts.printerFilter
+		if opts.showAllDests {
+			filter = nil
+		}
+		w.Add("printers")
+		for _, p := range printers {
+			if matchesFilter(filter, p.name) {
+				w.Add("printers", printerRecord(p))
+			}
+		}
+	}
+	if opts.showClasses {
+		classes, err := fetchClasses(client, opts.printerFilter)
+		if err != nil {
+			return err
+		}
+		w.Add("classes")
+		for _, c := range classes {
+			w.Add("classes", classRecord(c))
+		}
+	}
+	if opts.showJobs {
+		jobs, err := fetchJobs(client, opts.printerFilter, opts.userFilter, opts.whichJobs)
+		if err != nil {
+			return err
+		}
+		w.Add("jobs")
+		for _, j := range jobs {
+			w.Add("jobs", jobRecord(j))
+		}
+	}
+	return w.Flush(os.Stdout)
+}
+
+func printerRecord(p printerInfo) report.Record {
+	return report.Record{
+		{Name: "name", Value: p.name},
+		{Name: "uri", Value: p.uri},
+		{Name: "device_uri", Value: p.deviceURI},
+		{Name: "type", Value: destinationType(p)},
+		{Name: "remote", Value: p.ptype&0x0002 != 0},
+		{Name: "state", Value: report.PrinterState(p.state)},
+		{Name: "state_reasons", Value: report.Strings(p.reasons)},
+		{Name: "state_message", Value: p.stateMsg},
+		{Name: "state_change_time", Value: report.Time(p.stateChange)},
+		{Name: "accepting", Value: p.accepting},
+		{Name: "info", Value: p.info},
+		{Name: "location", Value: p.location},
+		{Name: "make_and_model", Value: p.makeModel},
+		{Name: "device_id", Value: findAttr(p.attrs, "printer-device-id")},
+		{Name: "users_allowed", Value: report.Strings(p.allowed)},
+		{Name: "users_denied", Value: report.Strings(p.denied)},
+		{Name: "media_supported", Value: report.Strings(p.media)},
+		{Name: "charsets_supported", Value: report.Strings(p.charsets)},
+		{Name: "supplies", Value: supplyRecords(p.attrs)},
+		{Name: "attributes", Value: report.Attributes(p.attrs)},
+	}
+}
+
+// supplyRecords pairs up the marker-* attributes, one record per marker.
+// Levels are percentages, or nil when the printer does not report them.
+func supplyRecords(attrs goipp.Attributes) []report.Record {
+	names := attrStrings(attrs, "marker-names")
+	types := attrStrings(attrs, "marker-types")
+	colors := attrStrings(attrs, "marker-colors")
+	levels := attrStrings(attrs, "marker-levels")
+	lows := attrStrings(attrs, "marker-low-levels")
+	highs := attrStrings(attrs, "marker-high-levels")
+	at := func(list []string, i int) string {
+		if i < len(list) {
+			return list[i]
+		}
+		return ""
+	}
+	level := func(list []string, i int) any {
+		if i >= len(list) {
+			return nil
+		}
+		n := parseInt(list[i])
+		if n < 0 {
+			return nil
+		}
+		return n
+	}
+	out := make([]report.Record, 0, len(names))
+	for i, name := range names {
+		out = append(out, report.Record{
+			{Name: "name", Value: name},
+			{Name: "type", Value: at(types, i)},
+			{Name: "color", Value: at(colors, i)},
+			{Name: "level", Value: level(levels, i)},
+			{Name: "low_level", Value: level(lows, i)},
+			{Name: "high_level", Value: level(highs, i)},
+		})
+	}
+	return out
+}
+
+func classRecord(c classInfo) report.Record {
+	return report.Record{
+		{Name: "name", Value: c.name},
+		{Name: "members", Value: report.Strings(c.members)},
+		{Name: "state", Value: report.PrinterState(parseInt(findAttr(c.attrs, "printer-state")))},
+		{Name: "state_reasons", Value: report.Strings(attrStrings(c.attrs, "printer-state-reasons"))},
+		{Name: "accepting", Value: findAttr(c.attrs, "printer-is-accepting-jobs") == "true"},
+		{Name: "info", Value: findAttr(c.attrs, "printer-info")},
+		{Name: "location", Value: findAttr(c.attrs, "printer-location")},
+		{Name: "attributes", Value: report.Attributes(c.attrs)},
+	}
+}
+
+func jobRecord(j jobInfo) report.Record {
+	return report.Record{
+		{Name: "id", Value: parseInt(j.id)},
+		{Name: "name", Value: findAttr(j.attrs, "job-name")},
+		{Name: "printer", Value: j.printerName},
+		{Name: "user", Value: j.user},
+		{Name: "state", Value: report.JobState(parseInt(findAttr(j.attrs, "job-state")))},
+		{Name: "state_reasons", Value: report.Strings(j.reasons)},
+		{Name: "state_message", Value: j.stateMsg},
+		{Name: "size_kb", Value: j.sizeKB},
+		{Name: "priority", Value: parseInt(findAttr(j.attrs, "job-priority"))},
+		{Name: "copies", Value: parseInt(findAttr(j.attrs, "copies"))},
+		{Name: "documents", Value: parseInt(findAttr(j.attrs, "number-of-documents"))},
+		{Name: "impressions_completed", Value: parseInt(findAttr(j.attrs, "job-impressions-completed"))},
+		{Name: "created_at", Value: report.Time(parseInt64(findAttr(j.attrs, "time-at-creation")))},
+		{Name: "processing_at", Value: report.Time(parseInt64(findAttr(j.attrs, "time-at-processing")))},
+		{Name: "completed_at", Value: report.Time(parseInt64(findAttr(j.attrs, "time-at-completed")))},
+		{Name: "attributes", Value: report.Attributes(j.attrs)},
+	}
+}
+
+func auditRecord(e model.AuditEntry) report.Record {
+	names := make([]string, 0, len(e.Changes))
+	for name := range e.Changes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	changes := make(report.Record, 0, len(names))
+	for _, name := range names {
+		change := e.Changes[name]
+		changes.Add(name, report.Record{{Name: "old", Value: change[0]}, {Name: "new", Value: change[1]}})
+	}
+	var created any
+	if !e.CreatedAt.IsZero() {
+		created = report.Time(e.CreatedAt.Unix())
+	}
+	return report.Record{
+		{Name: "id", Value: e.ID},
+		{Name: "time", Value: created},
+		{Name: "user", Value: e.User},
+		{Name: "remote_addr", Value: e.RemoteAddr},
+		{Name: "operation", Value: e.Operation},
+		{Name: "target", Value: e.Target},
+		{Name: "changes", Value: changes},
+	}
+}
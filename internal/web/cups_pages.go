@@ -2,7 +2,6 @@ package web
 
 import (
 	"context"
-	"database/sql"
 	"encoding/json"
 	"io/fs"
 	"net/http"
@@ -14,9 +13,9 @@ import (
 	"cupsgolang/internal/store"
 )
 
-func RenderPrinters(w http.ResponseWriter, r *http.Request, st *store.Store) {
+func RenderPrinters(w http.ResponseWriter, r *http.Request, st store.Repository) {
 	var printers []model.Printer
-	_ = st.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	_ = st.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printers, err = st.ListPrinters(context.Background(), tx)
 		return err
@@ -42,7 +41,7 @@ func RenderPrinters(w http.ResponseWriter, r *http.Request, st *store.Store) {
 	renderCupsPage(w, r, ctx, "header.tmpl.in", "printers-header.tmpl", "printers.tmpl", "trailer.tmpl")
 }
 
-func RenderPrinter(w http.ResponseWriter, r *http.Request, st *store.Store) {
+func RenderPrinter(w http.ResponseWriter, r *http.Request, st store.Repository) {
 	name := strings.TrimPrefix(r.URL.Path, "/printers/")
 	name = path.Base(name)
 	if name == "" || name == "/" {
@@ -51,7 +50,7 @@ func RenderPrinter(w http.ResponseWriter, r *http.Request, st *store.Store) {
 	}
 
 	var printer model.Printer
-	err := st.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := st.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printer, err = st.GetPrinterByName(r.Context(), tx, name)
 		return err
@@ -91,10 +90,10 @@ func RenderPrinter(w http.ResponseWriter, r *http.Request, st *store.Store) {
 	renderCupsPage(w, r, ctx, "header.tmpl.in", "printer.tmpl", "trailer.tmpl")
 }
 
-func RenderJobs(w http.ResponseWriter, r *http.Request, st *store.Store) {
+func RenderJobs(w http.ResponseWriter, r *http.Request, st store.Repository) {
 	var jobs []model.Job
 	var printers []model.Printer
-	_ = st.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	_ = st.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		printers, err = st.ListPrinters(r.Context(), tx)
 		if err != nil || len(printers) == 0 {
@@ -122,12 +121,12 @@ func RenderJobs(w http.ResponseWriter, r *http.Request, st *store.Store) {
 	renderCupsPage(w, r, ctx, "header.tmpl.in", "jobs-header.tmpl", "jobs.tmpl", "trailer.tmpl")
 }
 
-func RenderJob(w http.ResponseWriter, r *http.Request, st *store.Store) {
+func RenderJob(w http.ResponseWriter, r *http.Request, st store.Repository) {
 	// CUPS uses job list; fall back to /jobs/ for now.
 	http.Redirect(w, r, "/jobs/", http.StatusFound)
 }
 
-func RenderAdmin(w http.ResponseWriter, r *http.Request, st *store.Store, msgTemplate string, msgVars map[string]string, arrayVars map[string][]string) {
+func RenderAdmin(w http.ResponseWriter, r *http.Request, st store.Repository, msgTemplate string, msgVars map[string]string, arrayVars map[string][]string) {
 	settings := loadServerSettings(r.Context(), st)
 	shareServer := settingBool(settings, "_share_printers", "1")
 	remoteAdmin := settingBool(settings, "_remote_admin", "0")
@@ -186,9 +185,9 @@ func RenderAdmin(w http.ResponseWriter, r *http.Request, st *store.Store, msgTem
 	renderCupsPage(w, r, ctx, "header.tmpl.in", "admin.tmpl", "trailer.tmpl")
 }
 
-func RenderClasses(w http.ResponseWriter, r *http.Request, st *store.Store) {
+func RenderClasses(w http.ResponseWriter, r *http.Request, st store.Repository) {
 	var classes []model.Class
-	_ = st.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	_ = st.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		classes, err = st.ListClasses(r.Context(), tx)
 		return err
@@ -233,7 +232,7 @@ func RenderHelp(w http.ResponseWriter, r *http.Request) {
 	renderCupsPage(w, r, ctx, "header.tmpl.in", "help-header.tmpl", "help-trailer.tmpl")
 }
 
-func RenderClass(w http.ResponseWriter, r *http.Request, st *store.Store) {
+func RenderClass(w http.ResponseWriter, r *http.Request, st store.Repository) {
 	name := strings.TrimPrefix(r.URL.Path, "/classes/")
 	name = path.Base(name)
 	if name == "" || name == "/" {
@@ -243,7 +242,7 @@ func RenderClass(w http.ResponseWriter, r *http.Request, st *store.Store) {
 
 	var class model.Class
 	var members []model.Printer
-	err := st.WithTx(r.Context(), true, func(tx *sql.Tx) error {
+	err := st.WithTx(r.Context(), true, func(tx store.Tx) error {
 		var err error
 		class, err = st.GetClassByName(r.Context(), tx, name)
 		if err != nil {
@@ -452,12 +451,12 @@ func firstNonEmptyString(values ...string) string {
 	return ""
 }
 
-func serverSharingEnabled(ctx context.Context, st *store.Store) bool {
+func serverSharingEnabled(ctx context.Context, st store.Repository) bool {
 	if st == nil {
 		return true
 	}
 	enabled := true
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		val, err := st.GetSetting(ctx, tx, "_share_printers", "1")
 		if err != nil {
 			return err
@@ -469,12 +468,12 @@ func serverSharingEnabled(ctx context.Context, st *store.Store) bool {
 	return enabled
 }
 
-func loadServerSettings(ctx context.Context, st *store.Store) map[string]string {
+func loadServerSettings(ctx context.Context, st store.Repository) map[string]string {
 	if st == nil {
 		return map[string]string{}
 	}
 	settings := map[string]string{}
-	_ = st.WithTx(ctx, true, func(tx *sql.Tx) error {
+	_ = st.WithTx(ctx, true, func(tx store.Tx) error {
 		var err error
 		settings, err = st.ListSettings(ctx, tx)
 		return err
@@ -510,3 +509,34 @@ func isDisabledSetting(value string) bool {
 		return false
 	}
 }
+
+// RenderAudit lists audit-log entries newest first.
+func RenderAudit(w http.ResponseWriter, r *http.Request, entries []model.AuditEntry) {
+	ctx := NewTemplateContext()
+	ctx.SetVar("title", "Audit Log")
+	ctx.SetVar("SECTION", "admin")
+	ids := make([]string, 0, len(entries))
+	times := make([]string, 0, len(entries))
+	users := make([]string, 0, len(entries))
+	addrs := make([]string, 0, len(entries))
+	ops := make([]string, 0, len(entries))
+	targets := make([]string, 0, len(entries))
+	changes := make([]string, 0, len(entries))
+	for _, e := range entries {
+		ids = append(ids, strconv.FormatInt(e.ID, 10))
+		times = append(times, e.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		users = append(users, e.User)
+		addrs = append(addrs, e.RemoteAddr)
+		ops = append(ops, e.Operation)
+		targets = append(targets, e.Target)
+		changes = append(changes, e.ChangeSummary())
+	}
+	ctx.SetArray("audit_id", ids)
+	ctx.SetArray("audit_time", times)
+	ctx.SetArray("audit_user", users)
+	ctx.SetArray("audit_address", addrs)
+	ctx.SetArray("audit_operation", ops)
+	ctx.SetArray("audit_target", targets)
+	ctx.SetArray("audit_changes", changes)
+	renderCupsPage(w, r, ctx, "header.tmpl.in", "audit.tmpl", "trailer.tmpl")
+}
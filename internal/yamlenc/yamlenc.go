@@ -0,0 +1,119 @@
+// Package yamlenc writes block-style YAML for the small, regular documents
+// the tools emit, without a YAML dependency.
+package yamlenc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Map is a mapping that keeps its key order.
+type Map []Field
+
+// Field is one key of a Map.
+type Field struct {
+	Key   string
+	Value any
+}
+
+// Write encodes v as block-style YAML. Values are Map, []any, or scalars:
+// nil, bool, integers, floats, json.Number and strings (anything else is
+// written as its fmt.Sprint text).
+func Write(w io.Writer, v any) error {
+	var b bytes.Buffer
+	if s, ok := inline(v); ok {
+		b.WriteString(s + "\n")
+	} else {
+		writeBlock(&b, v, 0)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// inline returns the text of a value that fits on the line of its key or
+// dash: scalars and empty collections.
+func inline(v any) (string, bool) {
+	switch t := v.(type) {
+	case Map:
+		if len(t) == 0 {
+			return "{}", true
+		}
+		return "", false
+	case []any:
+		if len(t) == 0 {
+			return "[]", true
+		}
+		return "", false
+	}
+	return Scalar(v), true
+}
+
+// writeBlock writes a mapping or sequence as a block at indent.
+func writeBlock(b *bytes.Buffer, v any, indent int) {
+	pad := strings.Repeat(" ", indent)
+	if m, ok := v.(Map); ok {
+		for _, f := range m {
+			if s, ok := inline(f.Value); ok {
+				fmt.Fprintf(b, "%s%s: %s\n", pad, Scalar(f.Key), s)
+				continue
+			}
+			fmt.Fprintf(b, "%s%s:\n", pad, Scalar(f.Key))
+			writeBlock(b, f.Value, indent+2)
+		}
+		return
+	}
+	items, _ := v.([]any)
+	for _, item := range items {
+		if s, ok := inline(item); ok {
+			fmt.Fprintf(b, "%s- %s\n", pad, s)
+			continue
+		}
+		// The first line of a nested block goes after the dash.
+		var nested bytes.Buffer
+		writeBlock(&nested, item, indent+2)
+		b.WriteString(pad + "- " + strings.TrimPrefix(nested.String(), pad+"  "))
+	}
+}
+
+var number = regexp.MustCompile(`^[-+]?(\.[0-9]+|[0-9]+(\.[0-9]*)?)([eE][-+]?[0-9]+)?$`)
+
+// IsNumber reports whether a plain scalar reads as a number.
+func IsNumber(s string) bool {
+	return number.MatchString(s)
+}
+
+// Scalar renders a scalar, quoting strings that would otherwise read as
+// another type or as YAML syntax.
+func Scalar(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return strconv.FormatBool(t)
+	case int, int32, int64, uint, uint32, uint64, float32, float64:
+		return fmt.Sprint(t)
+	case json.Number:
+		return t.String()
+	}
+	s := fmt.Sprint(v)
+	if s == "" || s != strings.TrimSpace(s) || IsNumber(s) || isKeyword(s) ||
+		strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") ||
+		strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") ||
+		strings.ContainsAny(s, "\n\r\t") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func isKeyword(s string) bool {
+	switch strings.ToLower(s) {
+	case "null", "~", "true", "false", "yes", "no", "on", "off", ".inf", "-.inf", ".nan":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,55 @@
+package yamlenc
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteBlock(t *testing.T) {
+	doc := Map{
+		{Key: "version", Value: 1},
+		{Key: "printers", Value: []any{
+			Map{{Key: "name", Value: "Office"}, {Key: "shared", Value: true}, {Key: "members", Value: []any{}}},
+			Map{{Key: "name", Value: "yes"}, {Key: "size", Value: json.Number("2.5")}},
+		}},
+		{Key: "empty", Value: Map{}},
+		{Key: "notes", Value: []any{"a: b", nil, "#tag"}},
+	}
+	var b bytes.Buffer
+	if err := Write(&b, doc); err != nil {
+		t.Fatal(err)
+	}
+	want := `version: 1
+printers:
+  - name: Office
+    shared: true
+    members: []
+  - name: "yes"
+    size: 2.5
+empty: {}
+notes:
+  - "a: b"
+  - null
+  - "#tag"
+`
+	if b.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestScalarQuotesAmbiguousStrings(t *testing.T) {
+	for in, want := range map[string]string{
+		"plain":    "plain",
+		"":         `""`,
+		"42":       `"42"`,
+		"off":      `"off"`,
+		" padded":  `" padded"`,
+		"-dash":    `"-dash"`,
+		"two\nrow": `"two\nrow"`,
+	} {
+		if got := Scalar(in); got != want {
+			t.Errorf("Scalar(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"crypto/tls"
-	"log"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
@@ -22,62 +24,79 @@ import (
 	"cupsgolang/internal/tlsutil"
 )
 
+// readHeaderTimeout bounds how long a client may take to send its request
+// headers, whatever Timeout is.
+const readHeaderTimeout = 30 * time.Second
+
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			os.Exit(runMigrate(os.Args[2:]))
+		case "backup":
+			os.Exit(runBackup(os.Args[2:]))
+		case "restore":
+			os.Exit(runRestore(os.Args[2:]))
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		}
+	}
+	checkMigrations := flag.Bool("check-migrations", false, "list pending database schema migrations and exit without applying them")
+	testConfig := flag.Bool("t", false, "check the configuration files for errors and exit")
+	cupsdConf := flag.String("c", "", "cupsd.conf to check with -t; the other configuration files are read from its directory")
+	flag.Parse()
+
 	cfg := config.Load()
+	if *checkMigrations {
+		os.Exit(runCheckMigrations(cfg))
+	}
+	if *testConfig {
+		os.Exit(runConfigTest(cfg, *cupsdConf))
+	}
 	server.SetAppConfig(cfg)
-	logging.Configure(
-		cfg.ErrorLogPath,
-		cfg.AccessLogPath,
-		cfg.PageLogPath,
-		cfg.MaxLogSize,
-		cfg.AccessLogLevel,
-		cfg.PageLogFormat,
-	)
-
-	log.SetOutput(logging.ErrorWriter())
+	logger := configureLogging(cfg)
 
 	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
-		log.Fatalf("failed to create data dir: %v", err)
+		fatalf("failed to create data dir: %v", err)
 	}
 	if err := os.MkdirAll(filepath.Dir(cfg.DBPath), 0755); err != nil {
-		log.Fatalf("failed to create db dir: %v", err)
+		fatalf("failed to create db dir: %v", err)
 	}
 	if err := os.MkdirAll(cfg.ConfDir, 0755); err != nil {
-		log.Fatalf("failed to create conf dir: %v", err)
+		fatalf("failed to create conf dir: %v", err)
 	}
 	if err := os.MkdirAll(cfg.PPDDir, 0755); err != nil {
-		log.Fatalf("failed to create ppd dir: %v", err)
+		fatalf("failed to create ppd dir: %v", err)
 	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	st, err := store.Open(ctx, cfg.DBPath)
+	st, err := openStore(ctx, cfg)
 	if err != nil {
-		log.Fatalf("failed to open store: %v", err)
+		fatalf("failed to open store: %v", err)
 	}
 	defer st.Close()
 	server.SetAppStore(st)
-	st.MaxEvents = cfg.MaxEvents
 
 	if err := st.EnsureDefaultPrinter(ctx); err != nil {
-		log.Fatalf("failed to ensure default printer: %v", err)
+		fatalf("failed to ensure default printer: %v", err)
 	}
 	if err := st.EnsureAdminUser(ctx); err != nil {
-		log.Fatalf("failed to ensure admin user: %v", err)
+		fatalf("failed to ensure admin user: %v", err)
 	}
 	if err := config.SyncFromConf(ctx, cfg.ConfDir, st); err != nil {
-		log.Printf("warning: failed to sync from conf: %v", err)
+		logger.Warn("failed to sync from conf", "err", err)
 	}
 	config.SyncLoop(ctx, cfg.ConfDir, st)
 	mimeDB, err := config.LoadMimeDB(cfg.ConfDir)
 	if err != nil {
-		log.Printf("warning: failed to load mime db: %v", err)
+		logger.Warn("failed to load mime db", "err", err)
 	}
 
 	sp := spool.Spool{Dir: cfg.SpoolDir, OutputDir: cfg.OutputDir}
 	if err := sp.Ensure(); err != nil {
-		log.Fatalf("failed to ensure spool dir: %v", err)
+		fatalf("failed to ensure spool dir: %v", err)
 	}
 
 	sched := &scheduler.Scheduler{Store: st, Spool: sp, Interval: 2 * time.Second, Mime: mimeDB, Config: cfg}
@@ -86,21 +105,30 @@ func main() {
 
 	policy := config.LoadPolicy(cfg.ConfDir)
 	srv := &server.Server{Config: cfg, Store: st, Spool: sp, Policy: policy}
+	reload := &reloader{cfg: cfg, mime: mimeDB, srv: srv, sched: sched}
+	srv.Reloader = reload.Reload
 	if dnssdAdv, err := server.StartDNSSDAdvertiser(ctx, srv); err != nil {
-		log.Printf("warning: failed to start DNS-SD advertiser: %v", err)
+		logger.Warn("failed to start DNS-SD advertiser", "err", err)
 	} else if dnssdAdv != nil {
 		defer dnssdAdv.Close()
 	}
 
-	handler := logging.HTTPAccessMiddleware(srv.Handler())
+	conns := server.NewConnLimiter(cfg.MaxClients, cfg.MaxClientsPerHost)
+	reload.conns = conns
+	handler := logging.HTTPAccessMiddleware(conns.Handler(srv.Handler()))
 	newServer := func(addr string) *http.Server {
-		return &http.Server{
-			Addr:         addr,
-			Handler:      handler,
-			ReadTimeout:  30 * time.Second,
-			WriteTimeout: 30 * time.Second,
-			IdleTimeout:  60 * time.Second,
+		// Only the headers have a fixed deadline, kept short so a silent
+		// client cannot hold a connection slot; the server's handler gives
+		// bodies and responses inactivity deadlines of Timeout.
+		hs := &http.Server{
+			Addr:              addr,
+			Handler:           handler,
+			ReadHeaderTimeout: readHeaderTimeout,
+			IdleTimeout:       time.Duration(cfg.KeepAliveTimeout) * time.Second,
+			ConnContext:       conns.ConnContext,
 		}
+		hs.SetKeepAlivesEnabled(cfg.KeepAlive)
+		return hs
 	}
 
 	var servers []*http.Server
@@ -138,11 +166,24 @@ func main() {
 		certHosts := uniqueHosts(hosts)
 		cert, err := tlsutil.EnsureCertificate(cfg.TLSCertPath, cfg.TLSKeyPath, certHosts, cfg.TLSAutoGenerate)
 		if err != nil {
-			log.Fatalf("failed to load TLS certificate: %v", err)
+			fatalf("failed to load TLS certificate: %v", err)
 		}
+		minVersion, maxVersion := tlsVersions(cfg.SSLOptions)
 		tlsConfig = &tls.Config{
 			Certificates: []tls.Certificate{cert},
-			MinVersion:   tls.VersionTLS12,
+			MinVersion:   minVersion,
+			MaxVersion:   maxVersion,
+		}
+		if strings.TrimSpace(cfg.ACMEDirectory) != "" {
+			acmeMgr, err := newACMEManager(cfg, logger)
+			if err != nil {
+				fatalf("failed to configure ACME: %v", err)
+			}
+			// Until the CA issues a certificate the self-signed one above is
+			// served, so HTTPS comes up immediately.
+			tlsConfig.GetCertificate = acmeMgr.GetCertificate
+			handler = logging.HTTPAccessMiddleware(conns.Handler(acmeMgr.HTTPHandler(srv.Handler())))
+			go acmeMgr.Run(ctx)
 		}
 	}
 
@@ -151,9 +192,9 @@ func main() {
 		servers = append(servers, srv)
 		listeners = append(listeners, ln)
 		go func() {
-			log.Printf("CUPS-Golang %s listening on %s", label, addr)
+			logger.Info("CUPS-Golang listening", "proto", label, "addr", addr)
 			if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
-				log.Fatalf("listen error: %v", err)
+				fatalf("listen error: %v", err)
 			}
 		}()
 	}
@@ -163,8 +204,9 @@ func main() {
 		for _, addr := range listenHTTP {
 			baseLn, err := net.Listen("tcp", addr)
 			if err != nil {
-				log.Fatalf("listen error on %s: %v", addr, err)
+				fatalf("listen error on %s: %v", addr, err)
 			}
+			baseLn = conns.Listener(baseLn)
 			plainLn, tlsLn := tlsutil.SplitListener(baseLn, tlsConfig, true)
 			startServe(addr, plainLn, "HTTP")
 			startServe(addr, tlsLn, "HTTPS")
@@ -174,28 +216,36 @@ func main() {
 		for _, addr := range listenHTTP {
 			ln, err := net.Listen("tcp", addr)
 			if err != nil {
-				log.Fatalf("listen error on %s: %v", addr, err)
+				fatalf("listen error on %s: %v", addr, err)
 			}
-			startServe(addr, ln, "HTTP")
+			startServe(addr, conns.Listener(ln), "HTTP")
 		}
 		if cfg.TLSEnabled {
 			for _, addr := range listenHTTPS {
 				ln, err := net.Listen("tcp", addr)
 				if err != nil {
-					log.Fatalf("listen error on %s: %v", addr, err)
+					fatalf("listen error on %s: %v", addr, err)
 				}
-				startServe(addr, tls.NewListener(ln, tlsConfig), "HTTPS")
+				startServe(addr, tls.NewListener(conns.Listener(ln), tlsConfig), "HTTPS")
 			}
 		} else if len(listenHTTPS) > 0 {
-			log.Printf("TLS disabled; skipping HTTPS listeners: %v", listenHTTPS)
+			logger.Warn("TLS disabled; skipping HTTPS listeners", "listeners", strings.Join(listenHTTPS, ","))
 		}
 	}
 
 	sigs := make(chan os.Signal, 1)
-	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
-	<-sigs
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigs {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if err := reload.Reload(); err != nil {
+			logger.Warn("failed to reload configuration", "err", err)
+		}
+	}
 
-	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// ReloadTimeout bounds how long requests in progress may take to finish.
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), time.Duration(cfg.ReloadTimeout)*time.Second)
 	defer shutdownCancel()
 	for _, srv := range servers {
 		_ = srv.Shutdown(shutdownCtx)
@@ -205,6 +255,88 @@ func main() {
 	}
 }
 
+// tlsVersions applies the SSLOptions MinTLS and MaxTLS settings to the
+// default of TLS 1.2 and later. DenyTLS1.0 is implied by that default; the
+// cipher options have no equivalent in crypto/tls.
+func tlsVersions(options []string) (uint16, uint16) {
+	versions := map[string]uint16{"1.0": tls.VersionTLS10, "1.1": tls.VersionTLS11, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13}
+	minVersion, maxVersion := uint16(tls.VersionTLS12), uint16(0)
+	for _, opt := range options {
+		lower := strings.ToLower(opt)
+		if v, ok := versions[strings.TrimPrefix(lower, "mintls")]; ok && strings.HasPrefix(lower, "mintls") {
+			minVersion = v
+		}
+		if v, ok := versions[strings.TrimPrefix(lower, "maxtls")]; ok && strings.HasPrefix(lower, "maxtls") {
+			maxVersion = v
+		}
+	}
+	if maxVersion != 0 && maxVersion < minVersion {
+		minVersion = maxVersion
+	}
+	return minVersion, maxVersion
+}
+
+func newACMEManager(cfg config.Config, logger *slog.Logger) (*tlsutil.ACMEManager, error) {
+	httpClient, err := tlsutil.ACMEHTTPClient(cfg.ACMECARoots)
+	if err != nil {
+		return nil, err
+	}
+	stateDir := cfg.StateDir
+	if strings.TrimSpace(stateDir) == "" {
+		stateDir = cfg.DataDir
+	}
+	return tlsutil.NewACMEManager(tlsutil.ACMEConfig{
+		DirectoryURL: cfg.ACMEDirectory,
+		Email:        cfg.ACMEEmail,
+		Domains:      append([]string{cfg.ServerName}, cfg.ServerAlias...),
+		StateDir:     stateDir,
+		Challenge:    cfg.ACMEChallenge,
+		DNSHook:      cfg.ACMEDNSHook,
+		RenewBefore:  time.Duration(cfg.ACMERenewDays) * 24 * time.Hour,
+		HTTPClient:   httpClient,
+		Logger:       logger,
+	})
+}
+
+// runCheckMigrations reports the schema migrations the next start would
+// apply to the configured database.
+func runCheckMigrations(cfg config.Config) int {
+	pending, err := store.PendingMigrations(context.Background(), cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang: %s: %v\n", cfg.DBPath, err)
+		return 1
+	}
+	if len(pending) == 0 {
+		fmt.Printf("%s: schema is up to date\n", cfg.DBPath)
+		return 0
+	}
+	fmt.Printf("%s: %d pending migration(s)\n", cfg.DBPath, len(pending))
+	for _, step := range pending {
+		fmt.Printf("  %d  %s\n", step.Version, step.Name)
+	}
+	return 0
+}
+
+// runConfigTest implements -t: it parses cupsd.conf, cups-files.conf, the
+// MIME database, printers.conf, classes.conf and the PPDs, prints what it
+// found and fails if any of it is an error.
+func runConfigTest(cfg config.Config, cupsdPath string) int {
+	if cupsdPath == "" {
+		cupsdPath = filepath.Join(cfg.ConfDir, "cupsd.conf")
+	}
+	report := config.Validate(cfg, cupsdPath)
+	report.WriteText(os.Stdout, cupsdPath)
+	if report.HasErrors() {
+		return 1
+	}
+	return 0
+}
+
+func fatalf(format string, args ...any) {
+	logging.Logger().Log(context.Background(), logging.LevelCrit, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
 func uniqueAddrs(addrs []string) []string {
 	seen := map[string]bool{}
 	out := make([]string, 0, len(addrs))
@@ -256,3 +388,20 @@ func stripPort(host string) string {
 	}
 	return host
 }
+
+// openStore opens the SQLite database at cfg.DBPath. A DBPath of ":memory:"
+// selects the in-memory store instead, for ephemeral deployments that
+// rebuild their configuration on every start.
+func openStore(ctx context.Context, cfg config.Config) (store.Repository, error) {
+	if cfg.DBPath == ":memory:" {
+		st := store.NewMemory()
+		st.MaxEvents = cfg.MaxEvents
+		return st, nil
+	}
+	st, err := store.Open(ctx, cfg.DBPath)
+	if err != nil {
+		return nil, err
+	}
+	st.MaxEvents = cfg.MaxEvents
+	return st, nil
+}
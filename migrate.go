@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/migrate"
+	"cupsgolang/internal/spool"
+	"cupsgolang/internal/store"
+)
+
+// runMigrate implements "cupsgolang migrate": import printers, classes,
+// PPDs, subscriptions and queued jobs from an existing CUPS installation
+// into the database and spool configured for this server.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	from := fs.String("from", "/etc/cups", "CUPS configuration directory (ServerRoot)")
+	spoolDir := fs.String("spool", "/var/spool/cups", "CUPS spool directory (RequestRoot)")
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without changing anything")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cupsgolang migrate [--from /etc/cups] [--spool /var/spool/cups] [--dry-run]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg := config.Load()
+	ctx := context.Background()
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang migrate: %v\n", err)
+		return 1
+	}
+	st, err := store.Open(ctx, cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang migrate: failed to open store: %v\n", err)
+		return 1
+	}
+	defer st.Close()
+
+	report, err := migrate.Run(ctx, st, migrate.Options{
+		From:     *from,
+		SpoolDir: *spoolDir,
+		PPDDir:   cfg.PPDDir,
+		Spool:    spool.Spool{Dir: cfg.SpoolDir, OutputDir: cfg.OutputDir},
+		DryRun:   *dryRun,
+	})
+	report.WriteText(os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang migrate: %v\n", err)
+		return 1
+	}
+	if !*dryRun {
+		// Regenerate printers.conf/classes.conf so the next start does not
+		// re-import the old, smaller view of the queues.
+		if err := config.SyncToConf(ctx, cfg.ConfDir, st); err != nil {
+			fmt.Fprintf(os.Stderr, "cupsgolang migrate: failed to write %s: %v\n", cfg.ConfDir, err)
+			return 1
+		}
+	}
+	return 0
+}
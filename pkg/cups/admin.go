@@ -0,0 +1,175 @@
+package cups
+
+import (
+	"context"
+	"io"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// PrinterConfig is what AddPrinter sets. Empty fields leave an existing
+// printer's value alone.
+type PrinterConfig struct {
+	DeviceURI string
+	// Model is a ppd-name from Models, or "everywhere".
+	Model    string
+	Info     string
+	Location string
+	Shared   *bool
+	// PPD, when set, is uploaded as the printer's PPD instead of Model.
+	PPD io.Reader
+	// Attributes are extra printer attributes, for example
+	// "media-default" or "printer-error-policy".
+	Attributes goipp.Attributes
+}
+
+// AddPrinter creates a printer or changes an existing one.
+func (c *Client) AddPrinter(ctx context.Context, name string, cfg PrinterConfig) error {
+	req := c.printerRequest(goipp.OpCupsAddModifyPrinter, name)
+	req.Operation.Add(goipp.MakeAttribute("printer-name", goipp.TagName, goipp.String(name)))
+	if cfg.DeviceURI != "" {
+		req.Printer.Add(goipp.MakeAttribute("device-uri", goipp.TagURI, goipp.String(cfg.DeviceURI)))
+	}
+	if cfg.Model != "" && cfg.PPD == nil {
+		req.Printer.Add(goipp.MakeAttribute("ppd-name", goipp.TagName, goipp.String(cfg.Model)))
+	}
+	if cfg.Info != "" {
+		req.Printer.Add(goipp.MakeAttribute("printer-info", goipp.TagText, goipp.String(cfg.Info)))
+	}
+	if cfg.Location != "" {
+		req.Printer.Add(goipp.MakeAttribute("printer-location", goipp.TagText, goipp.String(cfg.Location)))
+	}
+	if cfg.Shared != nil {
+		req.Printer.Add(goipp.MakeAttribute("printer-is-shared", goipp.TagBoolean, goipp.Boolean(*cfg.Shared)))
+	}
+	req.Printer = append(req.Printer, cfg.Attributes...)
+	_, err := c.Do(ctx, req, cfg.PPD)
+	return err
+}
+
+// DeletePrinter removes a printer and its jobs.
+func (c *Client) DeletePrinter(ctx context.Context, name string) error {
+	_, err := c.Do(ctx, c.printerRequest(goipp.OpCupsDeletePrinter, name), nil)
+	return err
+}
+
+// AddClass creates a class or replaces the members of an existing one.
+func (c *Client) AddClass(ctx context.Context, name string, members []string) error {
+	req := c.printerRequest(goipp.OpCupsAddModifyClass, name)
+	if len(members) > 0 {
+		vals := make([]goipp.Value, 0, len(members))
+		for _, m := range members {
+			vals = append(vals, goipp.String(c.PrinterURI(m)))
+		}
+		req.Printer.Add(goipp.MakeAttr("member-uris", goipp.TagURI, vals[0], vals[1:]...))
+	}
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
+
+// DeleteClass removes a class.
+func (c *Client) DeleteClass(ctx context.Context, name string) error {
+	_, err := c.Do(ctx, c.printerRequest(goipp.OpCupsDeleteClass, name), nil)
+	return err
+}
+
+// PausePrinter stops a destination from printing; reason becomes its
+// printer-state-message.
+func (c *Client) PausePrinter(ctx context.Context, name, reason string) error {
+	return c.printerControl(ctx, goipp.OpPausePrinter, name, reason)
+}
+
+// ResumePrinter lets a paused destination print again.
+func (c *Client) ResumePrinter(ctx context.Context, name string) error {
+	return c.printerControl(ctx, goipp.OpResumePrinter, name, "")
+}
+
+// AcceptJobs lets a destination queue new jobs.
+func (c *Client) AcceptJobs(ctx context.Context, name string) error {
+	return c.printerControl(ctx, goipp.OpCupsAcceptJobs, name, "")
+}
+
+// RejectJobs refuses new jobs with reason as the printer-state-message.
+func (c *Client) RejectJobs(ctx context.Context, name, reason string) error {
+	return c.printerControl(ctx, goipp.OpCupsRejectJobs, name, reason)
+}
+
+// SetDefault makes a destination the scheduler's default.
+func (c *Client) SetDefault(ctx context.Context, name string) error {
+	return c.printerControl(ctx, goipp.OpCupsSetDefault, name, "")
+}
+
+func (c *Client) printerControl(ctx context.Context, op goipp.Op, name, reason string) error {
+	req := c.printerRequest(op, name)
+	if reason != "" {
+		req.Operation.Add(goipp.MakeAttribute("printer-state-message", goipp.TagText, goipp.String(reason)))
+	}
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
+
+// Device is a device found by the backends.
+type Device struct {
+	URI          string
+	Class        string
+	Info         string
+	MakeAndModel string
+	DeviceID     string
+	Location     string
+}
+
+// Devices asks the backends for devices, which can take as long as the
+// slowest network backend.
+func (c *Client) Devices(ctx context.Context) ([]Device, error) {
+	resp, err := c.Do(ctx, c.NewRequest(goipp.OpCupsGetDevices), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []Device
+	for _, group := range resp.Groups {
+		if group.Tag != goipp.TagPrinterGroup || len(group.Attrs) == 0 {
+			continue
+		}
+		out = append(out, Device{
+			URI:          attrString(group.Attrs, "device-uri"),
+			Class:        attrString(group.Attrs, "device-class"),
+			Info:         attrString(group.Attrs, "device-info"),
+			MakeAndModel: attrString(group.Attrs, "device-make-and-model"),
+			DeviceID:     attrString(group.Attrs, "device-id"),
+			Location:     attrString(group.Attrs, "device-location"),
+		})
+	}
+	return out, nil
+}
+
+// Model is an installed driver.
+type Model struct {
+	// Name is the ppd-name to pass as PrinterConfig.Model.
+	Name         string
+	Make         string
+	MakeAndModel string
+	DeviceID     string
+	Language     string
+}
+
+// Models lists the installed drivers.
+func (c *Client) Models(ctx context.Context) ([]Model, error) {
+	resp, err := c.Do(ctx, c.NewRequest(goipp.OpCupsGetPpds), nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []Model
+	for _, group := range resp.Groups {
+		if group.Tag != goipp.TagPrinterGroup || len(group.Attrs) == 0 {
+			continue
+		}
+		out = append(out, Model{
+			Name:         attrString(group.Attrs, "ppd-name"),
+			Make:         attrString(group.Attrs, "ppd-make"),
+			MakeAndModel: attrString(group.Attrs, "ppd-make-and-model"),
+			DeviceID:     attrString(group.Attrs, "ppd-device-id"),
+			Language:     attrString(group.Attrs, "ppd-natural-language"),
+		})
+	}
+	return out, nil
+}
@@ -0,0 +1,291 @@
+// Package cups is a typed client for the scheduler. It covers what the
+// command-line tools do by hand with raw IPP messages: destinations with
+// lpoptions defaults merged in, job submission with streamed documents, job
+// control, subscriptions with long-polled notifications, and printer and
+// class administration.
+//
+// A client reads the same settings as the tools (client.conf, CUPS_SERVER,
+// CUPS_USER and friends) and options override them:
+//
+//	c := cups.New(cups.WithServer("print.example.com:631"))
+//	job, err := c.Print(ctx, "Office", cups.JobRequest{
+//		Name:    "report",
+//		Options: cups.ParseOptions("sides=two-sided-long-edge copies=2"),
+//	}, cups.Document{Name: "report.pdf", Format: "application/pdf", Reader: f})
+//
+// Failed requests return *Error, which matches the Err* sentinels with
+// errors.Is:
+//
+//	if errors.Is(err, cups.ErrNotFound) { ... }
+//
+// Operations without a typed method can be sent with NewRequest and Do.
+package cups
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/cupsclient"
+)
+
+// DefaultTimeout bounds each request unless WithTimeout says otherwise.
+// Notification long-polls add their wait on top of it.
+const DefaultTimeout = 60 * time.Second
+
+// Client talks to one scheduler. It is safe for concurrent use.
+type Client struct {
+	conn      *cupsclient.Client
+	user      string
+	timeout   time.Duration
+	lpOptions []string
+	requestID atomic.Uint32
+}
+
+// Option configures a Client.
+type Option func(*settings)
+
+type settings struct {
+	client    []cupsclient.ClientOption
+	insecure  bool
+	timeout   time.Duration
+	lpOptions []string
+	noLocal   bool
+}
+
+// WithServer sets the scheduler as host, host:port or a URL; an ipps or
+// https URL turns on TLS.
+func WithServer(server string) Option {
+	return func(s *settings) { s.client = append(s.client, cupsclient.WithServer(server)) }
+}
+
+// WithTLS turns on TLS.
+func WithTLS(enable bool) Option {
+	return func(s *settings) { s.client = append(s.client, cupsclient.WithTLS(enable)) }
+}
+
+// WithInsecureSkipVerify accepts any server certificate.
+func WithInsecureSkipVerify() Option {
+	return func(s *settings) { s.insecure = true }
+}
+
+// WithUser sets requesting-user-name and the Basic auth user.
+func WithUser(user string) Option {
+	return func(s *settings) { s.client = append(s.client, cupsclient.WithUser(user)) }
+}
+
+// WithPassword sets the Basic auth password.
+func WithPassword(password string) Option {
+	return func(s *settings) { s.client = append(s.client, cupsclient.WithPassword(password)) }
+}
+
+// WithTimeout sets the per-request timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(s *settings) { s.timeout = d }
+}
+
+// WithLpOptions replaces the lpoptions files merged into destinations.
+// Later files override earlier ones; no paths disables merging.
+func WithLpOptions(paths ...string) Option {
+	return func(s *settings) {
+		s.lpOptions = append([]string(nil), paths...)
+		s.noLocal = len(paths) == 0
+	}
+}
+
+// New returns a client for the configured scheduler.
+func New(opts ...Option) *Client {
+	var s settings
+	for _, opt := range opts {
+		if opt != nil {
+			opt(&s)
+		}
+	}
+	conn := cupsclient.NewFromConfig(s.client...)
+	if s.insecure {
+		conn.InsecureSkipVerify = true
+	}
+	c := &Client{conn: conn, user: requestingUser(conn), timeout: s.timeout, lpOptions: s.lpOptions}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+	if c.lpOptions == nil && !s.noLocal {
+		c.lpOptions = DefaultLpOptionsPaths()
+	}
+	return c
+}
+
+// Server returns the scheduler address as host:port.
+func (c *Client) Server() string {
+	return c.conn.Host + ":" + strconv.Itoa(c.conn.Port)
+}
+
+// User returns the requesting-user-name sent with every request.
+func (c *Client) User() string {
+	return c.user
+}
+
+// requestingUser picks the user name the way the command-line tools do:
+// the configured user, then the environment, then "anonymous".
+func requestingUser(conn *cupsclient.Client) string {
+	if user := strings.TrimSpace(conn.User); user != "" {
+		return user
+	}
+	for _, key := range []string{"CUPS_USER", "USER", "USERNAME"} {
+		if user := strings.TrimSpace(os.Getenv(key)); user != "" {
+			return user
+		}
+	}
+	return "anonymous"
+}
+
+// PrinterURI returns the URI naming a printer or class in requests.
+func (c *Client) PrinterURI(name string) string {
+	return c.conn.PrinterURI(name)
+}
+
+// NewRequest returns a request for op with the charset, language and
+// requesting user filled in.
+func (c *Client) NewRequest(op goipp.Op) *goipp.Message {
+	req := goipp.NewRequest(goipp.DefaultVersion, op, c.requestID.Add(1))
+	req.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	req.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	req.Operation.Add(goipp.MakeAttribute("requesting-user-name", goipp.TagName, goipp.String(c.user)))
+	return req
+}
+
+// Do sends req, followed by doc when it is not nil, and returns the
+// response. A document is streamed with chunked encoding rather than read
+// into memory. HTTP and IPP failures are returned as *Error.
+func (c *Client) Do(ctx context.Context, req *goipp.Message, doc io.Reader) (*goipp.Message, error) {
+	return c.do(ctx, req, doc, c.timeout)
+}
+
+func (c *Client) do(ctx context.Context, req *goipp.Message, doc io.Reader, timeout time.Duration) (*goipp.Message, error) {
+	resp, httpResp, err := c.conn.Do(ctx, cupsclient.Request{
+		Resource: cupsclient.ResourceFor(req),
+		Message:  req,
+		Document: doc,
+		Timeout:  timeout,
+	})
+	if err != nil {
+		if httpResp != nil && httpResp.StatusCode/100 != 2 {
+			return nil, httpError(goipp.Op(req.Code), httpResp)
+		}
+		return nil, err
+	}
+	if status := goipp.Status(resp.Code); status >= goipp.StatusRedirectionOtherSite {
+		return nil, &Error{
+			Op:      goipp.Op(req.Code),
+			Status:  status,
+			Message: attrString(resp.Operation, "status-message"),
+		}
+	}
+	return resp, nil
+}
+
+// printerRequest returns a request for op addressed to a destination.
+func (c *Client) printerRequest(op goipp.Op, dest string) *goipp.Message {
+	req := c.NewRequest(op)
+	req.Operation.Add(goipp.MakeAttribute("printer-uri", goipp.TagURI, goipp.String(c.PrinterURI(dest))))
+	return req
+}
+
+// jobRequest returns a request for op addressed to a job.
+func (c *Client) jobRequest(op goipp.Op, id int) *goipp.Message {
+	req := c.NewRequest(op)
+	req.Operation.Add(goipp.MakeAttribute("job-uri", goipp.TagURI, goipp.String("ipp://localhost/jobs/"+strconv.Itoa(id))))
+	return req
+}
+
+func addKeywords(attrs *goipp.Attributes, name string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	vals := make([]goipp.Value, 0, len(values))
+	for _, v := range values {
+		vals = append(vals, goipp.String(v))
+	}
+	attrs.Add(goipp.MakeAttr(name, goipp.TagKeyword, vals[0], vals[1:]...))
+}
+
+func attrString(attrs goipp.Attributes, name string) string {
+	for _, a := range attrs {
+		if a.Name == name && len(a.Values) > 0 {
+			return a.Values[0].V.String()
+		}
+	}
+	return ""
+}
+
+func attrStrings(attrs goipp.Attributes, name string) []string {
+	for _, a := range attrs {
+		if a.Name != name {
+			continue
+		}
+		out := make([]string, 0, len(a.Values))
+		for _, v := range a.Values {
+			if s := v.V.String(); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func attrInt(attrs goipp.Attributes, name string) int {
+	for _, a := range attrs {
+		if a.Name == name && len(a.Values) > 0 {
+			if n, ok := a.Values[0].V.(goipp.Integer); ok {
+				return int(n)
+			}
+			n, _ := strconv.Atoi(a.Values[0].V.String())
+			return n
+		}
+	}
+	return 0
+}
+
+func attrBool(attrs goipp.Attributes, name string) bool {
+	for _, a := range attrs {
+		if a.Name == name && len(a.Values) > 0 {
+			if b, ok := a.Values[0].V.(goipp.Boolean); ok {
+				return bool(b)
+			}
+			return a.Values[0].V.String() == "true"
+		}
+	}
+	return false
+}
+
+func attrTime(attrs goipp.Attributes, name string) time.Time {
+	if n := attrInt(attrs, name); n > 0 {
+		return time.Unix(int64(n), 0)
+	}
+	return time.Time{}
+}
+
+// nameFromURI returns the last path element of a printer or job URI.
+func nameFromURI(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	name, err := url.PathUnescape(path)
+	if err != nil {
+		return path
+	}
+	return name
+}
@@ -0,0 +1,292 @@
+package cups
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// fakeScheduler answers IPP requests with handle and records what it saw.
+type fakeScheduler struct {
+	t      *testing.T
+	handle func(req *goipp.Message, r *http.Request, doc []byte) *goipp.Message
+
+	mu       sync.Mutex
+	requests []*goipp.Message
+	paths    []string
+	chunked  []bool
+}
+
+func (f *fakeScheduler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req := &goipp.Message{}
+	if err := req.Decode(r.Body); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	doc, _ := io.ReadAll(r.Body)
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	f.paths = append(f.paths, r.URL.Path)
+	f.chunked = append(f.chunked, len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked")
+	f.mu.Unlock()
+	resp := f.handle(req, r, doc)
+	if resp == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	data, _ := resp.EncodeBytes()
+	w.Header().Set("Content-Type", goipp.ContentType)
+	w.Write(data)
+}
+
+func newTestClient(t *testing.T, handle func(req *goipp.Message, r *http.Request, doc []byte) *goipp.Message, opts ...Option) (*Client, *fakeScheduler) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("CUPS_CLIENT_CONF_DIR", dir)
+	t.Setenv("CUPS_USER_CONF_DIR", dir)
+	t.Setenv("CUPS_SERVER", "")
+	t.Setenv("CUPS_USER", "")
+	fake := &fakeScheduler{t: t, handle: handle}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	opts = append([]Option{WithServer(strings.TrimPrefix(srv.URL, "http://")), WithUser("alice")}, opts...)
+	return New(opts...), fake
+}
+
+func response(req *goipp.Message, status goipp.Status) *goipp.Message {
+	resp := goipp.NewResponse(req.Version, status, req.RequestID)
+	resp.Operation.Add(goipp.MakeAttribute("attributes-charset", goipp.TagCharset, goipp.String("utf-8")))
+	resp.Operation.Add(goipp.MakeAttribute("attributes-natural-language", goipp.TagLanguage, goipp.String("en-US")))
+	return resp
+}
+
+func TestPrintStreamsDocumentWithTypedOptions(t *testing.T) {
+	var gotDoc []byte
+	client, fake := newTestClient(t, func(req *goipp.Message, r *http.Request, doc []byte) *goipp.Message {
+		gotDoc = doc
+		resp := response(req, goipp.StatusOk)
+		resp.Job.Add(goipp.MakeAttribute("job-id", goipp.TagInteger, goipp.Integer(42)))
+		resp.Job.Add(goipp.MakeAttribute("job-state", goipp.TagEnum, goipp.Integer(3)))
+		return resp
+	}, WithLpOptions(writeLpOptions(t, "Dest Office media=A4 copies=5\nDest Office/duplex sides=two-sided-long-edge\n")))
+
+	job, err := client.Print(context.Background(), "Office/duplex", JobRequest{
+		Name:    "report",
+		Options: ParseOptions("copies=2 page-ranges=1-3"),
+	}, Document{Name: "report.txt", Format: "text/plain", Reader: strings.NewReader("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != 42 || job.State != JobPending {
+		t.Fatalf("job = %+v", job)
+	}
+	req := fake.requests[0]
+	if goipp.Op(req.Code) != goipp.OpPrintJob || fake.paths[0] != "/printers/Office" || !fake.chunked[0] {
+		t.Fatalf("sent %s to %s (chunked %v)", goipp.Op(req.Code), fake.paths[0], fake.chunked[0])
+	}
+	if string(gotDoc) != "hello" {
+		t.Fatalf("document = %q", gotDoc)
+	}
+	op := map[string]string{}
+	for _, a := range req.Operation {
+		op[a.Name] = a.Values[0].V.String()
+	}
+	if op["printer-uri"] != "ipp://localhost/printers/Office" || op["requesting-user-name"] != "alice" || op["document-format"] != "text/plain" || op["job-name"] != "report" {
+		t.Fatalf("operation attributes = %v", op)
+	}
+	jobAttrs := map[string]goipp.Attribute{}
+	for _, a := range req.Job {
+		jobAttrs[a.Name] = a
+	}
+	// The request wins over the instance, which inherits its queue.
+	if v := jobAttrs["copies"]; v.Values[0].V != goipp.Integer(2) {
+		t.Fatalf("copies = %v", v)
+	}
+	if jobAttrs["media"].Values[0].V.String() != "A4" || jobAttrs["sides"].Values[0].V.String() != "two-sided-long-edge" {
+		t.Fatalf("lpoptions were not merged: %v", req.Job)
+	}
+	if jobAttrs["page-ranges"].Values[0].T != goipp.TagRange {
+		t.Fatalf("page-ranges = %v", jobAttrs["page-ranges"])
+	}
+}
+
+func TestPrintSeveralDocuments(t *testing.T) {
+	var docs []string
+	client, fake := newTestClient(t, func(req *goipp.Message, r *http.Request, doc []byte) *goipp.Message {
+		resp := response(req, goipp.StatusOk)
+		switch goipp.Op(req.Code) {
+		case goipp.OpCreateJob, goipp.OpGetJobAttributes:
+			resp.Job.Add(goipp.MakeAttribute("job-id", goipp.TagInteger, goipp.Integer(7)))
+		case goipp.OpSendDocument:
+			docs = append(docs, string(doc))
+		}
+		return resp
+	}, WithLpOptions())
+
+	job, err := client.Print(context.Background(), "Office", JobRequest{},
+		Document{Reader: strings.NewReader("one")}, Document{Reader: strings.NewReader("two")})
+	if err != nil || job.ID != 7 {
+		t.Fatalf("Print = %+v, %v", job, err)
+	}
+	var ops []string
+	for _, req := range fake.requests {
+		ops = append(ops, goipp.Op(req.Code).String())
+	}
+	if strings.Join(ops, ",") != "Create-Job,Send-Document,Send-Document,Get-Job-Attribute" || strings.Join(docs, ",") != "one,two" {
+		t.Fatalf("ops %v docs %v", ops, docs)
+	}
+	if attrString(fake.requests[1].Operation, "job-uri") != "ipp://localhost/jobs/7" || attrBool(fake.requests[1].Operation, "last-document") || !attrBool(fake.requests[2].Operation, "last-document") {
+		t.Fatalf("Send-Document requests are wrong: %v / %v", fake.requests[1].Operation, fake.requests[2].Operation)
+	}
+}
+
+func TestErrorsMapStatus(t *testing.T) {
+	client, _ := newTestClient(t, func(req *goipp.Message, r *http.Request, doc []byte) *goipp.Message {
+		switch goipp.Op(req.Code) {
+		case goipp.OpCancelJob:
+			resp := response(req, goipp.StatusErrorNotFound)
+			resp.Operation.Add(goipp.MakeAttribute("status-message", goipp.TagText, goipp.String("Job #9 does not exist.")))
+			return resp
+		case goipp.OpCupsDeletePrinter:
+			return nil
+		case goipp.OpPrintJob:
+			return response(req, goipp.StatusErrorNotAcceptingJobs)
+		}
+		return response(req, goipp.StatusErrorBusy)
+	}, WithLpOptions())
+	ctx := context.Background()
+
+	err := client.CancelJob(ctx, 9, false)
+	var ippErr *Error
+	if !errors.As(err, &ippErr) || ippErr.Status != goipp.StatusErrorNotFound || !errors.Is(err, ErrNotFound) || errors.Is(err, ErrForbidden) {
+		t.Fatalf("CancelJob error = %v", err)
+	}
+	if !strings.Contains(err.Error(), "Job #9 does not exist.") {
+		t.Fatalf("message lost: %v", err)
+	}
+	if err := client.DeletePrinter(ctx, "Office"); !errors.Is(err, ErrNotAuthenticated) {
+		t.Fatalf("HTTP 401 = %v", err)
+	}
+	if _, err := client.Print(ctx, "Office", JobRequest{}, Document{Reader: strings.NewReader("x")}); !errors.Is(err, ErrNotAcceptingJobs) {
+		t.Fatalf("not accepting = %v", err)
+	}
+	if err := client.PausePrinter(ctx, "Office", "maintenance"); !errors.Is(err, ErrServiceUnavailable) {
+		t.Fatalf("busy = %v", err)
+	}
+}
+
+func TestDestinationsMergeDefaultsAndLpOptions(t *testing.T) {
+	client, _ := newTestClient(t, func(req *goipp.Message, r *http.Request, doc []byte) *goipp.Message {
+		resp := response(req, goipp.StatusOk)
+		switch goipp.Op(req.Code) {
+		case goipp.OpCupsGetDefault:
+			resp.Printer.Add(goipp.MakeAttribute("printer-name", goipp.TagName, goipp.String("Lab")))
+		case goipp.OpCupsGetPrinters:
+			resp.Groups = goipp.Groups{{Tag: goipp.TagOperationGroup, Attrs: resp.Operation}}
+			for _, name := range []string{"Office", "Lab"} {
+				resp.Groups = append(resp.Groups, goipp.Group{Tag: goipp.TagPrinterGroup, Attrs: goipp.Attributes{
+					goipp.MakeAttribute("printer-name", goipp.TagName, goipp.String(name)),
+					goipp.MakeAttribute("printer-state", goipp.TagEnum, goipp.Integer(3)),
+					goipp.MakeAttribute("printer-is-accepting-jobs", goipp.TagBoolean, goipp.Boolean(true)),
+					goipp.MakeAttribute("media-default", goipp.TagKeyword, goipp.String("na_letter_8.5x11in")),
+					goipp.MakeAttribute("sides-default", goipp.TagKeyword, goipp.String("one-sided")),
+				}})
+			}
+		}
+		return resp
+	}, WithLpOptions(writeLpOptions(t, "Dest Office media=iso_a4_210x297mm\nDest Office/draft print-quality=draft\n")))
+
+	dests, err := client.Destinations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, d := range dests {
+		names = append(names, d.FullName())
+	}
+	if strings.Join(names, ",") != "Lab,Office,Office/draft" {
+		t.Fatalf("destinations = %v", names)
+	}
+	lab, office, draft := dests[0], dests[1], dests[2]
+	if !lab.IsDefault || office.IsDefault || lab.State != PrinterIdle || !lab.Accepting {
+		t.Fatalf("Lab = %+v", lab)
+	}
+	if office.Options["media"] != "iso_a4_210x297mm" || office.Options["sides"] != "one-sided" || lab.Options["media"] != "na_letter_8.5x11in" {
+		t.Fatalf("options: office %v lab %v", office.Options, lab.Options)
+	}
+	if draft.Options["print-quality"] != "draft" || draft.Options["media"] != "iso_a4_210x297mm" || office.Options["print-quality"] != "" {
+		t.Fatalf("instance options = %v", draft.Options)
+	}
+}
+
+func TestWatchLongPollsUntilEventsComplete(t *testing.T) {
+	round := 0
+	client, fake := newTestClient(t, func(req *goipp.Message, r *http.Request, doc []byte) *goipp.Message {
+		if goipp.Op(req.Code) == goipp.OpCreateJobSubscriptions {
+			resp := response(req, goipp.StatusOk)
+			resp.Subscription.Add(goipp.MakeAttribute("notify-subscription-id", goipp.TagInteger, goipp.Integer(3)))
+			return resp
+		}
+		round++
+		status := goipp.StatusOk
+		if round == 2 {
+			status = goipp.StatusOkEventsComplete
+		}
+		resp := response(req, status)
+		if round == 1 {
+			resp.Operation.Add(goipp.MakeAttribute("notify-get-interval", goipp.TagInteger, goipp.Integer(10)))
+		}
+		resp.Groups = goipp.Groups{{Tag: goipp.TagOperationGroup, Attrs: resp.Operation}}
+		for seq, event := range map[int]string{1: "job-created", 2: "job-completed"} {
+			if seq != round {
+				continue
+			}
+			resp.Groups = append(resp.Groups, goipp.Group{Tag: goipp.TagEventNotificationGroup, Attrs: goipp.Attributes{
+				goipp.MakeAttribute("notify-subscription-id", goipp.TagInteger, goipp.Integer(3)),
+				goipp.MakeAttribute("notify-sequence-number", goipp.TagInteger, goipp.Integer(seq)),
+				goipp.MakeAttribute("notify-event", goipp.TagKeyword, goipp.String(event)),
+				goipp.MakeAttribute("notify-job-id", goipp.TagInteger, goipp.Integer(42)),
+			}})
+		}
+		return resp
+	}, WithLpOptions())
+	ctx := context.Background()
+
+	sub, err := client.CreateJobSubscription(ctx, 42, SubscriptionRequest{Events: []string{"job-state-changed"}})
+	if err != nil || sub.ID != 3 {
+		t.Fatalf("CreateJobSubscription = %+v, %v", sub, err)
+	}
+	if attrString(fake.requests[0].Subscription, "notify-pull-method") != "ippget" || attrString(fake.requests[0].Operation, "job-uri") != "ipp://localhost/jobs/42" {
+		t.Fatalf("subscription request = %v", fake.requests[0])
+	}
+	var events []string
+	err = client.Watch(ctx, []int{sub.ID}, func(ev Event) error {
+		events = append(events, ev.Event)
+		return nil
+	})
+	if err != nil || strings.Join(events, ",") != "job-created,job-completed" {
+		t.Fatalf("Watch = %v, %v", events, err)
+	}
+	second := fake.requests[2]
+	if !attrBool(second.Operation, "notify-wait") || attrInt(second.Operation, "notify-sequence-numbers") != 2 {
+		t.Fatalf("second poll = %v", second.Operation)
+	}
+}
+
+func writeLpOptions(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "lpoptions")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
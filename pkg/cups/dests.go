@@ -0,0 +1,239 @@
+package cups
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// PrinterState is the printer-state enum.
+type PrinterState int
+
+const (
+	PrinterIdle       PrinterState = 3
+	PrinterProcessing PrinterState = 4
+	PrinterStopped    PrinterState = 5
+)
+
+func (s PrinterState) String() string {
+	switch s {
+	case PrinterIdle:
+		return "idle"
+	case PrinterProcessing:
+		return "processing"
+	case PrinterStopped:
+		return "stopped"
+	}
+	return "unknown"
+}
+
+// Destination is a printer or class, or an lpoptions instance of one.
+type Destination struct {
+	Name string
+	// Instance is the lpoptions instance name, empty for the queue itself.
+	Instance     string
+	URI          string
+	IsClass      bool
+	IsDefault    bool
+	State        PrinterState
+	StateReasons []string
+	StateMessage string
+	StateChanged time.Time
+	Accepting    bool
+	Shared       bool
+	Info         string
+	Location     string
+	MakeAndModel string
+	DeviceURI    string
+	DeviceID     string
+	// Members lists the printers of a class.
+	Members []string
+	// Options are the printer's job defaults (the *-default attributes
+	// without the suffix) overlaid with the lpoptions saved for it.
+	Options Options
+	// Attributes is everything the scheduler returned.
+	Attributes goipp.Attributes
+}
+
+// FullName is Name, or Name/Instance for an instance.
+func (d *Destination) FullName() string {
+	if d.Instance != "" {
+		return d.Name + "/" + d.Instance
+	}
+	return d.Name
+}
+
+// Destinations lists the printers and classes, sorted by name, followed by
+// each lpoptions instance right after its queue. The default is the
+// lpoptions Default when set, else the scheduler's.
+func (c *Client) Destinations(ctx context.Context) ([]*Destination, error) {
+	req := c.NewRequest(goipp.OpCupsGetPrinters)
+	addKeywords(&req.Operation, "requested-attributes", []string{"all"})
+	resp, err := c.Do(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	local, err := c.localOptions()
+	if err != nil {
+		return nil, err
+	}
+	serverDefault, err := c.defaultName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defaultName := serverDefault
+	if local.Default != "" {
+		defaultName = local.Default
+	}
+	var out []*Destination
+	for _, group := range resp.Groups {
+		if group.Tag != goipp.TagPrinterGroup || len(group.Attrs) == 0 {
+			continue
+		}
+		dest := newDestination(group.Attrs, local)
+		dest.IsDefault = strings.EqualFold(dest.Name, defaultName)
+		out = append(out, dest)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name) })
+	return withInstances(out, local, defaultName), nil
+}
+
+// Destination returns one printer or class; "name/instance" returns an
+// lpoptions instance with its saved options.
+func (c *Client) Destination(ctx context.Context, name string) (*Destination, error) {
+	base, instance, _ := strings.Cut(name, "/")
+	req := c.printerRequest(goipp.OpGetPrinterAttributes, base)
+	addKeywords(&req.Operation, "requested-attributes", []string{"all"})
+	resp, err := c.Do(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	local, err := c.localOptions()
+	if err != nil {
+		return nil, err
+	}
+	dest := newDestination(resp.Printer, local)
+	if dest.Name == "" {
+		dest.Name = base
+	}
+	if instance != "" {
+		if _, ok := local.Dests[name]; !ok {
+			return nil, &Error{Op: goipp.OpGetPrinterAttributes, Status: goipp.StatusErrorNotFound, Message: "no instance " + name}
+		}
+		dest.Instance = instance
+		dest.Options = dest.Options.Merge(local.For(name))
+	}
+	return dest, nil
+}
+
+// DefaultDestination returns the default destination: the lpoptions
+// Default when set, else the scheduler's. It fails with ErrNotFound when
+// there is none.
+func (c *Client) DefaultDestination(ctx context.Context) (*Destination, error) {
+	local, err := c.localOptions()
+	if err != nil {
+		return nil, err
+	}
+	name := local.Default
+	if name == "" {
+		if name, err = c.defaultName(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if name == "" {
+		return nil, &Error{Op: goipp.OpCupsGetDefault, Status: goipp.StatusErrorNotFound, Message: "no default destination"}
+	}
+	dest, err := c.Destination(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	dest.IsDefault = true
+	return dest, nil
+}
+
+// defaultName asks the scheduler for its default, empty when it has none.
+func (c *Client) defaultName(ctx context.Context) (string, error) {
+	req := c.NewRequest(goipp.OpCupsGetDefault)
+	addKeywords(&req.Operation, "requested-attributes", []string{"printer-name"})
+	resp, err := c.Do(ctx, req, nil)
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.Is(ErrNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+	return attrString(resp.Printer, "printer-name"), nil
+}
+
+func (c *Client) localOptions() (*LpOptions, error) {
+	return LoadLpOptions(c.lpOptions...)
+}
+
+func newDestination(attrs goipp.Attributes, local *LpOptions) *Destination {
+	d := &Destination{
+		Name:         attrString(attrs, "printer-name"),
+		URI:          attrString(attrs, "printer-uri-supported"),
+		State:        PrinterState(attrInt(attrs, "printer-state")),
+		StateReasons: attrStrings(attrs, "printer-state-reasons"),
+		StateMessage: attrString(attrs, "printer-state-message"),
+		StateChanged: attrTime(attrs, "printer-state-change-time"),
+		Accepting:    attrBool(attrs, "printer-is-accepting-jobs"),
+		Shared:       attrBool(attrs, "printer-is-shared"),
+		Info:         attrString(attrs, "printer-info"),
+		Location:     attrString(attrs, "printer-location"),
+		MakeAndModel: attrString(attrs, "printer-make-and-model"),
+		DeviceURI:    attrString(attrs, "device-uri"),
+		DeviceID:     attrString(attrs, "printer-device-id"),
+		Members:      attrStrings(attrs, "member-names"),
+		Options:      Options{},
+		Attributes:   attrs,
+	}
+	// CUPS_PRINTER_CLASS in printer-type.
+	d.IsClass = attrInt(attrs, "printer-type")&0x0001 != 0 || len(d.Members) > 0
+	for _, a := range attrs {
+		name, ok := strings.CutSuffix(a.Name, "-default")
+		if !ok || len(a.Values) == 0 || name == "document-format" {
+			continue
+		}
+		if a.Values[0].T == goipp.TagNoValue || a.Values[0].T == goipp.TagBeginCollection {
+			continue
+		}
+		values := make([]string, 0, len(a.Values))
+		for _, v := range a.Values {
+			values = append(values, v.V.String())
+		}
+		d.Options[name] = strings.Join(values, ",")
+	}
+	d.Options = d.Options.Merge(local.For(d.Name))
+	return d
+}
+
+// withInstances inserts the lpoptions instances of each queue after it.
+func withInstances(dests []*Destination, local *LpOptions, defaultName string) []*Destination {
+	instances := map[string][]string{}
+	for name := range local.Dests {
+		if base, instance, ok := strings.Cut(name, "/"); ok && instance != "" {
+			instances[strings.ToLower(base)] = append(instances[strings.ToLower(base)], name)
+		}
+	}
+	if len(instances) == 0 {
+		return dests
+	}
+	out := make([]*Destination, 0, len(dests))
+	for _, d := range dests {
+		out = append(out, d)
+		names := instances[strings.ToLower(d.Name)]
+		sort.Strings(names)
+		for _, name := range names {
+			inst := *d
+			_, inst.Instance, _ = strings.Cut(name, "/")
+			inst.IsDefault = strings.EqualFold(name, defaultName)
+			inst.Options = d.Options.Merge(local.Dests[name])
+			out = append(out, &inst)
+		}
+	}
+	return out
+}
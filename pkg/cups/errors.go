@@ -0,0 +1,103 @@
+package cups
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// Sentinels for the failure classes callers usually branch on. An *Error
+// matches one of them with errors.Is.
+var (
+	ErrBadRequest         = errors.New("cups: bad request")
+	ErrNotAuthenticated   = errors.New("cups: not authenticated")
+	ErrForbidden          = errors.New("cups: forbidden")
+	ErrNotFound           = errors.New("cups: not found")
+	ErrNotPossible        = errors.New("cups: not possible")
+	ErrUnsupported        = errors.New("cups: not supported")
+	ErrNotAcceptingJobs   = errors.New("cups: not accepting jobs")
+	ErrServiceUnavailable = errors.New("cups: service unavailable")
+	ErrServerError        = errors.New("cups: server error")
+)
+
+// Error is a request the scheduler refused, either with an IPP status or,
+// when Status is zero, with a non-2xx HTTP status.
+type Error struct {
+	Op         goipp.Op
+	Status     goipp.Status
+	HTTPStatus int
+	// Message is the status-message or HTTP reason, when there is one.
+	Message string
+}
+
+func (e *Error) Error() string {
+	var status string
+	if e.Status != 0 {
+		status = e.Status.String()
+	} else {
+		status = fmt.Sprintf("HTTP %d", e.HTTPStatus)
+	}
+	if e.Message != "" && e.Message != status {
+		return fmt.Sprintf("%s: %s: %s", e.Op, status, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Op, status)
+}
+
+// Is matches the sentinel for the error's class.
+func (e *Error) Is(target error) bool {
+	class := e.class()
+	return class != nil && class == target
+}
+
+func (e *Error) class() error {
+	if e.Status == 0 {
+		switch e.HTTPStatus {
+		case http.StatusBadRequest:
+			return ErrBadRequest
+		case http.StatusUnauthorized:
+			return ErrNotAuthenticated
+		case http.StatusForbidden:
+			return ErrForbidden
+		case http.StatusNotFound:
+			return ErrNotFound
+		case http.StatusServiceUnavailable:
+			return ErrServiceUnavailable
+		}
+		if e.HTTPStatus >= 500 {
+			return ErrServerError
+		}
+		return nil
+	}
+	switch e.Status {
+	case goipp.StatusErrorBadRequest, goipp.StatusErrorRequestEntity, goipp.StatusErrorRequestValue,
+		goipp.StatusErrorConflicting, goipp.StatusErrorCharset:
+		return ErrBadRequest
+	case goipp.StatusErrorNotAuthenticated:
+		return ErrNotAuthenticated
+	case goipp.StatusErrorForbidden, goipp.StatusErrorNotAuthorized:
+		return ErrForbidden
+	case goipp.StatusErrorNotFound, goipp.StatusErrorGone:
+		return ErrNotFound
+	case goipp.StatusErrorNotPossible, goipp.StatusErrorAttributesNotSettable:
+		return ErrNotPossible
+	case goipp.StatusErrorOperationNotSupported, goipp.StatusErrorDocumentFormatNotSupported,
+		goipp.StatusErrorAttributesOrValues, goipp.StatusErrorURIScheme,
+		goipp.StatusErrorCompressionNotSupported, goipp.StatusErrorVersionNotSupported,
+		goipp.StatusErrorMultipleJobsNotSupported:
+		return ErrUnsupported
+	case goipp.StatusErrorNotAcceptingJobs:
+		return ErrNotAcceptingJobs
+	case goipp.StatusErrorServiceUnavailable, goipp.StatusErrorBusy, goipp.StatusErrorTemporary:
+		return ErrServiceUnavailable
+	}
+	if e.Status >= goipp.StatusErrorInternal {
+		return ErrServerError
+	}
+	return nil
+}
+
+func httpError(op goipp.Op, resp *http.Response) *Error {
+	return &Error{Op: op, HTTPStatus: resp.StatusCode, Message: http.StatusText(resp.StatusCode)}
+}
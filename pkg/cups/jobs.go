@@ -0,0 +1,296 @@
+package cups
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// JobState is the job-state enum.
+type JobState int
+
+const (
+	JobPending           JobState = 3
+	JobHeld              JobState = 4
+	JobProcessing        JobState = 5
+	JobProcessingStopped JobState = 6
+	JobCanceled          JobState = 7
+	JobAborted           JobState = 8
+	JobCompleted         JobState = 9
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobPending:
+		return "pending"
+	case JobHeld:
+		return "pending-held"
+	case JobProcessing:
+		return "processing"
+	case JobProcessingStopped:
+		return "processing-stopped"
+	case JobCanceled:
+		return "canceled"
+	case JobAborted:
+		return "aborted"
+	case JobCompleted:
+		return "completed"
+	}
+	return "unknown"
+}
+
+// Done reports whether the job reached a terminal state.
+func (s JobState) Done() bool {
+	return s >= JobCanceled
+}
+
+// Job is a print job.
+type Job struct {
+	ID           int
+	URI          string
+	Name         string
+	User         string
+	Destination  string
+	State        JobState
+	StateReasons []string
+	StateMessage string
+	Priority     int
+	Copies       int
+	Documents    int
+	SizeKB       int
+	Impressions  int
+	Created      time.Time
+	Processing   time.Time
+	Completed    time.Time
+	// Attributes is everything the scheduler returned.
+	Attributes goipp.Attributes
+}
+
+func newJob(attrs goipp.Attributes) *Job {
+	j := &Job{
+		ID:           attrInt(attrs, "job-id"),
+		URI:          attrString(attrs, "job-uri"),
+		Name:         attrString(attrs, "job-name"),
+		User:         attrString(attrs, "job-originating-user-name"),
+		Destination:  nameFromURI(attrString(attrs, "job-printer-uri")),
+		State:        JobState(attrInt(attrs, "job-state")),
+		StateReasons: attrStrings(attrs, "job-state-reasons"),
+		StateMessage: attrString(attrs, "job-printer-state-message"),
+		Priority:     attrInt(attrs, "job-priority"),
+		Copies:       attrInt(attrs, "copies"),
+		Documents:    attrInt(attrs, "number-of-documents"),
+		SizeKB:       attrInt(attrs, "job-k-octets"),
+		Impressions:  attrInt(attrs, "job-impressions-completed"),
+		Created:      attrTime(attrs, "time-at-creation"),
+		Processing:   attrTime(attrs, "time-at-processing"),
+		Completed:    attrTime(attrs, "time-at-completed"),
+		Attributes:   attrs,
+	}
+	if j.StateMessage == "" {
+		j.StateMessage = attrString(attrs, "job-state-message")
+	}
+	return j
+}
+
+// Document is one file of a job. Reader is streamed to the scheduler and
+// not closed.
+type Document struct {
+	Name string
+	// Format is the MIME type; empty lets the scheduler detect it.
+	Format string
+	Reader io.Reader
+}
+
+// JobRequest describes a job to submit.
+type JobRequest struct {
+	Name string
+	// Options are job template options as given to lp -o; they override
+	// the destination's lpoptions. "job-hold-until=indefinite" holds the
+	// job on submission.
+	Options Options
+}
+
+// Print submits docs as one job to dest, which may be "name/instance".
+// A single document uses Print-Job; several use Create-Job and one
+// Send-Document each, and a failed document cancels the job.
+func (c *Client) Print(ctx context.Context, dest string, job JobRequest, docs ...Document) (*Job, error) {
+	if len(docs) == 0 {
+		return nil, errors.New("cups: no documents to print")
+	}
+	if len(docs) > 1 {
+		created, err := c.CreateJob(ctx, dest, job)
+		if err != nil {
+			return nil, err
+		}
+		for i, doc := range docs {
+			if err := c.SendDocument(ctx, created.ID, doc, i == len(docs)-1); err != nil {
+				_ = c.CancelJob(ctx, created.ID, false)
+				return nil, err
+			}
+		}
+		return c.Job(ctx, created.ID)
+	}
+	base, _, _ := strings.Cut(dest, "/")
+	req := c.printerRequest(goipp.OpPrintJob, base)
+	c.addJob(req, dest, job)
+	addDocument(req, docs[0])
+	resp, err := c.Do(ctx, req, docs[0].Reader)
+	if err != nil {
+		return nil, err
+	}
+	return newJob(resp.Job), nil
+}
+
+// CreateJob creates an empty job on dest for SendDocument.
+func (c *Client) CreateJob(ctx context.Context, dest string, job JobRequest) (*Job, error) {
+	base, _, _ := strings.Cut(dest, "/")
+	req := c.printerRequest(goipp.OpCreateJob, base)
+	c.addJob(req, dest, job)
+	resp, err := c.Do(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newJob(resp.Job), nil
+}
+
+// SendDocument streams a document into a job made with CreateJob; last
+// closes the job so it can print.
+func (c *Client) SendDocument(ctx context.Context, jobID int, doc Document, last bool) error {
+	req := c.jobRequest(goipp.OpSendDocument, jobID)
+	addDocument(req, doc)
+	req.Operation.Add(goipp.MakeAttribute("last-document", goipp.TagBoolean, goipp.Boolean(last)))
+	_, err := c.Do(ctx, req, doc.Reader)
+	return err
+}
+
+// addJob adds the job name and the options, over the lpoptions saved for
+// dest.
+func (c *Client) addJob(req *goipp.Message, dest string, job JobRequest) {
+	if job.Name != "" {
+		req.Operation.Add(goipp.MakeAttribute("job-name", goipp.TagName, goipp.String(job.Name)))
+	}
+	opts := Options{}
+	if local, err := c.localOptions(); err == nil {
+		opts = local.For(dest)
+	}
+	opts = opts.Merge(job.Options)
+	if format := opts["document-format"]; format != "" {
+		req.Operation.Add(goipp.MakeAttribute("document-format", goipp.TagMimeType, goipp.String(format)))
+		delete(opts, "document-format")
+	}
+	req.Job = opts.Attributes()
+}
+
+func addDocument(req *goipp.Message, doc Document) {
+	if doc.Name != "" {
+		req.Operation.Add(goipp.MakeAttribute("document-name", goipp.TagName, goipp.String(doc.Name)))
+	}
+	if doc.Format != "" {
+		// A per-document format replaces one from the options.
+		kept := req.Operation[:0]
+		for _, a := range req.Operation {
+			if a.Name != "document-format" {
+				kept = append(kept, a)
+			}
+		}
+		req.Operation = kept
+		req.Operation.Add(goipp.MakeAttribute("document-format", goipp.TagMimeType, goipp.String(doc.Format)))
+	}
+}
+
+// WhichJobs selects jobs by state.
+type WhichJobs string
+
+const (
+	NotCompletedJobs WhichJobs = "not-completed"
+	CompletedJobs    WhichJobs = "completed"
+	AllJobs          WhichJobs = "all"
+)
+
+// Jobs lists the jobs of dest, or of every destination when dest is
+// empty. mine limits the list to the client's user.
+func (c *Client) Jobs(ctx context.Context, dest string, which WhichJobs, mine bool) ([]*Job, error) {
+	req := c.printerRequest(goipp.OpGetJobs, dest)
+	if which != "" {
+		req.Operation.Add(goipp.MakeAttribute("which-jobs", goipp.TagKeyword, goipp.String(string(which))))
+	}
+	if mine {
+		req.Operation.Add(goipp.MakeAttribute("my-jobs", goipp.TagBoolean, goipp.Boolean(true)))
+	}
+	addKeywords(&req.Operation, "requested-attributes", []string{"all"})
+	resp, err := c.Do(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	var out []*Job
+	for _, group := range resp.Groups {
+		if group.Tag == goipp.TagJobGroup && len(group.Attrs) > 0 {
+			out = append(out, newJob(group.Attrs))
+		}
+	}
+	return out, nil
+}
+
+// Job returns one job.
+func (c *Client) Job(ctx context.Context, id int) (*Job, error) {
+	req := c.jobRequest(goipp.OpGetJobAttributes, id)
+	addKeywords(&req.Operation, "requested-attributes", []string{"all"})
+	resp, err := c.Do(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	return newJob(resp.Job), nil
+}
+
+// CancelJob cancels a job; purge also removes its files and history.
+func (c *Client) CancelJob(ctx context.Context, id int, purge bool) error {
+	req := c.jobRequest(goipp.OpCancelJob, id)
+	if purge {
+		req.Operation.Add(goipp.MakeAttribute("purge-job", goipp.TagBoolean, goipp.Boolean(true)))
+	}
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
+
+// HoldJob holds a pending job. until is a job-hold-until value such as
+// "indefinite" or "night"; empty means indefinite.
+func (c *Client) HoldJob(ctx context.Context, id int, until string) error {
+	req := c.jobRequest(goipp.OpHoldJob, id)
+	if until != "" {
+		req.Operation.Add(goipp.MakeAttribute("job-hold-until", goipp.TagKeyword, goipp.String(until)))
+	}
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
+
+// ReleaseJob releases a held job.
+func (c *Client) ReleaseJob(ctx context.Context, id int) error {
+	_, err := c.Do(ctx, c.jobRequest(goipp.OpReleaseJob, id), nil)
+	return err
+}
+
+// RestartJob prints a retained job again.
+func (c *Client) RestartJob(ctx context.Context, id int) error {
+	_, err := c.Do(ctx, c.jobRequest(goipp.OpRestartJob, id), nil)
+	return err
+}
+
+// MoveJob moves a job to another destination.
+func (c *Client) MoveJob(ctx context.Context, id int, dest string) error {
+	req := c.jobRequest(goipp.OpCupsMoveJob, id)
+	req.Job.Add(goipp.MakeAttribute("job-printer-uri", goipp.TagURI, goipp.String(c.PrinterURI(dest))))
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
+
+// SetJobAttributes changes the options of a job that has not printed yet.
+func (c *Client) SetJobAttributes(ctx context.Context, id int, opts Options) error {
+	req := c.jobRequest(goipp.OpSetJobAttributes, id)
+	req.Job = opts.Attributes()
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
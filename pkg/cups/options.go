@@ -0,0 +1,354 @@
+package cups
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	goipp "github.com/OpenPrinting/goipp"
+
+	"cupsgolang/internal/cupsclient"
+)
+
+// Options are job options by name, as given to lp -o. A name without a
+// value reads as "true".
+type Options map[string]string
+
+// ParseOptions reads space-separated name=value words. Values may be
+// quoted with ' or " and a backslash escapes the next character.
+func ParseOptions(s string) Options {
+	out := Options{}
+	for _, word := range splitWords(s) {
+		name, value, ok := strings.Cut(word, "=")
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !ok || value == "" {
+			value = "true"
+		}
+		out[name] = value
+	}
+	return out
+}
+
+// Merge returns o overlaid with each of more in turn.
+func (o Options) Merge(more ...Options) Options {
+	out := Options{}
+	for k, v := range o {
+		out[k] = v
+	}
+	for _, m := range more {
+		for k, v := range m {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// String writes the options back as sorted name=value words, quoting
+// values that need it.
+func (o Options) String() string {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	words := make([]string, 0, len(names))
+	for _, name := range names {
+		value := o[name]
+		if strings.ContainsAny(value, " \t'\"\\") {
+			value = "'" + strings.ReplaceAll(value, "'", `\'`) + "'"
+		}
+		words = append(words, name+"="+value)
+	}
+	return strings.Join(words, " ")
+}
+
+// Attributes converts the options to job template attributes, typed the
+// way lp sends them: integers for counts, enums for print-quality and
+// finishings, ranges for page-ranges, a resolution for printer-resolution
+// and keywords for everything else. Names are sorted so the encoding is
+// stable.
+func (o Options) Attributes() goipp.Attributes {
+	names := make([]string, 0, len(o))
+	for name := range o {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var attrs goipp.Attributes
+	for _, name := range names {
+		attrs.Add(optionAttribute(name, o[name]))
+	}
+	return attrs
+}
+
+func optionAttribute(name, value string) goipp.Attribute {
+	switch name {
+	case "copies", "job-priority", "number-up", "job-cancel-after", "number-of-retries", "retry-interval", "retry-time-out":
+		if n, err := strconv.Atoi(strings.TrimSpace(value)); err == nil {
+			return goipp.MakeAttribute(name, goipp.TagInteger, goipp.Integer(n))
+		}
+	case "print-quality":
+		if n, ok := parsePrintQuality(value); ok {
+			return goipp.MakeAttribute(name, goipp.TagEnum, goipp.Integer(n))
+		}
+	case "finishings", "orientation-requested":
+		var vals []goipp.Value
+		for _, part := range splitList(value, 0) {
+			n, err := strconv.Atoi(part)
+			if err != nil {
+				vals = nil
+				break
+			}
+			vals = append(vals, goipp.Integer(n))
+		}
+		if len(vals) > 0 {
+			return goipp.MakeAttr(name, goipp.TagEnum, vals[0], vals[1:]...)
+		}
+	case "page-ranges":
+		if ranges, err := ParseRanges(value); err == nil {
+			vals := make([]goipp.Value, 0, len(ranges))
+			for _, r := range ranges {
+				vals = append(vals, r)
+			}
+			return goipp.MakeAttr(name, goipp.TagRange, vals[0], vals[1:]...)
+		}
+	case "printer-resolution":
+		if res, err := ParseResolution(value); err == nil {
+			return goipp.MakeAttribute(name, goipp.TagResolution, res)
+		}
+	case "job-sheets":
+		parts := splitList(value, 2)
+		if len(parts) == 0 {
+			parts = []string{"none"}
+		}
+		vals := make([]goipp.Value, 0, len(parts))
+		for _, p := range parts {
+			vals = append(vals, goipp.String(p))
+		}
+		return goipp.MakeAttr(name, goipp.TagName, vals[0], vals[1:]...)
+	case "notify-recipient-uri":
+		return goipp.MakeAttribute(name, goipp.TagURI, goipp.String(value))
+	case "job-preset-name":
+		return goipp.MakeAttribute(name, goipp.TagName, goipp.String(strings.TrimSpace(value)))
+	}
+	return goipp.MakeAttribute(name, goipp.TagKeyword, goipp.String(value))
+}
+
+// ParseRanges reads a page-ranges value such as "1-4,7,9-". An open upper
+// bound means the last page.
+func ParseRanges(s string) ([]goipp.Range, error) {
+	var out []goipp.Range
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		lower, upper, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(strings.TrimSpace(lower))
+		if err != nil || start <= 0 {
+			return nil, &OptionError{Name: "page-ranges", Value: s}
+		}
+		end := start
+		if isRange {
+			end = int(^uint32(0) >> 1)
+			if v := strings.TrimSpace(upper); v != "" {
+				if end, err = strconv.Atoi(v); err != nil || end < start {
+					return nil, &OptionError{Name: "page-ranges", Value: s}
+				}
+			}
+		}
+		out = append(out, goipp.Range{Lower: start, Upper: end})
+	}
+	if len(out) == 0 {
+		return nil, &OptionError{Name: "page-ranges", Value: s}
+	}
+	return out, nil
+}
+
+// ParseResolution reads a printer-resolution value: "600", "600dpi",
+// "300x600dpi" or "118dpcm".
+func ParseResolution(s string) (goipp.Resolution, error) {
+	v := strings.ToLower(strings.TrimSpace(s))
+	units := goipp.UnitsDpi
+	switch {
+	case strings.HasSuffix(v, "dpcm"):
+		units = goipp.UnitsDpcm
+		v = strings.TrimSuffix(v, "dpcm")
+	case strings.HasSuffix(v, "dpi"):
+		v = strings.TrimSuffix(v, "dpi")
+	}
+	xs, ys, found := strings.Cut(v, "x")
+	if !found {
+		ys = xs
+	}
+	x, errX := strconv.Atoi(xs)
+	y, errY := strconv.Atoi(ys)
+	if errX != nil || errY != nil || x <= 0 || y <= 0 {
+		return goipp.Resolution{}, &OptionError{Name: "printer-resolution", Value: s}
+	}
+	return goipp.Resolution{Xres: x, Yres: y, Units: units}, nil
+}
+
+// OptionError is an option value that does not parse.
+type OptionError struct {
+	Name  string
+	Value string
+}
+
+func (e *OptionError) Error() string {
+	return "cups: bad " + e.Name + " value " + strconv.Quote(e.Value)
+}
+
+func parsePrintQuality(value string) (int, bool) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "3", "draft":
+		return 3, true
+	case "4", "normal":
+		return 4, true
+	case "5", "high":
+		return 5, true
+	}
+	return 0, false
+}
+
+func splitList(value string, max int) []string {
+	parts := strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || unicode.IsSpace(r)
+	})
+	if max > 0 && len(parts) > max {
+		parts = parts[:max]
+	}
+	return parts
+}
+
+func splitWords(value string) []string {
+	var out []string
+	var current strings.Builder
+	quote := rune(0)
+	escaped, inWord := false, false
+	for _, r := range value {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case unicode.IsSpace(r):
+			if inWord {
+				out = append(out, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+	if inWord {
+		out = append(out, current.String())
+	}
+	return out
+}
+
+// LpOptions holds lpoptions files: the default destination and options
+// saved per destination. Instances are keyed "name/instance".
+type LpOptions struct {
+	Default string
+	Dests   map[string]Options
+}
+
+// DefaultLpOptionsPaths returns the system lpoptions file followed by the
+// user's, in the order they are merged.
+func DefaultLpOptionsPaths() []string {
+	system, user := cupsclient.ConfDirs()
+	paths := []string{filepath.Join(system, "lpoptions")}
+	if user != "" {
+		paths = append(paths, filepath.Join(user, "lpoptions"))
+	}
+	return paths
+}
+
+// LoadLpOptions reads and merges lpoptions files. Missing files are
+// skipped; a later file's Default line and destination options win.
+func LoadLpOptions(paths ...string) (*LpOptions, error) {
+	out := &LpOptions{Dests: map[string]Options{}}
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+		err = out.read(f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+func (l *LpOptions) read(f *os.File) error {
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words := splitWords(line)
+		if len(words) < 2 {
+			continue
+		}
+		kind, dest := strings.ToLower(words[0]), words[1]
+		if kind != "default" && kind != "dest" && kind != "printer" {
+			continue
+		}
+		if kind == "default" {
+			l.Default = dest
+		}
+		l.Dests[dest] = l.Dests[dest].Merge(ParseOptions(strings.Join(quoteWords(words[2:]), " ")))
+	}
+	return scanner.Err()
+}
+
+// quoteWords re-quotes split words so ParseOptions reads them back
+// unchanged.
+func quoteWords(words []string) []string {
+	out := make([]string, len(words))
+	for i, w := range words {
+		name, value, ok := strings.Cut(w, "=")
+		if ok && strings.ContainsAny(value, " \t'\"\\") {
+			w = name + "='" + strings.ReplaceAll(value, "'", `\'`) + "'"
+		}
+		out[i] = w
+	}
+	return out
+}
+
+// For returns the saved options of a destination. An instance
+// ("name/instance") inherits the options of its base destination.
+func (l *LpOptions) For(dest string) Options {
+	if l == nil {
+		return Options{}
+	}
+	base, _, isInstance := strings.Cut(dest, "/")
+	if isInstance {
+		return l.Dests[base].Merge(l.Dests[dest])
+	}
+	return l.Dests[dest].Merge()
+}
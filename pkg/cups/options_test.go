@@ -0,0 +1,123 @@
+package cups
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+func TestParseOptions(t *testing.T) {
+	opts := ParseOptions(`copies=2 fit-to-page job-name='Quarterly report' media=A4 title="a \"b\"" x=\ y`)
+	want := Options{"copies": "2", "fit-to-page": "true", "job-name": "Quarterly report", "media": "A4", "title": `a "b"`, "x": " y"}
+	if len(opts) != len(want) {
+		t.Fatalf("ParseOptions = %v, want %v", opts, want)
+	}
+	for k, v := range want {
+		if opts[k] != v {
+			t.Fatalf("option %s = %q, want %q", k, opts[k], v)
+		}
+	}
+	if back := ParseOptions(opts.String()); len(back) != len(opts) || back["job-name"] != "Quarterly report" || back["title"] != `a "b"` {
+		t.Fatalf("String does not round-trip: %q -> %v", opts.String(), back)
+	}
+}
+
+func TestOptionsAttributes(t *testing.T) {
+	attrs := Options{
+		"copies":             "3",
+		"finishings":         "4,5",
+		"page-ranges":        "1-3,7",
+		"print-quality":      "high",
+		"printer-resolution": "300x600dpi",
+		"job-sheets":         "standard,none",
+		"job-preset-name":    "booklet",
+		"sides":              "two-sided-long-edge",
+	}.Attributes()
+	tags := map[string]goipp.Tag{}
+	values := map[string]goipp.Values{}
+	for _, a := range attrs {
+		tags[a.Name] = a.Values[0].T
+		values[a.Name] = a.Values
+	}
+	want := map[string]goipp.Tag{
+		"copies":             goipp.TagInteger,
+		"finishings":         goipp.TagEnum,
+		"page-ranges":        goipp.TagRange,
+		"print-quality":      goipp.TagEnum,
+		"printer-resolution": goipp.TagResolution,
+		"job-sheets":         goipp.TagName,
+		"job-preset-name":    goipp.TagName,
+		"sides":              goipp.TagKeyword,
+	}
+	for name, tag := range want {
+		if tags[name] != tag {
+			t.Errorf("%s encoded as %s, want %s", name, tags[name], tag)
+		}
+	}
+	if len(values["page-ranges"]) != 2 || len(values["finishings"]) != 2 || len(values["job-sheets"]) != 2 {
+		t.Fatalf("multi-valued options lost values: %v", attrs)
+	}
+	if attrs[0].Name != "copies" || attrs[len(attrs)-1].Name != "sides" {
+		t.Fatalf("attributes are not sorted: %v", attrs)
+	}
+	// Values that do not parse fall back to keywords.
+	bad := Options{"copies": "many", "page-ranges": "all"}.Attributes()
+	for _, a := range bad {
+		if a.Values[0].T != goipp.TagKeyword {
+			t.Fatalf("%s encoded as %s, want keyword", a.Name, a.Values[0].T)
+		}
+	}
+}
+
+func TestParseRangesAndResolution(t *testing.T) {
+	ranges, err := ParseRanges("1-4, 7,9-")
+	if err != nil || len(ranges) != 3 || ranges[0] != (goipp.Range{Lower: 1, Upper: 4}) || ranges[1] != (goipp.Range{Lower: 7, Upper: 7}) || ranges[2].Lower != 9 || ranges[2].Upper < 1<<30 {
+		t.Fatalf("ParseRanges = %v, %v", ranges, err)
+	}
+	for _, bad := range []string{"", "0", "4-2", "a-b"} {
+		if _, err := ParseRanges(bad); err == nil {
+			t.Fatalf("ParseRanges(%q) succeeded", bad)
+		}
+	}
+	for in, want := range map[string]goipp.Resolution{
+		"600":        {Xres: 600, Yres: 600, Units: goipp.UnitsDpi},
+		"300x600dpi": {Xres: 300, Yres: 600, Units: goipp.UnitsDpi},
+		"118dpcm":    {Xres: 118, Yres: 118, Units: goipp.UnitsDpcm},
+	} {
+		if got, err := ParseResolution(in); err != nil || got != want {
+			t.Fatalf("ParseResolution(%q) = %v, %v", in, got, err)
+		}
+	}
+	if _, err := ParseResolution("fine"); err == nil {
+		t.Fatal("ParseResolution accepted a keyword")
+	}
+}
+
+func TestLoadLpOptions(t *testing.T) {
+	dir := t.TempDir()
+	system := filepath.Join(dir, "system")
+	user := filepath.Join(dir, "user")
+	os.WriteFile(system, []byte("Default Office\nDest Office media=A4 sides=one-sided\nDest Lab copies=2\n"), 0o644)
+	os.WriteFile(user, []byte("# mine\nDest Office sides=two-sided-long-edge\nDest Office/draft print-quality=draft 'job-name=My draft'\nDefault Office/draft\n"), 0o644)
+
+	local, err := LoadLpOptions(system, user, filepath.Join(dir, "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.Default != "Office/draft" {
+		t.Fatalf("Default = %q, want the user's", local.Default)
+	}
+	office := local.For("Office")
+	if office["media"] != "A4" || office["sides"] != "two-sided-long-edge" {
+		t.Fatalf("Office options = %v", office)
+	}
+	draft := local.For("Office/draft")
+	if draft["media"] != "A4" || draft["print-quality"] != "draft" || draft["job-name"] != "My draft" {
+		t.Fatalf("instance does not inherit its queue: %v", draft)
+	}
+	if len(local.For("Nowhere")) != 0 {
+		t.Fatal("unknown destination has options")
+	}
+}
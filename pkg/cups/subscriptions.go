@@ -0,0 +1,192 @@
+package cups
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	goipp "github.com/OpenPrinting/goipp"
+)
+
+// SubscriptionRequest describes a pull (ippget) subscription.
+type SubscriptionRequest struct {
+	// Events are notify-events keywords such as "job-completed" or
+	// "printer-state-changed"; empty takes the scheduler's default.
+	Events []string
+	// Lease is how long the subscription lives; zero takes the default.
+	// Job subscriptions end with their job.
+	Lease time.Duration
+	// UserData is returned with every event, up to 63 bytes.
+	UserData []byte
+}
+
+// Subscription is a created subscription.
+type Subscription struct {
+	ID int
+}
+
+// Event is one notification.
+type Event struct {
+	SubscriptionID int
+	// Sequence orders the events of a subscription.
+	Sequence   int
+	Event      string
+	JobID      int
+	PrinterURI string
+	Time       time.Time
+	// Attributes is everything the scheduler returned.
+	Attributes goipp.Attributes
+}
+
+// Notifications is the result of one Get-Notifications.
+type Notifications struct {
+	Events []Event
+	// Interval is how soon to ask again; zero means the subscriptions'
+	// jobs are done and no more events will come.
+	Interval time.Duration
+}
+
+// CreatePrinterSubscription subscribes to the events of dest; an empty
+// dest subscribes to every destination.
+func (c *Client) CreatePrinterSubscription(ctx context.Context, dest string, sub SubscriptionRequest) (*Subscription, error) {
+	req := c.printerRequest(goipp.OpCreatePrinterSubscriptions, dest)
+	addSubscription(req, sub)
+	return c.subscribe(ctx, req)
+}
+
+// CreateJobSubscription subscribes to the events of one job.
+func (c *Client) CreateJobSubscription(ctx context.Context, jobID int, sub SubscriptionRequest) (*Subscription, error) {
+	req := c.jobRequest(goipp.OpCreateJobSubscriptions, jobID)
+	addSubscription(req, sub)
+	return c.subscribe(ctx, req)
+}
+
+func (c *Client) subscribe(ctx context.Context, req *goipp.Message) (*Subscription, error) {
+	resp, err := c.Do(ctx, req, nil)
+	if err != nil {
+		return nil, err
+	}
+	id := attrInt(resp.Subscription, "notify-subscription-id")
+	if id == 0 {
+		return nil, errors.New("cups: no notify-subscription-id in response")
+	}
+	return &Subscription{ID: id}, nil
+}
+
+func addSubscription(req *goipp.Message, sub SubscriptionRequest) {
+	req.Subscription.Add(goipp.MakeAttribute("notify-pull-method", goipp.TagKeyword, goipp.String("ippget")))
+	addKeywords(&req.Subscription, "notify-events", sub.Events)
+	if sub.Lease > 0 {
+		req.Subscription.Add(goipp.MakeAttribute("notify-lease-duration", goipp.TagInteger, goipp.Integer(sub.Lease/time.Second)))
+	}
+	if len(sub.UserData) > 0 {
+		req.Subscription.Add(goipp.MakeAttribute("notify-user-data", goipp.TagString, goipp.Binary(sub.UserData)))
+	}
+}
+
+// RenewSubscription extends a printer subscription's lease; zero takes
+// the default lease.
+func (c *Client) RenewSubscription(ctx context.Context, id int, lease time.Duration) error {
+	req := c.printerRequest(goipp.OpRenewSubscription, "")
+	req.Operation.Add(goipp.MakeAttribute("notify-subscription-id", goipp.TagInteger, goipp.Integer(id)))
+	if lease > 0 {
+		req.Subscription.Add(goipp.MakeAttribute("notify-lease-duration", goipp.TagInteger, goipp.Integer(lease/time.Second)))
+	}
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
+
+// CancelSubscription ends a subscription.
+func (c *Client) CancelSubscription(ctx context.Context, id int) error {
+	req := c.printerRequest(goipp.OpCancelSubscription, "")
+	req.Operation.Add(goipp.MakeAttribute("notify-subscription-id", goipp.TagInteger, goipp.Integer(id)))
+	_, err := c.Do(ctx, req, nil)
+	return err
+}
+
+// GetNotifications returns the events of the subscriptions from the given
+// sequence numbers on (seqs[i] pairs with ids[i]; missing ones start at
+// the first event). With wait the scheduler holds the request until an
+// event arrives or the poll interval passes, so a caller can long-poll
+// rather than sleep between requests.
+func (c *Client) GetNotifications(ctx context.Context, ids, seqs []int, wait bool) (*Notifications, error) {
+	if len(ids) == 0 {
+		return nil, errors.New("cups: no subscription ids")
+	}
+	req := c.printerRequest(goipp.OpGetNotifications, "")
+	req.Operation.Add(intsAttribute("notify-subscription-ids", ids))
+	if len(seqs) > 0 {
+		req.Operation.Add(intsAttribute("notify-sequence-numbers", seqs))
+	}
+	timeout := c.timeout
+	if wait {
+		req.Operation.Add(goipp.MakeAttribute("notify-wait", goipp.TagBoolean, goipp.Boolean(true)))
+		// The scheduler holds a waiting request for up to its poll
+		// interval, which is at most a minute.
+		timeout += time.Minute
+	}
+	resp, err := c.do(ctx, req, nil, timeout)
+	if err != nil {
+		return nil, err
+	}
+	out := &Notifications{Interval: time.Duration(attrInt(resp.Operation, "notify-get-interval")) * time.Second}
+	for _, group := range resp.Groups {
+		if group.Tag != goipp.TagEventNotificationGroup {
+			continue
+		}
+		out.Events = append(out.Events, Event{
+			SubscriptionID: attrInt(group.Attrs, "notify-subscription-id"),
+			Sequence:       attrInt(group.Attrs, "notify-sequence-number"),
+			Event:          attrString(group.Attrs, "notify-event"),
+			JobID:          attrInt(group.Attrs, "notify-job-id"),
+			PrinterURI:     attrString(group.Attrs, "notify-printer-uri"),
+			Time:           attrTime(group.Attrs, "printer-state-change-time"),
+			Attributes:     group.Attrs,
+		})
+	}
+	return out, nil
+}
+
+// Watch long-polls the subscriptions and calls fn for every event in
+// order until ctx is done, fn returns an error, or the scheduler reports
+// that no more events will come (then Watch returns nil).
+func (c *Client) Watch(ctx context.Context, ids []int, fn func(Event) error) error {
+	next := make([]int, len(ids))
+	index := make(map[int]int, len(ids))
+	for i, id := range ids {
+		next[i] = 1
+		index[id] = i
+	}
+	for {
+		n, err := c.GetNotifications(ctx, ids, next, true)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		for _, ev := range n.Events {
+			if i, ok := index[ev.SubscriptionID]; ok && ev.Sequence >= next[i] {
+				next[i] = ev.Sequence + 1
+			}
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+		if n.Interval == 0 {
+			return nil
+		}
+		// No sleep: a waiting request already took up to the interval.
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+}
+
+func intsAttribute(name string, values []int) goipp.Attribute {
+	vals := make([]goipp.Value, 0, len(values))
+	for _, v := range values {
+		vals = append(vals, goipp.Integer(v))
+	}
+	return goipp.MakeAttr(name, goipp.TagInteger, vals[0], vals[1:]...)
+}
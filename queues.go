@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/declare"
+	"cupsgolang/internal/store"
+)
+
+// runConfig implements "cupsgolang config": export the printers and classes
+// as a declarative YAML or JSON document, or apply such a document to the
+// database.
+func runConfig(args []string) int {
+	usage := "Usage: cupsgolang config export [-o file] [--format yaml|json]\n" +
+		"       cupsgolang config apply [--dry-run] [--prune] file|-"
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	switch args[0] {
+	case "export":
+		return runConfigExport(args[1:])
+	case "apply":
+		return runConfigApply(args[1:])
+	case "-h", "-help", "--help":
+		fmt.Println(usage)
+		return 0
+	}
+	fmt.Fprintf(os.Stderr, "cupsgolang config: unknown command %q\n%s\n", args[0], usage)
+	return 2
+}
+
+func runConfigExport(args []string) int {
+	fs := flag.NewFlagSet("config export", flag.ContinueOnError)
+	output := fs.String("o", "", "write the document to this file instead of standard output")
+	format := fs.String("format", "", "yaml or json (default: from the -o extension, else yaml)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cupsgolang config export [-o file] [--format yaml|json]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format == "" {
+		*format = "yaml"
+		if strings.EqualFold(filepath.Ext(*output), ".json") {
+			*format = "json"
+		}
+	}
+	if *format != "yaml" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "cupsgolang config export: unknown format %q\n", *format)
+		return 2
+	}
+
+	ctx := context.Background()
+	cfg := config.Load()
+	st, err := store.Open(ctx, cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config export: failed to open store: %v\n", err)
+		return 1
+	}
+	defer st.Close()
+	doc, err := declare.Export(ctx, st)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config export: %v\n", err)
+		return 1
+	}
+
+	var buf bytes.Buffer
+	if *format == "json" {
+		err = doc.EncodeJSON(&buf)
+	} else {
+		buf.WriteString("# cupsgolang printers and classes; apply with \"cupsgolang config apply\"\n")
+		err = doc.EncodeYAML(&buf)
+	}
+	if err == nil {
+		if *output != "" {
+			err = os.WriteFile(*output, buf.Bytes(), 0644)
+		} else {
+			_, err = os.Stdout.Write(buf.Bytes())
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config export: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runConfigApply(args []string) int {
+	fs := flag.NewFlagSet("config apply", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "show the changes without making them")
+	prune := fs.Bool("prune", false, "remove printers and classes the document does not list")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cupsgolang config apply [--dry-run] [--prune] file|-")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	var data []byte
+	var err error
+	if name := fs.Arg(0); name == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config apply: %v\n", err)
+		return 1
+	}
+	doc, err := declare.Decode(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config apply: %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+
+	ctx := context.Background()
+	cfg := config.Load()
+	if err := os.MkdirAll(cfg.DataDir, 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config apply: %v\n", err)
+		return 1
+	}
+	st, err := store.Open(ctx, cfg.DBPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config apply: failed to open store: %v\n", err)
+		return 1
+	}
+	defer st.Close()
+
+	result, err := declare.Apply(ctx, st, doc, declare.ApplyOptions{DryRun: *dryRun, Prune: *prune, PPDDir: cfg.PPDDir})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cupsgolang config apply: %v\n", err)
+		return 1
+	}
+	result.WriteText(os.Stdout)
+	if !*dryRun && len(result.Changes) > 0 {
+		// Keep printers.conf/classes.conf in step, as migrate does.
+		if err := config.SyncToConf(ctx, cfg.ConfDir, st); err != nil {
+			fmt.Fprintf(os.Stderr, "cupsgolang config apply: failed to write %s: %v\n", cfg.ConfDir, err)
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log/slog"
+	"reflect"
+	"sync"
+
+	"cupsgolang/internal/config"
+	"cupsgolang/internal/logging"
+	"cupsgolang/internal/scheduler"
+	"cupsgolang/internal/server"
+)
+
+// configureLogging applies the log settings from cfg. It is called at startup
+// and again on every reload.
+func configureLogging(cfg config.Config) *slog.Logger {
+	logging.Configure(
+		cfg.ErrorLogPath,
+		cfg.AccessLogPath,
+		cfg.PageLogPath,
+		cfg.MaxLogSize,
+		cfg.AccessLogLevel,
+		cfg.PageLogFormat,
+	)
+	logging.SetFilePerm(cfg.LogFilePerm)
+	logging.ConfigureAudit(cfg.AuditLogPath, cfg.MaxLogSize)
+	logging.ConfigureErrorLog(cfg.LogLevel, cfg.LogFormat)
+	logger := logging.Logger()
+	slog.SetDefault(logger)
+	return logger
+}
+
+// reloader re-reads cupsd.conf, the policies and the MIME database and swaps
+// them into the running server and scheduler. Listeners, the database and the
+// spool are opened once at startup, so changes to those settings are only
+// reported.
+type reloader struct {
+	mu    sync.Mutex
+	cfg   config.Config
+	mime  *config.MimeDB
+	srv   *server.Server
+	sched *scheduler.Scheduler
+	conns *server.ConnLimiter
+}
+
+func (r *reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cfg := config.Load()
+	logger := configureLogging(cfg)
+	policy := config.LoadPolicy(cfg.ConfDir)
+	mimeDB, err := config.LoadMimeDB(cfg.ConfDir)
+	if err != nil || mimeDB == nil {
+		logger.Warn("failed to reload mime db, keeping the previous one", "err", err)
+		mimeDB = r.mime
+	}
+	for _, name := range restartOnlyChanges(r.cfg, cfg) {
+		logger.Warn("setting changed but takes effect only after a restart", "setting", name)
+	}
+
+	r.srv.Reload(cfg, policy)
+	if r.conns != nil {
+		r.conns.SetLimits(cfg.MaxClients, cfg.MaxClientsPerHost)
+	}
+	r.sched.Reload(cfg, mimeDB)
+	r.cfg = cfg
+	r.mime = mimeDB
+	logger.Info("Configuration reloaded", "conf-dir", cfg.ConfDir)
+	return nil
+}
+
+// restartOnlyChanges names the settings that differ between old and cfg but
+// are only read at startup.
+func restartOnlyChanges(old, cfg config.Config) []string {
+	checks := []struct {
+		name     string
+		old, new any
+	}{
+		{"Listen", old.ListenHTTP, cfg.ListenHTTP},
+		{"SSLListen", old.ListenHTTPS, cfg.ListenHTTPS},
+		{"ListenAddr", old.ListenAddr, cfg.ListenAddr},
+		{"TLSEnabled", old.TLSEnabled, cfg.TLSEnabled},
+		{"TLSOnly", old.TLSOnly, cfg.TLSOnly},
+		{"ServerCertificate", old.TLSCertPath, cfg.TLSCertPath},
+		{"ServerKey", old.TLSKeyPath, cfg.TLSKeyPath},
+		{"DBPath", old.DBPath, cfg.DBPath},
+		{"SpoolDir", old.SpoolDir, cfg.SpoolDir},
+		{"MaxEvents", old.MaxEvents, cfg.MaxEvents},
+		{"Timeout (request headers)", old.Timeout, cfg.Timeout},
+		{"KeepAlive", old.KeepAlive, cfg.KeepAlive},
+		{"KeepAliveTimeout", old.KeepAliveTimeout, cfg.KeepAliveTimeout},
+		{"SSLOptions", old.SSLOptions, cfg.SSLOptions},
+	}
+	var changed []string
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.old, c.new) {
+			changed = append(changed, c.name)
+		}
+	}
+	return changed
+}